@@ -0,0 +1,223 @@
+// Package fakecp is an in-process control plane for drone tests. It serves
+// the routes a drone calls (register, profiles, work queue, results, runs and
+// heartbeat), records what it receives, and can be scripted to fail any of
+// them.
+package fakecp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// Route names accepted by Fail.
+const (
+	RouteRegister  = "register"
+	RouteProfile   = "profile"
+	RouteWork      = "work"
+	RouteResults   = "results"
+	RouteRuns      = "runs"
+	RouteHeartbeat = "heartbeat"
+)
+
+// Profile is a registry profile envelope as the drone reads it.
+type Profile struct {
+	ID       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Content  string `json:"content"`
+	Enabled  *bool  `json:"enabled,omitempty"`
+	Interval string `json:"interval,omitempty"`
+	Jitter   string `json:"jitter,omitempty"`
+}
+
+// Run is a run report posted to /api/runs.
+type Run struct {
+	RunID     string         `json:"run_id"`
+	DroneID   string         `json:"drone_id"`
+	ProfileID string         `json:"profile_id"`
+	Status    string         `json:"status"`
+	RowsOut   int            `json:"rows_out"`
+	Error     string         `json:"error,omitempty"`
+	Meta      map[string]any `json:"meta,omitempty"`
+}
+
+// Result is a batch posted to /api/results.
+type Result struct {
+	DroneID   string           `json:"drone_id"`
+	ProfileID string           `json:"profile_id"`
+	RunID     string           `json:"run_id"`
+	Data      []map[string]any `json:"data"`
+	Meta      map[string]any   `json:"meta,omitempty"`
+}
+
+// Server is the fake control plane. Its URL is the drone's CONTROL_PLANE.
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	assigned   []string
+	profiles   map[string]Profile
+	work       map[string][]string
+	failures   map[string]int
+	runs       []Run
+	results    []Result
+	heartbeats []string
+	calls      map[string]int
+}
+
+// New starts a fake control plane that assigns the given profiles to every
+// drone that registers. Close it when done.
+func New(assigned ...string) *Server {
+	s := &Server{
+		assigned: assigned,
+		profiles: make(map[string]Profile),
+		work:     make(map[string][]string),
+		failures: make(map[string]int),
+		calls:    make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// SetProfile adds or replaces a profile.
+func (s *Server) SetProfile(p Profile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profiles[p.ID] = p
+}
+
+// SetWork queues forced runs for a drone; the queue is returned on every
+// poll until replaced.
+func (s *Server) SetWork(droneID string, profileIDs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.work[droneID] = profileIDs
+}
+
+// Fail makes route answer status with an error body; 0 restores it.
+func (s *Server) Fail(route string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if status == 0 {
+		delete(s.failures, route)
+		return
+	}
+	s.failures[route] = status
+}
+
+// Runs returns the run reports received so far.
+func (s *Server) Runs() []Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Run(nil), s.runs...)
+}
+
+// Results returns the result batches received so far.
+func (s *Server) Results() []Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Result(nil), s.results...)
+}
+
+// Heartbeats returns the drone ids of the heartbeats received so far.
+func (s *Server) Heartbeats() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.heartbeats...)
+}
+
+// Calls counts requests per route, failed ones included.
+func (s *Server) Calls(route string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[route]
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	route, arg := classify(r)
+	if route == "" {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "not_found"})
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[route]++
+	if status := s.failures[route]; status != 0 {
+		writeJSON(w, status, map[string]any{"error": "scripted_failure", "route": route})
+		return
+	}
+
+	switch route {
+	case RouteRegister:
+		var req struct {
+			ID string `json:"id"`
+		}
+		_ = json.Unmarshal(body, &req)
+		writeJSON(w, http.StatusOK, map[string]any{"id": req.ID, "status": "registered", "assigned_profiles": s.assigned})
+	case RouteProfile:
+		p, ok := s.profiles[arg]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]any{"error": "profile_not_found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	case RouteWork:
+		writeJSON(w, http.StatusOK, map[string]any{"drone_id": arg, "profiles": s.work[arg]})
+	case RouteResults:
+		var res Result
+		if err := json.Unmarshal(body, &res); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_json"})
+			return
+		}
+		s.results = append(s.results, res)
+		writeJSON(w, http.StatusOK, map[string]any{"status": "accepted", "count": len(res.Data)})
+	case RouteRuns:
+		var run Run
+		if err := json.Unmarshal(body, &run); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_json"})
+			return
+		}
+		s.runs = append(s.runs, run)
+		writeJSON(w, http.StatusOK, map[string]any{"status": "recorded"})
+	case RouteHeartbeat:
+		var req struct {
+			ID string `json:"id"`
+		}
+		_ = json.Unmarshal(body, &req)
+		s.heartbeats = append(s.heartbeats, req.ID)
+		writeJSON(w, http.StatusOK, map[string]any{"status": "ok"})
+	}
+}
+
+// classify maps a request to its route name and path argument (a profile or
+// drone id), or "" when the fake does not serve it.
+func classify(r *http.Request) (string, string) {
+	path := r.URL.Path
+	switch {
+	case r.Method == http.MethodPost && path == "/api/drones/register":
+		return RouteRegister, ""
+	case r.Method == http.MethodPost && path == "/api/drones/heartbeat":
+		return RouteHeartbeat, ""
+	case r.Method == http.MethodPost && path == "/api/results":
+		return RouteResults, ""
+	case r.Method == http.MethodPost && path == "/api/runs":
+		return RouteRuns, ""
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/api/profiles/"):
+		return RouteProfile, strings.TrimPrefix(path, "/api/profiles/")
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/api/drones/") && strings.HasSuffix(path, "/work"):
+		return RouteWork, strings.TrimSuffix(strings.TrimPrefix(path, "/api/drones/"), "/work")
+	}
+	return "", ""
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
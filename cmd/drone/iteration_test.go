@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ap3pp3rs94/Chartly2.0/cmd/drone/internal/fakecp"
+)
+
+const testProfileYAML = `id: %s
+name: Test
+version: "1"
+source:
+  type: http_rest
+  url: https://example.test/data
+mapping:
+  price: measures.price
+`
+
+// droneHarness runs iteration against a fake control plane with a fixed
+// clock, an in-memory source and no retry pauses.
+type droneHarness struct {
+	cp      *fakecp.Server
+	droneID string
+	now     time.Time
+	lastRun map[string]time.Time
+	state   *droneState
+	fetched []string
+}
+
+func newDroneHarness(t *testing.T, assigned ...string) *droneHarness {
+	t.Helper()
+	h := &droneHarness{
+		cp:      fakecp.New(assigned...),
+		droneID: "drone-test",
+		now:     time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		lastRun: make(map[string]time.Time),
+		state:   loadDroneState(filepath.Join(t.TempDir(), "state.json")),
+	}
+	t.Cleanup(h.cp.Close)
+
+	prevClock, prevFetch, prevBackoff := clock, fetchProfile, retryBackoff
+	t.Cleanup(func() { clock, fetchProfile, retryBackoff = prevClock, prevFetch, prevBackoff })
+	clock = func() time.Time { return h.now }
+	retryBackoff = []time.Duration{0, 0, 0}
+	fetchProfile = func(p Profile) ([]byte, error) {
+		h.fetched = append(h.fetched, p.ID)
+		return []byte(`[{"price":"1.5"},{"price":"2"}]`), nil
+	}
+	return h
+}
+
+func (h *droneHarness) profile(id string, enabled bool, interval string) {
+	h.cp.SetProfile(fakecp.Profile{
+		ID:       id,
+		Content:  strings.ReplaceAll(testProfileYAML, "%s", id),
+		Enabled:  &enabled,
+		Interval: interval,
+	})
+}
+
+func (h *droneHarness) run(assigned ...string) error {
+	return iteration(context.Background(), h.cp.Client(), h.cp.URL, h.droneID, assigned, h.lastRun, h.state)
+}
+
+func TestIterationRegistersAndRuns(t *testing.T) {
+	h := newDroneHarness(t, "p1")
+	h.profile("p1", true, "")
+
+	var reg registerResponse
+	if err := doJSON(context.Background(), h.cp.Client(), http.MethodPost, h.cp.URL+"/api/drones/register", map[string]any{"id": h.droneID}, &reg); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.run(reg.AssignedProfiles...); err != nil {
+		t.Fatalf("iteration: %v", err)
+	}
+	results, runs := h.cp.Results(), h.cp.Runs()
+	if len(results) != 1 || results[0].ProfileID != "p1" || len(results[0].Data) != 2 {
+		t.Fatalf("results %+v", results)
+	}
+	if results[0].Data[0]["measures"].(map[string]any)["price"] != 1.5 {
+		t.Fatalf("mapping not applied: %+v", results[0].Data[0])
+	}
+	if len(runs) != 1 || runs[0].Status != "succeeded" || runs[0].RowsOut != 2 || runs[0].RunID != results[0].RunID {
+		t.Fatalf("runs %+v", runs)
+	}
+	if hb := h.cp.Heartbeats(); len(hb) != 1 || hb[0] != h.droneID {
+		t.Fatalf("heartbeats %v", hb)
+	}
+	if !h.lastRun["p1"].Equal(h.now) {
+		t.Fatalf("lastRun %v, want the injected clock", h.lastRun["p1"])
+	}
+}
+
+func TestIterationSkipsDisabledProfile(t *testing.T) {
+	h := newDroneHarness(t)
+	h.profile("off", false, "")
+	if err := h.run("off"); err != nil {
+		t.Fatalf("iteration: %v", err)
+	}
+	if len(h.fetched) != 0 || len(h.cp.Runs()) != 0 || len(h.cp.Results()) != 0 {
+		t.Fatalf("disabled profile ran: fetched=%v runs=%+v", h.fetched, h.cp.Runs())
+	}
+	if len(h.cp.Heartbeats()) != 1 {
+		t.Fatal("heartbeat should still be sent")
+	}
+}
+
+func TestIterationForcedRunOverridesDisabledAndSchedule(t *testing.T) {
+	h := newDroneHarness(t)
+	h.profile("off", false, "1h")
+	h.lastRun["off"] = h.now.Add(-time.Minute) // not due either
+	h.cp.SetWork(h.droneID, "off")
+	if err := h.run("off"); err != nil {
+		t.Fatalf("iteration: %v", err)
+	}
+	if runs := h.cp.Runs(); len(runs) != 1 || runs[0].Status != "succeeded" {
+		t.Fatalf("forced run: %+v", runs)
+	}
+}
+
+func TestIterationResultsPostFailureReportsPartial(t *testing.T) {
+	h := newDroneHarness(t)
+	h.profile("p1", true, "")
+	h.cp.Fail(fakecp.RouteResults, http.StatusServiceUnavailable)
+
+	err := h.run("p1")
+	if err == nil || !strings.Contains(err.Error(), "results_post_failed id=p1") {
+		t.Fatalf("err %v", err)
+	}
+	if n := h.cp.Calls(fakecp.RouteResults); n != retryMaxAttempts {
+		t.Fatalf("results attempts %d, want %d", n, retryMaxAttempts)
+	}
+	runs := h.cp.Runs()
+	if len(runs) != 1 || runs[0].Status != "partial" || runs[0].RowsOut != 2 || !strings.Contains(runs[0].Error, "503") {
+		t.Fatalf("runs %+v", runs)
+	}
+	if _, ok := h.lastRun["p1"]; ok {
+		t.Fatal("a failed post must not count as a run")
+	}
+	if h.state.bodyHash("p1") != "" {
+		t.Fatal("body hash recorded for an unstored result; the retry would be skipped as unchanged")
+	}
+}
+
+func TestIterationJoinsHeartbeatFailure(t *testing.T) {
+	h := newDroneHarness(t)
+	h.cp.Fail(fakecp.RouteHeartbeat, http.StatusBadRequest)
+
+	err := h.run("missing")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"profile_get_failed id=missing", "heartbeat_failed"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("err %q lacks %q", err, want)
+		}
+	}
+}
+
+func TestIterationSchedule(t *testing.T) {
+	cases := []struct {
+		name     string
+		interval string
+		last     time.Duration // before now; 0 = never ran
+		wantRun  bool
+	}{
+		{"never ran", "1h", 0, true},
+		{"not due", "1h", 30 * time.Minute, false},
+		{"due", "1h", 61 * time.Minute, true},
+		{"no interval", "", time.Second, true},
+		{"bad interval", "soon", time.Second, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newDroneHarness(t)
+			h.profile("p1", true, tc.interval)
+			if tc.last > 0 {
+				h.lastRun["p1"] = h.now.Add(-tc.last)
+			}
+			if err := h.run("p1"); err != nil {
+				t.Fatalf("iteration: %v", err)
+			}
+			if ran := len(h.cp.Runs()) == 1; ran != tc.wantRun {
+				t.Fatalf("ran=%v, want %v", ran, tc.wantRun)
+			}
+		})
+	}
+}
+
+func TestIterationPostsFetchProvenance(t *testing.T) {
+	h := newDroneHarness(t)
+	h.cp.SetProfile(fakecp.Profile{
+		ID:      "keyed",
+		Content: strings.Replace(strings.ReplaceAll(testProfileYAML, "%s", "keyed"), "/data", "/data?key=${SOURCE_KEY}", 1),
+	})
+	body := `[{"price":"1.5"},{"price":"2"}]`
+	fetchProfile = func(Profile) ([]byte, error) {
+		h.now = h.now.Add(1200 * time.Millisecond)
+		return []byte(body), nil
+	}
+	if err := h.run("keyed"); err != nil {
+		t.Fatalf("iteration: %v", err)
+	}
+
+	results := h.cp.Results()
+	if len(results) != 1 {
+		t.Fatalf("results %+v", results)
+	}
+	meta := results[0].Meta
+	want := map[string]any{
+		"source_url":        "https://example.test/data?key=${SOURCE_KEY}",
+		"pages_fetched":     float64(1),
+		"bytes_fetched":     float64(len(body)),
+		"fetch_duration_ms": float64(1200),
+		"mapping_version":   mappingVersion(map[string]string{"price": "measures.price"}),
+	}
+	for k, v := range want {
+		if meta[k] != v {
+			t.Errorf("meta[%s] = %v, want %v", k, meta[k], v)
+		}
+	}
+	if !strings.HasPrefix(meta["mapping_version"].(string), "sha256:") {
+		t.Fatalf("mapping_version %v", meta["mapping_version"])
+	}
+	if mappingVersion(map[string]string{"price": "measures.close"}) == meta["mapping_version"] {
+		t.Fatal("different mappings share a version")
+	}
+}
+
+func TestIterationReprojectsAfterProfileEdit(t *testing.T) {
+	h := newDroneHarness(t)
+	h.profile("p1", true, "")
+	for i := 0; i < 2; i++ {
+		if err := h.run("p1"); err != nil {
+			t.Fatalf("iteration %d: %v", i, err)
+		}
+	}
+	if runs := h.cp.Runs(); len(runs) != 2 || runs[1].Meta["unchanged"] != true || len(h.cp.Results()) != 1 {
+		t.Fatalf("same body and profile should be skipped: runs %+v", runs)
+	}
+
+	// Same body, new mapping: the rows must be projected again.
+	h.cp.SetProfile(fakecp.Profile{
+		ID:      "p1",
+		Content: strings.Replace(strings.ReplaceAll(testProfileYAML, "%s", "p1"), "measures.price", "measures.close", 1),
+	})
+	if err := h.run("p1"); err != nil {
+		t.Fatalf("iteration after edit: %v", err)
+	}
+	results := h.cp.Results()
+	if len(results) != 2 || results[1].Data[0]["measures"].(map[string]any)["close"] != 1.5 {
+		t.Fatalf("edited profile was not re-projected: %+v", results)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
@@ -28,6 +29,22 @@ const (
 	maxBodyBytes     = 8 << 20
 	defaultInterval  = 5 * time.Minute
 	retryMaxAttempts = 3
+	// gzipMinBytes is the body size from which results are compressed when
+	// CHARTLY_COMPRESS_RESULTS is set; smaller bodies are not worth it.
+	gzipMinBytes = 16 << 10
+)
+
+// compressResults gzips large POST /api/results bodies. The aggregator
+// inflates Content-Encoding: gzip; other control-plane routes do not, so only
+// results are compressed.
+var compressResults bool
+
+// Seams for tests: the clock used for schedules and run timestamps, how a
+// profile's source is fetched, and the pauses between doJSON retries.
+var (
+	clock        = time.Now
+	fetchProfile = FetchProfileSource
+	retryBackoff = []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second}
 )
 
 type registerResponse struct {
@@ -59,15 +76,27 @@ type workResponse struct {
 }
 
 type runReport struct {
-	RunID      string `json:"run_id"`
-	DroneID    string `json:"drone_id"`
-	ProfileID  string `json:"profile_id"`
-	StartedAt  string `json:"started_at"`
-	FinishedAt string `json:"finished_at"`
-	Status     string `json:"status"`
-	RowsOut    int    `json:"rows_out"`
-	DurationMs int64  `json:"duration_ms"`
-	Error      string `json:"error,omitempty"`
+	RunID      string         `json:"run_id"`
+	DroneID    string         `json:"drone_id"`
+	ProfileID  string         `json:"profile_id"`
+	StartedAt  string         `json:"started_at"`
+	FinishedAt string         `json:"finished_at"`
+	Status     string         `json:"status"`
+	RowsOut    int            `json:"rows_out"`
+	DurationMs int64          `json:"duration_ms"`
+	Error      string         `json:"error,omitempty"`
+	Meta       map[string]any `json:"meta,omitempty"`
+}
+
+// resultsMeta is the provenance posted with a run's results and kept by
+// the aggregator in run_meta. SourceURL is the profile's URL before
+// placeholder expansion, so keys in ${VARS} never leave the drone.
+type resultsMeta struct {
+	SourceURL       string `json:"source_url,omitempty"`
+	PagesFetched    int    `json:"pages_fetched"`
+	BytesFetched    int    `json:"bytes_fetched"`
+	FetchDurationMs int64  `json:"fetch_duration_ms"`
+	MappingVersion  string `json:"mapping_version,omitempty"`
 }
 
 type sourceSpec struct {
@@ -136,6 +165,8 @@ func main() {
 		}
 	}
 
+	compressResults = envBool("CHARTLY_COMPRESS_RESULTS")
+
 	client := &http.Client{Timeout: httpTimeout}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -165,11 +196,16 @@ func main() {
 	}
 
 	lastRun := make(map[string]time.Time)
+	statePath := strings.TrimSpace(os.Getenv("DRONE_STATE_FILE"))
+	if statePath == "" {
+		statePath = defaultStateFile
+	}
+	state := loadDroneState(statePath)
 
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	if err := iteration(ctx, client, controlPlane, droneID, assigned, lastRun); err != nil {
+	if err := iteration(ctx, client, controlPlane, droneID, assigned, lastRun, state); err != nil {
 		logLine("WARN", droneID, "iteration_completed_with_errors err=%s", err.Error())
 	}
 
@@ -179,17 +215,18 @@ func main() {
 			logLine("INFO", droneID, "shutdown_complete")
 			return
 		case <-ticker.C:
-			if err := iteration(ctx, client, controlPlane, droneID, assigned, lastRun); err != nil {
+			if err := iteration(ctx, client, controlPlane, droneID, assigned, lastRun, state); err != nil {
 				logLine("WARN", droneID, "iteration_completed_with_errors err=%s", err.Error())
 			}
 		}
 	}
 }
 
-func iteration(ctx context.Context, client *http.Client, cp, droneID string, assigned []string, lastRun map[string]time.Time) error {
+func iteration(ctx context.Context, client *http.Client, cp, droneID string, assigned []string, lastRun map[string]time.Time, state *droneState) error {
 	var iterErr error
 	executed := 0
 	skipped := 0
+	unchanged := 0
 
 	forced := fetchWorkQueue(ctx, client, cp, droneID)
 
@@ -221,19 +258,39 @@ func iteration(ctx context.Context, client *http.Client, cp, droneID string, ass
 		}
 
 		runID := mustUUIDv4()
-		started := time.Now().UTC()
+		started := clock().UTC()
 
 		var p Profile
 		if err := yaml.Unmarshal([]byte(env.Content), &p); err != nil {
 			iterErr = joinErr(iterErr, fmt.Errorf("profile_yaml_decode_failed id=%s err=%w", pid, err))
-			reportRun(ctx, client, cp, runID, droneID, pid, started, time.Now().UTC(), "failed", 0, time.Since(started).Milliseconds(), "invalid_profile_yaml")
+			reportRun(ctx, client, cp, runID, droneID, pid, started, clock().UTC(), "failed", 0, clock().Sub(started).Milliseconds(), "invalid_profile_yaml", nil)
+			continue
+		}
+
+		fetchStarted := clock()
+		raw, err := fetchProfile(p)
+		fetchMs := clock().Sub(fetchStarted).Milliseconds()
+		if err != nil {
+			iterErr = joinErr(iterErr, fmt.Errorf("process_failed id=%s err=%w", pid, err))
+			reportRun(ctx, client, cp, runID, droneID, pid, started, clock().UTC(), "failed", 0, clock().Sub(started).Milliseconds(), capError(err.Error()), nil)
 			continue
 		}
 
-		results, err := ProcessProfile(p)
+		digest := profileContentDigest(env.Content)
+		hash, same := unchangedBody(state, p, pid, digest, raw)
+		if same {
+			finished := clock().UTC()
+			reportRun(ctx, client, cp, runID, droneID, pid, started, finished, "succeeded", 0, finished.Sub(started).Milliseconds(), "",
+				map[string]any{"unchanged": true, "body_sha256": hash})
+			lastRun[pid] = finished
+			unchanged++
+			continue
+		}
+
+		results, err := ProjectRecords(p, raw)
 		if err != nil {
 			iterErr = joinErr(iterErr, fmt.Errorf("process_failed id=%s err=%w", pid, err))
-			reportRun(ctx, client, cp, runID, droneID, pid, started, time.Now().UTC(), "failed", 0, time.Since(started).Milliseconds(), capError(err.Error()))
+			reportRun(ctx, client, cp, runID, droneID, pid, started, clock().UTC(), "failed", 0, clock().Sub(started).Milliseconds(), capError(err.Error()), nil)
 			continue
 		}
 
@@ -242,17 +299,30 @@ func iteration(ctx context.Context, client *http.Client, cp, droneID string, ass
 			"profile_id": pid,
 			"run_id":     runID,
 			"data":       results,
+			"meta": resultsMeta{
+				SourceURL:       strings.TrimSpace(p.Source.URL),
+				PagesFetched:    1,
+				BytesFetched:    len(raw),
+				FetchDurationMs: fetchMs,
+				MappingVersion:  mappingVersion(p.Mapping),
+			},
 		}
 		var resp any
-		if err := doJSON(ctx, client, http.MethodPost, cp+"/api/results", payload, &resp); err != nil {
+		if err := doJSONGzip(ctx, client, http.MethodPost, cp+"/api/results", payload, &resp, compressResults); err != nil {
 			iterErr = joinErr(iterErr, fmt.Errorf("results_post_failed id=%s err=%w", pid, err))
-			reportRun(ctx, client, cp, runID, droneID, pid, started, time.Now().UTC(), "partial", len(results), time.Since(started).Milliseconds(), capError(err.Error()))
+			reportRun(ctx, client, cp, runID, droneID, pid, started, clock().UTC(), "partial", len(results), clock().Sub(started).Milliseconds(), capError(err.Error()), nil)
 			continue
 		}
 
-		finished := time.Now().UTC()
+		// Only remember the hash once the results are stored, so failed posts are retried.
+		if err := state.setBodyHash(pid, hash, digest); err != nil {
+			logLine("WARN", droneID, "state_save_failed err=%s", err.Error())
+		}
+
+		finished := clock().UTC()
 		duration := finished.Sub(started).Milliseconds()
-		reportRun(ctx, client, cp, runID, droneID, pid, started, finished, "succeeded", len(results), duration, "")
+		reportRun(ctx, client, cp, runID, droneID, pid, started, finished, "succeeded", len(results), duration, "",
+			map[string]any{"body_sha256": hash})
 
 		lastRun[pid] = finished
 		executed++
@@ -263,7 +333,7 @@ func iteration(ctx context.Context, client *http.Client, cp, droneID string, ass
 		iterErr = joinErr(iterErr, fmt.Errorf("heartbeat_failed err=%w", err))
 	}
 
-	logLine("INFO", droneID, "executed=%d skipped=%d heartbeat=sent", executed, skipped)
+	logLine("INFO", droneID, "executed=%d skipped=%d unchanged=%d heartbeat=sent", executed, skipped, unchanged)
 	return iterErr
 }
 
@@ -735,7 +805,7 @@ func isDue(env profileEnvelope, last time.Time, droneID, profileID string) (bool
 	}
 
 	next := last.Add(d + deterministicJitter(droneID, profileID, jitter))
-	return time.Now().UTC().After(next), true
+	return clock().UTC().After(next), true
 }
 
 func deterministicJitter(droneID, profileID string, window time.Duration) time.Duration {
@@ -758,7 +828,7 @@ func binaryToInt(b []byte) int64 {
 	return v
 }
 
-func reportRun(ctx context.Context, client *http.Client, cp, runID, droneID, profileID string, started, finished time.Time, status string, rows int, durationMs int64, errMsg string) {
+func reportRun(ctx context.Context, client *http.Client, cp, runID, droneID, profileID string, started, finished time.Time, status string, rows int, durationMs int64, errMsg string, meta map[string]any) {
 	r := runReport{
 		RunID:      runID,
 		DroneID:    droneID,
@@ -769,11 +839,22 @@ func reportRun(ctx context.Context, client *http.Client, cp, runID, droneID, pro
 		RowsOut:    rows,
 		DurationMs: durationMs,
 		Error:      capError(errMsg),
+		Meta:       meta,
 	}
 	var resp any
 	_ = doJSON(ctx, client, http.MethodPost, cp+"/api/runs", r, &resp)
 }
 
+// mappingVersion identifies a profile's mapping block by the digest of its
+// canonical JSON, so rows shaped by different mappings can be told apart.
+func mappingVersion(mapping map[string]string) string {
+	if len(mapping) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(canonicalJSONBytes(mapping))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
 func capError(s string) string {
 	s = strings.TrimSpace(s)
 	if len(s) > 2048 {
@@ -783,17 +864,30 @@ func capError(s string) string {
 }
 
 func doJSON(ctx context.Context, client *http.Client, method, url string, body any, out any) error {
+	return doJSONGzip(ctx, client, method, url, body, out, false)
+}
+
+// doJSONGzip is doJSON that, when compress is set, sends bodies of at least
+// gzipMinBytes gzipped with Content-Encoding: gzip.
+func doJSONGzip(ctx context.Context, client *http.Client, method, url string, body any, out any, compress bool) error {
 	var bodyBytes []byte
+	gzipped := false
 	if body != nil {
 		b, err := json.Marshal(body)
 		if err != nil {
 			return err
 		}
 		bodyBytes = b
+		if compress && len(b) >= gzipMinBytes {
+			if bodyBytes, err = gzipBytes(b); err != nil {
+				return err
+			}
+			gzipped = true
+		}
 	}
 
 	var lastErr error
-	backoff := []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second}
+	backoff := retryBackoff
 
 	for attempt := 1; attempt <= retryMaxAttempts; attempt++ {
 		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(bodyBytes))
@@ -804,6 +898,9 @@ func doJSON(ctx context.Context, client *http.Client, method, url string, body a
 		if body != nil {
 			req.Header.Set("Content-Type", "application/json")
 		}
+		if gzipped {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
 
 		resp, err := client.Do(req)
 		if err != nil {
@@ -846,6 +943,26 @@ func doJSON(ctx context.Context, client *http.Client, method, url string, body a
 	return lastErr
 }
 
+func gzipBytes(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func envBool(key string) bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(key))) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
 func sleepWithContext(ctx context.Context, d time.Duration) {
 	t := time.NewTimer(d)
 	defer t.Stop()
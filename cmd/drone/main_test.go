@@ -0,0 +1,55 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDoJSONGzipCompressesLargeBodies(t *testing.T) {
+	var gotEncoding string
+	var gotBody map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotEncoding = r.Header.Get("Content-Encoding")
+		var body io.Reader = r.Body
+		if gotEncoding == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("server: %v", err)
+				return
+			}
+			body = zr
+		}
+		gotBody = nil
+		_ = json.NewDecoder(body).Decode(&gotBody)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	large := map[string]string{"v": strings.Repeat("x", gzipMinBytes)}
+	small := map[string]string{"v": "x"}
+	cases := []struct {
+		name     string
+		body     map[string]string
+		compress bool
+		want     string
+	}{
+		{"large compressed", large, true, "gzip"},
+		{"small stays plain", small, true, ""},
+		{"flag off", large, false, ""},
+	}
+	for _, tc := range cases {
+		var out map[string]any
+		if err := doJSONGzip(context.Background(), srv.Client(), http.MethodPost, srv.URL, tc.body, &out, tc.compress); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if gotEncoding != tc.want || gotBody["v"] != tc.body["v"] {
+			t.Fatalf("%s: encoding %q, body intact=%v", tc.name, gotEncoding, gotBody["v"] == tc.body["v"])
+		}
+	}
+}
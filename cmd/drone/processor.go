@@ -30,19 +30,31 @@ type SourceConfig struct {
 	Type string `yaml:"type"` // "http_rest"
 	URL  string `yaml:"url"`
 	Auth string `yaml:"auth"` // "none"
+
+	// SkipUnchanged=false forces full processing even when the body hash is unchanged.
+	SkipUnchanged *bool `yaml:"skip_unchanged,omitempty" json:"skip_unchanged,omitempty"`
 }
 
 func ProcessProfile(profile Profile) ([]map[string]interface{}, error) {
+	raw, err := FetchProfileSource(profile)
+	if err != nil {
+		return []map[string]interface{}{}, err
+	}
+	return ProjectRecords(profile, raw)
+}
+
+// FetchProfileSource resolves the profile source URL and returns the raw body.
+func FetchProfileSource(profile Profile) ([]byte, error) {
 	rawURL := strings.TrimSpace(profile.Source.URL)
 	if rawURL == "" {
 		logProc("missing_source_url profile_id=%s", profile.ID)
-		return []map[string]interface{}{}, fmt.Errorf("missing_source_url")
+		return nil, fmt.Errorf("missing_source_url")
 	}
 
 	expandedURL, err := ExpandEnvPlaceholders(rawURL)
 	if err != nil {
 		logProc("missing_env_var profile_id=%s err=%s", profile.ID, err.Error())
-		return []map[string]interface{}{}, err
+		return nil, err
 	}
 
 	client := &http.Client{Timeout: 30 * time.Second}
@@ -50,12 +62,16 @@ func ProcessProfile(profile Profile) ([]map[string]interface{}, error) {
 	raw, err := fetchSource(client, expandedURL)
 	if err != nil {
 		logProc("fetch_failed host=%s err=%s", safeHost(expandedURL), err.Error())
-		return []map[string]interface{}{}, err
+		return nil, err
 	}
+	return raw, nil
+}
 
+// ProjectRecords parses a fetched body and applies the profile mapping.
+func ProjectRecords(profile Profile, raw []byte) ([]map[string]interface{}, error) {
 	var parsed any
 	if err := json.Unmarshal(raw, &parsed); err != nil {
-		logProc("json_parse_failed host=%s err=%s", safeHost(expandedURL), err.Error())
+		logProc("json_parse_failed host=%s err=%s", safeHost(profile.Source.URL), err.Error())
 		return []map[string]interface{}{}, err
 	}
 
@@ -610,6 +626,19 @@ func cloneMapWithoutKey(in map[string]interface{}, key string) map[string]interf
 	return out
 }
 
+// bodyHash hashes a fetched body after normalizing JSON key order and
+// whitespace, so re-serialized but identical payloads compare equal.
+func bodyHash(raw []byte) string {
+	var parsed any
+	if err := json.Unmarshal(raw, &parsed); err == nil {
+		raw = canonicalJSONBytes(parsed)
+	} else {
+		raw = bytes.TrimSpace(raw)
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
 func canonicalJSONBytes(v any) []byte {
 	b, _ := json.Marshal(v)
 	var buf bytes.Buffer
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const defaultStateFile = "drone_state.json"
+
+// droneState is persisted between iterations (and restarts) so the drone can
+// recognise sources whose content has not changed since the last run.
+// ProfileDigests records the profile each body was projected with, so editing
+// the profile invalidates the skip.
+type droneState struct {
+	path string
+	mu   sync.Mutex
+
+	BodyHashes     map[string]string `json:"body_hashes"`
+	ProfileDigests map[string]string `json:"profile_digests"`
+}
+
+func loadDroneState(path string) *droneState {
+	st := &droneState{path: path, BodyHashes: make(map[string]string), ProfileDigests: make(map[string]string)}
+	if path == "" {
+		return st
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return st
+	}
+	_ = json.Unmarshal(b, st)
+	if st.BodyHashes == nil {
+		st.BodyHashes = make(map[string]string)
+	}
+	if st.ProfileDigests == nil {
+		st.ProfileDigests = make(map[string]string)
+	}
+	return st
+}
+
+func (st *droneState) bodyHash(profileID string) string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.BodyHashes[profileID]
+}
+
+func (st *droneState) profileDigest(profileID string) string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.ProfileDigests[profileID]
+}
+
+// setBodyHash records the body last processed for a profile and the digest
+// of the profile content it was processed with.
+func (st *droneState) setBodyHash(profileID, hash, digest string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.BodyHashes[profileID] = hash
+	st.ProfileDigests[profileID] = digest
+	return st.saveLocked()
+}
+
+func (st *droneState) saveLocked() error {
+	if st.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(st.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	tmp := st.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, st.path)
+}
+
+// profileContentDigest identifies the profile YAML a body is projected with;
+// any edit (mapping, fields, version) changes it.
+func profileContentDigest(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// unchangedBody reports whether raw matches the last processed body for the
+// profile and the profile is still the digest it was processed with. It
+// always returns the body hash so the caller can record it.
+func unchangedBody(st *droneState, p Profile, profileID, digest string, raw []byte) (string, bool) {
+	hash := bodyHash(raw)
+	if p.Source.SkipUnchanged != nil && !*p.Source.SkipUnchanged {
+		return hash, false
+	}
+	prev := st.bodyHash(profileID)
+	return hash, prev != "" && prev == hash && st.profileDigest(profileID) == digest
+}
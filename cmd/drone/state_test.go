@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestUnchangedBodySkip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	st := loadDroneState(path)
+	p := Profile{ID: "p1"}
+
+	steps := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{"first fetch", `{"a":1,"b":[1,2]}`, false},
+		{"identical body", `{"a":1,"b":[1,2]}`, true},
+		{"reformatted body", "{\n  \"b\": [1, 2],\n  \"a\": 1\n}", true},
+		{"changed body", `{"a":2,"b":[1,2]}`, false},
+		{"changed body repeated", `{"a":2,"b":[1,2]}`, true},
+	}
+	for _, step := range steps {
+		hash, same := unchangedBody(st, p, "p1", "d1", []byte(step.body))
+		if same != step.want {
+			t.Fatalf("%s: unchanged=%v want %v", step.name, same, step.want)
+		}
+		if !same {
+			if err := st.setBodyHash("p1", hash, "d1"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// The hash survives a restart via the state file.
+	reloaded := loadDroneState(path)
+	if _, same := unchangedBody(reloaded, p, "p1", "d1", []byte(`{"a":2,"b":[1,2]}`)); !same {
+		t.Fatal("expected persisted hash to match after reload")
+	}
+	// An edited profile re-projects the same body.
+	if _, same := unchangedBody(reloaded, p, "p1", "d2", []byte(`{"a":2,"b":[1,2]}`)); same {
+		t.Fatal("a profile edit must invalidate the skip")
+	}
+}
+
+func TestUnchangedBodyOverride(t *testing.T) {
+	st := loadDroneState("")
+	off := false
+	p := Profile{ID: "p1", Source: SourceConfig{SkipUnchanged: &off}}
+	hash, _ := unchangedBody(st, p, "p1", "d1", []byte(`[1,2,3]`))
+	_ = st.setBodyHash("p1", hash, "d1")
+	if _, same := unchangedBody(st, p, "p1", "d1", []byte(`[1,2,3]`)); same {
+		t.Fatal("skip_unchanged=false must force full processing")
+	}
+}
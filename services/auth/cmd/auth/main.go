@@ -10,7 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -42,10 +42,14 @@ type config struct {
 	TenantHeader    string
 	LocalTenant     string
 	HMACSecret      []byte
+	SigningAlg      string // "HS256" (default) or "RS256"
+	RSAKeyFile      string
+	Issuer          string
 }
 type tokenHeader struct {
 	Alg string `json:"alg"`
 	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"`
 }
 type tokenClaims struct {
 	TenantID  string   `json:"tenant_id"`
@@ -55,6 +59,13 @@ type tokenClaims struct {
 	Scopes    []string `json:"scopes,omitempty"`
 	TokenID   string   `json:"token_id"` // deterministic id
 	RequestID string   `json:"request_id,omitempty"`
+
+	// Registered claims so standard JWT verifiers (the gateway) can check
+	// subject, expiry and issuer without knowing the fields above.
+	Issuer  string `json:"iss,omitempty"`
+	Sub     string `json:"sub,omitempty"`
+	IatUnix int64  `json:"iat,omitempty"`
+	ExpUnix int64  `json:"exp,omitempty"`
 }
 type issueRequest struct {
 	Subject   string   `json:"subject"`
@@ -71,16 +82,23 @@ type revokeRequest struct {
 type server struct {
 	cfg  config
 	reqN uint64
+	rsa  *rsaSigner // set when cfg.SigningAlg is RS256
 
 	mu      sync.Mutex
 	revoked map[string]struct{} // token_id -> revoked
 }
 
 func main() {
+	setupLogging()
 	cfg := loadConfig()
 
+	if cfg.SigningAlg != "HS256" && cfg.SigningAlg != "RS256" {
+		logJSON("error", "unsupported_jwt_alg", map[string]any{"alg": cfg.SigningAlg})
+		os.Exit(1)
+	}
+
 	// Enforce secret in non-local environments.
-	if strings.ToLower(cfg.Env) != "local" && len(cfg.HMACSecret) == 0 {
+	if strings.ToLower(cfg.Env) != "local" && cfg.SigningAlg == "HS256" && len(cfg.HMACSecret) == 0 {
 		logJSON("error", "missing_secret", map[string]any{"env": cfg.Env})
 		os.Exit(1)
 	}
@@ -88,9 +106,23 @@ func main() {
 		cfg:     cfg,
 		revoked: make(map[string]struct{}),
 	}
+	if cfg.SigningAlg == "RS256" {
+		if strings.ToLower(cfg.Env) != "local" && strings.TrimSpace(cfg.RSAKeyFile) == "" {
+			logJSON("error", "missing_rsa_key_file", map[string]any{"env": cfg.Env})
+			os.Exit(1)
+		}
+		signer, generated, err := loadRSASigner(cfg.RSAKeyFile)
+		if err != nil {
+			logJSON("error", "rsa_key_load_failed", map[string]any{"path": cfg.RSAKeyFile, "error": err.Error()})
+			os.Exit(1)
+		}
+		s.rsa = signer
+		logJSON("info", "rsa_key_loaded", map[string]any{"path": cfg.RSAKeyFile, "kid": signer.kid, "generated": generated})
+	}
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", s.handleHealth)
 	mux.HandleFunc("/ready", s.handleReady)
+	mux.HandleFunc("/.well-known/jwks.json", s.handleJWKS)
 	mux.HandleFunc("/v0/token", s.withMiddleware(s.handleIssue))
 	mux.HandleFunc("/v0/verify", s.withMiddleware(s.handleVerify))
 	mux.HandleFunc("/v0/revoke", s.withMiddleware(s.handleRevoke))
@@ -176,9 +208,13 @@ func (s *server) handleIssue(w http.ResponseWriter, r *http.Request, tenantID, r
 		ExpiresAt: te.UTC().Format(time.RFC3339Nano),
 		Scopes:    scopes,
 		RequestID: reqID,
+		Issuer:    s.cfg.Issuer,
+		Sub:       sub,
+		IatUnix:   ti.Unix(),
+		ExpUnix:   te.Unix(),
 	}
 	claims.TokenID = deterministicTokenID(claims)
-	tok, err := signToken(s.cfg.HMACSecret, claims)
+	tok, err := s.signToken(claims)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "sign failed"})
 		return
@@ -210,7 +246,7 @@ func (s *server) handleVerify(w http.ResponseWriter, r *http.Request, tenantID,
 		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "token required"})
 		return
 	}
-	claims, err := verifyToken(s.cfg.HMACSecret, tok)
+	claims, err := s.verifyToken(tok)
 	if err != nil {
 		writeJSON(w, http.StatusUnauthorized, map[string]any{"error": "invalid token"})
 		return
@@ -262,7 +298,7 @@ func (s *server) handleRevoke(w http.ResponseWriter, r *http.Request, tenantID,
 		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "token required"})
 		return
 	}
-	claims, err := verifyToken(s.cfg.HMACSecret, tok)
+	claims, err := s.verifyToken(tok)
 	if err != nil {
 		writeJSON(w, http.StatusUnauthorized, map[string]any{"error": "invalid token"})
 		return
@@ -314,6 +350,20 @@ func (s *server) withMiddleware(next func(http.ResponseWriter, *http.Request, st
 		if strings.ToLower(s.cfg.Env) == "local" && tenantID == "" {
 			tenantID = s.cfg.LocalTenant
 		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		w = rec
+		defer func() {
+			slog.InfoContext(r.Context(), "request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", rec.status,
+				"duration_ms", time.Since(start).Milliseconds(),
+				"request_id", reqID,
+				"tenant_id", tenantID,
+				"remote", r.RemoteAddr,
+			)
+		}()
 		defer func() {
 			if rec := recover(); rec != nil {
 				logJSON("error", "panic_recovered", map[string]any{
@@ -323,13 +373,6 @@ func (s *server) withMiddleware(next func(http.ResponseWriter, *http.Request, st
 				writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "internal"})
 			}
 		}()
-		logJSON("info", "request", map[string]any{
-			"method":     r.Method,
-			"path":       r.URL.Path,
-			"tenant_id":  tenantID,
-			"request_id": reqID,
-			"remote":     r.RemoteAddr,
-		})
 		next(w, r, tenantID, reqID)
 	}
 }
@@ -358,11 +401,59 @@ func (s *server) tenantID(r *http.Request) (string, error) {
 // Token signing / verification (HS256)
 ////////////////////////////////////////////////////////////////////////////////
 
+// signToken signs with the deployment's algorithm: RS256 when an RSA key is
+// loaded, HS256 otherwise.
+func (s *server) signToken(claims tokenClaims) (string, error) {
+	if s.rsa == nil {
+		return signToken(s.cfg.HMACSecret, claims)
+	}
+	unsigned, err := encodeUnsigned(tokenHeader{Alg: "RS256", Typ: "JWT", Kid: s.rsa.kid}, claims)
+	if err != nil {
+		return "", err
+	}
+	sig, err := s.rsa.sign(unsigned)
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + sig, nil
+}
+
+// verifyToken only accepts tokens signed with the deployment's algorithm, so
+// an RS256 deployment never falls back to a shared secret.
+func (s *server) verifyToken(tok string) (tokenClaims, error) {
+	if s.rsa == nil {
+		return verifyToken(s.cfg.HMACSecret, tok)
+	}
+	parts := strings.Split(tok, ".")
+	if len(parts) != 3 {
+		return tokenClaims{}, errors.New("bad token")
+	}
+	hb, err := b64urlDecode(parts[0])
+	if err != nil {
+		return tokenClaims{}, errors.New("bad header")
+	}
+	var h tokenHeader
+	if err := json.Unmarshal(hb, &h); err != nil || h.Alg != "RS256" || h.Kid != s.rsa.kid {
+		return tokenClaims{}, errors.New("bad header")
+	}
+	if err := s.rsa.verify(parts[0]+"."+parts[1], parts[2]); err != nil {
+		return tokenClaims{}, err
+	}
+	return decodeClaims(parts[1])
+}
 func signToken(secret []byte, claims tokenClaims) (string, error) {
 	if len(secret) == 0 {
 		return "", errors.New("missing secret")
 	}
-	h := tokenHeader{Alg: "HS256", Typ: "JWT"}
+	unsigned, err := encodeUnsigned(tokenHeader{Alg: "HS256", Typ: "JWT"}, claims)
+	if err != nil {
+		return "", err
+	}
+	sig := hmacSHA256(secret, []byte(unsigned))
+	t64 := b64url(sig)
+	return unsigned + "." + t64, nil
+}
+func encodeUnsigned(h tokenHeader, claims tokenClaims) (string, error) {
 	hb, err := json.Marshal(h)
 	if err != nil {
 		return "", err
@@ -375,13 +466,7 @@ func signToken(secret []byte, claims tokenClaims) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	h64 := b64url(hb)
-	p64 := b64url(pb)
-	unsigned := h64 + "." + p64
-
-	sig := hmacSHA256(secret, []byte(unsigned))
-	t64 := b64url(sig)
-	return unsigned + "." + t64, nil
+	return b64url(hb) + "." + b64url(pb), nil
 }
 func verifyToken(secret []byte, tok string) (tokenClaims, error) {
 	parts := strings.Split(tok, ".")
@@ -397,7 +482,10 @@ func verifyToken(secret []byte, tok string) (tokenClaims, error) {
 	if !hmac.Equal(want, got) {
 		return tokenClaims{}, errors.New("sig mismatch")
 	}
-	pb, err := b64urlDecode(parts[1])
+	return decodeClaims(parts[1])
+}
+func decodeClaims(p64 string) (tokenClaims, error) {
+	pb, err := b64urlDecode(p64)
 	if err != nil {
 		return tokenClaims{}, errors.New("bad payload")
 	}
@@ -495,6 +583,7 @@ func loadConfig() config {
 		secret = "dev-secret"
 	}
 	secB := []byte(secret)
+	alg := strings.ToUpper(strings.TrimSpace(getenv("AUTH_JWT_ALG", "HS256")))
 	return config{
 		Env:             env,
 		Addr:            addr,
@@ -508,6 +597,9 @@ func loadConfig() config {
 		TenantHeader:    tenantHeader,
 		LocalTenant:     localTenant,
 		HMACSecret:      secB,
+		SigningAlg:      alg,
+		RSAKeyFile:      strings.TrimSpace(getenv("AUTH_RSA_KEY_FILE", "")),
+		Issuer:          strings.TrimSpace(getenv("AUTH_JWT_ISSUER", "")),
 	}
 }
 func decodeJSONStrict(r io.Reader, out any) error {
@@ -533,26 +625,6 @@ func writeJSON(w http.ResponseWriter, code int, v any) {
 	enc := json.NewEncoder(w)
 	_ = enc.Encode(v)
 }
-func logJSON(level string, event string, fields map[string]any) {
-	// Stable encoding: convert fields into sorted kv array.
-	type kv struct {
-		K string `json:"k"`
-		V any    `json:"v"`
-	}
-	keys := make([]string, 0, len(fields))
-	for k := range fields {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-	arr := make([]kv, 0, len(keys)+2)
-	arr = append(arr, kv{K: "level", V: level})
-	arr = append(arr, kv{K: "event", V: event})
-	for _, k := range keys {
-		arr = append(arr, kv{K: k, V: fields[k]})
-	}
-	b, _ := json.Marshal(arr)
-	log.Print(string(b))
-}
 func parseRFC3339(s string) (time.Time, error) {
 	s = normCollapse(s)
 	if s == "" {
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// Token signing (RS256) and JWKS publishing
+////////////////////////////////////////////////////////////////////////////////
+
+const rsaKeyBits = 2048
+
+// rsaSigner holds the deployment's RS256 private key. kid is the RFC 7638
+// thumbprint of the public key, so it is stable across restarts for the same
+// key file and changes automatically on rotation.
+type rsaSigner struct {
+	key *rsa.PrivateKey
+	kid string
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+func newRSASigner(key *rsa.PrivateKey) *rsaSigner {
+	return &rsaSigner{key: key, kid: rsaThumbprint(&key.PublicKey)}
+}
+
+// loadRSASigner reads a PEM private key (PKCS#1 or PKCS#8) from path. A
+// missing file is created with a freshly generated key; an empty path yields
+// an in-memory key that does not survive a restart.
+func loadRSASigner(path string) (*rsaSigner, bool, error) {
+	if strings.TrimSpace(path) == "" {
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, false, err
+		}
+		return newRSASigner(key), true, nil
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, false, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, false, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, false, err
+		}
+		out := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		if err := os.WriteFile(path, out, 0o600); err != nil {
+			return nil, false, err
+		}
+		return newRSASigner(key), true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	key, err := parseRSAPrivateKeyPEM(raw)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", path, err)
+	}
+	return newRSASigner(key), false, nil
+}
+
+func parseRSAPrivateKeyPEM(raw []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("no pem block")
+	}
+	rk, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, errors.New("unsupported private key")
+		}
+		var ok bool
+		if rk, ok = k.(*rsa.PrivateKey); !ok {
+			return nil, errors.New("private key is not rsa")
+		}
+	}
+	if rk.N.BitLen() < rsaKeyBits {
+		return nil, fmt.Errorf("rsa key must be at least %d bits", rsaKeyBits)
+	}
+	return rk, nil
+}
+
+func (s *rsaSigner) sign(unsigned string) (string, error) {
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return b64url(sig), nil
+}
+
+func (s *rsaSigner) verify(unsigned, sig64 string) error {
+	sig, err := b64urlDecode(sig64)
+	if err != nil {
+		return errors.New("bad sig")
+	}
+	sum := sha256.Sum256([]byte(unsigned))
+	if err := rsa.VerifyPKCS1v15(&s.key.PublicKey, crypto.SHA256, sum[:], sig); err != nil {
+		return errors.New("sig mismatch")
+	}
+	return nil
+}
+
+func (s *rsaSigner) jwks() jwkSet {
+	pub := &s.key.PublicKey
+	return jwkSet{Keys: []jwk{{
+		Kty: "RSA",
+		Kid: s.kid,
+		Use: "sig",
+		Alg: "RS256",
+		N:   b64url(pub.N.Bytes()),
+		E:   b64url(big.NewInt(int64(pub.E)).Bytes()),
+	}}}
+}
+
+// rsaThumbprint is the RFC 7638 JWK thumbprint: the SHA-256 of the required
+// members in lexicographic order, without whitespace.
+func rsaThumbprint(pub *rsa.PublicKey) string {
+	b, _ := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{
+		E:   b64url(big.NewInt(int64(pub.E)).Bytes()),
+		Kty: "RSA",
+		N:   b64url(pub.N.Bytes()),
+	})
+	sum := sha256.Sum256(b)
+	return b64url(sum[:])
+}
+
+// handleJWKS publishes the public signing key for verifiers such as the
+// gateway (AUTH_JWT_JWKS_URL). HS256 deployments have nothing to publish.
+func (s *server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method not allowed"})
+		return
+	}
+	if s.rsa == nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "jwks not enabled"})
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, s.rsa.jwks())
+}
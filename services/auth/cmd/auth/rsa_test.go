@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRS256Server(t *testing.T) *server {
+	t.Helper()
+	signer, _, err := loadRSASigner("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &server{
+		cfg:     config{Env: "local", LocalTenant: "local", SigningAlg: "RS256", HMACSecret: []byte("dev-secret")},
+		rsa:     signer,
+		revoked: make(map[string]struct{}),
+	}
+}
+
+func issueTestToken(t *testing.T, s *server) string {
+	t.Helper()
+	now := time.Now().UTC()
+	body, _ := json.Marshal(issueRequest{
+		Subject:   "alice",
+		IssuedAt:  now.Format(time.RFC3339),
+		ExpiresAt: now.Add(time.Hour).Format(time.RFC3339),
+	})
+	rec := httptest.NewRecorder()
+	s.withMiddleware(s.handleIssue)(rec, httptest.NewRequest(http.MethodPost, "/v0/token", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("issue: %d %s", rec.Code, rec.Body.String())
+	}
+	var out struct {
+		Token string `json:"token"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	return out.Token
+}
+
+func TestRS256TokenVerifiesAgainstServedJWKS(t *testing.T) {
+	s := newRS256Server(t)
+	tok := issueTestToken(t, s)
+	parts := strings.Split(tok, ".")
+	if len(parts) != 3 {
+		t.Fatalf("malformed token %q", tok)
+	}
+	hb, _ := b64urlDecode(parts[0])
+	var h tokenHeader
+	_ = json.Unmarshal(hb, &h)
+	if h.Alg != "RS256" || h.Kid != s.rsa.kid {
+		t.Fatalf("unexpected header %+v", h)
+	}
+	pb, _ := b64urlDecode(parts[1])
+	var claims map[string]any
+	_ = json.Unmarshal(pb, &claims)
+	if claims["sub"] != "alice" || claims["exp"] == nil {
+		t.Fatalf("registered claims missing: %v", claims)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleJWKS(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("jwks: %d", rec.Code)
+	}
+	var set jwkSet
+	if err := json.Unmarshal(rec.Body.Bytes(), &set); err != nil || len(set.Keys) != 1 {
+		t.Fatalf("jwks body %s", rec.Body.String())
+	}
+	k := set.Keys[0]
+	if k.Kid != h.Kid || k.Kty != "RSA" || k.Alg != "RS256" {
+		t.Fatalf("unexpected jwk %+v", k)
+	}
+	n, _ := b64urlDecode(k.N)
+	e, _ := b64urlDecode(k.E)
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	sig, _ := b64urlDecode(parts[2])
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig); err != nil {
+		t.Fatalf("signature does not verify with published key: %v", err)
+	}
+
+	if _, err := s.verifyToken(tok); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	hs, _ := signToken(s.cfg.HMACSecret, tokenClaims{TenantID: "local", Subject: "alice", IssuedAt: "2026-01-01T00:00:00Z", ExpiresAt: "2026-01-02T00:00:00Z"})
+	if _, err := s.verifyToken(hs); err == nil {
+		t.Fatal("RS256 deployment accepted an HS256 token")
+	}
+}
+
+func TestJWKSNotEnabledForHS256(t *testing.T) {
+	s := &server{cfg: config{SigningAlg: "HS256"}}
+	rec := httptest.NewRecorder()
+	s.handleJWKS(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestLoadRSASignerPersistsGeneratedKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "auth.pem")
+	first, generated, err := loadRSASigner(path)
+	if err != nil || !generated {
+		t.Fatalf("generate: generated=%v err=%v", generated, err)
+	}
+	second, generated, err := loadRSASigner(path)
+	if err != nil || generated {
+		t.Fatalf("reload: generated=%v err=%v", generated, err)
+	}
+	if first.kid != second.kid {
+		t.Fatalf("kid changed across reload: %s != %s", first.kid, second.kid)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- compression at rest ---
+//
+// Rows whose canonical JSON is at least AGG_COMPRESS_MIN_BYTES long are
+// stored gzip-compressed in data_z with data_enc = 'gzip' and an empty data
+// column. Rows written before compression was enabled (or below the
+// threshold) keep data_enc NULL and are read as before, so existing
+// databases migrate lazily as new rows arrive.
+
+const dataEncGzip = "gzip"
+
+// compressMinBytesFromEnv returns the threshold; 0 disables compression.
+func compressMinBytesFromEnv() int {
+	v := strings.TrimSpace(os.Getenv("AGG_COMPRESS_MIN_BYTES"))
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		slog.Warn("env_int_invalid", "key", "AGG_COMPRESS_MIN_BYTES", "value", v)
+		return 0
+	}
+	return n
+}
+
+// blobType is the column type for compressed payloads.
+func (s *server) blobType() string {
+	if s.dbDriver == "postgres" {
+		return "BYTEA"
+	}
+	return "BLOB"
+}
+
+// encodeData picks the stored form of one canonical row. blob and enc are
+// nil for plain rows so the driver writes NULL.
+func (s *server) encodeData(canon []byte) (plain string, blob []byte, enc any) {
+	if s.compressMin <= 0 || len(canon) < s.compressMin {
+		storageStats.record(len(canon), len(canon), false)
+		return string(canon), nil, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(canon); err != nil || zw.Close() != nil || buf.Len() >= len(canon) {
+		// Not worth it (or failed): keep the row readable as plain JSON.
+		storageStats.record(len(canon), len(canon), false)
+		return string(canon), nil, nil
+	}
+	storageStats.record(len(canon), buf.Len(), true)
+	return "", buf.Bytes(), dataEncGzip
+}
+
+// decodeData returns the JSON of a scanned data, data_z, data_enc triple.
+func decodeData(plain string, blob []byte, enc sql.NullString) (json.RawMessage, error) {
+	if !enc.Valid || enc.String == "" {
+		return json.RawMessage(plain), nil
+	}
+	if enc.String != dataEncGzip {
+		return nil, fmt.Errorf("unknown data encoding %q", enc.String)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(blob))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(b), nil
+}
+
+// storageCounters tracks payloads encoded since start, for /metrics. Each
+// posted row is counted once even though it lands in results and records.
+type storageCounters struct {
+	mu             sync.Mutex
+	rowsPlain      int64
+	rowsCompressed int64
+	rawBytes       int64
+	storedBytes    int64
+}
+
+var storageStats storageCounters
+
+func (c *storageCounters) record(raw, stored int, compressed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if compressed {
+		c.rowsCompressed++
+	} else {
+		c.rowsPlain++
+	}
+	c.rawBytes += int64(raw)
+	c.storedBytes += int64(stored)
+}
+
+func (c *storageCounters) snapshot() map[string]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ratio := 1.0
+	if c.storedBytes > 0 {
+		ratio = float64(c.rawBytes) / float64(c.storedBytes)
+	}
+	return map[string]any{
+		"data_rows_plain_total":      c.rowsPlain,
+		"data_rows_compressed_total": c.rowsCompressed,
+		"data_raw_bytes_total":       c.rawBytes,
+		"data_stored_bytes_total":    c.storedBytes,
+		"data_compression_ratio":     ratio,
+	}
+}
+
+// statsAcc accumulates /results/stats aggregates for rows the database
+// cannot see into, i.e. compressed ones.
+type statsAcc struct {
+	rows, numeric int64
+	min, max, sum float64
+	seen          bool
+}
+
+func (a *statsAcc) add(v float64) {
+	a.numeric++
+	a.sum += v
+	if !a.seen || v < a.min {
+		a.min = v
+	}
+	if !a.seen || v > a.max {
+		a.max = v
+	}
+	a.seen = true
+}
+
+// compressedFieldStats decodes the compressed rows of profileID in the window
+// and aggregates field the way the SQL path does: only JSON numbers count.
+func (s *server) compressedFieldStats(profileID, field string, since, until time.Time) (statsAcc, error) {
+	var acc statsAcc
+	conds := []string{"profile_id = " + s.ph(1), "data_enc IS NOT NULL"}
+	args := []any{profileID}
+	conds, args, _ = s.windowConds(conds, args, 2, since, until)
+	rows, err := s.db.Query(`SELECT data_z, data_enc FROM results WHERE `+strings.Join(conds, " AND "), args...)
+	if err != nil {
+		return acc, err
+	}
+	defer rows.Close()
+	path := strings.Split(field, ".")
+	for rows.Next() {
+		var blob []byte
+		var enc sql.NullString
+		if err := rows.Scan(&blob, &enc); err != nil {
+			return acc, err
+		}
+		raw, err := decodeData("", blob, enc)
+		if err != nil {
+			return acc, err
+		}
+		acc.rows++
+		var doc any
+		if json.Unmarshal(raw, &doc) != nil {
+			continue
+		}
+		for _, key := range path {
+			obj, ok := doc.(map[string]any)
+			if !ok {
+				doc = nil
+				break
+			}
+			doc = obj[key]
+		}
+		if v, ok := doc.(float64); ok {
+			acc.add(v)
+		}
+	}
+	return acc, rows.Err()
+}
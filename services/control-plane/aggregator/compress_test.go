@@ -0,0 +1,190 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// watchlistRows mimics a crypto-watchlist drone: Binance 24h tickers, one row
+// per symbol, where the keys dominate the payload.
+func watchlistRows(run, n int) []string {
+	out := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		price := 100 + float64(i)*1.25 + float64(run)
+		out = append(out, fmt.Sprintf(`{"symbol":"SYM%03dUSDT","priceChange":"%.4f","priceChangePercent":"%.3f",`+
+			`"weightedAvgPrice":"%.4f","prevClosePrice":"%.4f","lastPrice":%.4f,"lastQty":"%.3f","bidPrice":"%.4f",`+
+			`"bidQty":"%.3f","askPrice":"%.4f","askQty":"%.3f","openPrice":"%.4f","highPrice":"%.4f","lowPrice":"%.4f",`+
+			`"volume":"%.2f","quoteVolume":"%.2f","openTime":%d,"closeTime":%d,"firstId":%d,"lastId":%d,"count":%d,`+
+			`"source":{"exchange":"binance","endpoint":"/api/v3/ticker/24hr","run":%d}}`,
+			i, price*0.01, 1.0+float64(i%7), price*0.99, price*0.98, price, 0.5+float64(i%3), price-0.01,
+			12.5, price+0.01, 8.25, price*0.98, price*1.03, price*0.95,
+			1e5+float64(i)*10, 1e7+float64(i)*100, 1767225600000+int64(run)*60000, 1767312000000+int64(run)*60000,
+			1000*i, 1000*i+999, 999, run))
+	}
+	return out
+}
+
+func postRows(t testing.TB, s *server, profileID, runID string, rows []string) {
+	t.Helper()
+	body := `{"drone_id":"d1","profile_id":"` + profileID + `","run_id":"` + runID + `","data":[` + strings.Join(rows, ",") + `]}`
+	rec := httptest.NewRecorder()
+	s.handleResults(rec, httptest.NewRequest(http.MethodPost, "/results", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("post %s: %d %s", runID, rec.Code, rec.Body.String())
+	}
+}
+
+func sameJSONSet(t *testing.T, name string, got []json.RawMessage, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %d rows, want %d", name, len(got), len(want))
+	}
+	seen := make(map[string]bool, len(want))
+	for _, w := range want {
+		var v any
+		_ = json.Unmarshal([]byte(w), &v)
+		b, _ := json.Marshal(v)
+		seen[string(b)] = true
+	}
+	for _, g := range got {
+		var v any
+		if err := json.Unmarshal(g, &v); err != nil {
+			t.Fatalf("%s: row is not JSON: %q", name, g)
+		}
+		b, _ := json.Marshal(v)
+		if !seen[string(b)] {
+			t.Fatalf("%s: unexpected row %s", name, g)
+		}
+	}
+}
+
+func TestCompressedDataRoundTrip(t *testing.T) {
+	s := newTestServer(t)
+	before := storageStats.snapshot()
+
+	// Old rows, written before compression was turned on, stay plain.
+	plain := watchlistRows(1, 3)
+	postRows(t, s, "p1", "r1", plain)
+	s.compressMin = 256
+	packed := watchlistRows(2, 4)
+	postRows(t, s, "p1", "r2", packed)
+	all := append(append([]string{}, plain...), packed...)
+
+	var nPlain, nGzip int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM results WHERE data_enc IS NULL AND data <> ''`).Scan(&nPlain); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM results WHERE data_enc = 'gzip' AND data = '' AND data_z IS NOT NULL`).Scan(&nGzip); err != nil {
+		t.Fatal(err)
+	}
+	if nPlain != 3 || nGzip != 4 {
+		t.Fatalf("stored forms: plain=%d gzip=%d", nPlain, nGzip)
+	}
+
+	get := func(h http.HandlerFunc, target string) []byte {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", target, rec.Code, rec.Body.String())
+		}
+		return rec.Body.Bytes()
+	}
+	type resultRow struct {
+		Data json.RawMessage `json:"data"`
+	}
+	dataOf := func(rows []resultRow) []json.RawMessage {
+		out := make([]json.RawMessage, 0, len(rows))
+		for _, r := range rows {
+			out = append(out, r.Data)
+		}
+		return out
+	}
+
+	var list []resultRow
+	if err := json.Unmarshal(get(s.handleResults, "/results?profile_id=p1"), &list); err != nil {
+		t.Fatal(err)
+	}
+	sameJSONSet(t, "results", dataOf(list), all)
+
+	var page struct {
+		Rows []resultRow `json:"rows"`
+	}
+	if err := json.Unmarshal(get(s.handleResults, "/results?profile_id=p1&cursor=&limit=100"), &page); err != nil {
+		t.Fatal(err)
+	}
+	sameJSONSet(t, "paged results", dataOf(page.Rows), all)
+
+	var records []json.RawMessage
+	if err := json.Unmarshal(get(s.handleRecords, "/records?profile_id=p1"), &records); err != nil {
+		t.Fatal(err)
+	}
+	sameJSONSet(t, "records", records, all)
+
+	// lastPrice is numeric on every row: 101,102.25,103.5 plain; 102..105.75 compressed.
+	var stats map[string]any
+	if err := json.Unmarshal(get(s.handleResultsStats, "/results/stats?profile_id=p1&field=lastPrice"), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats["rows"] != 7.0 || stats["count"] != 7.0 || stats["min"] != 101.0 || stats["max"] != 105.75 || stats["sum"] != 722.25 {
+		t.Fatalf("stats across plain and compressed rows: %v", stats)
+	}
+	if err := json.Unmarshal(get(s.handleResultsStats, "/results/stats?profile_id=p1&field=source.run"), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats["count"] != 7.0 || stats["sum"] != 11.0 {
+		t.Fatalf("nested stats: %v", stats)
+	}
+
+	after := storageStats.snapshot()
+	if d := after["data_rows_compressed_total"].(int64) - before["data_rows_compressed_total"].(int64); d != 4 {
+		t.Fatalf("compressed rows counted %d, want 4", d)
+	}
+	if after["data_compression_ratio"].(float64) <= 1 {
+		t.Fatalf("expected a ratio above 1: %v", after)
+	}
+}
+
+func TestDecodeDataRejectsUnknownEncoding(t *testing.T) {
+	got, err := decodeData(`{"a":1}`, nil, sql.NullString{})
+	if err != nil || !reflect.DeepEqual(got, json.RawMessage(`{"a":1}`)) {
+		t.Fatalf("plain row: %q %v", got, err)
+	}
+	if _, err := decodeData("", []byte("x"), sql.NullString{String: "zstd", Valid: true}); err == nil {
+		t.Fatal("expected an error for an unknown encoding")
+	}
+}
+
+// BenchmarkWatchlistStorage reports bytes stored per row for a crypto
+// watchlist with and without compression at rest.
+func BenchmarkWatchlistStorage(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		min  int
+	}{{"plain", 0}, {"gzip", 256}} {
+		b.Run(bc.name, func(b *testing.B) {
+			s := newTestServer(b)
+			s.compressMin = bc.min
+			rows := 0
+			for i := 0; i < b.N; i++ {
+				batch := watchlistRows(i, 50)
+				postRows(b, s, "watch", fmt.Sprintf("r%d", i), batch)
+				rows += len(batch)
+			}
+			var raw, stored int64
+			if err := s.db.QueryRow(`SELECT COALESCE(SUM(LENGTH(data) + COALESCE(LENGTH(data_z), 0)), 0) FROM results`).Scan(&stored); err != nil {
+				b.Fatal(err)
+			}
+			for _, r := range watchlistRows(0, 50) {
+				raw += int64(len(r))
+			}
+			b.ReportMetric(float64(stored)/float64(rows), "stored_B/row")
+			b.ReportMetric(float64(raw)/50, "json_B/row")
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// --- CORS ---
+
+// corsConfig holds the CORS_ALLOWED_ORIGINS allowlist. An empty list keeps
+// the permissive "*" behaviour.
+type corsConfig struct {
+	origins     map[string]struct{} // exact origins, lowercased
+	suffixes    []corsSuffix        // "*.example.com" entries
+	credentials bool                // CORS_ALLOW_CREDENTIALS
+}
+
+// corsSuffix matches any subdomain of host; scheme is empty when the entry
+// did not name one.
+type corsSuffix struct {
+	scheme string
+	host   string // ".example.com"
+}
+
+func loadCORSConfig() corsConfig {
+	cfg := parseCORSOrigins(os.Getenv("CORS_ALLOWED_ORIGINS"))
+	cfg.credentials = envBool("CORS_ALLOW_CREDENTIALS", false)
+	return cfg
+}
+
+// parseCORSOrigins accepts exact origins ("https://app.example.com") and
+// wildcard subdomains ("*.example.com" or "https://*.example.com").
+func parseCORSOrigins(spec string) corsConfig {
+	cfg := corsConfig{origins: make(map[string]struct{})}
+	for _, o := range strings.Split(spec, ",") {
+		o = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(o), "/"))
+		if o == "" {
+			continue
+		}
+		scheme, host, hasScheme := strings.Cut(o, "://")
+		if !hasScheme {
+			scheme, host = "", o
+		}
+		if rest, ok := strings.CutPrefix(host, "*."); ok && rest != "" {
+			cfg.suffixes = append(cfg.suffixes, corsSuffix{scheme: scheme, host: "." + rest})
+			continue
+		}
+		cfg.origins[o] = struct{}{}
+	}
+	return cfg
+}
+
+func (c corsConfig) enabled() bool {
+	return len(c.origins) > 0 || len(c.suffixes) > 0
+}
+
+// matches reports whether origin is on the allowlist.
+func (c corsConfig) matches(origin string) bool {
+	origin = strings.ToLower(origin)
+	if _, ok := c.origins[origin]; ok {
+		return true
+	}
+	if len(c.suffixes) == 0 {
+		return false
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, s := range c.suffixes {
+		if (s.scheme == "" || s.scheme == u.Scheme) && strings.HasSuffix(u.Host, s.host) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or ""
+// when it must not be sent. credentials is only ever set for a concrete
+// matching origin, never alongside "*".
+func (c corsConfig) allowOrigin(origin string) (allow string, credentials bool) {
+	if !c.enabled() {
+		return "*", false
+	}
+	if origin == "" || !c.matches(origin) {
+		return "", false
+	}
+	return origin, c.credentials
+}
+
+func withCORS(cfg corsConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allow, credentials := cfg.allowOrigin(r.Header.Get("Origin"))
+			if cfg.enabled() {
+				w.Header().Add("Vary", "Origin")
+			}
+			if allow != "" {
+				w.Header().Set("Access-Control-Allow-Origin", allow)
+			}
+			if credentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "GET,POST,DELETE,OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Request-ID, X-API-Key, X-Principal, X-Tenant-ID")
+			w.Header().Set("Access-Control-Max-Age", "86400")
+
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
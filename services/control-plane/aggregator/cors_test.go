@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSOriginMatching(t *testing.T) {
+	cases := []struct {
+		spec, origin string
+		want         bool
+	}{
+		{"https://app.example.com", "https://app.example.com", true},
+		{"https://app.example.com", "https://APP.example.com", true},
+		{"https://app.example.com", "http://app.example.com", false},
+		{"*.example.com", "https://a.example.com", true},
+		{"*.example.com", "http://a.b.example.com", true},
+		{"*.example.com", "https://example.com", false},
+		{"*.example.com", "https://badexample.com", false},
+		{"*.example.com", "https://a.example.com.evil.io", false},
+		{"https://*.example.com", "http://a.example.com", false},
+		{"https://app.example.com, *.internal.example", "https://ops.internal.example", true},
+	}
+	for _, tc := range cases {
+		if got := parseCORSOrigins(tc.spec).matches(tc.origin); got != tc.want {
+			t.Errorf("spec %q origin %q: got %v, want %v", tc.spec, tc.origin, got, tc.want)
+		}
+	}
+}
+
+func TestCORSHeaders(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	serve := func(cfg corsConfig, origin string) http.Header {
+		req := httptest.NewRequest(http.MethodOptions, "/health", nil)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		withCORS(cfg)(ok).ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("preflight: %d", rec.Code)
+		}
+		return rec.Header()
+	}
+
+	if h := serve(parseCORSOrigins(""), "https://any.example"); h.Get("Access-Control-Allow-Origin") != "*" || h.Get("Vary") != "" {
+		t.Fatalf("unset allowlist should keep *: %v", h)
+	}
+	cfg := parseCORSOrigins("*.example.com")
+	cfg.credentials = true
+	h := serve(cfg, "https://app.example.com")
+	if h.Get("Access-Control-Allow-Origin") != "https://app.example.com" || h.Get("Access-Control-Allow-Credentials") != "true" || h.Get("Vary") != "Origin" {
+		t.Fatalf("matching origin: %v", h)
+	}
+	if h := serve(cfg, "https://evil.io"); h.Get("Access-Control-Allow-Origin") != "" || h.Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatalf("other origin: %v", h)
+	}
+}
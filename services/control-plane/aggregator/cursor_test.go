@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestResultsCursorPagination(t *testing.T) {
+	s := newTestServer(t)
+	insert := func(id, ts string) {
+		t.Helper()
+		if _, err := s.db.Exec(`INSERT INTO results(id, drone_id, profile_id, run_id, timestamp, data) VALUES(?,?,?,?,?,?)`,
+			id, "d1", "p1", "r1", ts, `{}`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 23 rows over 6 timestamps, so page boundaries fall inside ties.
+	want := make(map[string]bool)
+	for i := 0; i < 23; i++ {
+		id := fmt.Sprintf("row-%02d", i)
+		insert(id, fmt.Sprintf("2026-01-01 00:00:%02d", i/4))
+		want[id] = true
+	}
+
+	type page struct {
+		Rows []struct {
+			ID        string `json:"id"`
+			Timestamp string `json:"timestamp"`
+		} `json:"rows"`
+		NextCursor *string `json:"next_cursor"`
+	}
+	get := func(cursor string) page {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.handleResults(rec, httptest.NewRequest(http.MethodGet, "/results?profile_id=p1&limit=5&cursor="+url.QueryEscape(cursor), nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("page %q: %d %s", cursor, rec.Code, rec.Body.String())
+		}
+		var p page
+		if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	seen := make(map[string]bool)
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("pagination did not terminate")
+		}
+		p := get(cursor)
+		for _, r := range p.Rows {
+			if seen[r.ID] {
+				t.Fatalf("row %s returned twice", r.ID)
+			}
+			seen[r.ID] = true
+		}
+		// Rows arriving mid-pagination must not shift later pages.
+		if pages == 1 {
+			insert("late", "2026-01-01 00:01:00")
+		}
+		if p.NextCursor == nil {
+			if len(p.Rows) != 3 {
+				t.Fatalf("last page should hold the 3 remaining rows, got %d", len(p.Rows))
+			}
+			break
+		}
+		if len(p.Rows) != 5 {
+			t.Fatalf("non-final page with %d rows", len(p.Rows))
+		}
+		cursor = *p.NextCursor
+	}
+	for id := range want {
+		if !seen[id] {
+			t.Fatalf("row %s skipped", id)
+		}
+	}
+	if seen["late"] {
+		t.Fatal("a row newer than the first page leaked into later pages")
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleResults(rec, httptest.NewRequest(http.MethodGet, "/results?profile_id=p1&limit=2", nil))
+	var legacy []map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &legacy); err != nil || len(legacy) != 2 {
+		t.Fatalf("legacy mode should return a bare array: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleResults(rec, httptest.NewRequest(http.MethodGet, "/results?cursor=not-a-cursor", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad cursor: expected 400, got %d", rec.Code)
+	}
+}
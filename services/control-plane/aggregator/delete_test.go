@@ -0,0 +1,109 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t testing.TB) *server {
+	t.Helper()
+	db, err := sql.Open("sqlite3", "file::memory:?_foreign_keys=ON")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	s := &server{db: db, dbDriver: "sqlite"}
+	if err := s.initSchema(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func seedResults(t *testing.T, s *server, profileID string, values ...string) {
+	t.Helper()
+	data := make([]string, 0, len(values))
+	for _, v := range values {
+		data = append(data, `{"v":"`+v+`"}`)
+	}
+	body := `{"drone_id":"d1","profile_id":"` + profileID + `","run_id":"r-` + profileID + `","data":[` + strings.Join(data, ",") + `]}`
+	rec := httptest.NewRecorder()
+	s.handleResults(rec, httptest.NewRequest(http.MethodPost, "/results", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("seed %s: %d %s", profileID, rec.Code, rec.Body.String())
+	}
+}
+
+func countRows(t *testing.T, s *server, table, profileID string) int {
+	t.Helper()
+	var n int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE profile_id = ?", profileID).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestDeleteProfileResults(t *testing.T) {
+	t.Setenv("AGGREGATOR_API_KEY", "secret")
+	s := newTestServer(t)
+	seedResults(t, s, "p1", "a", "b", "c")
+	seedResults(t, s, "p2", "a", "b")
+
+	del := func(target, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, target, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		mux := http.NewServeMux()
+		mux.HandleFunc("/results", s.handleResults)
+		mux.HandleFunc("/records", s.handleRecords)
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := del("/results?profile_id=p1", ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("anonymous delete: expected 403, got %d", rec.Code)
+	}
+	if rec := del("/results?profile_id=p1", "wrong"); rec.Code != http.StatusForbidden {
+		t.Fatalf("wrong key: expected 403, got %d", rec.Code)
+	}
+	if rec := del("/results", "secret"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("missing profile_id: expected 400, got %d", rec.Code)
+	}
+
+	rec := del("/results?profile_id=p1", "secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", rec.Code, rec.Body.String())
+	}
+	var out struct {
+		ProfileID string           `json:"profile_id"`
+		Deleted   map[string]int64 `json:"deleted"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.ProfileID != "p1" || out.Deleted["results"] != 3 || out.Deleted["records"] != 3 {
+		t.Fatalf("unexpected counts: %+v", out)
+	}
+	for _, table := range []string{"results", "records"} {
+		if n := countRows(t, s, table, "p1"); n != 0 {
+			t.Fatalf("%s still has %d rows for p1", table, n)
+		}
+		if n := countRows(t, s, table, "p2"); n != 2 {
+			t.Fatalf("%s lost rows of p2: %d left", table, n)
+		}
+	}
+
+	rec = del("/records?profile_id=p2", "secret")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"records":2`) || strings.Contains(rec.Body.String(), `"results"`) {
+		t.Fatalf("records delete: %d %s", rec.Code, rec.Body.String())
+	}
+	if n := countRows(t, s, "results", "p2"); n != 2 {
+		t.Fatalf("records delete must not touch results, %d left", n)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func postResults(s *server, body []byte, encoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/results", bytes.NewReader(body))
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	rec := httptest.NewRecorder()
+	s.handleResults(rec, req)
+	return rec
+}
+
+func TestResultsPostGzipRoundTrip(t *testing.T) {
+	s := newTestServer(t)
+	body := []byte(`{"drone_id":"d1","profile_id":"p1","run_id":"r1","data":[{"v":1},{"v":2},{"v":3}]}`)
+	rec := postResults(s, gzipBytes(t, body), "gzip")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("gzip post: %d %s", rec.Code, rec.Body.String())
+	}
+	if n := countRows(t, s, "results", "p1"); n != 3 {
+		t.Fatalf("expected 3 rows, got %d", n)
+	}
+	var out map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	if out["inserted_results"] != float64(3) {
+		t.Fatalf("unexpected response %v", out)
+	}
+}
+
+func TestResultsPostGzipErrors(t *testing.T) {
+	s := newTestServer(t)
+	body := []byte(`{"drone_id":"d1","profile_id":"p1","run_id":"r1","data":[{"v":1}]}`)
+	zipped := gzipBytes(t, body)
+
+	cases := []struct {
+		name     string
+		body     []byte
+		encoding string
+		code     int
+		errCode  string
+	}{
+		{"truncated stream", zipped[:len(zipped)-10], "gzip", http.StatusBadRequest, "invalid_gzip"},
+		{"not gzip", body, "gzip", http.StatusBadRequest, "invalid_gzip"},
+		{"unknown encoding", body, "br", http.StatusUnsupportedMediaType, "unsupported_content_encoding"},
+		{"decompressed past the cap", gzipBytes(t, []byte(strings.Repeat(" ", maxRequestBodyBytes+1))), "gzip", http.StatusRequestEntityTooLarge, "body_too_large"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := postResults(s, tc.body, tc.encoding)
+			var out map[string]any
+			_ = json.Unmarshal(rec.Body.Bytes(), &out)
+			if rec.Code != tc.code || out["error"] != tc.errCode {
+				t.Fatalf("got %d %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+	if n := countRows(t, s, "results", "p1"); n != 0 {
+		t.Fatalf("rejected bodies must not insert rows, got %d", n)
+	}
+}
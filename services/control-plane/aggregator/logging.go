@@ -0,0 +1,27 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// --- Logging ---
+
+// setupLogging makes a JSON slog handler on stdout the default logger.
+// LOG_LEVEL (debug, info, warn, error; default info) sets the minimum level.
+func setupLogging() {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: parseLogLevel(os.Getenv("LOG_LEVEL"))})))
+}
+
+func parseLogLevel(v string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
@@ -2,13 +2,17 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -33,30 +37,35 @@ type resultIn struct {
 	ProfileID string            `json:"profile_id"`
 	RunID     string            `json:"run_id"`
 	Data      []json.RawMessage `json:"data"`
+	// Meta is the run's fetch provenance, stored in run_meta.
+	Meta *runMeta `json:"meta,omitempty"`
 }
 
 type runIn struct {
-	RunID      string `json:"run_id"`
-	DroneID    string `json:"drone_id"`
-	ProfileID  string `json:"profile_id"`
-	StartedAt  string `json:"started_at"`
-	FinishedAt string `json:"finished_at"`
-	Status     string `json:"status"`
-	RowsOut    int64  `json:"rows_out"`
-	DurationMs int64  `json:"duration_ms"`
-	Error      string `json:"error"`
+	RunID      string          `json:"run_id"`
+	DroneID    string          `json:"drone_id"`
+	ProfileID  string          `json:"profile_id"`
+	StartedAt  string          `json:"started_at"`
+	FinishedAt string          `json:"finished_at"`
+	Status     string          `json:"status"`
+	RowsOut    int64           `json:"rows_out"`
+	DurationMs int64           `json:"duration_ms"`
+	Error      string          `json:"error"`
+	Meta       json.RawMessage `json:"meta,omitempty"`
 }
 
 type runRow struct {
-	RunID      string `json:"run_id"`
-	DroneID    string `json:"drone_id"`
-	ProfileID  string `json:"profile_id"`
-	StartedAt  string `json:"started_at"`
-	FinishedAt string `json:"finished_at"`
-	Status     string `json:"status"`
-	RowsOut    int64  `json:"rows_out"`
-	DurationMs int64  `json:"duration_ms"`
-	Error      string `json:"error"`
+	RunID      string          `json:"run_id"`
+	DroneID    string          `json:"drone_id"`
+	ProfileID  string          `json:"profile_id"`
+	StartedAt  string          `json:"started_at"`
+	FinishedAt string          `json:"finished_at"`
+	Status     string          `json:"status"`
+	RowsOut    int64           `json:"rows_out"`
+	DurationMs int64           `json:"duration_ms"`
+	Error      string          `json:"error"`
+	Meta       json.RawMessage `json:"meta,omitempty"`
+	Provenance *runMeta        `json:"provenance,omitempty"`
 }
 
 type serviceDetail struct {
@@ -66,11 +75,23 @@ type serviceDetail struct {
 type server struct {
 	db       *sql.DB
 	dbDriver string
+	dbFile   string // sqlite database path, for WAL size reporting
+	ops      opsCache
+
+	compressMin int // store data gzip-compressed from this size; 0 = off
+
+	// resultsMaxAge bounds GET /results to recent rows when the caller gives
+	// no since or until; 0 = unbounded.
+	resultsMaxAge time.Duration
 }
 
+// defaultResultsMaxAge is the implicit window of GET /results.
+const defaultResultsMaxAge = 24 * time.Hour
+
 func main() {
+	setupLogging()
 	if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
-		logLine("ERROR", "mkdir_failed", "err=%s", err.Error())
+		slog.Error("mkdir_failed", "err", err)
 		os.Exit(1)
 	}
 
@@ -84,19 +105,19 @@ func main() {
 	case "postgres":
 		dsn = strings.TrimSpace(os.Getenv("DB_DSN"))
 		if dsn == "" {
-			logLine("ERROR", "db_dsn_missing", "driver=%s", dbDriver)
+			slog.Error("db_dsn_missing", "driver", dbDriver)
 			os.Exit(1)
 		}
 	case "sqlite":
 		dsn = fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=ON", dbPath)
 	default:
-		logLine("ERROR", "db_driver_invalid", "driver=%s", dbDriver)
+		slog.Error("db_driver_invalid", "driver", dbDriver)
 		os.Exit(1)
 	}
 
 	db, err := sql.Open(dbDriver, dsn)
 	if err != nil {
-		logLine("ERROR", "db_open_failed", "err=%s", err.Error())
+		slog.Error("db_open_failed", "err", err)
 		os.Exit(1)
 	}
 	defer db.Close()
@@ -107,22 +128,35 @@ func main() {
 		db.SetMaxOpenConns(5)
 	}
 
-	s := &server{db: db, dbDriver: dbDriver}
+	s := &server{
+		db:            db,
+		dbDriver:      dbDriver,
+		compressMin:   compressMinBytesFromEnv(),
+		resultsMaxAge: envDuration("AGG_RESULTS_DEFAULT_MAX_AGE", defaultResultsMaxAge),
+	}
+	if dbDriver == "sqlite" {
+		s.dbFile = dbPath
+	}
 	if err := s.initSchema(); err != nil {
-		logLine("ERROR", "schema_init_failed", "err=%s", err.Error())
+		slog.Error("schema_init_failed", "err", err)
 		os.Exit(1)
 	}
+	if cfg := loadRetentionConfig(); cfg.enabled() {
+		go newRetentionJob(s, cfg).run(context.Background())
+	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", s.handleHealth)
 	mux.HandleFunc("/metrics", s.handleMetrics)
 	mux.HandleFunc("/results", s.handleResults)
 	mux.HandleFunc("/results/summary", s.handleSummary)
+	mux.HandleFunc("/results/stats", s.handleResultsStats)
 	mux.HandleFunc("/records", s.handleRecords)
 	mux.HandleFunc("/runs", s.handleRuns)
 	mux.HandleFunc("/runs/", s.handleRunGet)
+	mux.HandleFunc("/ops/overview", s.handleOpsOverview)
 
-	h := withRequestLogging(withCORS(withAuth(mux)))
+	h := withRequestLogging(withCORS(loadCORSConfig())(withAuth(mux)))
 
 	addr := ":" + defaultPort
 	srv := &http.Server{
@@ -130,9 +164,9 @@ func main() {
 		Handler:           h,
 		ReadHeaderTimeout: 10 * time.Second,
 	}
-	logLine("INFO", "starting", "addr=%s db=%s", addr, dbPath)
+	slog.Info("starting", "addr", addr, "db", dbPath)
 	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		logLine("ERROR", "listen_failed", "err=%s", err.Error())
+		slog.Error("listen_failed", "err", err)
 		os.Exit(1)
 	}
 }
@@ -223,14 +257,44 @@ func (s *server) initSchema() error {
 		}
 	}
 
+	if s.dbDriver == "postgres" {
+		stmts = append(stmts, runMetaSchema("TIMESTAMPTZ")...)
+	} else {
+		stmts = append(stmts, runMetaSchema("DATETIME")...)
+	}
+
 	for _, q := range stmts {
 		if _, err := s.db.Exec(q); err != nil {
 			return err
 		}
 	}
+	if err := s.ensureColumn("runs", "meta", "TEXT"); err != nil {
+		return err
+	}
+	for _, table := range []string{"results", "records"} {
+		if err := s.ensureColumn(table, "data_z", s.blobType()); err != nil {
+			return err
+		}
+		if err := s.ensureColumn(table, "data_enc", "TEXT"); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// ensureColumn adds a column introduced after the table was first created.
+func (s *server) ensureColumn(table, column, typ string) error {
+	if s.dbDriver == "postgres" {
+		_, err := s.db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s`, table, column, typ))
+		return err
+	}
+	_, err := s.db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, typ))
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "duplicate column") {
+		return nil
+	}
+	return err
+}
+
 func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusNoContent)
@@ -274,7 +338,11 @@ func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
 		return
 	}
-	writeJSON(w, http.StatusOK, metricsSnapshot())
+	out := metricsSnapshot()
+	for k, v := range storageStats.snapshot() {
+		out[k] = v
+	}
+	writeJSON(w, http.StatusOK, out)
 }
 
 func (s *server) handleResults(w http.ResponseWriter, r *http.Request) {
@@ -287,6 +355,8 @@ func (s *server) handleResults(w http.ResponseWriter, r *http.Request) {
 		s.handleResultsPost(w, r)
 	case http.MethodGet:
 		s.handleResultsGet(w, r)
+	case http.MethodDelete:
+		s.handleProfileDelete(w, r, "results", "records")
 	default:
 		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
 	}
@@ -295,7 +365,7 @@ func (s *server) handleResults(w http.ResponseWriter, r *http.Request) {
 func (s *server) handleResultsPost(w http.ResponseWriter, r *http.Request) {
 	var in resultIn
 	if err := decodeJSONStrict(r, &in); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_json"})
+		writeDecodeError(w, err)
 		return
 	}
 
@@ -306,6 +376,12 @@ func (s *server) handleResultsPost(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "missing_fields"})
 		return
 	}
+	if in.Meta != nil {
+		if err := in.Meta.normalize(); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_meta", "detail": err.Error()})
+			return
+		}
+	}
 
 	insertedResults := 0
 	insertedRecords := 0
@@ -319,9 +395,10 @@ func (s *server) handleResultsPost(w http.ResponseWriter, r *http.Request) {
 		}
 
 		recordID := recordIDFromJSON(canon)
+		data, dataZ, dataEnc := s.encodeData(canon)
 		// insert into records (dedupe)
 		res, err := s.db.Exec(s.insertRecordSQL(),
-			recordID, in.ProfileID, in.RunID, string(canon))
+			recordID, in.ProfileID, in.RunID, data, dataZ, dataEnc)
 		if err != nil {
 			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "db_error"})
 			return
@@ -340,13 +417,20 @@ func (s *server) handleResultsPost(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if _, err := s.db.Exec(s.insertResultSQL(),
-			id, in.DroneID, in.ProfileID, in.RunID, string(canon)); err != nil {
+			id, in.DroneID, in.ProfileID, in.RunID, data, dataZ, dataEnc); err != nil {
 			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "db_error"})
 			return
 		}
 		insertedResults++
 	}
 
+	if in.Meta != nil {
+		if err := s.storeRunMeta(in.RunID, in.ProfileID, *in.Meta); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "db_error"})
+			return
+		}
+	}
+
 	writeJSON(w, http.StatusOK, map[string]any{
 		"inserted_results": insertedResults,
 		"inserted_records": insertedRecords,
@@ -361,8 +445,33 @@ func (s *server) handleResultsGet(w http.ResponseWriter, r *http.Request) {
 	profileID := strings.TrimSpace(q.Get("profile_id"))
 	runID := strings.TrimSpace(q.Get("run_id"))
 	limit := parseLimit(q.Get("limit"))
+	since, until, errCode := parseTimeWindow(q.Get("since"), q.Get("until"))
+	if errCode != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": errCode})
+		return
+	}
+	// Without an explicit window only recent rows are read, so a poller that
+	// reconnects does not page through week-old data. The headers (and meta
+	// in the paged shape) tell the caller which window was applied.
+	implicit := since.IsZero() && until.IsZero() && s.resultsMaxAge > 0
+	if implicit {
+		since = time.Now().UTC().Add(-s.resultsMaxAge)
+		w.Header().Set("X-Results-Since", since.Format(time.RFC3339))
+		w.Header().Set("X-Results-Max-Age", strconv.FormatInt(int64(s.resultsMaxAge/time.Second), 10))
+	}
+	// Passing cursor (empty for the first page) switches to the paged
+	// {"rows","next_cursor"} shape; without it the bare array is kept.
+	_, paged := q["cursor"]
+	var after resultsCursor
+	if c := strings.TrimSpace(q.Get("cursor")); c != "" {
+		var err error
+		if after, err = decodeResultsCursor(c); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_cursor"})
+			return
+		}
+	}
 
-	sqlq := `SELECT id, drone_id, profile_id, run_id, timestamp, data FROM results`
+	sqlq := `SELECT id, drone_id, profile_id, run_id, timestamp, data, data_z, data_enc FROM results`
 	conds := make([]string, 0, 3)
 	args := make([]any, 0, 4)
 	idx := 1
@@ -381,11 +490,24 @@ func (s *server) handleResultsGet(w http.ResponseWriter, r *http.Request) {
 		args = append(args, runID)
 		idx++
 	}
+	conds, args, idx = s.windowConds(conds, args, idx, since, until)
+	if after.ID != "" {
+		ts := s.timeArg(after.Timestamp)
+		conds = append(conds, fmt.Sprintf("(timestamp < %s OR (timestamp = %s AND id < %s))", s.ph(idx), s.ph(idx+1), s.ph(idx+2)))
+		args = append(args, ts, ts, after.ID)
+		idx += 3
+	}
 	if len(conds) > 0 {
 		sqlq += " WHERE " + strings.Join(conds, " AND ")
 	}
-	sqlq += " ORDER BY timestamp DESC, id ASC LIMIT " + s.ph(idx)
-	args = append(args, limit)
+	if paged {
+		// One extra row tells whether another page exists.
+		sqlq += " ORDER BY timestamp DESC, id DESC LIMIT " + s.ph(idx)
+		args = append(args, limit+1)
+	} else {
+		sqlq += " ORDER BY timestamp DESC, id ASC LIMIT " + s.ph(idx)
+		args = append(args, limit)
+	}
 
 	rows, err := s.db.Query(sqlq, args...)
 	if err != nil {
@@ -407,15 +529,87 @@ func (s *server) handleResultsGet(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var rrow row
 		var dataStr string
-		if err := rows.Scan(&rrow.ID, &rrow.DroneID, &rrow.ProfileID, &rrow.RunID, &rrow.Timestamp, &dataStr); err != nil {
+		var dataZ []byte
+		var dataEnc sql.NullString
+		if err := rows.Scan(&rrow.ID, &rrow.DroneID, &rrow.ProfileID, &rrow.RunID, &rrow.Timestamp, &dataStr, &dataZ, &dataEnc); err != nil {
 			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "db_error"})
 			return
 		}
-		rrow.Data = json.RawMessage([]byte(dataStr))
+		data, err := decodeData(dataStr, dataZ, dataEnc)
+		if err != nil {
+			slog.Error("data_decode_failed", "id", rrow.ID, "err", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "data_decode_failed"})
+			return
+		}
+		rrow.Data = data
 		out = append(out, rrow)
 	}
 
-	writeJSON(w, http.StatusOK, out)
+	if !paged {
+		writeJSON(w, http.StatusOK, out)
+		return
+	}
+	var next any
+	if len(out) > limit {
+		out = out[:limit]
+		last := out[len(out)-1]
+		c, err := encodeResultsCursor(last.Timestamp, last.ID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "cursor_error"})
+			return
+		}
+		next = c
+	}
+	meta := map[string]any{"since": timeOrNil(since), "until": timeOrNil(until), "implicit_since": implicit}
+	if implicit {
+		meta["max_age_seconds"] = int64(s.resultsMaxAge / time.Second)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"rows":        out,
+		"next_cursor": next,
+		"meta":        meta,
+	})
+}
+
+func timeOrNil(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// resultsCursor is the keyset position of the last row on a page. It travels
+// as opaque base64url JSON.
+type resultsCursor struct {
+	Timestamp time.Time `json:"ts"`
+	ID        string    `json:"id"`
+}
+
+func encodeResultsCursor(ts, id string) (string, error) {
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(resultsCursor{Timestamp: t, ID: id})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeResultsCursor(s string) (resultsCursor, error) {
+	var c resultsCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, err
+	}
+	if c.ID == "" || c.Timestamp.IsZero() {
+		return c, errors.New("incomplete cursor")
+	}
+	return c, nil
 }
 
 func (s *server) handleRecords(w http.ResponseWriter, r *http.Request) {
@@ -423,6 +617,10 @@ func (s *server) handleRecords(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
+	if r.Method == http.MethodDelete {
+		s.handleProfileDelete(w, r, "records")
+		return
+	}
 	if r.Method != http.MethodGet {
 		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
 		return
@@ -432,8 +630,13 @@ func (s *server) handleRecords(w http.ResponseWriter, r *http.Request) {
 	profileID := strings.TrimSpace(q.Get("profile_id"))
 	runID := strings.TrimSpace(q.Get("run_id"))
 	limit := parseLimit(q.Get("limit"))
+	since, until, errCode := parseTimeWindow(q.Get("since"), q.Get("until"))
+	if errCode != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": errCode})
+		return
+	}
 
-	sqlq := `SELECT data, timestamp, record_id FROM records`
+	sqlq := `SELECT data, data_z, data_enc, timestamp, record_id FROM records`
 	conds := make([]string, 0, 2)
 	args := make([]any, 0, 3)
 	idx := 1
@@ -447,6 +650,7 @@ func (s *server) handleRecords(w http.ResponseWriter, r *http.Request) {
 		args = append(args, runID)
 		idx++
 	}
+	conds, args, idx = s.windowConds(conds, args, idx, since, until)
 	if len(conds) > 0 {
 		sqlq += " WHERE " + strings.Join(conds, " AND ")
 	}
@@ -463,18 +667,76 @@ func (s *server) handleRecords(w http.ResponseWriter, r *http.Request) {
 	out := make([]json.RawMessage, 0, limit)
 	for rows.Next() {
 		var dataStr string
+		var dataZ []byte
+		var dataEnc sql.NullString
 		var ts string
 		var rid string
-		if err := rows.Scan(&dataStr, &ts, &rid); err != nil {
+		if err := rows.Scan(&dataStr, &dataZ, &dataEnc, &ts, &rid); err != nil {
 			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "db_error"})
 			return
 		}
-		out = append(out, json.RawMessage([]byte(dataStr)))
+		data, err := decodeData(dataStr, dataZ, dataEnc)
+		if err != nil {
+			slog.Error("data_decode_failed", "record_id", rid, "err", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "data_decode_failed"})
+			return
+		}
+		out = append(out, data)
 	}
 
 	writeJSON(w, http.StatusOK, out)
 }
 
+// handleProfileDelete removes every row of profile_id from tables in one
+// transaction and reports how many rows each table lost.
+func (s *server) handleProfileDelete(w http.ResponseWriter, r *http.Request, tables ...string) {
+	if !requireAPIKey(w, r) {
+		return
+	}
+	profileID := strings.TrimSpace(r.URL.Query().Get("profile_id"))
+	if profileID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "missing_profile_id"})
+		return
+	}
+
+	deleted, err := s.deleteProfileRows(profileID, tables...)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "db_error"})
+		return
+	}
+	slog.Info("profile_rows_deleted", "profile_id", profileID, "tables", strings.Join(tables, ","))
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"profile_id": profileID,
+		"deleted":    deleted,
+	})
+}
+
+func (s *server) deleteProfileRows(profileID string, tables ...string) (map[string]int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	deleted := make(map[string]int64, len(tables))
+	for _, table := range tables {
+		res, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE profile_id = %s`, table, s.ph(1)), profileID)
+		if err != nil {
+			return nil, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		deleted[table] = n
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
 func (s *server) handleRuns(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusNoContent)
@@ -493,7 +755,7 @@ func (s *server) handleRuns(w http.ResponseWriter, r *http.Request) {
 func (s *server) handleRunsPost(w http.ResponseWriter, r *http.Request) {
 	var in runIn
 	if err := decodeJSONStrict(r, &in); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_json"})
+		writeDecodeError(w, err)
 		return
 	}
 
@@ -519,8 +781,22 @@ func (s *server) handleRunsPost(w http.ResponseWriter, r *http.Request) {
 
 	in.Error = sanitizeError(in.Error)
 
+	var meta any
+	if len(in.Meta) > 0 && string(in.Meta) != "null" {
+		var obj map[string]any
+		if err := json.Unmarshal(in.Meta, &obj); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_meta"})
+			return
+		}
+		b, _ := json.Marshal(obj)
+		in.Meta = b
+		meta = string(b)
+	} else {
+		in.Meta = nil
+	}
+
 	_, err := s.db.Exec(s.upsertRunSQL(),
-		in.RunID, in.DroneID, in.ProfileID, in.StartedAt, emptyToNull(in.FinishedAt), in.Status, in.RowsOut, in.DurationMs, emptyToNull(in.Error))
+		in.RunID, in.DroneID, in.ProfileID, in.StartedAt, emptyToNull(in.FinishedAt), in.Status, in.RowsOut, in.DurationMs, emptyToNull(in.Error), meta)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "db_error"})
 		return
@@ -536,6 +812,7 @@ func (s *server) handleRunsPost(w http.ResponseWriter, r *http.Request) {
 		RowsOut:    in.RowsOut,
 		DurationMs: in.DurationMs,
 		Error:      in.Error,
+		Meta:       in.Meta,
 	}
 
 	writeJSON(w, http.StatusOK, row)
@@ -544,28 +821,53 @@ func (s *server) handleRunsPost(w http.ResponseWriter, r *http.Request) {
 func (s *server) handleRunsGet(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
 	droneID := strings.TrimSpace(q.Get("drone_id"))
-	profileID := strings.TrimSpace(q.Get("profile_id"))
+	profileIDs := make([]string, 0, len(q["profile_id"]))
+	for _, v := range q["profile_id"] {
+		if v = strings.TrimSpace(v); v != "" {
+			profileIDs = append(profileIDs, v)
+		}
+	}
+	latest := q.Get("latest") == "1" || strings.EqualFold(q.Get("latest"), "true")
 	limit := parseLimit(q.Get("limit"))
+	// latest without a limit returns one run for every matching profile,
+	// however many there are.
+	unbounded := latest && strings.TrimSpace(q.Get("limit")) == ""
 
-	sqlq := `SELECT run_id, drone_id, profile_id, started_at, finished_at, status, rows_out, duration_ms, error FROM runs`
-	conds := make([]string, 0, 2)
-	args := make([]any, 0, 3)
+	sqlq := `SELECT run_id, drone_id, profile_id, started_at, finished_at, status, rows_out, duration_ms, error, meta FROM runs`
+	conds := make([]string, 0, 3)
+	args := make([]any, 0, 3+len(profileIDs))
 	idx := 1
 	if droneID != "" {
 		conds = append(conds, "drone_id = "+s.ph(idx))
 		args = append(args, droneID)
 		idx++
 	}
-	if profileID != "" {
+	if len(profileIDs) == 1 {
 		conds = append(conds, "profile_id = "+s.ph(idx))
-		args = append(args, profileID)
+		args = append(args, profileIDs[0])
 		idx++
+	} else if len(profileIDs) > 1 {
+		phs := make([]string, 0, len(profileIDs))
+		for _, id := range profileIDs {
+			phs = append(phs, s.ph(idx))
+			args = append(args, id)
+			idx++
+		}
+		conds = append(conds, "profile_id IN ("+strings.Join(phs, ", ")+")")
+	}
+	if latest {
+		// Only the most recent run of each profile; ties on started_at go to
+		// the lowest run_id, matching the ORDER BY below.
+		conds = append(conds, "run_id = (SELECT r2.run_id FROM runs r2 WHERE r2.profile_id = runs.profile_id ORDER BY r2.started_at DESC, r2.run_id ASC LIMIT 1)")
 	}
 	if len(conds) > 0 {
 		sqlq += " WHERE " + strings.Join(conds, " AND ")
 	}
-	sqlq += " ORDER BY started_at DESC, run_id ASC LIMIT " + s.ph(idx)
-	args = append(args, limit)
+	sqlq += " ORDER BY started_at DESC, run_id ASC"
+	if !unbounded {
+		sqlq += " LIMIT " + s.ph(idx)
+		args = append(args, limit)
+	}
 
 	rows, err := s.db.Query(sqlq, args...)
 	if err != nil {
@@ -574,12 +876,13 @@ func (s *server) handleRunsGet(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
-	out := make([]runRow, 0, limit)
+	out := make([]runRow, 0, min(limit, 100))
 	for rows.Next() {
 		var rr runRow
 		var finished sql.NullString
 		var errStr sql.NullString
-		if err := rows.Scan(&rr.RunID, &rr.DroneID, &rr.ProfileID, &rr.StartedAt, &finished, &rr.Status, &rr.RowsOut, &rr.DurationMs, &errStr); err != nil {
+		var meta sql.NullString
+		if err := rows.Scan(&rr.RunID, &rr.DroneID, &rr.ProfileID, &rr.StartedAt, &finished, &rr.Status, &rr.RowsOut, &rr.DurationMs, &errStr, &meta); err != nil {
 			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "db_error"})
 			return
 		}
@@ -589,6 +892,9 @@ func (s *server) handleRunsGet(w http.ResponseWriter, r *http.Request) {
 		if errStr.Valid {
 			rr.Error = errStr.String
 		}
+		if meta.Valid && meta.String != "" {
+			rr.Meta = json.RawMessage(meta.String)
+		}
 		out = append(out, rr)
 	}
 
@@ -615,9 +921,13 @@ func (s *server) handleRunGet(w http.ResponseWriter, r *http.Request) {
 	var rr runRow
 	var finished sql.NullString
 	var errStr sql.NullString
-	sqlq := fmt.Sprintf(`SELECT run_id, drone_id, profile_id, started_at, finished_at, status, rows_out, duration_ms, error FROM runs WHERE run_id = %s`, s.ph(1))
+	var meta sql.NullString
+	var prov runMetaScan
+	sqlq := fmt.Sprintf(`SELECT r.run_id, r.drone_id, r.profile_id, r.started_at, r.finished_at, r.status, r.rows_out, r.duration_ms, r.error, r.meta, %s
+	FROM runs r LEFT JOIN run_meta m ON m.run_id = r.run_id WHERE r.run_id = %s`, runMetaColumns, s.ph(1))
 	row := s.db.QueryRow(sqlq, runID)
-	if err := row.Scan(&rr.RunID, &rr.DroneID, &rr.ProfileID, &rr.StartedAt, &finished, &rr.Status, &rr.RowsOut, &rr.DurationMs, &errStr); err != nil {
+	dest := append([]any{&rr.RunID, &rr.DroneID, &rr.ProfileID, &rr.StartedAt, &finished, &rr.Status, &rr.RowsOut, &rr.DurationMs, &errStr, &meta}, prov.dest()...)
+	if err := row.Scan(dest...); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			writeJSON(w, http.StatusNotFound, map[string]any{"error": "not_found"})
 			return
@@ -631,6 +941,10 @@ func (s *server) handleRunGet(w http.ResponseWriter, r *http.Request) {
 	if errStr.Valid {
 		rr.Error = errStr.String
 	}
+	if meta.Valid && meta.String != "" {
+		rr.Meta = json.RawMessage(meta.String)
+	}
+	rr.Provenance = prov.meta()
 
 	writeJSON(w, http.StatusOK, rr)
 }
@@ -697,22 +1011,22 @@ func (s *server) count(table string) (int, error) {
 
 func (s *server) insertRecordSQL() string {
 	if s.dbDriver == "postgres" {
-		return `INSERT INTO records(record_id, profile_id, run_id, data) VALUES($1,$2,$3,$4) ON CONFLICT (record_id, profile_id) DO NOTHING`
+		return `INSERT INTO records(record_id, profile_id, run_id, data, data_z, data_enc) VALUES($1,$2,$3,$4,$5,$6) ON CONFLICT (record_id, profile_id) DO NOTHING`
 	}
-	return `INSERT OR IGNORE INTO records(record_id, profile_id, run_id, data) VALUES(?,?,?,?)`
+	return `INSERT OR IGNORE INTO records(record_id, profile_id, run_id, data, data_z, data_enc) VALUES(?,?,?,?,?,?)`
 }
 
 func (s *server) insertResultSQL() string {
 	if s.dbDriver == "postgres" {
-		return `INSERT INTO results(id, drone_id, profile_id, run_id, data) VALUES($1,$2,$3,$4,$5)`
+		return `INSERT INTO results(id, drone_id, profile_id, run_id, data, data_z, data_enc) VALUES($1,$2,$3,$4,$5,$6,$7)`
 	}
-	return `INSERT INTO results(id, drone_id, profile_id, run_id, data) VALUES(?,?,?,?,?)`
+	return `INSERT INTO results(id, drone_id, profile_id, run_id, data, data_z, data_enc) VALUES(?,?,?,?,?,?,?)`
 }
 
 func (s *server) upsertRunSQL() string {
 	if s.dbDriver == "postgres" {
-		return `INSERT INTO runs(run_id, drone_id, profile_id, started_at, finished_at, status, rows_out, duration_ms, error)
-	VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9)
+		return `INSERT INTO runs(run_id, drone_id, profile_id, started_at, finished_at, status, rows_out, duration_ms, error, meta)
+	VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
 	ON CONFLICT (run_id) DO UPDATE SET
 	drone_id=EXCLUDED.drone_id,
 	profile_id=EXCLUDED.profile_id,
@@ -721,23 +1035,68 @@ func (s *server) upsertRunSQL() string {
 	status=EXCLUDED.status,
 	rows_out=EXCLUDED.rows_out,
 	duration_ms=EXCLUDED.duration_ms,
-	error=EXCLUDED.error`
+	error=EXCLUDED.error,
+	meta=EXCLUDED.meta`
 	}
-	return `INSERT OR REPLACE INTO runs(run_id, drone_id, profile_id, started_at, finished_at, status, rows_out, duration_ms, error)
-	VALUES(?,?,?,?,?,?,?,?,?)`
+	return `INSERT OR REPLACE INTO runs(run_id, drone_id, profile_id, started_at, finished_at, status, rows_out, duration_ms, error, meta)
+	VALUES(?,?,?,?,?,?,?,?,?,?)`
 }
 
+const maxRequestBodyBytes = 8 << 20
+
+var (
+	errBodyTooLarge        = errors.New("request body too large")
+	errInvalidGzip         = errors.New("invalid gzip body")
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+)
+
+// decodeJSONStrict decodes the request body, transparently inflating
+// Content-Encoding: gzip. The size cap applies to the decompressed stream so a
+// small compressed body cannot expand without bound.
 func decodeJSONStrict(r *http.Request, v any) error {
 	defer r.Body.Close()
-	b, err := io.ReadAll(io.LimitReader(r.Body, 8<<20))
+	var body io.Reader = r.Body
+	switch enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); enc {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return errInvalidGzip
+		}
+		defer zr.Close()
+		body = zr
+	default:
+		return errUnsupportedEncoding
+	}
+	b, err := io.ReadAll(io.LimitReader(body, maxRequestBodyBytes+1))
 	if err != nil {
+		if body != r.Body {
+			return errInvalidGzip
+		}
 		return err
 	}
+	if len(b) > maxRequestBodyBytes {
+		return errBodyTooLarge
+	}
 	dec := json.NewDecoder(bytes.NewReader(b))
 	dec.DisallowUnknownFields()
 	return dec.Decode(v)
 }
 
+// writeDecodeError answers a failed decodeJSONStrict.
+func writeDecodeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errBodyTooLarge):
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]any{"error": "body_too_large", "max_bytes": maxRequestBodyBytes})
+	case errors.Is(err, errInvalidGzip):
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_gzip"})
+	case errors.Is(err, errUnsupportedEncoding):
+		writeJSON(w, http.StatusUnsupportedMediaType, map[string]any{"error": "unsupported_content_encoding"})
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_json"})
+	}
+}
+
 func canonicalJSON(raw json.RawMessage) ([]byte, error) {
 	var obj any
 	if err := json.Unmarshal(raw, &obj); err != nil {
@@ -808,6 +1167,55 @@ func parseLimit(v string) int {
 	return limit
 }
 
+// parseTimeWindow validates the optional since/until RFC3339 bounds. On
+// failure it returns the error code to report.
+func parseTimeWindow(sinceStr, untilStr string) (since, until time.Time, errCode string) {
+	if v := strings.TrimSpace(sinceStr); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, "invalid_since"
+		}
+		since = t
+	}
+	if v := strings.TrimSpace(untilStr); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, "invalid_until"
+		}
+		until = t
+	}
+	if !since.IsZero() && !until.IsZero() && !until.After(since) {
+		return time.Time{}, time.Time{}, "invalid_time_window"
+	}
+	return since, until, ""
+}
+
+// windowConds appends timestamp >= since and timestamp < until conditions
+// for whichever bounds are set.
+func (s *server) windowConds(conds []string, args []any, idx int, since, until time.Time) ([]string, []any, int) {
+	if !since.IsZero() {
+		conds = append(conds, "timestamp >= "+s.ph(idx))
+		args = append(args, s.timeArg(since))
+		idx++
+	}
+	if !until.IsZero() {
+		conds = append(conds, "timestamp < "+s.ph(idx))
+		args = append(args, s.timeArg(until))
+		idx++
+	}
+	return conds, args, idx
+}
+
+// timeArg binds t for comparison with a timestamp column. SQLite keeps
+// CURRENT_TIMESTAMP as "YYYY-MM-DD HH:MM:SS" text in UTC and compares it as a
+// string, so the bound must use the same layout.
+func (s *server) timeArg(t time.Time) any {
+	if s.dbDriver == "postgres" {
+		return t
+	}
+	return t.UTC().Format("2006-01-02 15:04:05.999999999")
+}
+
 func (s *server) ph(i int) string {
 	if s.dbDriver == "postgres" {
 		return "$" + strconv.Itoa(i)
@@ -838,6 +1246,22 @@ func envBool(key string, def bool) bool {
 	}
 }
 
+// requireAPIKey guards destructive endpoints with AGGREGATOR_API_KEY, the
+// same way the registry guards profile writes.
+func requireAPIKey(w http.ResponseWriter, r *http.Request) bool {
+	envKey := strings.TrimSpace(os.Getenv("AGGREGATOR_API_KEY"))
+	if envKey == "" {
+		writeJSON(w, http.StatusForbidden, map[string]any{"error": "api_key_not_configured"})
+		return false
+	}
+	hKey := strings.TrimSpace(r.Header.Get("X-API-Key"))
+	if hKey == "" || hKey != envKey {
+		writeJSON(w, http.StatusForbidden, map[string]any{"error": "forbidden"})
+		return false
+	}
+	return true
+}
+
 func withAuth(next http.Handler) http.Handler {
 	required := envBool("AUTH_REQUIRED", false)
 	tenantRequired := envBool("AUTH_TENANT_REQUIRED", false)
@@ -886,41 +1310,22 @@ func withRequestLogging(next http.Handler) http.Handler {
 
 		dur := time.Since(start).Milliseconds()
 		metricsRecord(rec.status, dur)
-		level := "INFO"
+		level := slog.LevelInfo
 		if rec.status >= 500 {
-			level = "ERROR"
+			level = slog.LevelError
 		} else if rec.status >= 400 {
-			level = "WARN"
-		}
-
-		ts := time.Now().UTC().Format(time.RFC3339)
-		fmt.Fprintf(os.Stdout, "%s %s method=%s path=%s status=%d duration_ms=%d\n",
-			ts, level, r.Method, r.URL.Path, rec.status, dur)
-	})
-}
-
-func withCORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Request-ID, X-API-Key, X-Principal, X-Tenant-ID")
-		w.Header().Set("Access-Control-Max-Age", "86400")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
+			level = slog.LevelWarn
 		}
-
-		next.ServeHTTP(w, r)
+		slog.Log(r.Context(), level, "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", dur,
+			"request_id", strings.TrimSpace(r.Header.Get("X-Request-ID")),
+		)
 	})
 }
 
-func logLine(level, msg, format string, args ...any) {
-	ts := time.Now().UTC().Format(time.RFC3339)
-	line := fmt.Sprintf(format, args...)
-	fmt.Fprintf(os.Stdout, "%s %s %s %s\n", ts, level, msg, line)
-}
-
 // --- minimal metrics ---
 
 var metricsMu sync.Mutex
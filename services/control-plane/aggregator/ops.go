@@ -0,0 +1,187 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	opsOverviewTTL    = 10 * time.Second
+	opsOverviewWindow = time.Hour
+	opsTopN           = 10
+	opsFailedRuns     = 20
+)
+
+// opsCache holds the last /ops/overview payload; the zero value is ready to use.
+type opsCache struct {
+	mu      sync.Mutex
+	expires time.Time
+	data    map[string]any
+}
+
+type opsProfileCount struct {
+	ProfileID string `json:"profile_id"`
+	Results   int64  `json:"results"`
+}
+
+type opsDroneCount struct {
+	DroneID string `json:"drone_id"`
+	Rows    int64  `json:"rows"`
+}
+
+type opsFailedRun struct {
+	RunID      string `json:"run_id"`
+	DroneID    string `json:"drone_id"`
+	ProfileID  string `json:"profile_id"`
+	StartedAt  string `json:"started_at"`
+	Error      string `json:"error,omitempty"`
+	ErrorClass string `json:"error_class"`
+}
+
+func (s *server) handleOpsOverview(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
+		return
+	}
+
+	s.ops.mu.Lock()
+	defer s.ops.mu.Unlock()
+	now := time.Now()
+	if s.ops.data != nil && now.Before(s.ops.expires) {
+		out := make(map[string]any, len(s.ops.data)+1)
+		for k, v := range s.ops.data {
+			out[k] = v
+		}
+		out["cached"] = true
+		writeJSON(w, http.StatusOK, out)
+		return
+	}
+
+	data, err := s.opsOverview(now)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "db_error"})
+		return
+	}
+	s.ops.data = data
+	s.ops.expires = now.Add(opsOverviewTTL)
+	data["cached"] = false
+	writeJSON(w, http.StatusOK, data)
+}
+
+// opsOverview gathers the overview with one bounded query per section.
+func (s *server) opsOverview(now time.Time) (map[string]any, error) {
+	since := s.timeArg(now.Add(-opsOverviewWindow))
+
+	profiles := make([]opsProfileCount, 0, opsTopN)
+	rows, err := s.db.Query(`SELECT profile_id, COUNT(*) AS n FROM results WHERE timestamp >= `+s.ph(1)+
+		` GROUP BY profile_id ORDER BY n DESC, profile_id ASC LIMIT `+s.ph(2), since, opsTopN)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var p opsProfileCount
+		if err := rows.Scan(&p.ProfileID, &p.Results); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	rows.Close()
+
+	drones := make([]opsDroneCount, 0, opsTopN)
+	rows, err = s.db.Query(`SELECT drone_id, COUNT(*) AS n FROM results WHERE timestamp >= `+s.ph(1)+
+		` GROUP BY drone_id ORDER BY n DESC, drone_id ASC LIMIT `+s.ph(2), since, opsTopN)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var d opsDroneCount
+		if err := rows.Scan(&d.DroneID, &d.Rows); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		drones = append(drones, d)
+	}
+	rows.Close()
+
+	failed := make([]opsFailedRun, 0, opsFailedRuns)
+	rows, err = s.db.Query(`SELECT run_id, drone_id, profile_id, started_at, error FROM runs WHERE status = 'failed'`+
+		` ORDER BY started_at DESC, run_id ASC LIMIT `+s.ph(1), opsFailedRuns)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var f opsFailedRun
+		var errStr sql.NullString
+		if err := rows.Scan(&f.RunID, &f.DroneID, &f.ProfileID, &f.StartedAt, &errStr); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		f.Error = errStr.String
+		f.ErrorClass = errorClass(f.Error)
+		failed = append(failed, f)
+	}
+	rows.Close()
+
+	tables := make(map[string]int, 3)
+	for _, t := range []string{"results", "records", "runs"} {
+		n, err := s.count(t)
+		if err != nil {
+			return nil, err
+		}
+		tables[t] = n
+	}
+
+	var wal any
+	if s.dbDriver == "sqlite" && s.dbFile != "" {
+		if fi, err := os.Stat(s.dbFile + "-wal"); err == nil {
+			wal = fi.Size()
+		} else {
+			wal = int64(0)
+		}
+	}
+
+	return map[string]any{
+		"generated_at":   now.UTC().Format(time.RFC3339),
+		"window_seconds": int(opsOverviewWindow / time.Second),
+		"top_profiles":   profiles,
+		"top_drones":     drones,
+		"failed_runs":    failed,
+		"tables":         tables,
+		"wal_bytes":      wal,
+	}, nil
+}
+
+var httpStatusRe = regexp.MustCompile(`status[=_ ](\d)\d\d`)
+
+// errorClass buckets a run error into a coarse class for triage.
+func errorClass(e string) string {
+	l := strings.ToLower(e)
+	switch {
+	case l == "":
+		return "unknown"
+	case strings.Contains(l, "timeout") || strings.Contains(l, "deadline exceeded"):
+		return "timeout"
+	}
+	if m := httpStatusRe.FindStringSubmatch(l); m != nil {
+		return "http_" + m[1] + "xx"
+	}
+	switch {
+	case strings.Contains(l, "connection refused") || strings.Contains(l, "no such host") || strings.Contains(l, "connection reset") || strings.Contains(l, "eof"):
+		return "network"
+	case strings.Contains(l, "profile") || strings.Contains(l, "yaml"):
+		return "profile"
+	case strings.Contains(l, "json") || strings.Contains(l, "decode") || strings.Contains(l, "unmarshal"):
+		return "decode"
+	}
+	return "other"
+}
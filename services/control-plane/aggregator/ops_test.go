@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type opsResponse struct {
+	Cached      bool              `json:"cached"`
+	TopProfiles []opsProfileCount `json:"top_profiles"`
+	TopDrones   []opsDroneCount   `json:"top_drones"`
+	FailedRuns  []opsFailedRun    `json:"failed_runs"`
+	Tables      map[string]int    `json:"tables"`
+}
+
+func getOps(t *testing.T, s *server) opsResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.handleOpsOverview(rec, httptest.NewRequest(http.MethodGet, "/ops/overview", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ops overview: %d %s", rec.Code, rec.Body.String())
+	}
+	var out opsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestOpsOverview(t *testing.T) {
+	s := newTestServer(t)
+	now := time.Now()
+	recent := s.timeArg(now.Add(-10 * time.Minute))
+	old := s.timeArg(now.Add(-3 * time.Hour))
+	n := 0
+	insert := func(drone, profile string, ts any, count int) {
+		for i := 0; i < count; i++ {
+			n++
+			if _, err := s.db.Exec(`INSERT INTO results(id, drone_id, profile_id, run_id, timestamp, data) VALUES(?,?,?,?,?,?)`,
+				fmt.Sprintf("r%d", n), drone, profile, "run", ts, `{}`); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	insert("d1", "quiet", recent, 1)
+	insert("d1", "loud", recent, 5)
+	insert("d2", "medium", recent, 3)
+	insert("d2", "stale", old, 50)
+
+	runs := []struct{ id, status, started, err string }{
+		{"ok-1", "succeeded", "2026-01-01T03:00:00Z", ""},
+		{"f-1", "failed", "2026-01-01T01:00:00Z", "http_error status=503 body=unavailable"},
+		{"f-2", "failed", "2026-01-01T02:00:00Z", "context deadline exceeded"},
+		{"f-3", "failed", "2026-01-01T00:00:00Z", "invalid_profile_yaml"},
+	}
+	for _, r := range runs {
+		if _, err := s.db.Exec(`INSERT INTO runs(run_id, drone_id, profile_id, started_at, status, rows_out, duration_ms, error) VALUES(?,?,?,?,?,?,?,?)`,
+			r.id, "d1", "loud", r.started, r.status, 0, 0, emptyToNull(r.err)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := getOps(t, s)
+	if out.Cached {
+		t.Fatal("first call must not be cached")
+	}
+	if len(out.TopProfiles) != 3 || out.TopProfiles[0].ProfileID != "loud" || out.TopProfiles[1].ProfileID != "medium" || out.TopProfiles[2].ProfileID != "quiet" {
+		t.Fatalf("top profiles should rank the last hour only: %+v", out.TopProfiles)
+	}
+	if len(out.TopDrones) != 2 || out.TopDrones[0].DroneID != "d1" || out.TopDrones[0].Rows != 6 {
+		t.Fatalf("top drones: %+v", out.TopDrones)
+	}
+	if len(out.FailedRuns) != 3 || out.FailedRuns[0].RunID != "f-2" || out.FailedRuns[0].ErrorClass != "timeout" ||
+		out.FailedRuns[1].ErrorClass != "http_5xx" || out.FailedRuns[2].ErrorClass != "profile" {
+		t.Fatalf("failed runs: %+v", out.FailedRuns)
+	}
+	if out.Tables["results"] != 59 || out.Tables["runs"] != 4 {
+		t.Fatalf("tables: %+v", out.Tables)
+	}
+
+	insert("d3", "new", recent, 20)
+	if cached := getOps(t, s); !cached.Cached || cached.TopProfiles[0].ProfileID != "loud" {
+		t.Fatalf("second call within TTL should be served from cache: %+v", cached)
+	}
+	s.ops.expires = time.Time{}
+	if fresh := getOps(t, s); fresh.Cached || fresh.TopProfiles[0].ProfileID != "new" {
+		t.Fatalf("expired cache should be recomputed: %+v", fresh)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultRetentionInterval = time.Hour
+
+// retentionConfig controls the background purge. A zero max age keeps that
+// table forever; records have their own setting because they are the
+// canonical deduped copy and usually outlive raw results.
+type retentionConfig struct {
+	interval      time.Duration
+	resultsMaxAge time.Duration
+	recordsMaxAge time.Duration
+	vacuum        string // "incremental", "full" or "off"
+}
+
+func loadRetentionConfig() retentionConfig {
+	cfg := retentionConfig{
+		interval:      envDuration("AGG_RETENTION_INTERVAL", defaultRetentionInterval),
+		resultsMaxAge: envDuration("AGG_RETENTION_MAX_AGE", 0),
+		recordsMaxAge: envDuration("AGG_RECORDS_RETENTION_MAX_AGE", 0),
+		vacuum:        strings.ToLower(strings.TrimSpace(os.Getenv("AGG_RETENTION_VACUUM"))),
+	}
+	switch cfg.vacuum {
+	case "incremental", "full", "off":
+	default:
+		cfg.vacuum = "incremental"
+	}
+	if cfg.interval <= 0 {
+		cfg.interval = defaultRetentionInterval
+	}
+	return cfg
+}
+
+func (c retentionConfig) enabled() bool {
+	return c.resultsMaxAge > 0 || c.recordsMaxAge > 0
+}
+
+// envDuration reads a Go duration ("90m", "720h") or whole days ("30d").
+func envDuration(key string, def time.Duration) time.Duration {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
+	}
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return time.Duration(n) * 24 * time.Hour
+		}
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		slog.Warn("env_duration_invalid", "key", key, "value", v)
+		return def
+	}
+	return d
+}
+
+type retentionJob struct {
+	s   *server
+	cfg retentionConfig
+	now func() time.Time
+}
+
+type retentionResult struct {
+	results int64
+	records int64
+	vacuum  string
+}
+
+func newRetentionJob(s *server, cfg retentionConfig) *retentionJob {
+	return &retentionJob{s: s, cfg: cfg, now: time.Now}
+}
+
+func (j *retentionJob) run(ctx context.Context) {
+	slog.Info("retention_started", "interval", j.cfg.interval.String(), "results_max_age", j.cfg.resultsMaxAge.String(),
+		"records_max_age", j.cfg.recordsMaxAge.String(), "vacuum", j.cfg.vacuum)
+	t := time.NewTicker(j.cfg.interval)
+	defer t.Stop()
+	for {
+		j.cycle()
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (j *retentionJob) cycle() {
+	start := time.Now()
+	res, err := j.runOnce()
+	if err != nil {
+		slog.Error("retention_failed", "err", sanitizeError(err.Error()))
+		return
+	}
+	slog.Info("retention_cycle", "results_deleted", res.results, "records_deleted", res.records,
+		"vacuum", res.vacuum, "duration_ms", time.Since(start).Milliseconds())
+}
+
+// runOnce deletes rows older than each table's cutoff and, when anything was
+// deleted, reclaims the space.
+func (j *retentionJob) runOnce() (retentionResult, error) {
+	var res retentionResult
+	now := j.now()
+	var err error
+	if j.cfg.resultsMaxAge > 0 {
+		if res.results, err = j.purge("results", now.Add(-j.cfg.resultsMaxAge)); err != nil {
+			return res, err
+		}
+	}
+	if j.cfg.recordsMaxAge > 0 {
+		if res.records, err = j.purge("records", now.Add(-j.cfg.recordsMaxAge)); err != nil {
+			return res, err
+		}
+	}
+	res.vacuum = "skipped"
+	if res.results+res.records > 0 {
+		if res.vacuum, err = j.reclaim(); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+func (j *retentionJob) purge(table string, cutoff time.Time) (int64, error) {
+	r, err := j.s.db.Exec(`DELETE FROM `+table+` WHERE timestamp < `+j.s.ph(1), j.s.timeArg(cutoff))
+	if err != nil {
+		return 0, err
+	}
+	return r.RowsAffected()
+}
+
+// reclaim returns freed pages to the filesystem on SQLite. Incremental mode
+// needs auto_vacuum=INCREMENTAL, which an existing database only gets through
+// one full VACUUM; that conversion happens on the first cycle that deletes
+// anything. Postgres is left to autovacuum.
+func (j *retentionJob) reclaim() (string, error) {
+	if j.s.dbDriver != "sqlite" || j.cfg.vacuum == "off" {
+		return "off", nil
+	}
+	if j.cfg.vacuum == "full" {
+		_, err := j.s.db.Exec(`VACUUM`)
+		return "full", err
+	}
+	var mode int
+	if err := j.s.db.QueryRow(`PRAGMA auto_vacuum`).Scan(&mode); err != nil {
+		return "", err
+	}
+	if mode != 2 {
+		if _, err := j.s.db.Exec(`PRAGMA auto_vacuum = INCREMENTAL`); err != nil {
+			return "", err
+		}
+		_, err := j.s.db.Exec(`VACUUM`)
+		return "full", err
+	}
+	_, err := j.s.db.Exec(`PRAGMA incremental_vacuum`)
+	return "incremental", err
+}
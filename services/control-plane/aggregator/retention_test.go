@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetentionPurgesOnlyOldRows(t *testing.T) {
+	s := newTestServer(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, age := range []time.Duration{90 * 24 * time.Hour, 40 * 24 * time.Hour, 10 * 24 * time.Hour, time.Hour} {
+		id := string(rune('a' + i))
+		ts := s.timeArg(now.Add(-age))
+		if _, err := s.db.Exec(`INSERT INTO results(id, drone_id, profile_id, run_id, timestamp, data) VALUES(?,?,?,?,?,?)`,
+			id, "d1", "p1", "r1", ts, `{}`); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.db.Exec(`INSERT INTO records(record_id, profile_id, run_id, timestamp, data) VALUES(?,?,?,?,?)`,
+			id, "p1", "r1", ts, `{}`); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	job := newRetentionJob(s, retentionConfig{
+		interval:      time.Hour,
+		resultsMaxAge: 30 * 24 * time.Hour,
+		recordsMaxAge: 60 * 24 * time.Hour,
+		vacuum:        "incremental",
+	})
+	job.now = func() time.Time { return now }
+
+	res, err := job.runOnce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.results != 2 || res.records != 1 || res.vacuum != "full" {
+		t.Fatalf("unexpected cycle result: %+v", res)
+	}
+	if n := countRows(t, s, "results", "p1"); n != 2 {
+		t.Fatalf("results: expected the 2 recent rows to survive, got %d", n)
+	}
+	if n := countRows(t, s, "records", "p1"); n != 3 {
+		t.Fatalf("records: expected 3 rows within their own max age, got %d", n)
+	}
+	var ids []string
+	rows, err := s.db.Query(`SELECT id FROM results ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if len(ids) != 2 || ids[0] != "c" || ids[1] != "d" {
+		t.Fatalf("wrong rows purged, left %v", ids)
+	}
+
+	// The first cycle converted the database; later ones vacuum incrementally,
+	// and a cycle that deletes nothing does not vacuum at all.
+	now = now.Add(25 * 24 * time.Hour)
+	if res, err := job.runOnce(); err != nil || res.results != 1 || res.vacuum != "incremental" {
+		t.Fatalf("second cycle: %+v %v", res, err)
+	}
+	if res, err := job.runOnce(); err != nil || res.results+res.records != 0 || res.vacuum != "skipped" {
+		t.Fatalf("idle cycle: %+v %v", res, err)
+	}
+}
+
+func TestLoadRetentionConfig(t *testing.T) {
+	t.Setenv("AGG_RETENTION_INTERVAL", "15m")
+	t.Setenv("AGG_RETENTION_MAX_AGE", "30d")
+	t.Setenv("AGG_RECORDS_RETENTION_MAX_AGE", "")
+	t.Setenv("AGG_RETENTION_VACUUM", "bogus")
+	cfg := loadRetentionConfig()
+	if cfg.interval != 15*time.Minute || cfg.resultsMaxAge != 30*24*time.Hour || cfg.recordsMaxAge != 0 || cfg.vacuum != "incremental" || !cfg.enabled() {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	t.Setenv("AGG_RETENTION_MAX_AGE", "soon")
+	if cfg := loadRetentionConfig(); cfg.enabled() {
+		t.Fatalf("invalid max age must leave retention off: %+v", cfg)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	maxMetaSourceURL      = 2048
+	maxMetaMappingVersion = 128
+)
+
+// runMeta is the provenance a drone posts alongside a run's results: the
+// source URL as written in the profile (placeholders unexpanded, so no
+// secrets), how much was fetched and how long it took, and a digest of the
+// mapping block that shaped the rows. It is kept in run_meta, one row per
+// run, and served as "provenance" on GET /runs/{id}.
+type runMeta struct {
+	SourceURL       string `json:"source_url,omitempty"`
+	PagesFetched    int64  `json:"pages_fetched"`
+	BytesFetched    int64  `json:"bytes_fetched"`
+	FetchDurationMs int64  `json:"fetch_duration_ms"`
+	MappingVersion  string `json:"mapping_version,omitempty"`
+}
+
+func (m *runMeta) normalize() error {
+	m.SourceURL = strings.TrimSpace(m.SourceURL)
+	m.MappingVersion = strings.TrimSpace(m.MappingVersion)
+	switch {
+	case len(m.SourceURL) > maxMetaSourceURL:
+		return errors.New("source_url too long")
+	case len(m.MappingVersion) > maxMetaMappingVersion:
+		return errors.New("mapping_version too long")
+	case m.PagesFetched < 0 || m.BytesFetched < 0 || m.FetchDurationMs < 0:
+		return errors.New("negative count")
+	}
+	return nil
+}
+
+func runMetaSchema(timeType string) []string {
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS run_meta (
+	run_id TEXT PRIMARY KEY,
+	profile_id TEXT NOT NULL,
+	source_url TEXT,
+	pages_fetched INTEGER NOT NULL,
+	bytes_fetched INTEGER NOT NULL,
+	fetch_duration_ms INTEGER NOT NULL,
+	mapping_version TEXT,
+	recorded_at %s DEFAULT CURRENT_TIMESTAMP
+	);`, timeType),
+		`CREATE INDEX IF NOT EXISTS idx_run_meta_profile ON run_meta(profile_id);`,
+	}
+}
+
+func (s *server) upsertRunMetaSQL() string {
+	if s.dbDriver == "postgres" {
+		return `INSERT INTO run_meta(run_id, profile_id, source_url, pages_fetched, bytes_fetched, fetch_duration_ms, mapping_version)
+	VALUES($1,$2,$3,$4,$5,$6,$7)
+	ON CONFLICT (run_id) DO UPDATE SET
+	profile_id=EXCLUDED.profile_id,
+	source_url=EXCLUDED.source_url,
+	pages_fetched=EXCLUDED.pages_fetched,
+	bytes_fetched=EXCLUDED.bytes_fetched,
+	fetch_duration_ms=EXCLUDED.fetch_duration_ms,
+	mapping_version=EXCLUDED.mapping_version,
+	recorded_at=CURRENT_TIMESTAMP`
+	}
+	return `INSERT OR REPLACE INTO run_meta(run_id, profile_id, source_url, pages_fetched, bytes_fetched, fetch_duration_ms, mapping_version)
+	VALUES(?,?,?,?,?,?,?)`
+}
+
+// storeRunMeta records the provenance of a run; a later post for the same
+// run replaces it.
+func (s *server) storeRunMeta(runID, profileID string, m runMeta) error {
+	_, err := s.db.Exec(s.upsertRunMetaSQL(),
+		runID, profileID, emptyToNull(m.SourceURL), m.PagesFetched, m.BytesFetched, m.FetchDurationMs, emptyToNull(m.MappingVersion))
+	return err
+}
+
+// runMetaColumns are the run_meta columns GET /runs/{id} joins in, aliased m.
+const runMetaColumns = `m.run_id, m.source_url, m.pages_fetched, m.bytes_fetched, m.fetch_duration_ms, m.mapping_version`
+
+// runMetaScan receives runMetaColumns from a LEFT JOIN, where a run without
+// provenance yields NULLs.
+type runMetaScan struct {
+	runID, sourceURL, mappingVersion sql.NullString
+	pages, bytes, durationMs         sql.NullInt64
+}
+
+func (m *runMetaScan) dest() []any {
+	return []any{&m.runID, &m.sourceURL, &m.pages, &m.bytes, &m.durationMs, &m.mappingVersion}
+}
+
+func (m *runMetaScan) meta() *runMeta {
+	if !m.runID.Valid {
+		return nil
+	}
+	return &runMeta{
+		SourceURL:       m.sourceURL.String,
+		PagesFetched:    m.pages.Int64,
+		BytesFetched:    m.bytes.Int64,
+		FetchDurationMs: m.durationMs.Int64,
+		MappingVersion:  m.mappingVersion.String,
+	}
+}
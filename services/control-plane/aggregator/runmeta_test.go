@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRunMetaJoinedIntoRun(t *testing.T) {
+	s := newTestServer(t)
+	post := func(h http.HandlerFunc, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+		return rec
+	}
+	getRun := func(id string) runRow {
+		rec := httptest.NewRecorder()
+		s.handleRunGet(rec, httptest.NewRequest(http.MethodGet, "/runs/"+id, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("get %s: %d %s", id, rec.Code, rec.Body.String())
+		}
+		var rr runRow
+		if err := json.Unmarshal(rec.Body.Bytes(), &rr); err != nil {
+			t.Fatal(err)
+		}
+		return rr
+	}
+
+	meta := `{"source_url":"https://api.example.test/v1?key=${API_KEY}","pages_fetched":1,"bytes_fetched":2048,"fetch_duration_ms":350,"mapping_version":"sha256:abc"}`
+	if rec := post(s.handleResults, "/results", `{"drone_id":"d1","profile_id":"p1","run_id":"r1","data":[{"v":1}],"meta":`+meta+`}`); rec.Code != http.StatusOK {
+		t.Fatalf("results: %d %s", rec.Code, rec.Body.String())
+	}
+	for _, id := range []string{"r1", "r2"} {
+		if rec := post(s.handleRuns, "/runs", `{"run_id":"`+id+`","drone_id":"d1","profile_id":"p1","started_at":"2026-03-01T12:00:00Z","status":"succeeded","rows_out":1}`); rec.Code != http.StatusOK {
+			t.Fatalf("run %s: %d %s", id, rec.Code, rec.Body.String())
+		}
+	}
+
+	want := runMeta{SourceURL: "https://api.example.test/v1?key=${API_KEY}", PagesFetched: 1, BytesFetched: 2048, FetchDurationMs: 350, MappingVersion: "sha256:abc"}
+	if rr := getRun("r1"); rr.Provenance == nil || *rr.Provenance != want || rr.Status != "succeeded" {
+		t.Fatalf("r1: %+v %+v", rr, rr.Provenance)
+	}
+	if rr := getRun("r2"); rr.Provenance != nil {
+		t.Fatalf("r2 has provenance %+v", rr.Provenance)
+	}
+
+	// A repeated post for the run replaces its provenance.
+	post(s.handleResults, "/results", `{"drone_id":"d1","profile_id":"p1","run_id":"r1","data":[],"meta":{"pages_fetched":2}}`)
+	if rr := getRun("r1"); rr.Provenance == nil || *rr.Provenance != (runMeta{PagesFetched: 2}) {
+		t.Fatalf("replaced: %+v", rr.Provenance)
+	}
+
+	for _, body := range []string{
+		`{"drone_id":"d1","profile_id":"p1","run_id":"r3","data":[],"meta":{"pages_fetched":-1}}`,
+		`{"drone_id":"d1","profile_id":"p1","run_id":"r3","data":[],"meta":{"source_url":"` + strings.Repeat("x", maxMetaSourceURL+1) + `"}}`,
+	} {
+		if rec := post(s.handleResults, "/results", body); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid_meta") {
+			t.Fatalf("invalid meta: %d %s", rec.Code, rec.Body.String())
+		}
+	}
+	if rec := post(s.handleResults, "/results", `{"drone_id":"d1","profile_id":"p1","run_id":"r3","data":[],"meta":{"pages":1}}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown meta field: %d %s", rec.Code, rec.Body.String())
+	}
+}
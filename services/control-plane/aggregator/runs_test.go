@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRunsLatestReturnsOnePerProfileUncapped(t *testing.T) {
+	s := newTestServer(t)
+	const profiles = 1005
+	for i := 0; i < profiles; i++ {
+		pid := fmt.Sprintf("p%04d", i)
+		for _, started := range []string{"2026-03-01T10:00:00Z", "2026-03-01T11:00:00Z"} {
+			runID := pid + "-" + started
+			if _, err := s.db.Exec(s.upsertRunSQL(), runID, "d1", pid, started, nil, "succeeded", 1, 10, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// A second run sharing p0000's newest started_at must not duplicate it.
+	if _, err := s.db.Exec(s.upsertRunSQL(), "p0000-tie", "d1", "p0000", "2026-03-01T11:00:00Z", nil, "failed", 0, 10, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(target string) []runRow {
+		rec := httptest.NewRecorder()
+		s.handleRuns(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var out []runRow
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d %v", target, rec.Code, err)
+		}
+		return out
+	}
+
+	out := get("/runs?latest=1")
+	if len(out) != profiles {
+		t.Fatalf("latest returned %d runs, want one for each of %d profiles", len(out), profiles)
+	}
+	seen := make(map[string]bool)
+	for _, rr := range out {
+		if seen[rr.ProfileID] || rr.StartedAt != "2026-03-01T11:00:00Z" {
+			t.Fatalf("unexpected run %+v", rr)
+		}
+		seen[rr.ProfileID] = true
+	}
+	if out := get("/runs?latest=1&profile_id=p0000&profile_id=p0001"); len(out) != 2 {
+		t.Fatalf("filtered latest: %+v", out)
+	}
+	if out := get("/runs?latest=1&limit=5"); len(out) != 5 {
+		t.Fatalf("an explicit limit still applies: %d", len(out))
+	}
+}
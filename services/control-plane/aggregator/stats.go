@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// statsFieldRe accepts dotted object paths such as "c" or "quote.close".
+var statsFieldRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// handleResultsStats serves GET /results/stats?profile_id=X&field=a.b with
+// count, min, max, sum and avg of a numeric field of each row's data,
+// optionally limited to a since/until window.
+func (s *server) handleResultsStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
+		return
+	}
+
+	q := r.URL.Query()
+	profileID := strings.TrimSpace(q.Get("profile_id"))
+	if profileID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "missing_profile_id"})
+		return
+	}
+	field := strings.TrimSpace(q.Get("field"))
+	if field == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "missing_field"})
+		return
+	}
+	if !statsFieldRe.MatchString(field) {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_field"})
+		return
+	}
+	since, until, errCode := parseTimeWindow(q.Get("since"), q.Get("until"))
+	if errCode != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": errCode})
+		return
+	}
+
+	// v is the field value when it is a JSON number and NULL otherwise, so
+	// COUNT(v) counts numeric rows and the aggregates skip everything else.
+	var value string
+	var args []any
+	if s.dbDriver == "postgres" {
+		value = `CASE WHEN jsonb_typeof(data::jsonb #> $1::text[]) = 'number' THEN (data::jsonb #>> $2::text[])::double precision END`
+		path := "{" + strings.ReplaceAll(field, ".", ",") + "}"
+		args = []any{path, path}
+	} else {
+		value = `CASE WHEN json_type(data, ?) IN ('integer', 'real') THEN json_extract(data, ?) END`
+		path := "$." + field
+		args = []any{path, path}
+	}
+	// Compressed rows have an empty data column; they are aggregated in Go
+	// below and merged in.
+	conds := []string{"profile_id = " + s.ph(3), "data_enc IS NULL"}
+	args = append(args, profileID)
+	conds, args, _ = s.windowConds(conds, args, 4, since, until)
+
+	sqlq := `SELECT COUNT(*), COUNT(v), MIN(v), MAX(v), SUM(v) FROM (SELECT ` + value +
+		` AS v FROM results WHERE ` + strings.Join(conds, " AND ") + `) t`
+	var rows, numeric int64
+	var minV, maxV, sumV sql.NullFloat64
+	if err := s.db.QueryRow(sqlq, args...).Scan(&rows, &numeric, &minV, &maxV, &sumV); err != nil {
+		slog.Error("stats_query_failed", "profile_id", profileID, "field", field, "err", sanitizeError(err.Error()))
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "db_error"})
+		return
+	}
+	z, err := s.compressedFieldStats(profileID, field, since, until)
+	if err != nil {
+		slog.Error("stats_query_failed", "profile_id", profileID, "field", field, "err", sanitizeError(err.Error()))
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "db_error"})
+		return
+	}
+	if z.seen {
+		if !minV.Valid || z.min < minV.Float64 {
+			minV = sql.NullFloat64{Float64: z.min, Valid: true}
+		}
+		if !maxV.Valid || z.max > maxV.Float64 {
+			maxV = sql.NullFloat64{Float64: z.max, Valid: true}
+		}
+		sumV = sql.NullFloat64{Float64: sumV.Float64 + z.sum, Valid: true}
+	}
+	rows += z.rows
+	numeric += z.numeric
+
+	// A field that is missing or non-numeric on most rows is almost certainly
+	// the wrong path; averaging the few rows that happen to match would mislead.
+	if rows > 0 && numeric*2 <= rows {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+			"error":        "field_not_numeric",
+			"field":        field,
+			"rows":         rows,
+			"numeric_rows": numeric,
+		})
+		return
+	}
+
+	out := map[string]any{
+		"profile_id": profileID,
+		"field":      field,
+		"rows":       rows,
+		"count":      numeric,
+		"min":        nil,
+		"max":        nil,
+		"sum":        nil,
+		"avg":        nil,
+	}
+	if numeric > 0 {
+		out["min"] = minV.Float64
+		out["max"] = maxV.Float64
+		out["sum"] = sumV.Float64
+		out["avg"] = sumV.Float64 / float64(numeric)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func seedStatsRows(t *testing.T, s *server) {
+	t.Helper()
+	rows := []struct{ id, ts, data string }{
+		{"a", "2026-01-01 00:00:00", `{"c":10,"q":{"close":1.5},"name":"x"}`},
+		{"b", "2026-01-01 01:00:00", `{"c":20.5,"q":{"close":2.5}}`},
+		{"c", "2026-01-01 02:00:00", `{"c":"n/a"}`},
+		{"d", "2026-01-01 03:00:00", `{"other":1}`},
+		{"e", "2026-01-01 04:00:00", `{"c":-4,"name":"y"}`},
+	}
+	for _, r := range rows {
+		if _, err := s.db.Exec(`INSERT INTO results(id, drone_id, profile_id, run_id, timestamp, data) VALUES(?,?,?,?,?,?)`,
+			r.id, "d1", "p1", "r1", r.ts, r.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.db.Exec(`INSERT INTO results(id, drone_id, profile_id, run_id, timestamp, data) VALUES(?,?,?,?,?,?)`,
+		"z", "d1", "p2", "r2", "2026-01-01 00:00:00", `{"c":1000}`); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResultsStats(t *testing.T) {
+	s := newTestServer(t)
+	seedStatsRows(t, s)
+
+	get := func(target string) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		s.handleResultsStats(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var out map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatalf("%s: %v %s", target, err, rec.Body.String())
+		}
+		return rec.Code, out
+	}
+
+	// Three of five rows carry a numeric c; the string and the missing value are skipped.
+	code, out := get("/results/stats?profile_id=p1&field=c")
+	if code != http.StatusOK {
+		t.Fatalf("stats: %d %v", code, out)
+	}
+	if out["rows"] != 5.0 || out["count"] != 3.0 || out["min"] != -4.0 || out["max"] != 20.5 || out["sum"] != 26.5 {
+		t.Fatalf("unexpected stats: %v", out)
+	}
+	if avg := out["avg"].(float64); avg < 8.83 || avg > 8.84 {
+		t.Fatalf("avg: %v", avg)
+	}
+
+	// The window keeps a and b only.
+	code, out = get("/results/stats?profile_id=p1&field=c&until=2026-01-01T01:30:00Z")
+	if code != http.StatusOK || out["count"] != 2.0 || out["avg"] != 15.25 {
+		t.Fatalf("windowed stats: %d %v", code, out)
+	}
+
+	// Nested paths resolve, but q.close is numeric on only 2 of 5 rows.
+	code, out = get("/results/stats?profile_id=p1&field=q.close")
+	if code != http.StatusUnprocessableEntity || out["error"] != "field_not_numeric" || out["numeric_rows"] != 2.0 {
+		t.Fatalf("mostly-missing field: %d %v", code, out)
+	}
+	code, out = get("/results/stats?profile_id=p1&field=name")
+	if code != http.StatusUnprocessableEntity || out["numeric_rows"] != 0.0 {
+		t.Fatalf("string field: %d %v", code, out)
+	}
+
+	code, out = get("/results/stats?profile_id=nope&field=c")
+	if code != http.StatusOK || out["rows"] != 0.0 || out["count"] != 0.0 || out["avg"] != nil {
+		t.Fatalf("empty profile: %d %v", code, out)
+	}
+
+	for target, want := range map[string]string{
+		"/results/stats?field=c":                               "missing_profile_id",
+		"/results/stats?profile_id=p1":                         "missing_field",
+		"/results/stats?profile_id=p1&field=c')--":             "invalid_field",
+		"/results/stats?profile_id=p1&field=c&since=yesterday": "invalid_since",
+	} {
+		if code, out := get(target); code != http.StatusBadRequest || out["error"] != want {
+			t.Fatalf("%s: %d %v", target, code, out)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func seedTimedRows(t *testing.T, s *server) {
+	t.Helper()
+	for i, ts := range []string{"2026-01-01 00:00:00", "2026-01-01 01:00:00", "2026-01-01 02:00:00", "2026-01-01 03:00:00"} {
+		id := string(rune('a' + i))
+		if _, err := s.db.Exec(`INSERT INTO results(id, drone_id, profile_id, run_id, timestamp, data) VALUES(?,?,?,?,?,?)`,
+			id, "d1", "p1", "r1", ts, `{"id":"`+id+`"}`); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.db.Exec(`INSERT INTO records(record_id, profile_id, run_id, timestamp, data) VALUES(?,?,?,?,?)`,
+			id, "p1", "r1", ts, `{"id":"`+id+`"}`); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestResultsTimeWindow(t *testing.T) {
+	s := newTestServer(t)
+	seedTimedRows(t, s)
+
+	get := func(h http.HandlerFunc, target string) (int, string) {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			return rec.Code, rec.Body.String()
+		}
+		var raw []json.RawMessage
+		if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]string, 0, len(raw))
+		for _, r := range raw {
+			var row struct {
+				ID   string `json:"id"`
+				Data struct {
+					ID string `json:"id"`
+				} `json:"data"`
+			}
+			_ = json.Unmarshal(r, &row)
+			// /records returns the data documents themselves.
+			if row.Data.ID != "" {
+				row.ID = row.Data.ID
+			}
+			ids = append(ids, row.ID)
+		}
+		return rec.Code, strings.Join(ids, ",")
+	}
+
+	cases := []struct {
+		query, want string
+	}{
+		{"since=2026-01-01T01:00:00Z", "d,c,b"},
+		{"until=2026-01-01T01:00:00Z", "a"},
+		{"since=2026-01-01T01:00:00Z&until=2026-01-01T03:00:00Z", "c,b"},
+		{"since=2026-01-01T02:00:00%2B01:00", "d,c,b"},
+		{"since=2026-01-01T00:30:00Z&limit=2", "d,c"},
+		{"profile_id=p2&since=2026-01-01T00:00:00Z", ""},
+	}
+	for _, tc := range cases {
+		for name, h := range map[string]http.HandlerFunc{"results": s.handleResults, "records": s.handleRecords} {
+			if code, got := get(h, "/"+name+"?"+tc.query); code != http.StatusOK || got != tc.want {
+				t.Fatalf("%s?%s: %d %q want %q", name, tc.query, code, got, tc.want)
+			}
+		}
+	}
+
+	for _, q := range []string{"since=yesterday", "until=2026-01-01", "since=2026-01-02T00:00:00Z&until=2026-01-01T00:00:00Z"} {
+		for name, h := range map[string]http.HandlerFunc{"results": s.handleResults, "records": s.handleRecords} {
+			if code, body := get(h, "/"+name+"?"+q); code != http.StatusBadRequest {
+				t.Fatalf("%s?%s: expected 400, got %d %s", name, q, code, body)
+			}
+		}
+	}
+}
+
+func TestResultsDefaultMaxAge(t *testing.T) {
+	s := newTestServer(t)
+	s.resultsMaxAge = 24 * time.Hour
+	seedTimedRows(t, s)
+	seedResults(t, s, "p1", "fresh")
+
+	ids := func(target string) ([]string, *httptest.ResponseRecorder) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.handleResults(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", target, rec.Code, rec.Body.String())
+		}
+		var rows []struct {
+			ID   string         `json:"id"`
+			Data map[string]any `json:"data"`
+		}
+		body := rec.Body.Bytes()
+		if strings.Contains(target, "cursor=") {
+			var page struct {
+				Rows json.RawMessage `json:"rows"`
+			}
+			_ = json.Unmarshal(body, &page)
+			body = page.Rows
+		}
+		if err := json.Unmarshal(body, &rows); err != nil {
+			t.Fatal(err)
+		}
+		out := make([]string, 0, len(rows))
+		for _, r := range rows {
+			if v, ok := r.Data["v"].(string); ok {
+				out = append(out, v)
+				continue
+			}
+			out = append(out, r.ID)
+		}
+		return out, rec
+	}
+
+	got, rec := ids("/results?profile_id=p1")
+	if strings.Join(got, ",") != "fresh" {
+		t.Fatalf("default window: %v", got)
+	}
+	if rec.Header().Get("X-Results-Max-Age") != "86400" || rec.Header().Get("X-Results-Since") == "" {
+		t.Fatalf("window headers: %v", rec.Header())
+	}
+
+	got, rec = ids("/results?profile_id=p1&since=2026-01-01T01:00:00Z")
+	if strings.Join(got, ",") != "fresh,d,c,b" || rec.Header().Get("X-Results-Since") != "" {
+		t.Fatalf("explicit since: %v %v", got, rec.Header())
+	}
+	if got, _ := ids("/results?profile_id=p1&until=2026-01-01T02:00:00Z"); strings.Join(got, ",") != "b,a" {
+		t.Fatalf("explicit until: %v", got)
+	}
+
+	got, rec = ids("/results?profile_id=p1&cursor=")
+	if strings.Join(got, ",") != "fresh" {
+		t.Fatalf("paged default window: %v", got)
+	}
+	var page struct {
+		Meta map[string]any `json:"meta"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &page)
+	if page.Meta["implicit_since"] != true || page.Meta["max_age_seconds"] != float64(86400) || page.Meta["since"] == nil {
+		t.Fatalf("paged meta: %v", page.Meta)
+	}
+
+	s.resultsMaxAge = 0
+	if got, _ := ids("/results?profile_id=p1"); len(got) != 5 {
+		t.Fatalf("max age disabled: %v", got)
+	}
+}
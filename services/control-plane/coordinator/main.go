@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"sort"
@@ -44,6 +45,7 @@ type server struct {
 }
 
 func main() {
+	setupLogging()
 	regURL := strings.TrimSpace(os.Getenv("REGISTRY_URL"))
 	if regURL == "" {
 		regURL = defaultRegistryURL
@@ -81,9 +83,9 @@ func main() {
 		ReadHeaderTimeout: 10 * time.Second,
 	}
 
-	logLine("INFO", "starting", "addr=%s registry_url=%s", addr, regURL)
+	slog.Info("starting", "addr", addr, "registry_url", regURL)
 	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		logLine("ERROR", "listen_failed", "err=%s", err.Error())
+		slog.Error("listen_failed", "err", err)
 		os.Exit(1)
 	}
 }
@@ -465,15 +467,19 @@ func requestLoggingMiddleware(next http.Handler) http.Handler {
 
 		dur := time.Since(start).Milliseconds()
 		metricsRecord(rec.status, dur)
-		level := "INFO"
+		level := slog.LevelInfo
 		if rec.status >= 500 {
-			level = "ERROR"
+			level = slog.LevelError
 		} else if rec.status >= 400 {
-			level = "WARN"
+			level = slog.LevelWarn
 		}
-		ts := time.Now().UTC().Format(time.RFC3339)
-		fmt.Fprintf(os.Stdout, "%s %s method=%s path=%s status=%d duration_ms=%d\n",
-			ts, level, r.Method, r.URL.Path, rec.status, dur)
+		slog.Log(r.Context(), level, "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", dur,
+			"request_id", strings.TrimSpace(r.Header.Get("X-Request-ID")),
+		)
 	})
 }
 
@@ -492,12 +498,6 @@ func withCORS(next http.Handler) http.Handler {
 	})
 }
 
-func logLine(level, msg, format string, args ...any) {
-	ts := time.Now().UTC().Format(time.RFC3339)
-	line := fmt.Sprintf(format, args...)
-	fmt.Fprintf(os.Stdout, "%s %s %s %s\n", ts, level, msg, line)
-}
-
 // --- minimal metrics ---
 
 var metricsMu sync.Mutex
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// --- Anonymous paths ---
+
+// defaultAllowAnonymous is used when AUTH_ALLOW_ANONYMOUS is unset: health,
+// read-only dashboards and the public market data feeds.
+var defaultAllowAnonymous = []string{
+	"/health",
+	"/api/health",
+	"/api/gateway/health",
+	"/api/status",
+	"/api/openapi.json",
+	"/api/auth/logout",
+	"/api/events",
+	"/api/live/stream",
+	"/api/results",
+	"/api/results/summary",
+	"/api/results/stream",
+	"/api/summary",
+	"/api/reports",
+	"/api/audit/health",
+	"/api/audit/v0/events",
+	"/api/catalog",
+	"/api/gateway/connectors/catalog",
+	"/api/gateway/connectors/health",
+	"/api/connectors/health",
+	"/api/crypto/symbols",
+	"/api/crypto/top",
+	"/api/crypto/stream",
+	"/api/crypto/ws",
+	"/api/crypto/health",
+	"/metrics",
+	"/favicon.ico",
+}
+
+// legacyAnonymousPrefixes were open regardless of configuration before
+// AUTH_STRICT_PATHS. They stay open unless strict mode is on.
+var legacyAnonymousPrefixes = []string{
+	"/api/reports/*",
+	"/api/profiles/*",
+	"/api/gateway/connectors/*",
+	"/api/connectors/*",
+	"/api/audit/*",
+}
+
+// anonymousPaths is the set of paths served without credentials: exact
+// paths, and prefixes written as "/api/crypto/*" that match everything below
+// "/api/crypto/" (but not "/api/crypto" itself).
+type anonymousPaths struct {
+	exact    map[string]struct{}
+	prefixes []string
+}
+
+func parseAnonymousPaths(entries []string) anonymousPaths {
+	out := anonymousPaths{exact: make(map[string]struct{})}
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		switch {
+		case e == "":
+		case strings.HasSuffix(e, "/*"):
+			out.prefixes = append(out.prefixes, strings.TrimSuffix(e, "*"))
+		default:
+			out.exact[e] = struct{}{}
+		}
+	}
+	sort.Strings(out.prefixes)
+	return out
+}
+
+// loadAnonymousPaths reads AUTH_ALLOW_ANONYMOUS (comma-separated), falling
+// back to defaultAllowAnonymous when it is empty. Unless strict, the legacy
+// prefixes are added on top.
+func loadAnonymousPaths(raw string, strict bool) anonymousPaths {
+	entries := splitCSV(raw)
+	if len(entries) == 0 {
+		entries = append([]string(nil), defaultAllowAnonymous...)
+	}
+	if !strict {
+		entries = append(entries, legacyAnonymousPrefixes...)
+	}
+	return parseAnonymousPaths(entries)
+}
+
+func (a anonymousPaths) allows(path string) bool {
+	if _, ok := a.exact[path]; ok {
+		return true
+	}
+	for _, p := range a.prefixes {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestDefaultAnonymousPaths documents which paths are open without
+// credentials under the defaults, before and after AUTH_STRICT_PATHS.
+func TestDefaultAnonymousPaths(t *testing.T) {
+	cases := []struct {
+		path         string
+		open, strict bool
+	}{
+		{"/health", true, true},
+		{"/metrics", true, true},
+		{"/api/status", true, true},
+		{"/api/events", true, true},
+		{"/api/summary", true, true},
+		{"/api/results/stream", true, true},
+		{"/api/crypto/top", true, true},
+		{"/api/crypto/ws", true, true},
+		{"/api/catalog", true, true},
+		{"/api/reports", true, true},
+		{"/api/audit/v0/events", true, true},
+		{"/api/gateway/connectors/health", true, true},
+
+		{"/api/reports/live-crypto-wall", true, false},
+		{"/api/profiles/p1", true, false},
+		{"/api/connectors/x/config", true, false},
+		{"/api/gateway/connectors/x/config", true, false},
+		{"/api/audit/other", true, false},
+
+		{"/api/profiles", false, false},
+		{"/api/profiles:status", false, false},
+		{"/api/drones", false, false},
+		{"/api/gateway/webhooks/dlq", false, false},
+		{"/api/gateway/auth/revoke", false, false},
+		{"/api/crypto/klines", false, false},
+		{"/api/ws", false, false},
+		{"/healthz", false, false},
+	}
+	legacy := loadAnonymousPaths("", false)
+	strict := loadAnonymousPaths("", true)
+	for _, tc := range cases {
+		if got := legacy.allows(tc.path); got != tc.open {
+			t.Errorf("%s: open=%v by default, want %v", tc.path, got, tc.open)
+		}
+		if got := strict.allows(tc.path); got != tc.strict {
+			t.Errorf("%s: open=%v with AUTH_STRICT_PATHS, want %v", tc.path, got, tc.strict)
+		}
+	}
+}
+
+func TestConfiguredAnonymousPaths(t *testing.T) {
+	a := loadAnonymousPaths(" /health , /api/crypto/* ,", true)
+	for path, want := range map[string]bool{
+		"/health":             true,
+		"/api/crypto/top":     true,
+		"/api/crypto/a/b":     true,
+		"/api/crypto":         false, // a prefix covers what is below it only
+		"/api/cryptocurrency": false,
+		"/metrics":            false, // the list replaces the defaults
+	} {
+		if got := a.allows(path); got != want {
+			t.Errorf("%s: open=%v, want %v", path, got, want)
+		}
+	}
+	if !loadAnonymousPaths("/health", false).allows("/api/profiles/p1") {
+		t.Error("legacy prefixes apply on top of a configured list until strict")
+	}
+}
+
+func TestWithAuthStrictPaths(t *testing.T) {
+	h := func(strict bool) http.Handler {
+		cfg := &authConfig{Enabled: true, APIKeys: parseKeySet("k"), TenantHeader: "X-Tenant-ID", AllowAnonymous: loadAnonymousPaths("", strict)}
+		return withAuth(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	}
+	for _, tc := range []struct {
+		strict bool
+		want   int
+	}{{false, http.StatusOK}, {true, http.StatusUnauthorized}} {
+		rec := httptest.NewRecorder()
+		h(tc.strict).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/profiles/p1", nil))
+		if rec.Code != tc.want {
+			t.Fatalf("strict=%v: status %d, want %d", tc.strict, rec.Code, tc.want)
+		}
+	}
+}
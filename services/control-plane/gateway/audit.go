@@ -0,0 +1,724 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Audit log ---
+
+const (
+	defaultAuditLogMaxBytes = 100 << 20
+	defaultAuditLogMaxFiles = 14
+	auditDayLayout          = "2006-01-02"
+)
+
+// auditBackend persists audit events. query returns the page of events
+// matching f (see auditCollector).
+type auditBackend interface {
+	append(ev auditEvent) error
+	query(f auditFilter) (auditPage, error)
+}
+
+// auditPage is one page of events. NextSince is set when paging by since;
+// NextCursor and PrevCursor when paging by cursor.
+type auditPage struct {
+	Items      []auditEvent
+	NextSince  string
+	NextCursor string
+	PrevCursor string
+}
+
+// auditFilter selects events for auditStore.list. Empty fields match
+// everything; Limit applies after filtering.
+type auditFilter struct {
+	Limit        int
+	Since        time.Time // inclusive
+	Until        time.Time // exclusive
+	Action       string    // HTTP method or custom event type, case-insensitive
+	Outcome      string    // "success" or "error"
+	ActorID      string
+	ObjectPrefix string // prefix of object_key
+
+	// Direction ("asc" or "desc") switches to cursor paging in
+	// (event_ts, event_id) order, starting after Cursor when it is set.
+	Direction string
+	Cursor    *auditCursor
+}
+
+func (f auditFilter) cursorMode() bool {
+	return f.Direction != ""
+}
+
+// auditCursor is a position in (event_ts, event_id) order. Dir is the
+// direction to continue in, so a prev_cursor needs no direction param.
+type auditCursor struct {
+	TS      string `json:"ts"`
+	EventID string `json:"event_id"`
+	Dir     string `json:"dir,omitempty"`
+}
+
+func encodeAuditCursor(ev auditEvent, dir string) string {
+	raw, _ := json.Marshal(auditCursor{TS: ev.EventTS, EventID: ev.EventID, Dir: dir})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeAuditCursor(s string) (*auditCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	var c auditCursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, err
+	}
+	if c.TS == "" && c.EventID == "" {
+		return nil, fmt.Errorf("empty cursor")
+	}
+	switch c.Dir {
+	case "", "asc", "desc":
+	default:
+		return nil, fmt.Errorf("invalid cursor direction %q", c.Dir)
+	}
+	return &c, nil
+}
+
+// compareAuditKey orders events by timestamp, then by event id. Ids are
+// usually UnixNano strings, so all-digit ids compare numerically.
+func compareAuditKey(aTS, aID, bTS, bID string) int {
+	at, aerr := time.Parse(time.RFC3339, aTS)
+	bt, berr := time.Parse(time.RFC3339, bTS)
+	switch {
+	case aerr == nil && berr == nil:
+		if c := at.Compare(bt); c != 0 {
+			return c
+		}
+	case aTS != bTS:
+		return strings.Compare(aTS, bTS)
+	}
+	if allDigits(aID) && allDigits(bID) && len(aID) != len(bID) {
+		if len(aID) < len(bID) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(aID, bID)
+}
+
+// nullIfEmpty renders an unset cursor as JSON null.
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func allDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func (f auditFilter) match(ev auditEvent) bool {
+	if auditBefore(ev, f.Since) || auditAtOrAfter(ev, f.Until) {
+		return false
+	}
+	if f.Action != "" && !strings.EqualFold(ev.Action, f.Action) {
+		return false
+	}
+	if f.Outcome != "" && ev.Outcome != f.Outcome {
+		return false
+	}
+	if f.ActorID != "" && ev.ActorID != f.ActorID {
+		return false
+	}
+	return strings.HasPrefix(ev.ObjectKey, f.ObjectPrefix)
+}
+
+type auditStore struct {
+	backend auditBackend
+	notify  func(auditEvent)
+}
+
+// newAuditStore keeps the last max events in memory.
+func newAuditStore(max int) *auditStore {
+	return &auditStore{backend: newMemoryAuditBackend(max)}
+}
+
+// loadAuditStore uses the NDJSON file backend when AUDIT_LOG_PATH is set and
+// falls back to memory (keeping max events) when it is unset or unusable.
+// The file backend also keeps the last max events in memory, replayed from
+// disk on start.
+func loadAuditStore(max int) *auditStore {
+	path := strings.TrimSpace(os.Getenv("AUDIT_LOG_PATH"))
+	if path == "" {
+		return newAuditStore(max)
+	}
+	b, err := newFileAuditBackend(path, auditFileConfig{
+		maxBytes: envInt64("AUDIT_LOG_MAX_BYTES", defaultAuditLogMaxBytes),
+		maxFiles: envInt("AUDIT_LOG_MAX_FILES", defaultAuditLogMaxFiles),
+		recent:   max,
+	})
+	if err != nil {
+		slog.Warn("audit_log_open_failed", "path", path, "err", err)
+		return newAuditStore(max)
+	}
+	slog.Info("audit_log_file", "path", path, "max_bytes", b.cfg.maxBytes, "max_files", b.cfg.maxFiles, "replayed", len(b.recent.events))
+	return &auditStore{backend: b}
+}
+
+func (s *auditStore) add(ev auditEvent) {
+	if err := s.backend.append(ev); err != nil {
+		slog.Warn("audit_append_failed", "event_id", ev.EventID, "err", err)
+	}
+	if s.notify != nil {
+		s.notify(ev)
+	}
+}
+
+func (s *auditStore) list(f auditFilter) []auditEvent {
+	return s.page(f).Items
+}
+
+// page is list plus the cursors for the neighbouring pages, empty when there
+// is nothing more in that direction.
+func (s *auditStore) page(f auditFilter) auditPage {
+	p, err := s.backend.query(f)
+	if err != nil {
+		slog.Warn("audit_query_failed", "err", err)
+		return auditPage{Items: []auditEvent{}}
+	}
+	return p
+}
+
+// auditBefore reports whether ev is older than since. Events with an
+// unparseable timestamp are kept.
+func auditBefore(ev auditEvent, since time.Time) bool {
+	if since.IsZero() {
+		return false
+	}
+	ts, err := time.Parse(time.RFC3339, ev.EventTS)
+	return err == nil && ts.Before(since)
+}
+
+func auditAtOrAfter(ev auditEvent, until time.Time) bool {
+	if until.IsZero() {
+		return false
+	}
+	ts, err := time.Parse(time.RFC3339, ev.EventTS)
+	return err == nil && !ts.Before(until)
+}
+
+func tailAuditEvents(events []auditEvent, limit int) []auditEvent {
+	if limit > 0 && limit < len(events) {
+		return events[len(events)-limit:]
+	}
+	return events
+}
+
+// auditCollector gathers matching events in file order. Without Since it
+// keeps the newest Limit. With Since it pages forward: the first Limit events
+// from Since on, with next_since set to the timestamp of the first event left
+// out. Timestamps have second resolution, so pages end on a second boundary
+// (and grow past Limit when one second alone holds more) to keep since
+// inclusive without repeating or skipping events.
+//
+// In cursor mode it instead keeps the first Limit events past the cursor in
+// (event_ts, event_id) order, which is total, so pages are exactly Limit
+// long and never overlap.
+type auditCollector struct {
+	f      auditFilter
+	out    []auditEvent
+	before bool // cursor mode: a match exists on the far side of the cursor
+}
+
+func (c *auditCollector) forward() bool {
+	return !c.f.Since.IsZero() && c.f.Limit > 0
+}
+
+// add records ev and reports whether the collector needs no more events.
+func (c *auditCollector) add(ev auditEvent) bool {
+	if !c.f.match(ev) {
+		return false
+	}
+	if c.f.cursorMode() {
+		c.addCursor(ev)
+		return false
+	}
+	c.out = append(c.out, ev)
+	limit := c.f.Limit
+	if c.forward() {
+		n := len(c.out)
+		return n > limit && c.out[n-1].EventTS != c.out[limit-1].EventTS
+	}
+	if limit > 0 && len(c.out) >= 2*limit {
+		c.out = append(c.out[:0], c.out[len(c.out)-limit:]...)
+	}
+	return false
+}
+
+// beyond reports whether ev comes after the cursor in the paging direction.
+func (c *auditCollector) beyond(ev auditEvent) bool {
+	cur := c.f.Cursor
+	if cur == nil {
+		return true
+	}
+	cmp := compareAuditKey(ev.EventTS, ev.EventID, cur.TS, cur.EventID)
+	if c.f.Direction == "desc" {
+		return cmp < 0
+	}
+	return cmp > 0
+}
+
+func (c *auditCollector) sortCursor() {
+	desc := c.f.Direction == "desc"
+	sort.SliceStable(c.out, func(i, j int) bool {
+		cmp := compareAuditKey(c.out[i].EventTS, c.out[i].EventID, c.out[j].EventTS, c.out[j].EventID)
+		if desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+}
+
+func (c *auditCollector) addCursor(ev auditEvent) {
+	if !c.beyond(ev) {
+		c.before = true
+		return
+	}
+	c.out = append(c.out, ev)
+	// Keep Limit+1 so result can tell whether another page follows.
+	if keep := c.f.Limit + 1; c.f.Limit > 0 && len(c.out) >= 2*keep {
+		c.sortCursor()
+		c.out = c.out[:keep]
+	}
+}
+
+func (c *auditCollector) result() auditPage {
+	out, limit := c.out, c.f.Limit
+	if out == nil {
+		out = make([]auditEvent, 0)
+	}
+	if c.f.cursorMode() {
+		c.out = out
+		c.sortCursor()
+		p := auditPage{Items: c.out}
+		if limit > 0 && len(p.Items) > limit {
+			p.Items = p.Items[:limit]
+			p.NextCursor = encodeAuditCursor(p.Items[limit-1], c.f.Direction)
+		}
+		if c.before && len(p.Items) > 0 {
+			back := "asc"
+			if c.f.Direction == "asc" {
+				back = "desc"
+			}
+			p.PrevCursor = encodeAuditCursor(p.Items[0], back)
+		}
+		return p
+	}
+	if !c.forward() {
+		return auditPage{Items: tailAuditEvents(out, limit)}
+	}
+	if len(out) <= limit {
+		return auditPage{Items: out}
+	}
+	end := limit
+	for end > 0 && out[end-1].EventTS == out[limit].EventTS {
+		end--
+	}
+	if end == 0 {
+		for end = limit; end < len(out) && out[end].EventTS == out[0].EventTS; end++ {
+		}
+		if end == len(out) {
+			return auditPage{Items: out}
+		}
+	}
+	return auditPage{Items: out[:end], NextSince: out[end].EventTS}
+}
+
+// memoryAuditBackend is a ring of the last max events; history is lost on restart.
+type memoryAuditBackend struct {
+	mu      sync.Mutex
+	events  []auditEvent
+	max     int
+	dropped int
+}
+
+func newMemoryAuditBackend(max int) *memoryAuditBackend {
+	if max <= 0 {
+		max = 1000
+	}
+	return &memoryAuditBackend{max: max}
+}
+
+func (b *memoryAuditBackend) append(ev auditEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = append(b.events, ev)
+	if n := len(b.events) - b.max; n > 0 {
+		b.events = b.events[n:]
+		b.dropped += n
+	}
+	return nil
+}
+
+func (b *memoryAuditBackend) query(f auditFilter) (auditPage, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := auditCollector{f: f}
+	for _, ev := range b.events {
+		if c.add(ev) {
+			break
+		}
+	}
+	return c.result(), nil
+}
+
+// covers reports whether the ring alone can answer f: it holds the whole
+// history, or f pages forward from inside the window, or the newest f.Limit
+// matches are all in it. Cursor pages always need the whole history.
+func (b *memoryAuditBackend) covers(f auditFilter, complete bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if complete && b.dropped == 0 {
+		return true
+	}
+	if len(b.events) == 0 || f.Limit <= 0 || f.cursorMode() {
+		return false
+	}
+	if !f.Since.IsZero() {
+		oldest, err := time.Parse(time.RFC3339, b.events[0].EventTS)
+		return err == nil && f.Since.After(oldest)
+	}
+	n := 0
+	for i := len(b.events) - 1; i >= 0 && n < f.Limit; i-- {
+		if f.match(b.events[i]) {
+			n++
+		}
+	}
+	return n >= f.Limit
+}
+
+type auditFileConfig struct {
+	maxBytes int64 // rotate before the active file grows past this
+	maxFiles int   // rotated files to keep; <= 0 keeps all
+	recent   int   // events kept in memory for fast queries
+}
+
+// fileAuditBackend appends one JSON event per line to path. The file is
+// rotated at the first write of a new UTC day, or when the next line would
+// take it past maxBytes, to path.YYYY-MM-DD (path.YYYY-MM-DD.N for further
+// rotations that day), and only the newest maxFiles rotated files are kept.
+// The last events are also held in a memory ring, replayed from disk on
+// open, which answers queries that fall inside it; others read the files.
+type fileAuditBackend struct {
+	path string
+	cfg  auditFileConfig
+	now  func() time.Time
+
+	mu       sync.Mutex
+	f        *os.File
+	size     int64
+	day      string // UTC day of the events in the active file
+	recent   *memoryAuditBackend
+	complete bool // recent held every event on disk when it was replayed
+}
+
+func newFileAuditBackend(path string, cfg auditFileConfig) (*fileAuditBackend, error) {
+	if cfg.maxBytes <= 0 {
+		cfg.maxBytes = defaultAuditLogMaxBytes
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	b := &fileAuditBackend{path: path, cfg: cfg, now: time.Now, recent: newMemoryAuditBackend(cfg.recent)}
+	if err := b.open(); err != nil {
+		return nil, err
+	}
+	if err := b.replay(); err != nil {
+		b.f.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *fileAuditBackend) open() error {
+	f, err := os.OpenFile(b.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	b.f, b.size = f, fi.Size()
+	b.day = fi.ModTime().UTC().Format(auditDayLayout)
+	return nil
+}
+
+// replay warms the memory ring from the active file and the newest rotated
+// one.
+func (b *fileAuditBackend) replay() error {
+	files, err := b.files()
+	if err != nil {
+		return err
+	}
+	skipped := len(files) > 2
+	if skipped {
+		files = files[len(files)-2:]
+	}
+	for _, p := range files {
+		if err := scanAuditFile(p, func(ev auditEvent) bool {
+			_ = b.recent.append(ev)
+			return false
+		}); err != nil {
+			return err
+		}
+	}
+	b.complete = !skipped
+	return nil
+}
+
+// rotatedAuditFile is a rotated generation of the audit log; files from
+// the older size-only scheme (path.1) sort first.
+type rotatedAuditFile struct {
+	path string
+	day  string
+	seq  int
+}
+
+// rotated lists rotated generations, oldest first.
+func (b *fileAuditBackend) rotated() ([]rotatedAuditFile, error) {
+	matches, err := filepath.Glob(b.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	out := make([]rotatedAuditFile, 0, len(matches))
+	for _, m := range matches {
+		suffix := strings.TrimPrefix(m, b.path+".")
+		day, seq, _ := strings.Cut(suffix, ".")
+		r := rotatedAuditFile{path: m}
+		if _, err := time.Parse(auditDayLayout, day); err == nil {
+			r.day = day
+			if seq != "" {
+				if r.seq, err = strconv.Atoi(seq); err != nil {
+					continue
+				}
+			}
+		} else if suffix != "1" {
+			continue
+		}
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].day != out[j].day {
+			return out[i].day < out[j].day
+		}
+		return out[i].seq < out[j].seq
+	})
+	return out, nil
+}
+
+// files lists every generation oldest first, ending with the active file.
+func (b *fileAuditBackend) files() ([]string, error) {
+	rot, err := b.rotated()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(rot)+1)
+	for _, r := range rot {
+		out = append(out, r.path)
+	}
+	return append(out, b.path), nil
+}
+
+func (b *fileAuditBackend) rotate() error {
+	if err := b.f.Close(); err != nil {
+		return err
+	}
+	target := b.path + "." + b.day
+	for n := 1; ; n++ {
+		if _, err := os.Stat(target); os.IsNotExist(err) {
+			break
+		}
+		target = fmt.Sprintf("%s.%s.%d", b.path, b.day, n)
+	}
+	if err := os.Rename(b.path, target); err != nil {
+		return err
+	}
+	if err := b.open(); err != nil {
+		return err
+	}
+	b.prune()
+	return nil
+}
+
+// prune removes the oldest rotated files beyond maxFiles.
+func (b *fileAuditBackend) prune() {
+	if b.cfg.maxFiles <= 0 {
+		return
+	}
+	rot, err := b.rotated()
+	if err != nil {
+		slog.Warn("audit_prune_failed", "err", err)
+		return
+	}
+	for i := 0; i < len(rot)-b.cfg.maxFiles; i++ {
+		if err := os.Remove(rot[i].path); err != nil {
+			slog.Warn("audit_prune_failed", "path", rot[i].path, "err", err)
+		}
+	}
+}
+
+func (b *fileAuditBackend) append(ev auditEvent) error {
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	today := b.now().UTC().Format(auditDayLayout)
+	if b.size > 0 && (today != b.day || b.size+int64(len(line)) > b.cfg.maxBytes) {
+		if err := b.rotate(); err != nil {
+			return fmt.Errorf("rotate: %w", err)
+		}
+	}
+	if b.size == 0 {
+		b.day = today
+	}
+	n, err := b.f.Write(line)
+	b.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return b.recent.append(ev)
+}
+
+func (b *fileAuditBackend) query(f auditFilter) (auditPage, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.recent.covers(f, b.complete) {
+		return b.recent.query(f)
+	}
+	files, err := b.files()
+	if err != nil {
+		return auditPage{}, err
+	}
+	c := auditCollector{f: f}
+	for _, p := range files {
+		done := false
+		if err := scanAuditFile(p, func(ev auditEvent) bool {
+			done = c.add(ev)
+			return done
+		}); err != nil {
+			return auditPage{}, err
+		}
+		if done {
+			break
+		}
+	}
+	return c.result(), nil
+}
+
+// scanAuditFile calls fn for each event in path until fn returns true. A
+// missing file is empty.
+func scanAuditFile(path string, fn func(auditEvent) bool) error {
+	fh, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	sc := bufio.NewScanner(fh)
+	sc.Buffer(make([]byte, 0, 64<<10), 4<<20)
+	for sc.Scan() {
+		var ev auditEvent
+		// A torn last line from a crash is skipped rather than failing the query.
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			continue
+		}
+		if fn(ev) {
+			return nil
+		}
+	}
+	return sc.Err()
+}
+
+// parseAuditFilter reads limit, since, until, action, outcome, actor_id,
+// object_key (a prefix), cursor and direction from q. On failure it returns
+// the error code to report.
+func parseAuditFilter(q url.Values) (auditFilter, string) {
+	f := auditFilter{
+		Limit:        200,
+		Action:       strings.TrimSpace(q.Get("action")),
+		Outcome:      strings.ToLower(strings.TrimSpace(q.Get("outcome"))),
+		ActorID:      strings.TrimSpace(q.Get("actor_id")),
+		ObjectPrefix: strings.TrimSpace(q.Get("object_key")),
+	}
+	if v := strings.TrimSpace(q.Get("limit")); v != "" {
+		if n, err := strconvAtoiSafe(v); err == nil && n > 0 {
+			f.Limit = n
+		}
+	}
+	for _, p := range []struct {
+		key string
+		dst *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		v := strings.TrimSpace(q.Get(p.key))
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return auditFilter{}, "invalid_" + p.key
+		}
+		*p.dst = t
+	}
+	if !f.Since.IsZero() && !f.Until.IsZero() && !f.Until.After(f.Since) {
+		return auditFilter{}, "invalid_time_window"
+	}
+	switch f.Outcome {
+	case "", "success", "error":
+	default:
+		return auditFilter{}, "invalid_outcome"
+	}
+	if v := strings.TrimSpace(q.Get("cursor")); v != "" {
+		cur, err := decodeAuditCursor(v)
+		if err != nil {
+			return auditFilter{}, "invalid_cursor"
+		}
+		f.Cursor = cur
+		f.Direction = cur.Dir
+	}
+	switch d := strings.ToLower(strings.TrimSpace(q.Get("direction"))); d {
+	case "":
+		if f.Cursor != nil && f.Direction == "" {
+			f.Direction = "asc"
+		}
+	case "asc", "desc":
+		f.Direction = d
+	default:
+		return auditFilter{}, "invalid_direction"
+	}
+	return f, ""
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func auditEventAt(i int, ts time.Time) auditEvent {
+	return auditEvent{
+		EventID:   strconv.Itoa(i),
+		EventTS:   ts.UTC().Format(time.RFC3339),
+		Action:    "GET",
+		Outcome:   "success",
+		ObjectKey: "/api/profiles",
+	}
+}
+
+func TestFileAuditBackendPersistsAndRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "events.ndjson")
+	b, err := newFileAuditBackend(path, auditFileConfig{maxBytes: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &auditStore{backend: b}
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return base }
+	for i := 0; i < 20; i++ {
+		s.add(auditEventAt(i, base.Add(time.Duration(i)*time.Minute)))
+	}
+
+	rot, err := b.rotated()
+	if err != nil || len(rot) < 2 || rot[0].path != path+".2026-01-01" || rot[1].path != path+".2026-01-01.1" {
+		t.Fatalf("expected same-day generations, got %+v %v", rot, err)
+	}
+	files, _ := b.files()
+	for _, p := range files {
+		if fi, err := os.Stat(p); err != nil || fi.Size() > 1024 {
+			t.Fatalf("%s should stay under the size limit: %v", p, fi.Size())
+		}
+	}
+
+	got := s.list(auditFilter{Limit: 3})
+	if len(got) != 3 || got[0].EventID != "17" || got[2].EventID != "19" {
+		t.Fatalf("expected the newest 3 events oldest first, got %+v", got)
+	}
+
+	// A new process sees the same history, read from disk.
+	b.f.Close()
+	b2, err := newFileAuditBackend(path, auditFileConfig{maxBytes: 1024, recent: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b2.f.Close()
+	s2 := &auditStore{backend: b2}
+	got = s2.list(auditFilter{Since: base.Add(2 * time.Minute)})
+	if len(got) != 18 || got[0].EventID != "2" || got[17].EventID != "19" {
+		t.Fatalf("since filter after reopen: %+v", got)
+	}
+	s2.add(auditEventAt(20, base.Add(20*time.Minute)))
+	if got := s2.list(auditFilter{Limit: 1}); len(got) != 1 || got[0].EventID != "20" {
+		t.Fatalf("append after reopen: %+v", got)
+	}
+}
+
+func TestFileAuditBackendRotatesDailyAndPrunes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	b, err := newFileAuditBackend(path, auditFileConfig{maxFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { b.f.Close() }()
+	s := &auditStore{backend: b}
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		now := day.AddDate(0, 0, i)
+		b.now = func() time.Time { return now }
+		s.add(auditEventAt(i, now))
+	}
+
+	rot, err := b.rotated()
+	if err != nil || len(rot) != 2 || rot[0].day != "2026-03-02" || rot[1].day != "2026-03-03" {
+		t.Fatalf("expected the two newest daily files, got %+v %v", rot, err)
+	}
+	if _, err := os.Stat(path + ".2026-03-01"); !os.IsNotExist(err) {
+		t.Fatalf("oldest daily file should be pruned: %v", err)
+	}
+	ids := make([]string, 0)
+	for _, ev := range s.list(auditFilter{}) {
+		ids = append(ids, ev.EventID)
+	}
+	if got := strings.Join(ids, ","); got != "0,1,2,3" {
+		t.Fatalf("memory window keeps pruned events until restart, got %q", got)
+	}
+
+	b.f.Close()
+	b, err = newFileAuditBackend(path, auditFileConfig{maxFiles: 2, recent: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(b.recent.events); n != 2 {
+		t.Fatalf("replay should warm the ring from the newest rotated and active files, got %d events", n)
+	}
+	ids = ids[:0]
+	for _, ev := range (&auditStore{backend: b}).list(auditFilter{}) {
+		ids = append(ids, ev.EventID)
+	}
+	if got := strings.Join(ids, ","); got != "1,2,3" {
+		t.Fatalf("history after restart: %q", got)
+	}
+}
+
+func TestAuditPagingBySince(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Seconds: 0,1,1,1,2,3 -- a page must not split second 1.
+	offsets := []int{0, 1, 1, 1, 2, 3}
+	for _, backend := range []string{"memory", "file"} {
+		s := newAuditStore(100)
+		if backend == "file" {
+			b, err := newFileAuditBackend(filepath.Join(t.TempDir(), "events.ndjson"), auditFileConfig{recent: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.f.Close()
+			s = &auditStore{backend: b}
+		}
+		for i, off := range offsets {
+			s.add(auditEventAt(i, base.Add(time.Duration(off)*time.Second)))
+		}
+		t.Run(backend, func(t *testing.T) {
+			var pages []string
+			f := auditFilter{Since: base, Limit: 2}
+			for guard := 0; guard < 10; guard++ {
+				p := s.page(f)
+				next := p.NextSince
+				ids := make([]string, 0, len(p.Items))
+				for _, ev := range p.Items {
+					ids = append(ids, ev.EventID)
+				}
+				pages = append(pages, strings.Join(ids, ","))
+				if next == "" {
+					break
+				}
+				ts, err := time.Parse(time.RFC3339, next)
+				if err != nil {
+					t.Fatalf("bad cursor %q", next)
+				}
+				f.Since = ts
+			}
+			if got := strings.Join(pages, " | "); got != "0 | 1,2,3 | 4,5" {
+				t.Fatalf("pages %q", got)
+			}
+		})
+	}
+}
+
+func TestAuditPagingByCursor(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Many events share a second and ids 10+ sort after 9 only numerically,
+	// so pages must order by (event_ts, event_id) rather than by either alone.
+	offsets := []int{0, 0, 0, 1, 1, 1, 1, 1, 2, 3, 3, 3, 4}
+	for _, backend := range []string{"memory", "file"} {
+		s := newAuditStore(100)
+		if backend == "file" {
+			b, err := newFileAuditBackend(filepath.Join(t.TempDir(), "events.ndjson"), auditFileConfig{recent: 3})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.f.Close()
+			s = &auditStore{backend: b}
+		}
+		for i, off := range offsets {
+			s.add(auditEventAt(i, base.Add(time.Duration(off)*time.Second)))
+		}
+		// walk follows next_cursor from f and returns the ids in order, failing
+		// on a repeat.
+		walk := func(t *testing.T, f auditFilter) ([]string, auditPage) {
+			var ids []string
+			var first auditPage
+			seen := map[string]bool{}
+			for guard := 0; guard < 20; guard++ {
+				p := s.page(f)
+				if guard == 0 {
+					first = p
+				}
+				if len(p.Items) > f.Limit {
+					t.Fatalf("page of %d over limit %d", len(p.Items), f.Limit)
+				}
+				for _, ev := range p.Items {
+					if seen[ev.EventID] {
+						t.Fatalf("event %s repeated", ev.EventID)
+					}
+					seen[ev.EventID] = true
+					ids = append(ids, ev.EventID)
+				}
+				if p.NextCursor == "" {
+					return ids, first
+				}
+				cur, err := decodeAuditCursor(p.NextCursor)
+				if err != nil {
+					t.Fatalf("bad cursor %q: %v", p.NextCursor, err)
+				}
+				f.Cursor, f.Direction = cur, cur.Dir
+			}
+			t.Fatal("paging did not terminate")
+			return nil, first
+		}
+
+		t.Run(backend, func(t *testing.T) {
+			asc, first := walk(t, auditFilter{Limit: 3, Direction: "asc"})
+			if got := strings.Join(asc, ","); got != "0,1,2,3,4,5,6,7,8,9,10,11,12" {
+				t.Fatalf("forward %q", got)
+			}
+			if first.PrevCursor != "" {
+				t.Fatalf("first page has prev_cursor %q", first.PrevCursor)
+			}
+			desc, _ := walk(t, auditFilter{Limit: 4, Direction: "desc"})
+			if got := strings.Join(desc, ","); got != "12,11,10,9,8,7,6,5,4,3,2,1,0" {
+				t.Fatalf("backward %q", got)
+			}
+
+			// prev_cursor from a middle page leads back over exactly the
+			// events before it.
+			cur, _ := decodeAuditCursor(encodeAuditCursor(auditEventAt(5, base.Add(time.Second)), "asc"))
+			mid := s.page(auditFilter{Limit: 3, Direction: "asc", Cursor: cur})
+			if ids := eventIDs(mid.Items); ids != "6,7,8" || mid.PrevCursor == "" {
+				t.Fatalf("middle page %q prev=%q", ids, mid.PrevCursor)
+			}
+			back, _ := decodeAuditCursor(mid.PrevCursor)
+			if back.Dir != "desc" {
+				t.Fatalf("prev_cursor direction %q", back.Dir)
+			}
+			rest, _ := walk(t, auditFilter{Limit: 5, Cursor: back, Direction: back.Dir})
+			if got := strings.Join(rest, ","); got != "5,4,3,2,1,0" {
+				t.Fatalf("back from the middle page %q", got)
+			}
+
+			// since (inclusive) and until (exclusive) still bound the walk.
+			since, _ := walk(t, auditFilter{Limit: 2, Direction: "asc", Since: base.Add(time.Second), Until: base.Add(3 * time.Second)})
+			if got := strings.Join(since, ","); got != "3,4,5,6,7,8" {
+				t.Fatalf("with since/until %q", got)
+			}
+		})
+	}
+}
+
+func eventIDs(evs []auditEvent) string {
+	ids := make([]string, 0, len(evs))
+	for _, ev := range evs {
+		ids = append(ids, ev.EventID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestParseAuditFilterCursor(t *testing.T) {
+	cur := encodeAuditCursor(auditEvent{EventID: "7", EventTS: "2026-01-01T00:00:00Z"}, "desc")
+	cases := []struct {
+		query, wantDir, wantErr string
+	}{
+		{"", "", ""},
+		{"direction=desc", "desc", ""},
+		{"cursor=" + cur, "desc", ""},
+		{"cursor=" + cur + "&direction=asc", "asc", ""},
+		{"direction=sideways", "", "invalid_direction"},
+		{"cursor=not-base64!", "", "invalid_cursor"},
+		{"cursor=e30", "", "invalid_cursor"}, // {}
+	}
+	for _, tc := range cases {
+		q, _ := url.ParseQuery(tc.query)
+		f, code := parseAuditFilter(q)
+		if code != tc.wantErr || f.Direction != tc.wantDir {
+			t.Fatalf("%q: direction %q err %q, want %q %q", tc.query, f.Direction, code, tc.wantDir, tc.wantErr)
+		}
+	}
+}
+
+func TestFileAuditBackendSkipsTornLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	if err := os.WriteFile(path, []byte(`{"event_id":"1","event_ts":"2026-01-01T00:00:00Z"}`+"\n"+`{"event_id":"2","ev`), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	b, err := newFileAuditBackend(path, auditFileConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.f.Close()
+	got, err := b.query(auditFilter{})
+	if err != nil || len(got.Items) != 1 || got.Items[0].EventID != "1" {
+		t.Fatalf("expected the torn line to be skipped, got %+v %v", got.Items, err)
+	}
+}
+
+func TestLoadAuditStoreFallsBackToMemory(t *testing.T) {
+	t.Setenv("AUDIT_LOG_PATH", "")
+	if _, ok := loadAuditStore(5).backend.(*memoryAuditBackend); !ok {
+		t.Fatal("expected the memory backend without AUDIT_LOG_PATH")
+	}
+	dir := t.TempDir()
+	t.Setenv("AUDIT_LOG_PATH", dir) // a directory cannot be opened for appending
+	s := loadAuditStore(5)
+	if _, ok := s.backend.(*memoryAuditBackend); !ok {
+		t.Fatal("expected the memory backend when the file cannot be opened")
+	}
+	for i := 0; i < 8; i++ {
+		s.add(auditEventAt(i, time.Now()))
+	}
+	if got := s.list(auditFilter{}); len(got) != 5 || got[0].EventID != "3" {
+		t.Fatalf("memory ring should keep the last 5, got %+v", got)
+	}
+}
+
+func seedFilterEvents(s *auditStore) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []struct{ action, outcome, actor, key string }{
+		{"GET", "success", "jwt:alice", "/api/profiles"},
+		{"POST", "success", "jwt:alice", "/api/profiles"},
+		{"DELETE", "error", "jwt:bob", "/api/reports/r1"},
+		{"GET", "error", "jwt:bob", "/api/profiles/p1"},
+		{"GET", "success", "", "/api/results"},
+		{"report.created", "success", "jwt:alice", "/api/reports/r2"},
+	}
+	for i, e := range events {
+		ev := auditEventAt(i, base.Add(time.Duration(i)*time.Minute))
+		ev.Action, ev.Outcome, ev.ActorID, ev.ObjectKey = e.action, e.outcome, e.actor, e.key
+		s.add(ev)
+	}
+}
+
+func TestAuditFilter(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name string
+		f    auditFilter
+		want string
+	}{
+		{"no filter", auditFilter{}, "0,1,2,3,4,5"},
+		{"action is case-insensitive", auditFilter{Action: "get"}, "0,3,4"},
+		{"custom event type", auditFilter{Action: "report.created"}, "5"},
+		{"outcome", auditFilter{Outcome: "error"}, "2,3"},
+		{"actor", auditFilter{ActorID: "jwt:alice"}, "0,1,5"},
+		{"object key prefix", auditFilter{ObjectPrefix: "/api/profiles"}, "0,1,3"},
+		{"since", auditFilter{Since: base.Add(4 * time.Minute)}, "4,5"},
+		{"until", auditFilter{Until: base.Add(2 * time.Minute)}, "0,1"},
+		{"since and limit pages forward", auditFilter{Since: base.Add(time.Minute), Limit: 2}, "1,2"},
+		{"action and outcome", auditFilter{Action: "GET", Outcome: "success"}, "0,4"},
+		{"actor and prefix", auditFilter{ActorID: "jwt:alice", ObjectPrefix: "/api/reports"}, "5"},
+		{"limit applies after filtering", auditFilter{ActorID: "jwt:alice", Limit: 2}, "1,5"},
+		{"no match", auditFilter{ActorID: "jwt:bob", Outcome: "success"}, ""},
+	}
+	for _, backend := range []string{"memory", "file"} {
+		s := newAuditStore(100)
+		if backend == "file" {
+			b, err := newFileAuditBackend(filepath.Join(t.TempDir(), "events.ndjson"), auditFileConfig{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.f.Close()
+			s = &auditStore{backend: b}
+		}
+		seedFilterEvents(s)
+		for _, tc := range cases {
+			t.Run(backend+"/"+tc.name, func(t *testing.T) {
+				ids := make([]string, 0)
+				for _, ev := range s.list(tc.f) {
+					ids = append(ids, ev.EventID)
+				}
+				if got := strings.Join(ids, ","); got != tc.want {
+					t.Fatalf("got %q want %q", got, tc.want)
+				}
+			})
+		}
+	}
+}
+
+func TestParseAuditFilter(t *testing.T) {
+	q, _ := url.ParseQuery("limit=5&since=2026-01-01T00:00:00Z&until=2026-01-02T00:00:00Z&action=POST&outcome=Error&actor_id=jwt:bob&object_key=/api/reports")
+	f, errCode := parseAuditFilter(q)
+	if errCode != "" || f.Limit != 5 || f.Since.IsZero() || f.Until.IsZero() || f.Action != "POST" || f.Outcome != "error" || f.ActorID != "jwt:bob" || f.ObjectPrefix != "/api/reports" {
+		t.Fatalf("unexpected filter %+v %q", f, errCode)
+	}
+	if f, _ := parseAuditFilter(url.Values{}); f.Limit != 200 {
+		t.Fatalf("default limit: %+v", f)
+	}
+	for _, tc := range []struct{ query, want string }{
+		{"outcome=maybe", "invalid_outcome"},
+		{"since=yesterday", "invalid_since"},
+		{"until=2026-13-01", "invalid_until"},
+		{"since=2026-01-02T00:00:00Z&until=2026-01-01T00:00:00Z", "invalid_time_window"},
+	} {
+		q, _ := url.ParseQuery(tc.query)
+		if _, errCode := parseAuditFilter(q); errCode != tc.want {
+			t.Fatalf("%s: expected %s, got %q", tc.query, tc.want, errCode)
+		}
+	}
+}
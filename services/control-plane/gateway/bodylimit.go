@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// --- Body limits ---
+
+const (
+	defaultMaxBodyBytes = 8 << 20
+	// maxUpstreamBodyBytes caps upstream responses the gateway reads into
+	// memory itself (summary, reports); proxied responses are streamed.
+	maxUpstreamBodyBytes = 64 << 20
+)
+
+// defaultBodyLimitRoutes lets result ingest through: drones post whole runs
+// to the aggregator in one request.
+const defaultBodyLimitRoutes = "/api/results=67108864"
+
+var errUpstreamBodyTooLarge = errors.New("upstream_body_too_large")
+
+type bodyLimitRule struct {
+	pattern string
+	prefix  bool
+	max     int64
+}
+
+// bodyLimits is the request body cap: max by default, or the most specific
+// matching rule.
+type bodyLimits struct {
+	max   int64
+	rules []bodyLimitRule
+}
+
+// loadBodyLimits reads GATEWAY_MAX_BODY_BYTES and GATEWAY_MAX_BODY_BYTES_ROUTES.
+func loadBodyLimits() bodyLimits {
+	routes, ok := os.LookupEnv("GATEWAY_MAX_BODY_BYTES_ROUTES")
+	if !ok {
+		routes = defaultBodyLimitRoutes
+	}
+	rules, err := parseBodyLimitRules(routes)
+	if err != nil {
+		slog.Warn("body_limit_rules", "err", err)
+	}
+	return bodyLimits{max: envInt64("GATEWAY_MAX_BODY_BYTES", defaultMaxBodyBytes), rules: rules}
+}
+
+// parseBodyLimitRules parses "/api/results=67108864,/api/runs/*=16777216".
+// A pattern ending in /* also matches every path below it. Invalid entries
+// are skipped and reported in the returned error.
+func parseBodyLimitRules(spec string) ([]bodyLimitRule, error) {
+	var rules []bodyLimitRule
+	var bad []string
+	for _, entry := range splitCSV(spec) {
+		pattern, limit, ok := strings.Cut(entry, "=")
+		pattern = strings.TrimSpace(pattern)
+		n, err := strconv.ParseInt(strings.TrimSpace(limit), 10, 64)
+		if !ok || !strings.HasPrefix(pattern, "/") || err != nil || n < 1 {
+			bad = append(bad, entry)
+			continue
+		}
+		rule := bodyLimitRule{pattern: pattern, max: n}
+		if strings.HasSuffix(pattern, "/*") {
+			rule.prefix = true
+			rule.pattern = strings.TrimSuffix(pattern, "/*")
+		}
+		rules = append(rules, rule)
+	}
+	if len(bad) > 0 {
+		return rules, fmt.Errorf("invalid body limit rules: %s", strings.Join(bad, ","))
+	}
+	return rules, nil
+}
+
+// limitFor returns the cap for path; 0 or less means unlimited.
+func (b bodyLimits) limitFor(path string) int64 {
+	var best bodyLimitRule
+	found := false
+	for _, rule := range b.rules {
+		match := path == rule.pattern
+		if rule.prefix && !match {
+			match = strings.HasPrefix(path, rule.pattern+"/")
+		}
+		if match && (!found || len(rule.pattern) > len(best.pattern) || (len(rule.pattern) == len(best.pattern) && !rule.prefix)) {
+			best, found = rule, true
+		}
+	}
+	if found {
+		return best.max
+	}
+	return b.max
+}
+
+// withBodyLimit rejects bodies over the route's cap with 413. A declared
+// Content-Length is checked up front; chunked bodies are cut off by
+// http.MaxBytesReader, which handlers and the proxy report as 413 too.
+func withBodyLimit(limits bodyLimits) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			max := limits.limitFor(r.URL.Path)
+			if max <= 0 || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.ContentLength > max {
+				slog.Warn("request_body_too_large", "path", r.URL.Path, "content_length", r.ContentLength, "max_bytes", max)
+				writeBodyTooLarge(w, max)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, max)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeBodyTooLarge(w http.ResponseWriter, max int64) {
+	w.Header().Set("Connection", "close")
+	writeJSON(w, http.StatusRequestEntityTooLarge, map[string]any{"error": "request_too_large", "max_bytes": max})
+}
+
+// decodeJSONBody decodes the request body into v. On failure it answers 413
+// when the body hit its cap and 400 invalid_json otherwise, and returns false.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil {
+		return true
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeBodyTooLarge(w, tooLarge.Limit)
+		return false
+	}
+	writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_json"})
+	return false
+}
+
+// readUpstreamBody reads an upstream response of at most maxUpstreamBodyBytes.
+func readUpstreamBody(body io.Reader) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(body, maxUpstreamBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxUpstreamBodyBytes {
+		return nil, errUpstreamBodyTooLarge
+	}
+	return b, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// jsonBody is a syntactically valid JSON object of at least n bytes.
+func jsonBody(n int) string {
+	return `{"pad":"` + strings.Repeat("x", n) + `"}`
+}
+
+func assertTooLarge(t *testing.T, rec *httptest.ResponseRecorder, max int64) {
+	t.Helper()
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status %d, want 413 (%s)", rec.Code, rec.Body.String())
+	}
+	var out map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("413 body is not JSON: %q", rec.Body.String())
+	}
+	if out["error"] != "request_too_large" || out["max_bytes"] != float64(max) {
+		t.Fatalf("413 body: %v", out)
+	}
+}
+
+func TestBodyLimitLocalRoutes(t *testing.T) {
+	mux, reports, connectorID, upstreamHits := newTestGatewayMux(t)
+	h := withBodyLimit(bodyLimits{max: 1024})(mux)
+	post := func(method, path, body string, chunked bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if chunked {
+			// No declared length: only the MaxBytesReader can stop it.
+			req.ContentLength = -1
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assertTooLarge(t, post(http.MethodPost, "/api/reports", jsonBody(4096), false), 1024)
+	assertTooLarge(t, post(http.MethodPost, "/api/reports", jsonBody(4096), true), 1024)
+	if n := len(reports.list()); n != 0 {
+		t.Fatalf("oversized report was stored: %d reports", n)
+	}
+	assertTooLarge(t, post(http.MethodPut, "/api/connectors/"+connectorID+"/config", jsonBody(4096), true), 1024)
+	assertTooLarge(t, post(http.MethodPost, "/api/gateway/connectors/"+connectorID+"/config", jsonBody(4096), false), 1024)
+
+	if rec := post(http.MethodPost, "/api/reports", `{"profiles":["p1"]}`, true); rec.Code != http.StatusOK {
+		t.Fatalf("small body: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := post(http.MethodPost, "/api/reports", `{"profiles":`, false); rec.Code != http.StatusBadRequest {
+		t.Fatalf("malformed small body must stay 400: %d", rec.Code)
+	}
+	if upstreamHits.Load() != 0 {
+		t.Fatalf("local routes reached an upstream %d times", upstreamHits.Load())
+	}
+}
+
+func TestBodyLimitProxiedRoutes(t *testing.T) {
+	var received atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(io.Discard, r.Body)
+		received.Store(n)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+	rules, err := parseBodyLimitRules("/api/results=8192")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := stripPrefixProxy("/api", mustProxy(upstream.URL, 5*time.Second))
+	h := withBodyLimit(bodyLimits{max: 1024, rules: rules})(proxy)
+	send := func(path string, size int, chunked bool) *httptest.ResponseRecorder {
+		received.Store(-1)
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(jsonBody(size)))
+		if chunked {
+			req.ContentLength = -1
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assertTooLarge(t, send("/api/runs", 2048, false), 1024)
+	if received.Load() != -1 {
+		t.Fatal("a body over a declared limit must not be forwarded")
+	}
+	assertTooLarge(t, send("/api/runs", 2048, true), 1024)
+
+	// The ingest override allows larger result batches, up to its own cap.
+	if rec := send("/api/results", 4096, true); rec.Code != http.StatusOK || received.Load() != int64(len(jsonBody(4096))) {
+		t.Fatalf("results within the override: %d, upstream read %d bytes", rec.Code, received.Load())
+	}
+	assertTooLarge(t, send("/api/results", 16384, true), 8192)
+	assertTooLarge(t, send("/api/results", 16384, false), 8192)
+}
+
+func TestParseBodyLimitRules(t *testing.T) {
+	rules, err := parseBodyLimitRules("/api/results=100, /api/runs/*=50,/api/runs/big=75,nope=1,/api/x=0")
+	if err == nil || !strings.Contains(err.Error(), "nope=1") || !strings.Contains(err.Error(), "/api/x=0") {
+		t.Fatalf("invalid entries not reported: %v", err)
+	}
+	limits := bodyLimits{max: 10, rules: rules}
+	for path, want := range map[string]int64{
+		"/api/results":     100,
+		"/api/results/raw": 10,
+		"/api/runs/r1":     50,
+		"/api/runs/big":    75,
+		"/api/reports":     10,
+	} {
+		if got := limits.limitFor(path); got != want {
+			t.Errorf("limitFor(%s) = %d, want %d", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerTimeout   = 10 * time.Second
+	defaultBreakerWindow    = 30 * time.Second
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker trips open after threshold consecutive upstream failures
+// within window and fast-fails until timeout has passed. It then lets a single trial request
+// through (half-open); that request's outcome closes or re-opens the circuit.
+type circuitBreaker struct {
+	upstream  string
+	mu        sync.Mutex
+	state     breakerState
+	failures  int
+	firstFail time.Time
+	openedAt  time.Time
+	trial     bool
+	threshold int
+	timeout   time.Duration
+	window    time.Duration
+	now       func() time.Time
+}
+
+// breakerStatus is the per-upstream view reported by /api/gateway/health.
+type breakerStatus struct {
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	RetryAfterMs        int64  `json:"retry_after_ms,omitempty"`
+}
+
+func newCircuitBreaker(upstream string, threshold int, timeout time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+	if timeout <= 0 {
+		timeout = defaultBreakerTimeout
+	}
+	return &circuitBreaker{upstream: upstream, threshold: threshold, timeout: timeout, window: defaultBreakerWindow, now: time.Now}
+}
+
+// allow reports whether a request may go upstream and, if not, how long the
+// circuit will stay open.
+func (b *circuitBreaker) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if wait := b.timeout - b.now().Sub(b.openedAt); wait > 0 {
+			return false, wait
+		}
+		b.state = breakerHalfOpen
+		b.trial = true
+		return true, 0
+	case breakerHalfOpen:
+		if b.trial {
+			return false, 0
+		}
+		b.trial = true
+		return true, 0
+	default:
+		return true, 0
+	}
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != breakerClosed {
+		slog.Info("circuit_closed", "upstream", b.upstream)
+	}
+	b.state = breakerClosed
+	b.failures = 0
+	b.trial = false
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if b.state == breakerHalfOpen {
+		b.trip()
+		return
+	}
+	now := b.now()
+	if b.failures > 0 && b.window > 0 && now.Sub(b.firstFail) > b.window {
+		// The earlier failures are too old to count towards this streak.
+		b.failures = 0
+	}
+	if b.failures == 0 {
+		b.firstFail = now
+	}
+	b.failures++
+	if b.state == breakerClosed && b.failures >= b.threshold {
+		b.trip()
+	}
+}
+
+// release ends a half-open trial without a verdict (e.g. the client went away),
+// so the next request can try again.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// trip opens the circuit; b.mu must be held.
+func (b *circuitBreaker) trip() {
+	b.state = breakerOpen
+	b.openedAt = b.now()
+	b.failures = 0
+	slog.Warn("circuit_open", "upstream", b.upstream, "timeout_ms", b.timeout.Milliseconds())
+}
+
+// reset closes the circuit immediately; the health loop calls it once the
+// upstream probes healthy again.
+func (b *circuitBreaker) reset() {
+	b.success()
+}
+
+func (b *circuitBreaker) current() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *circuitBreaker) status() breakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := breakerStatus{State: b.state.String(), ConsecutiveFailures: b.failures}
+	if b.state == breakerOpen {
+		if wait := b.timeout - b.now().Sub(b.openedAt); wait > 0 {
+			st.RetryAfterMs = wait.Milliseconds()
+		}
+	}
+	return st
+}
+
+// breakerProxy is a reverse proxy guarded by a circuit breaker. Transport errors
+// and 5xx responses count as failures; anything else closes the circuit.
+type breakerProxy struct {
+	proxy   *httputil.ReverseProxy
+	breaker *circuitBreaker
+}
+
+func (p *breakerProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ok, wait := p.breaker.allow()
+	if !ok {
+		if wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		}
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"error": "upstream_circuit_open", "retry_after_ms": wait.Milliseconds()})
+		return
+	}
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	p.proxy.ServeHTTP(rec, r)
+	switch {
+	case r.Context().Err() != nil:
+		// The caller gave up or hit its own deadline; that says nothing about the upstream.
+		p.breaker.release()
+	case rec.status >= http.StatusInternalServerError:
+		p.breaker.failure()
+	case rec.status == http.StatusTooManyRequests:
+		// Passed through with its Retry-After; the upstream is alive, just busy.
+		metricsUpstreamThrottled(p.breaker.upstream)
+		p.breaker.success()
+	default:
+		p.breaker.success()
+	}
+}
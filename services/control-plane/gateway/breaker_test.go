@@ -0,0 +1,154 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerStates(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	t.Setenv("CIRCUIT_BREAKER_THRESHOLD", "3")
+	t.Setenv("CIRCUIT_BREAKER_TIMEOUT", "10")
+	p := mustProxy(upstream.URL, defaultUpstreamTimeout)
+	now := time.Unix(1_700_000_000, 0)
+	p.breaker.now = func() time.Time { return now }
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/x", nil))
+		return rec
+	}
+
+	for i := 0; i < 3; i++ {
+		if rec := get(); rec.Code != http.StatusServiceUnavailable || strings.Contains(rec.Body.String(), "circuit") {
+			t.Fatalf("request %d should reach upstream: %d %s", i, rec.Code, rec.Body.String())
+		}
+	}
+	if p.breaker.current() != breakerOpen {
+		t.Fatalf("expected open after threshold, got %s", p.breaker.current())
+	}
+	rec := get()
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "upstream_circuit_open") {
+		t.Fatalf("expected fast-fail, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Retry-After") != "10" || hits.Load() != 3 {
+		t.Fatalf("fast-fail must not hit upstream: retry-after=%q hits=%d", rec.Header().Get("Retry-After"), hits.Load())
+	}
+
+	// A failed half-open trial re-opens the circuit.
+	now = now.Add(10 * time.Second)
+	get()
+	if p.breaker.current() != breakerOpen || hits.Load() != 4 {
+		t.Fatalf("failed trial should re-open: %s hits=%d", p.breaker.current(), hits.Load())
+	}
+
+	// A successful trial closes it.
+	failing.Store(false)
+	now = now.Add(10 * time.Second)
+	if rec := get(); rec.Code != http.StatusOK {
+		t.Fatalf("trial request: %d", rec.Code)
+	}
+	if p.breaker.current() != breakerClosed {
+		t.Fatalf("expected closed after successful trial, got %s", p.breaker.current())
+	}
+}
+
+func TestCircuitBreakerHalfOpenAllowsSingleTrial(t *testing.T) {
+	b := newCircuitBreaker("test", 1, time.Second)
+	now := time.Unix(0, 0)
+	b.now = func() time.Time { return now }
+	b.failure()
+	now = now.Add(time.Second)
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("first request after timeout should be let through")
+	}
+	if ok, _ := b.allow(); ok {
+		t.Fatal("only one trial request may be in flight")
+	}
+	b.release()
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("released trial should allow another attempt")
+	}
+}
+
+func TestHealthUpdateResetsBreaker(t *testing.T) {
+	b := newCircuitBreaker("registry", 1, time.Hour)
+	b.failure()
+	h := newHealthCache()
+	h.watchBreaker("registry", b)
+
+	h.update(map[string]serviceDetail{"registry": {Status: "down"}})
+	if b.current() != breakerOpen {
+		t.Fatalf("down service must keep the circuit open, got %s", b.current())
+	}
+	h.update(map[string]serviceDetail{"registry": {Status: "up"}})
+	if b.current() != breakerClosed {
+		t.Fatalf("up service should reset the circuit, got %s", b.current())
+	}
+}
+
+func TestCircuitBreakerTripAndRecoverWith500(t *testing.T) {
+	var code atomic.Int32
+	code.Store(http.StatusInternalServerError)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(code.Load()))
+	}))
+	defer upstream.Close()
+
+	t.Setenv("CIRCUIT_BREAKER_THRESHOLD", "2")
+	t.Setenv("CIRCUIT_BREAKER_TIMEOUT", "5")
+	t.Setenv("CIRCUIT_BREAKER_WINDOW", "30")
+	p := mustProxy(upstream.URL, defaultUpstreamTimeout)
+	now := time.Unix(1_700_000_000, 0)
+	p.breaker.now = func() time.Time { return now }
+	health := newHealthCache()
+	health.watchBreaker("aggregator", p.breaker)
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/results", nil))
+		return rec
+	}
+
+	// Failures further apart than the window do not add up.
+	get()
+	now = now.Add(31 * time.Second)
+	get()
+	if st := health.get().Breakers["aggregator"]; st.State != "closed" || st.ConsecutiveFailures != 1 {
+		t.Fatalf("stale failure should have been forgotten: %+v", st)
+	}
+
+	get()
+	rec := get()
+	if !strings.Contains(rec.Body.String(), `"retry_after_ms":5000`) {
+		t.Fatalf("expected short-circuit with retry_after_ms, got %d %s", rec.Code, rec.Body.String())
+	}
+	if st := health.get().Breakers["aggregator"]; st.State != "open" || st.RetryAfterMs != 5000 {
+		t.Fatalf("health should report the tripped breaker: %+v", st)
+	}
+
+	code.Store(http.StatusOK)
+	now = now.Add(5 * time.Second)
+	if rec := get(); rec.Code != http.StatusOK {
+		t.Fatalf("half-open probe: %d", rec.Code)
+	}
+	if st := health.get().Breakers["aggregator"]; st.State != "closed" {
+		t.Fatalf("breaker should recover after a good probe: %+v", st)
+	}
+}
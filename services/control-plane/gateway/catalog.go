@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Connector catalog ---
+
+const defaultCatalogReloadInterval = 30 * time.Second
+
+// liveCatalog is the connector catalog being served. With
+// CONNECTOR_CATALOG_PATH set it is re-read whenever the file's ModTime
+// changes; otherwise it holds the embedded catalog for the life of the process.
+type liveCatalog struct {
+	path string
+
+	mu      sync.RWMutex
+	cat     connectorCatalog
+	list    []connectorPublic
+	modTime time.Time // of the last file seen, loaded or rejected
+}
+
+func newLiveCatalog(path string, cat connectorCatalog, modTime time.Time) *liveCatalog {
+	return &liveCatalog{path: path, cat: cat, list: buildConnectorList(cat), modTime: modTime}
+}
+
+func (c *liveCatalog) snapshot() (connectorCatalog, []connectorPublic) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cat, c.list
+}
+
+// readConnectorCatalogSource returns the catalog file at path, or the
+// embedded catalog when path is empty.
+func readConnectorCatalogSource(path string) ([]byte, time.Time, error) {
+	if path == "" {
+		return connectorCatalogYAML, time.Time{}, nil
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return raw, fi.ModTime(), nil
+}
+
+// reload re-reads the file when its ModTime has changed. A catalog that fails
+// to parse or validate is rejected and the previous one stays live; the same
+// broken file is not retried until it changes again.
+func (c *liveCatalog) reload() (bool, error) {
+	if c.path == "" {
+		return false, nil
+	}
+	fi, err := os.Stat(c.path)
+	if err != nil {
+		return false, err
+	}
+	c.mu.RLock()
+	same := fi.ModTime().Equal(c.modTime)
+	c.mu.RUnlock()
+	if same {
+		return false, nil
+	}
+	raw, err := os.ReadFile(c.path)
+	if err != nil {
+		return false, err
+	}
+	cat, err := parseConnectorCatalog(raw)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.modTime = fi.ModTime()
+	if err != nil {
+		return false, err
+	}
+	c.cat, c.list = cat, buildConnectorList(cat)
+	return true, nil
+}
+
+// startCatalogReloadLoop polls the catalog file and publishes
+// "catalog_updated" on the SSE hub after each successful reload.
+func startCatalogReloadLoop(ctx context.Context, c *liveCatalog, hub *sseHub, every time.Duration) {
+	if c.path == "" {
+		return
+	}
+	go func() {
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				c.pollOnce(hub)
+			}
+		}
+	}()
+}
+
+func (c *liveCatalog) pollOnce(hub *sseHub) {
+	changed, err := c.reload()
+	if err != nil {
+		slog.Warn("connector_catalog_reload_failed", "path", c.path, "err", err)
+		return
+	}
+	if !changed {
+		return
+	}
+	cat, list := c.snapshot()
+	slog.Info("connector_catalog_reloaded", "path", c.path, "version", cat.Version, "count", len(list))
+	if hub != nil {
+		hub.publish("catalog_updated", map[string]any{
+			"version":    cat.Version,
+			"count":      len(list),
+			"updated_at": time.Now().UTC().Format(time.RFC3339),
+		})
+	}
+}
+
+// newCatalogHandler serves /api/gateway/connectors/catalog from the live
+// catalog, so a reload shows up on the next request.
+func newCatalogHandler(c *liveCatalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		cat, list := c.snapshot()
+		q := r.URL.Query()
+		if q.Get("grouped") == "1" || strings.EqualFold(q.Get("grouped"), "true") {
+			writeJSON(w, http.StatusOK, map[string]any{
+				"version":      cat.Version,
+				"count":        len(list),
+				"kinds":        groupConnectorsByKind(list),
+				"capabilities": connectorCapabilityFacets(list),
+			})
+			return
+		}
+		offset := clampInt(queryInt(r, "offset", 0), 0, len(list))
+		limit := clampInt(queryInt(r, "limit", len(list)), 0, len(list))
+		page := paginateConnectors(list, offset, limit)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"version":    cat.Version,
+			"count":      len(list),
+			"offset":     offset,
+			"limit":      limit,
+			"connectors": page,
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const fixtureCatalog = `
+version: "test"
+connectors:
+  - id: zeta
+    name: Zeta
+    kind: api
+    capabilities: ["stream", "ingest"]
+  - id: alpha
+    name: Alpha
+    kind: api
+    capabilities: ["ingest"]
+  - id: files
+    name: Files
+    kind: file
+    capabilities: ["ingest", "query"]
+  - id: broken
+    kind: file
+`
+
+func fixtureConnectorList(t *testing.T) []connectorPublic {
+	t.Helper()
+	var cat connectorCatalog
+	if err := yaml.Unmarshal([]byte(fixtureCatalog), &cat); err != nil {
+		t.Fatal(err)
+	}
+	return buildConnectorList(cat)
+}
+
+func TestGroupConnectorsByKind(t *testing.T) {
+	groups := groupConnectorsByKind(fixtureConnectorList(t))
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 kinds, got %+v", groups)
+	}
+	if groups[0].Kind != "api" || groups[0].Count != 2 || groups[0].Connectors[0].ID != "alpha" || groups[0].Connectors[1].ID != "zeta" {
+		t.Fatalf("unexpected api group: %+v", groups[0])
+	}
+	if groups[1].Kind != "file" || groups[1].Count != 1 {
+		t.Fatalf("unexpected file group: %+v", groups[1])
+	}
+}
+
+func TestConnectorCapabilityFacets(t *testing.T) {
+	facets := connectorCapabilityFacets(fixtureConnectorList(t))
+	want := []connectorFacet{{"ingest", 3}, {"query", 1}, {"stream", 1}}
+	if len(facets) != len(want) {
+		t.Fatalf("expected %v, got %v", want, facets)
+	}
+	for i := range want {
+		if facets[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, facets)
+		}
+	}
+}
+
+func TestPaginateConnectors(t *testing.T) {
+	list := fixtureConnectorList(t)
+	if page := paginateConnectors(list, 1, 1); len(page) != 1 || page[0].ID != "files" {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+	if page := paginateConnectors(list, 2, 10); len(page) != 1 || page[0].ID != "zeta" {
+		t.Fatalf("unexpected tail page: %+v", page)
+	}
+	if page := paginateConnectors(list, 5, 10); len(page) != 0 {
+		t.Fatalf("expected empty page past the end, got %+v", page)
+	}
+}
+
+func TestLiveCatalogReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.yaml")
+	write := func(body string, mod time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	write("version: \"v1\"\nconnectors:\n  - {id: a, name: A, kind: api}\n", t0)
+
+	raw, mod, err := readConnectorCatalogSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cat, _ := parseConnectorCatalog(raw)
+	live := newLiveCatalog(path, cat, mod)
+	hub := newSSEHub(16)
+	h := newCatalogHandler(live)
+	served := func() (string, float64) {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "/api/gateway/connectors/catalog", nil))
+		var out map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatalf("catalog: %d %s", rec.Code, rec.Body.String())
+		}
+		return out["version"].(string), out["count"].(float64)
+	}
+	if v, n := served(); v != "v1" || n != 1 {
+		t.Fatalf("initial catalog: %s/%v", v, n)
+	}
+
+	live.pollOnce(hub)
+	if len(hub.buffer) != 0 {
+		t.Fatal("an unchanged file must not publish an event")
+	}
+
+	write("version: \"v2\"\nconnectors:\n  - {id: a, name: A, kind: api}\n  - {id: b, name: B, kind: file}\n", t0.Add(time.Minute))
+	live.pollOnce(hub)
+	if v, n := served(); v != "v2" || n != 2 {
+		t.Fatalf("reloaded catalog: %s/%v", v, n)
+	}
+	if len(hub.buffer) != 1 || hub.buffer[0].Event != "catalog_updated" || !strings.Contains(hub.buffer[0].Data, `"version":"v2"`) {
+		t.Fatalf("expected one catalog_updated event, got %+v", hub.buffer)
+	}
+
+	// A broken edit is rejected and the last good catalog stays live.
+	write("version: \"v3\"\nconnectors:\n  - {id: a, kind: api}\n", t0.Add(2*time.Minute))
+	live.pollOnce(hub)
+	if v, n := served(); v != "v2" || n != 2 || len(hub.buffer) != 1 {
+		t.Fatalf("broken catalog should be ignored: %s/%v events=%d", v, n, len(hub.buffer))
+	}
+}
+
+func TestReadConnectorCatalogSourceDefaultsToEmbedded(t *testing.T) {
+	raw, mod, err := readConnectorCatalogSource("")
+	if err != nil || !mod.IsZero() || string(raw) != string(connectorCatalogYAML) {
+		t.Fatalf("expected the embedded catalog, got err=%v mod=%v", err, mod)
+	}
+	if _, _, err := readConnectorCatalogSource(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// --- Compression ---
+
+// defaultGzipMinBytes is the smallest JSON body worth compressing; below it
+// the gzip framing costs more than it saves.
+const defaultGzipMinBytes = 1024
+
+var gzipWriterPool = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip: listed
+// (or covered by "*") with a non-zero q value.
+func acceptsGzip(header string) bool {
+	star := false
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		ok := true
+		if _, q, found := strings.Cut(params, "q="); found {
+			if v, err := strconv.ParseFloat(strings.TrimSpace(q), 64); err == nil && v == 0 {
+				ok = false
+			}
+		}
+		if coding == "gzip" {
+			return ok
+		}
+		star = ok
+	}
+	return star
+}
+
+// withGzip compresses JSON responses of at least minBytes and event streams
+// for clients that accept gzip. Event streams are compressed as they are
+// written and flushed through on every Flush, so each event still reaches
+// the client immediately. Responses that are already encoded, bodiless or
+// of other types pass through untouched.
+func withGzip(minBytes int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			gw := &gzipResponseWriter{
+				ResponseWriter: w,
+				accept:         acceptsGzip(r.Header.Get("Accept-Encoding")),
+				minBytes:       minBytes,
+			}
+			defer gw.close()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+type gzipMode int
+
+const (
+	gzipUndecided gzipMode = iota
+	gzipPending            // compressible JSON of unknown size, buffered up to minBytes
+	gzipOn
+	gzipOff
+)
+
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	accept   bool
+	minBytes int
+	mode     gzipMode
+	status   int
+	buf      []byte
+	zw       *gzip.Writer
+}
+
+// compressibleType returns whether a Content-Type is worth compressing and
+// whether it is an event stream.
+func compressibleType(ct string) (ok, stream bool) {
+	ct, _, _ = strings.Cut(strings.ToLower(ct), ";")
+	ct = strings.TrimSpace(ct)
+	switch {
+	case ct == "text/event-stream":
+		return true, true
+	case ct == "application/json", strings.HasPrefix(ct, "application/") && strings.HasSuffix(ct, "+json"):
+		return true, false
+	}
+	return false, false
+}
+
+func (gw *gzipResponseWriter) WriteHeader(code int) {
+	if gw.mode != gzipUndecided {
+		return
+	}
+	gw.status = code
+	h := gw.Header()
+	ok, stream := compressibleType(h.Get("Content-Type"))
+	if ok {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	bodyless := code < 200 || code == http.StatusNoContent || code == http.StatusNotModified || code == http.StatusPartialContent
+	switch {
+	case !ok || !gw.accept || bodyless || h.Get("Content-Encoding") != "":
+		gw.mode = gzipOff
+	case stream:
+		gw.startGzip()
+		return
+	default:
+		if n, err := strconv.Atoi(h.Get("Content-Length")); err == nil {
+			if n < gw.minBytes {
+				gw.mode = gzipOff
+			} else {
+				gw.startGzip()
+				return
+			}
+		} else {
+			gw.mode = gzipPending
+			return
+		}
+	}
+	gw.ResponseWriter.WriteHeader(code)
+}
+
+// startGzip switches to compressed output and sends the header.
+func (gw *gzipResponseWriter) startGzip() {
+	gw.mode = gzipOn
+	h := gw.Header()
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	// The compressed body is a different byte sequence: strong validators
+	// no longer hold.
+	if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		h.Set("ETag", "W/"+etag)
+	}
+	gw.ResponseWriter.WriteHeader(gw.status)
+	gw.zw = gzipWriterPool.Get().(*gzip.Writer)
+	gw.zw.Reset(gw.ResponseWriter)
+}
+
+func (gw *gzipResponseWriter) Write(b []byte) (int, error) {
+	if gw.mode == gzipUndecided {
+		gw.WriteHeader(http.StatusOK)
+	}
+	switch gw.mode {
+	case gzipOn:
+		return gw.zw.Write(b)
+	case gzipPending:
+		if len(gw.buf)+len(b) < gw.minBytes {
+			gw.buf = append(gw.buf, b...)
+			return len(b), nil
+		}
+		gw.startGzip()
+		if len(gw.buf) > 0 {
+			if _, err := gw.zw.Write(gw.buf); err != nil {
+				return 0, err
+			}
+			gw.buf = nil
+		}
+		return gw.zw.Write(b)
+	}
+	return gw.ResponseWriter.Write(b)
+}
+
+// Flush pushes compressed bytes out with a gzip sync flush. A JSON body still
+// under the size threshold stays buffered: half a JSON document is of no use
+// to the client.
+func (gw *gzipResponseWriter) Flush() {
+	if gw.mode == gzipUndecided {
+		gw.WriteHeader(http.StatusOK)
+	}
+	switch gw.mode {
+	case gzipPending:
+		return
+	case gzipOn:
+		if err := gw.zw.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := gw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// close finishes the response: a buffered small body goes out uncompressed
+// with its length, a gzip stream gets its trailer.
+func (gw *gzipResponseWriter) close() {
+	switch gw.mode {
+	case gzipPending:
+		gw.Header().Set("Content-Length", strconv.Itoa(len(gw.buf)))
+		gw.ResponseWriter.WriteHeader(gw.status)
+		_, _ = gw.ResponseWriter.Write(gw.buf)
+	case gzipOn:
+		_ = gw.zw.Close()
+		gw.zw.Reset(io.Discard)
+		gzipWriterPool.Put(gw.zw)
+		gw.zw = nil
+	}
+}
+
+func (gw *gzipResponseWriter) Unwrap() http.ResponseWriter { return gw.ResponseWriter }
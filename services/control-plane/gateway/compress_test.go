@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func gunzip(t *testing.T, b []byte) []byte {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("not gzip: %v", err)
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("gzip body: %v", err)
+	}
+	return out
+}
+
+func TestGzipCryptoTop(t *testing.T) {
+	cache := &cryptoCache{}
+	ticks := make([]binanceTicker, 500)
+	for i := range ticks {
+		ticks[i] = binanceTicker{
+			Symbol:             fmt.Sprintf("COIN%03dUSDT", i),
+			LastPrice:          fmt.Sprintf("%d.%04d", i, i*7),
+			PriceChangePercent: fmt.Sprintf("%.2f", float64(i%40)-20),
+			QuoteVolume:        "123456.78",
+			CloseTime:          1767225600000 + int64(i),
+		}
+	}
+	cache.set(ticks, "binance", "")
+	h := withGzip(defaultGzipMinBytes)(newCryptoTopHandler(cache))
+	get := func(acceptEncoding string) (*httptest.ResponseRecorder, *statusRecorder) {
+		req := httptest.NewRequest(http.MethodGet, "/api/crypto/top?limit=500", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		sr := &statusRecorder{ResponseWriter: rec, status: http.StatusOK}
+		h.ServeHTTP(sr, req)
+		return rec, sr
+	}
+
+	plain, _ := get("")
+	if plain.Header().Get("Content-Encoding") != "" || plain.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("uncompressed response headers: %v", plain.Header())
+	}
+	zipped, sr := get("br;q=1.0, gzip;q=0.8")
+	if zipped.Code != http.StatusOK || zipped.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("500-row response not compressed: %d %v", zipped.Code, zipped.Header())
+	}
+	if sr.bytes != int64(zipped.Body.Len()) {
+		t.Fatalf("recorder counted %d bytes, %d were sent", sr.bytes, zipped.Body.Len())
+	}
+	body := gunzip(t, zipped.Body.Bytes())
+	if !bytes.Equal(body, plain.Body.Bytes()) {
+		t.Fatal("decompressed body differs from the uncompressed response")
+	}
+	var rows []cryptoTopRow
+	if err := json.Unmarshal(body, &rows); err != nil || len(rows) != 500 {
+		t.Fatalf("rows: %d %v", len(rows), err)
+	}
+	if ratio := float64(zipped.Body.Len()) / float64(len(body)); ratio > 0.3 {
+		t.Fatalf("compressed to %d of %d bytes", zipped.Body.Len(), len(body))
+	}
+
+	// The ETag still matches a conditional request from a gzip client.
+	req := httptest.NewRequest(http.MethodGet, "/api/crypto/top?limit=500", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", zipped.Header().Get("ETag"))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 || rec.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("304 through gzip: %d %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+}
+
+func TestGzipSkipsWhatItShould(t *testing.T) {
+	big := strings.Repeat(`{"k":"value"},`, 200)
+	cases := []struct {
+		name     string
+		accept   string
+		handler  http.HandlerFunc
+		wantGzip bool
+	}{
+		{"small json", "gzip", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+		}, false},
+		{"opted out", "gzip;q=0, *", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, []string{big})
+		}, false},
+		{"wildcard", "*", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, []string{big})
+		}, true},
+		{"not json", "gzip", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/csv")
+			_, _ = io.WriteString(w, big)
+		}, false},
+		{"already encoded", "gzip", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(w)
+			_ = json.NewEncoder(zw).Encode([]string{big})
+			_ = zw.Close()
+		}, true},
+		{"declared length below threshold", "gzip", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Length", "2")
+			_, _ = io.WriteString(w, "{}")
+		}, false},
+		{"json written in small pieces", "gzip", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusBadGateway)
+			for i := 0; i < 200; i++ {
+				_, _ = io.WriteString(w, `{"k":"value"},`)
+				w.(http.Flusher).Flush()
+			}
+		}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/x", nil)
+			req.Header.Set("Accept-Encoding", tc.accept)
+			rec := httptest.NewRecorder()
+			withGzip(defaultGzipMinBytes)(tc.handler).ServeHTTP(rec, req)
+			if got := rec.Header().Get("Content-Encoding") == "gzip"; got != tc.wantGzip {
+				t.Fatalf("gzip=%v, want %v (%v)", got, tc.wantGzip, rec.Header())
+			}
+			if tc.wantGzip {
+				gunzip(t, rec.Body.Bytes())
+			} else if cl := rec.Header().Get("Content-Length"); cl != "" && cl != fmt.Sprint(rec.Body.Len()) {
+				t.Fatalf("Content-Length %s for a %d byte body", cl, rec.Body.Len())
+			}
+		})
+	}
+}
+
+func TestGzipEventsDeliveredPromptly(t *testing.T) {
+	d, _, _ := newTestGatewayRoutes(t)
+	hub := newSSEHub(16)
+	d.sse = hub
+	srv := httptest.NewServer(withGzip(defaultGzipMinBytes)(newGatewayMux(d)))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := (&http.Client{Transport: &http.Transport{DisableCompression: true}}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("event stream not compressed: %v", resp.Header)
+	}
+
+	events := make(chan string, 8)
+	go func() {
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			close(events)
+			return
+		}
+		sc := bufio.NewScanner(zr)
+		for sc.Scan() {
+			if name, ok := strings.CutPrefix(sc.Text(), "event: "); ok {
+				events <- name
+			}
+		}
+		close(events)
+	}()
+	next := func() string {
+		select {
+		case name := <-events:
+			return name
+		case <-time.After(2 * time.Second):
+			t.Fatal("event held back by compression")
+			return ""
+		}
+	}
+
+	if name := next(); name != "heartbeat" {
+		t.Fatalf("first event %q, want the connect heartbeat", name)
+	}
+	for i := 0; i < 3; i++ {
+		hub.publish("results", map[string]int{"total_results": i})
+		if name := next(); name != "results" {
+			t.Fatalf("event %d: got %q", i, name)
+		}
+	}
+}
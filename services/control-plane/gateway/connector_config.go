@@ -0,0 +1,613 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Connector config ---
+
+// configViolation is one failing location in a submitted connector config.
+// Path is a JSON Pointer into the config ("" is the config itself).
+type configViolation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// connectorConfigStore holds connector configs with secret fields sealed.
+// With a path set every change is written through to a JSON file, which is
+// read back on start.
+type connectorConfigStore struct {
+	mu    sync.Mutex
+	items map[string]connectorConfigEntry
+	path  string
+	box   *secretBox
+}
+
+// connectorConfigEntry is a connector's active config and, while one is
+// being edited, its staged draft. Only the active config is used by
+// ingestion; a draft becomes active through apply.
+type connectorConfigEntry struct {
+	Config    any    `json:"config"`
+	Validated bool   `json:"validated"`
+	SavedAt   string `json:"saved_at,omitempty"`
+
+	Draft        any    `json:"draft,omitempty"`
+	DraftSavedAt string `json:"draft_saved_at,omitempty"`
+	DraftBy      string `json:"draft_by,omitempty"`
+}
+
+var errNoDraft = errors.New("no draft")
+
+type connectorConfigFile struct {
+	Version    int                             `json:"version"`
+	Connectors map[string]connectorConfigEntry `json:"connectors"`
+}
+
+func newConnectorConfigStore() *connectorConfigStore {
+	return &connectorConfigStore{items: make(map[string]connectorConfigEntry)}
+}
+
+// loadConnectorConfigStore persists to CONNECTOR_CONFIG_DIR/connectors.json
+// when the directory is set and seals secrets with CONNECTOR_SECRET_KEY.
+// Problems are logged and leave an in-memory store.
+func loadConnectorConfigStore() *connectorConfigStore {
+	s := newConnectorConfigStore()
+	box, err := newSecretBox(os.Getenv("CONNECTOR_SECRET_KEY"))
+	if err != nil {
+		slog.Warn("connector_secret_key_invalid", "err", err)
+	}
+	s.box = box
+	dir := strings.TrimSpace(os.Getenv("CONNECTOR_CONFIG_DIR"))
+	if dir == "" {
+		return s
+	}
+	if err := s.open(filepath.Join(dir, "connectors.json")); err != nil {
+		slog.Warn("connector_config_load_failed", "dir", dir, "err", err)
+		return s
+	}
+	slog.Info("connector_config_loaded", "path", s.path, "count", len(s.items))
+	return s
+}
+
+// open reads path if it exists and makes it the write-through target.
+func (s *connectorConfigStore) open(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	raw, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	default:
+		var f connectorConfigFile
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		for id, e := range f.Connectors {
+			s.items[id] = e
+		}
+		s.mu.Unlock()
+	}
+	s.path = path
+	return nil
+}
+
+// get returns the active config; ok is false when none has been saved or
+// applied, even if a draft exists.
+func (s *connectorConfigStore) get(id string) (cfg any, validated, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.items[id]
+	return e.Config, e.Validated, e.Config != nil
+}
+
+// entry returns the active config and draft together.
+func (s *connectorConfigStore) entry(id string) connectorConfigEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.items[id]
+}
+
+// set stores cfg as the active config. Its secret fields must already be
+// sealed. A pending draft is kept.
+func (s *connectorConfigStore) set(id string, cfg any, validated bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.items[id]
+	e.Config, e.Validated, e.SavedAt = cfg, validated, time.Now().UTC().Format(time.RFC3339)
+	return s.commitLocked(id, e)
+}
+
+// setDraft stages cfg, sealed like set, without touching the active config.
+func (s *connectorConfigStore) setDraft(id string, cfg any, by string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.items[id]
+	e.Draft, e.DraftSavedAt, e.DraftBy = cfg, time.Now().UTC().Format(time.RFC3339), by
+	return s.commitLocked(id, e)
+}
+
+// apply promotes the draft to the active config if check accepts it. The
+// draft is read and replaced under one lock so a concurrent PUT cannot slip
+// in between validation and promotion.
+func (s *connectorConfigStore) apply(id string, check func(draft any) error) (connectorConfigEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.items[id]
+	if e.Draft == nil {
+		return e, errNoDraft
+	}
+	if err := check(e.Draft); err != nil {
+		return e, err
+	}
+	e.Config, e.Validated, e.SavedAt = e.Draft, true, time.Now().UTC().Format(time.RFC3339)
+	e.Draft, e.DraftSavedAt, e.DraftBy = nil, "", ""
+	return e, s.commitLocked(id, e)
+}
+
+// discard drops the draft, leaving the active config as it is.
+func (s *connectorConfigStore) discard(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.items[id]
+	if e.Draft == nil {
+		return errNoDraft
+	}
+	e.Draft, e.DraftSavedAt, e.DraftBy = nil, "", ""
+	return s.commitLocked(id, e)
+}
+
+// commitLocked writes the store with id set to e through to the file, then
+// replaces the in-memory entry, so memory never runs ahead of disk. An entry
+// with neither a config nor a draft is removed.
+func (s *connectorConfigStore) commitLocked(id string, e connectorConfigEntry) error {
+	next := make(map[string]connectorConfigEntry, len(s.items)+1)
+	for k, v := range s.items {
+		next[k] = v
+	}
+	if e.Config == nil && e.Draft == nil {
+		delete(next, id)
+	} else {
+		next[id] = e
+	}
+	if s.path != "" {
+		raw, err := json.MarshalIndent(connectorConfigFile{Version: 1, Connectors: next}, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(s.path, raw, 0o600); err != nil {
+			return err
+		}
+	}
+	s.items = next
+	return nil
+}
+
+// writeFileAtomic replaces path via a temp file and rename so a crash never
+// leaves a half-written file behind.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// serveConnectorConfig handles .../connectors/{id}/config. GET returns the
+// active config and any draft; POST saves straight to the active config; PUT
+// stages a draft, which action "apply" (config:apply) promotes once it passes
+// connectorSchema(cat, id) and action "discard" (config:discard) drops.
+// Secret fields are sealed before they are stored and masked in every
+// response and audit event.
+func serveConnectorConfig(w http.ResponseWriter, r *http.Request, cat connectorCatalog, store *connectorConfigStore, audit *auditStore, id, action string) {
+	if !connectorExists(cat, id) {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "unknown_connector", "connector_id": id})
+		return
+	}
+	schema := connectorSchema(cat, id)
+	secrets := connectorSecretFields(schema)
+	switch action {
+	case "":
+	case "apply", "discard":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		if action == "apply" {
+			applyConnectorDraft(w, r, schema, secrets, store, audit, id)
+		} else {
+			discardConnectorDraft(w, r, store, audit, id)
+		}
+		return
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "not_found"})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		e := store.entry(id)
+		cfg, validated := e.Config, e.Validated
+		if cfg == nil {
+			cfg, validated = map[string]any{"enabled": false}, false
+		}
+		masked := maskConnectorSecrets(cfg, secrets, store.box)
+		var draft any
+		if e.Draft != nil {
+			draft = map[string]any{
+				"config":   maskConnectorSecrets(e.Draft, secrets, store.box),
+				"saved_at": e.DraftSavedAt,
+				"saved_by": e.DraftBy,
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"connector_id": id,
+			"config":       masked,
+			"validated":    validated,
+			"active":       map[string]any{"config": masked, "validated": validated, "saved_at": e.SavedAt},
+			"draft":        draft,
+		})
+	case http.MethodPost, http.MethodPut:
+		var payload map[string]any
+		if !decodeJSONBody(w, r, &payload) {
+			return
+		}
+		cfg, wrapped := payload["config"]
+		if !wrapped {
+			cfg = payload
+		}
+		violations := validateAgainstSchema(schema, cfg)
+		// A draft may be unfinished: it is stored with its violations and
+		// only has to pass on apply.
+		if len(violations) > 0 && r.Method == http.MethodPost {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+				"error":        "invalid_config",
+				"connector_id": id,
+				"violations":   violations,
+			})
+			return
+		}
+		if _, ok := cfg.(map[string]any); !ok {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"error": "invalid_config", "connector_id": id, "violations": violations})
+			return
+		}
+		e := store.entry(id)
+		prev := e.Config
+		if r.Method == http.MethodPut && e.Draft != nil {
+			prev = e.Draft
+		}
+		sealed, err := sealConnectorSecrets(cfg, prev, secrets, store.box)
+		if errors.Is(err, errSecretKeyMissing) {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"error": "secret_key_not_configured"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "seal_failed"})
+			return
+		}
+		principal := principalFromContext(r.Context())
+		if r.Method == http.MethodPut {
+			err = store.setDraft(id, sealed, principal)
+		} else {
+			err = store.set(id, sealed, true)
+		}
+		if err != nil {
+			slog.Error("connector_config_persist_failed", "id", id, "err", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "persist_failed"})
+			return
+		}
+		masked := maskConnectorSecrets(sealed, secrets, store.box)
+		if r.Method == http.MethodPut {
+			auditConnectorConfig(audit, r, "connector.config.drafted", id, map[string]any{"connector_id": id, "draft": masked, "violations": len(violations)})
+			writeJSON(w, http.StatusOK, map[string]any{
+				"connector_id": id,
+				"draft":        masked,
+				"status":       "draft",
+				"violations":   violationsOrEmpty(violations),
+				"saved_at":     time.Now().UTC().Format(time.RFC3339),
+			})
+			return
+		}
+		auditConnectorConfig(audit, r, "connector.config.saved", id, map[string]any{"connector_id": id, "config": masked})
+		writeJSON(w, http.StatusOK, map[string]any{
+			"connector_id": id,
+			"config":       masked,
+			"validated":    true,
+			"saved_at":     time.Now().UTC().Format(time.RFC3339),
+		})
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodPut)
+	}
+}
+
+// draftViolationsError carries the violations that kept a draft from being
+// applied.
+type draftViolationsError struct {
+	violations []configViolation
+}
+
+func (e *draftViolationsError) Error() string {
+	return fmt.Sprintf("%d violations", len(e.violations))
+}
+
+func applyConnectorDraft(w http.ResponseWriter, r *http.Request, schema map[string]any, secrets []string, store *connectorConfigStore, audit *auditStore, id string) {
+	e, err := store.apply(id, func(draft any) error {
+		if v := sealedDraftViolations(schema, secrets, store.box, draft); len(v) > 0 {
+			return &draftViolationsError{violations: v}
+		}
+		return nil
+	})
+	var dv *draftViolationsError
+	switch {
+	case errors.Is(err, errNoDraft):
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "no_draft", "connector_id": id})
+		return
+	case errors.As(err, &dv):
+		auditConnectorConfig(audit, r, "connector.config.apply_rejected", id, map[string]any{"connector_id": id, "violations": dv.violations})
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+			"error":        "invalid_config",
+			"connector_id": id,
+			"violations":   dv.violations,
+		})
+		return
+	case err != nil:
+		slog.Error("connector_config_persist_failed", "id", id, "err", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "persist_failed"})
+		return
+	}
+	masked := maskConnectorSecrets(e.Config, secrets, store.box)
+	auditConnectorConfig(audit, r, "connector.config.applied", id, map[string]any{"connector_id": id, "config": masked})
+	writeJSON(w, http.StatusOK, map[string]any{
+		"connector_id": id,
+		"config":       masked,
+		"validated":    true,
+		"status":       "applied",
+		"saved_at":     e.SavedAt,
+	})
+}
+
+func discardConnectorDraft(w http.ResponseWriter, r *http.Request, store *connectorConfigStore, audit *auditStore, id string) {
+	err := store.discard(id)
+	switch {
+	case errors.Is(err, errNoDraft):
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "no_draft", "connector_id": id})
+		return
+	case err != nil:
+		slog.Error("connector_config_persist_failed", "id", id, "err", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "persist_failed"})
+		return
+	}
+	auditConnectorConfig(audit, r, "connector.config.discarded", id, map[string]any{"connector_id": id})
+	writeJSON(w, http.StatusOK, map[string]any{"connector_id": id, "status": "discarded"})
+}
+
+// sealedDraftViolations validates a stored draft against schema with its
+// secret fields opened, so their plaintext is what gets checked.
+func sealedDraftViolations(schema map[string]any, secrets []string, box *secretBox, draft any) []configViolation {
+	m, ok := draft.(map[string]any)
+	if !ok {
+		return validateAgainstSchema(schema, draft)
+	}
+	plain := make(map[string]any, len(m))
+	for k, v := range m {
+		plain[k] = v
+	}
+	var out []configViolation
+	for _, f := range secrets {
+		sealed, ok := plain[f].(string)
+		if !ok || !strings.HasPrefix(sealed, sealedSecretPrefix) {
+			continue
+		}
+		if box == nil {
+			out = append(out, configViolation{Path: "/" + f, Message: "cannot be unsealed with the current secret key"})
+			continue
+		}
+		v, err := box.open(sealed)
+		if err != nil {
+			out = append(out, configViolation{Path: "/" + f, Message: "cannot be unsealed with the current secret key"})
+			continue
+		}
+		plain[f] = v
+	}
+	out = append(out, validateAgainstSchema(schema, plain)...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+func violationsOrEmpty(v []configViolation) []configViolation {
+	if v == nil {
+		return []configViolation{}
+	}
+	return v
+}
+
+func auditConnectorConfig(audit *auditStore, r *http.Request, action, id string, detail map[string]any) {
+	if audit == nil {
+		return
+	}
+	outcome := "success"
+	if action == "connector.config.apply_rejected" {
+		outcome = "error"
+	}
+	ev := auditEvent{
+		EventID:   fmt.Sprintf("%d", time.Now().UnixNano()),
+		EventTS:   time.Now().UTC().Format(time.RFC3339),
+		Action:    action,
+		Outcome:   outcome,
+		ObjectKey: r.URL.Path,
+		RequestID: strings.TrimSpace(r.Header.Get("X-Request-ID")),
+		ActorID:   principalFromContext(r.Context()),
+		Source:    "gateway",
+		Detail:    detail,
+	}
+	if info := requestLogFromContext(r.Context()); info != nil {
+		ev.SSEEventIDs = info.sseEventIDs
+	}
+	audit.add(ev)
+}
+
+// validateAgainstSchema checks v (as decoded by encoding/json) against the
+// subset of JSON Schema the connector schemas use: type, properties,
+// required, additionalProperties, items, enum, minimum/maximum,
+// minLength/maxLength and pattern. Violations come back sorted by path.
+func validateAgainstSchema(schema map[string]any, v any) []configViolation {
+	var out []configViolation
+	validateSchemaNode(schema, v, "", &out)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+func validateSchemaNode(schema map[string]any, v any, path string, out *[]configViolation) {
+	fail := func(format string, args ...any) {
+		*out = append(*out, configViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if t, ok := schema["type"].(string); ok && !schemaTypeMatches(t, v) {
+		fail("expected %s, got %s", t, jsonTypeName(v))
+		return
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) && jsonTypeName(e) == jsonTypeName(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %v", enum)
+		}
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		for _, k := range schemaStrings(schema["required"]) {
+			if _, ok := val[k]; !ok {
+				*out = append(*out, configViolation{Path: path + "/" + k, Message: "is required"})
+			}
+		}
+		for k, child := range val {
+			sub, ok := props[k].(map[string]any)
+			if !ok {
+				if extra, ok := schema["additionalProperties"].(bool); ok && !extra {
+					*out = append(*out, configViolation{Path: path + "/" + k, Message: "unknown field"})
+				}
+				continue
+			}
+			validateSchemaNode(sub, child, path+"/"+k, out)
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, child := range val {
+				validateSchemaNode(items, child, fmt.Sprintf("%s/%d", path, i), out)
+			}
+		}
+	case float64:
+		if lo, ok := schemaNumber(schema["minimum"]); ok && val < lo {
+			fail("must be >= %v", lo)
+		}
+		if hi, ok := schemaNumber(schema["maximum"]); ok && val > hi {
+			fail("must be <= %v", hi)
+		}
+	case string:
+		n := len([]rune(val))
+		if lo, ok := schemaNumber(schema["minLength"]); ok && float64(n) < lo {
+			fail("must be at least %v characters", lo)
+		}
+		if hi, ok := schemaNumber(schema["maxLength"]); ok && float64(n) > hi {
+			fail("must be at most %v characters", hi)
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(p); err == nil && !re.MatchString(val) {
+				fail("must match %s", p)
+			}
+		}
+	}
+}
+
+func schemaTypeMatches(t string, v any) bool {
+	switch t {
+	case "secret":
+		// Connector credentials; "secret" marks fields that are sealed at rest.
+		_, ok := v.(string)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	}
+	return strings.EqualFold(t, jsonTypeName(v))
+}
+
+func jsonTypeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func schemaNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// schemaStrings reads a string list written either in Go ([]string) or
+// decoded from JSON ([]any).
+func schemaStrings(v any) []string {
+	switch l := v.(type) {
+	case []string:
+		return l
+	case []any:
+		out := make([]string, 0, len(l))
+		for _, e := range l {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestConnectorConfigValidation(t *testing.T) {
+	var cat connectorCatalog
+	if err := yaml.Unmarshal([]byte(fixtureCatalog), &cat); err != nil {
+		t.Fatal(err)
+	}
+	store := newConnectorConfigStore()
+	do := func(method, id, body string) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/api/gateway/connectors/"+id+"/config", strings.NewReader(body))
+		serveConnectorConfig(rec, req, cat, store, nil, id, "")
+		var out map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatalf("%s %s: %v %s", method, id, err, rec.Body.String())
+		}
+		return rec.Code, out
+	}
+
+	code, out := do(http.MethodPost, "alpha", `{"enabeld": true, "enabled": "yes", "notes": "x"}`)
+	if code != http.StatusUnprocessableEntity || out["error"] != "invalid_config" {
+		t.Fatalf("expected 422, got %d %v", code, out)
+	}
+	violations, _ := out["violations"].([]any)
+	paths := make([]string, 0, len(violations))
+	for _, v := range violations {
+		paths = append(paths, v.(map[string]any)["path"].(string))
+	}
+	if strings.Join(paths, ",") != "/enabeld,/enabled" {
+		t.Fatalf("unexpected violation paths: %v", paths)
+	}
+	if _, _, ok := store.get("alpha"); ok {
+		t.Fatal("invalid config must not be stored")
+	}
+
+	if code, out := do(http.MethodGet, "alpha", ""); code != http.StatusOK || out["validated"] != false {
+		t.Fatalf("unset config: %d %v", code, out)
+	}
+	if code, out := do(http.MethodPost, "alpha", `{"config": {"enabled": true, "notes": "ok"}}`); code != http.StatusOK || out["validated"] != true {
+		t.Fatalf("valid config: %d %v", code, out)
+	}
+	code, out = do(http.MethodGet, "alpha", "")
+	if cfg, _ := out["config"].(map[string]any); code != http.StatusOK || out["validated"] != true || cfg["enabled"] != true {
+		t.Fatalf("stored config: %d %v", code, out)
+	}
+
+	if code, _ := do(http.MethodPost, "alpha", `{"config": `); code != http.StatusBadRequest {
+		t.Fatalf("malformed JSON: expected 400, got %d", code)
+	}
+	if code, _ := do(http.MethodPost, "alpha", `{"config": []}`); code != http.StatusUnprocessableEntity {
+		t.Fatalf("non-object config: expected 422, got %d", code)
+	}
+	if code, out := do(http.MethodPost, "nope", `{"enabled": true}`); code != http.StatusNotFound || out["error"] != "unknown_connector" {
+		t.Fatalf("unknown connector: %d %v", code, out)
+	}
+	if _, _, ok := store.get("nope"); ok {
+		t.Fatal("config for unknown connector must not be stored")
+	}
+}
+
+func TestConnectorConfigCatalogSchemaOverride(t *testing.T) {
+	cat, err := parseConnectorCatalog([]byte(`
+version: "test"
+connectors:
+  - id: feed
+    name: Feed
+    kind: api
+    schema:
+      additionalProperties: false
+      required: [interval_s]
+      properties:
+        enabled: {type: boolean}
+        interval_s: {type: integer, minimum: 5, maximum: 3600}
+        region: {type: string, enum: [us, eu]}
+  - id: plain
+    name: Plain
+    kind: api
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := connectorSchema(cat, "FEED")
+	if schema["type"] != "object" || schema["title"] != "Connector FEED" {
+		t.Fatalf("override should keep the object defaults: %v", schema)
+	}
+	if props, _ := schema["properties"].(map[string]any); props["interval_s"] == nil || props["notes"] != nil {
+		t.Fatalf("override should replace the default properties: %v", props)
+	}
+	if got := connectorSchema(cat, "plain"); got["properties"].(map[string]any)["notes"] == nil {
+		t.Fatalf("connector without override should get the default schema: %v", got)
+	}
+
+	store := newConnectorConfigStore()
+	post := func(id, body string) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/gateway/connectors/"+id+"/config", strings.NewReader(body))
+		serveConnectorConfig(rec, req, cat, store, nil, id, "")
+		var out map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &out)
+		return rec.Code, out
+	}
+	code, out := post("feed", `{"enabled": true, "interval_s": 2, "region": "apac", "notes": "x"}`)
+	if code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d %v", code, out)
+	}
+	var paths []string
+	for _, v := range out["violations"].([]any) {
+		paths = append(paths, v.(map[string]any)["path"].(string))
+	}
+	if strings.Join(paths, ",") != "/interval_s,/notes,/region" {
+		t.Fatalf("unexpected violation paths: %v", paths)
+	}
+	if code, out := post("feed", `{"enabled": true}`); code != http.StatusUnprocessableEntity || !strings.Contains(mustJSON(out), "is required") {
+		t.Fatalf("missing required field: %d %v", code, out)
+	}
+	if code, out := post("feed", `{"interval_s": 60, "region": "eu"}`); code != http.StatusOK {
+		t.Fatalf("valid config: %d %v", code, out)
+	}
+	if code, out := post("plain", `{"interval_s": 60}`); code != http.StatusUnprocessableEntity {
+		t.Fatalf("default schema should still reject unknown fields: %d %v", code, out)
+	}
+}
+
+func TestValidateAgainstSchemaKeywords(t *testing.T) {
+	schema := map[string]any{
+		"type":     "object",
+		"required": []any{"mode"},
+		"properties": map[string]any{
+			"mode":  map[string]any{"type": "string", "enum": []any{"poll", "push"}},
+			"every": map[string]any{"type": "integer", "minimum": 1, "maximum": 60},
+			"tags":  map[string]any{"type": "array", "items": map[string]any{"type": "string", "pattern": "^[a-z]+$"}},
+		},
+	}
+	var cfg any
+	_ = json.Unmarshal([]byte(`{"every": 1.5, "tags": ["ok", "Bad", 3]}`), &cfg)
+	got := validateAgainstSchema(schema, cfg)
+	want := []string{"/every", "/mode", "/tags/1", "/tags/2"}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v", got)
+	}
+	for i, v := range got {
+		if v.Path != want[i] {
+			t.Fatalf("violation %d: got %+v want path %s", i, v, want[i])
+		}
+	}
+	_ = json.Unmarshal([]byte(`{"mode": "push", "every": 60, "tags": ["a"]}`), &cfg)
+	if got := validateAgainstSchema(schema, cfg); len(got) != 0 {
+		t.Fatalf("valid config reported %+v", got)
+	}
+}
+
+func TestConnectorConfigPersistsWithSealedSecrets(t *testing.T) {
+	var cat connectorCatalog
+	if err := yaml.Unmarshal([]byte(fixtureCatalog), &cat); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	t.Setenv("CONNECTOR_CONFIG_DIR", dir)
+	t.Setenv("CONNECTOR_SECRET_KEY", "test-key")
+	const secret = "sk-live-abcdef1234"
+
+	audit := newAuditStore(10)
+	store := loadConnectorConfigStore()
+	do := func(store *connectorConfigStore, method, body string) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/api/gateway/connectors/alpha/config", strings.NewReader(body))
+		serveConnectorConfig(rec, req, cat, store, audit, "alpha", "")
+		var out map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &out)
+		return rec.Code, out
+	}
+
+	code, out := do(store, http.MethodPost, `{"config": {"enabled": true, "api_key": "`+secret+`"}}`)
+	if cfg, _ := out["config"].(map[string]any); code != http.StatusOK || cfg["api_key"] != "••••1234" {
+		t.Fatalf("save: %d %v", code, out)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, "connectors.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), secret) || strings.Contains(string(raw), "abcdef") || !strings.Contains(string(raw), sealedSecretPrefix) {
+		t.Fatalf("secret must only be stored sealed: %s", raw)
+	}
+	for _, ev := range audit.list(auditFilter{}) {
+		if strings.Contains(mustJSON(ev), secret) {
+			t.Fatalf("audit event leaks the secret: %+v", ev)
+		}
+	}
+
+	// A restart reads the file back.
+	restarted := loadConnectorConfigStore()
+	code, out = do(restarted, http.MethodGet, "")
+	cfg, _ := out["config"].(map[string]any)
+	if code != http.StatusOK || out["validated"] != true || cfg["enabled"] != true || cfg["api_key"] != "••••1234" {
+		t.Fatalf("after restart: %d %v", code, out)
+	}
+
+	// Sending the mask back keeps the stored secret; the sealed value still opens.
+	if code, _ := do(restarted, http.MethodPost, `{"enabled": false, "api_key": "••••1234"}`); code != http.StatusOK {
+		t.Fatalf("resave: %d", code)
+	}
+	stored, _, _ := restarted.get("alpha")
+	plain, err := restarted.box.open(stored.(map[string]any)["api_key"].(string))
+	if err != nil || plain != secret {
+		t.Fatalf("masked round-trip lost the secret: %q %v", plain, err)
+	}
+
+	// A different key cannot read the secret back.
+	t.Setenv("CONNECTOR_SECRET_KEY", "other-key")
+	if _, out := do(loadConnectorConfigStore(), http.MethodGet, ""); out["config"].(map[string]any)["api_key"] != "••••" {
+		t.Fatalf("wrong key must mask fully: %v", out)
+	}
+}
+
+func TestConnectorSecretRequiresKey(t *testing.T) {
+	var cat connectorCatalog
+	if err := yaml.Unmarshal([]byte(fixtureCatalog), &cat); err != nil {
+		t.Fatal(err)
+	}
+	store := newConnectorConfigStore()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/gateway/connectors/alpha/config", strings.NewReader(`{"api_key": "abc"}`))
+	serveConnectorConfig(rec, req, cat, store, nil, "alpha", "")
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "secret_key_not_configured") {
+		t.Fatalf("expected 503 without a key, got %d %s", rec.Code, rec.Body.String())
+	}
+	if _, _, ok := store.get("alpha"); ok {
+		t.Fatal("nothing may be stored without a key")
+	}
+}
+
+func TestConnectorConfigDraftLifecycle(t *testing.T) {
+	var cat connectorCatalog
+	if err := yaml.Unmarshal([]byte(fixtureCatalog), &cat); err != nil {
+		t.Fatal(err)
+	}
+	box, _ := newSecretBox("test-key")
+	store := newConnectorConfigStore()
+	store.box = box
+	if err := store.open(filepath.Join(t.TempDir(), "connectors.json")); err != nil {
+		t.Fatal(err)
+	}
+	audit := newAuditStore(50)
+	do := func(method, action, body string) (int, map[string]any) {
+		path := "/api/gateway/connectors/alpha/config"
+		if action != "" {
+			path += ":" + action
+		}
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), ctxPrincipal, "jwt:alice"))
+		rec := httptest.NewRecorder()
+		serveConnectorConfig(rec, req, cat, store, audit, "alpha", action)
+		var out map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &out)
+		return rec.Code, out
+	}
+
+	if code, _ := do(http.MethodPost, "", `{"enabled": true, "notes": "live"}`); code != http.StatusOK {
+		t.Fatalf("initial save: %d", code)
+	}
+
+	// A half-finished draft is kept but does not touch the active config.
+	code, out := do(http.MethodPut, "", `{"enabled": "half", "api_key": "sk-draft-9876"}`)
+	if code != http.StatusOK || out["status"] != "draft" || len(out["violations"].([]any)) != 1 {
+		t.Fatalf("draft: %d %v", code, out)
+	}
+	_, out = do(http.MethodGet, "", "")
+	active := out["active"].(map[string]any)["config"].(map[string]any)
+	draft, _ := out["draft"].(map[string]any)
+	if active["notes"] != "live" || out["config"].(map[string]any)["notes"] != "live" {
+		t.Fatalf("active config changed by a draft: %v", out)
+	}
+	if draft == nil || draft["saved_by"] != "jwt:alice" || draft["config"].(map[string]any)["api_key"] != "••••9876" {
+		t.Fatalf("draft in GET: %v", out["draft"])
+	}
+
+	// Apply validates the draft.
+	if code, out := do(http.MethodPost, "apply", ""); code != http.StatusUnprocessableEntity || out["error"] != "invalid_config" {
+		t.Fatalf("apply invalid draft: %d %v", code, out)
+	}
+	if cfg, _, _ := store.get("alpha"); cfg.(map[string]any)["notes"] != "live" {
+		t.Fatal("rejected apply changed the active config")
+	}
+
+	// Fixing the draft (sending the secret's mask back) and applying promotes it.
+	if code, _ := do(http.MethodPut, "", `{"enabled": false, "api_key": "••••9876"}`); code != http.StatusOK {
+		t.Fatalf("second draft: %d", code)
+	}
+	code, out = do(http.MethodPost, "apply", "")
+	if code != http.StatusOK || out["status"] != "applied" || out["config"].(map[string]any)["enabled"] != false {
+		t.Fatalf("apply: %d %v", code, out)
+	}
+	cfg, _, _ := store.get("alpha")
+	if plain, err := box.open(cfg.(map[string]any)["api_key"].(string)); err != nil || plain != "sk-draft-9876" {
+		t.Fatalf("applied secret: %q %v", plain, err)
+	}
+	if _, out := do(http.MethodGet, "", ""); out["draft"] != nil {
+		t.Fatalf("draft left after apply: %v", out["draft"])
+	}
+	if code, out := do(http.MethodPost, "apply", ""); code != http.StatusNotFound || out["error"] != "no_draft" {
+		t.Fatalf("apply without a draft: %d %v", code, out)
+	}
+
+	// Discard drops a draft and leaves the active config alone.
+	if code, _ := do(http.MethodPut, "", `{"enabled": true}`); code != http.StatusOK {
+		t.Fatalf("third draft: %d", code)
+	}
+	if code, out := do(http.MethodPost, "discard", ""); code != http.StatusOK || out["status"] != "discarded" {
+		t.Fatalf("discard: %d %v", code, out)
+	}
+	if code, _ := do(http.MethodPost, "discard", ""); code != http.StatusNotFound {
+		t.Fatalf("second discard: %d", code)
+	}
+	if cfg, _, _ := store.get("alpha"); cfg.(map[string]any)["enabled"] != false {
+		t.Fatal("discard changed the active config")
+	}
+	if code, _ := do(http.MethodGet, "apply", ""); code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET on apply: %d", code)
+	}
+
+	// The draft survives a restart.
+	if code, _ := do(http.MethodPut, "", `{"notes": "pending"}`); code != http.StatusOK {
+		t.Fatalf("fourth draft: %d", code)
+	}
+	restarted := newConnectorConfigStore()
+	if err := restarted.open(store.path); err != nil {
+		t.Fatal(err)
+	}
+	if e := restarted.entry("alpha"); e.Draft.(map[string]any)["notes"] != "pending" || e.Config.(map[string]any)["enabled"] != false {
+		t.Fatalf("after restart: %+v", e)
+	}
+
+	var actions []string
+	for _, ev := range audit.list(auditFilter{}) {
+		if ev.ActorID != "jwt:alice" {
+			t.Fatalf("audit event without the principal: %+v", ev)
+		}
+		actions = append(actions, ev.Action)
+	}
+	want := "connector.config.saved,connector.config.drafted,connector.config.apply_rejected,connector.config.drafted," +
+		"connector.config.applied,connector.config.drafted,connector.config.discarded,connector.config.drafted"
+	if got := strings.Join(actions, ","); got != want {
+		t.Fatalf("audit actions:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestConnectorConfigDraftRoutesMatchAlias(t *testing.T) {
+	mux, _, connectorID, _ := newTestGatewayMux(t)
+	for _, prefix := range []string{"/api/gateway/connectors/", "/api/connectors/"} {
+		base := prefix + connectorID + "/config"
+		steps := []struct {
+			method, path, body string
+			want               int
+		}{
+			{http.MethodPut, base, `{"enabled": true}`, http.StatusOK},
+			{http.MethodPost, base + ":apply", "", http.StatusOK},
+			{http.MethodPost, base + ":apply", "", http.StatusNotFound},
+			{http.MethodPut, base, `{"enabled": false}`, http.StatusOK},
+			{http.MethodPost, base + ":discard", "", http.StatusOK},
+			{http.MethodDelete, base + ":discard", "", http.StatusMethodNotAllowed},
+			{http.MethodPost, base + ":publish", "", http.StatusNotFound},
+		}
+		for _, st := range steps {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(st.method, st.path, strings.NewReader(st.body)))
+			if rec.Code != st.want {
+				t.Fatalf("%s %s: %d, want %d (%s)", st.method, st.path, rec.Code, st.want, rec.Body.String())
+			}
+		}
+	}
+}
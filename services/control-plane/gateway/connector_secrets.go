@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// --- Connector secrets ---
+
+const (
+	sealedSecretPrefix = "enc:v1:"
+	secretMaskPrefix   = "••••"
+)
+
+var errSecretKeyMissing = errors.New("connector secret key not configured")
+
+// secretBox seals connector secret fields with AES-256-GCM. The sealed form
+// is "enc:v1:" + base64(nonce || ciphertext).
+type secretBox struct {
+	aead cipher.AEAD
+}
+
+// newSecretBox derives the key from CONNECTOR_SECRET_KEY: 32 bytes given as
+// base64 or hex are used as is, anything else is hashed with SHA-256. An
+// empty key yields a nil box.
+func newSecretBox(key string) (*secretBox, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return nil, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != 32 {
+		if raw, err = hex.DecodeString(key); err != nil || len(raw) != 32 {
+			sum := sha256.Sum256([]byte(key))
+			raw = sum[:]
+		}
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &secretBox{aead: aead}, nil
+}
+
+func (b *secretBox) seal(plain string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	out := b.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return sealedSecretPrefix + base64.StdEncoding.EncodeToString(out), nil
+}
+
+func (b *secretBox) open(sealed string) (string, error) {
+	enc, ok := strings.CutPrefix(sealed, sealedSecretPrefix)
+	if !ok {
+		return "", errors.New("not a sealed secret")
+	}
+	raw, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return "", err
+	}
+	n := b.aead.NonceSize()
+	if len(raw) < n {
+		return "", errors.New("sealed secret too short")
+	}
+	plain, err := b.aead.Open(nil, raw[:n], raw[n:], nil)
+	if err != nil {
+		return "", fmt.Errorf("open sealed secret: %w", err)
+	}
+	return string(plain), nil
+}
+
+// connectorSecretFields lists the top-level properties of type "secret".
+func connectorSecretFields(schema map[string]any) []string {
+	props, _ := schema["properties"].(map[string]any)
+	var out []string
+	for k, v := range props {
+		if p, ok := v.(map[string]any); ok && p["type"] == "secret" {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// sealConnectorSecrets returns a copy of cfg with every secret field sealed.
+// A masked value sent back unchanged by the UI keeps the secret stored in
+// prev; an empty value clears it.
+func sealConnectorSecrets(cfg, prev any, fields []string, box *secretBox) (any, error) {
+	m, ok := cfg.(map[string]any)
+	if !ok || len(fields) == 0 {
+		return cfg, nil
+	}
+	prevMap, _ := prev.(map[string]any)
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	for _, f := range fields {
+		v, ok := out[f].(string)
+		if !ok || v == "" {
+			continue
+		}
+		if strings.HasPrefix(v, secretMaskPrefix) {
+			if old, ok := prevMap[f].(string); ok && strings.HasPrefix(old, sealedSecretPrefix) {
+				out[f] = old
+				continue
+			}
+		}
+		if box == nil {
+			return nil, errSecretKeyMissing
+		}
+		sealed, err := box.seal(v)
+		if err != nil {
+			return nil, err
+		}
+		out[f] = sealed
+	}
+	return out, nil
+}
+
+// maskConnectorSecrets returns a copy of a sealed cfg that is safe to show:
+// secret fields become "••••" plus the last four characters when the secret
+// is long enough for that not to give it away.
+func maskConnectorSecrets(cfg any, fields []string, box *secretBox) any {
+	m, ok := cfg.(map[string]any)
+	if !ok || len(fields) == 0 {
+		return cfg
+	}
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	for _, f := range fields {
+		v, ok := out[f].(string)
+		if !ok || v == "" {
+			continue
+		}
+		masked := secretMaskPrefix
+		if box != nil {
+			if plain, err := box.open(v); err == nil {
+				if r := []rune(plain); len(r) >= 8 {
+					masked += string(r[len(r)-4:])
+				}
+			}
+		}
+		out[f] = masked
+	}
+	return out
+}
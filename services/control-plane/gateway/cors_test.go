@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCORSAllowlist(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	cases := []struct {
+		name, spec, origin string
+		credentials        bool
+		wantAllow          string
+		wantCredentials    bool
+	}{
+		{"empty list keeps wildcard", "", "https://evil.example", false, "*", false},
+		{"wildcard never sends credentials", "", "https://evil.example", true, "*", false},
+		{"listed origin is echoed", "https://app.example, https://admin.example/", "https://admin.example", false, "https://admin.example", false},
+		{"credentials are opt-in", "https://app.example", "https://app.example", true, "https://app.example", true},
+		{"origin match ignores case", "https://App.Example", "https://app.example", false, "https://app.example", false},
+		{"unlisted origin gets nothing", "https://app.example", "https://evil.example", true, "", false},
+		{"no origin header gets nothing", "https://app.example", "", false, "", false},
+		{"subdomain wildcard", "*.example.com", "https://eu.app.example.com", true, "https://eu.app.example.com", true},
+		{"subdomain wildcard does not cover other ports", "*.example.com", "http://dev.example.com:5173", false, "", false},
+		{"subdomain wildcard excludes the apex", "*.example.com", "https://example.com", false, "", false},
+		{"subdomain wildcard is not a substring match", "*.example.com", "https://evil-example.com", false, "", false},
+		{"subdomain wildcard rejects lookalike suffix", "*.example.com", "https://app.example.com.evil.io", false, "", false},
+		{"wildcard with scheme", "https://*.example.com", "https://app.example.com", false, "https://app.example.com", false},
+		{"wildcard with scheme rejects other schemes", "https://*.example.com", "http://app.example.com", false, "", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := parseCORSOrigins(tc.spec)
+			cfg.credentials = tc.credentials
+			h := withCORS(cfg)(ok)
+			for _, method := range []string{http.MethodGet, http.MethodOptions} {
+				req := httptest.NewRequest(method, "/api/profiles", nil)
+				if tc.origin != "" {
+					req.Header.Set("Origin", tc.origin)
+				}
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+				if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tc.wantAllow {
+					t.Fatalf("%s: allow origin %q, want %q", method, got, tc.wantAllow)
+				}
+				if tc.spec != "" && rec.Header().Get("Vary") != "Origin" {
+					t.Fatalf("%s: missing Vary: Origin", method)
+				}
+				if got := rec.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tc.wantCredentials {
+					t.Fatalf("%s: credentials=%v, want %v", method, got, tc.wantCredentials)
+				}
+			}
+		})
+	}
+}
+
+// TestCORSPreflightAllowsConditionalPut covers profile updates from a
+// browser: PUT with If-Match, and the ETag it needs to read first.
+func TestCORSPreflightAllowsConditionalPut(t *testing.T) {
+	h := withCORS(parseCORSOrigins("https://app.example"))(http.NotFoundHandler())
+	req := httptest.NewRequest(http.MethodOptions, "/api/profiles/p1", nil)
+	req.Header.Set("Origin", "https://app.example")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("preflight: %d", rec.Code)
+	}
+	for header, want := range map[string]string{
+		"Access-Control-Allow-Methods":  "PUT",
+		"Access-Control-Allow-Headers":  "If-Match",
+		"Access-Control-Expose-Headers": "ETag",
+	} {
+		if got := rec.Header().Get(header); !strings.Contains(got, want) {
+			t.Fatalf("%s = %q, want it to include %s", header, got, want)
+		}
+	}
+}
+
+func TestCORSExposesRateLimitHeaders(t *testing.T) {
+	h := withCORS(parseCORSOrigins(""))(http.NotFoundHandler())
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/results", nil))
+	exposed := rec.Header().Get("Access-Control-Expose-Headers")
+	for _, want := range []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After"} {
+		if !strings.Contains(exposed, want) {
+			t.Fatalf("Access-Control-Expose-Headers = %q, missing %s", exposed, want)
+		}
+	}
+}
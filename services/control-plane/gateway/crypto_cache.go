@@ -0,0 +1,123 @@
+package main
+
+import (
+	mrand "math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// --- Crypto ticker cache loop ---
+
+// cryptoPollInterval is how often startCryptoCacheLoop refreshes the ticker
+// cache while the providers answer; cryptoMaxBackoff caps the wait after
+// consecutive failures.
+var (
+	cryptoPollInterval = 2 * time.Second
+	cryptoMaxBackoff   = 2 * time.Minute
+)
+
+// cryptoPollJitter is taken off each backoff so gateways that lost the
+// upstream together do not retry in lockstep: up to a quarter of the wait.
+var cryptoPollJitter = func(wait time.Duration) time.Duration {
+	return time.Duration(mrand.Int64N(int64(wait/4) + 1))
+}
+
+// cryptoPollDelay is the wait before the next refresh after failures
+// consecutive failed ones: the poll interval, doubled per failure up to
+// cryptoMaxBackoff, less jitter.
+func cryptoPollDelay(failures int) time.Duration {
+	if failures <= 0 {
+		return cryptoPollInterval
+	}
+	wait := cryptoPollInterval << min(failures, 20)
+	if wait <= 0 || wait > cryptoMaxBackoff {
+		wait = cryptoMaxBackoff
+	}
+	return wait - cryptoPollJitter(wait)
+}
+
+// cryptoStaleSeconds is the age of a snapshot in whole seconds once it is
+// older than three poll intervals, the point where the wall should stop
+// looking live. ok is false for fresh and never-fetched snapshots.
+func cryptoStaleSeconds(updated, now time.Time) (int64, bool) {
+	if updated.IsZero() {
+		return 0, false
+	}
+	age := now.Sub(updated)
+	if age <= 3*cryptoPollInterval {
+		return 0, false
+	}
+	return int64(age / time.Second), true
+}
+
+// scheduled records when the loop will refresh next.
+func (c *cryptoCache) scheduled(wait time.Duration, now time.Time) {
+	c.mu.Lock()
+	c.backoff = wait
+	c.nextPoll = now.Add(wait)
+	c.mu.Unlock()
+}
+
+// cryptoCacheStatus is the loop state served by /api/crypto/cache/status.
+type cryptoCacheStatus struct {
+	Source              string `json:"source,omitempty"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastSuccess         string `json:"last_success,omitempty"`
+	LastAttempt         string `json:"last_attempt,omitempty"`
+	LastError           string `json:"last_error,omitempty"`
+	NextPollAt          string `json:"next_poll_at,omitempty"`
+	BackoffMs           int64  `json:"backoff_ms"`
+	PollIntervalMs      int64  `json:"poll_interval_ms"`
+	StaleSeconds        *int64 `json:"stale_seconds,omitempty"`
+	Tickers             int    `json:"tickers"`
+}
+
+func (c *cryptoCache) status(now time.Time) cryptoCacheStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	st := cryptoCacheStatus{
+		Source:              c.source,
+		ConsecutiveFailures: c.failures,
+		LastError:           c.lastErr,
+		BackoffMs:           c.backoff.Milliseconds(),
+		PollIntervalMs:      cryptoPollInterval.Milliseconds(),
+		Tickers:             len(c.tickers),
+	}
+	if !c.lastUpdated.IsZero() {
+		st.LastSuccess = c.lastUpdated.UTC().Format(time.RFC3339)
+	}
+	if !c.lastAttempt.IsZero() {
+		st.LastAttempt = c.lastAttempt.UTC().Format(time.RFC3339)
+	}
+	if !c.nextPoll.IsZero() {
+		st.NextPollAt = c.nextPoll.UTC().Format(time.RFC3339)
+	}
+	if s, ok := cryptoStaleSeconds(c.lastUpdated, now); ok {
+		st.StaleSeconds = &s
+	}
+	return st
+}
+
+// newCryptoCacheStatusHandler shows the state of startCryptoCacheLoop to
+// operators holding ADMIN_API_KEY.
+func newCryptoCacheStatusHandler(cache *cryptoCache, adminKey string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		if adminKey == "" {
+			writeJSON(w, http.StatusForbidden, map[string]any{"error": "admin_disabled"})
+			return
+		}
+		if !adminKeyValid(adminKey, r) {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{"error": "unauthorized"})
+			return
+		}
+		writeJSON(w, http.StatusOK, cache.status(time.Now()))
+	}
+}
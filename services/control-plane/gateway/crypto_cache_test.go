@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyTickers fails every Tickers call while fail is set and records when
+// each call was made.
+type flakyTickers struct {
+	mu    sync.Mutex
+	fail  bool
+	calls []time.Time
+}
+
+func (p *flakyTickers) Name() string { return "flaky" }
+
+func (p *flakyTickers) Tickers(context.Context) ([]binanceTicker, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, time.Now())
+	if p.fail {
+		return nil, errors.New("rate limited")
+	}
+	return []binanceTicker{{Symbol: "BTCUSDT", LastPrice: "1"}}, nil
+}
+
+func (p *flakyTickers) Symbols(context.Context) ([]symbolInfo, error) {
+	return nil, errors.New("unused")
+}
+
+func (p *flakyTickers) snapshot() (bool, []time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.fail, append([]time.Time(nil), p.calls...)
+}
+
+func withCryptoPolling(t *testing.T, interval, maxBackoff time.Duration) {
+	t.Helper()
+	origInterval, origMax, origJitter := cryptoPollInterval, cryptoMaxBackoff, cryptoPollJitter
+	cryptoPollInterval, cryptoMaxBackoff = interval, maxBackoff
+	cryptoPollJitter = func(time.Duration) time.Duration { return 0 }
+	t.Cleanup(func() { cryptoPollInterval, cryptoMaxBackoff, cryptoPollJitter = origInterval, origMax, origJitter })
+}
+
+func TestCryptoPollDelay(t *testing.T) {
+	withCryptoPolling(t, 2*time.Second, 2*time.Minute)
+	for failures, want := range []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, 64 * time.Second, 2 * time.Minute, 2 * time.Minute} {
+		if got := cryptoPollDelay(failures); got != want {
+			t.Errorf("after %d failures: %v, want %v", failures, got, want)
+		}
+	}
+	if got := cryptoPollDelay(1000); got != 2*time.Minute {
+		t.Errorf("large failure counts must stay capped: %v", got)
+	}
+
+	cryptoPollJitter = func(wait time.Duration) time.Duration { return wait / 4 }
+	if got := cryptoPollDelay(2); got != 6*time.Second {
+		t.Errorf("jitter is taken off the wait: %v", got)
+	}
+}
+
+func TestCryptoCacheLoopBacksOffAndRecovers(t *testing.T) {
+	withCryptoPolling(t, time.Millisecond, 16*time.Millisecond)
+	p := &flakyTickers{fail: true}
+	orig := marketData
+	marketData = newMarketDataChain(p)
+	defer func() { marketData = orig }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache := &cryptoCache{}
+	startCryptoCacheLoop(ctx, cache)
+
+	waitFor := func(what string, cond func(cryptoCacheStatus) bool) cryptoCacheStatus {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if st := cache.status(time.Now()); cond(st) {
+				return st
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatalf("timed out waiting for %s: %+v", what, cache.status(time.Now()))
+		return cryptoCacheStatus{}
+	}
+
+	st := waitFor("six failures", func(st cryptoCacheStatus) bool { return st.ConsecutiveFailures >= 6 })
+	if !strings.Contains(st.LastError, "rate limited") || st.LastSuccess != "" {
+		t.Fatalf("failure state: %+v", st)
+	}
+	_, calls := p.snapshot()
+	for i := 2; i < 6; i++ {
+		// The wait before call i followed i-1 failures.
+		if gap, want := calls[i].Sub(calls[i-1]), cryptoPollDelay(i-1); gap < want {
+			t.Errorf("gap before call %d: %v, want at least %v", i, gap, want)
+		}
+	}
+	waitFor("capped backoff", func(st cryptoCacheStatus) bool { return st.BackoffMs == 16 })
+
+	p.mu.Lock()
+	p.fail = false
+	p.mu.Unlock()
+	st = waitFor("recovery", func(st cryptoCacheStatus) bool { return st.ConsecutiveFailures == 0 })
+	if st.Tickers != 1 || st.LastSuccess == "" || st.Source != "flaky" {
+		t.Fatalf("after recovery: %+v", st)
+	}
+	waitFor("base interval", func(st cryptoCacheStatus) bool { return st.BackoffMs == 1 })
+}
+
+func TestCryptoStaleSeconds(t *testing.T) {
+	withCryptoPolling(t, 2*time.Second, 2*time.Minute)
+	now := time.Date(2026, 1, 1, 0, 0, 10, 0, time.UTC)
+
+	if _, ok := cryptoStaleSeconds(now.Add(-6*time.Second), now); ok {
+		t.Fatal("three poll intervals old is not stale yet")
+	}
+	if s, ok := cryptoStaleSeconds(now.Add(-9500*time.Millisecond), now); !ok || s != 9 {
+		t.Fatalf("stale seconds: %d %v", s, ok)
+	}
+	if _, ok := cryptoStaleSeconds(time.Time{}, now); ok {
+		t.Fatal("never fetched is not reported as stale")
+	}
+
+	payload := cryptoStreamPayload(nil, now.Add(-30*time.Second), "", now)
+	if payload["stale_seconds"] != int64(30) {
+		t.Fatalf("stream payload: %v", payload)
+	}
+	if _, ok := cryptoStreamPayload(nil, now.Add(-time.Second), "", now)["stale_seconds"]; ok {
+		t.Fatal("fresh stream payload carries stale_seconds")
+	}
+
+	cache := &cryptoCache{}
+	seedCryptoCache(cache, time.Now().Add(-time.Minute))
+	var rows []cryptoTopRow
+	rec := getCryptoTop(newCryptoTopHandler(cache), "/api/crypto/top", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &rows); err != nil || len(rows) == 0 || rows[0].StaleSeconds < 60 {
+		t.Fatalf("top rows: %s", rec.Body.String())
+	}
+	seedCryptoCache(cache, time.Now())
+	rows = nil
+	rec = getCryptoTop(newCryptoTopHandler(cache), "/api/crypto/top", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &rows); err != nil || rows[0].StaleSeconds != 0 {
+		t.Fatalf("fresh top rows: %s", rec.Body.String())
+	}
+}
+
+func TestCryptoCacheStatusNeedsAdminKey(t *testing.T) {
+	cache := &cryptoCache{}
+	cache.set(nil, "", "boom")
+	get := func(h http.Handler, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/crypto/cache/status", nil)
+		if key != "" {
+			req.Header.Set("X-Admin-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := get(newCryptoCacheStatusHandler(cache, ""), "k"); rec.Code != http.StatusForbidden {
+		t.Fatalf("no admin key configured: %d", rec.Code)
+	}
+	h := newCryptoCacheStatusHandler(cache, "k")
+	if rec := get(h, "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong key: %d", rec.Code)
+	}
+	rec := get(h, "k")
+	var st cryptoCacheStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil || rec.Code != http.StatusOK || st.ConsecutiveFailures != 1 || st.LastError != "boom" {
+		t.Fatalf("status: %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- /api/crypto/klines ---
+
+// klineIntervals is the allowlist of Binance kline intervals and how long
+// each candle lasts. A month is taken as 30 days; it only sizes the cache.
+var klineIntervals = map[string]time.Duration{
+	"1m":  time.Minute,
+	"3m":  3 * time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"30m": 30 * time.Minute,
+	"1h":  time.Hour,
+	"2h":  2 * time.Hour,
+	"4h":  4 * time.Hour,
+	"6h":  6 * time.Hour,
+	"8h":  8 * time.Hour,
+	"12h": 12 * time.Hour,
+	"1d":  24 * time.Hour,
+	"3d":  72 * time.Hour,
+	"1w":  7 * 24 * time.Hour,
+	"1M":  30 * 24 * time.Hour,
+}
+
+// maxKlinesCacheTTL caps how long a response is reused: the newest candle of
+// a daily series is still open and keeps changing.
+const maxKlinesCacheTTL = time.Hour
+
+var klineSymbolRe = regexp.MustCompile(`^[A-Z0-9]{2,20}$`)
+
+type klinesEntry struct {
+	rows    []kline
+	source  string
+	expires time.Time
+}
+
+// klinesCache keeps one response per symbol, interval and limit for the
+// length of one candle.
+type klinesCache struct {
+	mu      sync.Mutex
+	entries map[string]klinesEntry
+	now     func() time.Time
+}
+
+func newKlinesCache() *klinesCache {
+	return &klinesCache{entries: map[string]klinesEntry{}, now: time.Now}
+}
+
+func klinesCacheTTL(interval string) time.Duration {
+	ttl := klineIntervals[interval]
+	if ttl > maxKlinesCacheTTL {
+		ttl = maxKlinesCacheTTL
+	}
+	return ttl
+}
+
+// get serves from the cache or asks the providers. A nil cache always asks.
+func (c *klinesCache) get(ctx context.Context, symbol, interval string, limit int) ([]kline, string, bool, error) {
+	if c == nil {
+		rows, source, err := marketData.klines(ctx, symbol, interval, limit)
+		return rows, source, false, err
+	}
+	key := symbol + "|" + interval + "|" + strconv.Itoa(limit)
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	now := c.now()
+	c.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.rows, e.source, true, nil
+	}
+	rows, source, err := marketData.klines(ctx, symbol, interval, limit)
+	if err != nil {
+		return nil, "", false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now = c.now()
+	for k, old := range c.entries {
+		if !now.Before(old.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = klinesEntry{rows: rows, source: source, expires: now.Add(klinesCacheTTL(interval))}
+	return rows, source, false, nil
+}
+
+// newCryptoKlinesHandler serves historical candles for one symbol as
+// {t,o,h,l,c,v} rows, oldest first. X-Cache says whether the rows came from
+// the cache; X-Source names the provider either way.
+func newCryptoKlinesHandler(cache *klinesCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		symbol := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("symbol")))
+		if !klineSymbolRe.MatchString(symbol) {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_symbol"})
+			return
+		}
+		interval := strings.TrimSpace(r.URL.Query().Get("interval"))
+		if interval == "" {
+			interval = "1m"
+		}
+		if _, ok := klineIntervals[interval]; !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_interval"})
+			return
+		}
+		limit := clampInt(queryInt(r, "limit", 500), 1, 1000)
+
+		rows, source, hit, err := cache.get(r.Context(), symbol, interval, limit)
+		if err != nil {
+			status := 0
+			var he *marketHTTPError
+			if errors.As(err, &he) {
+				status = he.Status
+			}
+			writeJSON(w, http.StatusBadGateway, map[string]any{"error": "upstream_error", "upstream": "market_data", "status": status})
+			return
+		}
+		w.Header().Set("X-Source", source)
+		if hit {
+			w.Header().Set("X-Cache", "hit")
+		} else {
+			w.Header().Set("X-Cache", "miss")
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"symbol":   symbol,
+			"interval": interval,
+			"source":   source,
+			"klines":   rows,
+		})
+	}
+}
+
+// indexFromKlines rebuilds the crypto index series from 1m candles: the mean
+// close of the ten most traded USDT pairs at each minute all of them share.
+// It is used when the aggregator has no index points yet.
+func indexFromKlines(ctx context.Context, cache *klinesCache, minutes int) ([]indexPoint, bool) {
+	ticks, _, err := marketData.tickers(ctx)
+	if err != nil {
+		return nil, false
+	}
+	symbols := topUSDTSymbols(ticks, 10)
+	if len(symbols) == 0 {
+		return nil, false
+	}
+	sums := map[string]float64{}
+	counts := map[string]int{}
+	for _, sym := range symbols {
+		rows, _, _, err := cache.get(ctx, sym, "1m", minutes)
+		if err != nil {
+			return nil, false
+		}
+		for _, k := range rows {
+			if k.C <= 0 {
+				continue
+			}
+			sums[k.T] += k.C
+			counts[k.T]++
+		}
+	}
+	points := make([]indexPoint, 0, len(sums))
+	for t, sum := range sums {
+		if counts[t] != len(symbols) {
+			continue
+		}
+		points = append(points, indexPoint{T: t, Y: sum / float64(len(symbols))})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].T < points[j].T })
+	return points, len(points) > 0
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func klinesTestProvider(t *testing.T) (*binanceProvider, *int) {
+	t.Helper()
+	hits := 0
+	fixtures := fixtureServer(t, map[string]string{
+		"/api/v3/klines":      "binance_klines.json",
+		"/api/v3/ticker/24hr": "binance_ticker_24hr.json",
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v3/klines" {
+			hits++
+			if r.URL.Query().Get("symbol") == "DOWNUSDT" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		fixtures.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return &binanceProvider{baseURLs: []string{srv.URL}, client: srv.Client()}, &hits
+}
+
+func getKlines(h http.Handler, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func TestCryptoKlinesNormalizesAndCaches(t *testing.T) {
+	p, hits := klinesTestProvider(t)
+	orig := marketData
+	marketData = newMarketDataChain(p)
+	defer func() { marketData = orig }()
+
+	cache := newKlinesCache()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	h := newCryptoKlinesHandler(cache)
+
+	rec := getKlines(h, "/api/crypto/klines?symbol=btcusdt&interval=1m&limit=2")
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "miss" || rec.Header().Get("X-Source") != "binance" {
+		t.Fatalf("first: %d %v %s", rec.Code, rec.Header(), rec.Body.String())
+	}
+	var body struct {
+		Symbol string  `json:"symbol"`
+		Klines []kline `json:"klines"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := kline{T: "2025-12-31T23:58:00Z", O: 65600, H: 65650, L: 65580, C: 65620.1, V: 12.5}
+	if body.Symbol != "BTCUSDT" || len(body.Klines) != 2 || body.Klines[0] != want {
+		t.Fatalf("unexpected body %+v", body)
+	}
+
+	if rec := getKlines(h, "/api/crypto/klines?symbol=BTCUSDT&interval=1m&limit=2"); rec.Header().Get("X-Cache") != "hit" || *hits != 1 {
+		t.Fatalf("second: %v hits=%d", rec.Header(), *hits)
+	}
+	now = now.Add(time.Minute)
+	if rec := getKlines(h, "/api/crypto/klines?symbol=BTCUSDT&interval=1m&limit=2"); rec.Header().Get("X-Cache") != "miss" || *hits != 2 {
+		t.Fatalf("after expiry: %v hits=%d", rec.Header(), *hits)
+	}
+}
+
+func TestCryptoKlinesRejectsBadInput(t *testing.T) {
+	h := newCryptoKlinesHandler(newKlinesCache())
+	for target, code := range map[string]string{
+		"/api/crypto/klines?symbol=BTCUSDT&interval=2m": "invalid_interval",
+		"/api/crypto/klines?symbol=BTC-USD":             "invalid_symbol",
+		"/api/crypto/klines":                            "invalid_symbol",
+	} {
+		rec := getKlines(h, target)
+		var body map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &body)
+		if rec.Code != http.StatusBadRequest || body["error"] != code {
+			t.Fatalf("%s: %d %v", target, rec.Code, body)
+		}
+	}
+}
+
+func TestCryptoKlinesUpstreamError(t *testing.T) {
+	p, _ := klinesTestProvider(t)
+	orig := marketData
+	marketData = newMarketDataChain(p)
+	defer func() { marketData = orig }()
+
+	rec := getKlines(newCryptoKlinesHandler(newKlinesCache()), "/api/crypto/klines?symbol=DOWNUSDT")
+	var body map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &body)
+	if rec.Code != http.StatusBadGateway || body["error"] != "upstream_error" || body["status"] != float64(503) {
+		t.Fatalf("unexpected %d %v", rec.Code, body)
+	}
+}
+
+func TestIndexFromKlines(t *testing.T) {
+	p, _ := klinesTestProvider(t)
+	orig := marketData
+	marketData = newMarketDataChain(p)
+	defer func() { marketData = orig }()
+
+	points, ok := indexFromKlines(context.Background(), newKlinesCache(), 30)
+	if !ok || len(points) != 2 || points[0].T != "2025-12-31T23:58:00Z" || points[1].Y != 65690 {
+		t.Fatalf("unexpected points %v %v", points, ok)
+	}
+}
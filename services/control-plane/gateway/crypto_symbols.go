@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- /api/crypto/symbols ---
+
+const defaultCryptoSymbolsTTL = 10 * time.Minute
+
+// symbolsCache keeps the provider chain's symbol list for ttl, so searches
+// do not refetch the exchange info on every keystroke. When a refresh fails
+// the previous list is served until one succeeds.
+type symbolsCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	syms    []symbolInfo
+	source  string
+	fetched time.Time
+	now     func() time.Time
+}
+
+func newSymbolsCache(ttl time.Duration) *symbolsCache {
+	if ttl <= 0 {
+		ttl = defaultCryptoSymbolsTTL
+	}
+	return &symbolsCache{ttl: ttl, now: time.Now}
+}
+
+// loadSymbolsCache reads CRYPTO_SYMBOLS_TTL_SECONDS.
+func loadSymbolsCache() *symbolsCache {
+	return newSymbolsCache(time.Duration(envInt("CRYPTO_SYMBOLS_TTL_SECONDS", int(defaultCryptoSymbolsTTL/time.Second))) * time.Second)
+}
+
+// get returns the symbol list, its provider and whether it came from the
+// cache. A nil cache always asks the providers.
+func (c *symbolsCache) get(ctx context.Context) ([]symbolInfo, string, bool, error) {
+	if c == nil {
+		syms, source, err := marketData.symbols(ctx)
+		return syms, source, false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.syms != nil && c.now().Sub(c.fetched) < c.ttl {
+		return c.syms, c.source, true, nil
+	}
+	syms, source, err := marketData.symbols(ctx)
+	if err != nil {
+		if c.syms != nil {
+			return c.syms, c.source, true, nil
+		}
+		return nil, "", false, err
+	}
+	c.syms, c.source, c.fetched = syms, source, c.now()
+	return syms, source, false, nil
+}
+
+// symbolQuery is the search on /api/crypto/symbols. The zero value matches
+// everything.
+type symbolQuery struct {
+	q        string // upper-cased substring of the symbol
+	quote    string // upper-cased quote asset
+	limit    int    // 0 is no limit
+	detailed bool
+}
+
+func parseSymbolQuery(r *http.Request) symbolQuery {
+	q := r.URL.Query()
+	sq := symbolQuery{
+		q:        strings.ToUpper(strings.TrimSpace(q.Get("q"))),
+		quote:    strings.ToUpper(strings.TrimSpace(q.Get("quote"))),
+		detailed: strings.EqualFold(strings.TrimSpace(q.Get("detailed")), "true"),
+	}
+	if q.Get("limit") != "" {
+		sq.limit = clampInt(queryInt(r, "limit", 0), 1, 10000)
+	}
+	return sq
+}
+
+// filter keeps the symbols that match, those starting with q first, each
+// group in its input order. Without a known quote asset the symbol's suffix
+// is compared instead.
+func (sq symbolQuery) filter(syms []symbolInfo) []symbolInfo {
+	var prefix, rest []symbolInfo
+	for _, s := range syms {
+		if sq.quote != "" {
+			if s.Quote != "" && !strings.EqualFold(s.Quote, sq.quote) {
+				continue
+			}
+			if s.Quote == "" && !strings.HasSuffix(s.Symbol, sq.quote) {
+				continue
+			}
+		}
+		switch {
+		case sq.q == "" || strings.HasPrefix(s.Symbol, sq.q):
+			prefix = append(prefix, s)
+		case strings.Contains(s.Symbol, sq.q):
+			rest = append(rest, s)
+		}
+	}
+	out := append(prefix, rest...)
+	if sq.limit > 0 && len(out) > sq.limit {
+		out = out[:sq.limit]
+	}
+	if out == nil {
+		out = []symbolInfo{}
+	}
+	return out
+}
+
+// render is the response body: plain symbol strings unless detailed.
+func (sq symbolQuery) render(syms []symbolInfo) any {
+	if sq.detailed {
+		return syms
+	}
+	return symbolNames(syms)
+}
+
+// streamSymbols turns the crypto-stream service's list into symbolInfo when
+// it is a list of strings, so the same search applies to it.
+func streamSymbols(payload any) ([]symbolInfo, bool) {
+	list, ok := payload.([]any)
+	if !ok {
+		return nil, false
+	}
+	out := make([]symbolInfo, 0, len(list))
+	for _, v := range list {
+		sym, ok := v.(string)
+		if !ok {
+			return nil, false
+		}
+		out = append(out, symbolInfo{Symbol: strings.ToUpper(sym)})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	return out, true
+}
+
+// newCryptoSymbolsHandler lists tradable symbols from the market data
+// providers, falling back to the crypto-stream service. q, quote and limit
+// narrow the list for autocomplete; detailed=true returns objects with the
+// base and quote assets and the exchange's status instead of strings.
+func newCryptoSymbolsHandler(cache *symbolsCache, cryptoStreamURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		sq := parseSymbolQuery(r)
+		// Prefer the exchange APIs to auto-populate symbols even if crypto-stream is absent.
+		if syms, provider, hit, err := cache.get(r.Context()); err == nil {
+			w.Header().Set("X-Source", provider)
+			if hit {
+				w.Header().Set("X-Cache", "hit")
+			} else {
+				w.Header().Set("X-Cache", "miss")
+			}
+			writeJSON(w, http.StatusOK, sq.render(sq.filter(syms)))
+			return
+		}
+		// Fallback to crypto-stream if available.
+		payload, source, err := fetchCryptoSymbols(r.Context(), cryptoStreamURL)
+		if err != nil {
+			writeJSON(w, http.StatusBadGateway, map[string]any{"error": "upstream_error", "upstream": source, "status": 0})
+			return
+		}
+		w.Header().Set("X-Source", source)
+		if source == "unavailable" {
+			w.Header().Set("X-Warning", "upstream_unavailable")
+		}
+		if syms, ok := streamSymbols(payload); ok {
+			writeJSON(w, http.StatusOK, sq.render(sq.filter(syms)))
+			return
+		}
+		writeJSON(w, http.StatusOK, payload)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// staticSymbolsProvider serves a fixed symbol list, or err when set.
+type staticSymbolsProvider struct {
+	syms  []symbolInfo
+	err   error
+	calls int
+}
+
+func (p *staticSymbolsProvider) Name() string { return "static" }
+
+func (p *staticSymbolsProvider) Tickers(context.Context) ([]binanceTicker, error) {
+	return nil, errors.New("unused")
+}
+
+func (p *staticSymbolsProvider) Symbols(context.Context) ([]symbolInfo, error) {
+	p.calls++
+	return p.syms, p.err
+}
+
+func getSymbols(t *testing.T, h http.Handler, target string, v any) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s: %v %s", target, err, rec.Body.String())
+		}
+	}
+	return rec
+}
+
+func TestCryptoSymbolsSearch(t *testing.T) {
+	p := &staticSymbolsProvider{syms: []symbolInfo{
+		{Symbol: "BTCUSDT", Base: "BTC", Quote: "USDT", Status: "TRADING"},
+		{Symbol: "ETHBTC", Base: "ETH", Quote: "BTC", Status: "TRADING"},
+		{Symbol: "ETHUSDT", Base: "ETH", Quote: "USDT", Status: "TRADING"},
+		{Symbol: "WETHUSDT", Base: "WETH", Quote: "USDT", Status: "TRADING"},
+	}}
+	orig := marketData
+	marketData = newMarketDataChain(p)
+	defer func() { marketData = orig }()
+	h := newCryptoSymbolsHandler(newSymbolsCache(time.Minute), "")
+
+	var plain []string
+	rec := getSymbols(t, h, "/api/crypto/symbols", &plain)
+	if !reflect.DeepEqual(plain, []string{"BTCUSDT", "ETHBTC", "ETHUSDT", "WETHUSDT"}) || rec.Header().Get("X-Source") != "static" {
+		t.Fatalf("plain list: %v %v", plain, rec.Header())
+	}
+	for target, want := range map[string][]string{
+		"/api/crypto/symbols?q=eth":                   {"ETHBTC", "ETHUSDT", "WETHUSDT"},
+		"/api/crypto/symbols?q=eth&quote=usdt":        {"ETHUSDT", "WETHUSDT"},
+		"/api/crypto/symbols?q=eth&limit=1":           {"ETHBTC"},
+		"/api/crypto/symbols?quote=BTC":               {"ETHBTC"},
+		"/api/crypto/symbols?q=doge":                  {},
+		"/api/crypto/symbols?q=USDT&quote=USDT&limit": {"BTCUSDT", "ETHUSDT", "WETHUSDT"},
+	} {
+		var got []string
+		getSymbols(t, h, target, &got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", target, got, want)
+		}
+	}
+
+	var detailed []symbolInfo
+	getSymbols(t, h, "/api/crypto/symbols?q=ethb&detailed=true", &detailed)
+	if !reflect.DeepEqual(detailed, []symbolInfo{{Symbol: "ETHBTC", Base: "ETH", Quote: "BTC", Status: "TRADING"}}) {
+		t.Fatalf("detailed: %+v", detailed)
+	}
+	if p.calls != 1 {
+		t.Fatalf("searches refetched the exchange info: %d calls", p.calls)
+	}
+}
+
+func TestSymbolsCacheRefreshesAfterTTL(t *testing.T) {
+	p := &staticSymbolsProvider{syms: []symbolInfo{{Symbol: "BTCUSDT"}}}
+	orig := marketData
+	marketData = newMarketDataChain(p)
+	defer func() { marketData = orig }()
+
+	c := newSymbolsCache(10 * time.Minute)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+	if _, _, hit, err := c.get(ctx); hit || err != nil {
+		t.Fatalf("first get: hit=%v %v", hit, err)
+	}
+	now = now.Add(9 * time.Minute)
+	if _, _, hit, _ := c.get(ctx); !hit || p.calls != 1 {
+		t.Fatalf("within ttl: hit=%v calls=%d", hit, p.calls)
+	}
+	now = now.Add(2 * time.Minute)
+	p.syms = []symbolInfo{{Symbol: "ETHUSDT"}}
+	if syms, _, hit, _ := c.get(ctx); hit || p.calls != 2 || syms[0].Symbol != "ETHUSDT" {
+		t.Fatalf("after ttl: %v hit=%v calls=%d", syms, hit, p.calls)
+	}
+	// A failed refresh keeps serving the last list.
+	now = now.Add(11 * time.Minute)
+	p.err = errors.New("down")
+	if syms, _, _, err := c.get(ctx); err != nil || syms[0].Symbol != "ETHUSDT" {
+		t.Fatalf("stale on error: %v %v", syms, err)
+	}
+}
+
+func TestCryptoSymbolsSearchesStreamFallback(t *testing.T) {
+	orig := marketData
+	marketData = newMarketDataChain(&staticSymbolsProvider{err: errors.New("down")})
+	defer func() { marketData = orig }()
+	stream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, []string{"ethusdt", "BTCUSDT", "ETHBTC"})
+	}))
+	defer stream.Close()
+
+	var got []string
+	rec := getSymbols(t, newCryptoSymbolsHandler(newSymbolsCache(time.Minute), stream.URL), "/api/crypto/symbols?q=ETH&quote=USDT", &got)
+	if rec.Header().Get("X-Source") != "crypto-stream" || !reflect.DeepEqual(got, []string{"ETHUSDT"}) {
+		t.Fatalf("fallback: %v %v", got, rec.Header())
+	}
+}
+
+func TestProviderSymbolMetadata(t *testing.T) {
+	srv := fixtureServer(t, map[string]string{
+		"/api/v3/exchangeInfo": "binance_exchange_info.json",
+		"/products":            "coinbase_products.json",
+		"/0/public/AssetPairs": "kraken_asset_pairs.json",
+	})
+	ctx := context.Background()
+	bn, _ := (&binanceProvider{baseURLs: []string{srv.URL}, client: srv.Client()}).Symbols(ctx)
+	cb, _ := (&coinbaseProvider{baseURL: srv.URL, client: srv.Client(), now: time.Now}).Symbols(ctx)
+	kr, _ := (&krakenProvider{baseURL: srv.URL, client: srv.Client(), now: time.Now}).Symbols(ctx)
+	for name, tc := range map[string]struct {
+		got  []symbolInfo
+		want symbolInfo
+	}{
+		"binance":  {bn, symbolInfo{Symbol: "BTCUSDT", Base: "BTC", Quote: "USDT", Status: "TRADING"}},
+		"coinbase": {cb, symbolInfo{Symbol: "BTCUSD", Base: "BTC", Quote: "USD", Status: "online"}},
+		"kraken":   {kr, symbolInfo{Symbol: "BTCUSD", Base: "BTC", Quote: "USD", Status: "online"}},
+	} {
+		if len(tc.got) == 0 || tc.got[0] != tc.want {
+			t.Errorf("%s: got %+v, want first %+v", name, tc.got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- /api/crypto/top ---
+
+// cryptoTopParams reads the query shared by /api/crypto/top and its
+// streams: limit (1-500, default 25), direction (default gainers), suffix
+// (default USDT) and min_quote_vol.
+func cryptoTopParams(r *http.Request) (limit int, direction, suffix string, minQuote float64) {
+	limit = clampInt(queryInt(r, "limit", 25), 1, 500)
+	direction = strings.ToLower(strings.TrimSpace(r.URL.Query().Get("direction")))
+	if direction == "" {
+		direction = "gainers"
+	}
+	suffix = strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("suffix")))
+	if suffix == "" {
+		suffix = "USDT"
+	}
+	return limit, direction, suffix, queryFloat(r, "min_quote_vol", 0)
+}
+
+// newCryptoTopHandler serves the top movers from the ticker cache refreshed
+// by startCryptoCacheLoop, falling back to a live provider fetch until the
+// cache has data. Each row, and the X-Source header, names the provider.
+// Cached responses carry a weak ETag so pollers get a 304 until the cache
+// refreshes.
+func newCryptoTopHandler(cache *cryptoCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		limit, direction, suffix, minQuote := cryptoTopParams(r)
+
+		ticks, updated, _ := cache.snapshot()
+		if len(ticks) == 0 {
+			rows, source, err := fetchMarketTop(r.Context(), limit, direction, suffix, minQuote)
+			if err != nil {
+				writeJSON(w, http.StatusBadGateway, map[string]any{"error": "upstream_error", "upstream": "market_data", "status": 0})
+				return
+			}
+			w.Header().Set("X-Source", source)
+			writeJSON(w, http.StatusOK, withRowSource(rows, source))
+			return
+		}
+		source := cache.currentSource()
+
+		stale, overdue := cryptoStaleSeconds(updated, time.Now())
+		etag := cryptoTopETag(updated, overdue, limit, direction, suffix, minQuote)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("X-Source", source)
+		w.Header().Set("Cache-Control", "no-cache")
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		rows := withRowSource(computeTopFromTickers(ticks, limit, direction, suffix, minQuote), source)
+		for i := range rows {
+			rows[i].StaleSeconds = stale
+		}
+		writeJSON(w, http.StatusOK, rows)
+	}
+}
+
+func withRowSource(rows []cryptoTopRow, source string) []cryptoTopRow {
+	for i := range rows {
+		rows[i].Source = source
+	}
+	return rows
+}
+
+// cryptoTopETag identifies one view of one cache generation: the refresh
+// time plus the normalized query parameters that shape the rows. The tag
+// changes once more when the generation turns stale, so pollers holding it
+// see stale_seconds appear.
+func cryptoTopETag(updated time.Time, stale bool, limit int, direction, suffix string, minQuote float64) string {
+	key := fmt.Sprintf("%d|%t|%d|%s|%s|%s", updated.UnixNano(), stale, limit, direction, suffix, strconv.FormatFloat(minQuote, 'g', -1, 64))
+	sum := sha256.Sum256([]byte(key))
+	return `W/"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// etagMatches applies the weak comparison of If-None-Match: any listed tag,
+// with or without the W/ prefix, or "*".
+func etagMatches(header, etag string) bool {
+	want := strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || (tag != "" && strings.TrimPrefix(tag, "W/") == want) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func seedCryptoCache(c *cryptoCache, updated time.Time) {
+	c.set([]binanceTicker{
+		{Symbol: "BTCUSDT", LastPrice: "100", PriceChangePercent: "5", QuoteVolume: "1000"},
+		{Symbol: "ETHUSDT", LastPrice: "10", PriceChangePercent: "-2", QuoteVolume: "500"},
+		{Symbol: "ETHBTC", LastPrice: "0.1", PriceChangePercent: "1", QuoteVolume: "50"},
+	}, "binance", "")
+	c.mu.Lock()
+	c.lastUpdated = updated
+	c.mu.Unlock()
+}
+
+func getCryptoTop(h http.Handler, target, ifNoneMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCryptoTopConditionalGet(t *testing.T) {
+	cache := &cryptoCache{}
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	seedCryptoCache(cache, t0)
+	h := newCryptoTopHandler(cache)
+
+	first := getCryptoTop(h, "/api/crypto/top?limit=5", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first GET: %d etag=%q", first.Code, etag)
+	}
+	var rows []cryptoTopRow
+	if err := json.Unmarshal(first.Body.Bytes(), &rows); err != nil || len(rows) != 2 || rows[0].Symbol != "BTCUSDT" || rows[0].Source != "binance" {
+		t.Fatalf("unexpected rows %s", first.Body.String())
+	}
+
+	again := getCryptoTop(h, "/api/crypto/top?limit=5", etag)
+	if again.Code != http.StatusNotModified || again.Body.Len() != 0 {
+		t.Fatalf("expected 304 with no body, got %d %q", again.Code, again.Body.String())
+	}
+	if got := getCryptoTop(h, "/api/crypto/top?limit=5", `"other", `+etag).Code; got != http.StatusNotModified {
+		t.Fatalf("a matching tag in a list should give 304, got %d", got)
+	}
+
+	for _, q := range []string{"limit=6", "limit=5&direction=losers", "limit=5&suffix=BTC", "limit=5&min_quote_vol=100"} {
+		rec := getCryptoTop(h, "/api/crypto/top?"+q, etag)
+		if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+			t.Fatalf("%s must not share the ETag of the default view: %d %s", q, rec.Code, rec.Header().Get("ETag"))
+		}
+	}
+
+	seedCryptoCache(cache, t0.Add(2*time.Second))
+	refreshed := getCryptoTop(h, "/api/crypto/top?limit=5", etag)
+	if refreshed.Code != http.StatusOK || refreshed.Header().Get("ETag") == etag {
+		t.Fatalf("ETag should change after a cache refresh: %d %s", refreshed.Code, refreshed.Header().Get("ETag"))
+	}
+}
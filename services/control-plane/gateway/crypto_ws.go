@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// --- /api/crypto/ws ---
+
+// cryptoStreamInterval is how often /api/crypto/stream and /api/crypto/ws
+// push a snapshot of the ticker cache.
+var cryptoStreamInterval = 2 * time.Second
+
+const (
+	cryptoWSWriteWait  = 10 * time.Second
+	cryptoWSPongWait   = 60 * time.Second
+	cryptoWSPingPeriod = cryptoWSPongWait * 9 / 10
+)
+
+// hijackWriter exposes the Hijacker of the connection underneath the
+// middleware's response writers, which only reach it through Unwrap.
+type hijackWriter struct{ http.ResponseWriter }
+
+func (h hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(h.ResponseWriter).Hijack()
+}
+
+// wsOriginAllowed is the Upgrader.CheckOrigin of the gateway's own
+// WebSockets. Browsers send an Origin, which must pass the CORS allowlist
+// when one is configured; other clients send none.
+func wsOriginAllowed(cors corsConfig) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		allow, _ := cors.allowOrigin(origin)
+		return allow != ""
+	}
+}
+
+// newCryptoWSHandler is /api/crypto/stream for clients that speak WebSocket
+// but not text/event-stream: every cryptoStreamInterval it sends one text
+// frame holding the same JSON as a "tickers" event, built from the same
+// cache, so it adds no upstream load. limit, direction, suffix and
+// min_quote_vol work as on /api/crypto/top.
+//
+// The server pings every cryptoWSPingPeriod and drops clients that stop
+// answering; anything the client sends is read and ignored so pongs and
+// close frames are seen. Origins are checked by wsOriginAllowed.
+func newCryptoWSHandler(cache *cryptoCache, cors corsConfig) http.HandlerFunc {
+	upgrader := websocket.Upgrader{CheckOrigin: wsOriginAllowed(cors)}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		if !isWebSocketUpgrade(r) {
+			w.Header().Set("Upgrade", "websocket")
+			w.Header().Set("Connection", "Upgrade")
+			writeJSON(w, http.StatusUpgradeRequired, map[string]any{"error": "websocket_upgrade_required"})
+			return
+		}
+		limit, direction, suffix, minQuote := cryptoTopParams(r)
+
+		conn, err := upgrader.Upgrade(hijackWriter{w}, r, nil)
+		if err != nil {
+			// Upgrade has already answered the client.
+			return
+		}
+		defer conn.Close()
+		defer metricsStreamOpen("crypto_ws")()
+
+		conn.SetReadLimit(4 << 10)
+		_ = conn.SetReadDeadline(time.Now().Add(cryptoWSPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(cryptoWSPongWait))
+		})
+		gone := make(chan struct{})
+		go func() {
+			defer close(gone)
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		send := func() error {
+			ticks, updated, errMsg := cache.snapshot()
+			rows := computeTopFromTickers(ticks, limit, direction, suffix, minQuote)
+			_ = conn.SetWriteDeadline(time.Now().Add(cryptoWSWriteWait))
+			return conn.WriteJSON(cryptoStreamPayload(rows, updated, errMsg, time.Now()))
+		}
+		if send() != nil {
+			return
+		}
+
+		ticker := time.NewTicker(cryptoStreamInterval)
+		defer ticker.Stop()
+		ping := time.NewTicker(cryptoWSPingPeriod)
+		defer ping.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				// Gateway shutdown: say goodbye before the connection drops.
+				msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "shutting down")
+				_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(cryptoWSWriteWait))
+				return
+			case <-gone:
+				return
+			case <-ticker.C:
+				if send() != nil {
+					return
+				}
+			case <-ping.C:
+				if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(cryptoWSWriteWait)) != nil {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCryptoWSStreamsFilteredFrames(t *testing.T) {
+	orig := cryptoStreamInterval
+	cryptoStreamInterval = 20 * time.Millisecond
+	defer func() { cryptoStreamInterval = orig }()
+
+	cache := &cryptoCache{}
+	seedCryptoCache(cache, time.Now())
+	// Through the logging middleware, whose writer only offers Hijack via Unwrap.
+	srv := httptest.NewServer(withLogging(newCryptoWSHandler(cache, corsConfig{}), newAuditStore(4)))
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/crypto/ws?direction=losers&suffix=usdt&limit=1"
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v %v", err, resp)
+	}
+	defer conn.Close()
+
+	for i := 0; i < 2; i++ {
+		var frame struct {
+			TS   string         `json:"ts"`
+			Rows []cryptoTopRow `json:"rows"`
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if frame.TS == "" || len(frame.Rows) != 1 || frame.Rows[0].Symbol != "ETHUSDT" {
+			t.Fatalf("frame %d: %+v", i, frame)
+		}
+	}
+
+	// The client going away ends the handler without waiting for a write to fail.
+	_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+func TestCryptoWSRejectsPlainRequestsAndForeignOrigins(t *testing.T) {
+	cache := &cryptoCache{}
+	h := newCryptoWSHandler(cache, parseCORSOrigins("https://app.example.com"))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/crypto/ws", nil))
+	if rec.Code != http.StatusUpgradeRequired || !strings.Contains(rec.Body.String(), "websocket_upgrade_required") {
+		t.Fatalf("plain GET: %d %s", rec.Code, rec.Body.String())
+	}
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/crypto/ws"
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.example.org"}})
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("foreign origin: %v %v", err, resp)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://app.example.com"}})
+	if err != nil {
+		t.Fatalf("allowed origin: %v", err)
+	}
+	conn.Close()
+}
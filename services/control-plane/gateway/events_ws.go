@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// --- /api/ws ---
+
+// defaultEventsWSQueue is how many events a /api/ws client may fall behind
+// by before the oldest are dropped, when EVENTS_WS_QUEUE is unset.
+const defaultEventsWSQueue = 64
+
+// wsEventFrame is one sseHub event as a /api/ws text frame. Data is the
+// event's JSON payload, embedded rather than quoted.
+type wsEventFrame struct {
+	ID    int64           `json:"id,omitempty"`
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+func newWSEventFrame(ev sseEvent) wsEventFrame {
+	data := json.RawMessage(ev.Data)
+	if !json.Valid(data) {
+		data = json.RawMessage("null")
+	}
+	return wsEventFrame{ID: ev.ID, Event: ev.Event, Data: data}
+}
+
+// wsSendQueue holds the events waiting to be written to one WebSocket. It is
+// bounded: once max events wait, each new one pushes out the oldest, so a
+// slow client sees the latest state rather than a backlog.
+type wsSendQueue struct {
+	mu      sync.Mutex
+	events  []sseEvent
+	max     int
+	dropped int
+	ready   chan struct{}
+}
+
+func newWSSendQueue(max int) *wsSendQueue {
+	if max < 1 {
+		max = defaultEventsWSQueue
+	}
+	return &wsSendQueue{max: max, ready: make(chan struct{}, 1)}
+}
+
+func (q *wsSendQueue) push(ev sseEvent) {
+	q.mu.Lock()
+	if len(q.events) >= q.max {
+		q.events = q.events[1:]
+		q.dropped++
+	}
+	q.events = append(q.events, ev)
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// take empties the queue and returns what was in it, oldest first.
+func (q *wsSendQueue) take() []sseEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := q.events
+	q.events = nil
+	return out
+}
+
+func (q *wsSendQueue) droppedCount() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// newEventsWSHandler is /api/events for clients that cannot consume
+// server-sent events: the same hub events, heartbeat on connect included,
+// one JSON text frame {id, event, data} each. ?last_event_id= replays what
+// the hub still buffers after that id, as Last-Event-ID does on
+// /api/events.
+//
+// Hub events are taken off the hub as they arrive and queued per
+// connection, at most queueSize of them, dropping the oldest; a stalled
+// client never holds up the hub. When the hub closes for shutdown the
+// queued events, the "shutdown" one included, are written before a
+// going-away close frame.
+func newEventsWSHandler(hub *sseHub, heartbeat func(context.Context) sseEvent, cors corsConfig, queueSize int) http.HandlerFunc {
+	upgrader := websocket.Upgrader{CheckOrigin: wsOriginAllowed(cors)}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		if !isWebSocketUpgrade(r) {
+			w.Header().Set("Upgrade", "websocket")
+			w.Header().Set("Connection", "Upgrade")
+			writeJSON(w, http.StatusUpgradeRequired, map[string]any{"error": "websocket_upgrade_required"})
+			return
+		}
+		lastID := parseLastEventID(r.URL.Query().Get("last_event_id"))
+
+		conn, err := upgrader.Upgrade(hijackWriter{w}, r, nil)
+		if err != nil {
+			// Upgrade has already answered the client.
+			return
+		}
+		defer conn.Close()
+		defer metricsStreamOpen("events_ws")()
+
+		rid := strings.TrimSpace(r.Header.Get("X-Request-ID"))
+		slog.Info("ws_connect", "path", r.URL.Path, "request_id", rid, "last_event_id", lastID)
+
+		write := func(ev sseEvent) error {
+			_ = conn.SetWriteDeadline(time.Now().Add(cryptoWSWriteWait))
+			return conn.WriteJSON(newWSEventFrame(ev))
+		}
+		goingAway := func(reason string) {
+			msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, reason)
+			_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(cryptoWSWriteWait))
+		}
+
+		ch := make(chan sseEvent, 16)
+		client := hub.addClient(ch, func() { _ = conn.UnderlyingConn().SetWriteDeadline(time.Now()) })
+		defer hub.removeClient(ch)
+
+		// Registered before the replay is read so nothing published in
+		// between is lost; a duplicate from the overlap is skipped below.
+		replayed := lastID
+		for _, ev := range hub.replaySince(lastID) {
+			if write(ev) != nil {
+				return
+			}
+			replayed = ev.ID
+		}
+		if write(heartbeat(r.Context())) != nil {
+			return
+		}
+
+		queue := newWSSendQueue(queueSize)
+		done := make(chan struct{})
+		defer close(done)
+		hubClosed := make(chan struct{})
+		go func() {
+			defer close(hubClosed)
+			for {
+				select {
+				case <-done:
+					return
+				case ev, ok := <-ch:
+					if !ok {
+						return
+					}
+					client.drained(time.Now())
+					if ev.ID > replayed {
+						queue.push(ev)
+					}
+				}
+			}
+		}()
+
+		conn.SetReadLimit(4 << 10)
+		_ = conn.SetReadDeadline(time.Now().Add(cryptoWSPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(cryptoWSPongWait))
+		})
+		gone := make(chan struct{})
+		go func() {
+			defer close(gone)
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+		defer func() {
+			slog.Info("ws_disconnect", "path", r.URL.Path, "request_id", rid, "dropped", queue.droppedCount())
+		}()
+
+		flush := func() error {
+			for _, ev := range queue.take() {
+				if err := write(ev); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		ping := time.NewTicker(cryptoWSPingPeriod)
+		defer ping.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				goingAway("shutting down")
+				return
+			case <-gone:
+				return
+			case <-hubClosed:
+				// Swept or closed for shutdown; hand over what is queued first.
+				if flush() == nil {
+					goingAway("closed")
+				}
+				return
+			case <-queue.ready:
+				if flush() != nil {
+					return
+				}
+			case <-ping.C:
+				if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(cryptoWSWriteWait)) != nil {
+					return
+				}
+			}
+		}
+	}
+}
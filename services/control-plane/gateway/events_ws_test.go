@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func readWSEvent(t *testing.T, conn *websocket.Conn) wsEventFrame {
+	t.Helper()
+	var f wsEventFrame
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(&f); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	return f
+}
+
+func eventsWSStreams() int {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	return metricsStreams["events_ws"]
+}
+
+func TestEventsWSHeartbeatAndResume(t *testing.T) {
+	hub := newSSEHub(16)
+	heartbeat := func(context.Context) sseEvent {
+		return sseEvent{Event: "heartbeat", Data: `{"status":"ok"}`}
+	}
+	srv := httptest.NewServer(withLogging(newEventsWSHandler(hub, heartbeat, corsConfig{}, 8), newAuditStore(4)))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/ws"
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v %v", err, resp)
+	}
+	if f := readWSEvent(t, conn); f.Event != "heartbeat" || f.ID != 0 || string(f.Data) != `{"status":"ok"}` {
+		t.Fatalf("first frame: %+v", f)
+	}
+	if n := eventsWSStreams(); n != 1 {
+		t.Fatalf("events_ws streams = %d", n)
+	}
+	hub.publish("tick", map[string]int{"n": 1})
+	hub.publish("tick", map[string]int{"n": 2})
+	for _, want := range []int64{1, 2} {
+		if f := readWSEvent(t, conn); f.ID != want || f.Event != "tick" {
+			t.Fatalf("want id %d, got %+v", want, f)
+		}
+	}
+	conn.Close()
+
+	// Missed while away, then replayed on reconnect before the heartbeat.
+	hub.publish("results", map[string]int{"n": 3})
+	hub.publish("insights", map[string]int{"n": 4})
+	conn, _, err = websocket.DefaultDialer.Dial(url+"?last_event_id=2", nil)
+	if err != nil {
+		t.Fatalf("redial: %v", err)
+	}
+	defer conn.Close()
+	var got []string
+	for i := 0; i < 3; i++ {
+		f := readWSEvent(t, conn)
+		got = append(got, f.Event+":"+string(f.Data))
+	}
+	want := []string{`results:{"n":3}`, `insights:{"n":4}`, `heartbeat:{"status":"ok"}`}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("resume: %v, want %v", got, want)
+	}
+	hub.publish("tick", map[string]int{"n": 5})
+	if f := readWSEvent(t, conn); f.ID != 5 {
+		t.Fatalf("live after resume: %+v", f)
+	}
+
+	// Shutdown hands over the shutdown event, then closes going away.
+	hub.close()
+	if f := readWSEvent(t, conn); f.Event != "shutdown" {
+		t.Fatalf("shutdown frame: %+v", f)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) || ce.Code != websocket.CloseGoingAway {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+func TestWSSendQueueDropsOldest(t *testing.T) {
+	q := newWSSendQueue(3)
+	for i := int64(1); i <= 5; i++ {
+		q.push(sseEvent{ID: i})
+	}
+	var ids []int64
+	for _, ev := range q.take() {
+		ids = append(ids, ev.ID)
+	}
+	if !reflect.DeepEqual(ids, []int64{3, 4, 5}) || q.droppedCount() != 2 {
+		t.Fatalf("queue kept %v, dropped %d", ids, q.droppedCount())
+	}
+	if len(q.take()) != 0 {
+		t.Fatal("take did not empty the queue")
+	}
+}
+
+func TestEventsWSRequiresUpgrade(t *testing.T) {
+	h := newEventsWSHandler(newSSEHub(4), nil, corsConfig{}, 0)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/ws", nil))
+	if rec.Code != http.StatusUpgradeRequired || !strings.Contains(rec.Body.String(), "websocket_upgrade_required") {
+		t.Fatalf("plain GET: %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// --- Sparse fieldsets ---
+
+const (
+	// Responses larger than this are passed through unfiltered rather than
+	// held in memory to be pruned.
+	maxFieldFilterBytes = 4 << 20
+	maxFieldPaths       = 64
+)
+
+// fieldTree is the set of requested dot paths. A nil subtree keeps the
+// whole value at that key.
+type fieldTree map[string]fieldTree
+
+// parseFieldPaths reads "a,b.c,rows.symbol" into a fieldTree. Requesting a
+// parent ("b") after one of its children ("b.c") widens it to all of b.
+func parseFieldPaths(raw string) fieldTree {
+	tree := fieldTree{}
+	n := 0
+	for _, p := range strings.Split(raw, ",") {
+		p = strings.Trim(strings.TrimSpace(p), ".")
+		if p == "" {
+			continue
+		}
+		if n++; n > maxFieldPaths {
+			break
+		}
+		node := tree
+		parts := strings.Split(p, ".")
+		for i, part := range parts {
+			child, seen := node[part]
+			if seen && child == nil {
+				break // an ancestor is already kept whole
+			}
+			if i == len(parts)-1 {
+				node[part] = nil
+				break
+			}
+			if child == nil {
+				child = fieldTree{}
+				node[part] = child
+			}
+			node = child
+		}
+	}
+	return tree
+}
+
+// pruneFields keeps only the requested keys of objects. Arrays are
+// transparent: the tree applies to each element, so "rows.symbol" keeps the
+// symbol of every row. Unknown keys are ignored, and a requested path that
+// runs into a scalar drops it.
+func pruneFields(v any, tree fieldTree) any {
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(tree))
+		for k, sub := range tree {
+			child, ok := val[k]
+			if !ok {
+				continue
+			}
+			if sub == nil {
+				out[k] = child
+				continue
+			}
+			switch child.(type) {
+			case map[string]any, []any:
+				out[k] = pruneFields(child, sub)
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, 0, len(val))
+		for _, e := range val {
+			switch e.(type) {
+			case map[string]any, []any:
+				out = append(out, pruneFields(e, tree))
+			}
+		}
+		return out
+	}
+	return v
+}
+
+// withFieldFilter prunes JSON responses to the paths in ?fields=. It buffers
+// the response only once it is known to be uncompressed JSON with a 2xx
+// status; streams, errors, other content types and bodies over
+// maxFieldFilterBytes are written through untouched. The pruned body is
+// written plain, and withGzip, outside it, decides on compression.
+func withFieldFilter(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := r.URL.Query().Get("fields")
+		if strings.TrimSpace(raw) == "" || r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		tree := parseFieldPaths(raw)
+		// The handler, or the upstream behind it, must produce plain JSON
+		// for us to prune.
+		r = r.Clone(r.Context())
+		r.Header.Del("Accept-Encoding")
+		// A pruned body is a different representation: its ETag carries a
+		// suffix for the field set, stripped again on If-None-Match so the
+		// handler can still answer 304. Bodies passed through unpruned keep
+		// the handler's ETag.
+		etagSuffix := "-f" + sha256Hex([]byte(raw))[:8]
+		if inm := r.Header.Get("If-None-Match"); inm != "" {
+			r.Header.Set("If-None-Match", strings.ReplaceAll(inm, etagSuffix+`"`, `"`))
+		}
+
+		fw := &fieldFilterWriter{ResponseWriter: w, etagSuffix: etagSuffix}
+		next.ServeHTTP(fw, r)
+		if fw.passthrough {
+			return
+		}
+		if !fw.wroteHeader {
+			fw.status = http.StatusOK
+		}
+		body := fw.buf.Bytes()
+		var v any
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err == nil {
+			var out bytes.Buffer
+			enc := json.NewEncoder(&out)
+			enc.SetEscapeHTML(false)
+			if enc.Encode(pruneFields(v, tree)) == nil {
+				body = out.Bytes()
+				fw.suffixETag()
+			}
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(fw.status)
+		_, _ = w.Write(body)
+	})
+}
+
+type fieldFilterWriter struct {
+	http.ResponseWriter
+	etagSuffix  string
+	status      int
+	wroteHeader bool
+	passthrough bool
+	buf         bytes.Buffer
+}
+
+func (fw *fieldFilterWriter) WriteHeader(status int) {
+	if fw.wroteHeader {
+		return
+	}
+	fw.wroteHeader = true
+	fw.status = status
+	h := fw.Header()
+	if status == http.StatusNotModified {
+		// The client holds the pruned body it was validating.
+		fw.suffixETag()
+	}
+	ct := strings.ToLower(h.Get("Content-Type"))
+	if status/100 != 2 || !strings.HasPrefix(ct, "application/json") || h.Get("Content-Encoding") != "" {
+		fw.passthrough = true
+		fw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (fw *fieldFilterWriter) suffixETag() {
+	h := fw.Header()
+	if etag := h.Get("ETag"); strings.HasSuffix(etag, `"`) {
+		h.Set("ETag", strings.TrimSuffix(etag, `"`)+fw.etagSuffix+`"`)
+	}
+}
+
+func (fw *fieldFilterWriter) Write(b []byte) (int, error) {
+	if !fw.wroteHeader {
+		fw.WriteHeader(http.StatusOK)
+	}
+	if fw.passthrough {
+		return fw.ResponseWriter.Write(b)
+	}
+	if fw.buf.Len()+len(b) > maxFieldFilterBytes {
+		// Too large to hold: send what we have unfiltered and stream the rest.
+		fw.passthrough = true
+		fw.ResponseWriter.WriteHeader(fw.status)
+		if _, err := fw.ResponseWriter.Write(fw.buf.Bytes()); err != nil {
+			return 0, err
+		}
+		fw.buf.Reset()
+		return fw.ResponseWriter.Write(b)
+	}
+	return fw.buf.Write(b)
+}
+
+// Flush only reaches the client for passthrough responses; buffered JSON is
+// written in one piece once the handler returns.
+func (fw *fieldFilterWriter) Flush() {
+	if !fw.wroteHeader {
+		fw.WriteHeader(http.StatusOK)
+	}
+	if !fw.passthrough {
+		return
+	}
+	if f, ok := fw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (fw *fieldFilterWriter) Unwrap() http.ResponseWriter {
+	return fw.ResponseWriter
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPruneFields(t *testing.T) {
+	doc := `{
+		"version": "v1",
+		"count": 2,
+		"meta": {"source": "binance", "updated": "2026-01-01T00:00:00Z", "limits": {"max": 500, "min": 1}},
+		"rows": [
+			{"symbol": "BTCUSDT", "price": 1.5, "stats": {"high": 2, "low": 1}},
+			{"symbol": "ETHUSDT", "price": 0.5, "stats": {"high": 3, "low": 0}},
+			"not-an-object"
+		],
+		"empty": []
+	}`
+	cases := []struct {
+		name, fields, want string
+	}{
+		{"top level", "version,count", `{"count":2,"version":"v1"}`},
+		{"nested path", "meta.source,meta.limits.max", `{"meta":{"limits":{"max":500},"source":"binance"}}`},
+		{"arrays of objects", "rows.symbol,rows.stats.high", `{"rows":[{"stats":{"high":2},"symbol":"BTCUSDT"},{"stats":{"high":3},"symbol":"ETHUSDT"}]}`},
+		{"parent widens child", "meta.source,meta", `{"meta":{"limits":{"max":500,"min":1},"source":"binance","updated":"2026-01-01T00:00:00Z"}}`},
+		{"child after parent", "meta,meta.source", `{"meta":{"limits":{"max":500,"min":1},"source":"binance","updated":"2026-01-01T00:00:00Z"}}`},
+		{"unknown fields ignored", "nope,rows.nope,count", `{"count":2,"rows":[{},{}]}`},
+		{"path through scalar", "version.major", `{}`},
+		{"empty array kept", "empty.id", `{"empty":[]}`},
+		{"blank entries", " , count ,.", `{"count":2}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var v any
+			if err := json.Unmarshal([]byte(doc), &v); err != nil {
+				t.Fatal(err)
+			}
+			got, _ := json.Marshal(pruneFields(v, parseFieldPaths(tc.fields)))
+			if string(got) != tc.want {
+				t.Fatalf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+
+	var arr any
+	_ = json.Unmarshal([]byte(`[{"id":"a","name":"A"},{"id":"b"}]`), &arr)
+	if got, _ := json.Marshal(pruneFields(arr, parseFieldPaths("name"))); string(got) != `[{"name":"A"},{}]` {
+		t.Fatalf("top-level array: %s", got)
+	}
+}
+
+func TestWithFieldFilter(t *testing.T) {
+	payload := map[string]any{
+		"count": 1,
+		"rows":  []map[string]any{{"symbol": "BTCUSDT", "price": 123456789.123456789, "volume": 42}},
+	}
+	h := withFieldFilter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("ETag", `W/"gen-1"`)
+			if etagMatches(r.Header.Get("If-None-Match"), `W/"gen-1"`) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			writeJSON(w, http.StatusOK, payload)
+		case "/error":
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "bad", "detail": "x"})
+		case "/stream":
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.(http.Flusher).Flush()
+			_, _ = io.WriteString(w, "data: {\"a\":1}\n\n")
+		case "/big":
+			w.Header().Set("ETag", `"big-1"`)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `{"pad":"`+strings.Repeat("x", maxFieldFilterBytes)+`","keep":1}`)
+		}
+	}))
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/json?fields=rows.symbol,rows.price", "")
+	if got := strings.TrimSpace(rec.Body.String()); got != `{"rows":[{"price":123456789.12345679,"symbol":"BTCUSDT"}]}` {
+		t.Fatalf("filtered body: %s", got)
+	}
+	if rec.Header().Get("Content-Length") != "" && rec.Header().Get("Content-Length") != strconv.Itoa(rec.Body.Len()) {
+		t.Fatalf("stale Content-Length %s for %d bytes", rec.Header().Get("Content-Length"), rec.Body.Len())
+	}
+
+	etag := rec.Header().Get("ETag")
+	if etag == `W/"gen-1"` || !strings.HasPrefix(etag, `W/"gen-1-f`) {
+		t.Fatalf("filtered ETag %q must differ from the full body's", etag)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/json?fields=rows.symbol,rows.price", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified || rec.Header().Get("ETag") != etag {
+		t.Fatalf("If-None-Match with the filtered ETag: %d %q", rec.Code, rec.Header().Get("ETag"))
+	}
+
+	// Compression is left to withGzip, which sees the pruned size.
+	if rec := get("/json?fields=count", "gzip"); rec.Header().Get("Content-Encoding") != "" || strings.TrimSpace(rec.Body.String()) != `{"count":1}` {
+		t.Fatalf("field filter must write plain JSON: %v %q", rec.Header(), rec.Body.String())
+	}
+	viaGzip := func(minBytes int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/json?fields=count", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		withGzip(minBytes)(h).ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := viaGzip(defaultGzipMinBytes); rec.Header().Get("Content-Encoding") != "" || strings.Join(rec.Header().Values("Vary"), ",") != "Accept-Encoding" {
+		t.Fatalf("small pruned body must stay plain with one Vary: %v", rec.Header())
+	}
+	rec = viaGzip(1)
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("gzip not applied: %v", rec.Header())
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(zr); strings.TrimSpace(string(b)) != `{"count":1}` {
+		t.Fatalf("gzip body: %s", b)
+	}
+
+	if rec := get("/json?fields=nothing", ""); strings.TrimSpace(rec.Body.String()) != `{}` || rec.Code != http.StatusOK {
+		t.Fatalf("no matching fields: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := get("/json", ""); !strings.Contains(rec.Body.String(), `"volume":42`) {
+		t.Fatalf("no fields param must not filter: %s", rec.Body.String())
+	}
+	if rec := get("/error?fields=count", ""); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"detail"`) {
+		t.Fatalf("errors pass through unfiltered: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := get("/stream?fields=a", ""); !strings.HasPrefix(rec.Body.String(), "data: ") || !rec.Flushed {
+		t.Fatalf("streams pass through: %q flushed=%v", rec.Body.String(), rec.Flushed)
+	}
+	if rec := get("/big?fields=keep", ""); rec.Body.Len() <= maxFieldFilterBytes || rec.Header().Get("ETag") != `"big-1"` {
+		t.Fatalf("oversized body should pass through unfiltered with its ETag, got %d bytes, ETag %q", rec.Body.Len(), rec.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import "time"
+
+// --- Data freshness ---
+
+const (
+	dataStatusLive  = "live"
+	dataStatusStale = "stale"
+	dataStatusNever = "never"
+)
+
+const (
+	// cryptoStaleAfter is a few missed refreshes of startCryptoCacheLoop.
+	cryptoStaleAfter = 10 * time.Second
+	// healthStaleAfter is a few missed heartbeats of startEventLoops.
+	healthStaleAfter = 10 * time.Second
+	// resultsStaleAfter matches the window the live wall reports on.
+	resultsStaleAfter = 30 * time.Minute
+)
+
+// freshness says how old cache-backed data is. updated_at and age_ms are
+// left out entirely when the data has never been fetched, so clients never
+// see a zero time.
+type freshness struct {
+	UpdatedAt  string `json:"updated_at,omitempty"`
+	AgeMs      *int64 `json:"age_ms,omitempty"`
+	DataStatus string `json:"data_status"`
+}
+
+// freshnessAt computes the age of data last updated at updated. Times taken
+// from time.Now in this process keep their monotonic reading, so the age is
+// immune to wall clock steps; upstream timestamps ahead of our clock count
+// as age 0.
+func freshnessAt(updated time.Time, staleAfter time.Duration, now time.Time) freshness {
+	if updated.IsZero() {
+		return freshness{DataStatus: dataStatusNever}
+	}
+	age := now.Sub(updated)
+	if age < 0 {
+		age = 0
+	}
+	ms := age.Milliseconds()
+	status := dataStatusLive
+	if age > staleAfter {
+		status = dataStatusStale
+	}
+	return freshness{UpdatedAt: updated.UTC().Format(time.RFC3339), AgeMs: &ms, DataStatus: status}
+}
+
+// apply sets the freshness fields on a map payload, removing updated_at and
+// age_ms when the data has never been fetched.
+func (f freshness) apply(payload map[string]any) {
+	payload["data_status"] = f.DataStatus
+	if f.AgeMs == nil {
+		delete(payload, "updated_at")
+		delete(payload, "age_ms")
+		return
+	}
+	payload["updated_at"] = f.UpdatedAt
+	payload["age_ms"] = *f.AgeMs
+}
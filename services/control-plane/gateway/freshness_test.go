@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// assertNeverFetched checks a payload carries no timestamp fields at all.
+func assertNeverFetched(t *testing.T, payload map[string]any, aliases ...string) {
+	t.Helper()
+	if payload["data_status"] != dataStatusNever {
+		t.Fatalf("data_status = %v, want never", payload["data_status"])
+	}
+	for _, k := range append([]string{"updated_at", "age_ms"}, aliases...) {
+		if v, ok := payload[k]; ok {
+			t.Fatalf("never-fetched payload has %s=%v", k, v)
+		}
+	}
+}
+
+// roundTrip marshals v and decodes it back as a JSON object.
+func roundTrip(t *testing.T, v any) map[string]any {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]any
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestFreshnessAt(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	if f := freshnessAt(time.Time{}, time.Minute, now); f.DataStatus != dataStatusNever || f.AgeMs != nil || f.UpdatedAt != "" {
+		t.Fatalf("zero time: %+v", f)
+	}
+	f := freshnessAt(now.Add(-1500*time.Millisecond), time.Minute, now)
+	if f.DataStatus != dataStatusLive || *f.AgeMs != 1500 || f.UpdatedAt != "2026-01-01T11:59:58Z" {
+		t.Fatalf("live: %+v", f)
+	}
+	if f := freshnessAt(now.Add(-2*time.Minute), time.Minute, now); f.DataStatus != dataStatusStale {
+		t.Fatalf("stale: %+v", f)
+	}
+	if f := freshnessAt(now.Add(time.Hour), time.Minute, now); *f.AgeMs != 0 || f.DataStatus != dataStatusLive {
+		t.Fatalf("a timestamp ahead of our clock must not give a negative age: %+v", f)
+	}
+}
+
+func TestCryptoStreamFreshness(t *testing.T) {
+	cache := &cryptoCache{}
+	ticks, updated, _ := cache.snapshot()
+	assertNeverFetched(t, roundTrip(t, cryptoStreamPayload(computeTopFromTickers(ticks, 5, "gainers", "USDT", 0), updated, "", time.Now())), "updated")
+
+	// A failed refresh keeps the last good tickers, which then go stale.
+	seedCryptoCache(cache, time.Now())
+	cache.set(nil, "", "non_2xx")
+	ticks, updated, errMsg := cache.snapshot()
+	if len(ticks) != 3 || errMsg != "non_2xx" {
+		t.Fatalf("failed refresh dropped the cache: %d tickers, err %q", len(ticks), errMsg)
+	}
+	live := roundTrip(t, cryptoStreamPayload(nil, updated, errMsg, time.Now()))
+	if live["data_status"] != dataStatusLive || live["updated"] != live["updated_at"] || live["error"] != "non_2xx" {
+		t.Fatalf("live payload: %v", live)
+	}
+	stale := roundTrip(t, cryptoStreamPayload(nil, updated, errMsg, updated.Add(cryptoStaleAfter+time.Second)))
+	if stale["data_status"] != dataStatusStale || stale["age_ms"].(float64) < float64(cryptoStaleAfter.Milliseconds()) {
+		t.Fatalf("stale payload: %v", stale)
+	}
+}
+
+func TestHealthSnapshotFreshness(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := newHealthCache()
+	h.now = func() time.Time { return now }
+
+	assertNeverFetched(t, roundTrip(t, h.get()), "checked_at")
+
+	h.update(map[string]serviceDetail{"registry": {Status: "up"}})
+	live := roundTrip(t, h.get())
+	if live["data_status"] != dataStatusLive || live["age_ms"] != float64(0) || live["checked_at"] != live["updated_at"] {
+		t.Fatalf("fresh snapshot: %v", live)
+	}
+	now = now.Add(healthStaleAfter + time.Second)
+	if stale := roundTrip(t, h.get()); stale["data_status"] != dataStatusStale || stale["age_ms"] != float64(11000) {
+		t.Fatalf("stale snapshot: %v", stale)
+	}
+}
+
+func TestSummaryFreshness(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	empty := map[string]any{"total_results": 0, "updated_at": "stale value", "age_ms": int64(5)}
+	applySummaryFreshness(empty, now)
+	assertNeverFetched(t, empty)
+
+	data := map[string]any{"updated_at": "2025-12-31T23:00:00Z", "last_updated": "2025-12-31T23:00:00Z"}
+	applySummaryFreshness(data, now)
+	if data["data_status"] != dataStatusStale || data["age_ms"] != int64(time.Hour/time.Millisecond) {
+		t.Fatalf("stale summary: %v", data)
+	}
+	// Serving from the cache later recomputes the age.
+	applySummaryFreshness(data, now.Add(time.Minute))
+	if data["age_ms"] != int64(61*time.Minute/time.Millisecond) {
+		t.Fatalf("age not recomputed: %v", data)
+	}
+}
+
+func TestLiveCryptoWallFreshness(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 30, 0, 0, time.UTC)
+	rows := []aggResult{
+		{ID: "1", Timestamp: "2026-01-01T00:29:00Z", Data: map[string]any{"symbol": "BTCUSDT", "c": 101.0}},
+		{ID: "2", Timestamp: "2026-01-01T00:20:00Z", Data: map[string]any{"symbol": "BTCUSDT", "c": 100.0}},
+		{ID: "3", Data: map[string]any{"symbol": "ETHUSDT", "c": 10.0}},
+	}
+	agg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(rows)
+	}))
+	defer agg.Close()
+
+	payload, err := buildLiveCryptoWallAt(context.Background(), agg.URL, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := roundTrip(t, payload)
+	if out["data_status"] != dataStatusLive || out["updated_at"] != "2026-01-01T00:29:00Z" || out["age_ms"] != float64(60000) {
+		t.Fatalf("wall freshness: %v", out)
+	}
+	got := out["rows"].([]any)
+	btc, eth := got[0].(map[string]any), got[1].(map[string]any)
+	if btc["price"] != 101.0 || btc["updated_at"] != "2026-01-01T00:29:00Z" || btc["updated"] != btc["updated_at"] {
+		t.Fatalf("newest row must win: %v", btc)
+	}
+	for _, k := range []string{"updated_at", "age_ms", "updated"} {
+		if _, ok := eth[k]; ok {
+			t.Fatalf("row without a timestamp reports %s: %v", k, eth)
+		}
+	}
+
+	payload, err = buildLiveCryptoWallAt(context.Background(), agg.URL, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload["data_status"] != dataStatusStale {
+		t.Fatalf("an hour later the wall should be stale: %v", payload["data_status"])
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckAllDetailedIsConcurrentAndBounded(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	targets := healthTargets{
+		"registry":      slow.URL,
+		"aggregator":    slow.URL,
+		"coordinator":   slow.URL,
+		"reporter":      up.URL,
+		"analytics":     up.URL,
+		"crypto_stream": up.URL,
+		"storage":       up.URL + "/",
+	}
+	start := time.Now()
+	out := checkAllDetailed(context.Background(), targets)
+	if elapsed := time.Since(start); elapsed > healthProbeTimeout+time.Second {
+		t.Fatalf("three hung upstreams took %s; probes must run concurrently", elapsed)
+	}
+	if out.Status != "degraded" || len(out.Services) != len(targets) {
+		t.Fatalf("unexpected result: %+v", out)
+	}
+	if d := out.Services["registry"]; d.Status != "down" || d.Error != "timeout" {
+		t.Fatalf("slow upstream: %+v", d)
+	}
+	if d := out.Services["storage"]; d.Status != "up" {
+		t.Fatalf("storage: %+v", d)
+	}
+}
+
+func TestLoadHealthTargetsOptionalServices(t *testing.T) {
+	t.Setenv("AUTH_URL", "")
+	t.Setenv("OBSERVER_URL", "http://observer:8086")
+	targets := loadHealthTargets("r", "a", "c", "rep", "ana", "cs")
+	if _, ok := targets["auth"]; ok {
+		t.Fatal("auth should only be probed when AUTH_URL is set")
+	}
+	if targets["observer"] != "http://observer:8086" || targets["storage"] == "" || targets["crypto_stream"] != "cs" {
+		t.Fatalf("unexpected targets: %v", targets)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- HS256 secret rotation ---
+
+const (
+	defaultHS256SecretTTL   = 30 * time.Second
+	defaultHS256SecretGrace = 5 * time.Minute
+)
+
+// hs256SecretCache re-reads AUTH_JWT_HS256_SECRET_FILE like apiKeyFileCache
+// does the key file: at most once per ttl, and only when its mtime changed.
+// After a rotation the previous secret keeps verifying for grace, so tokens
+// signed just before the switch are not rejected.
+type hs256SecretCache struct {
+	mu        sync.Mutex
+	path      string
+	ttl       time.Duration
+	grace     time.Duration
+	last      time.Time
+	modTime   time.Time
+	current   string
+	previous  string
+	rotatedAt time.Time
+	now       func() time.Time
+}
+
+func newHS256SecretCache(path string, ttl, grace time.Duration) *hs256SecretCache {
+	c := &hs256SecretCache{path: path, ttl: ttl, grace: grace, now: time.Now}
+	c.mu.Lock()
+	c.refreshLocked()
+	c.mu.Unlock()
+	return c
+}
+
+// secrets returns the current secret, then the previous one while it is
+// inside the grace window. An unreadable or empty file keeps the secrets
+// already loaded.
+func (c *hs256SecretCache) secrets() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshLocked()
+	var out []string
+	if c.current != "" {
+		out = append(out, c.current)
+	}
+	if c.previous != "" && c.now().Sub(c.rotatedAt) < c.grace {
+		out = append(out, c.previous)
+	}
+	return out
+}
+
+func (c *hs256SecretCache) refreshLocked() {
+	now := c.now()
+	if !c.last.IsZero() && now.Sub(c.last) < c.ttl {
+		return
+	}
+	c.last = now
+	fi, err := os.Stat(c.path)
+	if err != nil {
+		slog.Warn("hs256_secret_unreadable", "path", c.path, "err", err)
+		return
+	}
+	if c.modTime.Equal(fi.ModTime()) {
+		return
+	}
+	b, err := os.ReadFile(c.path)
+	if err != nil {
+		slog.Warn("hs256_secret_unreadable", "path", c.path, "err", err)
+		return
+	}
+	c.modTime = fi.ModTime()
+	secret := strings.TrimSpace(string(b))
+	if secret == "" {
+		slog.Warn("hs256_secret_empty", "path", c.path)
+		return
+	}
+	if secret == c.current {
+		return
+	}
+	if c.current != "" {
+		c.previous = c.current
+		c.rotatedAt = now
+		slog.Info("hs256_secret_rotated", "path", c.path, "grace", c.grace.String())
+	}
+	c.current = secret
+}
+
+// hs256Secrets returns the secrets an HS256 token may be signed with.
+func (cfg *authConfig) hs256Secrets() []string {
+	if cfg.HS256Cache != nil {
+		return cfg.HS256Cache.secrets()
+	}
+	if cfg.HS256Secret != "" {
+		return []string{cfg.HS256Secret}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHS256SecretRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hs256")
+	if err := os.WriteFile(path, []byte("old-secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	cache := newHS256SecretCache(path, time.Second, time.Minute)
+	cache.now = func() time.Time { return now }
+	cfg := &authConfig{HS256Cache: cache}
+	exp := time.Now().Add(time.Hour).Unix()
+	oldTok := signHS256(t, "old-secret", map[string]any{"sub": "alice", "exp": exp})
+	newTok := signHS256(t, "new-secret", map[string]any{"sub": "alice", "exp": exp})
+
+	if _, err := validateJWT(cfg, oldTok); err != nil {
+		t.Fatalf("old secret before rotation: %v", err)
+	}
+	if _, err := validateJWT(cfg, newTok); err == nil {
+		t.Fatal("new secret accepted before rotation")
+	}
+
+	if err := os.WriteFile(path, []byte("new-secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := now.Add(time.Hour)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	// Within the TTL the file is not looked at again.
+	if _, err := validateJWT(cfg, newTok); err == nil {
+		t.Fatal("file re-read before the TTL elapsed")
+	}
+
+	now = now.Add(2 * time.Second)
+	if _, err := validateJWT(cfg, newTok); err != nil {
+		t.Fatalf("new secret after rotation: %v", err)
+	}
+	if _, err := validateJWT(cfg, oldTok); err != nil {
+		t.Fatalf("old secret inside the grace window: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := validateJWT(cfg, oldTok); err == nil || err.Error() != "invalid_signature" {
+		t.Fatalf("old secret after the grace window: expected invalid_signature, got %v", err)
+	}
+	if _, err := validateJWT(cfg, newTok); err != nil {
+		t.Fatalf("new secret after the grace window: %v", err)
+	}
+
+	// An emptied file keeps the last good secret.
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mtime = mtime.Add(time.Hour)
+	_ = os.Chtimes(path, mtime, mtime)
+	now = now.Add(2 * time.Second)
+	if _, err := validateJWT(cfg, newTok); err != nil {
+		t.Fatalf("empty file should keep the current secret: %v", err)
+	}
+}
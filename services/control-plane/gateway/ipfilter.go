@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// --- IP filter ---
+
+// ctxClientIP holds the address withIPFilter resolved, so the rate limiter
+// keys anonymous callers by the same address the lists were checked against.
+const ctxClientIP ctxKey = "client_ip"
+
+func clientIPFromContext(ctx context.Context) net.IP {
+	ip, _ := ctx.Value(ctxClientIP).(net.IP)
+	return ip
+}
+
+// ipRules is one parsed set of filter lists.
+type ipRules struct {
+	allow []*net.IPNet
+	block []*net.IPNet
+	// allowSet is true when an allowlist was configured, even if none of its
+	// entries parsed: a broken allowlist denies everyone instead of opening up.
+	allowSet bool
+}
+
+// ipFilterSource says where the lists come from. Files, when set, are
+// read in addition to the env lists and re-read on SIGHUP.
+type ipFilterSource struct {
+	allow, block         string
+	allowFile, blockFile string
+}
+
+// ipFilter allows or rejects requests by client address. Blocklisted
+// addresses are always rejected; with an allowlist, only listed addresses
+// get through.
+type ipFilter struct {
+	mu      sync.RWMutex
+	rules   ipRules
+	src     ipFilterSource
+	trusted []*net.IPNet
+}
+
+func loadIPFilter() *ipFilter {
+	src := ipFilterSource{
+		allow:     os.Getenv("GATEWAY_IP_ALLOWLIST"),
+		block:     os.Getenv("GATEWAY_IP_BLOCKLIST"),
+		allowFile: strings.TrimSpace(os.Getenv("GATEWAY_IP_ALLOWLIST_FILE")),
+		blockFile: strings.TrimSpace(os.Getenv("GATEWAY_IP_BLOCKLIST_FILE")),
+	}
+	f := &ipFilter{src: src}
+	trusted, bad := parseCIDRList(splitCSV(os.Getenv("GATEWAY_TRUSTED_PROXIES")))
+	if len(bad) > 0 {
+		slog.Error("ip_filter_invalid", "list", "trusted_proxies", "entries", strings.Join(bad, ","))
+	}
+	f.trusted = trusted
+	if err := f.reload(); err != nil {
+		slog.Error("ip_filter_load_failed", "err", err)
+	}
+	return f
+}
+
+// reload re-reads the lists. On a file read error the current rules stay.
+func (f *ipFilter) reload() error {
+	allow, block := splitCSV(f.src.allow), splitCSV(f.src.block)
+	for _, p := range []struct {
+		path string
+		dst  *[]string
+	}{{f.src.allowFile, &allow}, {f.src.blockFile, &block}} {
+		if p.path == "" {
+			continue
+		}
+		raw, err := os.ReadFile(p.path)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", p.path, err)
+		}
+		*p.dst = append(*p.dst, parseIPListFile(string(raw))...)
+	}
+	rules := ipRules{allowSet: len(allow) > 0 || f.src.allowFile != ""}
+	var bad []string
+	rules.allow, bad = parseCIDRList(allow)
+	if len(bad) > 0 {
+		slog.Error("ip_filter_invalid", "list", "allow", "entries", strings.Join(bad, ","))
+	}
+	rules.block, bad = parseCIDRList(block)
+	if len(bad) > 0 {
+		slog.Error("ip_filter_invalid", "list", "block", "entries", strings.Join(bad, ","))
+	}
+	f.mu.Lock()
+	f.rules = rules
+	f.mu.Unlock()
+	if rules.allowSet || len(rules.block) > 0 {
+		slog.Info("ip_filter_loaded", "allow", len(rules.allow), "block", len(rules.block), "trusted_proxies", len(f.trusted))
+	}
+	return nil
+}
+
+// reloadOnSIGHUP re-reads the list files on every SIGHUP until ctx ends.
+func (f *ipFilter) reloadOnSIGHUP(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := f.reload(); err != nil {
+				slog.Error("ip_filter_reload_failed", "err", err)
+			}
+		}
+	}
+}
+
+// parseIPListFile reads entries separated by newlines or commas; "#" starts
+// a comment.
+func parseIPListFile(raw string) []string {
+	var out []string
+	for _, line := range strings.Split(raw, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		out = append(out, splitCSV(line)...)
+	}
+	return out
+}
+
+// parseCIDRList parses CIDRs, accepting bare addresses as single hosts, and
+// returns the entries that did not parse.
+func parseCIDRList(entries []string) (nets []*net.IPNet, bad []string) {
+	for _, e := range entries {
+		if !strings.Contains(e, "/") {
+			ip := net.ParseIP(e)
+			if ip == nil {
+				bad = append(bad, e)
+				continue
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			bad = append(bad, e)
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return nets, bad
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP is the address the request came from. X-Forwarded-For is only
+// believed when the direct peer is a trusted proxy; then the client is the
+// right-most hop that is not itself a trusted proxy, since everything left of
+// that could have been written by the client.
+func (f *ipFilter) clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer := net.ParseIP(host)
+	if peer == nil || !containsIP(f.trusted, peer) {
+		return peer
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			// A hop we cannot read ends the chain we can vouch for.
+			break
+		}
+		if !containsIP(f.trusted, ip) {
+			return ip
+		}
+		peer = ip
+	}
+	return peer
+}
+
+// allows reports whether ip may reach the gateway, and why not.
+func (f *ipFilter) allows(ip net.IP) (bool, string) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if ip == nil {
+		if f.rules.allowSet {
+			return false, "unknown_address"
+		}
+		return true, ""
+	}
+	if containsIP(f.rules.block, ip) {
+		return false, "blocklisted"
+	}
+	if f.rules.allowSet && !containsIP(f.rules.allow, ip) {
+		return false, "not_allowlisted"
+	}
+	return true, ""
+}
+
+// withIPFilter rejects requests from blocked or unlisted addresses with 403
+// before CORS and auth run, and records the resolved address in the context.
+func withIPFilter(f *ipFilter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := f.clientIP(r)
+			if ok, reason := f.allows(ip); !ok {
+				slog.Warn("ip_rejected", "ip", ip, "reason", reason, "path", r.URL.Path)
+				writeJSON(w, http.StatusForbidden, map[string]any{"error": "ip_forbidden"})
+				return
+			}
+			if ip != nil {
+				r = r.WithContext(context.WithValue(r.Context(), ctxClientIP, ip))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestIPFilter(t *testing.T, src ipFilterSource, trusted ...string) *ipFilter {
+	t.Helper()
+	nets, bad := parseCIDRList(trusted)
+	if len(bad) > 0 {
+		t.Fatalf("trusted proxies: %v", bad)
+	}
+	f := &ipFilter{src: src, trusted: nets}
+	if err := f.reload(); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestWithIPFilter(t *testing.T) {
+	f := newTestIPFilter(t, ipFilterSource{
+		allow: "10.0.0.0/8, 192.168.1.7, 2001:db8::/32",
+		block: "10.6.6.0/24",
+	}, "10.0.0.1/32")
+	var reached bool
+	h := withIPFilter(f)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	cases := []struct {
+		name, remote, xff string
+		want              int
+	}{
+		{"allowlisted range", "10.1.2.3:5000", "", http.StatusOK},
+		{"allowlisted host", "192.168.1.7:5000", "", http.StatusOK},
+		{"ipv6 range", "[2001:db8::1]:5000", "", http.StatusOK},
+		{"not allowlisted", "172.16.0.1:5000", "", http.StatusForbidden},
+		{"blocklist wins over allowlist", "10.6.6.6:5000", "", http.StatusForbidden},
+		{"untrusted peer cannot spoof XFF", "172.16.0.1:5000", "10.1.2.3", http.StatusForbidden},
+		{"untrusted peer XFF is ignored", "10.1.2.3:5000", "10.6.6.6", http.StatusOK},
+		{"trusted proxy forwards client", "10.0.0.1:5000", "172.16.0.9", http.StatusForbidden},
+		{"trusted proxy forwards allowed client", "10.0.0.1:5000", "10.2.2.2", http.StatusOK},
+		{"spoofed left-most hop is ignored", "10.0.0.1:5000", "10.2.2.2, 10.6.6.6", http.StatusForbidden},
+		{"chained trusted proxies", "10.0.0.1:5000", "10.6.6.6, 10.0.0.1", http.StatusForbidden},
+		{"unreadable hop falls back to the last good one", "10.0.0.1:5000", "garbage", http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			reached = false
+			req := httptest.NewRequest(http.MethodGet, "/api/summary", nil)
+			req.RemoteAddr = tc.remote
+			if tc.xff != "" {
+				req.Header.Set("X-Forwarded-For", tc.xff)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tc.want || reached != (tc.want == http.StatusOK) {
+				t.Fatalf("status %d reached=%v, want %d", rec.Code, reached, tc.want)
+			}
+			if tc.want == http.StatusForbidden && !strings.Contains(rec.Body.String(), "ip_forbidden") {
+				t.Fatalf("body %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestIPFilterLists(t *testing.T) {
+	open := newTestIPFilter(t, ipFilterSource{block: "203.0.113.0/24"})
+	if ok, _ := open.allows(net.ParseIP("198.51.100.1")); !ok {
+		t.Fatal("an empty allowlist must allow everyone not blocked")
+	}
+	if ok, reason := open.allows(net.ParseIP("203.0.113.9")); ok || reason != "blocklisted" {
+		t.Fatalf("blocklisted address: %v %s", ok, reason)
+	}
+
+	broken := newTestIPFilter(t, ipFilterSource{allow: "10.0.0.0/33,not-an-ip"})
+	if ok, _ := broken.allows(net.ParseIP("10.0.0.1")); ok {
+		t.Fatal("an allowlist with no valid entries must deny, not open up")
+	}
+
+	nets, bad := parseCIDRList([]string{"10.0.0.0/8", "::1", "1.2.3.4", "1.2.3.4/40", "nope"})
+	if len(nets) != 3 || strings.Join(bad, ",") != "1.2.3.4/40,nope" {
+		t.Fatalf("parsed %v, bad %v", nets, bad)
+	}
+}
+
+func TestIPFilterReloadsFiles(t *testing.T) {
+	dir := t.TempDir()
+	allowFile := filepath.Join(dir, "allow.txt")
+	if err := os.WriteFile(allowFile, []byte("# office\n10.0.0.0/8\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f := newTestIPFilter(t, ipFilterSource{allow: "192.168.0.1", allowFile: allowFile})
+	for ip, want := range map[string]bool{"10.9.9.9": true, "192.168.0.1": true, "172.16.0.1": false} {
+		if ok, _ := f.allows(net.ParseIP(ip)); ok != want {
+			t.Fatalf("before reload %s: %v, want %v", ip, ok, want)
+		}
+	}
+
+	if err := os.WriteFile(allowFile, []byte("172.16.0.0/12, # vpn\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.reload(); err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]bool{"10.9.9.9": false, "192.168.0.1": true, "172.16.0.1": true} {
+		if ok, _ := f.allows(net.ParseIP(ip)); ok != want {
+			t.Fatalf("after reload %s: %v, want %v", ip, ok, want)
+		}
+	}
+
+	// A missing file keeps the rules in force.
+	_ = os.Remove(allowFile)
+	if err := f.reload(); err == nil {
+		t.Fatal("reload of a missing file should fail")
+	}
+	if ok, _ := f.allows(net.ParseIP("172.16.0.1")); !ok {
+		t.Fatal("failed reload dropped the current rules")
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func signES256(t *testing.T, key *ecdsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+	hdr, _ := json.Marshal(jwtHeader{Alg: "ES256", Kid: kid, Typ: "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(hdr) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func ecJWKSServer(t *testing.T, kid string, pub *ecdsa.PublicKey) *httptest.Server {
+	t.Helper()
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	pub.X.FillBytes(x)
+	pub.Y.FillBytes(y)
+	doc := map[string]any{"keys": []map[string]any{{
+		"kty": "EC",
+		"kid": kid,
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(x),
+		"y":   base64.RawURLEncoding.EncodeToString(y),
+		"alg": "ES256",
+	}}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(doc)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestValidateJWTES256(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := ecJWKSServer(t, "ec1", &key.PublicKey)
+	cfg := &authConfig{JWKS: newJWKSCache(srv.URL, time.Minute)}
+	claims := map[string]any{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+
+	got, err := validateJWT(cfg, signES256(t, key, "ec1", claims))
+	if err != nil {
+		t.Fatalf("expected valid token, got %v", err)
+	}
+	if got["sub"] != "alice" {
+		t.Fatalf("unexpected claims: %v", got)
+	}
+
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if _, err := validateJWT(cfg, signES256(t, other, "ec1", claims)); err == nil || err.Error() != "invalid_signature" {
+		t.Fatalf("expected invalid_signature for foreign key, got %v", err)
+	}
+	if _, err := validateJWT(cfg, signES256(t, key, "missing", claims)); err == nil || err.Error() != "jwks_key_not_found" {
+		t.Fatalf("expected jwks_key_not_found, got %v", err)
+	}
+}
+
+// TestJWKSRefreshThrottle checks that unknown kids cannot drive the JWKS
+// endpoint: misses refetch at most once per minRefresh, and a kid absent
+// after a fetch is not refetched until negativeTTL has passed.
+func TestJWKSRefreshThrottle(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	key.PublicKey.X.FillBytes(x)
+	key.PublicKey.Y.FillBytes(y)
+	var (
+		fetches atomic.Int32
+		kids    atomic.Value
+		failing atomic.Bool
+	)
+	kids.Store([]string{"k1"})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var keys []map[string]any
+		for _, kid := range kids.Load().([]string) {
+			keys = append(keys, map[string]any{
+				"kty": "EC", "kid": kid, "crv": "P-256", "alg": "ES256",
+				"x": base64.RawURLEncoding.EncodeToString(x),
+				"y": base64.RawURLEncoding.EncodeToString(y),
+			})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	}))
+	defer srv.Close()
+
+	now := time.Unix(1_700_000_000, 0)
+	c := newJWKSCache(srv.URL, 10*time.Minute)
+	c.now = func() time.Time { return now }
+	c.minRefresh = 30 * time.Second
+	c.negativeTTL = time.Minute
+	lookup := func(kid string) error {
+		_, err := c.getECKey(kid)
+		return err
+	}
+	expect := func(step string, want int32) {
+		t.Helper()
+		if got := fetches.Load(); got != want {
+			t.Fatalf("%s: %d fetches, want %d", step, got, want)
+		}
+	}
+
+	if err := lookup("k1"); err != nil {
+		t.Fatal(err)
+	}
+	expect("first lookup", 1)
+	for i := 0; i < 50; i++ {
+		if err := lookup("bogus"); !errors.Is(err, errJWKSKeyNotFound) {
+			t.Fatalf("unknown kid: %v", err)
+		}
+	}
+	expect("misses inside the refresh interval", 1)
+
+	now = now.Add(31 * time.Second)
+	_ = lookup("bogus")
+	expect("miss after the refresh interval", 2)
+
+	now = now.Add(31 * time.Second)
+	for i := 0; i < 50; i++ {
+		_ = lookup("bogus")
+	}
+	expect("negatively cached kid", 2)
+
+	// A rolled-over key is still found: negative entries are per kid.
+	kids.Store([]string{"k1", "k2"})
+	if err := lookup("k2"); err != nil {
+		t.Fatalf("new kid after rollover: %v", err)
+	}
+	expect("new kid", 3)
+
+	now = now.Add(40 * time.Second)
+	_ = lookup("bogus")
+	expect("negative entry expired", 4)
+
+	// Concurrent misses share a single fetch.
+	now = now.Add(31 * time.Second)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = lookup("k3")
+		}()
+	}
+	wg.Wait()
+	expect("concurrent misses", 5)
+
+	// A failed fetch is throttled too; known keys keep verifying meanwhile
+	// and unknown kids report the fetch error.
+	now = now.Add(11 * time.Minute)
+	failing.Store(true)
+	if err := lookup("k1"); err == nil {
+		t.Fatal("stale key with a failing endpoint should report the fetch error once")
+	}
+	expect("failed refresh", 6)
+	if err := lookup("k1"); err != nil {
+		t.Fatalf("stale key while throttled: %v", err)
+	}
+	if err := lookup("k4"); err == nil || errors.Is(err, errJWKSKeyNotFound) {
+		t.Fatalf("unknown kid after a failed fetch: %v", err)
+	}
+	expect("throttled after failure", 6)
+
+	// A new URL clears the throttle.
+	failing.Store(false)
+	c.setURL(srv.URL + "/")
+	if err := lookup("k2"); err != nil {
+		t.Fatal(err)
+	}
+	expect("after setURL", 7)
+}
+
+func TestValidateJWTMixedJWKS(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coord := func(n *big.Int) string {
+		b := make([]byte, 32)
+		n.FillBytes(b)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	ecJWK := func(kid, alg, use string) map[string]any {
+		return map[string]any{"kty": "EC", "kid": kid, "crv": "P-256", "x": coord(ecKey.X), "y": coord(ecKey.Y), "alg": alg, "use": use}
+	}
+	doc := map[string]any{"keys": []map[string]any{
+		{"kty": "RSA", "kid": "rsa1", "alg": "RS256", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes())},
+		ecJWK("ec1", "ES256", "sig"),
+		ecJWK("ec-noalg", "", ""),
+		ecJWK("ec-enc", "", "enc"),
+		ecJWK("ec-384", "ES384", "sig"),
+		{"kty": "OKP", "kid": "ed1", "crv": "Ed25519", "x": "AAAA"},
+	}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(doc)
+	}))
+	t.Cleanup(srv.Close)
+	cfg := &authConfig{JWKS: newJWKSCache(srv.URL, time.Minute)}
+	claims := map[string]any{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+
+	for kid, want := range map[string]string{"ec1": "", "ec-noalg": "", "ec-enc": "jwks_key_not_found", "ec-384": "jwks_key_not_found"} {
+		_, err := validateJWT(cfg, signES256(t, ecKey, kid, claims))
+		if (want == "" && err != nil) || (want != "" && (err == nil || err.Error() != want)) {
+			t.Fatalf("kid %s: got %v, want %q", kid, err, want)
+		}
+	}
+	if _, err := validateJWT(cfg, signRS256(t, rsaKey, "rsa1", claims)); err != nil {
+		t.Fatalf("RSA key from the same set: %v", err)
+	}
+	// An ES256 header naming the RSA key must not fall back to it.
+	if _, err := validateJWT(cfg, signES256(t, ecKey, "rsa1", claims)); err == nil || err.Error() != "jwks_key_not_found" {
+		t.Fatalf("ES256 with an RSA kid: %v", err)
+	}
+
+	// Tampering with the payload of a valid ES256 token breaks the signature.
+	tok := signES256(t, ecKey, "ec1", claims)
+	parts := strings.Split(tok, ".")
+	forged, _ := json.Marshal(map[string]any{"sub": "admin", "exp": claims["exp"]})
+	parts[1] = base64.RawURLEncoding.EncodeToString(forged)
+	if _, err := validateJWT(cfg, strings.Join(parts, ".")); err == nil || err.Error() != "invalid_signature" {
+		t.Fatalf("tampered payload: %v", err)
+	}
+
+	// Anything but RS256, ES256 and HS256 fails closed.
+	for _, alg := range []string{"ES384", "PS256", "EdDSA"} {
+		hdr, _ := json.Marshal(jwtHeader{Alg: alg, Kid: "ec1", Typ: "JWT"})
+		bad := base64.RawURLEncoding.EncodeToString(hdr) + "." + parts[1] + "." + parts[2]
+		if _, err := validateJWT(cfg, bad); err == nil || err.Error() != "unsupported_alg" {
+			t.Fatalf("alg %s: %v", alg, err)
+		}
+	}
+}
+
+// rsaJWKSServer serves a key set in the shape the auth service publishes at
+// /.well-known/jwks.json when AUTH_JWT_ALG=RS256.
+func rsaJWKSServer(t *testing.T, kid string, pub *rsa.PublicKey) *httptest.Server {
+	t.Helper()
+	doc := map[string]any{"keys": []map[string]any{{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(doc)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+	hdr, _ := json.Marshal(jwtHeader{Alg: "RS256", Kid: kid, Typ: "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(hdr) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestValidateJWTRS256FromAuthService(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := rsaJWKSServer(t, "auth-kid", &key.PublicKey)
+	cfg := &authConfig{Issuer: "chartly-auth", JWKS: newJWKSCache(srv.URL, time.Minute)}
+	now := time.Now().UTC()
+	// Claims as issued by the auth service's /v0/token.
+	claims := map[string]any{
+		"tenant_id":  "acme",
+		"subject":    "alice",
+		"issued_at":  now.Format(time.RFC3339),
+		"expires_at": now.Add(time.Hour).Format(time.RFC3339),
+		"token_id":   "0123456789abcdef",
+		"iss":        "chartly-auth",
+		"sub":        "alice",
+		"iat":        now.Unix(),
+		"exp":        now.Add(time.Hour).Unix(),
+	}
+
+	got, err := validateJWT(cfg, signRS256(t, key, "auth-kid", claims))
+	if err != nil {
+		t.Fatalf("expected valid token, got %v", err)
+	}
+	if got["sub"] != "alice" || got["tenant_id"] != "acme" {
+		t.Fatalf("unexpected claims: %v", got)
+	}
+
+	claims["exp"] = now.Add(-time.Hour).Unix()
+	if _, err := validateJWT(cfg, signRS256(t, key, "auth-kid", claims)); err == nil || err.Error() != "invalid_claims" {
+		t.Fatalf("expected invalid_claims for expired token, got %v", err)
+	}
+}
+
+// withJWTHeader re-encodes a token's header, keeping payload and signature.
+func withJWTHeader(tok string, hdr map[string]any) string {
+	parts := strings.Split(tok, ".")
+	b, _ := json.Marshal(hdr)
+	parts[0] = base64.RawURLEncoding.EncodeToString(b)
+	return strings.Join(parts, ".")
+}
+
+func TestValidateJWTHeaderChecks(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches atomic.Int32
+	jwks := rsaJWKSServer(t, "rsa1", &rsaKey.PublicKey)
+	counting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		http.Redirect(w, r, jwks.URL, http.StatusFound)
+	}))
+	t.Cleanup(counting.Close)
+	claims := map[string]any{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+	hsTok := signHS256(t, "s3cret", claims)
+	rsTok := signRS256(t, rsaKey, "rsa1", claims)
+
+	jwksOnly := &authConfig{JWKS: newJWKSCache(counting.URL, time.Minute)}
+	secretOnly := &authConfig{HS256Secret: "s3cret"}
+	rsOnly := &authConfig{HS256Secret: "s3cret", JWKS: newJWKSCache(counting.URL, time.Minute), AllowedAlgs: map[string]bool{"RS256": true}}
+
+	cases := []struct {
+		name string
+		cfg  *authConfig
+		tok  string
+		want string
+	}{
+		{"alg none", secretOnly, withJWTHeader(hsTok, map[string]any{"alg": "none", "typ": "JWT"}), "alg_none"},
+		{"alg None", secretOnly, withJWTHeader(hsTok, map[string]any{"alg": "None"}), "alg_none"},
+		{"alg missing", secretOnly, withJWTHeader(hsTok, map[string]any{"typ": "JWT"}), "alg_none"},
+		{"alg in lower case", secretOnly, withJWTHeader(hsTok, map[string]any{"alg": "hs256"}), "unsupported_alg"},
+		{"alg not allowed", rsOnly, hsTok, "alg_not_allowed"},
+		{"HS256 with only JWKS", jwksOnly, hsTok, "hs256_not_configured"},
+		{"RS256 with only a secret", secretOnly, rsTok, "jwks_not_configured"},
+		{"ID token typ", rsOnly, withJWTHeader(rsTok, map[string]any{"alg": "RS256", "kid": "rsa1", "typ": "id_token+jwt"}), "invalid_typ"},
+		{"JWE typ", secretOnly, withJWTHeader(hsTok, map[string]any{"alg": "HS256", "typ": "JOSE"}), "invalid_typ"},
+	}
+	for _, tc := range cases {
+		if _, err := validateJWT(tc.cfg, tc.tok); err == nil || err.Error() != tc.want {
+			t.Errorf("%s: got %v, want %s", tc.name, err, tc.want)
+		}
+	}
+	if n := fetches.Load(); n != 0 {
+		t.Fatalf("header checks fetched the JWKS %d times", n)
+	}
+
+	if _, err := validateJWT(rsOnly, rsTok); err != nil {
+		t.Fatalf("allowed RS256 token: %v", err)
+	}
+	if _, err := validateJWT(rsOnly, withJWTHeader(rsTok, map[string]any{"alg": "RS256", "kid": "rsa1", "typ": "at+jwt"})); err == nil || err.Error() != "invalid_signature" {
+		t.Fatalf("at+jwt typ should reach signature checking: %v", err)
+	}
+	if _, err := validateJWT(secretOnly, hsTok); err != nil {
+		t.Fatalf("HS256 token with a secret: %v", err)
+	}
+}
+
+func TestParseJWTAlgs(t *testing.T) {
+	got, err := parseJWTAlgs(defaultJWTAlgs)
+	if err != nil || len(got) != 3 {
+		t.Fatalf("default: %v %v", got, err)
+	}
+	got, err = parseJWTAlgs(" RS256, none ,hs256,HS256")
+	if err == nil || !strings.Contains(err.Error(), "none,hs256") {
+		t.Fatalf("expected the bad entries to be named, got %v", err)
+	}
+	if len(got) != 2 || !got["RS256"] || !got["HS256"] {
+		t.Fatalf("allowed: %v", got)
+	}
+	if got, err := parseJWTAlgs(""); err != nil || got == nil || len(got) != 0 {
+		t.Fatalf("empty list must refuse everything: %v %v", got, err)
+	}
+}
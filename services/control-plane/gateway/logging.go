@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// --- Logging ---
+
+const ctxRequestLog ctxKey = "request_log"
+
+// requestLog carries what inner middleware and handlers learn about a
+// request (who made it, which events it published) out to the access log
+// line and audit event written by withLogging.
+type requestLog struct {
+	principal   string
+	sseEventIDs []int64
+}
+
+func requestLogFromContext(ctx context.Context) *requestLog {
+	info, _ := ctx.Value(ctxRequestLog).(*requestLog)
+	return info
+}
+
+// noteSSEEvent records that the request published event id on the hub.
+func noteSSEEvent(ctx context.Context, id int64) {
+	if info := requestLogFromContext(ctx); info != nil && id > 0 {
+		info.sseEventIDs = append(info.sseEventIDs, id)
+	}
+}
+
+// setupLogging makes a JSON slog handler on stdout the default logger.
+// LOG_LEVEL (debug, info, warn, error; default info) sets the minimum level.
+func setupLogging() {
+	slog.SetDefault(slog.New(newLogHandler(os.Stdout, os.Getenv("LOG_LEVEL"))))
+}
+
+func newLogHandler(w io.Writer, level string) slog.Handler {
+	return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: parseLogLevel(level)})
+}
+
+func parseLogLevel(v string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureLogs routes the default slog logger into a buffer for the test.
+func captureLogs(t *testing.T, level string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(newLogHandler(&buf, level)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("log line is not JSON: %q", line)
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func TestWithLoggingStructured(t *testing.T) {
+	buf := captureLogs(t, "")
+	cfg := &authConfig{Enabled: true, APIKeys: parseKeySet("k"), TenantHeader: "X-Tenant-ID", AllowAnonymous: loadAnonymousPaths("", true)}
+	h := withRequestID(withLogging(withAuth(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusCreated, map[string]any{"ok": true})
+	})), nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/profiles", nil)
+	req.Header.Set("X-API-Key", "k")
+	req.Header.Set("X-Request-ID", "rid-1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	recs := logRecords(t, buf)
+	if len(recs) != 1 {
+		t.Fatalf("want one access log record, got %d: %s", len(recs), buf.String())
+	}
+	got := recs[0]
+	want := map[string]any{
+		"level": "INFO", "msg": "request", "method": "GET", "path": "/api/profiles",
+		"status": float64(201), "request_id": "rid-1", "principal": "apikey:" + shortKeyHash("k"),
+		"bytes": float64(len(`{"ok":true}` + "\n")),
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	if _, ok := got["duration_ms"].(float64); !ok {
+		t.Errorf("duration_ms missing: %v", got)
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	buf := captureLogs(t, "warn")
+	slog.Info("dropped")
+	slog.Warn("upstream_error", "upstream", "agg:8082")
+	slog.Debug("dropped_too")
+
+	recs := logRecords(t, buf)
+	if len(recs) != 1 || recs[0]["level"] != "WARN" || recs[0]["msg"] != "upstream_error" {
+		t.Fatalf("LOG_LEVEL=warn should keep one record, got %s", buf.String())
+	}
+
+	for in, want := range map[string]slog.Level{"": slog.LevelInfo, "DEBUG": slog.LevelDebug, "warning": slog.LevelWarn, "error": slog.LevelError, "loud": slog.LevelInfo} {
+		if got := parseLogLevel(in); got != want {
+			t.Errorf("parseLogLevel(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
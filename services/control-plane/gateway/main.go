@@ -3,32 +3,38 @@ package main
 import (
 	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/subtle"
 	_ "embed"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"log/slog"
+	"math"
 	"math/big"
+	mrand "math/rand/v2"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
-
-	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -40,9 +46,13 @@ const (
 	defaultReporterURL     = "http://reporter:8084"
 	defaultAnalyticsURL    = "http://analytics:8086"
 	defaultCryptoStreamURL = "http://crypto-stream:8088"
+	defaultStorageURL      = "http://storage:8083"
+
+	defaultUpstreamTimeout = 10 * time.Second
 
 	defaultRateLimitRPS   = 10
 	defaultRateLimitBurst = 20
+	defaultRateLimitIdle  = 10 * time.Minute
 
 	distDir = "/app/web/dist"
 )
@@ -69,9 +79,9 @@ type reportSpec struct {
 }
 
 type reportEntry struct {
-	ID        string
-	CreatedAt time.Time
-	Spec      reportSpec
+	ID        string     `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Spec      reportSpec `json:"spec"`
 }
 
 type connectorCatalog struct {
@@ -88,6 +98,8 @@ type connectorCatalogEntry struct {
 	Endpoints    []struct {
 		Notes string `yaml:"notes"`
 	} `yaml:"endpoints"`
+	// Schema replaces defaultConnectorSchema for this connector's config.
+	Schema map[string]any `yaml:"schema"`
 }
 
 type connectorPublic struct {
@@ -98,28 +110,6 @@ type connectorPublic struct {
 	Capabilities []string `json:"capabilities,omitempty"`
 }
 
-type connectorConfigStore struct {
-	mu    sync.Mutex
-	items map[string]any
-}
-
-func newConnectorConfigStore() *connectorConfigStore {
-	return &connectorConfigStore{items: make(map[string]any)}
-}
-
-func (s *connectorConfigStore) get(id string) (any, bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	v, ok := s.items[id]
-	return v, ok
-}
-
-func (s *connectorConfigStore) set(id string, cfg any) {
-	s.mu.Lock()
-	s.items[id] = cfg
-	s.mu.Unlock()
-}
-
 type auditEvent struct {
 	EventID   string `json:"event_id"`
 	EventTS   string `json:"event_ts"`
@@ -129,77 +119,97 @@ type auditEvent struct {
 	RequestID string `json:"request_id,omitempty"`
 	ActorID   string `json:"actor_id,omitempty"`
 	Source    string `json:"source,omitempty"`
+	Severity  string `json:"severity,omitempty"`
+	Category  string `json:"category,omitempty"`
 	Detail    any    `json:"detail_json,omitempty"`
+	// SSEEventIDs are the ids of the events the request published on
+	// /api/events, so timelines can join the two.
+	SSEEventIDs []int64 `json:"sse_event_ids,omitempty"`
 }
 
-type auditStore struct {
-	mu     sync.Mutex
-	events []auditEvent
-	max    int
+type reportStore struct {
+	mu      sync.Mutex
+	items   map[string]reportEntry
+	order   []string
+	persist *reportStorage
 }
 
-func newAuditStore(max int) *auditStore {
-	if max <= 0 {
-		max = 1000
-	}
-	return &auditStore{max: max}
+func newReportStore() *reportStore {
+	return &reportStore{items: make(map[string]reportEntry)}
 }
 
-func (s *auditStore) add(ev auditEvent) {
+func (s *reportStore) add(spec reportSpec) string {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.events = append(s.events, ev)
-	if len(s.events) > s.max {
-		s.events = s.events[len(s.events)-s.max:]
+	id := fmt.Sprintf("report-%d", time.Now().UnixNano())
+	entry := reportEntry{ID: id, CreatedAt: time.Now().UTC(), Spec: spec}
+	s.items[id] = entry
+	s.order = append(s.order, id)
+	var dropped []string
+	if len(s.order) > 100 {
+		dropped = append(dropped, s.order[:len(s.order)-100]...)
+		for _, rid := range dropped {
+			delete(s.items, rid)
+		}
+		s.order = s.order[len(s.order)-100:]
 	}
-}
+	s.mu.Unlock()
 
-func (s *auditStore) list(limit int, since time.Time) []auditEvent {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	out := make([]auditEvent, 0, len(s.events))
-	for _, ev := range s.events {
-		if !since.IsZero() {
-			ts, err := time.Parse(time.RFC3339, ev.EventTS)
-			if err == nil && ts.Before(since) {
-				continue
+	if s.persist != nil {
+		go func() {
+			s.persist.save(entry, s.ids)
+			for _, rid := range dropped {
+				s.persist.remove(rid, s.ids)
 			}
-		}
-		out = append(out, ev)
-	}
-	if limit <= 0 || limit > len(out) {
-		limit = len(out)
-	}
-	if limit < len(out) {
-		out = out[len(out)-limit:]
+		}()
 	}
-	return out
+	return id
 }
 
-type reportStore struct {
-	mu    sync.Mutex
-	items map[string]reportEntry
-	order []string
-}
+func (s *reportStore) remove(id string) bool {
+	s.mu.Lock()
+	if _, ok := s.items[id]; !ok {
+		s.mu.Unlock()
+		return false
+	}
+	delete(s.items, id)
+	for i, rid := range s.order {
+		if rid == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	s.mu.Unlock()
 
-func newReportStore() *reportStore {
-	return &reportStore{items: make(map[string]reportEntry)}
+	if s.persist != nil {
+		go s.persist.remove(id, s.ids)
+	}
+	return true
 }
 
-func (s *reportStore) add(spec reportSpec) string {
+// restore loads persisted entries, oldest first, without writing them back.
+func (s *reportStore) restore(entries []reportEntry) {
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	id := fmt.Sprintf("report-%d", time.Now().UnixNano())
-	s.items[id] = reportEntry{ID: id, CreatedAt: time.Now().UTC(), Spec: spec}
-	s.order = append(s.order, id)
+	for _, it := range entries {
+		if _, ok := s.items[it.ID]; ok {
+			continue
+		}
+		s.items[it.ID] = it
+		s.order = append(s.order, it.ID)
+	}
 	if len(s.order) > 100 {
-		toDrop := s.order[:len(s.order)-100]
-		for _, rid := range toDrop {
+		for _, rid := range s.order[:len(s.order)-100] {
 			delete(s.items, rid)
 		}
 		s.order = s.order[len(s.order)-100:]
 	}
-	return id
+}
+
+func (s *reportStore) ids() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.order...)
 }
 
 func (s *reportStore) list() []reportEntry {
@@ -228,20 +238,50 @@ type summaryCache struct {
 }
 
 type cryptoCache struct {
-	mu          sync.RWMutex
-	tickers     []binanceTicker
+	mu      sync.RWMutex
+	tickers []binanceTicker
+	source  string // provider the tickers came from
+	// lastUpdated is the time of the last successful fetch, zero until the
+	// first one. It keeps its monotonic reading for age computations.
 	lastUpdated time.Time
 	lastErr     string
+
+	// Loop state for /api/crypto/cache/status.
+	failures    int // consecutive failed refreshes
+	lastAttempt time.Time
+	backoff     time.Duration
+	nextPoll    time.Time
 }
 
-func (c *cryptoCache) set(ticks []binanceTicker, errMsg string) {
+// set records a refresh. A failed refresh (errMsg set) keeps the last good
+// tickers and their time, so readers see stale data rather than none.
+func (c *cryptoCache) set(ticks []binanceTicker, source, errMsg string) {
 	c.mu.Lock()
-	c.tickers = ticks
 	c.lastErr = errMsg
-	c.lastUpdated = time.Now().UTC()
+	c.lastAttempt = time.Now()
+	if errMsg == "" {
+		c.tickers = ticks
+		c.source = source
+		c.lastUpdated = c.lastAttempt
+		c.failures = 0
+	} else {
+		c.failures++
+	}
 	c.mu.Unlock()
 }
 
+func (c *cryptoCache) consecutiveFailures() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.failures
+}
+
+func (c *cryptoCache) currentSource() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.source
+}
+
 func (c *cryptoCache) snapshot() ([]binanceTicker, time.Time, string) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -274,27 +314,46 @@ type healthSnapshot struct {
 	Status      string                   `json:"status"`
 	Services    map[string]serviceDetail `json:"services"`
 	LastSuccess map[string]string        `json:"last_success"`
-	CheckedAt   string                   `json:"checked_at"`
+	// CheckedAt is a deprecated alias for updated_at; drop after the next release.
+	CheckedAt string                   `json:"checked_at,omitempty"`
+	Breakers  map[string]breakerStatus `json:"breakers,omitempty"`
+	Startup   *startupReport           `json:"startup,omitempty"`
+	freshness
 }
 
 type healthCache struct {
 	mu          sync.Mutex
 	lastSuccess map[string]time.Time
 	snapshot    healthSnapshot
+	checkedAt   time.Time
+	breakers    map[string]*circuitBreaker
+	now         func() time.Time
 }
 
 func newHealthCache() *healthCache {
-	return &healthCache{lastSuccess: make(map[string]time.Time)}
+	return &healthCache{lastSuccess: make(map[string]time.Time), breakers: make(map[string]*circuitBreaker), now: time.Now}
+}
+
+// watchBreaker ties a proxy's circuit breaker to a health-checked service so
+// the breaker closes as soon as the service reports up again.
+func (h *healthCache) watchBreaker(service string, b *circuitBreaker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.breakers[service] = b
 }
 
 func (h *healthCache) update(services map[string]serviceDetail) healthSnapshot {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	now := time.Now().UTC()
+	h.checkedAt = h.now()
+	now := h.checkedAt.UTC()
 	allUp := true
 	for name, detail := range services {
 		if detail.Status == "up" {
 			h.lastSuccess[name] = now
+			if b := h.breakers[name]; b != nil && b.current() != breakerClosed {
+				b.reset()
+			}
 		} else {
 			allUp = false
 		}
@@ -313,27 +372,64 @@ func (h *healthCache) update(services map[string]serviceDetail) healthSnapshot {
 		LastSuccess: last,
 		CheckedAt:   now.Format(time.RFC3339),
 	}
-	return h.snapshot
+	return h.currentLocked()
 }
 
 func (h *healthCache) get() healthSnapshot {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	return h.snapshot
+	return h.currentLocked()
+}
+
+func (h *healthCache) currentLocked() healthSnapshot {
+	snap := h.snapshot
+	snap.Breakers = h.breakerStatusesLocked()
+	snap.freshness = freshnessAt(h.checkedAt, healthStaleAfter, h.now())
+	return snap
+}
+
+// breakerStatusesLocked reports live breaker state, which can change between
+// health updates; h.mu must be held.
+func (h *healthCache) breakerStatusesLocked() map[string]breakerStatus {
+	if len(h.breakers) == 0 {
+		return nil
+	}
+	out := make(map[string]breakerStatus, len(h.breakers))
+	for name, b := range h.breakers {
+		out[name] = b.status()
+	}
+	return out
 }
 
 type sseEvent struct {
 	ID    int64
 	Event string
 	Data  string
+	TS    time.Time // when the hub published it; zero for direct writes
 }
 
 type sseHub struct {
-	mu        sync.RWMutex
-	nextID    int64
-	buffer    []sseEvent
-	maxBuffer int
-	clients   map[chan sseEvent]struct{}
+	mu          sync.RWMutex
+	nextID      int64
+	buffer      []sseEvent
+	maxBuffer   int
+	maxReplay   int
+	clients     map[chan sseEvent]*sseClient
+	closed      bool // set by close; new clients are ended at once
+	idleTimeout time.Duration
+	now         func() time.Time
+}
+
+// sseClient tracks when a subscriber last took an event off its channel.
+// kick aborts the subscriber's pending write so a handler stuck on a stalled
+// connection returns.
+type sseClient struct {
+	lastDrain atomic.Int64 // unix nanos
+	kick      func()
+}
+
+func (c *sseClient) drained(now time.Time) {
+	c.lastDrain.Store(now.UnixNano())
 }
 
 func newSSEHub(maxBuffer int) *sseHub {
@@ -341,19 +437,24 @@ func newSSEHub(maxBuffer int) *sseHub {
 		maxBuffer = 256
 	}
 	return &sseHub{
-		maxBuffer: maxBuffer,
-		clients:   make(map[chan sseEvent]struct{}),
+		maxBuffer:   maxBuffer,
+		maxReplay:   100,
+		clients:     make(map[chan sseEvent]*sseClient),
+		idleTimeout: 30 * time.Second,
+		now:         time.Now,
 	}
 }
 
-func (h *sseHub) publish(event string, payload any) {
+// publish buffers and fans out one event and returns its id, or 0 when the
+// payload does not marshal.
+func (h *sseHub) publish(event string, payload any) int64 {
 	b, err := json.Marshal(payload)
 	if err != nil {
-		return
+		return 0
 	}
 	h.mu.Lock()
 	h.nextID++
-	ev := sseEvent{ID: h.nextID, Event: event, Data: string(b)}
+	ev := sseEvent{ID: h.nextID, Event: event, Data: string(b), TS: h.now()}
 	h.buffer = append(h.buffer, ev)
 	if len(h.buffer) > h.maxBuffer {
 		h.buffer = h.buffer[len(h.buffer)-h.maxBuffer:]
@@ -365,12 +466,20 @@ func (h *sseHub) publish(event string, payload any) {
 		}
 	}
 	h.mu.Unlock()
+	return ev.ID
 }
 
-func (h *sseHub) addClient(ch chan sseEvent) {
+func (h *sseHub) addClient(ch chan sseEvent, kick func()) *sseClient {
+	c := &sseClient{kick: kick}
+	c.drained(h.now())
 	h.mu.Lock()
-	h.clients[ch] = struct{}{}
+	if h.closed {
+		close(ch)
+	} else {
+		h.clients[ch] = c
+	}
 	h.mu.Unlock()
+	return c
 }
 
 func (h *sseHub) removeClient(ch chan sseEvent) {
@@ -379,19 +488,61 @@ func (h *sseHub) removeClient(ch chan sseEvent) {
 	h.mu.Unlock()
 }
 
+// sweep closes and removes clients that have events waiting but have not
+// drained their channel for longer than idleTimeout. Publish drops events for
+// such clients, so without this their handlers would linger forever. A quiet
+// client with nothing pending is never swept.
+func (h *sseHub) sweep() int {
+	h.mu.Lock()
+	before := len(h.clients)
+	cutoff := h.now().Add(-h.idleTimeout).UnixNano()
+	for ch, c := range h.clients {
+		if len(ch) == 0 || c.lastDrain.Load() >= cutoff {
+			continue
+		}
+		delete(h.clients, ch)
+		close(ch)
+		if c.kick != nil {
+			c.kick()
+		}
+	}
+	after := len(h.clients)
+	h.mu.Unlock()
+	if removed := before - after; removed > 0 {
+		slog.Warn("sse_idle_disconnect", "removed", removed, "clients_before", before, "clients_after", after, "idle_timeout", h.idleTimeout.String())
+		return removed
+	}
+	return 0
+}
+
+func (h *sseHub) sweepLoop(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			h.sweep()
+		}
+	}
+}
+
+// replaySince returns the buffered events after id, oldest first. IDs are
+// assigned in publish order, so the buffer is sorted and the start is found
+// by binary search. At most maxReplay of the newest events are returned; a
+// client that was away longer catches up from there rather than in one burst.
 func (h *sseHub) replaySince(id int64) []sseEvent {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 	if id <= 0 || len(h.buffer) == 0 {
 		return nil
 	}
-	out := make([]sseEvent, 0, len(h.buffer))
-	for _, ev := range h.buffer {
-		if ev.ID > id {
-			out = append(out, ev)
-		}
+	i := sort.Search(len(h.buffer), func(i int) bool { return h.buffer[i].ID > id })
+	if h.maxReplay > 0 && len(h.buffer)-i > h.maxReplay {
+		i = len(h.buffer) - h.maxReplay
 	}
-	return out
+	return append([]sseEvent(nil), h.buffer[i:]...)
 }
 
 type ctxKey string
@@ -402,28 +553,242 @@ const (
 )
 
 func main() {
+	setupLogging()
+	// ctx stops the background loops once the server has shut down.
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
 	registryURL := envOr("REGISTRY_URL", defaultRegistryURL)
 	aggregatorURL := envOr("AGGREGATOR_URL", defaultAggregatorURL)
 	coordinatorURL := envOr("COORDINATOR_URL", defaultCoordinatorURL)
 	reporterURL := envOr("REPORTER_URL", defaultReporterURL)
 	analyticsURL := envOr("ANALYTICS_URL", defaultAnalyticsURL)
 	cryptoStreamURL := envOr("CRYPTO_STREAM_URL", defaultCryptoStreamURL)
-
-	regProxy := mustProxy(registryURL)
-	aggProxy := mustProxy(aggregatorURL)
-	cooProxy := mustProxy(coordinatorURL)
-	repProxy := mustProxy(reporterURL)
-	anaProxy := mustProxy(analyticsURL)
+	healthChecks := loadHealthTargets(registryURL, aggregatorURL, coordinatorURL, reporterURL, analyticsURL, cryptoStreamURL)
+	catalogPath := strings.TrimSpace(os.Getenv("CONNECTOR_CATALOG_PATH"))
+	catalogRaw, catalogMod, catalogErr := readConnectorCatalogSource(catalogPath)
+	if catalogErr != nil {
+		catalogRaw = connectorCatalogYAML
+	}
+	startup := validateStartup(loadStartupConfig(), healthChecks, catalogRaw)
+	if catalogErr != nil {
+		startup.Issues = append(startup.Issues, startupIssue{Check: "catalog", Target: catalogPath, Message: "read failed, serving embedded catalog: " + catalogErr.Error()})
+		startup.OK = false
+	}
+	startup.enforce()
+
+	proxies := newProxyRegistry()
+	regProxy := proxies.register("registry", registryURL, upstreamTimeout("REGISTRY_TIMEOUT"))
+	aggProxy := proxies.register("aggregator", aggregatorURL, upstreamTimeout("AGGREGATOR_TIMEOUT"))
+	cooProxy := proxies.register("coordinator", coordinatorURL, upstreamTimeout("COORDINATOR_TIMEOUT"))
+	repProxy := proxies.register("reporter", reporterURL, upstreamTimeout("REPORTER_TIMEOUT"))
+	anaProxy := proxies.register("analytics", analyticsURL, upstreamTimeout("ANALYTICS_TIMEOUT"))
 
 	reports := newReportStore()
+	reportSrc := newReportSource(proxies.urlFunc("registry"), proxies.urlFunc("aggregator"))
+	reports.persist = newReportStorage(envOr("STORAGE_URL", defaultStorageURL), envOr("REPORTS_STORAGE_TENANT", "chartly"))
+	if reports.persist != nil {
+		loadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		entries, err := reports.persist.load(loadCtx)
+		cancel()
+		if err != nil {
+			slog.Warn("report_restore_failed", "err", err)
+		} else {
+			reports.restore(entries)
+			slog.Info("reports_restored", "count", len(entries))
+		}
+	}
 	health := newHealthCache()
+	health.watchBreaker("registry", regProxy.breaker)
+	health.watchBreaker("aggregator", aggProxy.breaker)
+	health.watchBreaker("coordinator", cooProxy.breaker)
+	health.watchBreaker("reporter", repProxy.breaker)
+	health.watchBreaker("analytics", anaProxy.breaker)
 	sse := newSSEHub(512)
+	if n := envInt("SSE_IDLE_TIMEOUT", 30); n > 0 {
+		sse.idleTimeout = time.Duration(n) * time.Second
+	}
+	if n := envInt("SSE_MAX_REPLAY_EVENTS", 100); n > 0 {
+		sse.maxReplay = n
+	}
+	go sse.sweepLoop(ctx, 5*time.Second)
 	summary := &summaryCache{}
 	crypto := &cryptoCache{}
-	audit := newAuditStore(2000)
-	connectors := newConnectorConfigStore()
-	connCatalog := loadConnectorCatalog()
-	connList := buildConnectorList(connCatalog)
+	audit := loadAuditStore(2000)
+	webhooks := newWebhookDispatcher(loadWebhookConfig())
+	if webhooks != nil {
+		audit.notify = webhooks.notify
+		webhooks.start(ctx)
+	}
+	connectors := loadConnectorConfigStore()
+	// Integrity problems are reported by validateStartup; a catalog that
+	// parses is still served.
+	connCatalog, _ := parseConnectorCatalog(catalogRaw)
+	catalog := newLiveCatalog(catalogPath, connCatalog, catalogMod)
+	startCatalogReloadLoop(ctx, catalog, sse, defaultCatalogReloadInterval)
+
+	liveHealth := newLiveHealthTargets(healthChecks)
+	corsCfg := loadCORSConfig()
+	mux := newGatewayMux(gatewayRoutes{
+		healthChecks:    liveHealth,
+		health:          health,
+		startup:         startup,
+		sse:             sse,
+		summary:         summary,
+		crypto:          crypto,
+		klines:          newKlinesCache(),
+		symbols:         loadSymbolsCache(),
+		audit:           audit,
+		webhooks:        webhooks,
+		reports:         reports,
+		reportSrc:       reportSrc,
+		catalog:         catalog,
+		connectors:      connectors,
+		cryptoStreamURL: cryptoStreamURL,
+		proxies:         proxies,
+		adminKey:        strings.TrimSpace(os.Getenv("ADMIN_API_KEY")),
+		cors:            corsCfg,
+	})
+
+	authCfg := loadAuthConfig()
+	mux.HandleFunc("/api/gateway/auth/revoke", newRevokeHandler(authCfg))
+	mux.HandleFunc("/api/auth/session", newSessionHandler(authCfg))
+	mux.HandleFunc("/api/auth/logout", newLogoutHandler(authCfg))
+	go authCfg.Revoked.runCleanup(ctx, time.Minute)
+	if authCfg.OIDC != nil {
+		go authCfg.OIDC.run(ctx, authCfg.JWKS, authCfg.JWKSCacheTTL)
+	}
+	metricsGoroutineAlarm = envInt("GATEWAY_GOROUTINE_ALARM", metricsGoroutineAlarm)
+	rateRPS := envInt("RATE_LIMIT_RPS", defaultRateLimitRPS)
+	rateBurst := envInt("RATE_LIMIT_BURST", defaultRateLimitBurst)
+	rateRules, err := parseRateRules(os.Getenv("RATE_LIMIT_RULES") + "," + os.Getenv("RATE_LIMIT_OVERRIDES"))
+	if err != nil {
+		slog.Warn("rate_limit_rules", "err", err)
+	}
+	rateLimiter := newRateLimiter(rateRPS, rateBurst, rateRules...)
+	rateLimiter.setTenantLimits(
+		envInt("RATE_LIMIT_RPS_PER_TENANT", rateRPS),
+		envInt("RATE_LIMIT_BURST_PER_TENANT", rateBurst),
+	)
+	if idle := envInt("RATE_LIMIT_BUCKET_IDLE_SECONDS", int(defaultRateLimitIdle/time.Second)); idle > 0 {
+		rateLimiter.idle = time.Duration(idle) * time.Second
+	}
+	go rateLimiter.runEvictor(ctx)
+
+	requestTimeoutMax := time.Duration(envInt64("REQUEST_TIMEOUT_MAX_SECONDS", int64(defaultRequestTimeoutMax/time.Second))) * time.Second
+
+	ipFilter := loadIPFilter()
+	go ipFilter.reloadOnSIGHUP(ctx)
+
+	streams, drainStreams := context.WithCancel(ctx)
+	defer drainStreams()
+
+	// Middleware order: X-Request-ID -> Trace -> Logging -> Gzip -> Timeout -> StreamDrain -> IPFilter -> CORS -> BodyLimit -> Auth -> RateLimit -> FieldFilter
+	var handler http.Handler = mux
+	handler = withFieldFilter(handler)
+	handler = withRateLimit(rateLimiter)(handler)
+	handler = withAuth(authCfg)(handler)
+	handler = withBodyLimit(loadBodyLimits())(handler)
+	handler = withCORS(corsCfg)(handler)
+	handler = withIPFilter(ipFilter)(handler)
+	handler = withStreamDrain(streams)(handler)
+	handler = withRequestTimeout(requestTimeoutMax)(handler)
+	if envBool("GATEWAY_GZIP", true) {
+		handler = withGzip(envInt("GATEWAY_GZIP_MIN_BYTES", defaultGzipMinBytes))(handler)
+	}
+	handler = withLogging(handler, audit)
+	handler = withTrace(handler)
+	handler = withRequestID(handler)
+
+	startEventLoops(ctx, sse, health, liveHealth, proxies.urlFunc("aggregator"))
+	marketData = loadMarketData()
+	startCryptoCacheLoop(ctx, crypto)
+
+	addr := ":" + defaultPort
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		// 0 disables the write timeout; streaming routes and requests carrying
+		// X-Request-Timeout override it per request.
+		WriteTimeout: time.Duration(envInt64("HTTP_WRITE_TIMEOUT_SECONDS", 0)) * time.Second,
+	}
+
+	shutdownTimeout := time.Duration(envInt64("GATEWAY_SHUTDOWN_TIMEOUT_SECONDS", int64(defaultShutdownTimeout/time.Second))) * time.Second
+
+	errCh := make(chan error, 1)
+	go func() {
+		slog.Info("starting", "addr", addr, "registry", registryURL, "aggregator", aggregatorURL, "coordinator", coordinatorURL, "reporter", reporterURL, "analytics", analyticsURL, "crypto", cryptoStreamURL)
+		errCh <- srv.ListenAndServe()
+	}()
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case sig := <-sigCh:
+		slog.Info("shutdown_signal", "signal", sig.String(), "timeout", shutdownTimeout.String())
+	case err := <-errCh:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("listen_failed", "err", err)
+			os.Exit(1)
+		}
+	}
+	_ = gracefulShutdown(srv, sse, drainStreams, shutdownTimeout)
+}
+
+func envOr(k, def string) string {
+	v := strings.TrimSpace(os.Getenv(k))
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+func envInt(k string, def int) int {
+	v := strings.TrimSpace(os.Getenv(k))
+	if v == "" {
+		return def
+	}
+	if n, err := strconvAtoiSafe(v); err == nil {
+		return n
+	}
+	return def
+}
+
+// gatewayRoutes is everything the gateway's own handlers and proxies need.
+type gatewayRoutes struct {
+	healthChecks    *liveHealthTargets
+	health          *healthCache
+	startup         startupReport
+	sse             *sseHub
+	summary         *summaryCache
+	crypto          *cryptoCache
+	klines          *klinesCache
+	symbols         *symbolsCache
+	audit           *auditStore
+	webhooks        *webhookDispatcher
+	reports         *reportStore
+	reportSrc       reportSource
+	catalog         *liveCatalog
+	connectors      *connectorConfigStore
+	cryptoStreamURL string
+	proxies         *proxyRegistry
+	adminKey        string
+	cors            corsConfig
+}
+
+// newGatewayMux registers every route. Handlers the gateway serves itself
+// answer unsupported methods with 405 and an Allow header; requests handed
+// to an upstream for a path the gateway also serves go through
+// proxyFallthrough so the hand-off is logged.
+func newGatewayMux(d gatewayRoutes) *http.ServeMux {
+	healthChecks, health, startup, sse := d.healthChecks, d.health, d.startup, d.sse
+	summary, crypto, klines, audit, webhooks := d.summary, d.crypto, d.klines, d.audit, d.webhooks
+	reports, reportSrc, catalog, connectors := d.reports, d.reportSrc, d.catalog, d.connectors
+	cryptoStreamURL := d.cryptoStreamURL
+	// Direct aggregator and registry calls follow admin repoints, as the
+	// proxies do.
+	registryURL, aggregatorURL := d.proxies.urlFunc("registry"), d.proxies.urlFunc("aggregator")
+	regProxy, aggProxy, cooProxy := d.proxies.handler("registry"), d.proxies.handler("aggregator"), d.proxies.handler("coordinator")
+	repProxy, anaProxy := d.proxies.handler("reporter"), d.proxies.handler("analytics")
 
 	mux := http.NewServeMux()
 
@@ -433,21 +798,11 @@ func main() {
 			return
 		}
 		if r.Method != http.MethodGet {
-			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
+			methodNotAllowed(w, http.MethodGet)
 			return
 		}
 
-		sum := checkAll(registryURL, aggregatorURL, coordinatorURL, reporterURL, analyticsURL)
-		status := "healthy"
-		if sum["services"].(map[string]string)["registry"] != "up" ||
-			sum["services"].(map[string]string)["aggregator"] != "up" ||
-			sum["services"].(map[string]string)["coordinator"] != "up" ||
-			sum["services"].(map[string]string)["reporter"] != "up" ||
-			sum["services"].(map[string]string)["analytics"] != "up" {
-			status = "degraded"
-		}
-		sum["status"] = status
-		writeJSON(w, http.StatusOK, sum)
+		writeJSON(w, http.StatusOK, checkAll(r.Context(), healthChecks.snapshot()))
 	})
 
 	mux.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
@@ -456,12 +811,12 @@ func main() {
 			return
 		}
 		if r.Method != http.MethodGet {
-			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
+			methodNotAllowed(w, http.MethodGet)
 			return
 		}
 		snap := health.get()
 		if snap.CheckedAt == "" {
-			services := checkAllDetailed(registryURL, aggregatorURL, coordinatorURL, reporterURL, analyticsURL).Services
+			services := checkAllDetailed(r.Context(), healthChecks.snapshot()).Services
 			snap = health.update(services)
 		}
 		writeJSON(w, http.StatusOK, snap)
@@ -473,14 +828,18 @@ func main() {
 			return
 		}
 		if r.Method != http.MethodGet {
-			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
+			methodNotAllowed(w, http.MethodGet)
 			return
 		}
 		snap := health.get()
 		if snap.CheckedAt == "" {
-			services := checkAllDetailed(registryURL, aggregatorURL, coordinatorURL, reporterURL, analyticsURL).Services
+			services := checkAllDetailed(r.Context(), healthChecks.snapshot()).Services
 			snap = health.update(services)
 		}
+		snap.Startup = &startup
+		if !startup.OK {
+			snap.Status = "degraded"
+		}
 		writeJSON(w, http.StatusOK, snap)
 	})
 
@@ -490,41 +849,47 @@ func main() {
 			return
 		}
 		if r.Method != http.MethodGet {
-			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
+			methodNotAllowed(w, http.MethodGet)
 			return
 		}
-		writeJSON(w, http.StatusOK, metricsSnapshot())
+		f := negotiateMetricsFormat(r)
+		w.Header().Set("Content-Type", f.contentType())
+		w.WriteHeader(http.StatusOK)
+		_ = f.format(w, metricsSnapshot())
 	})
 
+	mux.HandleFunc("/api/openapi.json", newOpenAPIHandler(openAPIYAML))
+
 	mux.HandleFunc("/api/status", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 		if r.Method != http.MethodGet {
-			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
+			methodNotAllowed(w, http.MethodGet)
 			return
 		}
 
-		out := checkAllDetailed(registryURL, aggregatorURL, coordinatorURL, reporterURL, analyticsURL)
-		status := "healthy"
-		for _, v := range out.Services {
-			if v.Status != "up" {
-				status = "degraded"
-				break
-			}
-		}
-		out.Status = status
-		writeJSON(w, http.StatusOK, out)
+		writeJSON(w, http.StatusOK, checkAllDetailed(r.Context(), healthChecks.snapshot()))
 	})
 
+	// connectHeartbeat is the heartbeat event /api/events and /api/ws send a
+	// client on connect, from a fresh health check.
+	connectHeartbeat := func(ctx context.Context) sseEvent {
+		snap := health.update(checkAllDetailed(ctx, healthChecks.snapshot()).Services)
+		return sseEvent{
+			Event: "heartbeat",
+			Data:  mustJSON(map[string]any{"status": snap.Status, "ts": time.Now().UTC().Format(time.RFC3339), "services": snapshotStatusMap(snap.Services)}),
+		}
+	}
+
 	mux.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 		if r.Method != http.MethodGet {
-			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
+			methodNotAllowed(w, http.MethodGet)
 			return
 		}
 
@@ -539,27 +904,30 @@ func main() {
 		w.Header().Set("Connection", "keep-alive")
 
 		rid := strings.TrimSpace(r.Header.Get("X-Request-ID"))
-		logLine("INFO", "sse_connect", "path=%s request_id=%s", r.URL.Path, rid)
+		slog.Info("sse_connect", "path", r.URL.Path, "request_id", rid)
 
 		ctx := r.Context()
 		lastID := parseLastEventID(r.Header.Get("Last-Event-ID"))
 		ch := make(chan sseEvent, 16)
-		sse.addClient(ch)
+		rc := http.NewResponseController(w)
+		client := sse.addClient(ch, func() { _ = rc.SetWriteDeadline(time.Now()) })
 		defer sse.removeClient(ch)
+		defer metricsStreamOpen("events")()
 
+		// Registered before the replay is read so nothing published in
+		// between is lost; a duplicate from the overlap is skipped below.
+		replay := sse.replaySince(lastID)
 		if lastID > 0 {
-			for _, ev := range sse.replaySince(lastID) {
-				writeSSEEvent(w, flusher, ev)
-			}
+			w.Header().Set("X-Replay-Count", strconv.Itoa(len(replay)))
+		}
+		replayed := lastID
+		for _, ev := range replay {
+			writeSSEEvent(w, flusher, ev)
+			replayed = ev.ID
 		}
 
 		// Immediate heartbeat on connect.
-		services := checkAllDetailed(registryURL, aggregatorURL, coordinatorURL, reporterURL, analyticsURL).Services
-		snap := health.update(services)
-		writeSSEEvent(w, flusher, sseEvent{
-			Event: "heartbeat",
-			Data:  mustJSON(map[string]any{"status": snap.Status, "ts": time.Now().UTC().Format(time.RFC3339), "services": snapshotStatusMap(snap.Services)}),
-		})
+		writeSSEEvent(w, flusher, connectHeartbeat(r.Context()))
 
 		keepalive := time.NewTicker(15 * time.Second)
 		defer keepalive.Stop()
@@ -567,9 +935,18 @@ func main() {
 		for {
 			select {
 			case <-ctx.Done():
-				logLine("INFO", "sse_disconnect", "path=%s request_id=%s", r.URL.Path, rid)
+				slog.Info("sse_disconnect", "path", r.URL.Path, "request_id", rid)
 				return
-			case ev := <-ch:
+			case ev, ok := <-ch:
+				if !ok {
+					// Swept as idle, or closed for shutdown.
+					slog.Info("sse_disconnect", "path", r.URL.Path, "request_id", rid, "reason", "closed")
+					return
+				}
+				client.drained(time.Now())
+				if ev.ID <= replayed {
+					continue
+				}
 				writeSSEEvent(w, flusher, ev)
 			case <-keepalive.C:
 				fmt.Fprint(w, ": keepalive\n\n")
@@ -578,144 +955,56 @@ func main() {
 		}
 	})
 
-	resultsStreamHandler := func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-		if r.Method != http.MethodGet {
-			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
-			return
-		}
-
-		flusher, ok := w.(http.Flusher)
-		if !ok {
-			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "streaming_not_supported"})
-			return
-		}
+	mux.HandleFunc("/api/ws", newEventsWSHandler(sse, connectHeartbeat, d.cors, envInt("EVENTS_WS_QUEUE", defaultEventsWSQueue)))
 
-		w.Header().Set("Content-Type", "text/event-stream")
-		w.Header().Set("Cache-Control", "no-cache")
-		w.Header().Set("Connection", "keep-alive")
-
-		limit := clampInt(queryInt(r, "limit", 50), 1, 500)
-		profileID := strings.TrimSpace(r.URL.Query().Get("profile_id"))
-		pollMs := clampInt(queryInt(r, "poll_ms", 2000), 500, 10000)
-
-		lastSeen := time.Time{}
-		if since := strings.TrimSpace(r.URL.Query().Get("since")); since != "" {
-			if t, ok := parseTimeRFC3339(since); ok {
-				lastSeen = t
-			}
-		}
-		seenIDs := make(map[string]struct{})
-
-		send := func(event string, payload any) {
-			b, _ := json.Marshal(payload)
-			fmt.Fprintf(w, "event: %s\n", event)
-			fmt.Fprintf(w, "data: %s\n\n", string(b))
-			flusher.Flush()
-		}
-
-		ctx := r.Context()
-		rid := strings.TrimSpace(r.Header.Get("X-Request-ID"))
-		logLine("INFO", "results_sse_connect", "path=%s request_id=%s", r.URL.Path, rid)
-
-		if rows, err := fetchAggregatorResults(ctx, aggregatorURL, profileID, limit); err == nil {
-			snapshot := make([]aggResult, 0, len(rows))
-			snapshot = append(snapshot, rows...)
-			if len(snapshot) > 0 {
-				if ts := getTimestamp(snapshot[0], resultData(snapshot[0])); !ts.IsZero() {
-					lastSeen = ts
-					for _, row := range snapshot {
-						if row.ID != "" {
-							seenIDs[row.ID] = struct{}{}
-						}
-					}
-				}
-			}
-			send("results", map[string]any{
-				"ts":   time.Now().UTC().Format(time.RFC3339),
-				"rows": snapshot,
-			})
-		}
-
-		ticker := time.NewTicker(time.Duration(pollMs) * time.Millisecond)
-		defer ticker.Stop()
-		keepalive := time.NewTicker(15 * time.Second)
-		defer keepalive.Stop()
-
-		for {
-			select {
-			case <-ctx.Done():
-				logLine("INFO", "results_sse_disconnect", "path=%s request_id=%s", r.URL.Path, rid)
-				return
-			case <-keepalive.C:
-				fmt.Fprint(w, ": keepalive\n\n")
-				flusher.Flush()
-			case <-ticker.C:
-				rows, err := fetchAggregatorResults(ctx, aggregatorURL, profileID, limit)
-				if err != nil {
-					send("results", map[string]any{
-						"ts":    time.Now().UTC().Format(time.RFC3339),
-						"error": "upstream_error",
-						"rows":  []aggResult{},
-					})
-					continue
-				}
-				newRows, newest, updatedSeen := selectNewResults(rows, lastSeen, seenIDs)
-				seenIDs = updatedSeen
-				if newest.After(lastSeen) {
-					lastSeen = newest
-				}
-				if len(newRows) == 0 {
-					continue
-				}
-				send("results", map[string]any{
-					"ts":   time.Now().UTC().Format(time.RFC3339),
-					"rows": newRows,
-				})
-			}
-		}
-	}
+	resultsStreamHandler := newResultsStreamHandler(newResultsPollers(aggregatorURL), newResultsReplay(envInt("RESULTS_STREAM_REPLAY_MAX", 500), envInt("RESULTS_STREAM_REPLAY_KEYS", 256)))
 	mux.HandleFunc("/api/results/stream", resultsStreamHandler)
 	mux.HandleFunc("/api/live/stream", resultsStreamHandler)
 
 	// Proxies (strip /api prefix)
 	mux.Handle("/api/profiles/", stripPrefixProxy("/api", regProxy))
 	mux.Handle("/api/profiles", stripPrefixProxy("/api", regProxy))
+	mux.Handle("/api/profiles:status", stripPrefixProxy("/api", regProxy))
+	mux.Handle("/api/profiles:batch", stripPrefixProxy("/api", regProxy))
+	mux.Handle("/api/profiles:reload", stripPrefixProxy("/api", regProxy))
 
 	mux.Handle("/api/results/", stripPrefixProxy("/api", aggProxy))
 	mux.Handle("/api/results", stripPrefixProxy("/api", aggProxy))
 
 	mux.Handle("/api/runs/", stripPrefixProxy("/api", aggProxy))
+	mux.Handle("/api/runs/{id}/stream", proxyWebSocket(cooProxy))
 	mux.Handle("/api/runs", stripPrefixProxy("/api", aggProxy))
 
 	mux.Handle("/api/records/", stripPrefixProxy("/api", aggProxy))
 	mux.Handle("/api/records", stripPrefixProxy("/api", aggProxy))
+	mux.Handle("/api/ops/overview", stripPrefixProxy("/api", aggProxy))
 
 	mux.Handle("/api/drones/", stripPrefixProxy("/api", cooProxy))
 	mux.Handle("/api/drones", stripPrefixProxy("/api", cooProxy))
 
+	mux.HandleFunc("/api/gateway/admin/routes", newAdminRoutesHandler(d.proxies, health, healthChecks, sse, d.adminKey))
+
 	mux.HandleFunc("/api/summary", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 		if r.Method != http.MethodGet {
-			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
+			methodNotAllowed(w, http.MethodGet)
 			return
 		}
 		if cached, ok := summary.get(); ok {
+			applySummaryFreshness(cached, time.Now())
 			writeJSON(w, http.StatusOK, cached)
 			return
 		}
 		ctx := r.Context()
-		data, err := buildSummary(ctx, registryURL, aggregatorURL)
+		data, err := buildSummary(ctx, registryURL(), aggregatorURL())
 		if err != nil {
-			writeJSON(w, http.StatusBadGateway, map[string]any{"error": "upstream_error"})
+			writeUpstreamError(w, err)
 			return
 		}
+		applySummaryFreshness(data, time.Now())
 		summary.set(data, 10*time.Minute)
 		writeJSON(w, http.StatusOK, data)
 	})
@@ -726,7 +1015,7 @@ func main() {
 			return
 		}
 		if r.Method != http.MethodGet {
-			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
+			methodNotAllowed(w, http.MethodGet)
 			return
 		}
 		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "status": "gateway_stub"})
@@ -738,27 +1027,46 @@ func main() {
 			return
 		}
 		if r.Method != http.MethodGet {
-			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
+			methodNotAllowed(w, http.MethodGet)
 			return
 		}
-		limit := 200
-		if v := strings.TrimSpace(r.URL.Query().Get("limit")); v != "" {
-			if n, err := strconvAtoiSafe(v); err == nil && n > 0 {
-				limit = n
-			}
+		f, errCode := parseAuditFilter(r.URL.Query())
+		if errCode != "" {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": errCode})
+			return
 		}
-		var since time.Time
-		if v := strings.TrimSpace(r.URL.Query().Get("since")); v != "" {
-			if t, err := time.Parse(time.RFC3339, v); err == nil {
-				since = t
-			}
+		p := audit.page(f)
+		out := map[string]any{
+			"count":      len(p.Items),
+			"items":      p.Items,
+			"events":     p.Items,
+			"next_since": nullIfEmpty(p.NextSince),
 		}
-		items := audit.list(limit, since)
-		writeJSON(w, http.StatusOK, map[string]any{
-			"count":  len(items),
-			"items":  items,
-			"events": items,
-		})
+		if f.cursorMode() {
+			out["next_cursor"] = nullIfEmpty(p.NextCursor)
+			out["prev_cursor"] = nullIfEmpty(p.PrevCursor)
+		}
+		writeJSON(w, http.StatusOK, out)
+	})
+
+	mux.HandleFunc("/api/audit/v0/timeline", newAuditTimelineHandler(audit, sse))
+
+	mux.HandleFunc("/api/gateway/webhooks/dlq", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		if webhooks == nil {
+			writeJSON(w, http.StatusOK, map[string]any{"enabled": false, "count": 0, "dead_letters": []webhookDLQEntry{}})
+			return
+		}
+		out := webhooks.snapshot()
+		out["enabled"] = true
+		writeJSON(w, http.StatusOK, out)
 	})
 
 	mux.HandleFunc("/api/reports", func(w http.ResponseWriter, r *http.Request) {
@@ -773,24 +1081,27 @@ func main() {
 				{"id": "crypto-index", "name": "Crypto Index", "type": "timeseries", "refresh_ms": 2000},
 			}
 			for _, it := range reports.list() {
+				mode := strings.ToLower(strings.TrimSpace(it.Spec.Mode))
+				if mode != "correlation" {
+					mode = "timeseries"
+				}
 				base = append(base, map[string]any{
 					"id":         it.ID,
 					"name":       "Custom Report",
-					"type":       "correlation",
+					"type":       mode,
 					"refresh_ms": 2000,
 				})
 			}
 			writeJSON(w, http.StatusOK, base)
 		case http.MethodPost:
 			var spec reportSpec
-			if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
-				writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_json"})
+			if !decodeJSONBody(w, r, &spec) {
 				return
 			}
 			id := reports.add(spec)
 			writeJSON(w, http.StatusOK, map[string]any{"id": id, "status": "created"})
 		default:
-			repProxy.ServeHTTP(w, r)
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
 		}
 	})
 
@@ -799,102 +1110,69 @@ func main() {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
-		if r.Method != http.MethodGet {
-			repProxy.ServeHTTP(w, r)
+		id := strings.TrimPrefix(r.URL.Path, "/api/reports/")
+		builtin := id == "live-crypto-wall" || id == "crypto-index"
+		_, custom := reports.get(id)
+		switch {
+		case r.Method == http.MethodDelete:
+			// Only custom reports can be deleted; the reporter has no
+			// DELETE, so built-in and unknown ids stop here.
+			if !custom || !reports.remove(id) {
+				writeJSON(w, http.StatusNotFound, map[string]any{"error": "report_not_found", "id": id})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"id": id, "status": "deleted"})
+			return
+		case r.Method == http.MethodGet:
+		case custom:
+			methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+			return
+		default:
+			// Built-in reports are read-only and the reporter only serves GET.
+			methodNotAllowed(w, http.MethodGet)
 			return
 		}
-		id := strings.TrimPrefix(r.URL.Path, "/api/reports/")
-		if id == "" || strings.Contains(id, "/") {
-			repProxy.ServeHTTP(w, r)
+		if !builtin && !custom {
+			proxyFallthrough(w, r, "reporter", repProxy)
 			return
 		}
 		switch id {
 		case "live-crypto-wall":
-			payload, err := buildLiveCryptoWall(r.Context(), aggregatorURL)
+			payload, err := buildLiveCryptoWall(r.Context(), aggregatorURL())
 			if err != nil {
-				writeJSON(w, http.StatusBadGateway, map[string]any{"error": "upstream_error"})
+				writeUpstreamError(w, err)
 				return
 			}
 			writeJSON(w, http.StatusOK, payload)
 			return
 		case "crypto-index":
-			payload, err := buildCryptoIndex(r.Context(), aggregatorURL)
+			payload, err := buildCryptoIndex(r.Context(), aggregatorURL(), klines)
 			if err != nil {
-				writeJSON(w, http.StatusBadGateway, map[string]any{"error": "upstream_error"})
+				writeUpstreamError(w, err)
 				return
 			}
 			writeJSON(w, http.StatusOK, payload)
 			return
 		default:
-			if _, ok := reports.get(id); ok {
-				payload, err := buildCryptoIndex(r.Context(), aggregatorURL)
+			if it, ok := reports.get(id); ok {
+				payload, err := buildCustomReport(r.Context(), id, it.Spec, reportSrc)
 				if err != nil {
-					writeJSON(w, http.StatusBadGateway, map[string]any{"error": "upstream_error"})
+					writeUpstreamError(w, err)
 					return
 				}
-				payload["id"] = id
-				payload["title"] = "Custom Report"
 				writeJSON(w, http.StatusOK, payload)
 				return
 			}
 		}
-		repProxy.ServeHTTP(w, r)
+		proxyFallthrough(w, r, "reporter", repProxy)
 	})
 
-	mux.HandleFunc("/api/crypto/symbols", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-		if r.Method != http.MethodGet {
-			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
-			return
-		}
-		// Prefer Binance public API to auto-populate symbols even if crypto-stream is absent.
-		if symbols, err := fetchBinanceSymbols(r.Context()); err == nil && len(symbols) > 0 {
-			w.Header().Set("X-Source", "binance")
-			writeJSON(w, http.StatusOK, symbols)
-			return
-		}
-		// Fallback to crypto-stream if available.
-		symbols, source, err := fetchCryptoSymbols(r.Context(), cryptoStreamURL)
-		if err != nil {
-			writeJSON(w, http.StatusBadGateway, map[string]any{"error": "upstream_error", "upstream": source, "status": 0})
-			return
-		}
-		w.Header().Set("X-Source", source)
-		if source == "unavailable" {
-			w.Header().Set("X-Warning", "upstream_unavailable")
-		}
-		writeJSON(w, http.StatusOK, symbols)
-	})
+	mux.HandleFunc("/api/crypto/symbols", newCryptoSymbolsHandler(d.symbols, cryptoStreamURL))
 
-	mux.HandleFunc("/api/crypto/top", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-		if r.Method != http.MethodGet {
-			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
-			return
-		}
-		limit := clampInt(queryInt(r, "limit", 25), 1, 500)
-		direction := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("direction")))
-		if direction == "" {
-			direction = "gainers"
-		}
-		suffix := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("suffix")))
-		if suffix == "" {
-			suffix = "USDT"
-		}
-		minQuote := queryFloat(r, "min_quote_vol", 0)
-		rows, err := fetchBinanceTop(r.Context(), limit, direction, suffix, minQuote)
-		if err != nil {
-			writeJSON(w, http.StatusBadGateway, map[string]any{"error": "upstream_error", "upstream": "binance", "status": 0})
-			return
-		}
-		writeJSON(w, http.StatusOK, rows)
-	})
+	mux.HandleFunc("/api/crypto/top", newCryptoTopHandler(crypto))
+	mux.HandleFunc("/api/crypto/klines", newCryptoKlinesHandler(klines))
+	mux.HandleFunc("/api/crypto/ws", newCryptoWSHandler(crypto, d.cors))
+	mux.HandleFunc("/api/crypto/cache/status", newCryptoCacheStatusHandler(crypto, d.adminKey))
 
 	mux.HandleFunc("/api/crypto/health", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodOptions {
@@ -902,7 +1180,7 @@ func main() {
 			return
 		}
 		if r.Method != http.MethodGet {
-			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
+			methodNotAllowed(w, http.MethodGet)
 			return
 		}
 		status, code, err := checkCryptoHealth(r.Context(), cryptoStreamURL)
@@ -919,7 +1197,7 @@ func main() {
 			return
 		}
 		if r.Method != http.MethodGet {
-			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
+			methodNotAllowed(w, http.MethodGet)
 			return
 		}
 
@@ -932,27 +1210,11 @@ func main() {
 		w.Header().Set("Cache-Control", "no-cache")
 		w.Header().Set("Connection", "keep-alive")
 
-		limit := clampInt(queryInt(r, "limit", 25), 1, 500)
-		direction := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("direction")))
-		if direction == "" {
-			direction = "gainers"
-		}
-		suffix := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("suffix")))
-		if suffix == "" {
-			suffix = "USDT"
-		}
-		minQuote := queryFloat(r, "min_quote_vol", 0)
+		limit, direction, suffix, minQuote := cryptoTopParams(r)
+		defer metricsStreamOpen("crypto")()
 
 		send := func(rows []cryptoTopRow, updated time.Time, errMsg string) {
-			payload := map[string]any{
-				"ts":      time.Now().UTC().Format(time.RFC3339),
-				"updated": updated.Format(time.RFC3339),
-				"rows":    rows,
-			}
-			if errMsg != "" {
-				payload["error"] = errMsg
-			}
-			b, _ := json.Marshal(payload)
+			b, _ := json.Marshal(cryptoStreamPayload(rows, updated, errMsg, time.Now()))
 			fmt.Fprintf(w, "event: tickers\n")
 			fmt.Fprintf(w, "data: %s\n\n", string(b))
 			flusher.Flush()
@@ -963,7 +1225,7 @@ func main() {
 		send(rows, updated, errMsg)
 
 		ctx := r.Context()
-		ticker := time.NewTicker(2 * time.Second)
+		ticker := time.NewTicker(cryptoStreamInterval)
 		defer ticker.Stop()
 		for {
 			select {
@@ -977,37 +1239,10 @@ func main() {
 		}
 	})
 
-	mux.HandleFunc("/api/gateway/connectors/catalog", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-		if r.Method != http.MethodGet {
-			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
-			return
-		}
-		writeJSON(w, http.StatusOK, map[string]any{
-			"version":    connCatalog.Version,
-			"count":      len(connList),
-			"connectors": connList,
-		})
-	})
+	handleCatalog := newCatalogHandler(catalog)
+	mux.HandleFunc("/api/gateway/connectors/catalog", handleCatalog)
 	// Compatibility alias for older UI builds.
-	mux.HandleFunc("/api/catalog", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-		if r.Method != http.MethodGet {
-			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
-			return
-		}
-		writeJSON(w, http.StatusOK, map[string]any{
-			"version":    connCatalog.Version,
-			"count":      len(connList),
-			"connectors": connList,
-		})
-	})
+	mux.HandleFunc("/api/catalog", handleCatalog)
 
 	mux.HandleFunc("/api/gateway/connectors/health", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodOptions {
@@ -1015,14 +1250,15 @@ func main() {
 			return
 		}
 		if r.Method != http.MethodGet {
-			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
+			methodNotAllowed(w, http.MethodGet)
 			return
 		}
+		_, list := catalog.snapshot()
 		writeJSON(w, http.StatusOK, map[string]any{
 			"status":     "ok",
 			"source":     "gateway",
 			"updated_at": time.Now().UTC().Format(time.RFC3339),
-			"count":      len(connList),
+			"count":      len(list),
 		})
 	})
 	// Compatibility alias for older UI builds.
@@ -1032,14 +1268,15 @@ func main() {
 			return
 		}
 		if r.Method != http.MethodGet {
-			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
+			methodNotAllowed(w, http.MethodGet)
 			return
 		}
+		_, list := catalog.snapshot()
 		writeJSON(w, http.StatusOK, map[string]any{
 			"status":     "ok",
 			"source":     "gateway",
 			"updated_at": time.Now().UTC().Format(time.RFC3339),
-			"count":      len(connList),
+			"count":      len(list),
 		})
 	})
 
@@ -1055,7 +1292,12 @@ func main() {
 			return
 		}
 		id := parts[0]
+		connCatalog, _ := catalog.snapshot()
 		if len(parts) == 2 && parts[1] == "health" {
+			if r.Method != http.MethodGet {
+				methodNotAllowed(w, http.MethodGet)
+				return
+			}
 			if !connectorExists(connCatalog, id) {
 				writeJSON(w, http.StatusNotFound, map[string]any{"error": "not_found"})
 				return
@@ -1069,42 +1311,15 @@ func main() {
 		}
 		if len(parts) == 2 && parts[1] == "schema" {
 			if r.Method != http.MethodGet {
-				writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
+				methodNotAllowed(w, http.MethodGet)
 				return
 			}
-			writeJSON(w, http.StatusOK, defaultConnectorSchema(id))
+			writeJSON(w, http.StatusOK, connectorSchema(connCatalog, id))
 			return
 		}
-		if len(parts) == 2 && parts[1] == "config" {
-			switch r.Method {
-			case http.MethodGet:
-				cfg, ok := connectors.get(id)
-				if !ok {
-					cfg = map[string]any{"enabled": false}
-				}
-				writeJSON(w, http.StatusOK, map[string]any{
-					"connector_id": id,
-					"config":       cfg,
-				})
-				return
-			case http.MethodPost, http.MethodPut:
-				var payload map[string]any
-				_ = json.NewDecoder(r.Body).Decode(&payload)
-				cfg := payload["config"]
-				if cfg == nil {
-					cfg = payload
-				}
-				connectors.set(id, cfg)
-				writeJSON(w, http.StatusOK, map[string]any{
-					"connector_id": id,
-					"config":       cfg,
-					"saved_at":     time.Now().UTC().Format(time.RFC3339),
-				})
-				return
-			default:
-				writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
-				return
-			}
+		if name, action, _ := strings.Cut(parts[len(parts)-1], ":"); len(parts) == 2 && name == "config" {
+			serveConnectorConfig(w, r, connCatalog, connectors, audit, id, action)
+			return
 		}
 		writeJSON(w, http.StatusNotFound, map[string]any{"error": "not_found"})
 	})
@@ -1121,7 +1336,12 @@ func main() {
 			return
 		}
 		id := parts[0]
+		connCatalog, _ := catalog.snapshot()
 		if len(parts) == 2 && parts[1] == "health" {
+			if r.Method != http.MethodGet {
+				methodNotAllowed(w, http.MethodGet)
+				return
+			}
 			if !connectorExists(connCatalog, id) {
 				writeJSON(w, http.StatusNotFound, map[string]any{"error": "not_found"})
 				return
@@ -1135,42 +1355,15 @@ func main() {
 		}
 		if len(parts) == 2 && parts[1] == "schema" {
 			if r.Method != http.MethodGet {
-				writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
+				methodNotAllowed(w, http.MethodGet)
 				return
 			}
-			writeJSON(w, http.StatusOK, defaultConnectorSchema(id))
+			writeJSON(w, http.StatusOK, connectorSchema(connCatalog, id))
 			return
 		}
-		if len(parts) == 2 && parts[1] == "config" {
-			switch r.Method {
-			case http.MethodGet:
-				cfg, ok := connectors.get(id)
-				if !ok {
-					cfg = map[string]any{"enabled": false}
-				}
-				writeJSON(w, http.StatusOK, map[string]any{
-					"connector_id": id,
-					"config":       cfg,
-				})
-				return
-			case http.MethodPost, http.MethodPut:
-				var payload map[string]any
-				_ = json.NewDecoder(r.Body).Decode(&payload)
-				cfg := payload["config"]
-				if cfg == nil {
-					cfg = payload
-				}
-				connectors.set(id, cfg)
-				writeJSON(w, http.StatusOK, map[string]any{
-					"connector_id": id,
-					"config":       cfg,
-					"saved_at":     time.Now().UTC().Format(time.RFC3339),
-				})
-				return
-			default:
-				writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
-				return
-			}
+		if name, action, _ := strings.Cut(parts[len(parts)-1], ":"); len(parts) == 2 && name == "config" {
+			serveConnectorConfig(w, r, connCatalog, connectors, audit, id, action)
+			return
 		}
 		writeJSON(w, http.StatusNotFound, map[string]any{"error": "not_found"})
 	})
@@ -1181,69 +1374,55 @@ func main() {
 
 	// Static + SPA fallback (everything else)
 	mux.HandleFunc("/", serveSPA(distDir))
-
-	authCfg := loadAuthConfig()
-	rateLimiter := newRateLimiter(
-		envInt("RATE_LIMIT_RPS", defaultRateLimitRPS),
-		envInt("RATE_LIMIT_BURST", defaultRateLimitBurst),
-	)
-
-	// Middleware order: X-Request-ID -> Logging -> CORS -> Auth -> RateLimit
-	var handler http.Handler = mux
-	handler = withRateLimit(rateLimiter)(handler)
-	handler = withAuth(authCfg)(handler)
-	handler = withCORS(handler)
-	handler = withLogging(handler, audit)
-	handler = withRequestID(handler)
-
-	startEventLoops(sse, health, registryURL, aggregatorURL, coordinatorURL, reporterURL, analyticsURL)
-	startCryptoCacheLoop(crypto)
-
-	addr := ":" + defaultPort
-	srv := &http.Server{
-		Addr:              addr,
-		Handler:           handler,
-		ReadHeaderTimeout: 10 * time.Second,
-	}
-
-	logLine("INFO", "starting", "addr=%s registry=%s aggregator=%s coordinator=%s reporter=%s analytics=%s crypto=%s", addr, registryURL, aggregatorURL, coordinatorURL, reporterURL, analyticsURL, cryptoStreamURL)
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		logLine("ERROR", "listen_failed", "err=%s", err.Error())
-		os.Exit(1)
-	}
+	return mux
 }
 
-func envOr(k, def string) string {
-	v := strings.TrimSpace(os.Getenv(k))
-	if v == "" {
-		return def
+// upstreamTimeout reads a per-service timeout in seconds.
+func upstreamTimeout(key string) time.Duration {
+	n := envInt(key, int(defaultUpstreamTimeout/time.Second))
+	if n <= 0 {
+		return defaultUpstreamTimeout
 	}
-	return v
+	return time.Duration(n) * time.Second
 }
 
-func envInt(k string, def int) int {
-	v := strings.TrimSpace(os.Getenv(k))
-	if v == "" {
-		return def
-	}
-	if n, err := strconvAtoiSafe(v); err == nil {
-		return n
-	}
-	return def
+// newUpstreamTransport bounds connecting to an upstream and waiting for its
+// response headers by timeout. Streaming bodies are not cut off once the
+// headers have arrived.
+func newUpstreamTransport(timeout time.Duration) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = countingDial((&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext)
+	t.ResponseHeaderTimeout = timeout
+	return t
 }
 
-func mustProxy(target string) *httputil.ReverseProxy {
+// statusClientClosedRequest is logged for proxied requests the client
+// abandoned before the upstream answered (nginx's 499).
+const statusClientClosedRequest = 499
+
+// mustProxy builds the proxy for one upstream with its own transport, so a
+// slow service cannot hold connections another one needs. An unparseable
+// target (only reachable when startup validation runs non-strict) yields a
+// proxy that answers 502 instead of panicking.
+func mustProxy(target string, timeout time.Duration) *breakerProxy {
 	u, err := url.Parse(target)
 	if err != nil {
-		panic(err)
+		u = &url.URL{}
 	}
 	p := httputil.NewSingleHostReverseProxy(u)
+	p.Transport = newUpstreamTransport(timeout)
+	// ReverseProxy flushes text/event-stream and unknown-length (chunked)
+	// responses after every write; FlushInterval only paces the rest. Every
+	// middleware writer passes Flush through, so streams reach the client as
+	// the upstream produces them.
+	p.FlushInterval = 0
 	orig := p.Director
 	p.Director = func(r *http.Request) {
 		orig(r)
 		if rid := r.Header.Get("X-Request-ID"); rid != "" {
 			r.Header.Set("X-Request-ID", rid)
 		}
+		injectTrace(r)
 		if principal := principalFromContext(r.Context()); principal != "" {
 			r.Header.Set("X-Principal", principal)
 		}
@@ -1252,12 +1431,38 @@ func mustProxy(target string) *httputil.ReverseProxy {
 		}
 	}
 	p.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if errors.Is(r.Context().Err(), context.Canceled) {
+			// The client went away; nobody is left to read a 502 and the
+			// upstream did nothing wrong.
+			slog.Info("proxy_client_canceled", "upstream", u.Host, "path", r.URL.Path)
+			w.WriteHeader(statusClientClosedRequest)
+			return
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			slog.Warn("request_body_too_large", "upstream", u.Host, "path", r.URL.Path, "max_bytes", tooLarge.Limit)
+			writeBodyTooLarge(w, tooLarge.Limit)
+			return
+		}
+		var ne net.Error
+		if r.Context().Err() == nil && errors.As(err, &ne) && ne.Timeout() {
+			slog.Warn("upstream_timeout", "upstream", u.Host, "path", r.URL.Path, "timeout_ms", timeout.Milliseconds())
+			writeJSON(w, http.StatusGatewayTimeout, map[string]any{"error": "upstream_timeout", "timeout_ms": timeout.Milliseconds()})
+			return
+		}
+		slog.Warn("upstream_error", "upstream", u.Host, "path", r.URL.Path, "err", err)
 		writeJSON(w, http.StatusBadGateway, map[string]any{"error": "upstream_unavailable"})
 	}
-	return p
+	threshold := envInt("CIRCUIT_BREAKER_THRESHOLD", defaultBreakerThreshold)
+	openFor := time.Duration(envInt("CIRCUIT_BREAKER_TIMEOUT", int(defaultBreakerTimeout/time.Second))) * time.Second
+	cb := newCircuitBreaker(u.Host, threshold, openFor)
+	if window := envInt("CIRCUIT_BREAKER_WINDOW", int(defaultBreakerWindow/time.Second)); window > 0 {
+		cb.window = time.Duration(window) * time.Second
+	}
+	return &breakerProxy{proxy: p, breaker: cb}
 }
 
-func stripPrefixProxy(prefix string, proxy *httputil.ReverseProxy) http.Handler {
+func stripPrefixProxy(prefix string, proxy http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		r.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
 		if r.URL.Path == "" {
@@ -1296,43 +1501,120 @@ func serveSPA(root string) http.HandlerFunc {
 	}
 }
 
-func checkAll(reg, agg, coo, rep, ana string) map[string]any {
-	svcs := map[string]string{
-		"registry":    upOrDown(reg + "/health"),
-		"aggregator":  upOrDown(agg + "/health"),
-		"coordinator": upOrDown(coo + "/health"),
-		"reporter":    upOrDown(rep + "/health"),
-		"analytics":   upOrDown(ana + "/health"),
+// healthTargets maps a service name to the base URL whose /health is probed.
+type healthTargets map[string]string
+
+// liveHealthTargets holds the healthTargets being probed. An admin repointing
+// a service swaps its entry, so health follows the route.
+type liveHealthTargets struct {
+	mu      sync.RWMutex
+	targets healthTargets
+}
+
+func newLiveHealthTargets(t healthTargets) *liveHealthTargets {
+	return &liveHealthTargets{targets: t}
+}
+
+// snapshot returns a copy that is safe to probe while entries change.
+func (l *liveHealthTargets) snapshot() healthTargets {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	out := make(healthTargets, len(l.targets))
+	for k, v := range l.targets {
+		out[k] = v
+	}
+	return out
+}
+
+func (l *liveHealthTargets) set(service, base string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.targets[service] = base
+}
+
+const (
+	healthProbeTimeout = 2 * time.Second
+	healthCheckBudget  = 3 * time.Second
+)
+
+// loadHealthTargets lists every backend the gateway talks to. Services
+// without a default address (auth, observer) are only probed when their URL
+// is configured.
+func loadHealthTargets(reg, agg, coo, rep, ana, cryptoStream string) healthTargets {
+	t := healthTargets{
+		"registry":      reg,
+		"aggregator":    agg,
+		"coordinator":   coo,
+		"reporter":      rep,
+		"analytics":     ana,
+		"crypto_stream": cryptoStream,
+		"storage":       envOr("STORAGE_URL", defaultStorageURL),
+	}
+	for name, key := range map[string]string{"auth": "AUTH_URL", "observer": "OBSERVER_URL"} {
+		if u := strings.TrimSpace(os.Getenv(key)); u != "" {
+			t[name] = u
+		}
+	}
+	return t
+}
+
+func checkAll(ctx context.Context, targets healthTargets) map[string]any {
+	detailed := checkAllDetailed(ctx, targets)
+	svcs := make(map[string]string, len(detailed.Services))
+	for name, d := range detailed.Services {
+		svcs[name] = d.Status
 	}
 	return map[string]any{
-		"status":   "healthy",
+		"status":   detailed.Status,
 		"services": svcs,
 	}
 }
 
-func checkAllDetailed(reg, agg, coo, rep, ana string) statusDetailed {
-	return statusDetailed{
-		Status: "healthy",
-		Services: map[string]serviceDetail{
-			"registry":    upOrDownDetailed(reg + "/health"),
-			"aggregator":  upOrDownDetailed(agg + "/health"),
-			"coordinator": upOrDownDetailed(coo + "/health"),
-			"reporter":    upOrDownDetailed(rep + "/health"),
-			"analytics":   upOrDownDetailed(ana + "/health"),
-		},
+// checkAllDetailed probes all targets concurrently. The whole check is bounded
+// by healthCheckBudget, so one hung upstream cannot stall the caller. Probes
+// made for a request carry its trace context.
+func checkAllDetailed(ctx context.Context, targets healthTargets) statusDetailed {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckBudget)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	services := make(map[string]serviceDetail, len(targets))
+	for name, base := range targets {
+		wg.Add(1)
+		go func(name, base string) {
+			defer wg.Done()
+			d := upOrDownDetailed(ctx, strings.TrimRight(base, "/")+"/health")
+			mu.Lock()
+			services[name] = d
+			mu.Unlock()
+		}(name, base)
 	}
-}
+	wg.Wait()
 
-func upOrDown(url string) string {
-	d := upOrDownDetailed(url)
-	return d.Status
+	status := "healthy"
+	for _, d := range services {
+		if d.Status != "up" {
+			status = "degraded"
+			break
+		}
+	}
+	return statusDetailed{Status: status, Services: services}
 }
 
-func upOrDownDetailed(hurl string) serviceDetail {
-	c := &http.Client{Timeout: 2 * time.Second}
-	req, _ := http.NewRequest(http.MethodGet, hurl, nil)
-	resp, err := c.Do(req)
+func upOrDownDetailed(ctx context.Context, hurl string) serviceDetail {
+	ctx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hurl, nil)
+	if err != nil {
+		return serviceDetail{Status: "down", Error: "invalid_url"}
+	}
+	injectTrace(req)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return serviceDetail{Status: "down", Error: "timeout"}
+		}
 		return serviceDetail{Status: "down", Error: "request_failed"}
 	}
 	defer resp.Body.Close()
@@ -1350,6 +1632,20 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 	_ = enc.Encode(v)
 }
 
+// methodNotAllowed answers 405 for a route the gateway serves itself, listing
+// the methods it does accept so the request is not mistaken for a missing route.
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(append(allowed, http.MethodOptions), ", "))
+	writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
+}
+
+// proxyFallthrough hands a request the gateway could not answer locally to an
+// upstream, logging it so a typo'd local route is visible rather than silent.
+func proxyFallthrough(w http.ResponseWriter, r *http.Request, upstream string, proxy http.Handler) {
+	slog.Info("route_fallthrough", "method", r.Method, "path", r.URL.Path, "upstream", upstream)
+	proxy.ServeHTTP(w, r)
+}
+
 type aggResult struct {
 	ID        string    `json:"id"`
 	DroneID   string    `json:"drone_id"`
@@ -1361,18 +1657,35 @@ type aggResult struct {
 }
 
 func fetchAggregatorResults(ctx context.Context, aggURL, profileID string, limit int) ([]aggResult, error) {
+	return fetchAggregatorResultsSince(ctx, aggURL, profileID, limit, time.Time{})
+}
+
+// fetchAggregatorResultsSince reads the newest rows at or after since. A zero
+// since leaves the window to the aggregator, which by default only returns
+// the last 24 hours.
+func fetchAggregatorResultsSince(ctx context.Context, aggURL, profileID string, limit int, since time.Time) ([]aggResult, error) {
+	if err := upstreamBackoffs.check(aggURL); err != nil {
+		return nil, err
+	}
 	u := fmt.Sprintf("%s/results?profile_id=%s&limit=%d", strings.TrimSuffix(aggURL, "/"), url.QueryEscape(profileID), limit)
+	if !since.IsZero() {
+		u += "&since=" + url.QueryEscape(since.UTC().Format(time.RFC3339Nano))
+	}
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	injectTrace(req)
 	c := &http.Client{Timeout: 6 * time.Second}
 	resp, err := c.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, upstreamBackoffs.throttled(aggURL, resp)
+	}
 	if resp.StatusCode/100 != 2 {
 		return nil, fmt.Errorf("non_2xx: %d", resp.StatusCode)
 	}
-	body, err := io.ReadAll(resp.Body)
+	body, err := readUpstreamBody(resp.Body)
 	if err != nil {
 		return nil, err
 	}
@@ -1551,36 +1864,62 @@ func getSymbol(data map[string]any) string {
 }
 
 func getTimestamp(row aggResult, data map[string]any) time.Time {
+	if t, ok := rowTimestamp(row, data); ok {
+		return t
+	}
+	return time.Now().UTC()
+}
+
+// rowTimestamp is the result's own timestamp, if it has one.
+func rowTimestamp(row aggResult, data map[string]any) (time.Time, bool) {
 	if row.Timestamp != "" {
 		if t, ok := parseTimeRFC3339(row.Timestamp); ok {
-			return t
+			return t, true
 		}
 	}
 	if ts := asString(data["timestamp"]); ts != "" {
 		if t, ok := parseTimeRFC3339(ts); ok {
-			return t
+			return t, true
 		}
 	}
-	return time.Now().UTC()
+	return time.Time{}, false
 }
 
 func buildLiveCryptoWall(ctx context.Context, aggURL string) (map[string]any, error) {
+	return buildLiveCryptoWallAt(ctx, aggURL, time.Now())
+}
+
+// liveWallRow is one symbol on the live crypto wall. updated_at and age_ms
+// are left out when the source row carries no timestamp.
+type liveWallRow struct {
+	Symbol    string  `json:"symbol"`
+	Price     float64 `json:"price"`
+	PctChange float64 `json:"pct_change"`
+	Volume    float64 `json:"volume"`
+	QuoteVol  float64 `json:"quote_volume"`
+	High      float64 `json:"high"`
+	Low       float64 `json:"low"`
+	Open      float64 `json:"open"`
+	UpdatedAt string  `json:"updated_at,omitempty"`
+	AgeMs     *int64  `json:"age_ms,omitempty"`
+	// Updated is a deprecated alias for UpdatedAt; drop after the next release.
+	Updated string `json:"updated,omitempty"`
+
+	updated time.Time
+}
+
+func (r *liveWallRow) setUpdated(t time.Time, now time.Time) {
+	r.updated = t
+	fresh := freshnessAt(t, resultsStaleAfter, now)
+	r.UpdatedAt, r.AgeMs, r.Updated = fresh.UpdatedAt, fresh.AgeMs, fresh.UpdatedAt
+}
+
+func buildLiveCryptoWallAt(ctx context.Context, aggURL string, now time.Time) (map[string]any, error) {
 	rows, err := fetchAggregatorResults(ctx, aggURL, "crypto-watchlist", 500)
 	if err != nil {
 		return nil, err
 	}
-	type rowOut struct {
-		Symbol    string  `json:"symbol"`
-		Price     float64 `json:"price"`
-		PctChange float64 `json:"pct_change"`
-		Volume    float64 `json:"volume"`
-		QuoteVol  float64 `json:"quote_volume"`
-		High      float64 `json:"high"`
-		Low       float64 `json:"low"`
-		Open      float64 `json:"open"`
-		Updated   string  `json:"updated"`
-	}
-	latest := make(map[string]rowOut)
+	latest := make(map[string]liveWallRow)
 	for _, r := range rows {
 		data := resultData(r)
 		if data == nil {
@@ -1590,7 +1929,10 @@ func buildLiveCryptoWall(ctx context.Context, aggURL string) (map[string]any, er
 		if symbol == "" {
 			continue
 		}
-		ts := getTimestamp(r, data)
+		ts, _ := rowTimestamp(r, data)
+		if prev, ok := latest[symbol]; ok && ts.Before(prev.updated) {
+			continue
+		}
 		price, _ := asFloat(data["c"])
 		if price == 0 {
 			price, _ = asFloat(data["price"])
@@ -1601,7 +1943,7 @@ func buildLiveCryptoWall(ctx context.Context, aggURL string) (map[string]any, er
 		high, _ := asFloat(data["h"])
 		low, _ := asFloat(data["l"])
 		open, _ := asFloat(data["o"])
-		latest[symbol] = rowOut{
+		row := liveWallRow{
 			Symbol:    symbol,
 			Price:     price,
 			PctChange: pct,
@@ -1610,21 +1952,22 @@ func buildLiveCryptoWall(ctx context.Context, aggURL string) (map[string]any, er
 			High:      high,
 			Low:       low,
 			Open:      open,
-			Updated:   ts.Format(time.RFC3339),
 		}
+		row.setUpdated(ts, now)
+		latest[symbol] = row
 	}
-	rowsOut := make([]rowOut, 0, len(latest))
+	rowsOut := make([]liveWallRow, 0, len(latest))
 	for _, v := range latest {
 		rowsOut = append(rowsOut, v)
 	}
 	sort.Slice(rowsOut, func(i, j int) bool { return rowsOut[i].Symbol < rowsOut[j].Symbol })
 	source := "aggregator"
 	if len(rowsOut) == 0 {
-		fallback, ferr := fetchBinanceTop(ctx, 100, "gainers", "USDT", 0)
+		fallback, provider, ferr := fetchMarketTop(ctx, 100, "gainers", "USDT", 0)
 		if ferr == nil {
-			source = "binance"
+			source = provider
 			for _, r := range fallback {
-				rowsOut = append(rowsOut, rowOut{
+				row := liveWallRow{
 					Symbol:    r.Symbol,
 					Price:     r.Price,
 					PctChange: r.PctChange,
@@ -1633,35 +1976,44 @@ func buildLiveCryptoWall(ctx context.Context, aggURL string) (map[string]any, er
 					High:      r.High,
 					Low:       r.Low,
 					Open:      r.Open,
-					Updated:   r.Updated,
-				})
+				}
+				ts, _ := parseTimeRFC3339(r.Updated)
+				row.setUpdated(ts, now)
+				rowsOut = append(rowsOut, row)
 			}
 		}
 	}
-	return map[string]any{
-		"id":         "live-crypto-wall",
-		"title":      "Live Crypto Wall",
-		"updated_at": time.Now().UTC().Format(time.RFC3339),
-		"rows":       rowsOut,
-		"series":     []any{},
+	var newest time.Time
+	for _, r := range rowsOut {
+		if r.updated.After(newest) {
+			newest = r.updated
+		}
+	}
+	payload := map[string]any{
+		"id":           "live-crypto-wall",
+		"title":        "Live Crypto Wall",
+		"generated_at": now.UTC().Format(time.RFC3339),
+		"rows":         rowsOut,
+		"series":       []any{},
 		"meta": map[string]any{
 			"source_profiles": []string{"crypto-watchlist"},
 			"window":          "last_30m",
 			"source":          source,
 		},
-	}, nil
+	}
+	freshnessAt(newest, resultsStaleAfter, now).apply(payload)
+	return payload, nil
 }
 
-func buildCryptoIndex(ctx context.Context, aggURL string) (map[string]any, error) {
+// buildCryptoIndex reads the index series from the aggregator. Until the
+// watchlist profile has produced points, the series is rebuilt from the last
+// 30 minutes of candles, and failing that from current prices.
+func buildCryptoIndex(ctx context.Context, aggURL string, klines *klinesCache) (map[string]any, error) {
 	rows, err := fetchAggregatorResults(ctx, aggURL, "crypto-watchlist", 500)
 	if err != nil {
 		return nil, err
 	}
-	type point struct {
-		T string  `json:"t"`
-		Y float64 `json:"y"`
-	}
-	points := make([]point, 0, 500)
+	points := make([]indexPoint, 0, 500)
 	for _, r := range rows {
 		data := resultData(r)
 		if data == nil {
@@ -1675,11 +2027,13 @@ func buildCryptoIndex(ctx context.Context, aggURL string) (map[string]any, error
 		if !ok {
 			continue
 		}
-		points = append(points, point{T: ts.Format(time.RFC3339), Y: val})
+		points = append(points, indexPoint{T: ts.Format(time.RFC3339), Y: val})
 	}
 	sort.Slice(points, func(i, j int) bool { return points[i].T < points[j].T })
 	if len(points) == 0 {
-		if idx, ok := buildIndexFromBinance(ctx); ok {
+		if seeded, ok := indexFromKlines(ctx, klines, 30); ok {
+			points = seeded
+		} else if idx, ok := buildIndexFromMarket(ctx); ok {
 			points = append(points, idx)
 		}
 	}
@@ -1709,14 +2063,20 @@ type authConfig struct {
 	JWKSURL          string
 	HS256Secret      string
 	HS256SecretFile  string
+	HS256Cache       *hs256SecretCache // set when the secret comes from a file
+	AllowedAlgs      map[string]bool   // nil allows every supported algorithm
 	LeewaySeconds    int64
 	APIKeys          map[string]struct{}
+	APIKeyScopes     map[string][]string // key hash -> scopes; empty grants API keys every scope
 	APIKeysFile      string
 	APIKeysTTL       time.Duration
-	AllowAnonymous   map[string]struct{}
+	AllowAnonymous   anonymousPaths
 	JWKSCacheTTL     time.Duration
 	RequireAuthPaths []string
 	JWKS             *jwksCache
+	OIDC             *oidcDiscovery
+	Revoked          *jtiRevocationCache
+	Sessions         *sessionConfig // dashboard session cookies; nil when auth is off
 	RequireTenant    bool
 	TenantClaim      string
 	TenantHeader     string
@@ -1732,6 +2092,7 @@ func loadAuthConfig() *authConfig {
 	cacheTTL := time.Duration(envInt64("AUTH_JWT_JWKS_TTL_SECONDS", 600)) * time.Second
 	apiKeysTTL := time.Duration(envInt64("AUTH_API_KEYS_TTL_SECONDS", 60)) * time.Second
 	requireTenant := envBool("AUTH_TENANT_REQUIRED", false)
+	strictPaths := envBool("AUTH_STRICT_PATHS", false)
 	tenantClaim := strings.TrimSpace(os.Getenv("AUTH_TENANT_CLAIM"))
 	if tenantClaim == "" {
 		tenantClaim = "tenant_id"
@@ -1743,8 +2104,23 @@ func loadAuthConfig() *authConfig {
 
 	apiKeysFile := strings.TrimSpace(os.Getenv("AUTH_API_KEYS_FILE"))
 	apiKeys := parseKeySet(os.Getenv("AUTH_API_KEYS"))
+	apiKeyScopes := parseAPIKeyScopes(os.Getenv("AUTH_API_KEY_SCOPES"))
+	var hsecretCache *hs256SecretCache
 	if hsecret == "" && hsecretFile != "" {
-		hsecret = strings.TrimSpace(readFileString(hsecretFile))
+		hsecretCache = newHS256SecretCache(hsecretFile,
+			time.Duration(envInt64("AUTH_JWT_HS256_SECRET_TTL_SECONDS", int64(defaultHS256SecretTTL/time.Second)))*time.Second,
+			time.Duration(envInt64("AUTH_JWT_HS256_SECRET_GRACE_SECONDS", int64(defaultHS256SecretGrace/time.Second)))*time.Second)
+		if secrets := hsecretCache.secrets(); len(secrets) > 0 {
+			hsecret = secrets[0]
+		}
+	}
+	algSpec, ok := os.LookupEnv("AUTH_JWT_ALGS")
+	if !ok {
+		algSpec = defaultJWTAlgs
+	}
+	allowedAlgs, err := parseJWTAlgs(algSpec)
+	if err != nil {
+		slog.Error("auth_jwt_algs_invalid", "err", err)
 	}
 
 	cfg := &authConfig{
@@ -1752,45 +2128,53 @@ func loadAuthConfig() *authConfig {
 		JWKSURL:         jwksURL,
 		HS256Secret:     hsecret,
 		HS256SecretFile: hsecretFile,
+		HS256Cache:      hsecretCache,
+		AllowedAlgs:     allowedAlgs,
 		LeewaySeconds:   leeway,
 		Audience:        splitCSV(aud),
 		APIKeys:         apiKeys,
+		APIKeyScopes:    apiKeyScopes,
 		APIKeysFile:     apiKeysFile,
 		APIKeysTTL:      apiKeysTTL,
-		AllowAnonymous: map[string]struct{}{
-			"/health":                         {},
-			"/api/health":                     {},
-			"/api/gateway/health":             {},
-			"/api/status":                     {},
-			"/api/events":                     {},
-			"/api/live/stream":                {},
-			"/api/results":                    {},
-			"/api/results/summary":            {},
-			"/api/results/stream":             {},
-			"/api/summary":                    {},
-			"/api/reports":                    {},
-			"/api/audit/health":               {},
-			"/api/audit/v0/events":            {},
-			"/api/catalog":                    {},
-			"/api/gateway/connectors/catalog": {},
-			"/api/gateway/connectors/health":  {},
-			"/api/connectors/health":          {},
-			"/api/crypto/symbols":             {},
-			"/api/crypto/top":                 {},
-			"/api/crypto/stream":              {},
-			"/api/crypto/health":              {},
-			"/metrics":                        {},
-			"/favicon.ico":                    {},
-		},
-		JWKSCacheTTL:  cacheTTL,
-		RequireTenant: requireTenant,
-		TenantClaim:   tenantClaim,
-		TenantHeader:  tenantHeader,
+		AllowAnonymous:  loadAnonymousPaths(os.Getenv("AUTH_ALLOW_ANONYMOUS"), strictPaths),
+		JWKSCacheTTL:    cacheTTL,
+		Revoked:         newJTIRevocationCache(),
+		RequireTenant:   requireTenant,
+		TenantClaim:     tenantClaim,
+		TenantHeader:    tenantHeader,
+	}
+
+	if oidcIssuer := strings.TrimSpace(os.Getenv("AUTH_OIDC_ISSUER")); oidcIssuer != "" {
+		cfg.OIDC = newOIDCDiscovery(oidcIssuer, strings.TrimSpace(os.Getenv("AUTH_OIDC_CACHE_FILE")))
+		if cfg.Issuer == "" {
+			cfg.Issuer = cfg.OIDC.issuer
+		}
+		doc, err := cfg.OIDC.discover(context.Background())
+		switch {
+		case err == nil:
+			cfg.JWKSURL = doc.JWKSURI
+			slog.Info("oidc_discovered", "issuer", cfg.OIDC.issuer, "jwks_uri", doc.JWKSURI)
+		case cfg.JWKSURL != "":
+			slog.Warn("oidc_discovery_failed", "issuer", cfg.OIDC.issuer, "err", err, "fallback", cfg.JWKSURL)
+		default:
+			// Degraded: bearer tokens needing the JWKS get jwks_unavailable
+			// until a later discovery round succeeds.
+			slog.Warn("oidc_discovery_failed", "issuer", cfg.OIDC.issuer, "err", err, "mode", "degraded")
+		}
 	}
 
-	cfg.Enabled = cfg.Issuer != "" || cfg.JWKSURL != "" || cfg.HS256Secret != "" || len(cfg.APIKeys) > 0
-	if cfg.JWKSURL != "" {
+	cfg.Enabled = cfg.Issuer != "" || cfg.JWKSURL != "" || cfg.HS256Secret != "" || cfg.HS256Cache != nil || len(cfg.APIKeys) > 0
+	if cfg.Enabled {
+		cfg.Sessions = loadSessionConfig()
+	}
+	if cfg.Enabled && !strictPaths {
+		slog.Warn("auth_legacy_anonymous_prefixes", "prefixes", strings.Join(legacyAnonymousPrefixes, ","),
+			"hint", "set AUTH_STRICT_PATHS=true to require auth under them")
+	}
+	if cfg.JWKSURL != "" || cfg.OIDC != nil {
 		cfg.JWKS = newJWKSCache(cfg.JWKSURL, cacheTTL)
+		cfg.JWKS.minRefresh = time.Duration(envInt64("AUTH_JWT_JWKS_MIN_REFRESH_SECONDS", int64(defaultJWKSMinRefresh/time.Second))) * time.Second
+		cfg.JWKS.negativeTTL = time.Duration(envInt64("AUTH_JWT_JWKS_NEGATIVE_TTL_SECONDS", int64(defaultJWKSNegativeTTL/time.Second))) * time.Second
 	}
 	return cfg
 }
@@ -1806,18 +2190,28 @@ func withAuth(cfg *authConfig) func(http.Handler) http.Handler {
 				next.ServeHTTP(w, r)
 				return
 			}
-			if _, ok := cfg.AllowAnonymous[r.URL.Path]; ok ||
-				strings.HasPrefix(r.URL.Path, "/api/reports/") ||
-				strings.HasPrefix(r.URL.Path, "/api/profiles/") ||
-				strings.HasPrefix(r.URL.Path, "/api/gateway/connectors/") ||
-				strings.HasPrefix(r.URL.Path, "/api/connectors/") ||
-				strings.HasPrefix(r.URL.Path, "/api/audit/") {
+			// Anonymous paths stay open for reads; writes that need a scope
+			// always authenticate.
+			scope := requiredScope(r)
+			if scope == "" && cfg.AllowAnonymous.allows(r.URL.Path) {
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			principal, tenant, ok := authenticateRequest(cfg, r)
-			if !ok {
+			principal, tenant, scopes, err := authenticateRequest(cfg, r)
+			if info := requestLogFromContext(r.Context()); info != nil {
+				info.principal = principal
+			}
+			if errors.Is(err, errJWKSUnavailable) {
+				writeJSON(w, http.StatusServiceUnavailable, map[string]any{"error": "jwks_unavailable"})
+				return
+			}
+			if errors.Is(err, errCSRF) {
+				slog.Warn("csrf_rejected", "principal", principal, "method", r.Method, "path", r.URL.Path)
+				writeJSON(w, http.StatusForbidden, map[string]any{"error": "csrf_failed"})
+				return
+			}
+			if err != nil {
 				writeJSON(w, http.StatusUnauthorized, map[string]any{"error": "unauthorized"})
 				return
 			}
@@ -1825,40 +2219,71 @@ func withAuth(cfg *authConfig) func(http.Handler) http.Handler {
 				writeJSON(w, http.StatusUnauthorized, map[string]any{"error": "tenant_required"})
 				return
 			}
+			if scope != "" && !hasScope(scopes, scope) {
+				slog.Warn("scope_denied", "principal", principal, "method", r.Method, "path", r.URL.Path, "scope", scope)
+				writeInsufficientScope(w, scope, scopes)
+				return
+			}
 
 			ctx := context.WithValue(r.Context(), ctxPrincipal, principal)
 			ctx = context.WithValue(ctx, ctxTenant, tenant)
+			ctx = context.WithValue(ctx, ctxScopes, scopes)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-func authenticateRequest(cfg *authConfig, r *http.Request) (string, string, bool) {
+// authenticateRequest returns the caller's principal, tenant and scopes. The
+// error is errJWKSUnavailable when a bearer token could not be checked
+// because no JWKS URL is known yet, errCSRF when a session cookie came
+// without its CSRF token, and errUnauthorized otherwise. The session cookie
+// is only considered when no API key or bearer token was sent.
+func authenticateRequest(cfg *authConfig, r *http.Request) (string, string, []string, error) {
 	tenantHeader := strings.TrimSpace(r.Header.Get(cfg.TenantHeader))
-	if key := strings.TrimSpace(r.Header.Get("X-API-Key")); key != "" {
+	key := strings.TrimSpace(r.Header.Get("X-API-Key"))
+	authz := strings.TrimSpace(r.Header.Get("Authorization"))
+	if key == "" && authz == "" {
+		sess, err := sessionFromCookie(cfg, r)
+		if err != nil {
+			return sess.Principal, "", nil, err
+		}
+		if tenantHeader != "" && sess.Tenant != "" && tenantHeader != sess.Tenant {
+			return "", "", nil, errUnauthorized
+		}
+		tenant := sess.Tenant
+		if tenant == "" && cfg.RequireTenant {
+			tenant = tenantHeader
+		}
+		return sess.Principal, tenant, sess.Scopes, nil
+	}
+	if key != "" {
 		if apiKeyValid(cfg, key) {
 			tenant := ""
 			if cfg.RequireTenant {
 				tenant = tenantHeader
 			}
-			return "apikey:" + shortKeyHash(key), tenant, true
+			return "apikey:" + shortKeyHash(key), tenant, apiKeyScopes(cfg, key), nil
 		}
 	}
-	if authz := strings.TrimSpace(r.Header.Get("Authorization")); strings.HasPrefix(strings.ToLower(authz), "bearer ") {
+	if strings.HasPrefix(strings.ToLower(authz), "bearer ") {
 		tok := strings.TrimSpace(authz[len("bearer "):])
 		claims, err := validateJWT(cfg, tok)
+		if errors.Is(err, errJWKSUnavailable) {
+			return "", "", nil, err
+		}
 		if err == nil {
 			tenant := tenantFromClaims(cfg, claims)
 			if tenantHeader != "" && tenant != "" && tenantHeader != tenant {
-				return "", "", false
+				return "", "", nil, errUnauthorized
 			}
+			scopes := scopesFromClaims(claims)
 			if sub, _ := claims["sub"].(string); sub != "" {
-				return "jwt:" + sub, tenant, true
+				return "jwt:" + sub, tenant, scopes, nil
 			}
-			return "jwt:anonymous", tenant, true
+			return "jwt:anonymous", tenant, scopes, nil
 		}
 	}
-	return "", "", false
+	return "", "", nil, errUnauthorized
 }
 
 func apiKeyValid(cfg *authConfig, key string) bool {
@@ -1882,83 +2307,217 @@ type jwtHeader struct {
 	Typ string `json:"typ"`
 }
 
+// jwksCache holds the signing keys of the JWKS endpoint. A lookup for an
+// unknown kid refetches the set, but at most once per minRefresh, and a kid
+// still absent after a fetch is remembered as missing for negativeTTL. A
+// stream of tokens with a bogus or not-yet-published kid therefore costs the
+// identity provider one request per interval, not one per token.
 type jwksCache struct {
-	mu      sync.RWMutex
-	url     string
-	ttl     time.Duration
-	lastRef time.Time
-	keys    map[string]*rsa.PublicKey
-	client  *http.Client
+	mu          sync.RWMutex
+	url         string
+	ttl         time.Duration
+	minRefresh  time.Duration
+	negativeTTL time.Duration
+	lastRef     time.Time
+	lastAttempt time.Time
+	lastErr     error
+	keys        map[string]*rsa.PublicKey
+	ecKeys      map[string]*ecdsa.PublicKey
+	missing     map[string]time.Time
+	client      *http.Client
+	now         func() time.Time
 }
 
+const (
+	defaultJWKSMinRefresh  = 30 * time.Second
+	defaultJWKSNegativeTTL = time.Minute
+)
+
+var errJWKSKeyNotFound = errors.New("jwks_key_not_found")
+
 type jwksDoc struct {
 	Keys []struct {
 		Kty string `json:"kty"`
 		Kid string `json:"kid"`
 		N   string `json:"n"`
 		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
 		Alg string `json:"alg"`
+		Use string `json:"use"`
 	} `json:"keys"`
 }
 
 func newJWKSCache(url string, ttl time.Duration) *jwksCache {
 	return &jwksCache{
-		url:    url,
-		ttl:    ttl,
-		keys:   make(map[string]*rsa.PublicKey),
-		client: &http.Client{Timeout: 5 * time.Second},
+		url:         url,
+		ttl:         ttl,
+		minRefresh:  defaultJWKSMinRefresh,
+		negativeTTL: defaultJWKSNegativeTTL,
+		keys:        make(map[string]*rsa.PublicKey),
+		ecKeys:      make(map[string]*ecdsa.PublicKey),
+		missing:     make(map[string]time.Time),
+		client:      &http.Client{Timeout: 5 * time.Second},
+		now:         time.Now,
 	}
 }
 
 func (c *jwksCache) getKey(kid string) (*rsa.PublicKey, error) {
+	var k *rsa.PublicKey
+	err := c.lookup(kid, func() bool {
+		k = c.keys[kid]
+		return k != nil
+	})
+	return k, err
+}
+
+func (c *jwksCache) getECKey(kid string) (*ecdsa.PublicKey, error) {
+	var k *ecdsa.PublicKey
+	err := c.lookup(kid, func() bool {
+		k = c.ecKeys[kid]
+		return k != nil
+	})
+	return k, err
+}
+
+// lookup runs find (under the read lock) until it reports a key, refreshing
+// the set in between when the keys are stale or find misses. A stale key is
+// still served while a refresh is throttled.
+func (c *jwksCache) lookup(kid string, find func() bool) error {
 	c.mu.RLock()
-	k := c.keys[kid]
-	fresh := time.Since(c.lastRef) < c.ttl
+	found := find()
+	now := c.now()
+	fresh := now.Sub(c.lastRef) < c.ttl
+	negative := now.Before(c.missing[kid])
 	c.mu.RUnlock()
-	if k != nil && fresh {
-		return k, nil
+	if found && fresh {
+		return nil
+	}
+	if !found && negative {
+		return errJWKSKeyNotFound
+	}
+	if ok, err := c.claimRefresh(now); !ok {
+		if found {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return errJWKSKeyNotFound
 	}
 	if err := c.refresh(); err != nil {
-		return nil, err
+		return err
 	}
-	c.mu.RLock()
-	k = c.keys[kid]
-	c.mu.RUnlock()
-	if k == nil {
-		return nil, errors.New("jwks_key_not_found")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if find() {
+		return nil
+	}
+	c.missing[kid] = c.now().Add(c.negativeTTL)
+	return errJWKSKeyNotFound
+}
+
+// claimRefresh reports whether the caller may fetch now, marking the attempt
+// so concurrent misses do not fetch as well. When it may not, it returns the
+// error of the last fetch, if that failed.
+func (c *jwksCache) claimRefresh(now time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.lastAttempt.IsZero() && now.Sub(c.lastAttempt) < c.minRefresh {
+		return false, c.lastErr
+	}
+	c.lastAttempt = now
+	return true, nil
+}
+
+// setURL points the cache at a new JWKS URL and reports whether it changed.
+// A change drops the freshness of the current keys, the refresh throttle and
+// the missing kids, so the next lookup fetches from the new URL.
+func (c *jwksCache) setURL(url string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if url == c.url {
+		return false
 	}
-	return k, nil
+	c.url = url
+	c.lastRef = time.Time{}
+	c.lastAttempt = time.Time{}
+	c.lastErr = nil
+	c.missing = make(map[string]time.Time)
+	return true
 }
 
 func (c *jwksCache) refresh() error {
-	resp, err := c.client.Get(c.url)
+	keys, ecKeys, err := c.fetch()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastErr = err
 	if err != nil {
 		return err
 	}
+	c.keys = keys
+	c.ecKeys = ecKeys
+	c.lastRef = c.now()
+	// Drop expired misses so the map stays bounded by the kids seen in the
+	// last negativeTTL.
+	for kid, until := range c.missing {
+		if !c.lastRef.Before(until) {
+			delete(c.missing, kid)
+		}
+	}
+	return nil
+}
+
+func (c *jwksCache) fetch() (map[string]*rsa.PublicKey, map[string]*ecdsa.PublicKey, error) {
+	c.mu.RLock()
+	url := c.url
+	c.mu.RUnlock()
+	if url == "" {
+		return nil, nil, errJWKSUnavailable
+	}
+	resp, err := c.client.Get(url)
+	if err != nil {
+		return nil, nil, err
+	}
 	defer resp.Body.Close()
 	if resp.StatusCode/100 != 2 {
-		return errors.New("jwks_fetch_failed")
+		return nil, nil, errors.New("jwks_fetch_failed")
 	}
 	var doc jwksDoc
 	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
-		return err
+		return nil, nil, err
 	}
 	keys := make(map[string]*rsa.PublicKey)
+	ecKeys := make(map[string]*ecdsa.PublicKey)
 	for _, k := range doc.Keys {
-		if strings.ToUpper(k.Kty) != "RSA" {
+		// Keys published for encryption, or pinned to another algorithm,
+		// must not verify signatures.
+		if k.Use != "" && k.Use != "sig" {
 			continue
 		}
-		pub, err := jwkToPublicKey(k.N, k.E)
-		if err != nil {
-			continue
+		switch strings.ToUpper(k.Kty) {
+		case "RSA":
+			if k.Alg != "" && k.Alg != "RS256" {
+				continue
+			}
+			pub, err := jwkToPublicKey(k.N, k.E)
+			if err != nil {
+				continue
+			}
+			keys[k.Kid] = pub
+		case "EC":
+			if k.Alg != "" && k.Alg != "ES256" {
+				continue
+			}
+			pub, err := jwkToECPublicKey(k.Crv, k.X, k.Y)
+			if err != nil {
+				continue
+			}
+			ecKeys[k.Kid] = pub
 		}
-		keys[k.Kid] = pub
 	}
-	c.mu.Lock()
-	c.keys = keys
-	c.lastRef = time.Now()
-	c.mu.Unlock()
-	return nil
+	return keys, ecKeys, nil
 }
 
 func jwkToPublicKey(n, e string) (*rsa.PublicKey, error) {
@@ -1977,6 +2536,39 @@ func jwkToPublicKey(n, e string) (*rsa.PublicKey, error) {
 	return &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: eInt}, nil
 }
 
+// jwkToECPublicKey decodes a P-256 JWK; other curves are rejected.
+func jwkToECPublicKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	if crv != "P-256" {
+		return nil, errors.New("unsupported_curve")
+	}
+	xBytes, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, err
+	}
+	yBytes, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, err
+	}
+	curve := elliptic.P256()
+	pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(xBytes), Y: new(big.Int).SetBytes(yBytes)}
+	if !curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, errors.New("invalid_ec_point")
+	}
+	return pub, nil
+}
+
+// es256ToASN1 converts a JWS ES256 signature (32-byte R || 32-byte S) into
+// the DER form expected by ecdsa.VerifyASN1.
+func es256ToASN1(sig []byte) ([]byte, error) {
+	if len(sig) != 64 {
+		return nil, errors.New("invalid_signature")
+	}
+	return asn1.Marshal(struct{ R, S *big.Int }{
+		R: new(big.Int).SetBytes(sig[:32]),
+		S: new(big.Int).SetBytes(sig[32:]),
+	})
+}
+
 func validateJWT(cfg *authConfig, token string) (map[string]any, error) {
 	parts := strings.Split(token, ".")
 	if len(parts) != 3 {
@@ -1991,6 +2583,9 @@ func validateJWT(cfg *authConfig, token string) (map[string]any, error) {
 	if err := json.Unmarshal(hBytes, &hdr); err != nil {
 		return nil, errors.New("invalid_header")
 	}
+	if err := checkJWTHeader(cfg, hdr); err != nil {
+		return nil, err
+	}
 
 	pBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
 	if err != nil {
@@ -2011,37 +2606,118 @@ func validateJWT(cfg *authConfig, token string) (map[string]any, error) {
 		return nil, errors.New("invalid_signature")
 	}
 
-	alg := strings.ToUpper(hdr.Alg)
-	switch alg {
+	switch hdr.Alg {
 	case "RS256":
-		if cfg.JWKS == nil {
-			return nil, errors.New("jwks_not_configured")
+		pub, err := cfg.JWKS.getKey(hdr.Kid)
+		if err != nil {
+			return nil, err
+		}
+		hash := sha256.Sum256([]byte(signed))
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], sig); err != nil {
+			return nil, errors.New("invalid_signature")
+		}
+	case "ES256":
+		pub, err := cfg.JWKS.getECKey(hdr.Kid)
+		if err != nil {
+			return nil, err
 		}
-		pub, err := cfg.JWKS.getKey(hdr.Kid)
+		der, err := es256ToASN1(sig)
 		if err != nil {
 			return nil, err
 		}
 		hash := sha256.Sum256([]byte(signed))
-		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], sig); err != nil {
+		if !ecdsa.VerifyASN1(pub, hash[:], der) {
 			return nil, errors.New("invalid_signature")
 		}
 	case "HS256":
-		if cfg.HS256Secret == "" {
-			return nil, errors.New("hs256_not_configured")
+		// During a rotation the previous secret is tried as well.
+		valid := false
+		for _, secret := range cfg.hs256Secrets() {
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write([]byte(signed))
+			if subtle.ConstantTimeCompare(mac.Sum(nil), sig) == 1 {
+				valid = true
+				break
+			}
 		}
-		mac := hmac.New(sha256.New, []byte(cfg.HS256Secret))
-		mac.Write([]byte(signed))
-		expected := mac.Sum(nil)
-		if subtle.ConstantTimeCompare(expected, sig) != 1 {
+		if !valid {
 			return nil, errors.New("invalid_signature")
 		}
 	default:
 		return nil, errors.New("unsupported_alg")
 	}
 
+	if cfg.Revoked != nil {
+		sub, _ := claims["sub"].(string)
+		if cfg.Revoked.revoked(sub, tokenID(claims)) {
+			return nil, errors.New("token_revoked")
+		}
+	}
 	return claims, nil
 }
 
+// supportedJWTAlgs are the algorithms validateJWT can verify.
+var supportedJWTAlgs = map[string]bool{"RS256": true, "ES256": true, "HS256": true}
+
+const defaultJWTAlgs = "RS256,ES256,HS256"
+
+// parseJWTAlgs reads an AUTH_JWT_ALGS list. Names are case-sensitive, as in
+// RFC 7518. "none" and algorithms the gateway cannot verify are left out and
+// reported in the error; an empty result refuses every token.
+func parseJWTAlgs(spec string) (map[string]bool, error) {
+	out := make(map[string]bool)
+	var bad []string
+	for _, alg := range splitCSV(spec) {
+		if !supportedJWTAlgs[alg] {
+			bad = append(bad, alg)
+			continue
+		}
+		out[alg] = true
+	}
+	if len(bad) > 0 {
+		return out, fmt.Errorf("unsupported algorithms ignored: %s", strings.Join(bad, ","))
+	}
+	return out, nil
+}
+
+// jwtTypAllowed accepts the typ values of a JWT access token (RFC 7519,
+// RFC 9068). typ is optional, but a token typed as something else, e.g. an
+// ID token or a JWE, is not a bearer credential here.
+func jwtTypAllowed(typ string) bool {
+	switch strings.ToLower(typ) {
+	case "", "jwt", "at+jwt", "application/at+jwt":
+		return true
+	}
+	return false
+}
+
+// checkJWTHeader refuses a token on its header alone, before any key is
+// looked up: alg "none", algorithms outside AllowedAlgs, and algorithms whose
+// key material is not configured. The last one blocks algorithm confusion:
+// an HS256 token is never checked against JWKS keys and an RS256/ES256 token
+// never against the shared secret.
+func checkJWTHeader(cfg *authConfig, hdr jwtHeader) error {
+	if !jwtTypAllowed(hdr.Typ) {
+		return errors.New("invalid_typ")
+	}
+	switch {
+	case hdr.Alg == "" || strings.EqualFold(hdr.Alg, "none"):
+		return errors.New("alg_none")
+	case !supportedJWTAlgs[hdr.Alg]:
+		return errors.New("unsupported_alg")
+	case cfg.AllowedAlgs != nil && !cfg.AllowedAlgs[hdr.Alg]:
+		return errors.New("alg_not_allowed")
+	}
+	if hdr.Alg == "HS256" {
+		if cfg.HS256Secret == "" && cfg.HS256Cache == nil {
+			return errors.New("hs256_not_configured")
+		}
+	} else if cfg.JWKS == nil {
+		return errors.New("jwks_not_configured")
+	}
+	return nil
+}
+
 func validateClaims(cfg *authConfig, claims map[string]any) bool {
 	if cfg.Issuer != "" {
 		if iss, _ := claims["iss"].(string); iss != cfg.Issuer {
@@ -2110,11 +2786,21 @@ func numClaim(claims map[string]any, key string) (int64, bool) {
 
 // --- Rate limiter ---
 
+// rateLimiter keeps authenticated tenants in their own bucket space
+// (tenant@principal) so one tenant cannot drain another's allowance;
+// callers without a tenant fall back to principal/IP buckets. Paths matching
+// a rule get their own bucket per caller with the rule's rps/burst.
 type rateLimiter struct {
-	rps   int
-	burst int
-	mu    sync.Mutex
-	bkt   map[string]*tokenBucket
+	rps         int
+	burst       int
+	tenantRPS   int
+	tenantBurst int
+	rules       []rateRule
+	idle        time.Duration
+	now         func() time.Time
+	mu          sync.Mutex
+	bkt         map[string]*tokenBucket
+	tenantBkt   map[string]*tokenBucket
 }
 
 type tokenBucket struct {
@@ -2124,35 +2810,208 @@ type tokenBucket struct {
 	ratePS float64
 }
 
-func newRateLimiter(rps, burst int) *rateLimiter {
+// rateRule overrides the limits for one route. A pattern ending in "/*"
+// matches the prefix and everything below it; otherwise the match is exact.
+type rateRule struct {
+	pattern string
+	prefix  bool
+	rps     int
+	burst   int
+}
+
+type rateDecision struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	retryAfter time.Duration
+	reset      time.Time // when the bucket is full again
+}
+
+func newRateLimiter(rps, burst int, rules ...rateRule) *rateLimiter {
 	if rps < 1 {
 		rps = defaultRateLimitRPS
 	}
 	if burst < 1 {
 		burst = defaultRateLimitBurst
 	}
-	return &rateLimiter{rps: rps, burst: burst, bkt: make(map[string]*tokenBucket)}
+	return &rateLimiter{
+		rps:         rps,
+		burst:       burst,
+		tenantRPS:   rps,
+		tenantBurst: burst,
+		rules:       rules,
+		idle:        defaultRateLimitIdle,
+		now:         time.Now,
+		bkt:         make(map[string]*tokenBucket),
+		tenantBkt:   make(map[string]*tokenBucket),
+	}
+}
+
+// evictIdle drops buckets untouched for longer than rl.idle and already
+// refilled, so a fresh one on the next request behaves the same. A slow rule
+// (say 1 rps with a burst of 1000) can take longer than the idle window to
+// refill; its bucket is kept until it has.
+func (rl *rateLimiter) evictIdle() int {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := rl.now()
+	cutoff := now.Add(-rl.idle)
+	n := 0
+	for _, buckets := range []map[string]*tokenBucket{rl.bkt, rl.tenantBkt} {
+		for k, b := range buckets {
+			if b.last.Before(cutoff) && !now.Before(b.fullAt()) {
+				delete(buckets, k)
+				n++
+			}
+		}
+	}
+	metricsRateLimitBuckets(len(rl.bkt) + len(rl.tenantBkt))
+	return n
+}
+
+// runEvictor sweeps idle buckets every half idle window until ctx is done.
+func (rl *rateLimiter) runEvictor(ctx context.Context) {
+	interval := rl.idle / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if n := rl.evictIdle(); n > 0 {
+				slog.Info("rate_limit_buckets_evicted", "count", n)
+			}
+		}
+	}
+}
+
+// parseRateRules parses RATE_LIMIT_RULES, e.g. "/api/crypto/*=50:100,/api/reports=5:10".
+// Entries may also be written path:rps:burst ("/api/crypto/*:2:4"), the
+// RATE_LIMIT_OVERRIDES form. Invalid entries are skipped and reported in the
+// returned error.
+func parseRateRules(spec string) ([]rateRule, error) {
+	rules := make([]rateRule, 0)
+	var bad []string
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, limits, ok := strings.Cut(entry, "=")
+		if !ok {
+			// path:rps:burst; the path itself may contain colons.
+			if i := strings.LastIndex(entry, ":"); i > 0 {
+				if j := strings.LastIndex(entry[:i], ":"); j > 0 {
+					pattern, limits, ok = entry[:j], entry[j+1:], true
+				}
+			}
+		}
+		pattern = strings.TrimSpace(pattern)
+		rpsStr, burstStr, ok2 := strings.Cut(limits, ":")
+		rps, err1 := strconv.Atoi(strings.TrimSpace(rpsStr))
+		burst, err2 := strconv.Atoi(strings.TrimSpace(burstStr))
+		if !ok || !ok2 || !strings.HasPrefix(pattern, "/") || err1 != nil || err2 != nil || rps < 1 || burst < 1 {
+			bad = append(bad, entry)
+			continue
+		}
+		rule := rateRule{pattern: pattern, rps: rps, burst: burst}
+		if strings.HasSuffix(pattern, "/*") {
+			rule.prefix = true
+			rule.pattern = strings.TrimSuffix(pattern, "/*")
+		}
+		rules = append(rules, rule)
+	}
+	if len(bad) > 0 {
+		return rules, fmt.Errorf("invalid rate limit rules: %s", strings.Join(bad, ","))
+	}
+	return rules, nil
+}
+
+// matchRule returns the most specific rule for path.
+func (rl *rateLimiter) matchRule(path string) (rateRule, bool) {
+	var best rateRule
+	found := false
+	for _, rule := range rl.rules {
+		match := path == rule.pattern
+		if rule.prefix && !match {
+			match = strings.HasPrefix(path, rule.pattern+"/")
+		}
+		if match && (!found || len(rule.pattern) > len(best.pattern) || (len(rule.pattern) == len(best.pattern) && !rule.prefix)) {
+			best, found = rule, true
+		}
+	}
+	return best, found
+}
+
+func (rl *rateLimiter) setTenantLimits(rps, burst int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rps >= 1 {
+		rl.tenantRPS = rps
+	}
+	if burst >= 1 {
+		rl.tenantBurst = burst
+	}
 }
 
-func (rl *rateLimiter) allow(key string) bool {
+func (rl *rateLimiter) allow(tenant, key, path string) rateDecision {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
-	b, ok := rl.bkt[key]
+	buckets, rps, burst := rl.bkt, rl.rps, rl.burst
+	if tenant != "" {
+		buckets, rps, burst = rl.tenantBkt, rl.tenantRPS, rl.tenantBurst
+		key = tenant + "@" + key
+	}
+	if rule, ok := rl.matchRule(path); ok {
+		rps, burst = rule.rps, rule.burst
+		route := rule.pattern
+		if rule.prefix {
+			route += "/*"
+		}
+		key = route + " " + key
+	}
+	now := rl.now()
+	b, ok := buckets[key]
 	if !ok {
-		b = &tokenBucket{last: time.Now(), tokens: float64(rl.burst), burst: float64(rl.burst), ratePS: float64(rl.rps)}
-		rl.bkt[key] = b
+		b = &tokenBucket{last: now, tokens: float64(burst), burst: float64(burst), ratePS: float64(rps)}
+		buckets[key] = b
+		metricsRateLimitBuckets(len(rl.bkt) + len(rl.tenantBkt))
 	}
-	now := time.Now()
 	delta := now.Sub(b.last).Seconds()
 	b.tokens = minf(b.burst, b.tokens+delta*b.ratePS)
 	b.last = now
 	if b.tokens < 1 {
-		return false
+		wait := time.Duration((1 - b.tokens) / b.ratePS * float64(time.Second))
+		return rateDecision{limit: burst, retryAfter: wait, reset: b.fullAt()}
 	}
 	b.tokens -= 1
-	return true
+	return rateDecision{allowed: true, limit: burst, remaining: int(math.Floor(b.tokens)), reset: b.fullAt()}
+}
+
+// fullAt is when the bucket will have refilled to burst.
+func (b *tokenBucket) fullAt() time.Time {
+	return b.last.Add(time.Duration((b.burst - b.tokens) / b.ratePS * float64(time.Second)))
 }
 
+// rateLimitJitter is added to the exact wait in retry_after_ms, so clients
+// throttled in the same instant do not all come back in the same one: up to
+// a quarter of the wait, and at least up to 100ms.
+var rateLimitJitter = func(wait time.Duration) time.Duration {
+	max := wait / 4
+	if max < 100*time.Millisecond {
+		max = 100 * time.Millisecond
+	}
+	return time.Duration(mrand.Int64N(int64(max) + 1))
+}
+
+// withRateLimit answers 429 rate_limited once the caller's bucket is empty.
+// Retry-After is the wait for the next token in whole seconds, rounded up;
+// retry_after_ms in the body is the same wait to the millisecond plus
+// rateLimitJitter, for clients that can schedule more finely.
 func withRateLimit(rl *rateLimiter) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -2160,26 +3019,35 @@ func withRateLimit(rl *rateLimiter) func(http.Handler) http.Handler {
 				w.WriteHeader(http.StatusNoContent)
 				return
 			}
-			key := rateKey(r)
-			if !rl.allow(key) {
-				writeJSON(w, http.StatusTooManyRequests, map[string]any{"error": "rate_limited"})
+			d := rl.allow(tenantFromContext(r.Context()), rateKey(r), r.URL.Path)
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(d.limit))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(int64(math.Ceil(float64(d.reset.UnixNano())/float64(time.Second))), 10))
+			if !d.allowed {
+				secs := int64(math.Ceil(d.retryAfter.Seconds()))
+				if secs < 1 {
+					secs = 1
+				}
+				w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+				w.Header().Set("X-RateLimit-Remaining", "0")
+				hint := d.retryAfter + rateLimitJitter(d.retryAfter)
+				writeJSON(w, http.StatusTooManyRequests, map[string]any{"error": "rate_limited", "retry_after_seconds": secs, "retry_after_ms": hint.Milliseconds()})
 				return
 			}
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(d.remaining))
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// rateKey is the caller's principal or, for anonymous requests, the client
+// address withIPFilter resolved. X-Forwarded-For is never read here: only
+// the IP filter knows which peers may set it.
 func rateKey(r *http.Request) string {
 	if p := principalFromContext(r.Context()); p != "" {
-		if t := tenantFromContext(r.Context()); t != "" {
-			return p + "@tenant:" + t
-		}
 		return p
 	}
-	if xf := strings.TrimSpace(r.Header.Get("X-Forwarded-For")); xf != "" {
-		parts := strings.Split(xf, ",")
-		return "ip:" + strings.TrimSpace(parts[0])
+	if ip := clientIPFromContext(r.Context()); ip != nil {
+		return "ip:" + ip.String()
 	}
 	host, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err == nil {
@@ -2193,6 +3061,8 @@ func rateKey(r *http.Request) string {
 type statusRecorder struct {
 	http.ResponseWriter
 	status int
+	// bytes counts body bytes as sent to the client, after compression.
+	bytes int64
 }
 
 func (r *statusRecorder) WriteHeader(code int) {
@@ -2200,12 +3070,20 @@ func (r *statusRecorder) WriteHeader(code int) {
 	r.ResponseWriter.WriteHeader(code)
 }
 
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
 func (r *statusRecorder) Flush() {
 	if f, ok := r.ResponseWriter.(http.Flusher); ok {
 		f.Flush()
 	}
 }
 
+func (r *statusRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
 func withRequestID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		rid := strings.TrimSpace(r.Header.Get("X-Request-ID"))
@@ -2222,18 +3100,31 @@ func withLogging(next http.Handler, audit *auditStore) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		info := &requestLog{}
+		r = r.WithContext(context.WithValue(r.Context(), ctxRequestLog, info))
 		next.ServeHTTP(rec, r)
 		dur := time.Since(start).Milliseconds()
 		ts := time.Now().UTC().Format(time.RFC3339)
 		rid := strings.TrimSpace(r.Header.Get("X-Request-ID"))
-		metricsRecord(rec.status, dur)
-		fmt.Fprintf(os.Stdout, "%s method=%s path=%s status=%d duration_ms=%d request_id=%s\n",
-			ts, r.Method, r.URL.Path, rec.status, dur, rid)
+		tc, _ := traceFromContext(r.Context())
+		metricsRecord(r.URL.Path, rec.status, dur)
+		slog.InfoContext(r.Context(), "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", dur,
+			"bytes", rec.bytes,
+			"request_id", rid,
+			"trace_id", tc.TraceID,
+			"trace_sampled", tc.sampled(),
+			"principal", info.principal,
+		)
 		if audit != nil {
 			outcome := "success"
 			if rec.status >= 400 {
 				outcome = "error"
 			}
+			category, severity := classifyAuditEvent(rec.status)
 			audit.add(auditEvent{
 				EventID:   fmt.Sprintf("%d", time.Now().UnixNano()),
 				EventTS:   ts,
@@ -2241,32 +3132,22 @@ func withLogging(next http.Handler, audit *auditStore) http.Handler {
 				Outcome:   outcome,
 				ObjectKey: r.URL.Path,
 				RequestID: rid,
-				ActorID:   principalFromContext(r.Context()),
+				ActorID:   info.principal,
 				Source:    "gateway",
+				Severity:  severity,
+				Category:  category,
 				Detail: map[string]any{
 					"status":      rec.status,
 					"duration_ms": dur,
+					"bytes":       rec.bytes,
+					"trace_id":    tc.TraceID,
 				},
+				SSEEventIDs: info.sseEventIDs,
 			})
 		}
 	})
 }
 
-func withCORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,DELETE,OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Request-ID, X-API-Key, Authorization, X-Tenant-ID")
-		w.Header().Set("Access-Control-Max-Age", "86400")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
-}
-
 func mustUUIDv4() string {
 	var b [16]byte
 	_, _ = rand.Read(b[:])
@@ -2276,24 +3157,6 @@ func mustUUIDv4() string {
 	return fmt.Sprintf("%s-%s-%s-%s-%s", s[0:8], s[8:12], s[12:16], s[16:20], s[20:32])
 }
 
-func logLine(level, msg, format string, args ...any) {
-	ts := time.Now().UTC().Format(time.RFC3339)
-	line := fmt.Sprintf(format, args...)
-	fmt.Fprintf(os.Stdout, "%s %s %s %s\n", ts, level, msg, line)
-}
-
-func loadConnectorCatalog() connectorCatalog {
-	var cat connectorCatalog
-	if len(connectorCatalogYAML) == 0 {
-		return cat
-	}
-	if err := yaml.Unmarshal(connectorCatalogYAML, &cat); err != nil {
-		logLine("WARN", "connector_catalog_parse_failed", "err=%s", err.Error())
-		return connectorCatalog{}
-	}
-	return cat
-}
-
 func buildConnectorList(cat connectorCatalog) []connectorPublic {
 	out := make([]connectorPublic, 0, len(cat.Connectors))
 	for _, c := range cat.Connectors {
@@ -2318,6 +3181,70 @@ func buildConnectorList(cat connectorCatalog) []connectorPublic {
 	return out
 }
 
+type connectorKindGroup struct {
+	Kind       string            `json:"kind"`
+	Count      int               `json:"count"`
+	Connectors []connectorPublic `json:"connectors"`
+}
+
+type connectorFacet struct {
+	Capability string `json:"capability"`
+	Count      int    `json:"count"`
+}
+
+// groupConnectorsByKind groups an ID-sorted connector list by kind, keeping
+// connector order within each group.
+func groupConnectorsByKind(list []connectorPublic) []connectorKindGroup {
+	idx := make(map[string]int)
+	out := make([]connectorKindGroup, 0)
+	for _, c := range list {
+		i, ok := idx[c.Kind]
+		if !ok {
+			i = len(out)
+			idx[c.Kind] = i
+			out = append(out, connectorKindGroup{Kind: c.Kind})
+		}
+		out[i].Count++
+		out[i].Connectors = append(out[i].Connectors, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Kind < out[j].Kind })
+	return out
+}
+
+func connectorCapabilityFacets(list []connectorPublic) []connectorFacet {
+	counts := make(map[string]int)
+	for _, c := range list {
+		for _, capName := range c.Capabilities {
+			counts[capName]++
+		}
+	}
+	out := make([]connectorFacet, 0, len(counts))
+	for k, n := range counts {
+		out = append(out, connectorFacet{Capability: k, Count: n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Capability < out[j].Capability
+	})
+	return out
+}
+
+func paginateConnectors(list []connectorPublic, offset, limit int) []connectorPublic {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(list) || limit <= 0 {
+		return []connectorPublic{}
+	}
+	end := offset + limit
+	if end > len(list) {
+		end = len(list)
+	}
+	return list[offset:end]
+}
+
 func connectorExists(cat connectorCatalog, id string) bool {
 	id = strings.TrimSpace(id)
 	if id == "" {
@@ -2331,11 +3258,35 @@ func connectorExists(cat connectorCatalog, id string) bool {
 	return false
 }
 
+// connectorSchema returns the schema a connector's config is validated
+// against: the catalog entry's own schema when it has one, otherwise
+// defaultConnectorSchema.
+func connectorSchema(cat connectorCatalog, id string) map[string]any {
+	id = strings.TrimSpace(id)
+	for _, c := range cat.Connectors {
+		if !strings.EqualFold(strings.TrimSpace(c.ID), id) || len(c.Schema) == 0 {
+			continue
+		}
+		out := map[string]any{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"title":   fmt.Sprintf("Connector %s", id),
+			"type":    "object",
+		}
+		for k, v := range c.Schema {
+			out[k] = v
+		}
+		return out
+	}
+	return defaultConnectorSchema(id)
+}
+
 func defaultConnectorSchema(id string) map[string]any {
 	return map[string]any{
 		"$schema": "https://json-schema.org/draft/2020-12/schema",
 		"title":   fmt.Sprintf("Connector %s", id),
 		"type":    "object",
+		// Unknown keys are almost always typos ("enabeld"); reject them.
+		"additionalProperties": false,
 		"properties": map[string]any{
 			"enabled": map[string]any{
 				"type":        "boolean",
@@ -2345,18 +3296,29 @@ func defaultConnectorSchema(id string) map[string]any {
 				"type":        "string",
 				"description": "Operator notes",
 			},
+			"api_key": map[string]any{
+				"type":        "secret",
+				"description": "Credential for the upstream API; stored encrypted",
+			},
 		},
 	}
 }
 
 // --- helpers ---
 
-func startEventLoops(hub *sseHub, health *healthCache, reg, agg, coo, rep, ana string) {
+// startEventLoops publishes heartbeat, tick, results and insights events
+// until ctx is done.
+func startEventLoops(ctx context.Context, hub *sseHub, health *healthCache, targets *liveHealthTargets, agg func() string) {
 	go func() {
 		heartbeat := time.NewTicker(2 * time.Second)
 		defer heartbeat.Stop()
-		for range heartbeat.C {
-			services := checkAllDetailed(reg, agg, coo, rep, ana).Services
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-heartbeat.C:
+			}
+			services := checkAllDetailed(ctx, targets.snapshot()).Services
 			snap := health.update(services)
 			hub.publish("heartbeat", map[string]any{
 				"status":   snap.Status,
@@ -2369,7 +3331,12 @@ func startEventLoops(hub *sseHub, health *healthCache, reg, agg, coo, rep, ana s
 	go func() {
 		tick := time.NewTicker(5 * time.Second)
 		defer tick.Stop()
-		for range tick.C {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C:
+			}
 			hub.publish("tick", map[string]any{"ts": time.Now().UTC().Format(time.RFC3339)})
 		}
 	}()
@@ -2379,17 +3346,27 @@ func startEventLoops(hub *sseHub, health *healthCache, reg, agg, coo, rep, ana s
 		var lastIndex string
 		tick := time.NewTicker(10 * time.Second)
 		defer tick.Stop()
-		for range tick.C {
-			total, ts, ok := fetchResultSummary(context.Background(), agg)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C:
+			}
+			total, ts, ok := fetchResultSummary(ctx, agg())
 			if ok && total != lastTotal {
 				lastTotal = total
-				hub.publish("results", map[string]any{
+				payload := map[string]any{
 					"ts":            time.Now().UTC().Format(time.RFC3339),
 					"total_results": total,
-					"last_updated":  ts,
-				})
+				}
+				if ts != "" {
+					payload["updated_at"] = ts
+					// Deprecated alias for updated_at; drop after the next release.
+					payload["last_updated"] = ts
+				}
+				hub.publish("results", payload)
 			}
-			if idx := fetchReportUpdated(context.Background(), agg); idx != "" && idx != lastIndex {
+			if idx := fetchReportUpdated(ctx, agg()); idx != "" && idx != lastIndex {
 				lastIndex = idx
 				hub.publish("insights", map[string]any{
 					"ts":         time.Now().UTC().Format(time.RFC3339),
@@ -2400,17 +3377,34 @@ func startEventLoops(hub *sseHub, health *healthCache, reg, agg, coo, rep, ana s
 	}()
 }
 
-func startCryptoCacheLoop(cache *cryptoCache) {
+// startCryptoCacheLoop refreshes the ticker cache until ctx is done, every
+// cryptoPollInterval while the providers answer and backing off
+// exponentially (see cryptoPollDelay) while they fail.
+func startCryptoCacheLoop(ctx context.Context, cache *cryptoCache) {
 	go func() {
-		ticker := time.NewTicker(2 * time.Second)
-		defer ticker.Stop()
-		for range ticker.C {
-			ticks, err := fetchBinanceTickers(context.Background())
+		wait := cryptoPollInterval
+		for {
+			cache.scheduled(wait, time.Now())
+			t := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return
+			case <-t.C:
+			}
+			ticks, source, err := marketData.tickers(ctx)
 			if err != nil {
-				cache.set(nil, err.Error())
-				continue
+				if ctx.Err() != nil {
+					return
+				}
+				cache.set(nil, "", err.Error())
+				if n := cache.consecutiveFailures(); n == 1 || n%10 == 0 {
+					slog.Warn("crypto_cache_refresh_failed", "failures", n, "err", err)
+				}
+			} else {
+				cache.set(ticks, source, "")
 			}
-			cache.set(ticks, "")
+			wait = cryptoPollDelay(cache.consecutiveFailures())
 		}
 	}()
 }
@@ -2489,19 +3483,42 @@ func clampInt(v, minV, maxV int) int {
 }
 
 func buildSummary(ctx context.Context, regURL, aggURL string) (map[string]any, error) {
+	// A throttled aggregator must not leave zero totals in the summary cache.
+	if err := upstreamBackoffs.check(aggURL); err != nil {
+		return nil, err
+	}
 	total, lastUpdated := fetchSummaryTotals(ctx, aggURL)
+	if err := upstreamBackoffs.check(aggURL); err != nil {
+		return nil, err
+	}
 	profiles := fetchProfilesCount(ctx, regURL)
-	return map[string]any{
+	data := map[string]any{
 		"total_results":   total,
 		"active_profiles": profiles,
-		"last_updated":    lastUpdated,
 		"generated_at":    time.Now().UTC().Format(time.RFC3339),
-	}, nil
+	}
+	if t, ok := parseTimeRFC3339(lastUpdated); ok {
+		data["updated_at"] = t.UTC().Format(time.RFC3339)
+		// Deprecated alias for updated_at; drop after the next release.
+		data["last_updated"] = data["updated_at"]
+	}
+	return data, nil
+}
+
+// applySummaryFreshness sets age_ms and data_status on a summary, which can
+// come out of the cache long after it was built.
+func applySummaryFreshness(data map[string]any, now time.Time) {
+	var updated time.Time
+	if t, ok := parseTimeRFC3339(asString(data["updated_at"])); ok {
+		updated = t
+	}
+	freshnessAt(updated, resultsStaleAfter, now).apply(data)
 }
 
 func fetchProfilesCount(ctx context.Context, regURL string) int {
 	u := strings.TrimSuffix(regURL, "/") + "/profiles"
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	injectTrace(req)
 	c := &http.Client{Timeout: 4 * time.Second}
 	resp, err := c.Do(req)
 	if err != nil {
@@ -2511,7 +3528,7 @@ func fetchProfilesCount(ctx context.Context, regURL string) int {
 	if resp.StatusCode/100 != 2 {
 		return 0
 	}
-	body, err := io.ReadAll(resp.Body)
+	body, err := readUpstreamBody(resp.Body)
 	if err != nil {
 		return 0
 	}
@@ -2529,39 +3546,47 @@ func fetchProfilesCount(ctx context.Context, regURL string) int {
 	return 0
 }
 
+// fetchSummaryTotals returns the result count and the newest result's
+// timestamp, "" when there are no results or the aggregator did not answer.
 func fetchSummaryTotals(ctx context.Context, aggURL string) (int, string) {
 	u := strings.TrimSuffix(aggURL, "/") + "/results/summary"
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	injectTrace(req)
 	c := &http.Client{Timeout: 4 * time.Second}
 	resp, err := c.Do(req)
 	if err != nil {
-		return 0, time.Now().UTC().Format(time.RFC3339)
+		return 0, ""
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		upstreamBackoffs.throttled(aggURL, resp)
+		return 0, ""
+	}
 	if resp.StatusCode/100 != 2 {
-		return 0, time.Now().UTC().Format(time.RFC3339)
+		return 0, ""
 	}
 	var sum map[string]any
 	if err := json.NewDecoder(resp.Body).Decode(&sum); err != nil {
-		return 0, time.Now().UTC().Format(time.RFC3339)
+		return 0, ""
 	}
 	total, _ := asInt(sum["total_results"])
-	last := fetchLatestResultTS(ctx, aggURL)
-	if last == "" {
-		last = time.Now().UTC().Format(time.RFC3339)
-	}
-	return total, last
+	return total, fetchLatestResultTS(ctx, aggURL)
 }
 
 func fetchLatestResultTS(ctx context.Context, aggURL string) string {
 	u := strings.TrimSuffix(aggURL, "/") + "/results?limit=1"
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	injectTrace(req)
 	c := &http.Client{Timeout: 4 * time.Second}
 	resp, err := c.Do(req)
 	if err != nil {
 		return ""
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		upstreamBackoffs.throttled(aggURL, resp)
+		return ""
+	}
 	if resp.StatusCode/100 != 2 {
 		return ""
 	}
@@ -2598,6 +3623,7 @@ func fetchReportUpdated(ctx context.Context, aggURL string) string {
 func fetchCryptoSymbols(ctx context.Context, cryptoURL string) (any, string, error) {
 	target := strings.TrimSuffix(cryptoURL, "/") + "/symbols"
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	injectTrace(req)
 	c := &http.Client{Timeout: 5 * time.Second}
 	resp, err := c.Do(req)
 	if err == nil && resp != nil {
@@ -2613,39 +3639,8 @@ func fetchCryptoSymbols(ctx context.Context, cryptoURL string) (any, string, err
 	return []string{}, "unavailable", nil
 }
 
-func fetchBinanceSymbols(ctx context.Context) ([]string, error) {
-	// Use binance.vision to avoid geo-blocks on api.binance.com.
-	u := "https://data-api.binance.vision/api/v3/exchangeInfo"
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
-	c := &http.Client{Timeout: 6 * time.Second}
-	resp, err := c.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode/100 != 2 {
-		return nil, fmt.Errorf("non_2xx")
-	}
-	var info struct {
-		Symbols []struct {
-			Symbol string `json:"symbol"`
-			Status string `json:"status"`
-		} `json:"symbols"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
-		return nil, err
-	}
-	out := make([]string, 0, len(info.Symbols))
-	for _, s := range info.Symbols {
-		if s.Symbol == "" || strings.ToUpper(s.Status) != "TRADING" {
-			continue
-		}
-		out = append(out, s.Symbol)
-	}
-	sort.Strings(out)
-	return out, nil
-}
-
+// binanceTicker is Binance's 24h ticker; every market data provider
+// normalizes into it.
 type binanceTicker struct {
 	Symbol             string `json:"symbol"`
 	LastPrice          string `json:"lastPrice"`
@@ -2668,34 +3663,41 @@ type cryptoTopRow struct {
 	Low       float64 `json:"low"`
 	Open      float64 `json:"open"`
 	Updated   string  `json:"updated"`
+	Source    string  `json:"source,omitempty"` // market data provider
+	// StaleSeconds is set when the cached snapshot is overdue; see
+	// cryptoStaleSeconds.
+	StaleSeconds int64 `json:"stale_seconds,omitempty"`
 }
 
-func fetchBinanceTickers(ctx context.Context) ([]binanceTicker, error) {
-	// Use binance.vision to avoid geo-blocks on api.binance.com.
-	u := "https://data-api.binance.vision/api/v3/ticker/24hr"
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
-	c := &http.Client{Timeout: 6 * time.Second}
-	resp, err := c.Do(req)
+// fetchMarketTop computes the top movers from a live fetch, for when the
+// ticker cache is still empty. It also names the provider that answered.
+func fetchMarketTop(ctx context.Context, limit int, direction, suffix string, minQuote float64) ([]cryptoTopRow, string, error) {
+	ticks, source, err := marketData.tickers(ctx)
 	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode/100 != 2 {
-		return nil, fmt.Errorf("non_2xx")
-	}
-	var ticks []binanceTicker
-	if err := json.NewDecoder(resp.Body).Decode(&ticks); err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	return ticks, nil
+	return computeTopFromTickers(ticks, limit, direction, suffix, minQuote), source, nil
 }
 
-func fetchBinanceTop(ctx context.Context, limit int, direction, suffix string, minQuote float64) ([]cryptoTopRow, error) {
-	ticks, err := fetchBinanceTickers(ctx)
-	if err != nil {
-		return nil, err
+// cryptoStreamPayload is one "tickers" event of /api/crypto/stream.
+func cryptoStreamPayload(rows []cryptoTopRow, updated time.Time, errMsg string, now time.Time) map[string]any {
+	payload := map[string]any{
+		"ts":   now.UTC().Format(time.RFC3339),
+		"rows": rows,
+	}
+	fresh := freshnessAt(updated, cryptoStaleAfter, now)
+	fresh.apply(payload)
+	if fresh.AgeMs != nil {
+		// Deprecated alias for updated_at; drop after the next release.
+		payload["updated"] = fresh.UpdatedAt
+	}
+	if errMsg != "" {
+		payload["error"] = errMsg
 	}
-	return computeTopFromTickers(ticks, limit, direction, suffix, minQuote), nil
+	if stale, ok := cryptoStaleSeconds(updated, now); ok {
+		payload["stale_seconds"] = stale
+	}
+	return payload
 }
 
 func computeTopFromTickers(ticks []binanceTicker, limit int, direction, suffix string, minQuote float64) []cryptoTopRow {
@@ -2745,20 +3747,17 @@ func computeTopFromTickers(ticks []binanceTicker, limit int, direction, suffix s
 	return out
 }
 
-func buildIndexFromBinance(ctx context.Context) (struct {
+// indexPoint is one point of the crypto index series.
+type indexPoint struct {
 	T string  `json:"t"`
 	Y float64 `json:"y"`
-}, bool) {
-	ticks, err := fetchBinanceTickers(ctx)
-	if err != nil || len(ticks) == 0 {
-		return struct {
-			T string  `json:"t"`
-			Y float64 `json:"y"`
-		}{}, false
-	}
+}
+
+// topUSDTSymbols returns up to n USDT pairs with a price, most traded first.
+func topUSDTSymbols(ticks []binanceTicker, n int) []string {
 	type ranked struct {
-		price float64
-		qv    float64
+		symbol string
+		qv     float64
 	}
 	top := make([]ranked, 0, 50)
 	for _, t := range ticks {
@@ -2770,31 +3769,45 @@ func buildIndexFromBinance(ctx context.Context) (struct {
 		if qv <= 0 || price <= 0 {
 			continue
 		}
-		top = append(top, ranked{price: price, qv: qv})
+		top = append(top, ranked{symbol: t.Symbol, qv: qv})
 	}
 	sort.Slice(top, func(i, j int) bool { return top[i].qv > top[j].qv })
-	if len(top) > 10 {
-		top = top[:10]
+	if len(top) > n {
+		top = top[:n]
+	}
+	out := make([]string, len(top))
+	for i, r := range top {
+		out[i] = r.symbol
+	}
+	return out
+}
+
+// buildIndexFromMarket is the last resort for the index: one point, the mean
+// last price of the ten most traded USDT pairs.
+func buildIndexFromMarket(ctx context.Context) (indexPoint, bool) {
+	ticks, _, err := marketData.tickers(ctx)
+	if err != nil || len(ticks) == 0 {
+		return indexPoint{}, false
+	}
+	prices := map[string]float64{}
+	for _, t := range ticks {
+		prices[t.Symbol], _ = asFloat(t.LastPrice)
 	}
+	top := topUSDTSymbols(ticks, 10)
 	if len(top) == 0 {
-		return struct {
-			T string  `json:"t"`
-			Y float64 `json:"y"`
-		}{}, false
+		return indexPoint{}, false
 	}
 	var sum float64
-	for _, r := range top {
-		sum += r.price
+	for _, sym := range top {
+		sum += prices[sym]
 	}
-	return struct {
-		T string  `json:"t"`
-		Y float64 `json:"y"`
-	}{T: time.Now().UTC().Format(time.RFC3339), Y: sum / float64(len(top))}, true
+	return indexPoint{T: time.Now().UTC().Format(time.RFC3339), Y: sum / float64(len(top))}, true
 }
 
 func checkCryptoHealth(ctx context.Context, cryptoURL string) (string, int, error) {
 	target := strings.TrimSuffix(cryptoURL, "/") + "/health"
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	injectTrace(req)
 	c := &http.Client{Timeout: 3 * time.Second}
 	resp, err := c.Do(req)
 	if err != nil {
@@ -2842,6 +3855,7 @@ type apiKeyFileCache struct {
 	last    time.Time
 	modTime time.Time
 	keys    map[string]struct{}
+	scopes  map[string][]string // key hash -> scopes, for scoped lines only
 }
 
 var apiKeyCache = &apiKeyFileCache{}
@@ -2852,49 +3866,93 @@ func getAPIKeysFromFile(path string, ttl time.Duration) map[string]struct{} {
 	}
 	apiKeyCache.mu.Lock()
 	defer apiKeyCache.mu.Unlock()
+	apiKeyCache.refreshLocked(path, ttl)
+	return apiKeyCache.keys
+}
+
+// getAPIKeyFileScopes returns the scopes of keys listed with a scope suffix
+// in the key file. Bare keys are absent from the map.
+func getAPIKeyFileScopes(path string, ttl time.Duration) map[string][]string {
+	if path == "" {
+		return nil
+	}
+	apiKeyCache.mu.Lock()
+	defer apiKeyCache.mu.Unlock()
+	apiKeyCache.refreshLocked(path, ttl)
+	return apiKeyCache.scopes
+}
 
-	if apiKeyCache.path != path {
-		apiKeyCache.path = path
-		apiKeyCache.keys = nil
-		apiKeyCache.last = time.Time{}
-		apiKeyCache.modTime = time.Time{}
+func (c *apiKeyFileCache) refreshLocked(path string, ttl time.Duration) {
+	if c.path != path {
+		c.path = path
+		c.keys = nil
+		c.scopes = nil
+		c.last = time.Time{}
+		c.modTime = time.Time{}
 	}
 
-	if time.Since(apiKeyCache.last) < ttl && apiKeyCache.keys != nil {
-		return apiKeyCache.keys
+	if time.Since(c.last) < ttl && c.keys != nil {
+		return
 	}
 
 	fi, err := os.Stat(path)
 	if err != nil {
-		apiKeyCache.keys = map[string]struct{}{}
-		apiKeyCache.last = time.Now()
-		return apiKeyCache.keys
+		c.keys, c.scopes = map[string]struct{}{}, nil
+		c.last = time.Now()
+		return
 	}
-	if apiKeyCache.modTime.Equal(fi.ModTime()) && apiKeyCache.keys != nil {
-		apiKeyCache.last = time.Now()
-		return apiKeyCache.keys
+	if c.modTime.Equal(fi.ModTime()) && c.keys != nil {
+		c.last = time.Now()
+		return
 	}
 
 	b, err := os.ReadFile(path)
 	if err != nil {
-		apiKeyCache.keys = map[string]struct{}{}
-		apiKeyCache.last = time.Now()
-		return apiKeyCache.keys
+		c.keys, c.scopes = map[string]struct{}{}, nil
+		c.last = time.Now()
+		return
 	}
-	lines := strings.Split(string(b), "\n")
+	c.keys, c.scopes = parseAPIKeyFile(string(b))
+	c.last = time.Now()
+	c.modTime = fi.ModTime()
+}
+
+// parseAPIKeyFile reads an API key file. Each line is either a bare key,
+// which holds every scope (subject to AUTH_API_KEY_SCOPES), or the sha256 of
+// a key followed by its scopes: "<sha256>:profiles:write,reports:write". A
+// key listed with an empty scope list is read-only.
+func parseAPIKeyFile(data string) (map[string]struct{}, map[string][]string) {
+	lines := strings.Split(data, "\n")
 	keys := make(map[string]struct{}, len(lines))
+	scopes := make(map[string][]string)
 	for _, line := range lines {
 		s := strings.TrimSpace(line)
 		if s == "" || strings.HasPrefix(s, "#") {
 			continue
 		}
+		if hash, list, ok := strings.Cut(s, ":"); ok && isSHA256Hex(hash) {
+			hash = strings.ToLower(hash)
+			keys[hash] = struct{}{}
+			scopes[hash] = append(scopes[hash], strings.FieldsFunc(list, func(r rune) bool {
+				return r == ',' || r == ' ' || r == '\t'
+			})...)
+			if scopes[hash] == nil {
+				scopes[hash] = []string{}
+			}
+			continue
+		}
 		h := sha256Hex([]byte(s))
 		keys[h] = struct{}{}
 	}
-	apiKeyCache.keys = keys
-	apiKeyCache.last = time.Now()
-	apiKeyCache.modTime = fi.ModTime()
-	return keys
+	return keys, scopes
+}
+
+func isSHA256Hex(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
 }
 
 func readFileString(path string) string {
@@ -2989,38 +4047,6 @@ func tenantFromClaims(cfg *authConfig, claims map[string]any) string {
 	return ""
 }
 
-// --- minimal metrics ---
-
-var metricsMu sync.Mutex
-var metricsReq int64
-var metricsErr int64
-var metricsDurMs int64
-
-func metricsRecord(status int, durMs int64) {
-	metricsMu.Lock()
-	defer metricsMu.Unlock()
-	metricsReq++
-	if status >= 400 {
-		metricsErr++
-	}
-	metricsDurMs += durMs
-}
-
-func metricsSnapshot() map[string]any {
-	metricsMu.Lock()
-	defer metricsMu.Unlock()
-	avg := int64(0)
-	if metricsReq > 0 {
-		avg = metricsDurMs / metricsReq
-	}
-	return map[string]any{
-		"requests_total":   metricsReq,
-		"errors_total":     metricsErr,
-		"avg_duration_ms":  avg,
-		"last_updated_utc": time.Now().UTC().Format(time.RFC3339),
-	}
-}
-
 // ACCEPTANCE TESTS:
 // curl http://localhost:8090/api/events
 // curl http://localhost:8090/api/reports
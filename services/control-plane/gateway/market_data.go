@@ -0,0 +1,599 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Crypto market data providers ---
+
+// marketDataProvider is a public exchange API the gateway reads tickers and
+// symbols from. Implementations normalize into binanceTicker, with symbols
+// written Binance-style as base+quote ("BTCUSDT"), so computeTopFromTickers
+// and the cache work the same whichever exchange answered.
+type marketDataProvider interface {
+	Name() string
+	Tickers(ctx context.Context) ([]binanceTicker, error)
+	Symbols(ctx context.Context) ([]symbolInfo, error)
+}
+
+// symbolInfo describes one tradable pair. Status is the exchange's own value
+// ("TRADING" on Binance, "online" on Coinbase and Kraken).
+type symbolInfo struct {
+	Symbol string `json:"symbol"`
+	Base   string `json:"base"`
+	Quote  string `json:"quote"`
+	Status string `json:"status"`
+}
+
+func symbolNames(syms []symbolInfo) []string {
+	out := make([]string, len(syms))
+	for i, s := range syms {
+		out[i] = s.Symbol
+	}
+	return out
+}
+
+// klinesProvider is implemented by providers that serve historical candles
+// for Binance-style symbols and intervals.
+type klinesProvider interface {
+	Klines(ctx context.Context, symbol, interval string, limit int) ([]kline, error)
+}
+
+// kline is one OHLCV candle; T is the candle's open time.
+type kline struct {
+	T string  `json:"t"`
+	O float64 `json:"o"`
+	H float64 `json:"h"`
+	L float64 `json:"l"`
+	C float64 `json:"c"`
+	V float64 `json:"v"`
+}
+
+// marketHTTPError is a non-2xx answer from a provider.
+type marketHTTPError struct {
+	Status int
+}
+
+func (e *marketHTTPError) Error() string { return "non_2xx" }
+
+const defaultCryptoProviders = "binance"
+
+// marketData is the provider chain used by the crypto routes, the ticker
+// cache and the crypto reports. main replaces it from CRYPTO_PROVIDER.
+var marketData = newMarketDataChain(newBinanceProvider())
+
+// marketDataChain tries its providers in order and answers with the first
+// that returns data.
+type marketDataChain struct {
+	providers []marketDataProvider
+}
+
+func newMarketDataChain(providers ...marketDataProvider) *marketDataChain {
+	return &marketDataChain{providers: providers}
+}
+
+// loadMarketData reads CRYPTO_PROVIDER, an ordered fallback list such as
+// "binance,coinbase,kraken". Unknown names are skipped with a warning.
+func loadMarketData() *marketDataChain {
+	spec := strings.TrimSpace(os.Getenv("CRYPTO_PROVIDER"))
+	if spec == "" {
+		spec = defaultCryptoProviders
+	}
+	var providers []marketDataProvider
+	for _, name := range splitCSV(spec) {
+		switch strings.ToLower(name) {
+		case "binance":
+			providers = append(providers, newBinanceProvider())
+		case "coinbase":
+			providers = append(providers, newCoinbaseProvider())
+		case "kraken":
+			providers = append(providers, newKrakenProvider())
+		default:
+			slog.Warn("crypto_provider_unknown", "provider", name)
+		}
+	}
+	if len(providers) == 0 {
+		providers = append(providers, newBinanceProvider())
+	}
+	return newMarketDataChain(providers...)
+}
+
+// tickers returns the first non-empty ticker set and the provider it came
+// from. When every provider fails the error names each failure.
+func (c *marketDataChain) tickers(ctx context.Context) ([]binanceTicker, string, error) {
+	var errs []string
+	for _, p := range c.providers {
+		ticks, err := p.Tickers(ctx)
+		if err == nil && len(ticks) > 0 {
+			return ticks, p.Name(), nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		if err == nil {
+			err = errors.New("empty")
+		}
+		errs = append(errs, p.Name()+": "+err.Error())
+	}
+	return nil, "", errors.New(strings.Join(errs, "; "))
+}
+
+// symbols is tickers for the symbol list.
+func (c *marketDataChain) symbols(ctx context.Context) ([]symbolInfo, string, error) {
+	var errs []string
+	for _, p := range c.providers {
+		syms, err := p.Symbols(ctx)
+		if err == nil && len(syms) > 0 {
+			return syms, p.Name(), nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		if err == nil {
+			err = errors.New("empty")
+		}
+		errs = append(errs, p.Name()+": "+err.Error())
+	}
+	return nil, "", errors.New(strings.Join(errs, "; "))
+}
+
+// klines returns candles from the first provider that serves them, and its
+// name.
+func (c *marketDataChain) klines(ctx context.Context, symbol, interval string, limit int) ([]kline, string, error) {
+	var errs []string
+	var last error
+	for _, p := range c.providers {
+		kp, ok := p.(klinesProvider)
+		if !ok {
+			continue
+		}
+		rows, err := kp.Klines(ctx, symbol, interval, limit)
+		if err == nil {
+			return rows, p.Name(), nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		last = err
+		errs = append(errs, p.Name()+": "+err.Error())
+	}
+	if len(errs) == 0 {
+		return nil, "", errors.New("no provider serves klines")
+	}
+	if len(errs) == 1 {
+		// Keep a lone provider's error as is, so callers can read its status.
+		return nil, "", last
+	}
+	return nil, "", errors.New(strings.Join(errs, "; "))
+}
+
+// getMarketJSON fetches url and decodes its JSON body into v.
+func getMarketJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return &marketHTTPError{Status: resp.StatusCode}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// pctChange formats (last-open)/open as the percentage string Binance sends.
+func pctChange(open, last float64) string {
+	if open == 0 {
+		return "0"
+	}
+	return strconv.FormatFloat((last-open)/open*100, 'f', 3, 64)
+}
+
+func formatPrice(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// --- Binance ---
+
+// defaultBinanceBaseURL is binance.vision, which avoids the geo-blocks on
+// api.binance.com.
+const defaultBinanceBaseURL = "https://data-api.binance.vision"
+
+// binanceFallbackDeadline bounds one read across all base URLs; each attempt
+// is also held to the client's own 6s timeout.
+const binanceFallbackDeadline = 15 * time.Second
+
+type binanceProvider struct {
+	// baseURLs are tried in order until one answers.
+	baseURLs []string
+	client   *http.Client
+	// deadline bounds one read across all of baseURLs; 0 = no bound beyond
+	// the caller's context.
+	deadline time.Duration
+}
+
+// newBinanceProvider reads BINANCE_BASE_URLS, an ordered fallback list of
+// Binance-compatible API roots such as a mirror or a local mock.
+func newBinanceProvider() *binanceProvider {
+	return &binanceProvider{
+		baseURLs: loadBinanceBaseURLs(),
+		client:   &http.Client{Timeout: 6 * time.Second},
+		deadline: binanceFallbackDeadline,
+	}
+}
+
+// loadBinanceBaseURLs parses BINANCE_BASE_URLS. Entries that are not http(s)
+// URLs are skipped with a warning; with none left the default host is used.
+func loadBinanceBaseURLs() []string {
+	var out []string
+	for _, raw := range splitCSV(os.Getenv("BINANCE_BASE_URLS")) {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			slog.Warn("binance_base_url_invalid", "url", raw)
+			continue
+		}
+		out = append(out, strings.TrimRight(raw, "/"))
+	}
+	if len(out) == 0 {
+		out = []string{defaultBinanceBaseURL}
+	}
+	return out
+}
+
+// get reads path from each base URL in turn and decodes the first success
+// into v. With a single base its error is returned as is, so callers can
+// still read a marketHTTPError; otherwise the error names each host.
+func (p *binanceProvider) get(ctx context.Context, path string, v any) error {
+	if p.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.deadline)
+		defer cancel()
+	}
+	var failed []string
+	var last error
+	lastHost := ""
+	for _, base := range p.baseURLs {
+		if last != nil {
+			failed = append(failed, lastHost+": "+last.Error())
+		}
+		last = getMarketJSON(ctx, p.client, base+path, v)
+		if last == nil {
+			return nil
+		}
+		lastHost = base
+		if u, err := url.Parse(base); err == nil {
+			lastHost = u.Host
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	switch {
+	case last == nil:
+		return errors.New("no base url")
+	case len(failed) == 0:
+		return last
+	}
+	return fmt.Errorf("%s; %s: %w", strings.Join(failed, "; "), lastHost, last)
+}
+
+func (p *binanceProvider) Name() string { return "binance" }
+
+func (p *binanceProvider) Tickers(ctx context.Context) ([]binanceTicker, error) {
+	var ticks []binanceTicker
+	if err := p.get(ctx, "/api/v3/ticker/24hr", &ticks); err != nil {
+		return nil, err
+	}
+	return ticks, nil
+}
+
+func (p *binanceProvider) Symbols(ctx context.Context) ([]symbolInfo, error) {
+	var info struct {
+		Symbols []struct {
+			Symbol     string `json:"symbol"`
+			Status     string `json:"status"`
+			BaseAsset  string `json:"baseAsset"`
+			QuoteAsset string `json:"quoteAsset"`
+		} `json:"symbols"`
+	}
+	if err := p.get(ctx, "/api/v3/exchangeInfo", &info); err != nil {
+		return nil, err
+	}
+	out := make([]symbolInfo, 0, len(info.Symbols))
+	for _, s := range info.Symbols {
+		if s.Symbol == "" || strings.ToUpper(s.Status) != "TRADING" {
+			continue
+		}
+		out = append(out, symbolInfo{Symbol: s.Symbol, Base: s.BaseAsset, Quote: s.QuoteAsset, Status: s.Status})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	return out, nil
+}
+
+// Klines reads /api/v3/klines, whose rows are arrays: open time (ms), open,
+// high, low, close, volume, then fields not used here.
+func (p *binanceProvider) Klines(ctx context.Context, symbol, interval string, limit int) ([]kline, error) {
+	q := url.Values{"symbol": {symbol}, "interval": {interval}, "limit": {strconv.Itoa(limit)}}
+	var raw [][]any
+	if err := p.get(ctx, "/api/v3/klines?"+q.Encode(), &raw); err != nil {
+		return nil, err
+	}
+	out := make([]kline, 0, len(raw))
+	for _, row := range raw {
+		if len(row) < 6 {
+			continue
+		}
+		openTime, ok := asFloat(row[0])
+		if !ok {
+			continue
+		}
+		k := kline{T: time.UnixMilli(int64(openTime)).UTC().Format(time.RFC3339)}
+		k.O, _ = asFloat(row[1])
+		k.H, _ = asFloat(row[2])
+		k.L, _ = asFloat(row[3])
+		k.C, _ = asFloat(row[4])
+		k.V, _ = asFloat(row[5])
+		out = append(out, k)
+	}
+	return out, nil
+}
+
+// --- Coinbase Exchange ---
+
+type coinbaseProvider struct {
+	baseURL string
+	client  *http.Client
+	now     func() time.Time
+}
+
+func newCoinbaseProvider() *coinbaseProvider {
+	return &coinbaseProvider{baseURL: "https://api.exchange.coinbase.com", client: &http.Client{Timeout: 6 * time.Second}, now: time.Now}
+}
+
+func (p *coinbaseProvider) Name() string { return "coinbase" }
+
+// Tickers reads /products/stats, the 24h open, high, low, last and base
+// volume of every product. Coinbase sends no change or quote volume, so they
+// are derived; the stats carry no time, so rows are stamped with the fetch
+// time.
+func (p *coinbaseProvider) Tickers(ctx context.Context) ([]binanceTicker, error) {
+	var stats map[string]struct {
+		Day *struct {
+			Open   string `json:"open"`
+			High   string `json:"high"`
+			Low    string `json:"low"`
+			Last   string `json:"last"`
+			Volume string `json:"volume"`
+		} `json:"stats_24hour"`
+	}
+	if err := getMarketJSON(ctx, p.client, p.baseURL+"/products/stats", &stats); err != nil {
+		return nil, err
+	}
+	closeTime := p.now().UnixMilli()
+	out := make([]binanceTicker, 0, len(stats))
+	for id, s := range stats {
+		if s.Day == nil {
+			continue
+		}
+		last, ok := asFloat(s.Day.Last)
+		if !ok || last <= 0 {
+			continue
+		}
+		open, _ := asFloat(s.Day.Open)
+		vol, _ := asFloat(s.Day.Volume)
+		out = append(out, binanceTicker{
+			Symbol:             strings.ReplaceAll(strings.ToUpper(id), "-", ""),
+			LastPrice:          s.Day.Last,
+			PriceChangePercent: pctChange(open, last),
+			Volume:             s.Day.Volume,
+			QuoteVolume:        formatPrice(vol * last),
+			HighPrice:          s.Day.High,
+			LowPrice:           s.Day.Low,
+			OpenPrice:          s.Day.Open,
+			CloseTime:          closeTime,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	return out, nil
+}
+
+func (p *coinbaseProvider) Symbols(ctx context.Context) ([]symbolInfo, error) {
+	var products []struct {
+		ID              string `json:"id"`
+		Base            string `json:"base_currency"`
+		Quote           string `json:"quote_currency"`
+		Status          string `json:"status"`
+		TradingDisabled bool   `json:"trading_disabled"`
+	}
+	if err := getMarketJSON(ctx, p.client, p.baseURL+"/products", &products); err != nil {
+		return nil, err
+	}
+	out := make([]symbolInfo, 0, len(products))
+	for _, pr := range products {
+		if pr.ID == "" || pr.TradingDisabled || !strings.EqualFold(pr.Status, "online") {
+			continue
+		}
+		out = append(out, symbolInfo{
+			Symbol: strings.ReplaceAll(strings.ToUpper(pr.ID), "-", ""),
+			Base:   strings.ToUpper(pr.Base),
+			Quote:  strings.ToUpper(pr.Quote),
+			Status: pr.Status,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	return out, nil
+}
+
+// --- Kraken ---
+
+// krakenPairsTTL is how long the pair list (needed to name ticker rows) is
+// reused between ticker fetches.
+const krakenPairsTTL = time.Hour
+
+type krakenProvider struct {
+	baseURL string
+	client  *http.Client
+	now     func() time.Time
+
+	mu        sync.Mutex
+	pairs     map[string]symbolInfo // Kraken pair key ("XXBTZUSD") -> pair ("BTCUSD")
+	pairsTime time.Time
+}
+
+func newKrakenProvider() *krakenProvider {
+	return &krakenProvider{baseURL: "https://api.kraken.com", client: &http.Client{Timeout: 6 * time.Second}, now: time.Now}
+}
+
+func (p *krakenProvider) Name() string { return "kraken" }
+
+// krakenAssets maps Kraken's legacy asset codes to the common ones.
+var krakenAssets = map[string]string{"XBT": "BTC", "XDG": "DOGE"}
+
+// krakenSymbol turns a pair's wsname ("XBT/USD") into "BTCUSD", with base
+// "BTC" and quote "USD". ok is false for a malformed wsname.
+func krakenSymbol(wsname string) (info symbolInfo, ok bool) {
+	base, quote, ok := strings.Cut(strings.ToUpper(wsname), "/")
+	if !ok || base == "" || quote == "" {
+		return symbolInfo{}, false
+	}
+	if v, ok := krakenAssets[base]; ok {
+		base = v
+	}
+	if v, ok := krakenAssets[quote]; ok {
+		quote = v
+	}
+	return symbolInfo{Symbol: base + quote, Base: base, Quote: quote}, true
+}
+
+// getKraken fetches a public endpoint and decodes its "result" into v.
+// Kraken answers 200 with a non-empty "error" list when a call fails.
+func (p *krakenProvider) getKraken(ctx context.Context, path string, v any) error {
+	var resp struct {
+		Error  []string        `json:"error"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := getMarketJSON(ctx, p.client, p.baseURL+path, &resp); err != nil {
+		return err
+	}
+	if len(resp.Error) > 0 {
+		return errors.New(strings.Join(resp.Error, ","))
+	}
+	return json.Unmarshal(resp.Result, v)
+}
+
+func (p *krakenProvider) fetchPairs(ctx context.Context) (map[string]symbolInfo, error) {
+	var result map[string]struct {
+		Altname string `json:"altname"`
+		WSName  string `json:"wsname"`
+		Status  string `json:"status"`
+	}
+	if err := p.getKraken(ctx, "/0/public/AssetPairs", &result); err != nil {
+		return nil, err
+	}
+	out := make(map[string]symbolInfo, len(result))
+	for key, pair := range result {
+		if strings.HasSuffix(pair.Altname, ".d") || (pair.Status != "" && pair.Status != "online") {
+			continue
+		}
+		if info, ok := krakenSymbol(pair.WSName); ok {
+			info.Status = "online"
+			out[key] = info
+		}
+	}
+	return out, nil
+}
+
+func (p *krakenProvider) pairMap(ctx context.Context) (map[string]symbolInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pairs != nil && p.now().Sub(p.pairsTime) < krakenPairsTTL {
+		return p.pairs, nil
+	}
+	pairs, err := p.fetchPairs(ctx)
+	if err != nil {
+		if p.pairs != nil {
+			return p.pairs, nil
+		}
+		return nil, err
+	}
+	p.pairs, p.pairsTime = pairs, p.now()
+	return pairs, nil
+}
+
+// Tickers reads /0/public/Ticker for every pair. Kraken's open is today's
+// (since 00:00 UTC) rather than 24 hours ago, so the change is the day's;
+// quote volume is the 24h volume times the 24h VWAP.
+func (p *krakenProvider) Tickers(ctx context.Context) ([]binanceTicker, error) {
+	pairs, err := p.pairMap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]struct {
+		Close  []string `json:"c"`
+		Volume []string `json:"v"`
+		VWAP   []string `json:"p"`
+		Low    []string `json:"l"`
+		High   []string `json:"h"`
+		Open   string   `json:"o"`
+	}
+	if err := p.getKraken(ctx, "/0/public/Ticker", &result); err != nil {
+		return nil, err
+	}
+	closeTime := p.now().UnixMilli()
+	out := make([]binanceTicker, 0, len(result))
+	for key, t := range result {
+		pair, ok := pairs[key]
+		if !ok || len(t.Close) < 1 || len(t.Volume) < 2 || len(t.VWAP) < 2 || len(t.Low) < 2 || len(t.High) < 2 {
+			continue
+		}
+		last, ok := asFloat(t.Close[0])
+		if !ok || last <= 0 {
+			continue
+		}
+		open, _ := asFloat(t.Open)
+		vol, _ := asFloat(t.Volume[1])
+		vwap, _ := asFloat(t.VWAP[1])
+		out = append(out, binanceTicker{
+			Symbol:             pair.Symbol,
+			LastPrice:          t.Close[0],
+			PriceChangePercent: pctChange(open, last),
+			Volume:             t.Volume[1],
+			QuoteVolume:        formatPrice(vol * vwap),
+			HighPrice:          t.High[1],
+			LowPrice:           t.Low[1],
+			OpenPrice:          t.Open,
+			CloseTime:          closeTime,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	return out, nil
+}
+
+func (p *krakenProvider) Symbols(ctx context.Context) ([]symbolInfo, error) {
+	pairs, err := p.pairMap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]symbolInfo, 0, len(pairs))
+	for _, pair := range pairs {
+		out = append(out, pair)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	return out, nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fixtureServer serves recorded exchange responses from testdata/market by
+// request path.
+func fixtureServer(t *testing.T, files map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		b, err := os.ReadFile(filepath.Join("testdata", "market", name))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func tickerBySymbol(ticks []binanceTicker) map[string]binanceTicker {
+	out := make(map[string]binanceTicker, len(ticks))
+	for _, t := range ticks {
+		out[t.Symbol] = t
+	}
+	return out
+}
+
+func TestBinanceProviderFixtures(t *testing.T) {
+	srv := fixtureServer(t, map[string]string{
+		"/api/v3/ticker/24hr":  "binance_ticker_24hr.json",
+		"/api/v3/exchangeInfo": "binance_exchange_info.json",
+	})
+	p := &binanceProvider{baseURLs: []string{srv.URL}, client: srv.Client()}
+	ticks, err := p.Tickers(context.Background())
+	if err != nil || len(ticks) != 2 {
+		t.Fatalf("tickers: %v %v", ticks, err)
+	}
+	if btc := tickerBySymbol(ticks)["BTCUSDT"]; btc.LastPrice != "65620.10000000" || btc.CloseTime != 1767225599999 {
+		t.Fatalf("unexpected BTCUSDT %+v", btc)
+	}
+	syms, err := p.Symbols(context.Background())
+	if err != nil || !reflect.DeepEqual(symbolNames(syms), []string{"BTCUSDT", "ETHUSDT"}) {
+		t.Fatalf("symbols: %v %v", syms, err)
+	}
+}
+
+func TestBinanceProviderFallsBackAcrossBaseURLs(t *testing.T) {
+	var downHits atomic.Int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downHits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	mirror := fixtureServer(t, map[string]string{
+		"/api/v3/ticker/24hr":  "binance_ticker_24hr.json",
+		"/api/v3/exchangeInfo": "binance_exchange_info.json",
+	})
+	p := &binanceProvider{baseURLs: []string{down.URL, mirror.URL}, client: http.DefaultClient, deadline: time.Second}
+
+	ticks, err := p.Tickers(context.Background())
+	if err != nil || len(ticks) != 2 {
+		t.Fatalf("tickers: %v %v", ticks, err)
+	}
+	syms, err := p.Symbols(context.Background())
+	if err != nil || len(syms) != 2 || downHits.Load() != 2 {
+		t.Fatalf("symbols: %v %v, first base hit %d times", syms, err, downHits.Load())
+	}
+
+	// With every base failing the error names each host and keeps the
+	// last failure readable.
+	p.baseURLs = []string{down.URL, down.URL + "/"}
+	_, err = p.Tickers(context.Background())
+	var he *marketHTTPError
+	host := strings.TrimPrefix(down.URL, "http://")
+	if !errors.As(err, &he) || he.Status != http.StatusServiceUnavailable || err.Error() != host+": non_2xx; "+host+": non_2xx" {
+		t.Fatalf("all down: %v", err)
+	}
+}
+
+func TestBinanceProviderDeadlineSpansFallbacks(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer slow.Close()
+	var fallbackHits atomic.Int32
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackHits.Add(1)
+		w.Write([]byte("[]"))
+	}))
+	defer fallback.Close()
+
+	p := &binanceProvider{baseURLs: []string{slow.URL, fallback.URL}, client: http.DefaultClient, deadline: 50 * time.Millisecond}
+	start := time.Now()
+	if _, err := p.Tickers(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second || fallbackHits.Load() != 0 {
+		t.Fatalf("took %v, fallback hit %d times after the deadline", elapsed, fallbackHits.Load())
+	}
+}
+
+func TestLoadBinanceBaseURLs(t *testing.T) {
+	t.Setenv("BINANCE_BASE_URLS", "")
+	if got := loadBinanceBaseURLs(); !reflect.DeepEqual(got, []string{defaultBinanceBaseURL}) {
+		t.Fatalf("default: %v", got)
+	}
+	t.Setenv("BINANCE_BASE_URLS", " http://127.0.0.1:9000/ , ftp://mirror, not a url,https://api.binance.com")
+	if got := loadBinanceBaseURLs(); !reflect.DeepEqual(got, []string{"http://127.0.0.1:9000", "https://api.binance.com"}) {
+		t.Fatalf("parsed: %v", got)
+	}
+	t.Setenv("BINANCE_BASE_URLS", "ftp://only")
+	if got := loadBinanceBaseURLs(); !reflect.DeepEqual(got, []string{defaultBinanceBaseURL}) {
+		t.Fatalf("all invalid: %v", got)
+	}
+}
+
+func TestCoinbaseProviderFixtures(t *testing.T) {
+	srv := fixtureServer(t, map[string]string{
+		"/products":       "coinbase_products.json",
+		"/products/stats": "coinbase_products_stats.json",
+	})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := &coinbaseProvider{baseURL: srv.URL, client: srv.Client(), now: func() time.Time { return now }}
+	ticks, err := p.Tickers(context.Background())
+	if err != nil || len(ticks) != 2 {
+		t.Fatalf("tickers: %v %v", ticks, err)
+	}
+	btc := tickerBySymbol(ticks)["BTCUSD"]
+	want := binanceTicker{
+		Symbol: "BTCUSD", LastPrice: "65600.00", PriceChangePercent: "2.500", Volume: "10234.5",
+		QuoteVolume: "671383200", HighPrice: "65950.12", LowPrice: "63880.00", OpenPrice: "64000.00",
+		CloseTime: now.UnixMilli(),
+	}
+	if btc != want {
+		t.Fatalf("BTCUSD = %+v, want %+v", btc, want)
+	}
+	if _, ok := tickerBySymbol(ticks)["ETHUSDT"]; !ok {
+		t.Fatal("ETH-USDT should normalize to ETHUSDT")
+	}
+	syms, err := p.Symbols(context.Background())
+	if err != nil || !reflect.DeepEqual(symbolNames(syms), []string{"BTCUSD", "ETHUSDT"}) {
+		t.Fatalf("symbols: %v %v", syms, err)
+	}
+}
+
+func TestKrakenProviderFixtures(t *testing.T) {
+	srv := fixtureServer(t, map[string]string{
+		"/0/public/AssetPairs": "kraken_asset_pairs.json",
+		"/0/public/Ticker":     "kraken_ticker.json",
+	})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := &krakenProvider{baseURL: srv.URL, client: srv.Client(), now: func() time.Time { return now }}
+	ticks, err := p.Tickers(context.Background())
+	if err != nil || len(ticks) != 2 {
+		t.Fatalf("tickers: %v %v", ticks, err)
+	}
+	btc := tickerBySymbol(ticks)["BTCUSD"]
+	want := binanceTicker{
+		Symbol: "BTCUSD", LastPrice: "65601.00000", PriceChangePercent: "1.236", Volume: "3401.25000000",
+		QuoteVolume: "221081250", HighPrice: "66000.00000", LowPrice: "64000.00000", OpenPrice: "64800.00000",
+		CloseTime: now.UnixMilli(),
+	}
+	if btc != want {
+		t.Fatalf("BTCUSD = %+v, want %+v", btc, want)
+	}
+	if doge := tickerBySymbol(ticks)["DOGEUSDT"]; doge.PriceChangePercent != "-6.250" {
+		t.Fatalf("XDG/USDT should normalize to DOGEUSDT, got %+v", ticks)
+	}
+	syms, err := p.Symbols(context.Background())
+	if err != nil || !reflect.DeepEqual(symbolNames(syms), []string{"BTCUSD", "DOGEUSDT"}) {
+		t.Fatalf("symbols: %v %v", syms, err)
+	}
+}
+
+func TestKrakenProviderError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error":["EGeneral:Too many requests"]}`))
+	}))
+	defer srv.Close()
+	p := &krakenProvider{baseURL: srv.URL, client: srv.Client(), now: time.Now}
+	if _, err := p.Tickers(context.Background()); err == nil || err.Error() != "EGeneral:Too many requests" {
+		t.Fatalf("expected the Kraken error, got %v", err)
+	}
+}
+
+func TestMarketDataChainFallsBack(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden) // geo-blocked
+	}))
+	defer down.Close()
+	cb := fixtureServer(t, map[string]string{"/products/stats": "coinbase_products_stats.json"})
+	chain := newMarketDataChain(
+		&binanceProvider{baseURLs: []string{down.URL}, client: down.Client()},
+		&coinbaseProvider{baseURL: cb.URL, client: cb.Client(), now: time.Now},
+	)
+	ticks, source, err := chain.tickers(context.Background())
+	if err != nil || source != "coinbase" || len(ticks) != 2 {
+		t.Fatalf("expected coinbase tickers, got %d from %q: %v", len(ticks), source, err)
+	}
+	// The normalized rows feed computeTopFromTickers unchanged.
+	rows := computeTopFromTickers(ticks, 10, "gainers", "USD", 0)
+	if len(rows) != 1 || rows[0].Symbol != "BTCUSD" || rows[0].PctChange != 2.5 {
+		t.Fatalf("unexpected rows %+v", rows)
+	}
+
+	chain = newMarketDataChain(&binanceProvider{baseURLs: []string{down.URL}, client: down.Client()})
+	if _, _, err := chain.tickers(context.Background()); err == nil || err.Error() != "binance: non_2xx" {
+		t.Fatalf("expected the provider's error, got %v", err)
+	}
+}
+
+func TestCryptoTopSourceFromLiveFetch(t *testing.T) {
+	cb := fixtureServer(t, map[string]string{"/products/stats": "coinbase_products_stats.json"})
+	orig := marketData
+	marketData = newMarketDataChain(&coinbaseProvider{baseURL: cb.URL, client: cb.Client(), now: time.Now})
+	defer func() { marketData = orig }()
+
+	rec := getCryptoTop(newCryptoTopHandler(&cryptoCache{}), "/api/crypto/top?suffix=USD", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Source") != "coinbase" {
+		t.Fatalf("expected 200 from coinbase, got %d %q", rec.Code, rec.Header().Get("X-Source"))
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `"source":"coinbase"`) {
+		t.Fatalf("rows should carry their source: %s", body)
+	}
+}
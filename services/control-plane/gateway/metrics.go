@@ -0,0 +1,634 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- metrics ---
+
+// Latency bucket upper bounds in milliseconds (exponential, base 2).
+var metricsBucketsMs = []float64{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024, 2048, 4096, 8192, 16384}
+
+// metricsDecayHalfLife controls how quickly the quantile estimate forgets old requests.
+const metricsDecayHalfLife = 5 * time.Minute
+
+var metricsQuantiles = []float64{0.5, 0.95, 0.99}
+
+var metricsMu sync.Mutex
+var metricsReq int64
+var metricsErr int64
+var metricsDurMs int64
+
+// metricsBuckets holds per-bucket (non-cumulative) counts; the last slot is +Inf.
+var metricsBuckets = make([]uint64, len(metricsBucketsMs)+1)
+
+// metricsDecayed mirrors metricsBuckets with exponentially decaying weights.
+var metricsDecayed = make([]float64, len(metricsBucketsMs)+1)
+var metricsDecayedAt time.Time
+
+// Results stream fan-out: upstream aggregator polls vs. connected clients.
+var metricsResultsPolls int64
+var metricsResultsClients int
+var metricsResultsPollers int
+
+// Token buckets currently held by the rate limiter.
+var metricsRateBuckets int
+
+// 429 responses received from upstreams, by upstream host.
+var metricsUpstream429 = make(map[string]int64)
+
+// Open streaming connections (SSE and WebSocket), by stream.
+var metricsStreams = make(map[string]int)
+
+// Upstream connections dialed and still open, by upstream host:port.
+var metricsUpstreamConns = make(map[string]*upstreamConnStats)
+
+type upstreamConnStats struct {
+	Open  int64
+	Dials int64
+}
+
+// metricsGoroutineAlarm is the goroutine count above which a scrape logs
+// goroutines_high, once per excursion (GATEWAY_GOROUTINE_ALARM; 0 is off).
+var metricsGoroutineAlarm = 10000
+var metricsGoroutineAlarmed bool
+
+// Responses by status code, overall and per route class.
+var metricsStatus = make(map[int]int64)
+var metricsRoutes = make(map[string]*routeMetrics)
+
+// maxMetricsRoutes bounds the route classes tracked; later ones count as
+// "other" so unmatched paths cannot grow the map without limit.
+const maxMetricsRoutes = 64
+
+// routeMetrics is the per-route-class slice of the request metrics. Its
+// buckets share metricsBucketsMs and are not decayed.
+type routeMetrics struct {
+	Requests  int64
+	Errors    int64
+	DurSumMs  int64
+	Buckets   []uint64
+	Status    map[int]int64
+	Quantiles map[float64]float64
+}
+
+type metricsData struct {
+	Requests  int64
+	Errors    int64
+	DurSumMs  int64
+	Bounds    []float64
+	Buckets   []uint64
+	Quantiles map[float64]float64
+	Updated   time.Time
+
+	ResultsPolls   int64
+	ResultsClients int
+	ResultsPollers int
+	RateBuckets    int
+	Upstream429    map[string]int64
+
+	Status map[int]int64
+	Routes map[string]routeMetrics
+
+	Streams       map[string]int
+	UpstreamConns map[string]upstreamConnStats
+	Runtime       runtimeStats
+}
+
+// runtimeStats is the gateway's own process state, read at scrape time.
+type runtimeStats struct {
+	Goroutines     int
+	HeapAllocBytes uint64
+	HeapSysBytes   uint64
+	SysBytes       uint64
+	GCCycles       uint32
+	GCPauseTotal   time.Duration
+}
+
+// readRuntimeStats samples the runtime. ReadMemStats stops the world for a
+// few microseconds, which is fine once per scrape.
+func readRuntimeStats() runtimeStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return runtimeStats{
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocBytes: ms.HeapAlloc,
+		HeapSysBytes:   ms.HeapSys,
+		SysBytes:       ms.Sys,
+		GCCycles:       ms.NumGC,
+		GCPauseTotal:   time.Duration(ms.PauseTotalNs),
+	}
+}
+
+// metricsRouteClass groups paths for the per-route breakdown: the first two
+// segments ("/api/profiles", "/api/reports"), plus the third under
+// /api/gateway where the second names no resource of its own. Ids further
+// down the path are dropped.
+func metricsRouteClass(path string) string {
+	parts := strings.SplitN(strings.Trim(path, "/"), "/", 4)
+	n := 2
+	if len(parts) > 2 && parts[0] == "api" && parts[1] == "gateway" {
+		n = 3
+	}
+	if len(parts) > n {
+		parts = parts[:n]
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+func metricsRecord(path string, status int, durMs int64) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metricsReq++
+	if status >= 400 {
+		metricsErr++
+	}
+	metricsDurMs += durMs
+
+	idx := len(metricsBucketsMs)
+	for i, b := range metricsBucketsMs {
+		if float64(durMs) <= b {
+			idx = i
+			break
+		}
+	}
+	metricsBuckets[idx]++
+	decayMetricsLocked(time.Now())
+	metricsDecayed[idx]++
+	metricsStatus[status]++
+
+	class := metricsRouteClass(path)
+	rm := metricsRoutes[class]
+	if rm == nil {
+		if len(metricsRoutes) >= maxMetricsRoutes {
+			class = "other"
+			rm = metricsRoutes[class]
+		}
+		if rm == nil {
+			rm = &routeMetrics{Buckets: make([]uint64, len(metricsBucketsMs)+1), Status: make(map[int]int64)}
+			metricsRoutes[class] = rm
+		}
+	}
+	rm.Requests++
+	if status >= 400 {
+		rm.Errors++
+	}
+	rm.DurSumMs += durMs
+	rm.Buckets[idx]++
+	rm.Status[status]++
+}
+
+func metricsResultsPoll() {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metricsResultsPolls++
+}
+
+func metricsResultsStream(clients, pollers int) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metricsResultsClients = clients
+	metricsResultsPollers = pollers
+}
+
+func metricsRateLimitBuckets(n int) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metricsRateBuckets = n
+}
+
+func metricsUpstreamThrottled(upstream string) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metricsUpstream429[upstream]++
+}
+
+// metricsStreamOpen counts an open streaming connection until the returned
+// func is called.
+func metricsStreamOpen(stream string) (closed func()) {
+	metricsMu.Lock()
+	metricsStreams[stream]++
+	metricsMu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			metricsMu.Lock()
+			metricsStreams[stream]--
+			metricsMu.Unlock()
+		})
+	}
+}
+
+// countingDial wraps an upstream transport's dialer so /metrics can show how
+// many connections each upstream holds open.
+func countingDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		metricsMu.Lock()
+		st := metricsUpstreamConns[addr]
+		if st == nil {
+			st = &upstreamConnStats{}
+			metricsUpstreamConns[addr] = st
+		}
+		st.Open++
+		st.Dials++
+		metricsMu.Unlock()
+		return &countedConn{Conn: conn, addr: addr}, nil
+	}
+}
+
+type countedConn struct {
+	net.Conn
+	addr string
+	once sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() {
+		metricsMu.Lock()
+		metricsUpstreamConns[c.addr].Open--
+		metricsMu.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+// checkGoroutineAlarmLocked logs when the goroutine count crosses
+// metricsGoroutineAlarm, a hint of a leak, and re-arms once it is back
+// under. Called with metricsMu held.
+func checkGoroutineAlarmLocked(goroutines int) {
+	if metricsGoroutineAlarm <= 0 {
+		return
+	}
+	switch {
+	case goroutines > metricsGoroutineAlarm && !metricsGoroutineAlarmed:
+		metricsGoroutineAlarmed = true
+		slog.Warn("goroutines_high", "goroutines", goroutines, "threshold", metricsGoroutineAlarm)
+	case goroutines <= metricsGoroutineAlarm && metricsGoroutineAlarmed:
+		metricsGoroutineAlarmed = false
+		slog.Info("goroutines_recovered", "goroutines", goroutines, "threshold", metricsGoroutineAlarm)
+	}
+}
+
+func decayMetricsLocked(now time.Time) {
+	if !metricsDecayedAt.IsZero() && now.After(metricsDecayedAt) {
+		f := math.Pow(0.5, float64(now.Sub(metricsDecayedAt))/float64(metricsDecayHalfLife))
+		for i := range metricsDecayed {
+			metricsDecayed[i] *= f
+		}
+	}
+	metricsDecayedAt = now
+}
+
+func metricsSnapshot() metricsData {
+	rt := readRuntimeStats()
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	checkGoroutineAlarmLocked(rt.Goroutines)
+	q := make(map[float64]float64, len(metricsQuantiles))
+	for _, p := range metricsQuantiles {
+		q[p] = bucketQuantile(p, metricsBucketsMs, metricsDecayed)
+	}
+	up429 := make(map[string]int64, len(metricsUpstream429))
+	for k, v := range metricsUpstream429 {
+		up429[k] = v
+	}
+	status := make(map[int]int64, len(metricsStatus))
+	for k, v := range metricsStatus {
+		status[k] = v
+	}
+	routes := make(map[string]routeMetrics, len(metricsRoutes))
+	for class, rm := range metricsRoutes {
+		counts := make([]float64, len(rm.Buckets))
+		for i, c := range rm.Buckets {
+			counts[i] = float64(c)
+		}
+		cp := routeMetrics{
+			Requests:  rm.Requests,
+			Errors:    rm.Errors,
+			DurSumMs:  rm.DurSumMs,
+			Buckets:   append([]uint64(nil), rm.Buckets...),
+			Status:    make(map[int]int64, len(rm.Status)),
+			Quantiles: make(map[float64]float64, len(metricsQuantiles)),
+		}
+		for k, v := range rm.Status {
+			cp.Status[k] = v
+		}
+		for _, p := range metricsQuantiles {
+			cp.Quantiles[p] = bucketQuantile(p, metricsBucketsMs, counts)
+		}
+		routes[class] = cp
+	}
+	streams := make(map[string]int, len(metricsStreams))
+	for k, v := range metricsStreams {
+		streams[k] = v
+	}
+	conns := make(map[string]upstreamConnStats, len(metricsUpstreamConns))
+	for k, v := range metricsUpstreamConns {
+		conns[k] = *v
+	}
+	return metricsData{
+		Requests:  metricsReq,
+		Errors:    metricsErr,
+		DurSumMs:  metricsDurMs,
+		Bounds:    metricsBucketsMs,
+		Buckets:   append([]uint64(nil), metricsBuckets...),
+		Quantiles: q,
+		Updated:   time.Now().UTC(),
+
+		ResultsPolls:   metricsResultsPolls,
+		ResultsClients: metricsResultsClients,
+		ResultsPollers: metricsResultsPollers,
+		RateBuckets:    metricsRateBuckets,
+		Upstream429:    up429,
+
+		Status: status,
+		Routes: routes,
+
+		Streams:       streams,
+		UpstreamConns: conns,
+		Runtime:       rt,
+	}
+}
+
+// bucketQuantile estimates quantile p by linear interpolation inside the
+// bucket that contains it. Values in the +Inf bucket report the last bound.
+func bucketQuantile(p float64, bounds, counts []float64) float64 {
+	total := 0.0
+	for _, c := range counts {
+		total += c
+	}
+	if total <= 0 {
+		return 0
+	}
+	rank := p * total
+	cum := 0.0
+	for i, c := range counts {
+		if c > 0 && cum+c >= rank {
+			if i >= len(bounds) {
+				return bounds[len(bounds)-1]
+			}
+			lo := 0.0
+			if i > 0 {
+				lo = bounds[i-1]
+			}
+			return lo + (bounds[i]-lo)*(rank-cum)/c
+		}
+		cum += c
+	}
+	return bounds[len(bounds)-1]
+}
+
+// metricsFormatter renders a metrics snapshot in one exposition format.
+type metricsFormatter interface {
+	contentType() string
+	format(w io.Writer, m metricsData) error
+}
+
+type jsonMetricsFormatter struct{}
+
+func (jsonMetricsFormatter) contentType() string { return "application/json; charset=utf-8" }
+
+func (jsonMetricsFormatter) format(w io.Writer, m metricsData) error {
+	avg := int64(0)
+	if m.Requests > 0 {
+		avg = m.DurSumMs / m.Requests
+	}
+	routes := make(map[string]any, len(m.Routes))
+	for class, rm := range m.Routes {
+		routeAvg := int64(0)
+		if rm.Requests > 0 {
+			routeAvg = rm.DurSumMs / rm.Requests
+		}
+		routes[class] = map[string]any{
+			"requests_total":        rm.Requests,
+			"errors_total":          rm.Errors,
+			"avg_duration_ms":       routeAvg,
+			"duration_ms_quantiles": jsonQuantiles(rm.Quantiles),
+			"status_codes":          jsonStatusCodes(rm.Status),
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(map[string]any{
+		"requests_total":        m.Requests,
+		"errors_total":          m.Errors,
+		"avg_duration_ms":       avg,
+		"duration_ms_quantiles": jsonQuantiles(m.Quantiles),
+		"status_codes":          jsonStatusCodes(m.Status),
+		"routes":                routes,
+		"last_updated_utc":      m.Updated.Format(time.RFC3339),
+		"rate_limit_buckets":    m.RateBuckets,
+		"upstream_429_total":    m.Upstream429,
+		"results_stream": map[string]any{
+			"upstream_polls_total": m.ResultsPolls,
+			"clients":              m.ResultsClients,
+			"pollers":              m.ResultsPollers,
+		},
+		"stream_connections":   m.Streams,
+		"upstream_connections": jsonUpstreamConns(m.UpstreamConns),
+		"runtime": map[string]any{
+			"goroutines":         m.Runtime.Goroutines,
+			"heap_alloc_bytes":   m.Runtime.HeapAllocBytes,
+			"heap_sys_bytes":     m.Runtime.HeapSysBytes,
+			"sys_bytes":          m.Runtime.SysBytes,
+			"gc_cycles_total":    m.Runtime.GCCycles,
+			"gc_pause_total_ms":  float64(m.Runtime.GCPauseTotal.Microseconds()) / 1000,
+			"goroutine_alarm_at": metricsGoroutineAlarm,
+		},
+	})
+}
+
+func jsonUpstreamConns(conns map[string]upstreamConnStats) map[string]any {
+	out := make(map[string]any, len(conns))
+	for addr, st := range conns {
+		out[addr] = map[string]int64{"open": st.Open, "dials_total": st.Dials}
+	}
+	return out
+}
+
+// jsonQuantiles keys quantiles as "p50", "p95", ... rounded to 0.01ms.
+func jsonQuantiles(q map[float64]float64) map[string]float64 {
+	out := make(map[string]float64, len(q))
+	for p, v := range q {
+		out["p"+strconv.FormatFloat(p*100, 'f', -1, 64)] = math.Round(v*100) / 100
+	}
+	return out
+}
+
+func jsonStatusCodes(status map[int]int64) map[string]int64 {
+	out := make(map[string]int64, len(status))
+	for code, n := range status {
+		out[strconv.Itoa(code)] = n
+	}
+	return out
+}
+
+type prometheusMetricsFormatter struct{}
+
+func (prometheusMetricsFormatter) contentType() string {
+	return "text/plain; version=0.0.4; charset=utf-8"
+}
+
+func (prometheusMetricsFormatter) format(w io.Writer, m metricsData) error {
+	var b strings.Builder
+	b.WriteString("# HELP requests_total Total HTTP requests handled by the gateway.\n")
+	b.WriteString("# TYPE requests_total counter\n")
+	fmt.Fprintf(&b, "requests_total %d\n", m.Requests)
+	b.WriteString("# HELP errors_total HTTP requests answered with status >= 400.\n")
+	b.WriteString("# TYPE errors_total counter\n")
+	fmt.Fprintf(&b, "errors_total %d\n", m.Errors)
+
+	b.WriteString("# HELP request_duration_ms Request latency in milliseconds.\n")
+	b.WriteString("# TYPE request_duration_ms histogram\n")
+	cum := uint64(0)
+	for i, bound := range m.Bounds {
+		cum += m.Buckets[i]
+		fmt.Fprintf(&b, "request_duration_ms_bucket{le=\"%s\"} %d\n", strconv.FormatFloat(bound, 'f', -1, 64), cum)
+	}
+	cum += m.Buckets[len(m.Bounds)]
+	fmt.Fprintf(&b, "request_duration_ms_bucket{le=\"+Inf\"} %d\n", cum)
+	fmt.Fprintf(&b, "request_duration_ms_sum %d\n", m.DurSumMs)
+	fmt.Fprintf(&b, "request_duration_ms_count %d\n", cum)
+
+	b.WriteString("# HELP request_duration_ms_quantile Recent latency quantiles (exponentially decayed).\n")
+	b.WriteString("# TYPE request_duration_ms_quantile gauge\n")
+	for _, p := range metricsQuantiles {
+		fmt.Fprintf(&b, "request_duration_ms_quantile{quantile=\"%s\"} %s\n",
+			strconv.FormatFloat(p, 'f', -1, 64), strconv.FormatFloat(m.Quantiles[p], 'f', 3, 64))
+	}
+
+	b.WriteString("# HELP responses_total HTTP responses by route class and status code.\n")
+	b.WriteString("# TYPE responses_total counter\n")
+	classes := make([]string, 0, len(m.Routes))
+	for class := range m.Routes {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		rm := m.Routes[class]
+		codes := make([]int, 0, len(rm.Status))
+		for code := range rm.Status {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(&b, "responses_total{route=%q,code=\"%d\"} %d\n", class, code, rm.Status[code])
+		}
+	}
+	b.WriteString("# HELP route_request_duration_ms Request latency in milliseconds by route class.\n")
+	b.WriteString("# TYPE route_request_duration_ms histogram\n")
+	for _, class := range classes {
+		rm := m.Routes[class]
+		cum := uint64(0)
+		for i, bound := range m.Bounds {
+			cum += rm.Buckets[i]
+			fmt.Fprintf(&b, "route_request_duration_ms_bucket{route=%q,le=\"%s\"} %d\n", class, strconv.FormatFloat(bound, 'f', -1, 64), cum)
+		}
+		cum += rm.Buckets[len(m.Bounds)]
+		fmt.Fprintf(&b, "route_request_duration_ms_bucket{route=%q,le=\"+Inf\"} %d\n", class, cum)
+		fmt.Fprintf(&b, "route_request_duration_ms_sum{route=%q} %d\n", class, rm.DurSumMs)
+		fmt.Fprintf(&b, "route_request_duration_ms_count{route=%q} %d\n", class, cum)
+	}
+
+	b.WriteString("# HELP results_stream_upstream_polls_total Aggregator polls made on behalf of results stream clients.\n")
+	b.WriteString("# TYPE results_stream_upstream_polls_total counter\n")
+	fmt.Fprintf(&b, "results_stream_upstream_polls_total %d\n", m.ResultsPolls)
+	b.WriteString("# HELP results_stream_clients Connected results stream clients.\n")
+	b.WriteString("# TYPE results_stream_clients gauge\n")
+	fmt.Fprintf(&b, "results_stream_clients %d\n", m.ResultsClients)
+	b.WriteString("# HELP results_stream_pollers Shared aggregator poll loops currently running.\n")
+	b.WriteString("# TYPE results_stream_pollers gauge\n")
+	fmt.Fprintf(&b, "results_stream_pollers %d\n", m.ResultsPollers)
+	b.WriteString("# HELP rate_limit_buckets Token buckets held by the rate limiter.\n")
+	b.WriteString("# TYPE rate_limit_buckets gauge\n")
+	fmt.Fprintf(&b, "rate_limit_buckets %d\n", m.RateBuckets)
+	b.WriteString("# HELP upstream_429_total 429 responses received from upstream services.\n")
+	b.WriteString("# TYPE upstream_429_total counter\n")
+	upstreams := make([]string, 0, len(m.Upstream429))
+	for k := range m.Upstream429 {
+		upstreams = append(upstreams, k)
+	}
+	sort.Strings(upstreams)
+	for _, k := range upstreams {
+		fmt.Fprintf(&b, "upstream_429_total{upstream=%q} %d\n", k, m.Upstream429[k])
+	}
+
+	b.WriteString("# HELP stream_connections Open SSE and WebSocket connections by stream.\n")
+	b.WriteString("# TYPE stream_connections gauge\n")
+	streams := make([]string, 0, len(m.Streams))
+	for k := range m.Streams {
+		streams = append(streams, k)
+	}
+	sort.Strings(streams)
+	for _, k := range streams {
+		fmt.Fprintf(&b, "stream_connections{stream=%q} %d\n", k, m.Streams[k])
+	}
+	addrs := make([]string, 0, len(m.UpstreamConns))
+	for k := range m.UpstreamConns {
+		addrs = append(addrs, k)
+	}
+	sort.Strings(addrs)
+	b.WriteString("# HELP upstream_connections_open Connections held open to each upstream.\n")
+	b.WriteString("# TYPE upstream_connections_open gauge\n")
+	for _, k := range addrs {
+		fmt.Fprintf(&b, "upstream_connections_open{upstream=%q} %d\n", k, m.UpstreamConns[k].Open)
+	}
+	b.WriteString("# HELP upstream_dials_total Connections dialed to each upstream.\n")
+	b.WriteString("# TYPE upstream_dials_total counter\n")
+	for _, k := range addrs {
+		fmt.Fprintf(&b, "upstream_dials_total{upstream=%q} %d\n", k, m.UpstreamConns[k].Dials)
+	}
+
+	b.WriteString("# HELP goroutines Goroutines in the gateway process.\n")
+	b.WriteString("# TYPE goroutines gauge\n")
+	fmt.Fprintf(&b, "goroutines %d\n", m.Runtime.Goroutines)
+	b.WriteString("# HELP heap_alloc_bytes Bytes of allocated heap objects.\n")
+	b.WriteString("# TYPE heap_alloc_bytes gauge\n")
+	fmt.Fprintf(&b, "heap_alloc_bytes %d\n", m.Runtime.HeapAllocBytes)
+	b.WriteString("# HELP heap_sys_bytes Heap memory obtained from the OS.\n")
+	b.WriteString("# TYPE heap_sys_bytes gauge\n")
+	fmt.Fprintf(&b, "heap_sys_bytes %d\n", m.Runtime.HeapSysBytes)
+	b.WriteString("# HELP sys_bytes Total memory obtained from the OS.\n")
+	b.WriteString("# TYPE sys_bytes gauge\n")
+	fmt.Fprintf(&b, "sys_bytes %d\n", m.Runtime.SysBytes)
+	b.WriteString("# HELP gc_cycles_total Completed GC cycles.\n")
+	b.WriteString("# TYPE gc_cycles_total counter\n")
+	fmt.Fprintf(&b, "gc_cycles_total %d\n", m.Runtime.GCCycles)
+	b.WriteString("# HELP gc_pause_seconds_total Total stop-the-world GC pause time.\n")
+	b.WriteString("# TYPE gc_pause_seconds_total counter\n")
+	fmt.Fprintf(&b, "gc_pause_seconds_total %s\n", strconv.FormatFloat(m.Runtime.GCPauseTotal.Seconds(), 'f', -1, 64))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// negotiateMetricsFormat picks the formatter from ?format= or the Accept
+// header; JSON stays the default for existing consumers.
+func negotiateMetricsFormat(r *http.Request) metricsFormatter {
+	switch strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format"))) {
+	case "prometheus", "openmetrics", "text":
+		return prometheusMetricsFormatter{}
+	case "json":
+		return jsonMetricsFormatter{}
+	}
+	accept := strings.ToLower(r.Header.Get("Accept"))
+	if strings.Contains(accept, "application/openmetrics-text") || strings.Contains(accept, "text/plain") {
+		return prometheusMetricsFormatter{}
+	}
+	return jsonMetricsFormatter{}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBucketQuantile(t *testing.T) {
+	bounds := []float64{10, 20, 40}
+	counts := []float64{50, 40, 9, 1}
+	if got := bucketQuantile(0.5, bounds, counts); got != 10 {
+		t.Fatalf("p50: got %v want 10", got)
+	}
+	if got := bucketQuantile(0.9, bounds, counts); got != 20 {
+		t.Fatalf("p90: got %v want 20", got)
+	}
+	if got := bucketQuantile(0.95, bounds, counts); math.Abs(got-(20+20*5.0/9)) > 1e-9 {
+		t.Fatalf("p95: got %v", got)
+	}
+	if got := bucketQuantile(0.999, bounds, counts); got != 40 {
+		t.Fatalf("+Inf bucket should report last bound, got %v", got)
+	}
+}
+
+func TestMetricsRecordPerRoute(t *testing.T) {
+	// Durations land in the 8, 32, 128 and 2048 buckets.
+	for _, d := range []int64{5, 6, 7, 8, 20, 30, 100, 1500} {
+		metricsRecord("/api/metrics-test/item-1", 200, d)
+	}
+	metricsRecord("/api/metrics-test", 404, 1)
+	metricsRecord("/api/metrics-test/item-2/sub", 503, 3000)
+
+	m := metricsSnapshot()
+	rm, ok := m.Routes["/api/metrics-test"]
+	if !ok {
+		t.Fatalf("route class missing: %v", m.Routes)
+	}
+	if rm.Requests != 10 || rm.Errors != 2 || rm.DurSumMs != 5+6+7+8+20+30+100+1500+1+3000 {
+		t.Fatalf("totals %+v", rm)
+	}
+	if rm.Status[200] != 8 || rm.Status[404] != 1 || rm.Status[503] != 1 {
+		t.Fatalf("status codes %v", rm.Status)
+	}
+	if m.Status[200] < 8 || m.Status[503] < 1 {
+		t.Fatalf("overall status codes %v", m.Status)
+	}
+	want := map[float64]uint64{1: 1, 8: 4, 32: 2, 128: 1, 2048: 1, 4096: 1}
+	for i, bound := range metricsBucketsMs {
+		if rm.Buckets[i] != want[bound] {
+			t.Fatalf("bucket le=%v: %d, want %d (%v)", bound, rm.Buckets[i], want[bound], rm.Buckets)
+		}
+	}
+	if inf := rm.Buckets[len(metricsBucketsMs)]; inf != 0 {
+		t.Fatalf("+Inf bucket %d", inf)
+	}
+	// Rank 5 of 10 is the last of four in (4,8]; ranks 9.5 and 9.9 fall
+	// halfway and 90% into (2048,4096].
+	if got := rm.Quantiles[0.5]; got != 8 {
+		t.Fatalf("p50 %v, want 8", got)
+	}
+	if got := rm.Quantiles[0.95]; got != 3072 {
+		t.Fatalf("p95 %v, want 3072", got)
+	}
+	if got := rm.Quantiles[0.99]; math.Abs(got-3891.2) > 1e-9 {
+		t.Fatalf("p99 %v, want 3891.2", got)
+	}
+
+	var b strings.Builder
+	if err := (prometheusMetricsFormatter{}).format(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`responses_total{route="/api/metrics-test",code="404"} 1`,
+		`route_request_duration_ms_bucket{route="/api/metrics-test",le="8"} 5`,
+		`route_request_duration_ms_count{route="/api/metrics-test"} 10`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Fatalf("missing %q", want)
+		}
+	}
+}
+
+func TestMetricsRouteClass(t *testing.T) {
+	cases := map[string]string{
+		"/health":                          "/health",
+		"/api/profiles":                    "/api/profiles",
+		"/api/profiles/p1":                 "/api/profiles",
+		"/api/reports/r1/export":           "/api/reports",
+		"/api/gateway/connectors/x/config": "/api/gateway/connectors",
+		"/api/gateway/webhooks/dlq":        "/api/gateway/webhooks",
+		"/api/audit/v0/events":             "/api/audit",
+		"/":                                "/",
+	}
+	for path, want := range cases {
+		if got := metricsRouteClass(path); got != want {
+			t.Fatalf("%s: %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestPrometheusMetricsFormat(t *testing.T) {
+	m := metricsData{
+		Requests:  3,
+		Errors:    1,
+		DurSumMs:  15,
+		Bounds:    []float64{1, 10},
+		Buckets:   []uint64{1, 1, 1},
+		Quantiles: map[float64]float64{0.5: 5.5},
+	}
+	var b strings.Builder
+	if err := (prometheusMetricsFormatter{}).format(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE requests_total counter\nrequests_total 3\n",
+		"errors_total 1\n",
+		`request_duration_ms_bucket{le="1"} 1`,
+		`request_duration_ms_bucket{le="10"} 2`,
+		`request_duration_ms_bucket{le="+Inf"} 3`,
+		"request_duration_ms_sum 15\n",
+		`request_duration_ms_quantile{quantile="0.5"} 5.500`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestNegotiateMetricsFormat(t *testing.T) {
+	cases := []struct {
+		target, accept string
+		prom           bool
+	}{
+		{"/metrics", "", false},
+		{"/metrics", "application/json", false},
+		{"/metrics", "text/plain;version=0.0.4", true},
+		{"/metrics", "application/openmetrics-text; version=1.0.0", true},
+		{"/metrics?format=prometheus", "application/json", true},
+		{"/metrics?format=json", "text/plain", false},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest("GET", tc.target, nil)
+		r.Header.Set("Accept", tc.accept)
+		_, prom := negotiateMetricsFormat(r).(prometheusMetricsFormatter)
+		if prom != tc.prom {
+			t.Fatalf("%s accept=%q: prometheus=%v want %v", tc.target, tc.accept, prom, tc.prom)
+		}
+	}
+}
+
+func TestMetricsRuntimeStats(t *testing.T) {
+	m := metricsSnapshot()
+	if m.Runtime.Goroutines <= 0 || m.Runtime.HeapAllocBytes == 0 || m.Runtime.SysBytes == 0 {
+		t.Fatalf("runtime stats %+v", m.Runtime)
+	}
+	var js bytes.Buffer
+	if err := (jsonMetricsFormatter{}).format(&js, m); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Runtime map[string]any `json:"runtime"`
+		Streams map[string]int `json:"stream_connections"`
+		Conns   map[string]any `json:"upstream_connections"`
+		Buckets *int           `json:"rate_limit_buckets"`
+	}
+	if err := json.Unmarshal(js.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"goroutines", "heap_alloc_bytes", "heap_sys_bytes", "sys_bytes", "gc_cycles_total", "gc_pause_total_ms"} {
+		if _, ok := out.Runtime[k]; !ok {
+			t.Errorf("json runtime.%s missing: %s", k, js.String())
+		}
+	}
+	if out.Streams == nil || out.Conns == nil || out.Buckets == nil {
+		t.Errorf("json gauges missing: %s", js.String())
+	}
+	var b strings.Builder
+	if err := (prometheusMetricsFormatter{}).format(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"\ngoroutines ", "\nheap_alloc_bytes ", "\nheap_sys_bytes ", "\ngc_pause_seconds_total ", "# TYPE stream_connections gauge", "# TYPE upstream_connections_open gauge"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("prometheus output missing %q", want)
+		}
+	}
+}
+
+func TestMetricsCountStreamsAndGoroutines(t *testing.T) {
+	mux, _, _, _ := newTestGatewayMux(t)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	before := metricsSnapshot()
+	const n = 5
+	bodies := make([]interface{ Close() error }, 0, n)
+	for i := 0; i < n; i++ {
+		resp, err := http.Get(srv.URL + "/api/crypto/stream")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, resp.Body)
+		// The first event means the handler is running.
+		if _, err := bufio.NewReader(resp.Body).ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+	}
+	open := metricsSnapshot()
+	if got := open.Streams["crypto"] - before.Streams["crypto"]; got != n {
+		t.Fatalf("crypto streams: %d open, want %d", got, n)
+	}
+	if open.Runtime.Goroutines < before.Runtime.Goroutines+n {
+		t.Fatalf("goroutines %d -> %d with %d streams open", before.Runtime.Goroutines, open.Runtime.Goroutines, n)
+	}
+
+	for _, b := range bodies {
+		b.Close()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		m := metricsSnapshot()
+		if m.Streams["crypto"] == before.Streams["crypto"] && m.Runtime.Goroutines <= open.Runtime.Goroutines-n {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("streams not released: %d open, %d goroutines", m.Streams["crypto"], m.Runtime.Goroutines)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMetricsUpstreamConnections(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	tr := newUpstreamTransport(time.Second)
+	client := &http.Client{Transport: tr}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if st := metricsSnapshot().UpstreamConns[addr]; st.Open != 1 || st.Dials != 1 {
+		t.Fatalf("keep-alive connection: %+v", st)
+	}
+	tr.CloseIdleConnections()
+	if st := metricsSnapshot().UpstreamConns[addr]; st.Open != 0 || st.Dials != 1 {
+		t.Fatalf("after closing idle connections: %+v", st)
+	}
+}
+
+func TestGoroutineAlarm(t *testing.T) {
+	orig := metricsGoroutineAlarm
+	defer func() { metricsGoroutineAlarm, metricsGoroutineAlarmed = orig, false }()
+
+	metricsGoroutineAlarm = 1
+	metricsSnapshot()
+	if !metricsGoroutineAlarmed {
+		t.Fatal("alarm not raised above the threshold")
+	}
+	metricsGoroutineAlarm = 1 << 30
+	metricsSnapshot()
+	if metricsGoroutineAlarmed {
+		t.Fatal("alarm not cleared below the threshold")
+	}
+}
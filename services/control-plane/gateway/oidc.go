@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// --- OIDC discovery ---
+
+// errJWKSUnavailable is returned for RS256/ES256 tokens while no JWKS URL is
+// known, i.e. OIDC discovery has not succeeded yet and AUTH_JWT_JWKS_URL is
+// unset.
+var errJWKSUnavailable = errors.New("jwks_unavailable")
+
+var errUnauthorized = errors.New("unauthorized")
+
+type oidcConfig struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// oidcDiscovery resolves the JWKS URL from
+// {issuer}/.well-known/openid-configuration. The last good document is kept
+// in cachePath (when set) so a restart during an IdP outage still finds the
+// keys.
+type oidcDiscovery struct {
+	issuer    string
+	cachePath string
+	client    *http.Client
+	attempts  int
+	backoff   time.Duration
+}
+
+func newOIDCDiscovery(issuer, cachePath string) *oidcDiscovery {
+	return &oidcDiscovery{
+		issuer:    strings.TrimRight(strings.TrimSpace(issuer), "/"),
+		cachePath: cachePath,
+		client:    &http.Client{Timeout: 5 * time.Second},
+		attempts:  3,
+		backoff:   time.Second,
+	}
+}
+
+// fetch makes one discovery request. The document's issuer must match the
+// configured one, as OIDC Discovery requires.
+func (d *oidcDiscovery) fetch(ctx context.Context) (oidcConfig, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return oidcConfig{}, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return oidcConfig{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return oidcConfig{}, fmt.Errorf("discovery status %d", resp.StatusCode)
+	}
+	var doc oidcConfig
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return oidcConfig{}, fmt.Errorf("discovery document: %w", err)
+	}
+	if strings.TrimRight(doc.Issuer, "/") != d.issuer {
+		return oidcConfig{}, fmt.Errorf("discovery issuer %q does not match %q", doc.Issuer, d.issuer)
+	}
+	if err := validateUpstreamURL(doc.JWKSURI); err != nil {
+		return oidcConfig{}, fmt.Errorf("jwks_uri: %w", err)
+	}
+	return doc, nil
+}
+
+// discover retries fetch with a doubling backoff. On success the document is
+// written to the cache file; when every attempt fails the cached document is
+// returned instead, if there is one.
+func (d *oidcDiscovery) discover(ctx context.Context) (oidcConfig, error) {
+	var lastErr error
+	wait := d.backoff
+	for i := 0; i < d.attempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return oidcConfig{}, ctx.Err()
+			case <-time.After(wait):
+			}
+			wait *= 2
+		}
+		doc, err := d.fetch(ctx)
+		if err == nil {
+			d.saveCache(doc)
+			return doc, nil
+		}
+		lastErr = err
+	}
+	if doc, ok := d.loadCache(); ok {
+		slog.Warn("oidc_discovery_cached", "issuer", d.issuer, "err", lastErr, "jwks_uri", doc.JWKSURI)
+		return doc, nil
+	}
+	return oidcConfig{}, lastErr
+}
+
+func (d *oidcDiscovery) saveCache(doc oidcConfig) {
+	if d.cachePath == "" {
+		return
+	}
+	raw, _ := json.Marshal(doc)
+	err := os.MkdirAll(filepath.Dir(d.cachePath), 0o700)
+	if err == nil {
+		err = writeFileAtomic(d.cachePath, raw, 0o600)
+	}
+	if err != nil {
+		slog.Warn("oidc_cache_write_failed", "path", d.cachePath, "err", err)
+	}
+}
+
+func (d *oidcDiscovery) loadCache() (oidcConfig, bool) {
+	if d.cachePath == "" {
+		return oidcConfig{}, false
+	}
+	raw, err := os.ReadFile(d.cachePath)
+	if err != nil {
+		return oidcConfig{}, false
+	}
+	var doc oidcConfig
+	if json.Unmarshal(raw, &doc) != nil || strings.TrimRight(doc.Issuer, "/") != d.issuer || doc.JWKSURI == "" {
+		return oidcConfig{}, false
+	}
+	return doc, true
+}
+
+// run re-runs discovery every interval so a jwks_uri moved at the IdP is
+// picked up without a restart. A failed round keeps the current URL.
+func (d *oidcDiscovery) run(ctx context.Context, jwks *jwksCache, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			d.refreshOnce(ctx, jwks)
+		}
+	}
+}
+
+func (d *oidcDiscovery) refreshOnce(ctx context.Context, jwks *jwksCache) {
+	doc, err := d.discover(ctx)
+	if err != nil {
+		slog.Warn("oidc_discovery_failed", "issuer", d.issuer, "err", err)
+		return
+	}
+	if jwks.setURL(doc.JWKSURI) {
+		slog.Info("oidc_jwks_uri_updated", "issuer", d.issuer, "jwks_uri", doc.JWKSURI)
+	}
+}
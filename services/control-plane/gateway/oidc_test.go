@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// oidcServer serves a discovery document pointing at jwksURL; while down is
+// set it answers 503.
+func oidcServer(t *testing.T, jwksURL *atomic.Value, down *atomic.Bool) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			http.NotFound(w, r)
+			return
+		}
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"issuer": srv.URL, "jwks_uri": jwksURL.Load()})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLoadAuthConfigOIDCDiscovery(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	keys := ecJWKSServer(t, "k1", &key.PublicKey)
+	var jwksURL atomic.Value
+	jwksURL.Store(keys.URL)
+	var down atomic.Bool
+	idp := oidcServer(t, &jwksURL, &down)
+
+	t.Setenv("AUTH_OIDC_ISSUER", idp.URL+"/")
+	t.Setenv("AUTH_OIDC_CACHE_FILE", filepath.Join(t.TempDir(), "oidc.json"))
+	t.Setenv("AUTH_JWT_ISSUER", "")
+	t.Setenv("AUTH_JWT_JWKS_URL", "")
+	cfg := loadAuthConfig()
+	if !cfg.Enabled || cfg.Issuer != idp.URL || cfg.JWKSURL != keys.URL || cfg.JWKS == nil {
+		t.Fatalf("discovery not applied: enabled=%v issuer=%q jwks=%q", cfg.Enabled, cfg.Issuer, cfg.JWKSURL)
+	}
+	claims := map[string]any{"sub": "alice", "iss": idp.URL, "exp": time.Now().Add(time.Hour).Unix()}
+	if _, err := validateJWT(cfg, signES256(t, key, "k1", claims)); err != nil {
+		t.Fatalf("token from the discovered issuer: %v", err)
+	}
+	claims["iss"] = "https://other.example"
+	if _, err := validateJWT(cfg, signES256(t, key, "k1", claims)); err == nil {
+		t.Fatal("token from another issuer must be rejected")
+	}
+
+	// The cached document carries a restart through an IdP outage.
+	down.Store(true)
+	d := newOIDCDiscovery(idp.URL, cfg.OIDC.cachePath)
+	d.backoff = time.Millisecond
+	doc, err := d.discover(context.Background())
+	if err != nil || doc.JWKSURI != keys.URL {
+		t.Fatalf("cached fallback: %+v %v", doc, err)
+	}
+}
+
+func TestOIDCDegradedUntilDiscoverySucceeds(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	keys := ecJWKSServer(t, "k1", &key.PublicKey)
+	var jwksURL atomic.Value
+	jwksURL.Store(keys.URL)
+	var down atomic.Bool
+	down.Store(true)
+	idp := oidcServer(t, &jwksURL, &down)
+
+	d := newOIDCDiscovery(idp.URL, "")
+	d.backoff = time.Millisecond
+	if _, err := d.discover(context.Background()); err == nil {
+		t.Fatal("expected discovery to fail while the IdP is down")
+	}
+	cfg := &authConfig{
+		Enabled:      true,
+		Issuer:       d.issuer,
+		OIDC:         d,
+		JWKS:         newJWKSCache("", time.Minute),
+		TenantHeader: "X-Tenant-ID",
+	}
+	h := withAuth(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	token := signES256(t, key, "k1", map[string]any{"sub": "alice", "iss": idp.URL, "exp": time.Now().Add(time.Hour).Unix()})
+	call := func() (int, string) {
+		req := httptest.NewRequest(http.MethodGet, "/api/drones", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		var out map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &out)
+		code, _ := out["error"].(string)
+		return rec.Code, code
+	}
+
+	if code, errCode := call(); code != http.StatusServiceUnavailable || errCode != "jwks_unavailable" {
+		t.Fatalf("degraded mode: %d %q", code, errCode)
+	}
+
+	down.Store(false)
+	d.refreshOnce(context.Background(), cfg.JWKS)
+	if code, errCode := call(); code != http.StatusOK {
+		t.Fatalf("after discovery: %d %q", code, errCode)
+	}
+
+	// A jwks_uri moved at the IdP is followed on the next round.
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rotated := ecJWKSServer(t, "k2", &other.PublicKey)
+	jwksURL.Store(rotated.URL)
+	d.refreshOnce(context.Background(), cfg.JWKS)
+	if _, err := validateJWT(cfg, signES256(t, other, "k2", map[string]any{"iss": idp.URL})); err != nil {
+		t.Fatalf("key from the rotated jwks_uri: %v", err)
+	}
+}
+
+func TestOIDCDiscoveryRejectsMismatchedIssuer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"issuer": "https://evil.example", "jwks_uri": "https://evil.example/jwks"})
+	}))
+	defer srv.Close()
+	d := newOIDCDiscovery(srv.URL, "")
+	if _, err := d.fetch(context.Background()); err == nil {
+		t.Fatal("expected an issuer mismatch error")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"gopkg.in/yaml.v3"
+)
+
+// --- OpenAPI ---
+
+// openAPIYAML documents the routes the gateway serves itself. Keep it in step
+// with newGatewayMux; TestOpenAPISpec fails when a route is missing.
+//
+//go:embed openapi.yaml
+var openAPIYAML []byte
+
+// openAPIToJSON converts the embedded YAML document to JSON. Response codes
+// and other map keys must be strings in the YAML for this to succeed.
+func openAPIToJSON(src []byte) ([]byte, error) {
+	var doc map[string]any
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		return nil, fmt.Errorf("parse openapi.yaml: %w", err)
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("encode openapi.yaml: %w", err)
+	}
+	return b, nil
+}
+
+// newOpenAPIHandler serves the document at GET /api/openapi.json. It is
+// converted once up front, so a broken embed fails every request the same way
+// instead of panicking.
+func newOpenAPIHandler(src []byte) http.HandlerFunc {
+	body, err := openAPIToJSON(src)
+	if err != nil {
+		slog.Error("openapi_invalid", "err", err)
+	}
+	sum := sha256.Sum256(body)
+	etag := `W/"` + hex.EncodeToString(sum[:8]) + `"`
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "openapi_unavailable"})
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(body)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// openAPIOwnedRoutes are the gateway-owned operations the document must
+// describe. Add a route here when adding it to newGatewayMux.
+var openAPIOwnedRoutes = []string{
+	"GET /health",
+	"GET /api/openapi.json",
+	"GET /api/summary",
+	"GET /api/audit/health",
+	"GET /api/audit/v0/events",
+	"GET /api/audit/v0/timeline",
+	"GET /api/crypto/symbols",
+	"GET /api/crypto/top",
+	"GET /api/crypto/klines",
+	"GET /api/crypto/health",
+	"GET /api/crypto/stream",
+	"GET /api/crypto/ws",
+	"GET /api/ws",
+	"GET /api/gateway/connectors/catalog",
+	"GET /api/gateway/connectors/health",
+	"GET /api/gateway/connectors/{id}/health",
+	"GET /api/gateway/connectors/{id}/schema",
+	"GET /api/gateway/connectors/{id}/config",
+	"POST /api/gateway/connectors/{id}/config",
+	"PUT /api/gateway/connectors/{id}/config",
+	"POST /api/gateway/connectors/{id}/config:apply",
+	"POST /api/gateway/connectors/{id}/config:discard",
+	"GET /api/reports",
+	"POST /api/reports",
+	"GET /api/reports/{id}",
+	"DELETE /api/reports/{id}",
+	"GET /api/events",
+}
+
+var (
+	openAPIMethods    = map[string]bool{"get": true, "put": true, "post": true, "delete": true, "options": true, "head": true, "patch": true, "trace": true}
+	openAPIPathFields = map[string]bool{"$ref": true, "summary": true, "description": true, "servers": true, "parameters": true}
+	openAPIStatusKey  = regexp.MustCompile(`^([1-5][0-9X]{2}|default)$`)
+	openAPIPathParam  = regexp.MustCompile(`\{([^}]+)\}`)
+)
+
+// openAPIChecker validates the parts of the OpenAPI 3.0 schema a hand-written
+// document is likely to get wrong: required fields, operation and response
+// shapes, path parameters and $ref targets.
+type openAPIChecker struct {
+	root map[string]any
+	errs *[]string
+}
+
+func (c openAPIChecker) errorf(format string, args ...any) {
+	*c.errs = append(*c.errs, fmt.Sprintf(format, args...))
+}
+
+// resolve follows a local $ref ("#/components/..."), or returns v unchanged.
+func (c openAPIChecker) resolve(where string, v any) map[string]any {
+	m, _ := v.(map[string]any)
+	ref, ok := m["$ref"].(string)
+	if !ok {
+		return m
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		c.errorf("%s: only local $ref is supported, got %q", where, ref)
+		return nil
+	}
+	var cur any = c.root
+	for _, part := range strings.Split(ref[2:], "/") {
+		next, ok := cur.(map[string]any)[strings.NewReplacer("~1", "/", "~0", "~").Replace(part)]
+		if !ok {
+			c.errorf("%s: $ref %q does not resolve", where, ref)
+			return nil
+		}
+		cur = next
+	}
+	out, _ := cur.(map[string]any)
+	return out
+}
+
+// walkRefs checks that every $ref anywhere in v resolves.
+func (c openAPIChecker) walkRefs(where string, v any) {
+	switch x := v.(type) {
+	case map[string]any:
+		if _, ok := x["$ref"]; ok {
+			c.resolve(where, x)
+		}
+		for k, e := range x {
+			c.walkRefs(where+"/"+k, e)
+		}
+	case []any:
+		for _, e := range x {
+			c.walkRefs(where, e)
+		}
+	}
+}
+
+// checkOpenAPI returns every problem found in doc.
+func checkOpenAPI(doc map[string]any) []string {
+	var errs []string
+	openAPIChecker{root: doc, errs: &errs}.check()
+	sort.Strings(errs)
+	return errs
+}
+
+func (c openAPIChecker) check() {
+	if v, _ := c.root["openapi"].(string); !regexp.MustCompile(`^3\.0\.\d+$`).MatchString(v) {
+		c.errorf("openapi: want 3.0.x, got %q", v)
+	}
+	info, _ := c.root["info"].(map[string]any)
+	for _, k := range []string{"title", "version"} {
+		if s, _ := info[k].(string); s == "" {
+			c.errorf("info.%s is required", k)
+		}
+	}
+	components, _ := c.root["components"].(map[string]any)
+	schemes, _ := components["securitySchemes"].(map[string]any)
+	checkSecurity := func(where string, v any) {
+		list, ok := v.([]any)
+		if v != nil && !ok {
+			c.errorf("%s: security must be a list", where)
+		}
+		for _, req := range list {
+			m, _ := req.(map[string]any)
+			for name := range m {
+				if _, ok := schemes[name]; !ok {
+					c.errorf("%s: unknown security scheme %q", where, name)
+				}
+			}
+		}
+	}
+	checkSecurity("security", c.root["security"])
+
+	paths, _ := c.root["paths"].(map[string]any)
+	if len(paths) == 0 {
+		c.errorf("paths is empty")
+	}
+	opIDs := map[string]string{}
+	for path, raw := range paths {
+		if !strings.HasPrefix(path, "/") {
+			c.errorf("path %q must start with /", path)
+		}
+		item, _ := raw.(map[string]any)
+		shared := paramNames(c, path, item["parameters"])
+		for key, op := range item {
+			if openAPIPathFields[key] {
+				continue
+			}
+			if !openAPIMethods[key] {
+				c.errorf("%s: unknown path item field %q", path, key)
+				continue
+			}
+			where := strings.ToUpper(key) + " " + path
+			opm, _ := op.(map[string]any)
+			if id, _ := opm["operationId"].(string); id != "" {
+				if prev, dup := opIDs[id]; dup {
+					c.errorf("%s: operationId %q already used by %s", where, id, prev)
+				}
+				opIDs[id] = where
+			}
+			checkSecurity(where, opm["security"])
+			declared := paramNames(c, where, opm["parameters"])
+			for name := range shared {
+				declared[name] = true
+			}
+			for _, m := range openAPIPathParam.FindAllStringSubmatch(path, -1) {
+				if !declared[m[1]] {
+					c.errorf("%s: path parameter %q is not declared", where, m[1])
+				}
+			}
+			if body, ok := opm["requestBody"]; ok {
+				if rb := c.resolve(where, body); rb != nil {
+					if content, _ := rb["content"].(map[string]any); len(content) == 0 {
+						c.errorf("%s: requestBody needs content", where)
+					}
+				}
+			}
+			responses, _ := opm["responses"].(map[string]any)
+			if len(responses) == 0 {
+				c.errorf("%s: responses is required", where)
+			}
+			for code, resp := range responses {
+				if !openAPIStatusKey.MatchString(code) {
+					c.errorf("%s: response key %q is not a status code", where, code)
+				}
+				if r := c.resolve(where, resp); r != nil {
+					if d, _ := r["description"].(string); d == "" {
+						c.errorf("%s %s: response description is required", where, code)
+					}
+				}
+			}
+		}
+	}
+	c.walkRefs("#", c.root)
+}
+
+// paramNames checks a parameter list and returns the names of its path
+// parameters, which must be required.
+func paramNames(c openAPIChecker, where string, v any) map[string]bool {
+	out := map[string]bool{}
+	list, _ := v.([]any)
+	for _, raw := range list {
+		p := c.resolve(where, raw)
+		if p == nil {
+			continue
+		}
+		name, _ := p["name"].(string)
+		in, _ := p["in"].(string)
+		switch in {
+		case "query", "header", "cookie":
+		case "path":
+			if req, _ := p["required"].(bool); !req {
+				c.errorf("%s: path parameter %q must be required", where, name)
+			}
+			out[name] = true
+		default:
+			c.errorf("%s: parameter %q has invalid in %q", where, name, in)
+		}
+		if name == "" {
+			c.errorf("%s: parameter without a name", where)
+		}
+		if _, ok := p["schema"]; !ok {
+			c.errorf("%s: parameter %q needs a schema", where, name)
+		}
+	}
+	return out
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	body, err := openAPIToJSON(openAPIYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range checkOpenAPI(doc) {
+		t.Error(e)
+	}
+
+	documented := map[string]bool{}
+	paths, _ := doc["paths"].(map[string]any)
+	for path, item := range paths {
+		for method := range item.(map[string]any) {
+			if openAPIMethods[method] {
+				documented[strings.ToUpper(method)+" "+path] = true
+			}
+		}
+	}
+	for _, route := range openAPIOwnedRoutes {
+		if !documented[route] {
+			t.Errorf("openapi.yaml does not document %s", route)
+		}
+	}
+
+	// Every documented path must reach a gateway route, not the SPA fallback.
+	mux, _, connectorID, _ := newTestGatewayMux(t)
+	var missing []string
+	for path := range paths {
+		concrete := strings.NewReplacer("{id}", connectorID).Replace(path)
+		if strings.HasPrefix(path, "/api/reports/") {
+			concrete = "/api/reports/live-crypto-wall"
+		}
+		if _, pattern := mux.Handler(httptest.NewRequest(http.MethodGet, concrete, nil)); pattern == "/" || pattern == "" {
+			missing = append(missing, path)
+		}
+	}
+	sort.Strings(missing)
+	if len(missing) > 0 {
+		t.Errorf("documented paths with no gateway route: %v", missing)
+	}
+}
+
+func TestOpenAPIChecksCatchMistakes(t *testing.T) {
+	var doc map[string]any
+	_ = json.Unmarshal([]byte(`{
+		"openapi": "2.0",
+		"info": {"title": "x"},
+		"paths": {
+			"/a/{id}": {"get": {"responses": {"ok": {"$ref": "#/components/responses/Nope"}}}},
+			"/b": {"fetch": {}}
+		}
+	}`), &doc)
+	got := strings.Join(checkOpenAPI(doc), "\n")
+	for _, want := range []string{"want 3.0.x", "info.version", "not a status code", "does not resolve", "\"id\" is not declared", "unknown path item field \"fetch\""} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	h := newOpenAPIHandler(openAPIYAML)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET: %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil || doc["openapi"] != "3.0.3" {
+		t.Fatalf("body is not the document: %v %v", err, doc["openapi"])
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("If-None-Match: %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	newOpenAPIHandler([]byte("openapi: [unclosed")).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("broken document: %d", rec.Code)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Upstream proxies ---
+
+// proxyRegistry holds the proxy for each upstream service. Routes look the
+// proxy up on every request, so an admin can repoint a service (for a
+// blue/green switch) without restarting the gateway.
+type proxyRegistry struct {
+	mu       sync.RWMutex
+	proxies  map[string]*breakerProxy
+	urls     map[string]string
+	timeouts map[string]time.Duration
+}
+
+func newProxyRegistry() *proxyRegistry {
+	return &proxyRegistry{
+		proxies:  make(map[string]*breakerProxy),
+		urls:     make(map[string]string),
+		timeouts: make(map[string]time.Duration),
+	}
+}
+
+// register adds a service at its startup URL.
+func (pr *proxyRegistry) register(service, target string, timeout time.Duration) *breakerProxy {
+	p := mustProxy(target, timeout)
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.proxies[service] = p
+	pr.urls[service] = target
+	pr.timeouts[service] = timeout
+	return p
+}
+
+var (
+	errUnknownService = errors.New("unknown_service")
+	errInvalidURL     = errors.New("invalid_url")
+)
+
+// set points a registered service at a new URL and returns the URL it
+// replaced. Requests already in flight finish against the old proxy.
+func (pr *proxyRegistry) set(service, target string) (*breakerProxy, string, error) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, "", errInvalidURL
+	}
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	prev, ok := pr.urls[service]
+	if !ok {
+		return nil, "", errUnknownService
+	}
+	p := mustProxy(target, pr.timeouts[service])
+	pr.proxies[service] = p
+	pr.urls[service] = target
+	return p, prev, nil
+}
+
+func (pr *proxyRegistry) get(service string) *breakerProxy {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+	return pr.proxies[service]
+}
+
+// url returns the current URL of a service.
+func (pr *proxyRegistry) url(service string) string {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+	return pr.urls[service]
+}
+
+// urlFunc is url bound to one service, for consumers that call the upstream
+// directly rather than through its proxy: each call sees a repoint.
+func (pr *proxyRegistry) urlFunc(service string) func() string {
+	return func() string { return pr.url(service) }
+}
+
+// snapshot returns the current URL of every service.
+func (pr *proxyRegistry) snapshot() map[string]string {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+	out := make(map[string]string, len(pr.urls))
+	for k, v := range pr.urls {
+		out[k] = v
+	}
+	return out
+}
+
+// handler proxies to whatever URL the service has when each request arrives.
+func (pr *proxyRegistry) handler(service string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := pr.get(service)
+		if p == nil {
+			writeJSON(w, http.StatusBadGateway, map[string]any{"error": "upstream_unavailable"})
+			return
+		}
+		p.ServeHTTP(w, r)
+	})
+}
+
+// adminKeyValid compares the X-Admin-Key header with ADMIN_API_KEY in
+// constant time.
+func adminKeyValid(adminKey string, r *http.Request) bool {
+	got := strings.TrimSpace(r.Header.Get("X-Admin-Key"))
+	return got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(adminKey)) == 1
+}
+
+type adminRouteRequest struct {
+	Service string `json:"service"`
+	URL     string `json:"url"`
+}
+
+// newAdminRoutesHandler serves /api/gateway/admin/routes: GET lists the
+// upstream URLs, PUT repoints one service and its health check. Both need the
+// ADMIN_API_KEY in X-Admin-Key, on top of whatever the auth middleware asks
+// for; without an admin key configured the endpoint is disabled. The
+// route_updated event on /api/events names the service only, since upstream
+// URLs are internal.
+func newAdminRoutesHandler(proxies *proxyRegistry, health *healthCache, targets *liveHealthTargets, sse *sseHub, adminKey string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodPut {
+			methodNotAllowed(w, http.MethodGet, http.MethodPut)
+			return
+		}
+		if adminKey == "" {
+			writeJSON(w, http.StatusForbidden, map[string]any{"error": "admin_disabled"})
+			return
+		}
+		if !adminKeyValid(adminKey, r) {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{"error": "unauthorized"})
+			return
+		}
+		if r.Method == http.MethodGet {
+			writeJSON(w, http.StatusOK, map[string]any{"routes": proxies.snapshot()})
+			return
+		}
+
+		var in adminRouteRequest
+		if !decodeJSONBody(w, r, &in) {
+			return
+		}
+		in.Service = strings.TrimSpace(in.Service)
+		in.URL = strings.TrimRight(strings.TrimSpace(in.URL), "/")
+		p, prev, err := proxies.set(in.Service, in.URL)
+		switch {
+		case errors.Is(err, errUnknownService):
+			services := make([]string, 0)
+			for name := range proxies.snapshot() {
+				services = append(services, name)
+			}
+			sort.Strings(services)
+			writeJSON(w, http.StatusNotFound, map[string]any{"error": "unknown_service", "services": services})
+			return
+		case err != nil:
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+			return
+		}
+		if health != nil {
+			health.watchBreaker(in.Service, p.breaker)
+		}
+		if targets != nil {
+			targets.set(in.Service, in.URL)
+		}
+		by := principalFromContext(r.Context())
+		slog.Warn("route_updated", "service", in.Service, "url", in.URL, "previous_url", prev, "by", by)
+		updatedAt := time.Now().UTC().Format(time.RFC3339)
+		if sse != nil {
+			noteSSEEvent(r.Context(), sse.publish("route_updated", map[string]any{"service": in.Service, "updated_at": updatedAt}))
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"service":      in.Service,
+			"url":          in.URL,
+			"previous_url": prev,
+			"updated_at":   updatedAt,
+		})
+	}
+}
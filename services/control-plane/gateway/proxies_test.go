@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminRoutesRepointsProxy(t *testing.T) {
+	d, _, oldHits := newTestGatewayRoutes(t)
+	d.adminKey = "admin-secret"
+	ch := make(chan sseEvent, 4)
+	d.sse.addClient(ch, func() {})
+	defer d.sse.removeClient(ch)
+	mux := newGatewayMux(d)
+
+	green := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", "green")
+		w.Header().Set("X-Path", r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer green.Close()
+
+	put := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/gateway/admin/routes", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-Admin-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := get("/api/results"); rec.Code != http.StatusTeapot {
+		t.Fatalf("before the switch: %d", rec.Code)
+	}
+	for _, tc := range []struct {
+		key, body string
+		want      int
+		wantErr   string
+	}{
+		{"", `{"service":"aggregator","url":"` + green.URL + `"}`, http.StatusUnauthorized, "unauthorized"},
+		{"wrong", `{"service":"aggregator","url":"` + green.URL + `"}`, http.StatusUnauthorized, "unauthorized"},
+		{"admin-secret", `{"service":"billing","url":"` + green.URL + `"}`, http.StatusNotFound, "unknown_service"},
+		{"admin-secret", `{"service":"aggregator","url":"ftp://x"}`, http.StatusBadRequest, "invalid_url"},
+		{"admin-secret", `{"service":"aggregator","url":"aggregator-v2:8082"}`, http.StatusBadRequest, "invalid_url"},
+	} {
+		rec := put(tc.key, tc.body)
+		var out map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &out)
+		if rec.Code != tc.want || out["error"] != tc.wantErr {
+			t.Fatalf("%s: %d %v, want %d %s", tc.body, rec.Code, out, tc.want, tc.wantErr)
+		}
+	}
+
+	rec := put("admin-secret", `{"service":"aggregator","url":"`+green.URL+`/"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", rec.Code, rec.Body.String())
+	}
+	before := oldHits.Load()
+	res := get("/api/results/run-1")
+	if res.Header().Get("X-Upstream") != "green" || res.Header().Get("X-Path") != "/results/run-1" {
+		t.Fatalf("aggregator route not repointed: %d %v", res.Code, res.Header())
+	}
+	if get("/api/profiles").Code != http.StatusTeapot || oldHits.Load() != before+1 {
+		t.Fatal("other services must keep their URL")
+	}
+
+	select {
+	case ev := <-ch:
+		var data map[string]any
+		if err := json.Unmarshal([]byte(ev.Data), &data); ev.Event != "route_updated" || err != nil || data["service"] != "aggregator" || data["url"] != nil || data["previous_url"] != nil {
+			t.Fatalf("event %s %s", ev.Event, ev.Data)
+		}
+	default:
+		t.Fatal("no route_updated event published")
+	}
+	if got := d.healthChecks.snapshot()["aggregator"]; got != green.URL {
+		t.Fatalf("health check not repointed: %q", got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/gateway/admin/routes", nil)
+	req.Header.Set("X-Admin-Key", "admin-secret")
+	list := httptest.NewRecorder()
+	mux.ServeHTTP(list, req)
+	var routes struct {
+		Routes map[string]string `json:"routes"`
+	}
+	if err := json.Unmarshal(list.Body.Bytes(), &routes); err != nil || routes.Routes["aggregator"] != green.URL || len(routes.Routes) != 5 {
+		t.Fatalf("routes: %s", list.Body.String())
+	}
+}
+
+func TestAdminRoutesDisabledWithoutKey(t *testing.T) {
+	d, _, _ := newTestGatewayRoutes(t)
+	req := httptest.NewRequest(http.MethodPut, "/api/gateway/admin/routes", strings.NewReader(`{"service":"aggregator","url":"http://x:1"}`))
+	req.Header.Set("X-Admin-Key", "")
+	rec := httptest.NewRecorder()
+	newGatewayMux(d).ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "admin_disabled") {
+		t.Fatalf("%d %s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestAdminRoutesRepointsDirectCallers covers the handlers that call the
+// aggregator themselves instead of proxying to it.
+func TestAdminRoutesRepointsDirectCallers(t *testing.T) {
+	d, _, _ := newTestGatewayRoutes(t)
+	d.adminKey = "admin-secret"
+	mux := newGatewayMux(d)
+
+	hits := make(chan string, 16)
+	green := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case hits <- r.URL.Path:
+		default:
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/results" {
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"total_results":7}`))
+	}))
+	defer green.Close()
+
+	req := httptest.NewRequest(http.MethodPut, "/api/gateway/admin/routes", strings.NewReader(`{"service":"aggregator","url":"`+green.URL+`"}`))
+	req.Header.Set("X-Admin-Key", "admin-secret")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", rec.Code, rec.Body.String())
+	}
+	waitHit := func(what, path string) {
+		t.Helper()
+		deadline := time.After(2 * time.Second)
+		for {
+			select {
+			case got := <-hits:
+				if got == path {
+					return
+				}
+			case <-deadline:
+				t.Fatalf("%s never reached the repointed aggregator at %s", what, path)
+			}
+		}
+	}
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	streamReq, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/results/stream?profile_id=repoint", nil)
+	go func() {
+		if resp, err := http.DefaultClient.Do(streamReq); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	waitHit("/api/results/stream", "/results")
+	cancel()
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/summary", nil))
+	waitHit("/api/summary", "/results/summary")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"total_results":7`) {
+		t.Fatalf("summary: %d %s", rec.Code, rec.Body.String())
+	}
+}
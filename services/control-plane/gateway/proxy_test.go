@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestProxyStreamsIncrementally checks that SSE and chunked upstream bodies
+// reach the client event by event through the gateway's middleware, not
+// once the upstream finishes. The upstream only sends each event after the
+// client has seen the previous one, so any buffering deadlocks into the
+// test timeout.
+func TestProxyStreamsIncrementally(t *testing.T) {
+	for _, tc := range []struct {
+		name, contentType string
+	}{
+		{"sse", "text/event-stream"},
+		{"chunked", "application/x-ndjson"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			seen := make(chan int)
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/stream" {
+					t.Errorf("upstream path %q", r.URL.Path)
+				}
+				w.Header().Set("Content-Type", tc.contentType)
+				for i := 1; i <= 3; i++ {
+					fmt.Fprintf(w, "data: %d\n\n", i)
+					w.(http.Flusher).Flush()
+					select {
+					case <-seen:
+					case <-time.After(5 * time.Second):
+						return
+					case <-r.Context().Done():
+						return
+					}
+					time.Sleep(50 * time.Millisecond)
+				}
+			}))
+			defer upstream.Close()
+
+			handler := withLogging(withRequestTimeout(defaultRequestTimeoutMax)(withFieldFilter(
+				stripPrefixProxy("/api/reporter", mustProxy(upstream.URL, 5*time.Second)))), nil)
+			gw := httptest.NewServer(handler)
+			defer gw.Close()
+
+			resp, err := http.Get(gw.URL + "/api/reporter/stream")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			sc := bufio.NewScanner(resp.Body)
+			got := 0
+			for sc.Scan() {
+				line := sc.Text()
+				if !strings.HasPrefix(line, "data: ") {
+					continue
+				}
+				got++
+				if line != fmt.Sprintf("data: %d", got) {
+					t.Fatalf("event %d: %q", got, line)
+				}
+				select {
+				case seen <- got:
+				case <-time.After(5 * time.Second):
+					t.Fatalf("upstream stopped waiting after event %d", got)
+				}
+			}
+			if got != 3 {
+				t.Fatalf("received %d events, want 3 (err %v)", got, sc.Err())
+			}
+		})
+	}
+}
+
+func TestProxyClientCancelIsNotBadGateway(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	p := mustProxy(upstream.URL, 5*time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/slow", nil).WithContext(ctx)
+	time.AfterFunc(50*time.Millisecond, cancel)
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	if rec.Code != statusClientClosedRequest || rec.Body.Len() != 0 {
+		t.Fatalf("canceled request: %d %q, want %d with no body", rec.Code, rec.Body.String(), statusClientClosedRequest)
+	}
+	if st := p.breaker.status(); st.State != "closed" {
+		t.Fatalf("a client cancel must not count against the upstream: %+v", st)
+	}
+
+	down := mustProxy("http://127.0.0.1:1", time.Second)
+	rec = httptest.NewRecorder()
+	down.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/x", nil))
+	if rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), "upstream_unavailable") {
+		t.Fatalf("unreachable upstream: %d %s", rec.Code, rec.Body.String())
+	}
+}
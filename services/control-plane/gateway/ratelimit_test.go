@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterTenantIsolation(t *testing.T) {
+	type call struct {
+		tenant, key string
+		want        bool
+	}
+	cases := []struct {
+		name  string
+		calls []call
+	}{
+		{
+			name: "heavy tenant does not starve another tenant",
+			calls: []call{
+				{"a", "jwt:u1", true},
+				{"a", "jwt:u1", true},
+				{"a", "jwt:u1", false},
+				{"b", "jwt:u1", true},
+				{"b", "jwt:u1", true},
+			},
+		},
+		{
+			name: "principals within a tenant have separate buckets",
+			calls: []call{
+				{"a", "jwt:u1", true},
+				{"a", "jwt:u1", true},
+				{"a", "jwt:u2", true},
+				{"a", "jwt:u1", false},
+			},
+		},
+		{
+			name: "unauthenticated callers use the default buckets",
+			calls: []call{
+				{"", "ip:10.0.0.1", true},
+				{"", "ip:10.0.0.1", true},
+				{"", "ip:10.0.0.1", true},
+				{"", "ip:10.0.0.1", false},
+				{"a", "ip:10.0.0.1", true},
+			},
+		},
+		{
+			name: "tenant buckets do not collide with principal buckets",
+			calls: []call{
+				{"", "a@jwt:u1", true},
+				{"", "a@jwt:u1", true},
+				{"", "a@jwt:u1", true},
+				{"a", "jwt:u1", true},
+				{"a", "jwt:u1", true},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rl := newRateLimiter(1, 3)
+			rl.setTenantLimits(1, 2)
+			for i, c := range tc.calls {
+				if got := rl.allow(c.tenant, c.key, "/api/profiles").allowed; got != c.want {
+					t.Fatalf("call %d (%s/%s): got %v want %v", i, c.tenant, c.key, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRateRules(t *testing.T) {
+	rules, err := parseRateRules("/api/crypto/*=50:100, /api/reports=5:10,bad,/api/x=0:1")
+	if err == nil || !strings.Contains(err.Error(), "bad") || !strings.Contains(err.Error(), "/api/x=0:1") {
+		t.Fatalf("expected invalid entries to be reported, got %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 valid rules, got %+v", rules)
+	}
+	rl := newRateLimiter(1, 1, rules...)
+	cases := []struct {
+		path    string
+		pattern string
+		ok      bool
+	}{
+		{"/api/crypto/stream", "/api/crypto", true},
+		{"/api/crypto", "/api/crypto", true},
+		{"/api/cryptos", "", false},
+		{"/api/reports", "/api/reports", true},
+		{"/api/reports/r1", "", false},
+	}
+	for _, tc := range cases {
+		rule, ok := rl.matchRule(tc.path)
+		if ok != tc.ok || rule.pattern != tc.pattern {
+			t.Fatalf("%s: got %q/%v want %q/%v", tc.path, rule.pattern, ok, tc.pattern, tc.ok)
+		}
+	}
+	if rules, err := parseRateRules(""); err != nil || len(rules) != 0 {
+		t.Fatalf("empty spec must yield no rules, got %v %v", rules, err)
+	}
+}
+
+func TestParseRateRulesOverrideSyntax(t *testing.T) {
+	rules, err := parseRateRules(" /api/crypto/* : 2 : 4 ,/api/events:1:2, /api/profiles/p1:pause:3:5 ,/api/x:1, :1:2")
+	if err == nil || !strings.Contains(err.Error(), "/api/x:1") || !strings.Contains(err.Error(), ":1:2") {
+		t.Fatalf("expected malformed entries to be reported, got %v", err)
+	}
+	want := []rateRule{
+		{pattern: "/api/crypto", prefix: true, rps: 2, burst: 4},
+		{pattern: "/api/events", rps: 1, burst: 2},
+		{pattern: "/api/profiles/p1:pause", rps: 3, burst: 5},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("got %+v", rules)
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Fatalf("rule %d: got %+v want %+v", i, rules[i], want[i])
+		}
+	}
+}
+
+func TestRateLimitDistinctRoutesSamePrincipal(t *testing.T) {
+	rules, _ := parseRateRules("/api/crypto/*:2:4,/api/events:1:2")
+	rl := newRateLimiter(10, 20, rules...)
+	now := time.Unix(1_700_000_000, 0)
+	rl.now = func() time.Time { return now }
+	h := withRateLimit(rl)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	do := func(path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), ctxPrincipal, "apikey:abc"))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	allowed := func(path string, n int) int {
+		ok := 0
+		for i := 0; i < n; i++ {
+			if do(path) == http.StatusOK {
+				ok++
+			}
+		}
+		return ok
+	}
+	if got := allowed("/api/crypto/stream", 10); got != 4 {
+		t.Fatalf("crypto burst: %d allowed, want 4", got)
+	}
+	if got := allowed("/api/events", 10); got != 2 {
+		t.Fatalf("events burst: %d allowed, want 2", got)
+	}
+	if got := allowed("/api/health", 10); got != 10 {
+		t.Fatalf("unmatched route should use the default limit, %d of 10 allowed", got)
+	}
+
+	now = now.Add(time.Second)
+	if do("/api/crypto/top") != http.StatusOK || do("/api/events") != http.StatusOK {
+		t.Fatal("each route should refill at its own rate")
+	}
+	if do("/api/events") != http.StatusTooManyRequests {
+		t.Fatal("events refills one token per second")
+	}
+}
+
+func TestRateLimitRouteRulesAndHeaders(t *testing.T) {
+	rules, _ := parseRateRules("/api/crypto/*=1:3")
+	rl := newRateLimiter(1, 1, rules...)
+	h := withRateLimit(rl)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	do := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// The crypto route has its own burst of 3 and does not drain the default bucket.
+	for i, want := range []string{"2", "1", "0"} {
+		rr := do("/api/crypto/stream")
+		if rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Remaining") != want {
+			t.Fatalf("crypto call %d: status=%d remaining=%q", i, rr.Code, rr.Header().Get("X-RateLimit-Remaining"))
+		}
+	}
+	if rr := do("/api/profiles"); rr.Code != http.StatusOK {
+		t.Fatalf("default route starved by crypto calls: %d", rr.Code)
+	}
+
+	rr := do("/api/crypto/ticker")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rr.Code)
+	}
+	if ra, err := strconv.Atoi(rr.Header().Get("Retry-After")); err != nil || ra != 1 {
+		t.Fatalf("expected Retry-After of 1s for a 1 rps bucket, got %q", rr.Header().Get("Retry-After"))
+	}
+	if rr := do("/api/profiles"); rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected default bucket to be exhausted with Retry-After, got %d", rr.Code)
+	}
+}
+
+func TestRateLimiterEvictsIdleBuckets(t *testing.T) {
+	rl := newRateLimiter(10, 20)
+	now := time.Unix(1_700_000_000, 0)
+	rl.now = func() time.Time { return now }
+
+	for i := 0; i < 5000; i++ {
+		rl.allow("", "ip:10.0."+strconv.Itoa(i/256)+"."+strconv.Itoa(i%256), "/api/profiles")
+		if i%2 == 0 {
+			rl.allow("t1", "jwt:u"+strconv.Itoa(i), "/api/profiles")
+		}
+	}
+	if got := len(rl.bkt) + len(rl.tenantBkt); got != 7500 {
+		t.Fatalf("expected 7500 buckets, got %d", got)
+	}
+
+	now = now.Add(5 * time.Minute)
+	rl.allow("", "ip:10.0.0.1", "/api/profiles")
+	if n := rl.evictIdle(); n != 0 {
+		t.Fatalf("nothing is idle yet, evicted %d", n)
+	}
+
+	now = now.Add(6 * time.Minute)
+	if n := rl.evictIdle(); n != 7499 {
+		t.Fatalf("expected 7499 idle buckets evicted, got %d", n)
+	}
+	if _, ok := rl.bkt["ip:10.0.0.1"]; !ok || len(rl.bkt)+len(rl.tenantBkt) != 1 {
+		t.Fatalf("recently used bucket should survive, have %d buckets", len(rl.bkt)+len(rl.tenantBkt))
+	}
+	if m := metricsSnapshot(); m.RateBuckets != 1 {
+		t.Fatalf("metrics should report 1 bucket, got %d", m.RateBuckets)
+	}
+}
+
+func TestRateLimiterKeepsDrainedSlowBuckets(t *testing.T) {
+	rules, err := parseRateRules("/api/exports/*=1:1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rl := newRateLimiter(10, 20, rules...)
+	now := time.Unix(1_700_000_000, 0)
+	rl.now = func() time.Time { return now }
+	for i := 0; i < 1000; i++ {
+		rl.allow("", "ip:10.0.0.1", "/api/exports/x")
+	}
+	if d := rl.allow("", "ip:10.0.0.1", "/api/exports/x"); d.allowed {
+		t.Fatal("expected the slow bucket to be drained")
+	}
+
+	// Idle past the window but only ~660 of 1000 tokens back: evicting now
+	// would hand the caller a full burst early.
+	now = now.Add(11 * time.Minute)
+	if n := rl.evictIdle(); n != 0 {
+		t.Fatalf("a bucket still refilling must not be evicted, evicted %d", n)
+	}
+	now = now.Add(6 * time.Minute)
+	if n := rl.evictIdle(); n != 1 {
+		t.Fatalf("a refilled idle bucket should be evicted, evicted %d", n)
+	}
+}
+
+func TestRateLimitHeadersOnEveryResponse(t *testing.T) {
+	rl := newRateLimiter(2, 4)
+	now := time.Unix(1_700_000_000, 0)
+	rl.now = func() time.Time { return now }
+	h := withRateLimit(rl)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	do := func(method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/profiles", nil)
+		req.RemoteAddr = "10.0.0.9:1234"
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do(http.MethodOptions); rr.Header().Get("X-RateLimit-Limit") != "" {
+		t.Fatal("preflight responses must not carry rate limit headers")
+	}
+	// 2 tokens/s, burst 4: each call pushes the full-bucket time 0.5s further out.
+	for i, want := range []struct{ remaining, reset string }{
+		{"3", "1700000001"}, // 0.5s, rounded up
+		{"2", "1700000001"},
+		{"1", "1700000002"}, // 1.5s
+		{"0", "1700000002"},
+	} {
+		rr := do(http.MethodGet)
+		if rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Limit") != "4" ||
+			rr.Header().Get("X-RateLimit-Remaining") != want.remaining || rr.Header().Get("X-RateLimit-Reset") != want.reset {
+			t.Fatalf("call %d: %d limit=%q remaining=%q reset=%q", i, rr.Code,
+				rr.Header().Get("X-RateLimit-Limit"), rr.Header().Get("X-RateLimit-Remaining"), rr.Header().Get("X-RateLimit-Reset"))
+		}
+	}
+	rr := do(http.MethodGet)
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" ||
+		rr.Header().Get("X-RateLimit-Limit") != "4" || rr.Header().Get("X-RateLimit-Remaining") != "0" || rr.Header().Get("X-RateLimit-Reset") != "1700000002" {
+		t.Fatalf("429 headers: %d %v", rr.Code, rr.Header())
+	}
+}
+
+func TestRateLimitRetryHint(t *testing.T) {
+	orig := rateLimitJitter
+	rateLimitJitter = func(wait time.Duration) time.Duration { return wait / 4 }
+	defer func() { rateLimitJitter = orig }()
+
+	rl := newRateLimiter(2, 1)
+	now := time.Unix(1_700_000_000, 0)
+	rl.now = func() time.Time { return now }
+	h := withRateLimit(rl)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	do := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/profiles", nil)
+		req.RemoteAddr = "10.0.0.9:1234"
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := do(); rr.Code != http.StatusOK {
+		t.Fatalf("first call: %d", rr.Code)
+	}
+	// The bucket is empty and refills at 2 tokens/s: the next token is 500ms away.
+	rr := do()
+	var body map[string]any
+	_ = json.Unmarshal(rr.Body.Bytes(), &body)
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" ||
+		body["retry_after_seconds"] != float64(1) || body["retry_after_ms"] != float64(625) {
+		t.Fatalf("429: %d %v %v", rr.Code, rr.Header(), body)
+	}
+	now = now.Add(250 * time.Millisecond)
+	_ = json.Unmarshal(do().Body.Bytes(), &body)
+	if body["retry_after_ms"] != float64(312) {
+		t.Fatalf("hint after 250ms: %v", body)
+	}
+
+	for _, wait := range []time.Duration{10 * time.Millisecond, 2 * time.Second} {
+		for i := 0; i < 50; i++ {
+			j := orig(wait)
+			if j < 0 || j > max(wait/4, 100*time.Millisecond) {
+				t.Fatalf("jitter %v for wait %v out of range", j, wait)
+			}
+		}
+	}
+}
+
+// TestRateLimitKeysOnFilteredClientIP checks that anonymous callers are
+// bucketed by the address the IP filter resolved, not a forged header.
+func TestRateLimitKeysOnFilteredClientIP(t *testing.T) {
+	rl := newRateLimiter(1, 1)
+	rl.now = func() time.Time { return time.Unix(1_700_000_000, 0) }
+	f := newTestIPFilter(t, ipFilterSource{}, "10.0.0.1/32")
+	h := withIPFilter(f)(withRateLimit(rl)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	do := func(remote, xff string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/summary", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-Forwarded-For", xff)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if do("172.16.0.1:5000", "1.1.1.1") != http.StatusOK {
+		t.Fatal("first request should pass")
+	}
+	if got := do("172.16.0.1:5001", "2.2.2.2"); got != http.StatusTooManyRequests {
+		t.Fatalf("rotating X-Forwarded-For from an untrusted peer must not reset the bucket, got %d", got)
+	}
+	if do("10.0.0.1:5000", "3.3.3.3") != http.StatusOK || do("10.0.0.1:5000", "4.4.4.4") != http.StatusOK {
+		t.Fatal("clients behind a trusted proxy should get their own buckets")
+	}
+	if got := do("10.0.0.1:5000", "3.3.3.3"); got != http.StatusTooManyRequests {
+		t.Fatalf("a forwarded client keeps its bucket, got %d", got)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Custom reports ---
+
+var errUnknownProfile = errors.New("unknown_profile")
+
+// reportSource returns the aggregator rows for one profile, or
+// errUnknownProfile when the registry does not know it.
+type reportSource func(ctx context.Context, profileID string) ([]aggResult, error)
+
+func newReportSource(regURL, aggURL func() string) reportSource {
+	c := &http.Client{Timeout: 5 * time.Second}
+	return func(ctx context.Context, profileID string) ([]aggResult, error) {
+		u := strings.TrimSuffix(regURL(), "/") + "/profiles/" + url.PathEscape(profileID)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		injectTrace(req)
+		resp, err := c.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, errUnknownProfile
+		}
+		if resp.StatusCode/100 != 2 {
+			return nil, fmt.Errorf("registry_non_2xx: %d", resp.StatusCode)
+		}
+		return fetchAggregatorResults(ctx, aggURL(), profileID, 1000)
+	}
+}
+
+type reportPoint struct {
+	T string  `json:"t"`
+	Y float64 `json:"y"`
+}
+
+// buildCustomReport joins the rows of every spec profile on spec.JoinKey and
+// projects spec.Metrics. Problems are reported in meta.warnings instead of
+// falling back to other data.
+func buildCustomReport(ctx context.Context, id string, spec reportSpec, src reportSource) (map[string]any, error) {
+	warnings := make([]string, 0)
+	mode := strings.ToLower(strings.TrimSpace(spec.Mode))
+	if mode == "" {
+		mode = "timeseries"
+	}
+	if mode != "timeseries" && mode != "correlation" {
+		warnings = append(warnings, fmt.Sprintf("unsupported_mode mode=%s using=timeseries", mode))
+		mode = "timeseries"
+	}
+	joinKey := strings.TrimSpace(spec.JoinKey)
+	if joinKey == "" {
+		warnings = append(warnings, "missing_join_key")
+	}
+	if len(spec.Metrics) == 0 {
+		warnings = append(warnings, "no_metrics")
+	}
+	if len(spec.Profiles) == 0 {
+		warnings = append(warnings, "no_profiles")
+	}
+
+	// columns are "<profile>.<metric>"; tables map join value -> column -> value.
+	columns := make([]string, 0, len(spec.Profiles)*len(spec.Metrics))
+	tables := make([]map[string]map[string]float64, 0, len(spec.Profiles))
+	if joinKey != "" {
+		for _, pid := range spec.Profiles {
+			rows, err := src(ctx, pid)
+			if errors.Is(err, errUnknownProfile) {
+				warnings = append(warnings, "unknown_profile profile="+pid)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if len(rows) == 0 {
+				warnings = append(warnings, "no_results profile="+pid)
+			}
+			table, missing := projectReportRows(rows, pid, joinKey, spec.Metrics)
+			if missing > 0 {
+				warnings = append(warnings, fmt.Sprintf("rows_missing_join_key profile=%s count=%d", pid, missing))
+			}
+			tables = append(tables, table)
+			for _, m := range spec.Metrics {
+				columns = append(columns, pid+"."+m)
+			}
+		}
+	}
+
+	keys := joinReportKeys(tables)
+	if len(tables) > 0 && len(keys) == 0 {
+		warnings = append(warnings, "empty_join")
+	}
+
+	joined := make(map[string]map[string]float64, len(keys))
+	for _, k := range keys {
+		row := make(map[string]float64)
+		for _, t := range tables {
+			for col, v := range t[k] {
+				row[col] = v
+			}
+		}
+		joined[k] = row
+	}
+
+	out := map[string]any{
+		"id":         id,
+		"title":      "Custom Report",
+		"mode":       mode,
+		"updated_at": time.Now().UTC().Format(time.RFC3339),
+		"meta": map[string]any{
+			"source_profiles": spec.Profiles,
+			"join_key":        joinKey,
+			"metrics":         spec.Metrics,
+			"joined_rows":     len(keys),
+			"warnings":        warnings,
+		},
+	}
+	switch mode {
+	case "correlation":
+		rows := make([]map[string]any, 0, len(keys))
+		for _, k := range keys {
+			rows = append(rows, map[string]any{"key": k, "values": joined[k]})
+		}
+		out["rows"] = rows
+		out["correlations"] = reportCorrelations(columns, keys, joined)
+	default:
+		series := make([]map[string]any, 0, len(columns))
+		for _, col := range columns {
+			points := make([]reportPoint, 0, len(keys))
+			for _, k := range keys {
+				if v, ok := joined[k][col]; ok {
+					points = append(points, reportPoint{T: k, Y: v})
+				}
+			}
+			series = append(series, map[string]any{"name": col, "points": points})
+		}
+		out["series"] = series
+	}
+	return out, nil
+}
+
+// projectReportRows indexes rows by join value, keeping the latest row per
+// value. It returns the number of rows that lacked the join key.
+func projectReportRows(rows []aggResult, profileID, joinKey string, metrics []string) (map[string]map[string]float64, int) {
+	sorted := append([]aggResult(nil), rows...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return getTimestamp(sorted[i], resultData(sorted[i])).Before(getTimestamp(sorted[j], resultData(sorted[j])))
+	})
+	out := make(map[string]map[string]float64)
+	missing := 0
+	for _, r := range sorted {
+		data := resultData(r)
+		kv, ok := lookupPath(data, joinKey)
+		if !ok || kv == nil || fmt.Sprint(kv) == "" {
+			missing++
+			continue
+		}
+		key := fmt.Sprint(kv)
+		row := make(map[string]float64, len(metrics))
+		for _, m := range metrics {
+			v, ok := lookupPath(data, m)
+			if !ok {
+				continue
+			}
+			if f, ok := asFloat(v); ok {
+				row[profileID+"."+m] = f
+			}
+		}
+		out[key] = row
+	}
+	return out, missing
+}
+
+// joinReportKeys returns the join values present in every table (inner join),
+// sorted numerically when all keys are numbers and lexically otherwise.
+func joinReportKeys(tables []map[string]map[string]float64) []string {
+	if len(tables) == 0 {
+		return []string{}
+	}
+	keys := make([]string, 0)
+	for k := range tables[0] {
+		inAll := true
+		for _, t := range tables[1:] {
+			if _, ok := t[k]; !ok {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			keys = append(keys, k)
+		}
+	}
+	numeric := true
+	for _, k := range keys {
+		if _, err := strconv.ParseFloat(k, 64); err != nil {
+			numeric = false
+			break
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if numeric {
+			a, _ := strconv.ParseFloat(keys[i], 64)
+			b, _ := strconv.ParseFloat(keys[j], 64)
+			return a < b
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// reportCorrelations computes the Pearson coefficient for every column pair.
+func reportCorrelations(columns, keys []string, joined map[string]map[string]float64) []map[string]any {
+	out := make([]map[string]any, 0)
+	for i := 0; i < len(columns); i++ {
+		for j := i + 1; j < len(columns); j++ {
+			xs := make([]float64, 0, len(keys))
+			ys := make([]float64, 0, len(keys))
+			for _, k := range keys {
+				x, okx := joined[k][columns[i]]
+				y, oky := joined[k][columns[j]]
+				if okx && oky {
+					xs = append(xs, x)
+					ys = append(ys, y)
+				}
+			}
+			entry := map[string]any{"a": columns[i], "b": columns[j], "n": len(xs)}
+			if r, ok := pearson(xs, ys); ok {
+				entry["r"] = r
+			} else {
+				entry["r"] = nil
+			}
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+func pearson(xs, ys []float64) (float64, bool) {
+	n := float64(len(xs))
+	if len(xs) < 2 {
+		return 0, false
+	}
+	var sx, sy float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+	}
+	mx, my := sx/n, sy/n
+	var cov, vx, vy float64
+	for i := range xs {
+		dx, dy := xs[i]-mx, ys[i]-my
+		cov += dx * dy
+		vx += dx * dx
+		vy += dy * dy
+	}
+	if vx == 0 || vy == 0 {
+		return 0, false
+	}
+	return cov / math.Sqrt(vx*vy), true
+}
+
+// lookupPath resolves a dotted path such as "dims.time.date" in a record.
+func lookupPath(data map[string]any, path string) (any, bool) {
+	var cur any = data
+	for _, part := range strings.Split(path, ".") {
+		m := asMap(cur)
+		if m == nil {
+			return nil, false
+		}
+		v, ok := m[part]
+		if !ok {
+			return nil, false
+		}
+		cur = v
+	}
+	return cur, true
+}
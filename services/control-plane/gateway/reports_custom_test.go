@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func fakeReportSource(rows map[string][]aggResult) reportSource {
+	return func(_ context.Context, profileID string) ([]aggResult, error) {
+		r, ok := rows[profileID]
+		if !ok {
+			return nil, errUnknownProfile
+		}
+		return r, nil
+	}
+}
+
+func reportRow(ts string, data map[string]any) aggResult {
+	return aggResult{Timestamp: ts, Data: data}
+}
+
+func reportWarnings(t *testing.T, payload map[string]any) []string {
+	t.Helper()
+	return payload["meta"].(map[string]any)["warnings"].([]string)
+}
+
+func twoProfileRows() map[string][]aggResult {
+	return map[string][]aggResult{
+		"gdp": {
+			reportRow("2026-01-01T00:00:00Z", map[string]any{"dims": map[string]any{"year": "2020"}, "measures": map[string]any{"value": 10.0}}),
+			reportRow("2026-01-01T00:00:00Z", map[string]any{"dims": map[string]any{"year": "2021"}, "measures": map[string]any{"value": 20.0}}),
+			reportRow("2026-01-01T00:00:00Z", map[string]any{"dims": map[string]any{"year": "2022"}, "measures": map[string]any{"value": 30.0}}),
+		},
+		"jobs": {
+			reportRow("2026-01-01T00:00:00Z", map[string]any{"dims": map[string]any{"year": "2021"}, "measures": map[string]any{"value": "2"}}),
+			reportRow("2026-01-01T00:00:00Z", map[string]any{"dims": map[string]any{"year": "2022"}, "measures": map[string]any{"value": 4.0}}),
+			reportRow("2026-01-01T00:00:00Z", map[string]any{"dims": map[string]any{"year": "2023"}, "measures": map[string]any{"value": 8.0}}),
+		},
+	}
+}
+
+func TestCustomReportTwoProfileJoin(t *testing.T) {
+	spec := reportSpec{Profiles: []string{"gdp", "jobs"}, JoinKey: "dims.year", Metrics: []string{"measures.value"}, Mode: "timeseries"}
+	payload, err := buildCustomReport(context.Background(), "r1", spec, fakeReportSource(twoProfileRows()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := reportWarnings(t, payload); len(w) != 0 {
+		t.Fatalf("unexpected warnings: %v", w)
+	}
+	series := payload["series"].([]map[string]any)
+	if len(series) != 2 || series[0]["name"] != "gdp.measures.value" || series[1]["name"] != "jobs.measures.value" {
+		t.Fatalf("unexpected series: %v", series)
+	}
+	points := series[1]["points"].([]reportPoint)
+	if len(points) != 2 || points[0] != (reportPoint{T: "2021", Y: 2}) || points[1] != (reportPoint{T: "2022", Y: 4}) {
+		t.Fatalf("expected inner join on 2021/2022, got %v", points)
+	}
+
+	spec.Mode = "correlation"
+	payload, err = buildCustomReport(context.Background(), "r1", spec, fakeReportSource(twoProfileRows()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	corr := payload["correlations"].([]map[string]any)
+	if len(corr) != 1 || corr[0]["n"] != 2 || corr[0]["r"].(float64) < 0.999 {
+		t.Fatalf("unexpected correlations: %v", corr)
+	}
+}
+
+func TestCustomReportMissingJoinKey(t *testing.T) {
+	rows := twoProfileRows()
+	rows["jobs"] = append(rows["jobs"], reportRow("2026-01-01T00:00:00Z", map[string]any{"measures": map[string]any{"value": 1.0}}))
+
+	spec := reportSpec{Profiles: []string{"gdp", "jobs", "nope"}, JoinKey: "dims.year", Metrics: []string{"measures.value"}}
+	payload, err := buildCustomReport(context.Background(), "r1", spec, fakeReportSource(rows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := strings.Join(reportWarnings(t, payload), "|")
+	if !strings.Contains(w, "rows_missing_join_key profile=jobs count=1") || !strings.Contains(w, "unknown_profile profile=nope") {
+		t.Fatalf("expected missing key and unknown profile warnings, got %q", w)
+	}
+
+	spec = reportSpec{Profiles: []string{"gdp", "jobs"}, Metrics: []string{"measures.value"}, Mode: "correlation"}
+	payload, err = buildCustomReport(context.Background(), "r1", spec, fakeReportSource(rows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := reportWarnings(t, payload); len(w) != 1 || w[0] != "missing_join_key" {
+		t.Fatalf("expected missing_join_key warning, got %v", w)
+	}
+	if got := payload["rows"].([]map[string]any); len(got) != 0 {
+		t.Fatalf("expected no rows without a join key, got %v", got)
+	}
+
+	spec = reportSpec{Profiles: []string{"gdp", "jobs"}, JoinKey: "dims.region", Metrics: []string{"measures.value"}}
+	payload, _ = buildCustomReport(context.Background(), "r1", spec, fakeReportSource(rows))
+	if w := strings.Join(reportWarnings(t, payload), "|"); !strings.Contains(w, "empty_join") {
+		t.Fatalf("expected empty_join warning, got %q", w)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Report persistence ---
+
+const (
+	reportKeyPrefix = "reports/"
+	reportIndexKey  = "reports/_index"
+)
+
+// reportStorage mirrors custom report specs into the storage service so they
+// survive gateway restarts. Storage has no listing API, so an index object
+// holds the current report IDs in creation order.
+type reportStorage struct {
+	baseURL  string
+	tenant   string
+	client   *http.Client
+	attempts int
+	backoff  time.Duration
+
+	mu sync.Mutex
+}
+
+func newReportStorage(baseURL, tenant string) *reportStorage {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if baseURL == "" {
+		return nil
+	}
+	return &reportStorage{
+		baseURL:  baseURL,
+		tenant:   tenant,
+		client:   &http.Client{Timeout: 3 * time.Second},
+		attempts: 3,
+		backoff:  250 * time.Millisecond,
+	}
+}
+
+// save writes the entry and the current index; failures are logged only.
+func (p *reportStorage) save(it reportEntry, ids func() []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	body, err := json.Marshal(it)
+	if err != nil {
+		return
+	}
+	if err := p.retry(http.MethodPut, reportKeyPrefix+it.ID, body); err != nil {
+		slog.Warn("report_persist_failed", "id", it.ID, "err", err)
+		return
+	}
+	p.writeIndex(ids())
+}
+
+func (p *reportStorage) remove(id string, ids func() []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.retry(http.MethodDelete, reportKeyPrefix+id, nil); err != nil {
+		slog.Warn("report_delete_failed", "id", id, "err", err)
+	}
+	p.writeIndex(ids())
+}
+
+func (p *reportStorage) writeIndex(ids []string) {
+	body, _ := json.Marshal(ids)
+	if err := p.retry(http.MethodPut, reportIndexKey, body); err != nil {
+		slog.Warn("report_index_persist_failed", "err", err)
+	}
+}
+
+// load fetches every indexed report. Missing objects are skipped.
+func (p *reportStorage) load(ctx context.Context) ([]reportEntry, error) {
+	b, status, err := p.do(ctx, http.MethodGet, reportIndexKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if status/100 != 2 {
+		return nil, fmt.Errorf("storage_status_%d", status)
+	}
+	var ids []string
+	if err := json.Unmarshal(b, &ids); err != nil {
+		return nil, err
+	}
+	out := make([]reportEntry, 0, len(ids))
+	for _, id := range ids {
+		b, status, err := p.do(ctx, http.MethodGet, reportKeyPrefix+id, nil)
+		if err != nil {
+			return nil, err
+		}
+		if status/100 != 2 {
+			continue
+		}
+		var it reportEntry
+		if err := json.Unmarshal(b, &it); err != nil || it.ID == "" {
+			continue
+		}
+		out = append(out, it)
+	}
+	return out, nil
+}
+
+func (p *reportStorage) retry(method, key string, body []byte) error {
+	var lastErr error
+	for attempt := 1; attempt <= p.attempts; attempt++ {
+		_, status, err := p.do(context.Background(), method, key, body)
+		switch {
+		case err != nil:
+			lastErr = err
+		case status/100 == 2 || (method == http.MethodDelete && status == http.StatusNotFound):
+			return nil
+		default:
+			lastErr = fmt.Errorf("storage_status_%d", status)
+		}
+		if attempt < p.attempts {
+			time.Sleep(p.backoff * time.Duration(attempt))
+		}
+	}
+	return lastErr
+}
+
+func (p *reportStorage) do(ctx context.Context, method, key string, body []byte) ([]byte, int, error) {
+	var rdr io.Reader
+	if body != nil {
+		rdr = bytes.NewReader(body)
+	}
+	u := p.baseURL + "/v0/objects?key=" + url.QueryEscape(key)
+	req, err := http.NewRequestWithContext(ctx, method, u, rdr)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("X-Tenant-Id", p.tenant)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	return b, resp.StatusCode, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeObjectStorage implements the subset of the storage object API used for reports.
+type fakeObjectStorage struct {
+	mu   sync.Mutex
+	objs map[string][]byte
+}
+
+func (f *fakeObjectStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := r.URL.Query().Get("key")
+	switch r.Method {
+	case http.MethodPut:
+		b, _ := io.ReadAll(r.Body)
+		f.objs[key] = b
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet:
+		b, ok := f.objs[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(b)
+	case http.MethodDelete:
+		delete(f.objs, key)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (f *fakeObjectStorage) has(key string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.objs[key]
+	return ok
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReportsSurviveRestart(t *testing.T) {
+	fake := &fakeObjectStorage{objs: make(map[string][]byte)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	first := newReportStore()
+	first.persist = newReportStorage(srv.URL, "t")
+	keep := first.add(reportSpec{Profiles: []string{"a", "b"}, JoinKey: "ts", Mode: "correlation"})
+	drop := first.add(reportSpec{Profiles: []string{"c"}})
+	waitFor(t, func() bool { return fake.has(reportKeyPrefix+keep) && fake.has(reportKeyPrefix+drop) })
+
+	if !first.remove(drop) {
+		t.Fatal("expected remove to find report")
+	}
+	waitFor(t, func() bool { return !fake.has(reportKeyPrefix + drop) })
+
+	second := newReportStore()
+	entries, err := newReportStorage(srv.URL, "t").load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.restore(entries)
+	it, ok := second.get(keep)
+	if !ok || it.Spec.JoinKey != "ts" || len(it.Spec.Profiles) != 2 {
+		t.Fatalf("report not restored: %+v", it)
+	}
+	if _, ok := second.get(drop); ok {
+		t.Fatal("deleted report was restored")
+	}
+}
+
+func TestReportStoreServesFromMemoryWhenStorageDown(t *testing.T) {
+	s := newReportStore()
+	s.persist = newReportStorage("http://127.0.0.1:1", "t")
+	s.persist.attempts = 1
+	id := s.add(reportSpec{Mode: "timeseries"})
+	if _, ok := s.get(id); !ok {
+		t.Fatal("expected report in memory")
+	}
+	if _, err := s.persist.load(context.Background()); err == nil {
+		t.Fatal("expected load error when storage is unreachable")
+	}
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Results stream ---
+
+// resultsReplayIdleTTL is how long a stream key's rows are kept after the
+// last record or resume for it.
+const resultsReplayIdleTTL = 10 * time.Minute
+
+// resultsReplay assigns monotonically increasing ids to result rows and keeps
+// the last max rows per stream key (the profile_id filter) so a reconnecting
+// client can resume from its Last-Event-ID instead of receiving a new snapshot.
+// Keys come from anonymous clients, so at most maxKeys logs are kept: logs
+// idle for idleTTL are dropped, then the least recently used.
+type resultsReplay struct {
+	mu      sync.Mutex
+	nextID  int64
+	max     int
+	maxKeys int
+	idleTTL time.Duration
+	now     func() time.Time
+	streams map[string]*resultsLog
+}
+
+type resultsLog struct {
+	entries []resultsEntry
+	byRow   map[string]int64
+	trimmed int64     // highest id dropped from entries
+	used    time.Time // last record or since
+}
+
+type resultsEntry struct {
+	ID  int64
+	Row aggResult
+}
+
+func newResultsReplay(max, maxKeys int) *resultsReplay {
+	if max < 1 {
+		max = 500
+	}
+	if maxKeys < 1 {
+		maxKeys = 256
+	}
+	return &resultsReplay{
+		max:     max,
+		maxKeys: maxKeys,
+		idleTTL: resultsReplayIdleTTL,
+		now:     time.Now,
+		streams: make(map[string]*resultsLog),
+	}
+}
+
+// evictLocked makes room for one more key: it drops idle logs and then, if
+// still at maxKeys, the least recently used ones. A resume on an evicted key
+// falls back to a snapshot.
+func (rp *resultsReplay) evictLocked(now time.Time) {
+	for key, lg := range rp.streams {
+		if now.Sub(lg.used) > rp.idleTTL {
+			delete(rp.streams, key)
+		}
+	}
+	for len(rp.streams) >= rp.maxKeys {
+		oldest := ""
+		var oldestUsed time.Time
+		for key, lg := range rp.streams {
+			if oldest == "" || lg.used.Before(oldestUsed) {
+				oldest, oldestUsed = key, lg.used
+			}
+		}
+		delete(rp.streams, oldest)
+	}
+}
+
+func resultRowKey(row aggResult) string {
+	if row.ID != "" {
+		return row.ID
+	}
+	return mustJSON(row)
+}
+
+// record buffers rows not seen before under key and returns the highest id
+// among rows (0 when rows is empty).
+func (rp *resultsReplay) record(key string, rows []aggResult) int64 {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	now := rp.now()
+	lg := rp.streams[key]
+	if lg == nil {
+		rp.evictLocked(now)
+		lg = &resultsLog{byRow: make(map[string]int64)}
+		rp.streams[key] = lg
+	}
+	lg.used = now
+	// Assign ids oldest first so they follow row time.
+	ordered := append([]aggResult(nil), rows...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return getTimestamp(ordered[i], resultData(ordered[i])).Before(getTimestamp(ordered[j], resultData(ordered[j])))
+	})
+	top := int64(0)
+	for _, row := range ordered {
+		rk := resultRowKey(row)
+		id, ok := lg.byRow[rk]
+		if !ok {
+			rp.nextID++
+			id = rp.nextID
+			lg.byRow[rk] = id
+			lg.entries = append(lg.entries, resultsEntry{ID: id, Row: row})
+		}
+		if id > top {
+			top = id
+		}
+	}
+	if over := len(lg.entries) - rp.max; over > 0 {
+		for _, e := range lg.entries[:over] {
+			delete(lg.byRow, resultRowKey(e.Row))
+			lg.trimmed = e.ID
+		}
+		lg.entries = append([]resultsEntry(nil), lg.entries[over:]...)
+	}
+	return top
+}
+
+// since returns the buffered rows newer than lastID (oldest first), the
+// highest buffered id, and every buffered row. ok is false when the buffer
+// cannot prove continuity (unknown key, evicted rows, or ids from a previous
+// gateway process), in which case the caller falls back to a snapshot.
+func (rp *resultsReplay) since(key string, lastID int64) (newer []aggResult, top int64, all []aggResult, ok bool) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	lg := rp.streams[key]
+	if lg == nil || len(lg.entries) == 0 || lastID < lg.trimmed || lastID > rp.nextID {
+		return nil, 0, nil, false
+	}
+	lg.used = rp.now()
+	newer = make([]aggResult, 0)
+	all = make([]aggResult, 0, len(lg.entries))
+	for _, e := range lg.entries {
+		if e.ID > lastID {
+			newer = append(newer, e.Row)
+		}
+		if e.ID > top {
+			top = e.ID
+		}
+		all = append(all, e.Row)
+	}
+	return newer, top, all, true
+}
+
+func newResultsStreamHandler(pollers *resultsPollers, replay *resultsReplay) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "streaming_not_supported"})
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		limit := clampInt(queryInt(r, "limit", 50), 1, 500)
+		profileID := strings.TrimSpace(r.URL.Query().Get("profile_id"))
+		interval := pollers.clampInterval(queryInt(r, "poll_ms", 2000))
+
+		// An explicit since is also forwarded to the aggregator, which
+		// otherwise reads only its default window.
+		var since time.Time
+		if raw := strings.TrimSpace(r.URL.Query().Get("since")); raw != "" {
+			if t, ok := parseTimeRFC3339(raw); ok {
+				since = t
+			}
+		}
+		lastSeen := since
+		seenIDs := make(map[string]struct{})
+		defer metricsStreamOpen("results")()
+
+		send := func(id int64, payload any) {
+			writeSSEEvent(w, flusher, sseEvent{ID: id, Event: "results", Data: mustJSON(payload)})
+		}
+
+		ctx := r.Context()
+		rid := strings.TrimSpace(r.Header.Get("X-Request-ID"))
+		lastID := parseLastEventID(r.Header.Get("Last-Event-ID"))
+		slog.Info("results_sse_connect", "path", r.URL.Path, "request_id", rid, "last_event_id", lastID)
+
+		resumed := false
+		if lastID > 0 {
+			if newer, top, all, ok := replay.since(profileID, lastID); ok {
+				resumed = true
+				// The client holds everything buffered once newer is sent, so
+				// polling continues from the newest buffered row.
+				_, newest, seen := selectNewResults(all, time.Time{}, nil)
+				lastSeen, seenIDs = newest, seen
+				if len(newer) > 0 {
+					send(top, map[string]any{
+						"ts":   time.Now().UTC().Format(time.RFC3339),
+						"rows": newer,
+					})
+				}
+			}
+		}
+
+		sub, unsubscribe := pollers.subscribe(profileID, limit, since, interval)
+		defer unsubscribe()
+
+		keepalive := time.NewTicker(15 * time.Second)
+		defer keepalive.Stop()
+
+		// Without a resume the first successful poll is sent whole as the snapshot.
+		snapshotSent := resumed
+		for {
+			select {
+			case <-ctx.Done():
+				slog.Info("results_sse_disconnect", "path", r.URL.Path, "request_id", rid)
+				return
+			case <-keepalive.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+				flusher.Flush()
+			case u := <-sub.updates:
+				if u.err != nil {
+					payload := map[string]any{
+						"ts":    time.Now().UTC().Format(time.RFC3339),
+						"error": "upstream_error",
+						"rows":  []aggResult{},
+					}
+					var te *upstreamThrottledError
+					if errors.As(u.err, &te) {
+						payload["error"] = "upstream_throttled"
+						payload["retry_after_ms"] = te.retryAfter.Milliseconds()
+					}
+					send(0, payload)
+					continue
+				}
+				if !snapshotSent {
+					snapshotSent = true
+					snapshot := make([]aggResult, 0, len(u.rows))
+					snapshot = append(snapshot, u.rows...)
+					if len(snapshot) > 0 {
+						if ts := getTimestamp(snapshot[0], resultData(snapshot[0])); !ts.IsZero() {
+							lastSeen = ts
+							for _, row := range snapshot {
+								if row.ID != "" {
+									seenIDs[row.ID] = struct{}{}
+								}
+							}
+						}
+					}
+					send(replay.record(profileID, snapshot), map[string]any{
+						"ts":   time.Now().UTC().Format(time.RFC3339),
+						"rows": snapshot,
+					})
+					continue
+				}
+				newRows, newest, updatedSeen := selectNewResults(u.rows, lastSeen, seenIDs)
+				seenIDs = updatedSeen
+				if newest.After(lastSeen) {
+					lastSeen = newest
+				}
+				if len(newRows) == 0 {
+					continue
+				}
+				send(replay.record(profileID, newRows), map[string]any{
+					"ts":   time.Now().UTC().Format(time.RFC3339),
+					"rows": newRows,
+				})
+			}
+		}
+	}
+}
+
+// resultsPollers shares one aggregator poll loop per (profile_id, limit, since) across
+// all stream connections. Each loop fetches at the fastest poll_ms requested
+// by its subscribers while rows keep arriving and backs off (up to idleFactor
+// times that) while nothing changes. Per-client since/dedupe state stays in
+// the handler; the loop only fans out whatever the aggregator returned.
+type resultsPollers struct {
+	aggregatorURL func() string
+	minPoll       time.Duration
+	maxPoll       time.Duration
+	idleFactor    int
+
+	mu      sync.Mutex
+	pollers map[string]*resultsPoller
+	clients int
+}
+
+type resultsPoller struct {
+	profileID string
+	limit     int
+	// since is the client's explicit lower bound, zero for the
+	// aggregator's default window; it applies until rows are held.
+	since  time.Time
+	cancel context.CancelFunc
+	kick   chan struct{}
+
+	// guarded by resultsPollers.mu
+	subs   map[*resultsSub]struct{}
+	latest *resultsUpdate
+}
+
+type resultsSub struct {
+	interval time.Duration
+	updates  chan resultsUpdate
+}
+
+type resultsUpdate struct {
+	rows []aggResult
+	err  error
+}
+
+func newResultsPollers(aggregatorURL func() string) *resultsPollers {
+	return &resultsPollers{
+		aggregatorURL: aggregatorURL,
+		minPoll:       500 * time.Millisecond,
+		maxPoll:       10 * time.Second,
+		idleFactor:    4,
+		pollers:       make(map[string]*resultsPoller),
+	}
+}
+
+func (h *resultsPollers) clampInterval(ms int) time.Duration {
+	d := time.Duration(ms) * time.Millisecond
+	if d < h.minPoll {
+		d = h.minPoll
+	}
+	if d > h.maxPoll {
+		d = h.maxPoll
+	}
+	return d
+}
+
+// subscribe attaches to the poll loop for (profileID, limit, since),
+// starting it if needed. The latest fetched rows, if any, are delivered right away. The
+// returned func detaches; the loop stops with its last subscriber.
+func (h *resultsPollers) subscribe(profileID string, limit int, since time.Time, interval time.Duration) (*resultsSub, func()) {
+	key := fmt.Sprintf("%s|%d", profileID, limit)
+	if !since.IsZero() {
+		key += "|" + since.UTC().Format(time.RFC3339Nano)
+	}
+	sub := &resultsSub{interval: interval, updates: make(chan resultsUpdate, 1)}
+
+	h.mu.Lock()
+	p := h.pollers[key]
+	if p == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		p = &resultsPoller{profileID: profileID, limit: limit, since: since, cancel: cancel, kick: make(chan struct{}, 1), subs: make(map[*resultsSub]struct{})}
+		h.pollers[key] = p
+		go h.run(ctx, p)
+	}
+	p.subs[sub] = struct{}{}
+	h.clients++
+	if p.latest != nil {
+		sub.updates <- *p.latest
+	}
+	metricsResultsStream(h.clients, len(h.pollers))
+	h.mu.Unlock()
+
+	// A new subscriber may want a faster pace than the loop has backed off to.
+	select {
+	case p.kick <- struct{}{}:
+	default:
+	}
+
+	return sub, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := p.subs[sub]; !ok {
+			return
+		}
+		delete(p.subs, sub)
+		h.clients--
+		if len(p.subs) == 0 {
+			p.cancel()
+			delete(h.pollers, key)
+		}
+		metricsResultsStream(h.clients, len(h.pollers))
+	}
+}
+
+// baseInterval is the fastest poll interval requested by p's subscribers.
+func (h *resultsPollers) baseInterval(p *resultsPoller) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	base := h.maxPoll
+	for sub := range p.subs {
+		if sub.interval < base {
+			base = sub.interval
+		}
+	}
+	return base
+}
+
+func (h *resultsPollers) run(ctx context.Context, p *resultsPoller) {
+	var lastSeen time.Time
+	var seen map[string]struct{}
+	var window []aggResult
+	interval := time.Duration(0) // first fetch right away
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.kick:
+			if base := h.baseInterval(p); interval > base {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				interval = base
+				timer.Reset(interval)
+			}
+			continue
+		case <-timer.C:
+		}
+
+		// Only rows from the newest one already held onwards are read; the
+		// rest of the window comes from earlier polls, so subscribers still
+		// get the latest limit rows.
+		from := newestRowTimestamp(window)
+		if from.IsZero() {
+			from = p.since
+		}
+		rows, err := fetchAggregatorResultsSince(ctx, h.aggregatorURL(), p.profileID, p.limit, from)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			rows = mergeResultsWindow(rows, window, p.limit)
+			window = rows
+		}
+		metricsResultsPoll()
+
+		base := h.baseInterval(p)
+		active := false
+		if err == nil {
+			var newRows []aggResult
+			var newest time.Time
+			newRows, newest, seen = selectNewResults(rows, lastSeen, seen)
+			if newest.After(lastSeen) {
+				lastSeen = newest
+			}
+			active = len(newRows) > 0
+		}
+		if active || interval == 0 {
+			interval = base
+		} else if interval < base*time.Duration(h.idleFactor) {
+			// Idle or failing upstream: ease off until rows show up again.
+			interval *= 2
+			if ceiling := base * time.Duration(h.idleFactor); interval > ceiling {
+				interval = ceiling
+			}
+		}
+
+		h.publish(p, resultsUpdate{rows: rows, err: err})
+		var te *upstreamThrottledError
+		if errors.As(err, &te) && te.retryAfter > interval {
+			// Honor the aggregator's Retry-After; the next tick goes back to the usual pace.
+			timer.Reset(te.retryAfter)
+			continue
+		}
+		timer.Reset(interval)
+	}
+}
+
+// publish hands u to every subscriber. A subscriber that has not consumed the
+// previous update gets it replaced, so a slow client never stalls the loop.
+func (h *resultsPollers) publish(p *resultsPoller, u resultsUpdate) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if u.err == nil {
+		p.latest = &u
+	}
+	for sub := range p.subs {
+		select {
+		case sub.updates <- u:
+		default:
+			select {
+			case <-sub.updates:
+			default:
+			}
+			sub.updates <- u
+		}
+	}
+}
+
+// newestRowTimestamp is the latest aggregator timestamp among rows, or zero
+// if none parses. It bounds the next incremental poll.
+func newestRowTimestamp(rows []aggResult) time.Time {
+	var newest time.Time
+	for _, row := range rows {
+		if t, ok := parseTimeRFC3339(row.Timestamp); ok && t.After(newest) {
+			newest = t
+		}
+	}
+	return newest
+}
+
+// mergeResultsWindow combines freshly fetched rows with the previous window,
+// newest first as the aggregator orders them, dropping rows fetched twice
+// and keeping at most limit.
+func mergeResultsWindow(fresh, window []aggResult, limit int) []aggResult {
+	out := make([]aggResult, 0, len(fresh)+len(window))
+	ids := make(map[string]struct{}, len(fresh))
+	for _, row := range fresh {
+		if row.ID != "" {
+			ids[row.ID] = struct{}{}
+		}
+		out = append(out, row)
+	}
+	for _, row := range window {
+		if _, dup := ids[row.ID]; dup && row.ID != "" {
+			continue
+		}
+		out = append(out, row)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return getTimestamp(out[i], resultData(out[i])).After(getTimestamp(out[j], resultData(out[j])))
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type streamEvent struct {
+	ID   string
+	Rows []aggResult
+}
+
+// readResultsEvent reads the next "results" event from an SSE body.
+func readResultsEvent(t *testing.T, sc *bufio.Scanner) streamEvent {
+	t.Helper()
+	var ev streamEvent
+	var data string
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			ev.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "" && data != "":
+			var payload struct {
+				Rows []aggResult `json:"rows"`
+			}
+			if err := json.Unmarshal([]byte(data), &payload); err != nil {
+				t.Fatal(err)
+			}
+			ev.Rows = payload.Rows
+			return ev
+		}
+	}
+	t.Fatalf("stream ended: %v", sc.Err())
+	return ev
+}
+
+func openResultsStream(t *testing.T, ctx context.Context, url, lastID string) *bufio.Scanner {
+	t.Helper()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url+"?profile_id=p1&poll_ms=500", nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return bufio.NewScanner(resp.Body)
+}
+
+func rowIDs(rows []aggResult) string {
+	ids := make([]string, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestResultsStreamResumesFromLastEventID(t *testing.T) {
+	var mu sync.Mutex
+	// Aggregator order: newest first.
+	rows := []aggResult{
+		{ID: "b", ProfileID: "p1", Timestamp: "2026-01-01T00:00:02Z"},
+		{ID: "a", ProfileID: "p1", Timestamp: "2026-01-01T00:00:01Z"},
+	}
+	agg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		_ = json.NewEncoder(w).Encode(rows)
+	}))
+	defer agg.Close()
+
+	replay := newResultsReplay(100, 0)
+	srv := httptest.NewServer(newResultsStreamHandler(newResultsPollers(func() string { return agg.URL }), replay))
+	defer srv.Close()
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	first := readResultsEvent(t, openResultsStream(t, ctx1, srv.URL, ""))
+	cancel1()
+	if first.ID == "" || rowIDs(first.Rows) != "b,a" {
+		t.Fatalf("unexpected snapshot: id=%q rows=%s", first.ID, rowIDs(first.Rows))
+	}
+
+	// Resuming from the snapshot id skips the snapshot; polling delivers c only.
+	mu.Lock()
+	rows = append([]aggResult{{ID: "c", ProfileID: "p1", Timestamp: "2026-01-01T00:00:03Z"}}, rows...)
+	mu.Unlock()
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 5*time.Second)
+	second := readResultsEvent(t, openResultsStream(t, ctx2, srv.URL, first.ID))
+	cancel2()
+	if rowIDs(second.Rows) != "c" {
+		t.Fatalf("expected only row c after resume, got %s", rowIDs(second.Rows))
+	}
+
+	// A client that missed c replays it from the buffer straight away.
+	ctx3, cancel3 := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel3()
+	sc := openResultsStream(t, ctx3, srv.URL, first.ID)
+	replayed := readResultsEvent(t, sc)
+	if rowIDs(replayed.Rows) != "c" || replayed.ID != second.ID {
+		t.Fatalf("expected buffered row c with id %s, got id=%s rows=%s", second.ID, replayed.ID, rowIDs(replayed.Rows))
+	}
+	mu.Lock()
+	rows = append([]aggResult{{ID: "d", ProfileID: "p1", Timestamp: "2026-01-01T00:00:04Z"}}, rows...)
+	mu.Unlock()
+	next := readResultsEvent(t, sc)
+	if rowIDs(next.Rows) != "d" || parseLastEventID(next.ID) <= parseLastEventID(replayed.ID) {
+		t.Fatalf("expected row d with a newer id, got id=%s rows=%s", next.ID, rowIDs(next.Rows))
+	}
+}
+
+func TestResultsReplayFallsBackToSnapshot(t *testing.T) {
+	rp := newResultsReplay(2, 0)
+	if _, _, _, ok := rp.since("p1", 1); ok {
+		t.Fatal("unknown stream must not resume")
+	}
+	first := rp.record("p1", []aggResult{{ID: "a", Timestamp: "2026-01-01T00:00:01Z"}})
+	rp.record("p1", []aggResult{{ID: "b", Timestamp: "2026-01-01T00:00:02Z"}, {ID: "c", Timestamp: "2026-01-01T00:00:03Z"}})
+	if _, _, _, ok := rp.since("p1", first-1); ok {
+		t.Fatal("ids older than the buffer must not resume")
+	}
+	if _, _, _, ok := rp.since("p1", 99); ok {
+		t.Fatal("ids from another process must not resume")
+	}
+	newer, _, _, ok := rp.since("p1", first)
+	if !ok || rowIDs(newer) != "b,c" {
+		t.Fatalf("expected b,c after %d, got %s ok=%v", first, rowIDs(newer), ok)
+	}
+}
+
+func TestResultsReplayBoundsKeys(t *testing.T) {
+	rp := newResultsReplay(10, 2)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	rp.now = func() time.Time { return now }
+	row := []aggResult{{ID: "a", Timestamp: "2026-01-01T00:00:01Z"}}
+
+	a := rp.record("a", row)
+	now = now.Add(time.Second)
+	rp.record("b", row)
+	now = now.Add(time.Second)
+	if _, _, _, ok := rp.since("a", a); !ok {
+		t.Fatal("a should still resume")
+	}
+	// A third key evicts the least recently used, b.
+	rp.record("c", row)
+	if _, _, _, ok := rp.since("b", a); ok || len(rp.streams) != 2 {
+		t.Fatalf("b should be evicted, %d keys kept", len(rp.streams))
+	}
+
+	// Logs idle past the TTL go when a new key arrives.
+	now = now.Add(resultsReplayIdleTTL + time.Second)
+	rp.record("d", row)
+	if len(rp.streams) != 1 {
+		t.Fatalf("idle logs kept: %d keys", len(rp.streams))
+	}
+}
+
+func TestResultsStreamSharesOnePoller(t *testing.T) {
+	var mu sync.Mutex
+	hits := 0
+	rows := []aggResult{{ID: "a", ProfileID: "p1", Timestamp: "2026-01-01T00:00:01Z"}}
+	agg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		hits++
+		_ = json.NewEncoder(w).Encode(rows)
+	}))
+	defer agg.Close()
+
+	pollers := newResultsPollers(func() string { return agg.URL })
+	pollers.maxPoll = time.Hour
+	srv := httptest.NewServer(newResultsStreamHandler(pollers, newResultsReplay(100, 0)))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	const clients = 5
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?profile_id=p1&poll_ms=3600000", nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+			if ev := readResultsEvent(t, bufio.NewScanner(resp.Body)); rowIDs(ev.Rows) != "a" {
+				t.Errorf("unexpected snapshot %s", rowIDs(ev.Rows))
+			}
+			<-ctx.Done()
+		}()
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		pollers.mu.Lock()
+		n, loops := pollers.clients, len(pollers.pollers)
+		pollers.mu.Unlock()
+		if n == clients {
+			if loops != 1 {
+				t.Fatalf("expected one shared poller, got %d", loops)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d clients connected", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if m := metricsSnapshot(); m.ResultsClients != clients || m.ResultsPollers != 1 {
+		t.Fatalf("metrics: clients=%d pollers=%d", m.ResultsClients, m.ResultsPollers)
+	}
+	mu.Lock()
+	if hits != 1 {
+		t.Fatalf("expected a single upstream fetch for %d clients, got %d", clients, hits)
+	}
+	mu.Unlock()
+
+	cancel()
+	wg.Wait()
+	deadline = time.Now().Add(2 * time.Second)
+	for {
+		pollers.mu.Lock()
+		loops := len(pollers.pollers)
+		pollers.mu.Unlock()
+		if loops == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("poller kept running after the last client left")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestResultsPollerBacksOffWhenIdle(t *testing.T) {
+	var mu sync.Mutex
+	var at []time.Time
+	agg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		at = append(at, time.Now())
+		mu.Unlock()
+		_ = json.NewEncoder(w).Encode([]aggResult{{ID: "a", Timestamp: "2026-01-01T00:00:01Z"}})
+	}))
+	defer agg.Close()
+
+	pollers := newResultsPollers(func() string { return agg.URL })
+	pollers.minPoll = 10 * time.Millisecond
+	sub, unsubscribe := pollers.subscribe("p1", 10, time.Time{}, pollers.clampInterval(20))
+	defer unsubscribe()
+
+	for i := 0; i < 6; i++ {
+		select {
+		case <-sub.updates:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no update %d", i)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if gap := at[len(at)-1].Sub(at[len(at)-2]); gap < 60*time.Millisecond {
+		t.Fatalf("idle poller should slow down towards 80ms, last gap %s", gap)
+	}
+}
+
+// TestResultsPollerFetchesIncrementally checks that the shared poll loop asks
+// the aggregator only for rows from its newest one onwards while still
+// publishing the full window of limit rows.
+func TestResultsPollerFetchesIncrementally(t *testing.T) {
+	var mu sync.Mutex
+	var sinces []string
+	rows := []aggResult{
+		{ID: "b", ProfileID: "p1", Timestamp: "2026-01-01T00:00:02Z"},
+		{ID: "a", ProfileID: "p1", Timestamp: "2026-01-01T00:00:01Z"},
+	}
+	agg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		since := r.URL.Query().Get("since")
+		sinces = append(sinces, since)
+		out := []aggResult{}
+		for _, row := range rows {
+			if since == "" || row.Timestamp >= since {
+				out = append(out, row)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+	defer agg.Close()
+
+	pollers := newResultsPollers(func() string { return agg.URL })
+	pollers.minPoll = 10 * time.Millisecond
+	sub, unsubscribe := pollers.subscribe("p1", 3, time.Time{}, pollers.clampInterval(10))
+	defer unsubscribe()
+	next := func() string {
+		t.Helper()
+		select {
+		case u := <-sub.updates:
+			if u.err != nil {
+				t.Fatal(u.err)
+			}
+			return rowIDs(u.rows)
+		case <-time.After(2 * time.Second):
+			t.Fatal("no update")
+			return ""
+		}
+	}
+
+	if got := next(); got != "b,a" {
+		t.Fatalf("first poll: %s", got)
+	}
+	if got := next(); got != "b,a" {
+		t.Fatalf("unchanged poll must keep the window: %s", got)
+	}
+	mu.Lock()
+	rows = append([]aggResult{
+		{ID: "d", ProfileID: "p1", Timestamp: "2026-01-01T00:00:04Z"},
+		{ID: "c", ProfileID: "p1", Timestamp: "2026-01-01T00:00:03Z"},
+	}, rows...)
+	mu.Unlock()
+	deadline := time.Now().Add(2 * time.Second)
+	for got := next(); got != "d,c,b"; got = next() {
+		if time.Now().After(deadline) {
+			t.Fatalf("window after new rows: %s", got)
+		}
+	}
+	if got := next(); got != "d,c,b" {
+		t.Fatalf("window after an incremental poll: %s", got)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if sinces[0] != "" || sinces[1] != "2026-01-01T00:00:02Z" || sinces[len(sinces)-1] != "2026-01-01T00:00:04Z" {
+		t.Fatalf("since sent to the aggregator: %q", sinces)
+	}
+}
+
+// TestResultsStreamForwardsExplicitSince covers a since older than the
+// aggregator's default 24h window: the stream must ask for it explicitly.
+func TestResultsStreamForwardsExplicitSince(t *testing.T) {
+	now := time.Now().UTC()
+	rows := []aggResult{
+		{ID: "new", ProfileID: "p1", Timestamp: now.Add(-time.Hour).Format(time.RFC3339)},
+		{ID: "old", ProfileID: "p1", Timestamp: now.Add(-48 * time.Hour).Format(time.RFC3339)},
+	}
+	agg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		from := now.Add(-24 * time.Hour)
+		if raw := r.URL.Query().Get("since"); raw != "" {
+			from, _ = time.Parse(time.RFC3339Nano, raw)
+		}
+		out := []aggResult{}
+		for _, row := range rows {
+			if ts, _ := time.Parse(time.RFC3339, row.Timestamp); !ts.Before(from) {
+				out = append(out, row)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+	defer agg.Close()
+
+	srv := httptest.NewServer(newResultsStreamHandler(newResultsPollers(func() string { return agg.URL }), newResultsReplay(100, 0)))
+	defer srv.Close()
+	snapshot := func(query string) string {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?profile_id=p1"+query, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		return rowIDs(readResultsEvent(t, bufio.NewScanner(resp.Body)).Rows)
+	}
+
+	if got := snapshot(""); got != "new" {
+		t.Fatalf("default window: %s", got)
+	}
+	since := now.Add(-72 * time.Hour).Format(time.RFC3339)
+	if got := snapshot("&since=" + url.QueryEscape(since)); got != "new,old" {
+		t.Fatalf("explicit since older than the default window: %s", got)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- JWT revocation ---
+
+// jtiRevocationCache holds revoked token ids until the token would have
+// expired anyway, so validateJWT can reject them without asking the auth
+// service. Entries are keyed by sub+jti; an entry without a subject revokes
+// the id for every subject.
+type jtiRevocationCache struct {
+	mu      sync.RWMutex
+	entries map[string]time.Time // key -> token expiry
+	now     func() time.Time
+}
+
+func newJTIRevocationCache() *jtiRevocationCache {
+	return &jtiRevocationCache{entries: make(map[string]time.Time), now: time.Now}
+}
+
+func revocationKey(sub, jti string) string {
+	return sub + "|" + jti
+}
+
+func (c *jtiRevocationCache) revoke(sub, jti string, exp time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := revocationKey(sub, jti)
+	if cur, ok := c.entries[key]; !ok || exp.After(cur) {
+		c.entries[key] = exp
+	}
+}
+
+func (c *jtiRevocationCache) revoked(sub, jti string) bool {
+	if jti == "" {
+		return false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.now()
+	for _, key := range []string{revocationKey(sub, jti), revocationKey("", jti)} {
+		if exp, ok := c.entries[key]; ok && now.Before(exp) {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanup drops entries whose token has expired and returns how many.
+func (c *jtiRevocationCache) cleanup() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	n := 0
+	for key, exp := range c.entries {
+		if !now.Before(exp) {
+			delete(c.entries, key)
+			n++
+		}
+	}
+	return n
+}
+
+func (c *jtiRevocationCache) len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
+
+func (c *jtiRevocationCache) runCleanup(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if n := c.cleanup(); n > 0 {
+				slog.Info("jti_revocations_expired", "removed", n, "remaining", c.len())
+			}
+		}
+	}
+}
+
+// tokenID reads jti, falling back to token_id as issued by the auth service.
+func tokenID(claims map[string]any) string {
+	if jti, _ := claims["jti"].(string); jti != "" {
+		return jti
+	}
+	id, _ := claims["token_id"].(string)
+	return id
+}
+
+type revokeRequest struct {
+	JTI string          `json:"jti"`
+	Sub string          `json:"sub"`
+	Exp json.RawMessage `json:"exp"`
+}
+
+// parseRevocationExp accepts RFC3339 or unix seconds, as a string or number.
+func parseRevocationExp(raw json.RawMessage) (time.Time, bool) {
+	var v any
+	if len(raw) == 0 || json.Unmarshal(raw, &v) != nil {
+		return time.Time{}, false
+	}
+	switch x := v.(type) {
+	case float64:
+		return time.Unix(int64(x), 0).UTC(), x > 0
+	case string:
+		x = strings.TrimSpace(x)
+		if t, err := time.Parse(time.RFC3339, x); err == nil {
+			return t.UTC(), true
+		}
+		if n, err := strconv.ParseInt(x, 10, 64); err == nil && n > 0 {
+			return time.Unix(n, 0).UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// newRevokeHandler serves POST /api/gateway/auth/revoke. It always requires
+// a configured API key holding scopeAuthAdmin, whether or not gateway auth is
+// otherwise enabled.
+func newRevokeHandler(cfg *authConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		key := strings.TrimSpace(r.Header.Get("X-API-Key"))
+		if key == "" || !apiKeyValid(cfg, key) {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{"error": "unauthorized"})
+			return
+		}
+		if scopes := apiKeyScopes(cfg, key); !slices.Contains(scopes, scopeAuthAdmin) {
+			writeInsufficientScope(w, scopeAuthAdmin, scopes)
+			return
+		}
+		var in revokeRequest
+		if !decodeJSONBody(w, r, &in) {
+			return
+		}
+		in.JTI = strings.TrimSpace(in.JTI)
+		in.Sub = strings.TrimSpace(in.Sub)
+		if in.JTI == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "missing_jti"})
+			return
+		}
+		exp, ok := parseRevocationExp(in.Exp)
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_exp"})
+			return
+		}
+		if !exp.After(cfg.Revoked.now()) {
+			// The token can no longer be used; nothing to remember.
+			writeJSON(w, http.StatusOK, map[string]any{"ok": true, "jti": in.JTI, "stored": false})
+			return
+		}
+		cfg.Revoked.revoke(in.Sub, in.JTI, exp)
+		slog.Info("jti_revoked", "jti", in.JTI, "sub", in.Sub, "exp", exp.Format(time.RFC3339), "by", principalFromContext(r.Context()))
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "jti": in.JTI, "stored": true, "expires_at": exp.Format(time.RFC3339)})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signHS256(t *testing.T, secret string, claims map[string]any) string {
+	t.Helper()
+	hdr, _ := json.Marshal(map[string]any{"alg": "HS256", "typ": "JWT"})
+	body, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signing := base64.RawURLEncoding.EncodeToString(hdr) + "." + base64.RawURLEncoding.EncodeToString(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signing))
+	return signing + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidateJWTRejectsRevokedJTI(t *testing.T) {
+	cfg := &authConfig{HS256Secret: "s3cret", Revoked: newJTIRevocationCache()}
+	exp := time.Now().Add(time.Hour)
+	tok := signHS256(t, cfg.HS256Secret, map[string]any{"sub": "alice", "jti": "t1", "exp": exp.Unix()})
+	other := signHS256(t, cfg.HS256Secret, map[string]any{"sub": "bob", "jti": "t1", "exp": exp.Unix()})
+
+	if _, err := validateJWT(cfg, tok); err != nil {
+		t.Fatalf("expected valid token, got %v", err)
+	}
+	cfg.Revoked.revoke("alice", "t1", exp)
+	if _, err := validateJWT(cfg, tok); err == nil || err.Error() != "token_revoked" {
+		t.Fatalf("expected token_revoked, got %v", err)
+	}
+	if _, err := validateJWT(cfg, other); err != nil {
+		t.Fatalf("revocation is per subject, got %v", err)
+	}
+
+	// Without a subject the id is revoked for everyone; token_id counts as jti.
+	cfg.Revoked.revoke("", "t2", exp)
+	authTok := signHS256(t, cfg.HS256Secret, map[string]any{"sub": "bob", "token_id": "t2", "exp": exp.Unix()})
+	if _, err := validateJWT(cfg, authTok); err == nil || err.Error() != "token_revoked" {
+		t.Fatalf("expected token_revoked for token_id, got %v", err)
+	}
+}
+
+func TestJTIRevocationCacheCleanup(t *testing.T) {
+	c := newJTIRevocationCache()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	c.revoke("a", "old", now.Add(time.Minute))
+	c.revoke("a", "new", now.Add(time.Hour))
+
+	now = now.Add(2 * time.Minute)
+	if c.revoked("a", "old") {
+		t.Fatal("expired entry should no longer count as revoked")
+	}
+	if n := c.cleanup(); n != 1 || c.len() != 1 || !c.revoked("a", "new") {
+		t.Fatalf("cleanup removed %d, %d left", n, c.len())
+	}
+}
+
+func TestRevokeHandler(t *testing.T) {
+	cfg := &authConfig{
+		APIKeys: map[string]struct{}{sha256Hex([]byte("k1")): {}, sha256Hex([]byte("k2")): {}},
+		APIKeyScopes: map[string][]string{
+			sha256Hex([]byte("k1")): {"auth:admin"},
+			sha256Hex([]byte("k2")): {"profiles:write"},
+		},
+		Revoked: newJTIRevocationCache(),
+	}
+	h := newRevokeHandler(cfg)
+	post := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/gateway/auth/revoke", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	exp := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	cases := []struct {
+		name, key, body string
+		code            int
+		errCode         string
+	}{
+		{"no key", "", `{"jti":"t1","exp":"` + exp + `"}`, http.StatusUnauthorized, "unauthorized"},
+		{"bad key", "nope", `{"jti":"t1","exp":"` + exp + `"}`, http.StatusUnauthorized, "unauthorized"},
+		{"no admin scope", "k2", `{"jti":"t1","exp":"` + exp + `"}`, http.StatusForbidden, "insufficient_scope"},
+		{"bad json", "k1", `{`, http.StatusBadRequest, "invalid_json"},
+		{"missing jti", "k1", `{"exp":"` + exp + `"}`, http.StatusBadRequest, "missing_jti"},
+		{"bad exp", "k1", `{"jti":"t1","exp":"tomorrow"}`, http.StatusBadRequest, "invalid_exp"},
+		{"ok", "k1", `{"jti":"t1","sub":"alice","exp":"` + exp + `"}`, http.StatusOK, ""},
+		{"ok unix", "k1", `{"jti":"t2","exp":` + strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10) + `}`, http.StatusOK, ""},
+	}
+	for _, tc := range cases {
+		rec := post(tc.key, tc.body)
+		var out map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &out)
+		if rec.Code != tc.code || (tc.errCode != "" && out["error"] != tc.errCode) {
+			t.Fatalf("%s: got %d %s", tc.name, rec.Code, rec.Body.String())
+		}
+	}
+	if !cfg.Revoked.revoked("alice", "t1") || !cfg.Revoked.revoked("anyone", "t2") {
+		t.Fatal("expected both ids to be revoked")
+	}
+
+	if rec := post("k1", `{"jti":"t3","exp":"2000-01-01T00:00:00Z"}`); rec.Code != http.StatusOK || cfg.Revoked.len() != 2 {
+		t.Fatalf("already-expired token should be accepted but not stored: %d len=%d", rec.Code, cfg.Revoked.len())
+	}
+
+	// Unmapped keys hold every scope but auth:admin.
+	cfg.APIKeyScopes = nil
+	if rec := post("k1", `{"jti":"t4","exp":"`+exp+`"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("unscoped key: expected 403, got %d %s", rec.Code, rec.Body.String())
+	}
+}
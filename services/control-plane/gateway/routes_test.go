@@ -0,0 +1,188 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestGatewayMux(t *testing.T) (*http.ServeMux, *reportStore, string, *atomic.Int32) {
+	t.Helper()
+	d, connectorID, upstreamHits := newTestGatewayRoutes(t)
+	return newGatewayMux(d), d.reports, connectorID, upstreamHits
+}
+
+// newTestGatewayRoutes is the dependency set behind newTestGatewayMux, for
+// tests that need to hold on to one of the stores.
+func newTestGatewayRoutes(t *testing.T) (gatewayRoutes, string, *atomic.Int32) {
+	t.Helper()
+	var upstreamHits atomic.Int32
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHits.Add(1)
+		w.Header().Set("X-Upstream", "stub")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	t.Cleanup(stub.Close)
+
+	cat, err := parseConnectorCatalog(connectorCatalogYAML)
+	if err != nil {
+		t.Fatalf("embedded catalog: %v", err)
+	}
+	live := newLiveCatalog("", cat, time.Time{})
+	_, list := live.snapshot()
+	if len(list) == 0 {
+		t.Fatal("embedded catalog is empty")
+	}
+	reports := newReportStore()
+	proxies := newProxyRegistry()
+	for _, name := range []string{"registry", "aggregator", "coordinator", "reporter", "analytics"} {
+		proxies.register(name, stub.URL, defaultUpstreamTimeout)
+	}
+	d := gatewayRoutes{
+		healthChecks:    newLiveHealthTargets(healthTargets{}),
+		health:          newHealthCache(),
+		sse:             newSSEHub(16),
+		summary:         &summaryCache{},
+		crypto:          &cryptoCache{},
+		klines:          newKlinesCache(),
+		symbols:         newSymbolsCache(0),
+		audit:           newAuditStore(100),
+		reports:         reports,
+		catalog:         live,
+		connectors:      newConnectorConfigStore(),
+		cryptoStreamURL: stub.URL,
+		proxies:         proxies,
+	}
+	return d, list[0].ID, &upstreamHits
+}
+
+func TestLocalRoutesRejectUnsupportedMethods(t *testing.T) {
+	mux, reports, connectorID, upstreamHits := newTestGatewayMux(t)
+	customID := reports.add(reportSpec{})
+
+	cases := []struct {
+		path      string
+		method    string
+		wantAllow string
+	}{
+		{"/health", http.MethodPost, "GET, OPTIONS"},
+		{"/api/health", http.MethodPut, "GET, OPTIONS"},
+		{"/api/gateway/health", http.MethodDelete, "GET, OPTIONS"},
+		{"/metrics", http.MethodPost, "GET, OPTIONS"},
+		{"/api/status", http.MethodPost, "GET, OPTIONS"},
+		{"/api/events", http.MethodPost, "GET, OPTIONS"},
+		{"/api/ws", http.MethodPost, "GET, OPTIONS"},
+		{"/api/results/stream", http.MethodPost, "GET, OPTIONS"},
+		{"/api/live/stream", http.MethodPost, "GET, OPTIONS"},
+		{"/api/summary", http.MethodPost, "GET, OPTIONS"},
+		{"/api/audit/health", http.MethodPost, "GET, OPTIONS"},
+		{"/api/audit/v0/events", http.MethodDelete, "GET, OPTIONS"},
+		{"/api/gateway/webhooks/dlq", http.MethodPost, "GET, OPTIONS"},
+		{"/api/reports", http.MethodPut, "GET, POST, OPTIONS"},
+		{"/api/reports", http.MethodDelete, "GET, POST, OPTIONS"},
+		{"/api/reports/live-crypto-wall", http.MethodPut, "GET, OPTIONS"},
+		{"/api/reports/crypto-index", http.MethodPost, "GET, OPTIONS"},
+		{"/api/reports/" + customID, http.MethodPut, "GET, DELETE, OPTIONS"},
+		{"/api/reports/unknown-report", http.MethodPatch, "GET, OPTIONS"},
+		{"/api/crypto/symbols", http.MethodPost, "GET, OPTIONS"},
+		{"/api/crypto/top", http.MethodPost, "GET, OPTIONS"},
+		{"/api/crypto/health", http.MethodPost, "GET, OPTIONS"},
+		{"/api/crypto/stream", http.MethodPost, "GET, OPTIONS"},
+		{"/api/gateway/connectors/catalog", http.MethodPost, "GET, OPTIONS"},
+		{"/api/catalog", http.MethodPost, "GET, OPTIONS"},
+		{"/api/gateway/connectors/health", http.MethodPost, "GET, OPTIONS"},
+		{"/api/connectors/health", http.MethodPost, "GET, OPTIONS"},
+		{"/api/gateway/connectors/" + connectorID + "/health", http.MethodPost, "GET, OPTIONS"},
+		{"/api/connectors/" + connectorID + "/health", http.MethodDelete, "GET, OPTIONS"},
+		{"/api/gateway/connectors/" + connectorID + "/schema", http.MethodPost, "GET, OPTIONS"},
+		{"/api/connectors/" + connectorID + "/schema", http.MethodPut, "GET, OPTIONS"},
+		{"/api/gateway/connectors/" + connectorID + "/config", http.MethodDelete, "GET, POST, PUT, OPTIONS"},
+		{"/api/connectors/" + connectorID + "/config", http.MethodPatch, "GET, POST, PUT, OPTIONS"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, strings.NewReader("{}")))
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("status %d, want 405 (body %s)", rec.Code, rec.Body.String())
+			}
+			if got := rec.Header().Get("Allow"); got != tc.wantAllow {
+				t.Fatalf("Allow %q, want %q", got, tc.wantAllow)
+			}
+			if !strings.Contains(rec.Body.String(), "method_not_allowed") {
+				t.Fatalf("body %s", rec.Body.String())
+			}
+		})
+	}
+	if n := upstreamHits.Load(); n != 0 {
+		t.Fatalf("%d unsupported-method requests reached an upstream", n)
+	}
+}
+
+func TestReportRoutesFallThroughToReporter(t *testing.T) {
+	mux, _, _, upstreamHits := newTestGatewayMux(t)
+
+	for _, path := range []string{"/api/reports/unknown-report", "/api/reports/unknown-report/export"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusTeapot || rec.Header().Get("X-Upstream") != "stub" {
+			t.Fatalf("GET %s: status %d, want the reporter's answer", path, rec.Code)
+		}
+	}
+	if n := upstreamHits.Load(); n != 2 {
+		t.Fatalf("upstream hits %d, want 2", n)
+	}
+}
+
+func TestDeleteReport(t *testing.T) {
+	mux, reports, _, upstreamHits := newTestGatewayMux(t)
+	keep := reports.add(reportSpec{})
+	customID := reports.add(reportSpec{Mode: "timeseries"})
+
+	del := func(id string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/reports/"+id, nil))
+		return rec
+	}
+	if rec := del(customID); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"deleted"`) {
+		t.Fatalf("DELETE custom report: %d %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := reports.get(customID); ok {
+		t.Fatal("report still in the store")
+	}
+	if ids := reports.ids(); len(ids) != 1 || ids[0] != keep {
+		t.Fatalf("order after delete: %v", ids)
+	}
+
+	for _, id := range []string{customID, "live-crypto-wall", "crypto-index", "unknown-report"} {
+		if rec := del(id); rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "report_not_found") {
+			t.Fatalf("DELETE %s: %d %s, want 404", id, rec.Code, rec.Body.String())
+		}
+	}
+	if n := upstreamHits.Load(); n != 0 {
+		t.Fatalf("DELETE reached the reporter (hits %d)", n)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/reports/live-crypto-wall", nil))
+	if rec.Code == http.StatusNotFound || rec.Code == http.StatusMethodNotAllowed {
+		t.Fatalf("GET built-in report after DELETE attempts: %d", rec.Code)
+	}
+}
+
+func TestLocalRoutesAnswerOptions(t *testing.T) {
+	mux, _, connectorID, upstreamHits := newTestGatewayMux(t)
+	for _, path := range []string{"/api/health", "/api/reports", "/api/reports/anything", "/api/gateway/connectors/" + connectorID + "/config"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, path, nil))
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("OPTIONS %s: status %d, want 204", path, rec.Code)
+		}
+	}
+	if n := upstreamHits.Load(); n != 0 {
+		t.Fatalf("OPTIONS reached an upstream (hits %d)", n)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// --- Scopes ---
+
+const ctxScopes ctxKey = "scopes"
+
+// scopeAll is held by API keys when AUTH_API_KEY_SCOPES is unset, so
+// deployments that predate scopes keep working.
+const scopeAll = "*"
+
+// scopeAuthAdmin lets an API key revoke tokens. It must be granted by name:
+// the scopeAll that unmapped keys hold does not include it.
+const scopeAuthAdmin = "auth:admin"
+
+// requiredScope names the scope a request needs, or "" when the route only
+// needs a principal (or none). Reads are never scoped.
+func requiredScope(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ""
+	}
+	path := r.URL.Path
+	switch {
+	case path == "/api/profiles" || path == "/api/profiles:batch" || path == "/api/profiles:reload" || strings.HasPrefix(path, "/api/profiles/"):
+		return "profiles:write"
+	case path == "/api/reports" || strings.HasPrefix(path, "/api/reports/"):
+		return "reports:write"
+	case strings.HasPrefix(path, "/api/gateway/connectors/") || strings.HasPrefix(path, "/api/connectors/"):
+		// .../config, and its :apply and :discard actions.
+		last := strings.TrimRight(path, "/")
+		if name, _, _ := strings.Cut(last[strings.LastIndex(last, "/")+1:], ":"); name == "config" {
+			return "connectors:write"
+		}
+	}
+	return ""
+}
+
+// scopesFromClaims reads the space-delimited OAuth "scope" claim, falling
+// back to "scp" and then "roles" (each a string or a list of strings).
+func scopesFromClaims(claims map[string]any) []string {
+	for _, name := range []string{"scope", "scp", "roles"} {
+		switch v := claims[name].(type) {
+		case string:
+			if out := strings.Fields(v); len(out) > 0 {
+				return out
+			}
+		case []any:
+			out := make([]string, 0, len(v))
+			for _, e := range v {
+				if s, ok := e.(string); ok && strings.TrimSpace(s) != "" {
+					out = append(out, strings.TrimSpace(s))
+				}
+			}
+			if len(out) > 0 {
+				return out
+			}
+		}
+	}
+	return nil
+}
+
+// parseAPIKeyScopes reads AUTH_API_KEY_SCOPES:
+// "<sha256 of key>=profiles:write reports:write,<sha256>=connectors:write".
+func parseAPIKeyScopes(v string) map[string][]string {
+	out := make(map[string][]string)
+	for _, entry := range splitCSV(v) {
+		hash, list, ok := strings.Cut(entry, "=")
+		hash = strings.ToLower(strings.TrimSpace(hash))
+		if !ok || hash == "" {
+			slog.Warn("api_key_scopes_invalid", "entry", entry)
+			continue
+		}
+		out[hash] = append(out[hash], strings.Fields(list)...)
+	}
+	return out
+}
+
+// apiKeyScopes returns the scopes of a valid key. Scopes given in the key
+// file win. Otherwise, without a mapping every key holds every scope; with
+// one, unlisted keys hold none.
+func apiKeyScopes(cfg *authConfig, key string) []string {
+	hash := sha256Hex([]byte(key))
+	if cfg.APIKeysFile != "" {
+		if scopes, ok := getAPIKeyFileScopes(cfg.APIKeysFile, cfg.APIKeysTTL)[hash]; ok {
+			return scopes
+		}
+	}
+	if len(cfg.APIKeyScopes) == 0 {
+		return []string{scopeAll}
+	}
+	return cfg.APIKeyScopes[hash]
+}
+
+func hasScope(scopes []string, want string) bool {
+	for _, s := range scopes {
+		if s == want || s == scopeAll {
+			return true
+		}
+	}
+	return false
+}
+
+func scopesFromContext(ctx context.Context) []string {
+	v, _ := ctx.Value(ctxScopes).([]string)
+	return v
+}
+
+// writeInsufficientScope answers 403 naming the scope the caller lacks, in
+// the body and in the RFC 6750 WWW-Authenticate form.
+func writeInsufficientScope(w http.ResponseWriter, scope string, have []string) {
+	have = append([]string{}, have...)
+	sort.Strings(have)
+	w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+	writeJSON(w, http.StatusForbidden, map[string]any{
+		"error":          "insufficient_scope",
+		"required_scope": scope,
+		"scopes":         have,
+	})
+}
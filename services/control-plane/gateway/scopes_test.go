@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithAuthScopes(t *testing.T) {
+	cfg := &authConfig{
+		Enabled:        true,
+		HS256Secret:    "s3cret",
+		APIKeys:        parseKeySet("writer-key,reader-key"),
+		APIKeyScopes:   parseAPIKeyScopes(sha256Hex([]byte("writer-key")) + "=profiles:write connectors:write"),
+		AllowAnonymous: parseAnonymousPaths([]string{"/api/reports", "/api/profiles/*", "/api/connectors/*"}),
+		TenantHeader:   "X-Tenant-ID",
+	}
+	var gotScopes []string
+	h := withAuth(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotScopes = scopesFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+	token := func(claims map[string]any) string {
+		claims["sub"] = "alice"
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		return "Bearer " + signHS256(t, cfg.HS256Secret, claims)
+	}
+
+	cases := []struct {
+		name, method, path string
+		header, value      string
+		wantCode           int
+		wantScope          string
+	}{
+		{"anonymous read of an open path", http.MethodGet, "/api/reports", "", "", http.StatusOK, ""},
+		{"anonymous read under an open prefix", http.MethodGet, "/api/connectors/x/config", "", "", http.StatusOK, ""},
+		{"anonymous write to an open path", http.MethodPost, "/api/reports", "", "", http.StatusUnauthorized, ""},
+		{"anonymous write under an open prefix", http.MethodPut, "/api/profiles/p1", "", "", http.StatusUnauthorized, ""},
+		{"scope claim allows", http.MethodPost, "/api/profiles", "Authorization", token(map[string]any{"scope": "profiles:write reports:write"}), http.StatusOK, ""},
+		{"scope claim denies", http.MethodPost, "/api/reports", "Authorization", token(map[string]any{"scope": "profiles:write"}), http.StatusForbidden, "reports:write"},
+		{"batch profile writes need the profiles scope", http.MethodPost, "/api/profiles:batch", "Authorization", token(map[string]any{"scope": "reports:write"}), http.StatusForbidden, "profiles:write"},
+		{"profile reloads need the profiles scope", http.MethodPost, "/api/profiles:reload", "Authorization", token(map[string]any{"scope": "reports:write"}), http.StatusForbidden, "profiles:write"},
+		{"roles list allows", http.MethodDelete, "/api/reports/r1", "Authorization", token(map[string]any{"roles": []any{"reports:write"}}), http.StatusOK, ""},
+		{"no scopes denies writes", http.MethodPost, "/api/gateway/connectors/x/config", "Authorization", token(map[string]any{}), http.StatusForbidden, "connectors:write"},
+		{"config actions need the connectors scope", http.MethodPost, "/api/connectors/x/config:apply", "Authorization", token(map[string]any{"scope": "profiles:write"}), http.StatusForbidden, "connectors:write"},
+		{"no scopes still reads", http.MethodGet, "/api/drones", "Authorization", token(map[string]any{}), http.StatusOK, ""},
+		{"unscoped write route", http.MethodPost, "/api/drones/register", "Authorization", token(map[string]any{}), http.StatusOK, ""},
+		{"mapped api key allows", http.MethodPut, "/api/connectors/x/config", "X-API-Key", "writer-key", http.StatusOK, ""},
+		{"mapped api key denies", http.MethodPost, "/api/reports", "X-API-Key", "writer-key", http.StatusForbidden, "reports:write"},
+		{"unmapped api key denies", http.MethodDelete, "/api/profiles/p1", "X-API-Key", "reader-key", http.StatusForbidden, "profiles:write"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader("{}"))
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tc.wantCode {
+				t.Fatalf("status %d, want %d (%s)", rec.Code, tc.wantCode, rec.Body.String())
+			}
+			if tc.wantScope == "" {
+				return
+			}
+			var out map[string]any
+			_ = json.Unmarshal(rec.Body.Bytes(), &out)
+			if out["error"] != "insufficient_scope" || out["required_scope"] != tc.wantScope {
+				t.Fatalf("body %v, want required_scope %s", out, tc.wantScope)
+			}
+			if !strings.Contains(rec.Header().Get("WWW-Authenticate"), `scope="`+tc.wantScope+`"`) {
+				t.Fatalf("WWW-Authenticate %q", rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/profiles", nil)
+	req.Header.Set("Authorization", token(map[string]any{"scope": "profiles:write"}))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if len(gotScopes) != 1 || gotScopes[0] != "profiles:write" {
+		t.Fatalf("scopes in context: %v", gotScopes)
+	}
+}
+
+func TestAPIKeysWithoutScopeMappingKeepFullAccess(t *testing.T) {
+	cfg := &authConfig{Enabled: true, APIKeys: parseKeySet("legacy"), TenantHeader: "X-Tenant-ID"}
+	h := withAuth(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	req := httptest.NewRequest(http.MethodPost, "/api/profiles", nil)
+	req.Header.Set("X-API-Key", "legacy")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+}
+
+func TestParseAPIKeyScopes(t *testing.T) {
+	got := parseAPIKeyScopes(" ABC=profiles:write  reports:write , def=connectors:write, broken")
+	if strings.Join(got["abc"], " ") != "profiles:write reports:write" || strings.Join(got["def"], " ") != "connectors:write" || len(got) != 2 {
+		t.Fatalf("unexpected mapping: %v", got)
+	}
+}
+
+func TestAPIKeyFileScopes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api_keys")
+	data := strings.Join([]string{
+		"# bare keys keep every scope",
+		"legacy-key",
+		sha256Hex([]byte("writer-key")) + ":profiles:write,reports:write",
+		strings.ToUpper(sha256Hex([]byte("reader-key"))) + ":",
+		"not-a-hash:looks-scoped",
+	}, "\n")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &authConfig{Enabled: true, APIKeysFile: path, TenantHeader: "X-Tenant-ID", AllowAnonymous: parseAnonymousPaths(nil)}
+	h := withAuth(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+
+	cases := []struct {
+		key, method, path string
+		want              int
+	}{
+		{"legacy-key", http.MethodPost, "/api/gateway/connectors/x/config", http.StatusOK},
+		{"writer-key", http.MethodPost, "/api/reports", http.StatusOK},
+		{"writer-key", http.MethodPut, "/api/profiles/p1", http.StatusOK},
+		{"writer-key", http.MethodPost, "/api/connectors/x/config", http.StatusForbidden},
+		{"reader-key", http.MethodGet, "/api/results", http.StatusOK},
+		{"reader-key", http.MethodPost, "/api/reports", http.StatusForbidden},
+		{"reader-key", http.MethodPost, "/api/profiles", http.StatusForbidden},
+		{"not-a-hash:looks-scoped", http.MethodPost, "/api/profiles", http.StatusOK},
+		{"unknown-key", http.MethodGet, "/api/results", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("X-API-Key", tc.key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s %s %s: status %d, want %d", tc.key, tc.method, tc.path, rec.Code, tc.want)
+		}
+	}
+
+	// AUTH_API_KEY_SCOPES still applies to bare keys in the file.
+	cfg.APIKeyScopes = parseAPIKeyScopes(sha256Hex([]byte("other")) + "=reports:write")
+	if got := apiKeyScopes(cfg, "legacy-key"); len(got) != 0 {
+		t.Fatalf("unlisted bare key under a scope mapping: %v", got)
+	}
+	if got := apiKeyScopes(cfg, "writer-key"); strings.Join(got, " ") != "profiles:write reports:write" {
+		t.Fatalf("file scopes should win: %v", got)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// --- Cookie sessions ---
+
+const (
+	sessionCookieName = "chartly_session"
+	csrfCookieName    = "chartly_csrf"
+	csrfHeader        = "X-CSRF-Token"
+
+	defaultSessionTTL = 8 * time.Hour
+)
+
+var (
+	errCSRF           = errors.New("csrf_failed")
+	errSessionInvalid = errors.New("session_invalid")
+	errSessionExpired = errors.New("session_expired")
+)
+
+// sessionConfig signs dashboard session cookies. The session is a JSON
+// payload and its HS256 MAC; nothing is stored server-side except the ids of
+// sessions ended by logout.
+type sessionConfig struct {
+	key    []byte
+	ttl    time.Duration
+	secure string // "auto" (TLS or X-Forwarded-Proto: https), "true" or "false"
+	now    func() time.Time
+}
+
+// sessionClaims is the signed content of the session cookie. CSRF is the
+// double-submit token: the same value is in the readable chartly_csrf cookie
+// and must come back in X-CSRF-Token on state-changing requests.
+type sessionClaims struct {
+	Principal string   `json:"sub"`
+	Tenant    string   `json:"tenant,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	SID       string   `json:"sid"`
+	CSRF      string   `json:"csrf"`
+	IssuedAt  int64    `json:"iat"`
+	Expires   int64    `json:"exp"`
+}
+
+// loadSessionConfig reads AUTH_SESSION_SECRET (or _FILE). Without one a
+// random key is used, so sessions end on restart and are not shared between
+// gateway instances.
+func loadSessionConfig() *sessionConfig {
+	secret := strings.TrimSpace(os.Getenv("AUTH_SESSION_SECRET"))
+	if f := strings.TrimSpace(os.Getenv("AUTH_SESSION_SECRET_FILE")); secret == "" && f != "" {
+		secret = strings.TrimSpace(readFileString(f))
+	}
+	key := []byte(secret)
+	if secret == "" {
+		key = make([]byte, 32)
+		_, _ = rand.Read(key)
+		slog.Warn("session_secret_ephemeral", "detail", "AUTH_SESSION_SECRET unset; sessions end on restart")
+	}
+	ttl := time.Duration(envInt64("AUTH_SESSION_TTL_SECONDS", int64(defaultSessionTTL/time.Second))) * time.Second
+	if ttl <= 0 {
+		ttl = defaultSessionTTL
+	}
+	secure := strings.ToLower(strings.TrimSpace(os.Getenv("AUTH_SESSION_COOKIE_SECURE")))
+	if secure != "true" && secure != "false" {
+		secure = "auto"
+	}
+	return &sessionConfig{key: key, ttl: ttl, secure: secure, now: time.Now}
+}
+
+func (sc *sessionConfig) mac(payload string) []byte {
+	m := hmac.New(sha256.New, sc.key)
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
+
+func (sc *sessionConfig) sign(c sessionClaims) string {
+	raw, _ := json.Marshal(c)
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(sc.mac(payload))
+}
+
+func (sc *sessionConfig) parse(v string) (sessionClaims, error) {
+	payload, sig, ok := strings.Cut(v, ".")
+	if !ok {
+		return sessionClaims{}, errSessionInvalid
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, sc.mac(payload)) {
+		return sessionClaims{}, errSessionInvalid
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return sessionClaims{}, errSessionInvalid
+	}
+	var c sessionClaims
+	if err := json.Unmarshal(raw, &c); err != nil || c.Principal == "" || c.SID == "" || c.CSRF == "" {
+		return sessionClaims{}, errSessionInvalid
+	}
+	if sc.now().Unix() >= c.Expires {
+		return sessionClaims{}, errSessionExpired
+	}
+	return c, nil
+}
+
+func (sc *sessionConfig) secureCookie(r *http.Request) bool {
+	switch sc.secure {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return r.TLS != nil || strings.EqualFold(strings.TrimSpace(r.Header.Get("X-Forwarded-Proto")), "https")
+}
+
+func (sc *sessionConfig) setCookies(w http.ResponseWriter, r *http.Request, session, csrf string, maxAge int) {
+	secure := sc.secureCookie(r)
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Value: session, Path: "/", MaxAge: maxAge, HttpOnly: true, Secure: secure, SameSite: http.SameSiteStrictMode})
+	// Readable by the dashboard, which echoes it in X-CSRF-Token.
+	http.SetCookie(w, &http.Cookie{Name: csrfCookieName, Value: csrf, Path: "/", MaxAge: maxAge, Secure: secure, SameSite: http.SameSiteStrictMode})
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func sessionRevocationID(sid string) string {
+	return "session:" + sid
+}
+
+// safeMethod reports whether a request cannot change state, so cookie-only
+// requests need no CSRF token.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// sessionFromCookie authenticates a request by its session cookie. A
+// state-changing request also needs X-CSRF-Token to match the session's
+// token, or it fails with errCSRF.
+func sessionFromCookie(cfg *authConfig, r *http.Request) (sessionClaims, error) {
+	c, err := r.Cookie(sessionCookieName)
+	if err != nil || cfg.Sessions == nil {
+		return sessionClaims{}, errUnauthorized
+	}
+	sess, err := cfg.Sessions.parse(c.Value)
+	if err != nil {
+		return sessionClaims{}, errUnauthorized
+	}
+	if cfg.Revoked != nil && cfg.Revoked.revoked(sess.Principal, sessionRevocationID(sess.SID)) {
+		return sessionClaims{}, errUnauthorized
+	}
+	if !safeMethod(r.Method) {
+		got := strings.TrimSpace(r.Header.Get(csrfHeader))
+		if got == "" || subtle.ConstantTimeCompare([]byte(got), []byte(sess.CSRF)) != 1 {
+			return sess, errCSRF
+		}
+	}
+	return sess, nil
+}
+
+// newSessionHandler serves POST /api/auth/session: it checks the API key or
+// bearer token sent with the request and answers with session cookies
+// carrying the same principal, tenant and scopes. A session cannot be used to
+// open another one.
+func newSessionHandler(cfg *authConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		if !cfg.Enabled || cfg.Sessions == nil {
+			writeJSON(w, http.StatusNotFound, map[string]any{"error": "sessions_disabled"})
+			return
+		}
+		if strings.TrimSpace(r.Header.Get("X-API-Key")) == "" && strings.TrimSpace(r.Header.Get("Authorization")) == "" {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{"error": "credentials_required"})
+			return
+		}
+		principal, tenant, scopes, err := authenticateRequest(cfg, r)
+		if errors.Is(err, errJWKSUnavailable) {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"error": "jwks_unavailable"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{"error": "unauthorized"})
+			return
+		}
+		if tenant == "" && cfg.RequireTenant {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{"error": "tenant_required"})
+			return
+		}
+
+		now := cfg.Sessions.now()
+		exp := now.Add(cfg.Sessions.ttl)
+		sess := sessionClaims{
+			Principal: principal,
+			Tenant:    tenant,
+			Scopes:    scopes,
+			SID:       randomHex(16),
+			CSRF:      randomHex(32),
+			IssuedAt:  now.Unix(),
+			Expires:   exp.Unix(),
+		}
+		cfg.Sessions.setCookies(w, r, cfg.Sessions.sign(sess), sess.CSRF, int(cfg.Sessions.ttl/time.Second))
+		w.Header().Set("Cache-Control", "no-store")
+		slog.Info("session_created", "principal", principal, "tenant", tenant, "expires_at", exp.UTC().Format(time.RFC3339))
+		writeJSON(w, http.StatusOK, map[string]any{
+			"principal":  principal,
+			"tenant":     tenant,
+			"scopes":     scopes,
+			"expires_at": exp.UTC().Format(time.RFC3339),
+			"csrf_token": sess.CSRF,
+		})
+	}
+}
+
+// newLogoutHandler serves POST /api/auth/logout: it clears the session
+// cookies and, when the session is still valid, revokes it so a copied
+// cookie stops working too.
+func newLogoutHandler(cfg *authConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		if cfg.Sessions == nil {
+			writeJSON(w, http.StatusNotFound, map[string]any{"error": "sessions_disabled"})
+			return
+		}
+		revoked := false
+		if c, err := r.Cookie(sessionCookieName); err == nil && cfg.Revoked != nil {
+			if sess, err := cfg.Sessions.parse(c.Value); err == nil {
+				cfg.Revoked.revoke(sess.Principal, sessionRevocationID(sess.SID), time.Unix(sess.Expires, 0))
+				revoked = true
+			}
+		}
+		cfg.Sessions.setCookies(w, r, "", "", -1)
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "revoked": revoked})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSessionAuth() *authConfig {
+	return &authConfig{
+		Enabled:        true,
+		APIKeys:        parseKeySet("k"),
+		TenantHeader:   "X-Tenant-ID",
+		AllowAnonymous: parseAnonymousPaths(nil),
+		Revoked:        newJTIRevocationCache(),
+		Sessions:       &sessionConfig{key: []byte("x"), ttl: time.Hour, secure: "auto", now: time.Now},
+	}
+}
+
+func TestSessionCookieLifecycle(t *testing.T) {
+	cfg := newTestSessionAuth()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/auth/session", newSessionHandler(cfg))
+	mux.HandleFunc("/api/auth/logout", newLogoutHandler(cfg))
+	mux.HandleFunc("/api/profiles", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"principal": principalFromContext(r.Context())})
+	})
+	h := withAuth(cfg)(mux)
+	do := func(method, path string, cookies []*http.Cookie, hdr map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader("{}"))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/api/auth/session", nil, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("login without credentials: expected 401, got %d", rec.Code)
+	}
+	rec := do(http.MethodPost, "/api/auth/session", nil, map[string]string{"X-API-Key": "k"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		CSRF string `json:"csrf_token"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &body)
+	cookies := rec.Result().Cookies()
+	var session, csrf *http.Cookie
+	for _, c := range cookies {
+		switch c.Name {
+		case sessionCookieName:
+			session = c
+		case csrfCookieName:
+			csrf = c
+		}
+	}
+	if session == nil || csrf == nil {
+		t.Fatalf("expected session and csrf cookies, got %v", cookies)
+	}
+	if !session.HttpOnly || session.SameSite != http.SameSiteStrictMode || csrf.HttpOnly {
+		t.Fatalf("unexpected cookie attributes: %+v %+v", session, csrf)
+	}
+	if csrf.Value != body.CSRF {
+		t.Fatalf("csrf cookie %q does not match body %q", csrf.Value, body.CSRF)
+	}
+
+	if rec := do(http.MethodGet, "/api/profiles", cookies, nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "apikey:") {
+		t.Fatalf("cookie-only GET: expected 200 as the key's principal, got %d %s", rec.Code, rec.Body.String())
+	}
+	for _, token := range []string{"", "wrong"} {
+		rec := do(http.MethodPost, "/api/profiles", cookies, map[string]string{csrfHeader: token})
+		if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "csrf_failed") {
+			t.Fatalf("POST with csrf %q: expected 403 csrf_failed, got %d %s", token, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := do(http.MethodPost, "/api/profiles", cookies, map[string]string{csrfHeader: body.CSRF}); rec.Code != http.StatusOK {
+		t.Fatalf("POST with csrf token: expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	tampered := *session
+	tampered.Value = "x" + session.Value[1:]
+	if rec := do(http.MethodGet, "/api/profiles", []*http.Cookie{&tampered}, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("tampered cookie: expected 401, got %d", rec.Code)
+	}
+
+	rec = do(http.MethodPost, "/api/auth/logout", cookies, map[string]string{csrfHeader: body.CSRF})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"revoked":true`) {
+		t.Fatalf("logout: expected 200 revoked, got %d %s", rec.Code, rec.Body.String())
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.MaxAge >= 0 {
+			t.Fatalf("logout should expire %s, got MaxAge %d", c.Name, c.MaxAge)
+		}
+	}
+	if rec := do(http.MethodGet, "/api/profiles", cookies, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("cookie after logout: expected 401, got %d", rec.Code)
+	}
+}
+
+func TestSessionCookieExpires(t *testing.T) {
+	cfg := newTestSessionAuth()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg.Sessions.now = func() time.Time { return now }
+	v := cfg.Sessions.sign(sessionClaims{Principal: "p", SID: "s", CSRF: "c", Expires: now.Add(time.Minute).Unix()})
+	if _, err := cfg.Sessions.parse(v); err != nil {
+		t.Fatalf("expected valid session, got %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := cfg.Sessions.parse(v); err != errSessionExpired {
+		t.Fatalf("expected errSessionExpired, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// --- Graceful shutdown ---
+
+const defaultShutdownTimeout = 10 * time.Second
+
+// close sends a final "shutdown" event to every /api/events and /api/ws
+// subscriber and ends their streams, so browsers reconnect (to another
+// instance) at once instead of waiting to notice a dead connection. Clients
+// that connect afterwards are ended straight away.
+func (h *sseHub) close() int {
+	h.publish("shutdown", map[string]any{"ts": time.Now().UTC().Format(time.RFC3339)})
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	n := len(h.clients)
+	for ch := range h.clients {
+		// Events already queued, the shutdown event included, are still
+		// read before the handler sees the channel closed.
+		delete(h.clients, ch)
+		close(ch)
+	}
+	return n
+}
+
+// withStreamDrain ends the long-lived streams in streamingPaths, and proxied
+// WebSockets, once drain is cancelled; http.Server.Shutdown would otherwise
+// wait on the streams until its timeout, and does not track hijacked
+// connections at all. /api/events and /api/ws are left to sseHub.close,
+// which sends the shutdown event before ending the stream.
+func withStreamDrain(drain context.Context) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, streaming := streamingPaths[r.URL.Path]
+			if (!streaming && !isWebSocketUpgrade(r)) || r.URL.Path == "/api/events" || r.URL.Path == "/api/ws" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			stop := context.AfterFunc(drain, cancel)
+			defer stop()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// gracefulShutdown stops accepting connections, ends event streams and waits
+// up to timeout for in-flight requests to finish. Connections still open
+// after that are closed.
+func gracefulShutdown(srv *http.Server, hub *sseHub, drainStreams context.CancelFunc, timeout time.Duration) error {
+	start := time.Now()
+	clients := hub.close()
+	drainStreams()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("shutdown_timeout", "timeout", timeout.String())
+		_ = srv.Close()
+	}
+	slog.Info("shutdown_complete", "sse_clients", clients, "duration_ms", time.Since(start).Milliseconds())
+	return err
+}
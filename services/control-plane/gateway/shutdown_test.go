@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGracefulShutdownDrains(t *testing.T) {
+	d, _, _ := newTestGatewayRoutes(t)
+	mux := newGatewayMux(d)
+	entered := make(chan struct{})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		time.Sleep(300 * time.Millisecond)
+		_, _ = io.WriteString(w, "done")
+	})
+	streams, drainStreams := context.WithCancel(context.Background())
+	defer drainStreams()
+	srv := httptest.NewServer(withStreamDrain(streams)(mux))
+	defer srv.Close()
+
+	// An event stream and a results stream that shutdown has to end.
+	events, err := http.Get(srv.URL + "/api/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer events.Body.Close()
+	crypto, err := http.Get(srv.URL + "/api/crypto/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer crypto.Body.Close()
+
+	type result struct {
+		body string
+		err  error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(srv.URL + "/slow")
+		if err != nil {
+			slow <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		slow <- result{string(b), err}
+	}()
+	<-entered
+
+	done := make(chan error, 1)
+	go func() { done <- gracefulShutdown(srv.Config, d.sse, drainStreams, 5*time.Second) }()
+
+	var names []string
+	sc := bufio.NewScanner(events.Body)
+	for sc.Scan() {
+		if name, ok := strings.CutPrefix(sc.Text(), "event: "); ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 || names[len(names)-1] != "shutdown" {
+		t.Fatalf("event stream should end with a shutdown event, got %v", names)
+	}
+	if _, err := io.Copy(io.Discard, crypto.Body); err != nil {
+		t.Fatalf("crypto stream: %v", err)
+	}
+
+	select {
+	case r := <-slow:
+		if r.err != nil || r.body != "done" {
+			t.Fatalf("in-flight request cut off: %q %v", r.body, r.err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("in-flight request did not finish")
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("shutdown: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("shutdown still waiting on open streams")
+	}
+
+	// A subscriber arriving after close is ended straight away.
+	ch := make(chan sseEvent, 1)
+	d.sse.addClient(ch, nil)
+	if _, ok := <-ch; ok {
+		t.Fatal("late subscriber kept open")
+	}
+}
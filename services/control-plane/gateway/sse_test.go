@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSSEHubSweepsStalledClients(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := newSSEHub(16)
+	h.now = func() time.Time { return now }
+
+	stalled := make(chan sseEvent, 2)
+	kicked := false
+	h.addClient(stalled, func() { kicked = true })
+	draining := make(chan sseEvent, 2)
+	drainer := h.addClient(draining, nil)
+	quiet := make(chan sseEvent, 2)
+	h.addClient(quiet, nil)
+	h.removeClient(quiet) // re-add after the publishes so it has nothing pending
+	h.publish("tick", map[string]int{"n": 1})
+	h.publish("tick", map[string]int{"n": 2})
+	h.addClient(quiet, nil)
+
+	now = now.Add(20 * time.Second)
+	<-draining
+	drainer.drained(now)
+	if n := h.sweep(); n != 0 {
+		t.Fatalf("nothing is past the idle timeout yet, swept %d", n)
+	}
+
+	now = now.Add(15 * time.Second)
+	if n := h.sweep(); n != 1 {
+		t.Fatalf("expected only the stalled client to be swept, got %d", n)
+	}
+	if _, ok := <-stalled; !ok {
+		t.Fatal("buffered events should still be readable before close is observed")
+	}
+	<-stalled
+	if _, ok := <-stalled; ok {
+		t.Fatal("stalled client channel should be closed")
+	}
+	if !kicked {
+		t.Fatal("stalled client should be kicked so its pending write aborts")
+	}
+	h.mu.RLock()
+	_, hasDraining := h.clients[draining]
+	_, hasQuiet := h.clients[quiet]
+	h.mu.RUnlock()
+	if !hasDraining || !hasQuiet {
+		t.Fatalf("draining=%v quiet=%v should stay connected", hasDraining, hasQuiet)
+	}
+
+	// removeClient after a sweep must not panic.
+	h.removeClient(stalled)
+}
+
+func TestSSEHubReplaySince(t *testing.T) {
+	h := newSSEHub(600)
+	for i := 0; i < 700; i++ {
+		h.publish("tick", map[string]int{"n": i})
+	}
+	// The buffer holds ids 101..700.
+	cases := []struct {
+		since     int64
+		n         int
+		first     int64
+		maxReplay int
+	}{
+		{0, 0, 0, 100},
+		{690, 10, 691, 100},
+		{700, 0, 0, 100},
+		{5, 100, 601, 100},   // older than the buffer: newest maxReplay only
+		{500, 100, 601, 100}, // capped
+		{500, 200, 501, 0},   // no cap
+	}
+	for _, tc := range cases {
+		h.maxReplay = tc.maxReplay
+		got := h.replaySince(tc.since)
+		if len(got) != tc.n {
+			t.Fatalf("since %d: %d events, want %d", tc.since, len(got), tc.n)
+		}
+		if tc.n == 0 {
+			continue
+		}
+		if got[0].ID != tc.first || got[len(got)-1].ID != 700 {
+			t.Fatalf("since %d: ids %d..%d, want %d..700", tc.since, got[0].ID, got[len(got)-1].ID, tc.first)
+		}
+		for i := 1; i < len(got); i++ {
+			if got[i].ID != got[i-1].ID+1 {
+				t.Fatalf("since %d: gap at %d", tc.since, got[i].ID)
+			}
+		}
+	}
+
+	h.maxReplay = 100
+	got := h.replaySince(695)
+	h.publish("tick", map[string]int{"n": 700})
+	if len(got) != 5 || got[4].ID != 700 {
+		t.Fatalf("replay must not alias the live buffer: %+v", got[len(got)-1])
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// --- Startup validation ---
+
+// startupIssue is one configuration problem found before serving.
+type startupIssue struct {
+	Check   string `json:"check"` // "upstream_url", "upstream_probe" or "catalog"
+	Target  string `json:"target,omitempty"`
+	Message string `json:"message"`
+}
+
+// startupReport is kept for the life of the process and shown on
+// /api/gateway/health, so a gateway that started degraded says why.
+type startupReport struct {
+	OK        bool           `json:"ok"`
+	Strict    bool           `json:"strict"`
+	CheckedAt string         `json:"checked_at"`
+	Issues    []startupIssue `json:"issues"`
+}
+
+type startupConfig struct {
+	strict bool // exit on any issue instead of serving degraded
+	probe  bool // GET each upstream's /health once
+}
+
+// loadStartupConfig fails fast by default outside GATEWAY_ENV=local;
+// GATEWAY_STARTUP_STRICT overrides either way.
+func loadStartupConfig() startupConfig {
+	env := strings.ToLower(envOr("GATEWAY_ENV", "local"))
+	return startupConfig{
+		strict: envBool("GATEWAY_STARTUP_STRICT", env != "local"),
+		probe:  envBool("GATEWAY_STARTUP_PROBE", false),
+	}
+}
+
+// validateStartup checks every upstream URL and the embedded connector
+// catalog, and optionally probes the upstreams.
+func validateStartup(cfg startupConfig, targets healthTargets, catalogRaw []byte) startupReport {
+	rep := startupReport{Strict: cfg.strict, CheckedAt: time.Now().UTC().Format(time.RFC3339), Issues: []startupIssue{}}
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	valid := make(healthTargets, len(targets))
+	for _, name := range names {
+		if err := validateUpstreamURL(targets[name]); err != nil {
+			rep.Issues = append(rep.Issues, startupIssue{Check: "upstream_url", Target: name, Message: err.Error()})
+			continue
+		}
+		valid[name] = targets[name]
+	}
+	if _, err := parseConnectorCatalog(catalogRaw); err != nil {
+		rep.Issues = append(rep.Issues, startupIssue{Check: "catalog", Message: err.Error()})
+	}
+	if cfg.probe && len(valid) > 0 {
+		detailed := checkAllDetailed(context.Background(), valid)
+		for _, name := range names {
+			d, ok := detailed.Services[name]
+			if !ok || d.Status == "up" {
+				continue
+			}
+			msg := d.Error
+			if d.HTTPStatus != 0 {
+				msg = fmt.Sprintf("%s (status %d)", d.Error, d.HTTPStatus)
+			}
+			rep.Issues = append(rep.Issues, startupIssue{Check: "upstream_probe", Target: name, Message: msg})
+		}
+	}
+	rep.OK = len(rep.Issues) == 0
+	return rep
+}
+
+// enforce logs the report and exits when strict and anything failed.
+func (r startupReport) enforce() {
+	level := slog.LevelWarn
+	if r.Strict {
+		level = slog.LevelError
+	}
+	for _, is := range r.Issues {
+		slog.Log(context.Background(), level, "startup_check_failed", "check", is.Check, "target", is.Target, "err", is.Message)
+	}
+	if !r.OK && r.Strict {
+		slog.Error("startup_validation_failed", "issues", len(r.Issues))
+		os.Exit(1)
+	}
+}
+
+// validateUpstreamURL requires an absolute http(s) URL with a host, which
+// catches the common "aggregator:8082" (no scheme) typo.
+func validateUpstreamURL(raw string) error {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return fmt.Errorf("invalid url %q", raw)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url %q must start with http:// or https://", raw)
+	}
+	if u.Host == "" || u.Hostname() == "" {
+		return fmt.Errorf("url %q has no host", raw)
+	}
+	return nil
+}
+
+// parseConnectorCatalog decodes the catalog and checks that it has a
+// version and that every connector has a unique id, a name and a kind, and
+// that a schema override, if any, describes an object.
+func parseConnectorCatalog(raw []byte) (connectorCatalog, error) {
+	var cat connectorCatalog
+	if len(raw) == 0 {
+		return cat, errors.New("catalog is empty")
+	}
+	if err := yaml.Unmarshal(raw, &cat); err != nil {
+		return connectorCatalog{}, fmt.Errorf("parse: %w", err)
+	}
+	var problems []string
+	if strings.TrimSpace(cat.Version) == "" {
+		problems = append(problems, "missing version")
+	}
+	seen := make(map[string]bool, len(cat.Connectors))
+	for i, c := range cat.Connectors {
+		id := strings.TrimSpace(c.ID)
+		label := id
+		if id == "" {
+			label = fmt.Sprintf("#%d", i)
+			problems = append(problems, fmt.Sprintf("connector %s: missing id", label))
+		} else if seen[id] {
+			problems = append(problems, fmt.Sprintf("connector %s: duplicate id", label))
+		}
+		seen[id] = true
+		if strings.TrimSpace(c.Name) == "" {
+			problems = append(problems, fmt.Sprintf("connector %s: missing name", label))
+		}
+		if strings.TrimSpace(c.Kind) == "" {
+			problems = append(problems, fmt.Sprintf("connector %s: missing kind", label))
+		}
+		if c.Schema != nil {
+			if t, ok := c.Schema["type"]; ok && t != "object" {
+				problems = append(problems, fmt.Sprintf("connector %s: schema type must be object", label))
+			}
+			if p, ok := c.Schema["properties"]; ok {
+				if _, isMap := p.(map[string]any); !isMap {
+					problems = append(problems, fmt.Sprintf("connector %s: schema properties must be a mapping", label))
+				}
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return cat, errors.New(strings.Join(problems, "; "))
+	}
+	return cat, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateUpstreamURL(t *testing.T) {
+	for raw, want := range map[string]string{
+		"http://aggregator:8082":  "",
+		"https://registry.local":  "",
+		"aggregator:8082":         "must start with http",
+		"//aggregator:8082":       "must start with http",
+		"http://":                 "has no host",
+		"http://[::1":             "invalid url",
+		"ftp://registry.local:21": "must start with http",
+	} {
+		err := validateUpstreamURL(raw)
+		if want == "" && err != nil {
+			t.Fatalf("%s: unexpected error %v", raw, err)
+		}
+		if want != "" && (err == nil || !strings.Contains(err.Error(), want)) {
+			t.Fatalf("%s: expected %q, got %v", raw, want, err)
+		}
+	}
+}
+
+func TestParseConnectorCatalogIntegrity(t *testing.T) {
+	if _, err := parseConnectorCatalog(connectorCatalogYAML); err != nil {
+		t.Fatalf("embedded catalog should be valid: %v", err)
+	}
+	cases := map[string]struct {
+		raw  string
+		want string
+	}{
+		"empty":        {"", "catalog is empty"},
+		"not yaml":     {"connectors: [", "parse:"},
+		"no version":   {"connectors:\n  - {id: a, name: A, kind: api}\n", "missing version"},
+		"missing id":   {"version: v1\nconnectors:\n  - {name: A, kind: api}\n", "connector #0: missing id"},
+		"missing name": {"version: v1\nconnectors:\n  - {id: a, kind: api}\n", "connector a: missing name"},
+		"missing kind": {"version: v1\nconnectors:\n  - {id: a, name: A}\n", "connector a: missing kind"},
+		"duplicate":    {"version: v1\nconnectors:\n  - {id: a, name: A, kind: api}\n  - {id: a, name: B, kind: api}\n", "connector a: duplicate id"},
+		"schema type":  {"version: v1\nconnectors:\n  - {id: a, name: A, kind: api, schema: {type: array}}\n", "connector a: schema type must be object"},
+		"schema props": {"version: v1\nconnectors:\n  - {id: a, name: A, kind: api, schema: {properties: [x]}}\n", "connector a: schema properties must be a mapping"},
+	}
+	for name, tc := range cases {
+		if _, err := parseConnectorCatalog([]byte(tc.raw)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: expected %q, got %v", name, tc.want, err)
+		}
+	}
+}
+
+func TestValidateStartup(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	targets := healthTargets{"registry": up.URL, "aggregator": "aggregator:8082", "reporter": down.URL}
+	rep := validateStartup(startupConfig{}, targets, connectorCatalogYAML)
+	if rep.OK || len(rep.Issues) != 1 || rep.Issues[0].Check != "upstream_url" || rep.Issues[0].Target != "aggregator" {
+		t.Fatalf("without probing only the bad URL should be reported: %+v", rep)
+	}
+
+	rep = validateStartup(startupConfig{probe: true}, targets, []byte("version: v1\nconnectors:\n  - {id: a}\n"))
+	got := make([]string, 0, len(rep.Issues))
+	for _, is := range rep.Issues {
+		got = append(got, is.Check+":"+is.Target)
+	}
+	if strings.Join(got, ",") != "upstream_url:aggregator,catalog:,upstream_probe:reporter" {
+		t.Fatalf("unexpected issues %v", got)
+	}
+
+	if rep := validateStartup(startupConfig{probe: true}, healthTargets{"registry": up.URL}, connectorCatalogYAML); !rep.OK {
+		t.Fatalf("healthy config reported issues: %+v", rep.Issues)
+	}
+}
+
+func TestLoadStartupConfigStrictOutsideLocal(t *testing.T) {
+	t.Setenv("GATEWAY_STARTUP_STRICT", "")
+	t.Setenv("GATEWAY_ENV", "")
+	if loadStartupConfig().strict {
+		t.Fatal("local (the default) should degrade, not fail fast")
+	}
+	t.Setenv("GATEWAY_ENV", "production")
+	if !loadStartupConfig().strict {
+		t.Fatal("non-local env should fail fast by default")
+	}
+	t.Setenv("GATEWAY_STARTUP_STRICT", "false")
+	if loadStartupConfig().strict {
+		t.Fatal("GATEWAY_STARTUP_STRICT=false should override the env default")
+	}
+}
+
+func TestMustProxyBadURLAnswers502(t *testing.T) {
+	p := mustProxy("http://[::1", defaultUpstreamTimeout)
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/results", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502 from an unparseable upstream, got %d", rec.Code)
+	}
+}
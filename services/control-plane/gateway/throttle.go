@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Upstream throttling ---
+
+const (
+	// defaultUpstreamRetryAfter applies when a 429 carries no usable Retry-After.
+	defaultUpstreamRetryAfter = time.Second
+	// maxUpstreamRetryAfter caps what an upstream can ask for, so a bogus
+	// header cannot silence a backend for hours.
+	maxUpstreamRetryAfter = 5 * time.Minute
+)
+
+// upstreamThrottledError is returned by the internal fetch helpers when an
+// upstream answered 429, or is still inside the Retry-After it gave.
+type upstreamThrottledError struct {
+	upstream   string
+	retryAfter time.Duration
+}
+
+func (e *upstreamThrottledError) Error() string {
+	return fmt.Sprintf("upstream_throttled: %s retry_after=%s", e.upstream, e.retryAfter)
+}
+
+// upstreamBackoff remembers, per upstream base URL, until when a 429 asked
+// the gateway to hold off. Fetch helpers consult it before dialing so a poll
+// tick inside the window fails fast instead of adding to the pile-up.
+type upstreamBackoff struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+	now   func() time.Time
+}
+
+var upstreamBackoffs = newUpstreamBackoff()
+
+func newUpstreamBackoff() *upstreamBackoff {
+	return &upstreamBackoff{until: make(map[string]time.Time), now: time.Now}
+}
+
+// check returns a throttled error while upstream is backing off.
+func (b *upstreamBackoff) check(upstream string) error {
+	upstream = strings.TrimSuffix(upstream, "/")
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	until, ok := b.until[upstream]
+	if !ok {
+		return nil
+	}
+	now := b.now()
+	if !now.Before(until) {
+		delete(b.until, upstream)
+		return nil
+	}
+	return &upstreamThrottledError{upstream: upstream, retryAfter: until.Sub(now)}
+}
+
+// throttled records a 429 response from upstream and returns the error for
+// the caller to surface.
+func (b *upstreamBackoff) throttled(upstream string, resp *http.Response) error {
+	upstream = strings.TrimSuffix(upstream, "/")
+	b.mu.Lock()
+	now := b.now()
+	wait := parseRetryAfter(resp.Header.Get("Retry-After"), now)
+	if until := now.Add(wait); until.After(b.until[upstream]) {
+		b.until[upstream] = until
+	}
+	b.mu.Unlock()
+	label := upstream
+	if u, err := url.Parse(upstream); err == nil && u.Host != "" {
+		label = u.Host
+	}
+	metricsUpstreamThrottled(label)
+	slog.Warn("upstream_throttled", "upstream", upstream, "retry_after_ms", wait.Milliseconds())
+	return &upstreamThrottledError{upstream: upstream, retryAfter: wait}
+}
+
+// parseRetryAfter accepts delay-seconds or an HTTP-date, clamped to
+// [defaultUpstreamRetryAfter, maxUpstreamRetryAfter].
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	d := time.Duration(0)
+	if secs, err := strconv.Atoi(v); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = t.Sub(now)
+	}
+	if d < defaultUpstreamRetryAfter {
+		d = defaultUpstreamRetryAfter
+	}
+	if d > maxUpstreamRetryAfter {
+		d = maxUpstreamRetryAfter
+	}
+	return d
+}
+
+// writeUpstreamError answers a failed internal fetch: 429 with Retry-After
+// when the upstream throttled us, so clients wait instead of retrying at once,
+// and 502 upstream_error otherwise.
+func writeUpstreamError(w http.ResponseWriter, err error) {
+	var te *upstreamThrottledError
+	if errors.As(err, &te) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(te.retryAfter.Seconds()))))
+		writeJSON(w, http.StatusTooManyRequests, map[string]any{"error": "upstream_throttled", "retry_after_ms": te.retryAfter.Milliseconds()})
+		return
+	}
+	writeJSON(w, http.StatusBadGateway, map[string]any{"error": "upstream_error"})
+}
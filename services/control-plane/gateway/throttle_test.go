@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProxyPassesThrough429(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer upstream.Close()
+
+	t.Setenv("CIRCUIT_BREAKER_THRESHOLD", "1")
+	p := mustProxy(upstream.URL, defaultUpstreamTimeout)
+	before := metricsSnapshot().Upstream429[p.breaker.upstream]
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		stripPrefixProxy("/api", p).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/results", nil))
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "7" {
+			t.Fatalf("call %d: expected passthrough 429 with Retry-After, got %d %q", i, rec.Code, rec.Header().Get("Retry-After"))
+		}
+	}
+	if p.breaker.current() != breakerClosed {
+		t.Fatalf("429 must not trip the breaker, got %s", p.breaker.current())
+	}
+	if got := metricsSnapshot().Upstream429[p.breaker.upstream] - before; got != 3 {
+		t.Fatalf("expected 3 upstream 429s counted, got %d", got)
+	}
+}
+
+func TestFetchHonorsRetryAfter(t *testing.T) {
+	orig := upstreamBackoffs
+	upstreamBackoffs = newUpstreamBackoff()
+	defer func() { upstreamBackoffs = orig }()
+	now := time.Unix(1_700_000_000, 0)
+	upstreamBackoffs.now = func() time.Time { return now }
+
+	var hits atomic.Int32
+	var throttle atomic.Bool
+	throttle.Store(true)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if throttle.Load() {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer upstream.Close()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rows, err := fetchAggregatorResults(r.Context(), upstream.URL, "p1", 10)
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rows)
+	})
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/reports/x", nil))
+		return rec
+	}
+
+	rec := get()
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "2" || !strings.Contains(rec.Body.String(), "upstream_throttled") {
+		t.Fatalf("expected 429 upstream_throttled, got %d %q %s", rec.Code, rec.Header().Get("Retry-After"), rec.Body.String())
+	}
+
+	// Inside the window the upstream is not called again.
+	now = now.Add(1500 * time.Millisecond)
+	_, err := fetchAggregatorResults(context.Background(), upstream.URL, "p1", 10)
+	var te *upstreamThrottledError
+	if !errors.As(err, &te) || te.retryAfter != 500*time.Millisecond || hits.Load() != 1 {
+		t.Fatalf("expected fast-fail with 500ms left, got %v hits=%d", err, hits.Load())
+	}
+	if rec := get(); rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("partial seconds round up, got %q", rec.Header().Get("Retry-After"))
+	}
+
+	throttle.Store(false)
+	now = now.Add(time.Second)
+	if rec := get(); rec.Code != http.StatusOK || hits.Load() != 2 {
+		t.Fatalf("expected recovery after Retry-After, got %d hits=%d", rec.Code, hits.Load())
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := map[string]time.Duration{
+		"":                              defaultUpstreamRetryAfter,
+		"soon":                          defaultUpstreamRetryAfter,
+		"0":                             defaultUpstreamRetryAfter,
+		"3":                             3 * time.Second,
+		"86400":                         maxUpstreamRetryAfter,
+		"Thu, 01 Jan 2026 00:00:30 GMT": 30 * time.Second,
+	}
+	for in, want := range cases {
+		if got := parseRetryAfter(in, now); got != want {
+			t.Fatalf("%q: got %s want %s", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// --- /api/audit/v0/timeline ---
+
+// eventsSince returns the buffered events published at or after since,
+// oldest first. Unlike replaySince it is not capped by maxReplay.
+func (h *sseHub) eventsSince(since time.Time) []sseEvent {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	out := make([]sseEvent, 0, len(h.buffer))
+	for _, ev := range h.buffer {
+		if !ev.TS.Before(since) {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+// timelineEntry is one row of the merged timeline; Type says which of Audit
+// and SSE is set.
+type timelineEntry struct {
+	Type  string             `json:"type"`
+	TS    string             `json:"ts"`
+	Audit *auditEvent        `json:"audit,omitempty"`
+	SSE   *timelineSSEDetail `json:"sse,omitempty"`
+}
+
+type timelineSSEDetail struct {
+	ID    int64           `json:"id"`
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// mergeTimeline interleaves audit events, in (event_ts, event_id) order, with
+// hub events, in publish order. Audit timestamps have second resolution, so
+// hub events are compared at that resolution too, and on a tie the hub event
+// goes first: a handler publishes before withLogging records its request.
+// Within each source the input order is kept, so the merge is stable.
+func mergeTimeline(audit []auditEvent, events []sseEvent, limit int) []timelineEntry {
+	out := make([]timelineEntry, 0, len(audit)+len(events))
+	i, j := 0, 0
+	for i < len(audit) || j < len(events) {
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+		if j < len(events) {
+			ts := events[j].TS.UTC().Truncate(time.Second)
+			if i >= len(audit) || !auditBefore(audit[i], ts) {
+				ev := events[j]
+				out = append(out, timelineEntry{
+					Type: "sse",
+					TS:   ts.Format(time.RFC3339),
+					SSE:  &timelineSSEDetail{ID: ev.ID, Event: ev.Event, Data: json.RawMessage(ev.Data)},
+				})
+				j++
+				continue
+			}
+		}
+		ev := audit[i]
+		out = append(out, timelineEntry{Type: "audit", TS: ev.EventTS, Audit: &ev})
+		i++
+	}
+	return out
+}
+
+// newAuditTimelineHandler serves audit events and the hub's buffered events
+// from since on as one list. Hub events only reach back as far as its
+// buffer of recent events.
+func newAuditTimelineHandler(audit *auditStore, sse *sseHub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		q := r.URL.Query()
+		limit := clampInt(queryInt(r, "limit", 200), 1, 5000)
+		var since time.Time
+		if v := q.Get("since"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_since"})
+				return
+			}
+			since = t
+		}
+		events := audit.list(auditFilter{Since: since, Limit: limit, Direction: "asc"})
+		var published []sseEvent
+		if sse != nil {
+			published = sse.eventsSince(since.Truncate(time.Second))
+		}
+		items := mergeTimeline(events, published, limit)
+		writeJSON(w, http.StatusOK, map[string]any{"count": len(items), "items": items})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func timelineKeys(items []timelineEntry) string {
+	keys := make([]string, len(items))
+	for i, it := range items {
+		if it.Type == "sse" {
+			keys[i] = "sse:" + it.SSE.Event
+		} else {
+			keys[i] = "audit:" + it.Audit.EventID
+		}
+	}
+	return strings.Join(keys, ",")
+}
+
+func TestMergeTimelineInterleavesAndBreaksTies(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := base
+	hub := newSSEHub(16)
+	hub.now = func() time.Time { return now }
+	store := newAuditStore(16)
+
+	store.add(auditEventAt(1, base))
+	now = base.Add(1500 * time.Millisecond) // same second as audit 2 and 3
+	hub.publish("a", map[string]int{"n": 1})
+	store.add(auditEventAt(2, base.Add(time.Second)))
+	hub.publish("b", map[string]int{"n": 2})
+	store.add(auditEventAt(3, base.Add(time.Second)))
+	now = base.Add(3 * time.Second)
+	hub.publish("c", map[string]int{"n": 3})
+	store.add(auditEventAt(4, base.Add(2*time.Second)))
+
+	events := store.list(auditFilter{Limit: 10, Direction: "asc"})
+	got := timelineKeys(mergeTimeline(events, hub.eventsSince(time.Time{}), 0))
+	want := "audit:1,sse:a,sse:b,audit:2,audit:3,audit:4,sse:c"
+	if got != want {
+		t.Fatalf("merged %s, want %s", got, want)
+	}
+	// The same inputs always merge the same way.
+	for i := 0; i < 5; i++ {
+		if again := timelineKeys(mergeTimeline(events, hub.eventsSince(time.Time{}), 0)); again != want {
+			t.Fatalf("unstable merge %s", again)
+		}
+	}
+	if got := timelineKeys(mergeTimeline(events, hub.eventsSince(time.Time{}), 3)); got != "audit:1,sse:a,sse:b" {
+		t.Fatalf("limited merge %s", got)
+	}
+}
+
+func TestAuditTimelineHandler(t *testing.T) {
+	base := time.Now().UTC().Truncate(time.Second).Add(-time.Minute)
+	now := base
+	hub := newSSEHub(16)
+	hub.now = func() time.Time { return now }
+	store := newAuditStore(16)
+	store.add(auditEventAt(1, base))
+	now = base.Add(10 * time.Second)
+	hub.publish("route_updated", map[string]string{"service": "aggregator"})
+	store.add(auditEventAt(2, base.Add(20*time.Second)))
+
+	h := newAuditTimelineHandler(store, hub)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+	rec := get("/api/audit/v0/timeline?since=" + base.Add(5*time.Second).Format(time.RFC3339))
+	var body struct {
+		Count int             `json:"count"`
+		Items []timelineEntry `json:"items"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("%d %s", rec.Code, rec.Body.String())
+	}
+	if body.Count != 2 || timelineKeys(body.Items) != "sse:route_updated,audit:2" {
+		t.Fatalf("unexpected %s", rec.Body.String())
+	}
+	if sse := body.Items[0].SSE; sse.ID != 1 || string(sse.Data) != `{"service":"aggregator"}` {
+		t.Fatalf("sse entry %+v", sse)
+	}
+	if rec := get("/api/audit/v0/timeline?since=yesterday"); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid_since") {
+		t.Fatalf("bad since: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAuditEventRecordsPublishedSSEIDs(t *testing.T) {
+	hub := newSSEHub(16)
+	hub.publish("earlier", map[string]int{})
+	store := newAuditStore(16)
+	h := withLogging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		noteSSEEvent(r.Context(), hub.publish("route_updated", map[string]int{}))
+		w.WriteHeader(http.StatusOK)
+	}), store)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/api/gateway/admin/routes", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/api/gateway/admin/routes", nil))
+
+	events := store.list(auditFilter{Limit: 10, Direction: "asc"})
+	if len(events) != 2 || len(events[0].SSEEventIDs) != 1 || events[0].SSEEventIDs[0] != 2 || events[1].SSEEventIDs[0] != 3 {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
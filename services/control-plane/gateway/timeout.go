@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Request deadlines ---
+
+const (
+	requestTimeoutHeader = "X-Request-Timeout"
+
+	defaultRequestTimeoutMax = 5 * time.Minute
+
+	// requestTimeoutGrace leaves room to write the 504 after the deadline.
+	requestTimeoutGrace = 2 * time.Second
+)
+
+// streamingPaths are long-lived SSE routes. They, and WebSocket upgrades, are
+// exempt from the server WriteTimeout unless the client asks for a deadline
+// itself.
+var streamingPaths = map[string]struct{}{
+	"/api/events":         {},
+	"/api/results/stream": {},
+	"/api/live/stream":    {},
+	"/api/crypto/stream":  {},
+}
+
+// parseRequestTimeout accepts a Go duration ("90s", "2m") or whole seconds ("90").
+func parseRequestTimeout(v string) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if n, err := strconv.Atoi(v); err == nil {
+		if n <= 0 {
+			return 0, false
+		}
+		return time.Duration(n) * time.Second, true
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+// withRequestTimeout honors X-Request-Timeout (capped by max) as the context
+// deadline for the request, so proxied calls and internal fetches that use
+// r.Context() stop together. A 5xx written after the deadline passed is
+// replaced by a structured 504.
+func withRequestTimeout(max time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rc := http.NewResponseController(w)
+			raw := r.Header.Get(requestTimeoutHeader)
+			if strings.TrimSpace(raw) == "" {
+				if _, ok := streamingPaths[r.URL.Path]; ok || isWebSocketUpgrade(r) {
+					_ = rc.SetWriteDeadline(time.Time{})
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			d, ok := parseRequestTimeout(raw)
+			if !ok {
+				writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_request_timeout"})
+				return
+			}
+			if max > 0 && d > max {
+				d = max
+			}
+			w.Header().Set(requestTimeoutHeader, d.String())
+
+			// Extend the connection write deadline past the server-wide
+			// WriteTimeout so the client's budget is what applies.
+			_ = rc.SetWriteDeadline(time.Now().Add(d + requestTimeoutGrace))
+
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			tw := &timeoutWriter{ResponseWriter: w, ctx: ctx, timeout: d, requestID: strings.TrimSpace(r.Header.Get("X-Request-ID"))}
+			next.ServeHTTP(tw, r.WithContext(ctx))
+			if !tw.wroteHeader && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				tw.WriteHeader(http.StatusGatewayTimeout)
+			}
+		})
+	}
+}
+
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	timeout     time.Duration
+	requestID   string
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	if tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	if code >= 500 && errors.Is(tw.ctx.Err(), context.DeadlineExceeded) {
+		tw.timedOut = true
+		tw.Header().Del("Content-Length")
+		writeJSON(tw.ResponseWriter, http.StatusGatewayTimeout, map[string]any{
+			"error":      "request_timeout",
+			"timeout_ms": tw.timeout.Milliseconds(),
+			"request_id": tw.requestID,
+		})
+		return
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if tw.timedOut {
+		return len(b), nil
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+func (tw *timeoutWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter { return tw.ResponseWriter }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequestTimeoutHeader(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			_, _ = w.Write([]byte("{\"id\":\"r1\"}\n"))
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/results/export", stripPrefixProxy("/api", mustProxy(upstream.URL, defaultUpstreamTimeout)))
+	mux.HandleFunc("/api/internal", func(w http.ResponseWriter, r *http.Request) {
+		rows, err := fetchAggregatorResults(r.Context(), upstream.URL, "p1", 10)
+		if err != nil {
+			writeJSON(w, http.StatusBadGateway, map[string]any{"error": "upstream_error"})
+			return
+		}
+		writeJSON(w, http.StatusOK, rows)
+	})
+
+	cases := []struct {
+		name    string
+		path    string
+		header  string
+		max     time.Duration
+		status  int
+		applied string
+	}{
+		{"no header uses no deadline", "/api/results/export", "", time.Minute, http.StatusOK, ""},
+		{"generous budget", "/api/results/export", "2s", time.Minute, http.StatusOK, "2s"},
+		{"short budget on proxy", "/api/results/export", "0.05s", time.Minute, http.StatusGatewayTimeout, "50ms"},
+		{"short budget on internal fetch", "/api/internal", "50ms", time.Minute, http.StatusGatewayTimeout, "50ms"},
+		{"capped by maximum", "/api/results/export", "60", 50 * time.Millisecond, http.StatusGatewayTimeout, "50ms"},
+		{"invalid value", "/api/results/export", "soon", time.Minute, http.StatusBadRequest, ""},
+		{"non-positive value", "/api/results/export", "0", time.Minute, http.StatusBadRequest, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := withRequestTimeout(tc.max)(mux)
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.header != "" {
+				req.Header.Set(requestTimeoutHeader, tc.header)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			if rr.Code != tc.status {
+				t.Fatalf("status=%d want %d body=%s", rr.Code, tc.status, rr.Body.String())
+			}
+			if got := rr.Header().Get(requestTimeoutHeader); got != tc.applied {
+				t.Fatalf("applied timeout=%q want %q", got, tc.applied)
+			}
+			if tc.status == http.StatusGatewayTimeout {
+				var body map[string]any
+				if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+					t.Fatalf("504 body is not JSON: %q", rr.Body.String())
+				}
+				if body["error"] != "request_timeout" || body["timeout_ms"] != float64(50) {
+					t.Fatalf("unexpected 504 body: %v", body)
+				}
+			}
+		})
+	}
+}
+
+func TestUpstreamTimeoutPerService(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(500 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fast.Close()
+
+	slowProxy := mustProxy(slow.URL, 100*time.Millisecond)
+	fastProxy := mustProxy(fast.URL, 100*time.Millisecond)
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	slowProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/analytics/x", nil))
+	var body map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &body)
+	if rec.Code != http.StatusGatewayTimeout || body["error"] != "upstream_timeout" {
+		t.Fatalf("slow upstream: %d %s", rec.Code, rec.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Fatalf("timeout should fire after ~100ms, took %s", elapsed)
+	}
+
+	rec = httptest.NewRecorder()
+	fastProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("fast upstream: %d", rec.Code)
+	}
+
+	t.Setenv("ANALYTICS_TIMEOUT", "3")
+	if got := upstreamTimeout("ANALYTICS_TIMEOUT"); got != 3*time.Second {
+		t.Fatalf("ANALYTICS_TIMEOUT=3: got %s", got)
+	}
+	t.Setenv("ANALYTICS_TIMEOUT", "0")
+	if got := upstreamTimeout("ANALYTICS_TIMEOUT"); got != defaultUpstreamTimeout {
+		t.Fatalf("ANALYTICS_TIMEOUT=0 should fall back to the default, got %s", got)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// --- Trace context (W3C traceparent) ---
+
+const ctxTrace ctxKey = "trace"
+
+const traceFlagSampled = 0x01
+
+// traceContext is the gateway's hop in a W3C trace: the caller's trace id and
+// flags, and a span id of our own that upstreams see as their parent.
+type traceContext struct {
+	TraceID string
+	SpanID  string
+	Flags   byte
+	State   string // tracestate, passed through untouched
+}
+
+func (tc traceContext) sampled() bool { return tc.Flags&traceFlagSampled != 0 }
+
+// traceparent formats the header sent to upstreams.
+func (tc traceContext) traceparent() string {
+	return "00-" + tc.TraceID + "-" + tc.SpanID + "-" + hex.EncodeToString([]byte{tc.Flags})
+}
+
+// parseTraceparent reads "00-<32 hex trace id>-<16 hex parent id>-<2 hex
+// flags>". Later versions may append fields, which are ignored; version ff
+// and all-zero ids are invalid.
+func parseTraceparent(v string) (traceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 {
+		return traceContext{}, false
+	}
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+	if !isLowerHex(version, 2) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return traceContext{}, false
+	}
+	if !isLowerHex(traceID, 32) || traceID == strings.Repeat("0", 32) {
+		return traceContext{}, false
+	}
+	if !isLowerHex(parentID, 16) || parentID == strings.Repeat("0", 16) {
+		return traceContext{}, false
+	}
+	if !isLowerHex(flags, 2) {
+		return traceContext{}, false
+	}
+	b, _ := hex.DecodeString(flags)
+	return traceContext{TraceID: traceID, SpanID: parentID, Flags: b[0]}, true
+}
+
+func isLowerHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func randomTraceID(n int) string {
+	b := make([]byte, n)
+	for {
+		_, _ = rand.Read(b)
+		for _, c := range b {
+			if c != 0 {
+				return hex.EncodeToString(b)
+			}
+		}
+	}
+}
+
+// withTrace continues the caller's trace from its traceparent header, or
+// starts a new sampled one, and gives this hop a fresh span id. The incoming
+// flags are kept, so a caller that did not sample is not sampled upstream
+// either. The rewritten traceparent replaces the caller's on the request, so
+// proxied calls carry it like X-Request-ID.
+func withTrace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tc, ok := parseTraceparent(r.Header.Get("traceparent"))
+		if ok {
+			tc.State = strings.TrimSpace(r.Header.Get("tracestate"))
+		} else {
+			tc = traceContext{TraceID: randomTraceID(16), Flags: traceFlagSampled}
+			r.Header.Del("tracestate")
+		}
+		tc.SpanID = randomTraceID(8)
+		r.Header.Set("traceparent", tc.traceparent())
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxTrace, tc)))
+	})
+}
+
+func traceFromContext(ctx context.Context) (traceContext, bool) {
+	tc, ok := ctx.Value(ctxTrace).(traceContext)
+	return tc, ok
+}
+
+// injectTrace copies the request's trace context onto an outbound request
+// built from the same context. Background work has none and is left alone.
+func injectTrace(req *http.Request) {
+	tc, ok := traceFromContext(req.Context())
+	if !ok {
+		return
+	}
+	req.Header.Set("traceparent", tc.traceparent())
+	if tc.State != "" {
+		req.Header.Set("tracestate", tc.State)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	cases := []struct {
+		in string
+		ok bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		if _, ok := parseTraceparent(c.in); ok != c.ok {
+			t.Errorf("parseTraceparent(%q) ok = %v, want %v", c.in, ok, c.ok)
+		}
+	}
+}
+
+// traceUpstream records the traceparent of every request it serves.
+func traceUpstream(t *testing.T) (*httptest.Server, chan string) {
+	t.Helper()
+	seen := make(chan string, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r.Header.Get("traceparent")
+		writeJSON(w, http.StatusOK, []map[string]any{})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, seen
+}
+
+func TestTraceparentSurvivesProxy(t *testing.T) {
+	up, seen := traceUpstream(t)
+	h := withTrace(mustProxy(up.URL, 5*time.Second))
+
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"
+	req := httptest.NewRequest(http.MethodGet, "/api/profiles", nil)
+	req.Header.Set("traceparent", incoming)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	got, ok := parseTraceparent(<-seen)
+	if !ok {
+		t.Fatal("upstream got no valid traceparent")
+	}
+	if got.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("trace id changed: %s", got.TraceID)
+	}
+	if got.SpanID == "00f067aa0ba902b7" {
+		t.Fatal("gateway should send its own span id as the parent")
+	}
+	if got.sampled() {
+		t.Fatal("an unsampled trace must stay unsampled")
+	}
+}
+
+func TestTraceparentOnManualFetch(t *testing.T) {
+	up, seen := traceUpstream(t)
+	var trace traceContext
+	h := withTrace(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace, _ = traceFromContext(r.Context())
+		fetchProfilesCount(r.Context(), up.URL)
+		upOrDownDetailed(r.Context(), up.URL+"/health")
+	}))
+
+	// No incoming header: a new sampled trace is started.
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/summary", nil))
+	if trace.TraceID == "" || !trace.sampled() {
+		t.Fatalf("expected a new sampled trace, got %+v", trace)
+	}
+	for i := 0; i < 2; i++ {
+		got := <-seen
+		if got != trace.traceparent() || !strings.HasSuffix(got, "-01") {
+			t.Fatalf("fetch %d: traceparent %q, want %q", i, got, trace.traceparent())
+		}
+	}
+
+	// Without a request context the fetch carries no trace.
+	fetchProfilesCount(context.Background(), up.URL)
+	if got := <-seen; got != "" {
+		t.Fatalf("background fetch should not invent a trace, got %q", got)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Audit webhooks ---
+
+const (
+	webhookSignatureHeader = "X-Chartly-Signature"
+	webhookEventHeader     = "X-Chartly-Event"
+)
+
+var severityRank = map[string]int{
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+type webhookConfig struct {
+	URL         string
+	Secret      string
+	MinSeverity string
+	Categories  map[string]struct{}
+	MaxAttempts int
+	Backoff     time.Duration
+	Workers     int
+	QueueSize   int
+	DLQSize     int
+	Timeout     time.Duration
+}
+
+type webhookDLQEntry struct {
+	Event     auditEvent `json:"event"`
+	Attempts  int        `json:"attempts"`
+	LastError string     `json:"last_error"`
+	FailedAt  string     `json:"failed_at"`
+}
+
+type webhookDispatcher struct {
+	cfg    webhookConfig
+	client *http.Client
+	queue  chan auditEvent
+
+	mu        sync.Mutex
+	dlq       []webhookDLQEntry
+	delivered int64
+	dropped   int64
+}
+
+func loadWebhookConfig() webhookConfig {
+	return webhookConfig{
+		URL:         strings.TrimSpace(os.Getenv("AUDIT_WEBHOOK_URL")),
+		Secret:      strings.TrimSpace(os.Getenv("AUDIT_WEBHOOK_SECRET")),
+		MinSeverity: strings.ToLower(envOr("AUDIT_WEBHOOK_MIN_SEVERITY", "high")),
+		Categories:  csvSet(os.Getenv("AUDIT_WEBHOOK_CATEGORIES")),
+		MaxAttempts: envInt("AUDIT_WEBHOOK_MAX_ATTEMPTS", 5),
+		Backoff:     time.Duration(envInt("AUDIT_WEBHOOK_BACKOFF_MS", 500)) * time.Millisecond,
+		Workers:     envInt("AUDIT_WEBHOOK_WORKERS", 4),
+		QueueSize:   envInt("AUDIT_WEBHOOK_QUEUE_SIZE", 256),
+		DLQSize:     envInt("AUDIT_WEBHOOK_DLQ_SIZE", 100),
+		Timeout:     5 * time.Second,
+	}
+}
+
+// newWebhookDispatcher returns nil, disabling webhooks, without a URL or
+// without a secret: an HMAC over an empty key would look authenticated while
+// anyone could forge it.
+func newWebhookDispatcher(cfg webhookConfig) *webhookDispatcher {
+	if cfg.URL == "" {
+		return nil
+	}
+	if cfg.Secret == "" {
+		slog.Error("audit_webhook_disabled", "reason", "AUDIT_WEBHOOK_SECRET is required with AUDIT_WEBHOOK_URL")
+		return nil
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = 500 * time.Millisecond
+	}
+	if cfg.Workers < 1 {
+		cfg.Workers = 4
+	}
+	if cfg.QueueSize < 1 {
+		cfg.QueueSize = 256
+	}
+	if cfg.DLQSize < 1 {
+		cfg.DLQSize = 100
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if _, ok := severityRank[cfg.MinSeverity]; !ok {
+		cfg.MinSeverity = "high"
+	}
+	return &webhookDispatcher{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		queue:  make(chan auditEvent, cfg.QueueSize),
+	}
+}
+
+// start runs cfg.Workers delivery loops, so one event waiting out its retry
+// backoff does not hold up the rest of the queue.
+func (d *webhookDispatcher) start(ctx context.Context) {
+	if d == nil {
+		return
+	}
+	for i := 0; i < d.cfg.Workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case ev := <-d.queue:
+					d.deliver(ctx, ev)
+				}
+			}
+		}()
+	}
+}
+
+// matches reports whether an audit event passes the severity/category filter.
+func (d *webhookDispatcher) matches(ev auditEvent) bool {
+	if ev.Severity == "" || severityRank[ev.Severity] < severityRank[d.cfg.MinSeverity] {
+		return false
+	}
+	if len(d.cfg.Categories) > 0 {
+		if _, ok := d.cfg.Categories[ev.Category]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// notify enqueues a matching event without blocking the caller; a full queue
+// sends the event straight to the dead-letter queue.
+func (d *webhookDispatcher) notify(ev auditEvent) {
+	if d == nil || !d.matches(ev) {
+		return
+	}
+	select {
+	case d.queue <- ev:
+	default:
+		d.mu.Lock()
+		d.dropped++
+		d.mu.Unlock()
+		d.deadLetter(ev, 0, "queue_full")
+	}
+}
+
+func (d *webhookDispatcher) deliver(ctx context.Context, ev auditEvent) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		d.deadLetter(ev, 0, "marshal_failed")
+		return
+	}
+	var lastErr string
+	for attempt := 1; attempt <= d.cfg.MaxAttempts; attempt++ {
+		err := d.post(ctx, ev, body)
+		if err == nil {
+			d.mu.Lock()
+			d.delivered++
+			d.mu.Unlock()
+			return
+		}
+		lastErr = err.Error()
+		if attempt == d.cfg.MaxAttempts {
+			break
+		}
+		wait := d.cfg.Backoff << (attempt - 1)
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			d.deadLetter(ev, attempt, "shutdown")
+			return
+		case <-t.C:
+		}
+	}
+	slog.Warn("audit_webhook_failed", "event_id", ev.EventID, "attempts", d.cfg.MaxAttempts, "err", lastErr)
+	d.deadLetter(ev, d.cfg.MaxAttempts, lastErr)
+}
+
+func (d *webhookDispatcher) post(ctx context.Context, ev auditEvent, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, ev.Category)
+	req.Header.Set(webhookSignatureHeader, "sha256="+signWebhookBody(d.cfg.Secret, body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("non_2xx: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (d *webhookDispatcher) deadLetter(ev auditEvent, attempts int, errMsg string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dlq = append(d.dlq, webhookDLQEntry{
+		Event:     ev,
+		Attempts:  attempts,
+		LastError: errMsg,
+		FailedAt:  time.Now().UTC().Format(time.RFC3339),
+	})
+	if len(d.dlq) > d.cfg.DLQSize {
+		d.dlq = d.dlq[len(d.dlq)-d.cfg.DLQSize:]
+	}
+}
+
+func (d *webhookDispatcher) snapshot() map[string]any {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	items := make([]webhookDLQEntry, len(d.dlq))
+	copy(items, d.dlq)
+	return map[string]any{
+		"url":          redactURL(d.cfg.URL),
+		"min_severity": d.cfg.MinSeverity,
+		"delivered":    d.delivered,
+		"dropped":      d.dropped,
+		"count":        len(items),
+		"dead_letters": items,
+	}
+}
+
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// classifyAuditEvent assigns a security category and severity to request
+// outcomes that should be pushed to external consumers.
+func classifyAuditEvent(status int) (string, string) {
+	switch {
+	case status == http.StatusUnauthorized:
+		return "auth_failure", "high"
+	case status == http.StatusForbidden:
+		return "access_denied", "high"
+	case status == http.StatusTooManyRequests:
+		return "rate_limited", "medium"
+	case status >= 500:
+		return "server_error", "low"
+	}
+	return "", ""
+}
+
+func redactURL(raw string) string {
+	if i := strings.Index(raw, "?"); i >= 0 {
+		return raw[:i]
+	}
+	return raw
+}
+
+func csvSet(v string) map[string]struct{} {
+	out := make(map[string]struct{})
+	for _, s := range splitCSV(v) {
+		out[strings.ToLower(s)] = struct{}{}
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookDeliverySignature(t *testing.T) {
+	got := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		want := "sha256=" + signWebhookBody("s3cret", body)
+		if r.Header.Get(webhookSignatureHeader) != want {
+			t.Errorf("signature mismatch: got %q want %q", r.Header.Get(webhookSignatureHeader), want)
+		}
+		got <- r.Header.Get(webhookEventHeader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	d := newWebhookDispatcher(webhookConfig{URL: srv.URL, Secret: "s3cret", MinSeverity: "high", MaxAttempts: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.start(ctx)
+
+	d.notify(auditEvent{EventID: "1", Category: "rate_limited", Severity: "medium"})
+	d.notify(auditEvent{EventID: "2", Category: "auth_failure", Severity: "high"})
+
+	select {
+	case cat := <-got:
+		if cat != "auth_failure" {
+			t.Fatalf("expected only the high severity event, got %q", cat)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+}
+
+func TestWebhookRetriesThenDeadLetters(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	d := newWebhookDispatcher(webhookConfig{URL: srv.URL, Secret: "k", MaxAttempts: 3, Backoff: time.Millisecond})
+	d.deliver(context.Background(), auditEvent{EventID: "ok", Category: "auth_failure", Severity: "high"})
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Fatalf("expected 3 attempts, got %d", n)
+	}
+	if snap := d.snapshot(); snap["delivered"].(int64) != 1 || snap["count"].(int) != 0 {
+		t.Fatalf("unexpected snapshot after recovery: %v", snap)
+	}
+
+	atomic.StoreInt32(&calls, -10)
+	d.deliver(context.Background(), auditEvent{EventID: "dead", Category: "auth_failure", Severity: "high"})
+	snap := d.snapshot()
+	dlq := snap["dead_letters"].([]webhookDLQEntry)
+	if len(dlq) != 1 || dlq[0].Event.EventID != "dead" || dlq[0].Attempts != 3 {
+		t.Fatalf("expected dead-lettered event after exhausting retries, got %+v", dlq)
+	}
+}
+
+func TestWebhookRequiresSecret(t *testing.T) {
+	if d := newWebhookDispatcher(webhookConfig{URL: "http://hooks.example"}); d != nil {
+		t.Fatal("a dispatcher without a secret would send forgeable signatures")
+	}
+}
+
+// TestWebhookRetryDoesNotBlockQueue checks that an event in retry backoff
+// leaves the other workers free to deliver.
+func TestWebhookRetryDoesNotBlockQueue(t *testing.T) {
+	delivered := make(chan string, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"slow"`) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		delivered <- string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	d := newWebhookDispatcher(webhookConfig{URL: srv.URL, Secret: "k", MaxAttempts: 2, Backoff: time.Hour, Workers: 2})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.start(ctx)
+
+	d.notify(auditEvent{EventID: "slow", Category: "auth_failure", Severity: "high"})
+	d.notify(auditEvent{EventID: "fast", Category: "auth_failure", Severity: "high"})
+	select {
+	case <-delivered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("event stuck behind another event's retry backoff")
+	}
+}
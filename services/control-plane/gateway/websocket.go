@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// --- WebSocket proxy ---
+
+// isWebSocketUpgrade reports whether r asks to switch to the WebSocket
+// protocol (RFC 6455 section 4.1).
+func isWebSocketUpgrade(r *http.Request) bool {
+	if !strings.EqualFold(strings.TrimSpace(r.Header.Get("Upgrade")), "websocket") {
+		return false
+	}
+	for _, v := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// proxyWebSocket tunnels a WebSocket handshake to upstream with the /api
+// prefix stripped. ReverseProxy does the upgrade itself: once the upstream
+// answers 101 it hijacks the client connection and copies bytes both ways,
+// so ping/pong and close frames pass through untouched. A refused handshake
+// reaches the client as the upstream's plain HTTP answer, and a failed one
+// as the proxy's 502. Auth runs before this handler like on any other route.
+func proxyWebSocket(upstream http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		if !isWebSocketUpgrade(r) {
+			w.Header().Set("Upgrade", "websocket")
+			w.Header().Set("Connection", "Upgrade")
+			writeJSON(w, http.StatusUpgradeRequired, map[string]any{"error": "websocket_upgrade_required"})
+			return
+		}
+		if strings.TrimSpace(r.Header.Get("Sec-WebSocket-Key")) == "" || strings.TrimSpace(r.Header.Get("Sec-WebSocket-Version")) != "13" {
+			w.Header().Set("Sec-WebSocket-Version", "13")
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_websocket_handshake"})
+			return
+		}
+		stripPrefixProxy("/api", upstream).ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsEchoUpstream completes WebSocket handshakes on /runs/{id}/stream and
+// echoes raw frames back; other paths answer 404.
+func wsEchoUpstream(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/runs/") || !strings.HasSuffix(r.URL.Path, "/stream") || !isWebSocketUpgrade(r) {
+			http.NotFound(w, r)
+			return
+		}
+		sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+		brw.Flush()
+		buf := make([]byte, 64)
+		for {
+			n, err := brw.Read(buf)
+			if err != nil {
+				return
+			}
+			conn.Write(buf[:n])
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// wsDial sends a handshake for path and returns the connection and the
+// status line of the reply.
+func wsDial(t *testing.T, addr, path string, hdr map[string]string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	req := "GET " + path + " HTTP/1.1\r\nHost: gw\r\n"
+	for k, v := range hdr {
+		req += k + ": " + v + "\r\n"
+	}
+	if _, err := io.WriteString(conn, req+"\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, br, resp
+}
+
+func TestProxyWebSocket(t *testing.T) {
+	up := wsEchoUpstream(t)
+	cfg := &authConfig{Enabled: true, APIKeys: parseKeySet("k"), TenantHeader: "X-Tenant-ID", AllowAnonymous: parseAnonymousPaths(nil)}
+	mux := http.NewServeMux()
+	mux.Handle("/api/runs/{id}/stream", proxyWebSocket(mustProxy(up.URL, 5*time.Second)))
+	gw := httptest.NewServer(withRequestID(withLogging(withGzip(0)(withRequestTimeout(time.Minute)(withAuth(cfg)(mux))), nil)))
+	defer gw.Close()
+	addr := strings.TrimPrefix(gw.URL, "http://")
+	handshake := map[string]string{
+		"Upgrade":               "websocket",
+		"Connection":            "Upgrade",
+		"Sec-WebSocket-Key":     "dGhlIHNhbXBsZSBub25jZQ==",
+		"Sec-WebSocket-Version": "13",
+		"X-API-Key":             "k",
+	}
+
+	conn, br, resp := wsDial(t, addr, "/api/runs/r1/stream", handshake)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Sec-WebSocket-Accept = %q", got)
+	}
+	// A masked ping frame with payload "hi" comes back byte for byte.
+	ping := []byte{0x89, 0x82, 1, 2, 3, 4, 'h' ^ 1, 'i' ^ 2}
+	if _, err := conn.Write(ping); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len(ping))
+	if _, err := io.ReadFull(br, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(ping) {
+		t.Fatalf("frame changed in transit: %v", got)
+	}
+
+	noKey := map[string]string{}
+	for k, v := range handshake {
+		if k != "X-API-Key" {
+			noKey[k] = v
+		}
+	}
+	if _, _, resp := wsDial(t, addr, "/api/runs/r1/stream", noKey); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("without credentials: expected 401 before the upgrade, got %d", resp.StatusCode)
+	}
+	if _, _, resp := wsDial(t, addr, "/api/runs/r1/stream", map[string]string{"X-API-Key": "k"}); resp.StatusCode != http.StatusUpgradeRequired {
+		t.Fatalf("plain GET: expected 426, got %d", resp.StatusCode)
+	}
+	bad := map[string]string{}
+	for k, v := range handshake {
+		bad[k] = v
+	}
+	bad["Sec-WebSocket-Version"] = "8"
+	if _, _, resp := wsDial(t, addr, "/api/runs/r1/stream", bad); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("old protocol version: expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestProxyWebSocketUpstreamRefuses(t *testing.T) {
+	up := httptest.NewServer(http.NotFoundHandler())
+	defer up.Close()
+	h := proxyWebSocket(mustProxy(up.URL, 5*time.Second))
+	req := httptest.NewRequest(http.MethodGet, "/api/runs/r1/stream", nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected the upstream's 404, got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// --- Batch operations ---
+
+// maxBatchProfiles bounds one /profiles:batch call.
+const maxBatchProfiles = 500
+
+const (
+	batchPause       = "pause"
+	batchResume      = "resume"
+	batchSetSchedule = "setSchedule"
+)
+
+// normalizeTags lower-cases and de-duplicates the tags of a profile.
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	var out []string
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// hasTag reports whether p carries tag, which must already be lower case.
+func (p Profile) hasTag(tag string) bool {
+	for _, t := range p.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+type batchRequest struct {
+	IDs      []string            `json:"ids,omitempty"`
+	Tag      string              `json:"tag,omitempty"`
+	Action   string              `json:"action"`
+	Schedule *setScheduleRequest `json:"schedule,omitempty"`
+}
+
+// batchResult is the outcome for one profile. Status is what the single
+// profile endpoint would have answered ("paused", "resumed", "updated") or
+// "error".
+type batchResult struct {
+	ID         string              `json:"id"`
+	Status     string              `json:"status"`
+	Error      string              `json:"error,omitempty"`
+	Violations []overrideViolation `json:"violations,omitempty"`
+}
+
+func newBatchID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// handleProfilesBatch pauses, resumes or reschedules several profiles in one
+// call. Profiles are selected by ids or by tag. Each profile is updated on
+// its own: one that is unknown or whose merged schedule is invalid is
+// reported in its result and does not stop the others.
+func (s *store) handleProfilesBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !s.requireAPIKey(w, r) {
+		return
+	}
+
+	body, berr := io.ReadAll(io.LimitReader(r.Body, 2<<20))
+	if berr != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_body"})
+		return
+	}
+	defer r.Body.Close()
+
+	var req batchRequest
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_json"})
+		return
+	}
+	switch req.Action {
+	case batchPause, batchResume:
+	case batchSetSchedule:
+		if req.Schedule == nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "missing_schedule"})
+			return
+		}
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_action", "actions": []string{batchPause, batchResume, batchSetSchedule}})
+		return
+	}
+	tag := strings.ToLower(strings.TrimSpace(req.Tag))
+	if (len(req.IDs) == 0) == (tag == "") {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_selector", "message": "give either ids or tag"})
+		return
+	}
+
+	ids := s.batchTargets(req.IDs, tag)
+	if len(ids) > maxBatchProfiles {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "too_many_profiles", "max": maxBatchProfiles})
+		return
+	}
+
+	batchID := newBatchID()
+	results := make([]batchResult, 0, len(ids))
+	failed := 0
+	for _, id := range ids {
+		res := s.applyBatchAction(id, req)
+		if res.Status == "error" {
+			failed++
+		}
+		slog.Info("audit", "event", "profile_"+req.Action, "batch_id", batchID, "id", id, "status", res.Status, "error", res.Error)
+		results = append(results, res)
+	}
+	slog.Info("audit", "event", "profiles_batch", "batch_id", batchID, "action", req.Action, "tag", tag,
+		"count", len(results), "succeeded", len(results)-failed, "failed", failed)
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"batch_id":  batchID,
+		"action":    req.Action,
+		"count":     len(results),
+		"succeeded": len(results) - failed,
+		"failed":    failed,
+		"results":   results,
+	})
+}
+
+// batchTargets resolves the selector to profile ids: the given ids
+// (trimmed, de-duplicated, in request order) or every profile with tag,
+// sorted.
+func (s *store) batchTargets(ids []string, tag string) []string {
+	if tag == "" {
+		seen := make(map[string]bool, len(ids))
+		out := make([]string, 0, len(ids))
+		for _, id := range ids {
+			id = strings.TrimSpace(id)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			out = append(out, id)
+		}
+		return out
+	}
+	var out []string
+	for id, p := range s.profiles.load() {
+		if p.hasTag(tag) {
+			out = append(out, id)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// applyBatchAction updates one profile's overrides. Unlike the single
+// profile endpoints, which replace the override file, it changes only the
+// fields the action names, so pausing and resuming keeps a schedule.
+func (s *store) applyBatchAction(id string, req batchRequest) batchResult {
+	if !safeIDRe.MatchString(id) {
+		return batchResult{ID: id, Status: "error", Error: "invalid_id"}
+	}
+	if _, ok := s.profile(id); !ok {
+		return batchResult{ID: id, Status: "error", Error: "not_found"}
+	}
+
+	s.overridesMu.Lock()
+	defer s.overridesMu.Unlock()
+	o, err := s.readOverrides(id)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		// An unreadable or invalid file is already being ignored; start over.
+		o = Overrides{}
+	}
+
+	status := "updated"
+	switch req.Action {
+	case batchPause:
+		o.Enabled, status = boolPtr(false), "paused"
+	case batchResume:
+		o.Enabled, status = boolPtr(true), "resumed"
+	case batchSetSchedule:
+		sch := req.Schedule
+		if sch.Enabled != nil {
+			o.Enabled = sch.Enabled
+		}
+		if v := strings.TrimSpace(sch.Interval); v != "" {
+			o.Interval = v
+		}
+		if v := strings.TrimSpace(sch.Jitter); v != "" {
+			o.Jitter = v
+		}
+		if sch.Limits != nil {
+			o.MaxRecords = sch.Limits.MaxRecords
+			o.MaxPages = sch.Limits.MaxPages
+			o.MaxBytes = sch.Limits.MaxBytes
+		}
+		if violations := validateOverrides(o); len(violations) > 0 {
+			return batchResult{ID: id, Status: "error", Error: "invalid_overrides", Violations: violations}
+		}
+	}
+
+	if err := s.writeOverrides(id, o); err != nil {
+		return batchResult{ID: id, Status: "error", Error: "write_failed"}
+	}
+	s.reloadProfile(id)
+	return batchResult{ID: id, Status: status}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newBatchTestStore loads profiles from YAML so tags are parsed as in
+// production.
+func newBatchTestStore(t *testing.T, docs map[string]string) *store {
+	t.Helper()
+	t.Setenv("REGISTRY_API_KEY", "k")
+	s := newTestStore("")
+	s.profilesDir = t.TempDir()
+	for id, extra := range docs {
+		doc := "id: " + id + "\nname: " + id + "\nversion: \"1\"\n" + extra
+		if err := os.WriteFile(filepath.Join(s.profilesDir, id+".yaml"), []byte(doc), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.loadAll(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func postBatch(t *testing.T, s *store, body string) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/profiles:batch", strings.NewReader(body))
+	req.Header.Set("X-API-Key", "k")
+	rec := httptest.NewRecorder()
+	s.handleProfilesBatch(rec, req)
+	var out map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	return rec.Code, out
+}
+
+func batchStatuses(out map[string]any) map[string]string {
+	got := map[string]string{}
+	results, _ := out["results"].([]any)
+	for _, r := range results {
+		m := r.(map[string]any)
+		status, _ := m["status"].(string)
+		if e, ok := m["error"].(string); ok {
+			status += ":" + e
+		}
+		got[m["id"].(string)] = status
+	}
+	return got
+}
+
+func TestProfilesBatchMixedOutcomes(t *testing.T) {
+	s := newBatchTestStore(t, map[string]string{"alpha": "", "beta": "", "gamma": ""})
+	// beta's existing interval lets a jitter-only schedule through; alpha and
+	// gamma have none, so the same schedule is invalid for them.
+	if err := s.writeOverrides("beta", Overrides{Interval: "1h"}); err != nil {
+		t.Fatal(err)
+	}
+	s.reloadProfile("beta")
+
+	code, out := postBatch(t, s, `{"ids":["alpha","beta","missing","../etc","beta"],"action":"setSchedule","schedule":{"jitter":"10m"}}`)
+	if code != http.StatusOK {
+		t.Fatalf("status %d: %v", code, out)
+	}
+	want := map[string]string{
+		"alpha":   "error:invalid_overrides",
+		"beta":    "updated",
+		"missing": "error:not_found",
+		"../etc":  "error:invalid_id",
+	}
+	got := batchStatuses(out)
+	if len(got) != len(want) || out["succeeded"] != float64(1) || out["failed"] != float64(3) {
+		t.Fatalf("results: %v", out)
+	}
+	for id, w := range want {
+		if got[id] != w {
+			t.Errorf("%s: %s, want %s", id, got[id], w)
+		}
+	}
+	if p, _ := s.profile("beta"); p.Interval != "1h" || p.Jitter != "10m" {
+		t.Fatalf("beta schedule: %+v", p)
+	}
+
+	// Pausing and resuming keeps the schedule.
+	if code, out := postBatch(t, s, `{"ids":["beta","gamma"],"action":"pause"}`); code != http.StatusOK || out["failed"] != float64(0) {
+		t.Fatalf("pause: %d %v", code, out)
+	}
+	if p, _ := s.profile("beta"); p.Enabled == nil || *p.Enabled || p.Interval != "1h" {
+		t.Fatalf("paused beta: %+v", p)
+	}
+	postBatch(t, s, `{"ids":["beta"],"action":"resume"}`)
+	if p, _ := s.profile("beta"); p.Enabled == nil || !*p.Enabled || p.Jitter != "10m" {
+		t.Fatalf("resumed beta: %+v", p)
+	}
+	if p, _ := s.profile("gamma"); p.Enabled == nil || *p.Enabled {
+		t.Fatalf("gamma should stay paused: %+v", p)
+	}
+}
+
+func TestProfilesBatchByTag(t *testing.T) {
+	s := newBatchTestStore(t, map[string]string{
+		"fx-a":   "tags: [FX, markets]\n",
+		"fx-b":   "tags:\n  - fx\n",
+		"census": "tags: [gov]\n",
+	})
+	code, out := postBatch(t, s, `{"tag":" fx ","action":"pause"}`)
+	if code != http.StatusOK {
+		t.Fatalf("status %d: %v", code, out)
+	}
+	if got := batchStatuses(out); len(got) != 2 || got["fx-a"] != "paused" || got["fx-b"] != "paused" {
+		t.Fatalf("tag selector: %v", got)
+	}
+	if p, _ := s.profile("census"); p.Enabled != nil {
+		t.Fatalf("untagged profile touched: %+v", p)
+	}
+	if p, _ := s.profile("fx-a"); strings.Join(p.Tags, ",") != "fx,markets" {
+		t.Fatalf("tags: %v", p.Tags)
+	}
+
+	if code, out := postBatch(t, s, `{"tag":"none-such","action":"resume"}`); code != http.StatusOK || out["count"] != float64(0) {
+		t.Fatalf("empty tag match: %d %v", code, out)
+	}
+}
+
+func TestProfilesBatchRejectsBadRequests(t *testing.T) {
+	s := newBatchTestStore(t, map[string]string{"alpha": ""})
+	for body, want := range map[string]string{
+		`{"ids":["alpha"],"action":"delete"}`:             "invalid_action",
+		`{"ids":["alpha"],"action":"setSchedule"}`:        "missing_schedule",
+		`{"action":"pause"}`:                              "invalid_selector",
+		`{"ids":["alpha"],"tag":"x","action":"pause"}`:    "invalid_selector",
+		`{"ids":["alpha"],"action":"pause","extra":true}`: "invalid_json",
+	} {
+		if code, out := postBatch(t, s, body); code != http.StatusBadRequest || out["error"] != want {
+			t.Errorf("%s: %d %v, want %s", body, code, out, want)
+		}
+	}
+	ids := make([]string, maxBatchProfiles+1)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("p%d", i)
+	}
+	b, _ := json.Marshal(map[string]any{"ids": ids, "action": "pause"})
+	if code, out := postBatch(t, s, string(b)); code != http.StatusBadRequest || out["error"] != "too_many_profiles" {
+		t.Fatalf("oversized batch: %d %v", code, out)
+	}
+}
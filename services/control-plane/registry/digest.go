@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// --- Profile writes and optimistic concurrency ---
+
+// digestMismatchError means the caller's digest is not the stored one:
+// someone else changed (or removed) the profile since the caller read it.
+type digestMismatchError struct {
+	current string // "" when the profile does not exist
+}
+
+func (e *digestMismatchError) Error() string { return "digest_mismatch" }
+
+// saveOptions shape saveProfile. IfDigest, when set, must equal the stored
+// profile's digest ("*" only requires the profile to exist). Name and
+// Version are used when the YAML has none.
+type saveOptions struct {
+	IfDigest string
+	Name     string
+	Version  string
+}
+
+// saveProfile writes id's content and publishes the new profile. The digest
+// and dependency cycle checks, the file write and the in-memory update
+// happen under profileFileMu, so two writers that read the same digest
+// cannot both succeed, two writes cannot close a cycle between them, and no
+// reader of the map sees a profile the file does not hold.
+func (s *store) saveProfile(id string, content []byte, opts saveOptions) (Profile, error) {
+	s.profileFileMu.Lock()
+	defer s.profileFileMu.Unlock()
+
+	if opts.IfDigest != "" {
+		cur, ok := s.profile(id)
+		if !ok || (opts.IfDigest != "*" && cur.Digest != opts.IfDigest) {
+			return Profile{}, &digestMismatchError{current: cur.Digest}
+		}
+	}
+	meta, err := parseProfileYAML(string(content))
+	if err != nil {
+		return Profile{}, err
+	}
+	p := Profile{
+		ID:      id,
+		Name:    firstNonEmpty(strings.TrimSpace(meta.Name), opts.Name),
+		Version: firstNonEmpty(strings.TrimSpace(meta.Version), opts.Version),
+		Tags:    normalizeTags(meta.Tags),
+		Digest:  digestBytes(content),
+		Content: string(content),
+	}
+	p = s.applyOverrides(p)
+	p = withSourceInventory(p)
+	if cycle := s.depGraph().cycleThrough(id, p.DependsOn); cycle != nil {
+		return Profile{}, &cycleError{cycle: cycle}
+	}
+	if err := s.writeProfileFile(id, content); err != nil {
+		return Profile{}, err
+	}
+	s.putProfile(p)
+	s.noteProfileFile(id+".yaml", nil)
+	return p, nil
+}
+
+// writeSaveError answers a failed saveProfile: 409 for a stale digest, 422
+// for a dependency cycle, 500 otherwise.
+func writeSaveError(w http.ResponseWriter, err error) {
+	var mismatch *digestMismatchError
+	var cycle *cycleError
+	switch {
+	case errors.As(err, &mismatch):
+		writeJSON(w, http.StatusConflict, map[string]any{"error": "digest_mismatch", "current_digest": mismatch.current})
+	case errors.As(err, &cycle):
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"error": "circular_dependency", "cycle": cycle.cycle})
+	default:
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "write_failed"})
+	}
+}
+
+// requestDigest is the digest an update is conditional on: the body's
+// "digest", else the If-Match header with quotes and a W/ prefix removed.
+// Both set and different is an error.
+func requestDigest(body, ifMatch string) (string, error) {
+	body = strings.TrimSpace(body)
+	header := strings.Trim(strings.TrimPrefix(strings.TrimSpace(ifMatch), "W/"), `"`)
+	switch {
+	case body == "":
+		return header, nil
+	case header == "" || header == body:
+		return body, nil
+	}
+	return "", errors.New("conflicting_digest")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func putProfileWith(h http.Handler, body map[string]string, ifMatch string) (int, map[string]any) {
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPut, "/profiles/alpha", strings.NewReader(string(b)))
+	req.Header.Set("X-API-Key", "k")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var out map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	return rec.Code, out
+}
+
+func TestProfileUpdateChecksDigest(t *testing.T) {
+	t.Setenv("REGISTRY_API_KEY", "k")
+	s := newTestStore("")
+	s.profilesDir = t.TempDir()
+	h := historyRouter(s)
+	putVersion(t, h, "one")
+	first, _ := s.profile("alpha")
+
+	code, out := putProfileWith(h, map[string]string{"content": "id: alpha\nname: two\n", "digest": first.Digest}, "")
+	if code != http.StatusOK {
+		t.Fatalf("matching digest: %d %v", code, out)
+	}
+	second := out["digest"].(string)
+
+	code, out = putProfileWith(h, map[string]string{"content": "id: alpha\nname: stale\n", "digest": first.Digest}, "")
+	if code != http.StatusConflict || out["error"] != "digest_mismatch" || out["current_digest"] != second {
+		t.Fatalf("stale digest: %d %v", code, out)
+	}
+	if p, _ := s.profile("alpha"); p.Name != "two" {
+		t.Fatalf("stale write applied: %+v", p)
+	}
+
+	code, out = putProfileWith(h, map[string]string{"content": "id: alpha\nname: three\n"}, `W/"`+second+`"`)
+	if code != http.StatusOK || out["name"] != "three" {
+		t.Fatalf("if-match: %d %v", code, out)
+	}
+	code, out = putProfileWith(h, map[string]string{"content": "id: alpha\nname: four\n"}, `"`+second+`"`)
+	if code != http.StatusConflict || out["error"] != "digest_mismatch" {
+		t.Fatalf("stale if-match: %d %v", code, out)
+	}
+	code, out = putProfileWith(h, map[string]string{"content": "id: alpha\nname: four\n", "digest": "a"}, `"b"`)
+	if code != http.StatusBadRequest || out["error"] != "conflicting_digest" {
+		t.Fatalf("conflicting digests: %d %v", code, out)
+	}
+}
+
+func TestProfileUpdateDigestRace(t *testing.T) {
+	t.Setenv("REGISTRY_API_KEY", "k")
+	s := newTestStore("")
+	s.profilesDir = t.TempDir()
+	h := historyRouter(s)
+	putVersion(t, h, "one")
+	base, _ := s.profile("alpha")
+
+	const writers = 8
+	codes := make(chan int, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			code, _ := putProfileWith(h, map[string]string{
+				"content": "id: alpha\nname: w" + string(rune('a'+i)) + "\n",
+				"digest":  base.Digest,
+			}, "")
+			codes <- code
+		}(i)
+	}
+	wg.Wait()
+	close(codes)
+	won := 0
+	for code := range codes {
+		switch code {
+		case http.StatusOK:
+			won++
+		case http.StatusConflict:
+		default:
+			t.Fatalf("unexpected status %d", code)
+		}
+	}
+	if won != 1 {
+		t.Fatalf("%d writers succeeded with the same digest, want 1", won)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// --- Profile dependency graph ---
+
+// depGraph is the adjacency list of profile dependencies: id → the ids its
+// content references, sorted. It is rebuilt from the profile set on every
+// change and, like the set, never modified once published.
+type depGraph map[string][]string
+
+func buildDepGraph(set profileSet) depGraph {
+	g := make(depGraph, len(set))
+	for id, p := range set {
+		if len(p.DependsOn) > 0 {
+			g[id] = p.DependsOn
+		}
+	}
+	return g
+}
+
+// dependencyIDs collects the profiles a profile references: its top-level
+// depends_on list, source.profile_id, and profile_id query parameters in
+// source.url (profiles reading another profile's results). Self references
+// are dropped.
+func dependencyIDs(self string, doc sourceDoc) []string {
+	seen := make(map[string]struct{})
+	add := func(id string) {
+		id = strings.TrimSpace(id)
+		if id != "" && id != self && safeIDRe.MatchString(id) {
+			seen[id] = struct{}{}
+		}
+	}
+	for _, id := range doc.DependsOn {
+		add(id)
+	}
+	add(doc.Source.ProfileID)
+	if raw := strings.TrimSpace(doc.Source.URL); raw != "" {
+		if u, err := url.Parse(raw); err == nil {
+			for _, id := range u.Query()["profile_id"] {
+				add(id)
+			}
+		}
+	}
+	if len(seen) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(seen))
+	for id := range seen {
+		out = append(out, id)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// cycleThrough reports the cycle that giving id the dependencies deps would
+// close, as the path from id back to itself (["a", "b", "a"]), or nil.
+func (g depGraph) cycleThrough(id string, deps []string) []string {
+	visited := make(map[string]bool)
+	var path []string
+	var walk func(n string) bool
+	walk = func(n string) bool {
+		if n == id {
+			return true
+		}
+		if visited[n] {
+			return false
+		}
+		visited[n] = true
+		path = append(path, n)
+		for _, next := range g[n] {
+			if walk(next) {
+				return true
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	for _, d := range deps {
+		if walk(d) {
+			return append(append([]string{id}, path...), id)
+		}
+	}
+	return nil
+}
+
+// transitive lists every profile id depends on, directly or not, sorted.
+func (g depGraph) transitive(id string) []string {
+	seen := map[string]bool{id: true}
+	queue := append([]string(nil), g[id]...)
+	var out []string
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if seen[n] {
+			continue
+		}
+		seen[n] = true
+		out = append(out, n)
+		queue = append(queue, g[n]...)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// dependents lists the profiles that reference id directly, sorted.
+func (g depGraph) dependents(id string) []string {
+	var out []string
+	for n, deps := range g {
+		for _, d := range deps {
+			if d == id {
+				out = append(out, n)
+				break
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// cycleError refuses a write that would make a profile depend on itself.
+type cycleError struct {
+	cycle []string
+}
+
+func (e *cycleError) Error() string { return "circular_dependency" }
+
+func (s *store) depGraph() depGraph {
+	if g := s.graph.Load(); g != nil {
+		return *g
+	}
+	return nil
+}
+
+// handleProfileDependencies lists what a profile references: its direct
+// dependencies, everything reachable from them, the profiles referencing it,
+// and referenced ids no profile has.
+func (s *store) handleProfileDependencies(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	id := strings.TrimSpace(mux.Vars(r)["id"])
+	all := s.profiles.load()
+	if _, ok := all[id]; !ok {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "not_found"})
+		return
+	}
+	g := s.depGraph()
+	transitive := g.transitive(id)
+	missing := []string{}
+	for _, d := range transitive {
+		if _, ok := all[d]; !ok {
+			missing = append(missing, d)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":           id,
+		"dependencies": nonNilStrings(g[id]),
+		"transitive":   nonNilStrings(transitive),
+		"dependents":   nonNilStrings(g.dependents(id)),
+		"missing":      missing,
+	})
+}
+
+func nonNilStrings(v []string) []string {
+	if v == nil {
+		return []string{}
+	}
+	return v
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func graphOf(edges map[string][]string) depGraph {
+	set := make(profileSet)
+	for id, deps := range edges {
+		set[id] = Profile{ID: id, DependsOn: deps}
+	}
+	return buildDepGraph(set)
+}
+
+func TestDepGraphDiamond(t *testing.T) {
+	// a → b → d and a → c → d.
+	g := graphOf(map[string][]string{"a": {"b", "c"}, "b": {"d"}, "c": {"d"}, "d": nil})
+
+	if got := g.transitive("a"); !reflect.DeepEqual(got, []string{"b", "c", "d"}) {
+		t.Fatalf("transitive(a) = %v", got)
+	}
+	if got := g.dependents("d"); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Fatalf("dependents(d) = %v", got)
+	}
+	// Two paths to d are not a cycle.
+	if cycle := g.cycleThrough("a", []string{"b", "c"}); cycle != nil {
+		t.Fatalf("diamond reported as cycle %v", cycle)
+	}
+	if cycle := g.cycleThrough("d", []string{"a"}); !reflect.DeepEqual(cycle, []string{"d", "a", "b", "d"}) {
+		t.Fatalf("d → a closes %v", cycle)
+	}
+}
+
+func TestDepGraphDisconnected(t *testing.T) {
+	g := graphOf(map[string][]string{"a": {"b"}, "x": {"y"}, "y": {"z"}, "lone": nil})
+
+	if got := g.transitive("x"); !reflect.DeepEqual(got, []string{"y", "z"}) {
+		t.Fatalf("transitive(x) = %v", got)
+	}
+	if got := g.transitive("lone"); got != nil {
+		t.Fatalf("transitive(lone) = %v", got)
+	}
+	if got := g.dependents("b"); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Fatalf("dependents(b) = %v", got)
+	}
+	// Linking the components in one direction is fine; back again is not.
+	if cycle := g.cycleThrough("b", []string{"x"}); cycle != nil {
+		t.Fatalf("b → x reported as cycle %v", cycle)
+	}
+	if cycle := g.cycleThrough("z", []string{"x"}); !reflect.DeepEqual(cycle, []string{"z", "x", "y", "z"}) {
+		t.Fatalf("z → x closes %v", cycle)
+	}
+}
+
+func TestDependencyIDsFromContent(t *testing.T) {
+	p := withSourceInventory(Profile{ID: "wall", Content: "id: wall\n" +
+		"depends_on: [prices, wall, \"../etc\"]\n" +
+		"source:\n  url: http://aggregator:8082/results?profile_id=fx&profile_id=prices\n  profile_id: census\n"})
+	if !reflect.DeepEqual(p.DependsOn, []string{"census", "fx", "prices"}) {
+		t.Fatalf("depends_on = %v", p.DependsOn)
+	}
+}
+
+func TestProfileWritesRejectCycles(t *testing.T) {
+	t.Setenv("REGISTRY_API_KEY", "k")
+	s := newTestStore("")
+	s.profilesDir = t.TempDir()
+	r := mux.NewRouter()
+	r.HandleFunc("/profiles", s.handleProfilesCreate).Methods(http.MethodPost)
+	r.HandleFunc("/profiles/{id}", s.handleProfileUpdate).Methods(http.MethodPut)
+	r.HandleFunc("/profiles/{id}/dependencies", s.handleProfileDependencies).Methods(http.MethodGet)
+	do := func(method, target, content string) (int, map[string]any) {
+		var body string
+		if content != "" {
+			id, _, _ := strings.Cut(strings.TrimPrefix(content, "id: "), "\n")
+			b, _ := json.Marshal(map[string]string{"id": id, "content": content})
+			body = string(b)
+		}
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("X-API-Key", "k")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		var out map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &out)
+		return rec.Code, out
+	}
+
+	if code, out := do(http.MethodPost, "/profiles", "id: a\ndepends_on: [b]\n"); code != http.StatusCreated {
+		t.Fatalf("create a: %d %v", code, out)
+	}
+	if code, out := do(http.MethodPost, "/profiles", "id: b\ndepends_on: [c]\n"); code != http.StatusCreated {
+		t.Fatalf("create b: %d %v", code, out)
+	}
+	code, out := do(http.MethodPost, "/profiles", "id: c\nsource:\n  profile_id: a\n")
+	cycle, _ := json.Marshal(out["cycle"])
+	if code != http.StatusUnprocessableEntity || out["error"] != "circular_dependency" || string(cycle) != `["c","a","b","c"]` {
+		t.Fatalf("create c: %d %v", code, out)
+	}
+	if _, ok := s.profile("c"); ok {
+		t.Fatal("rejected profile was stored")
+	}
+	code, out = do(http.MethodPut, "/profiles/b", "id: b\ndepends_on: [a]\n")
+	if code != http.StatusUnprocessableEntity || out["error"] != "circular_dependency" {
+		t.Fatalf("update b: %d %v", code, out)
+	}
+	if b, _ := os.ReadFile(filepath.Join(s.profilesDir, "b.yaml")); !strings.Contains(string(b), "[c]") {
+		t.Fatalf("rejected update reached the file: %s", b)
+	}
+
+	code, out = do(http.MethodGet, "/profiles/a/dependencies", "")
+	got, _ := json.Marshal(out)
+	if code != http.StatusOK || string(got) != `{"dependencies":["b"],"dependents":[],"id":"a","missing":["c"],"transitive":["b","c"]}` {
+		t.Fatalf("dependencies: %d %s", code, got)
+	}
+	if code, _ := do(http.MethodGet, "/profiles/ghost/dependencies", ""); code != http.StatusNotFound {
+		t.Fatalf("unknown profile: %d", code)
+	}
+}
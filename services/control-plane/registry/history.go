@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultHistoryDepth is how many previous versions of each profile are
+// kept under .history when REGISTRY_HISTORY_DEPTH is unset.
+const defaultHistoryDepth = 10
+
+// loadHistoryDepth reads REGISTRY_HISTORY_DEPTH; 0 turns history off.
+func loadHistoryDepth() int {
+	v := strings.TrimSpace(os.Getenv("REGISTRY_HISTORY_DEPTH"))
+	if v == "" {
+		return defaultHistoryDepth
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		slog.Warn("invalid_history_depth", "value", v, "default", defaultHistoryDepth)
+		return defaultHistoryDepth
+	}
+	return n
+}
+
+type profileVersion struct {
+	Version   string `json:"version"`
+	Digest    string `json:"digest"`
+	Timestamp string `json:"timestamp"`
+	Content   string `json:"content,omitempty"`
+}
+
+type rollbackRequest struct {
+	Version string `json:"version"`
+}
+
+func (s *store) historyDir(id string) string {
+	return filepath.Join(s.profilesDir, ".history", id)
+}
+
+// writeAtomic writes b to dst through a temp file in the same directory, so
+// readers see the old file or the new one and never a partial write.
+func writeAtomic(dst string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	_, werr := tmp.Write(b)
+	cerr := tmp.Close()
+	if werr != nil || cerr != nil {
+		_ = os.Remove(tmpName)
+		return errors.New("write_failed")
+	}
+	if err := os.Rename(tmpName, dst); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// writeProfileFile replaces {id}.yaml with content. The file it overwrites
+// is first copied to .history/{id}/{id}.{unix_ns}.yaml, and the oldest
+// copies beyond historyDepth are pruned. A failed snapshot fails the write,
+// so no version is lost without a trace. Callers hold profileFileMu.
+func (s *store) writeProfileFile(id string, content []byte) error {
+	if err := os.MkdirAll(s.profilesDir, 0o755); err != nil {
+		return err
+	}
+	dst := filepath.Join(s.profilesDir, id+".yaml")
+	if s.historyDepth > 0 {
+		old, err := os.ReadFile(dst)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return err
+		default:
+			if err := s.snapshotProfile(id, old); err != nil {
+				return err
+			}
+		}
+	}
+	return writeAtomic(dst, content)
+}
+
+func (s *store) snapshotProfile(id string, old []byte) error {
+	dir := s.historyDir(id)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	version := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := writeAtomic(filepath.Join(dir, id+"."+version+".yaml"), old); err != nil {
+		return err
+	}
+	versions, err := s.historyVersions(id)
+	if err != nil {
+		return nil
+	}
+	for _, v := range versions[min(len(versions), s.historyDepth):] {
+		if err := os.Remove(filepath.Join(dir, id+"."+v+".yaml")); err != nil {
+			slog.Warn("history_prune_failed", "id", id, "version", v, "err", err)
+		}
+	}
+	return nil
+}
+
+// historyVersions lists the versions kept for id, newest first. Versions are
+// the unix nanosecond timestamps in the file names.
+func (s *store) historyVersions(id string) ([]string, error) {
+	entries, err := os.ReadDir(s.historyDir(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []int64
+	for _, e := range entries {
+		v, ok := strings.CutPrefix(e.Name(), id+".")
+		if e.IsDir() || !ok {
+			continue
+		}
+		v, ok = strings.CutSuffix(v, ".yaml")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			out = append(out, n)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] > out[j] })
+	versions := make([]string, len(out))
+	for i, n := range out {
+		versions[i] = strconv.FormatInt(n, 10)
+	}
+	return versions, nil
+}
+
+func (s *store) readVersion(id, version string) (profileVersion, error) {
+	b, err := os.ReadFile(filepath.Join(s.historyDir(id), id+"."+version+".yaml"))
+	if err != nil {
+		return profileVersion{}, err
+	}
+	n, _ := strconv.ParseInt(version, 10, 64)
+	content := normalizeYAMLBytes(b)
+	return profileVersion{
+		Version:   version,
+		Digest:    digestBytes(content),
+		Timestamp: time.Unix(0, n).UTC().Format(time.RFC3339Nano),
+		Content:   string(content),
+	}, nil
+}
+
+func validVersion(v string) bool {
+	n, err := strconv.ParseInt(v, 10, 64)
+	return err == nil && n > 0 && strconv.FormatInt(n, 10) == v
+}
+
+func historyID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := strings.TrimSpace(mux.Vars(r)["id"])
+	if id == "" || !safeIDRe.MatchString(id) || strings.Contains(id, "..") {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_id"})
+		return "", false
+	}
+	return id, true
+}
+
+func (s *store) handleProfileHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	id, ok := historyID(w, r)
+	if !ok {
+		return
+	}
+	versions, err := s.historyVersions(id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "read_failed"})
+		return
+	}
+	out := make([]profileVersion, 0, len(versions))
+	for _, v := range versions {
+		pv, err := s.readVersion(id, v)
+		if err != nil {
+			continue
+		}
+		pv.Content = ""
+		out = append(out, pv)
+	}
+	_, current := s.profile(id)
+	if len(out) == 0 && !current {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "not_found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"id": id, "count": len(out), "versions": out})
+}
+
+func (s *store) handleProfileHistoryVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	id, ok := historyID(w, r)
+	if !ok {
+		return
+	}
+	version := strings.TrimSpace(mux.Vars(r)["version"])
+	if !validVersion(version) {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_version"})
+		return
+	}
+	pv, err := s.readVersion(id, version)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "version_not_found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":        id,
+		"version":   pv.Version,
+		"digest":    pv.Digest,
+		"timestamp": pv.Timestamp,
+		"content":   pv.Content,
+	})
+}
+
+// handleProfileRollback makes a kept version the current content. The
+// content it replaces goes to history like any other overwrite, so a
+// rollback can itself be rolled back. Profiles deleted since can be
+// restored the same way.
+func (s *store) handleProfileRollback(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !s.requireAPIKey(w, r) {
+		return
+	}
+	id, ok := historyID(w, r)
+	if !ok {
+		return
+	}
+
+	body, berr := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if berr != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_body"})
+		return
+	}
+	defer r.Body.Close()
+
+	var req rollbackRequest
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_json"})
+		return
+	}
+	version := strings.TrimSpace(req.Version)
+	if !validVersion(version) {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_version"})
+		return
+	}
+	pv, err := s.readVersion(id, version)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "version_not_found"})
+		return
+	}
+	p, err := s.saveProfile(id, []byte(pv.Content), saveOptions{})
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	slog.Info("profile_rolled_back", "id", id, "version", version, "digest", pv.Digest)
+	writeJSON(w, http.StatusOK, map[string]any{"status": "rolled_back", "id": id, "version": version, "profile": p})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func historyRouter(s *store) *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/profiles/{id}", s.handleProfileUpdate).Methods(http.MethodPut)
+	r.HandleFunc("/profiles/{id}/history", s.handleProfileHistory).Methods(http.MethodGet)
+	r.HandleFunc("/profiles/{id}/history/{version}", s.handleProfileHistoryVersion).Methods(http.MethodGet)
+	r.HandleFunc("/profiles/{id}:rollback", s.handleProfileRollback).Methods(http.MethodPost)
+	return r
+}
+
+func doHistory(t *testing.T, h http.Handler, method, target, body string) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("X-API-Key", "k")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var out map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	return rec.Code, out
+}
+
+func putVersion(t *testing.T, h http.Handler, name string) {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"content": "id: alpha\nname: " + name + "\n"})
+	if code, out := doHistory(t, h, http.MethodPut, "/profiles/alpha", string(body)); code != http.StatusOK {
+		t.Fatalf("put %s: %d %v", name, code, out)
+	}
+}
+
+func TestProfileHistoryKeepsPreviousVersions(t *testing.T) {
+	t.Setenv("REGISTRY_API_KEY", "k")
+	s := newTestStore("")
+	s.profilesDir = t.TempDir()
+	s.historyDepth = 2
+	h := historyRouter(s)
+
+	putVersion(t, h, "one")
+	if code, out := doHistory(t, h, http.MethodGet, "/profiles/alpha/history", ""); code != http.StatusOK || out["count"] != float64(0) {
+		t.Fatalf("after create: %d %v", code, out)
+	}
+	for _, name := range []string{"two", "three", "four"} {
+		putVersion(t, h, name)
+	}
+
+	code, out := doHistory(t, h, http.MethodGet, "/profiles/alpha/history", "")
+	versions, _ := out["versions"].([]any)
+	if code != http.StatusOK || len(versions) != 2 {
+		t.Fatalf("history: %d %v", code, out)
+	}
+	files, _ := os.ReadDir(filepath.Join(s.profilesDir, ".history", "alpha"))
+	if len(files) != 2 {
+		t.Fatalf("history depth not enforced: %d files", len(files))
+	}
+
+	// Newest first: the version overwritten by "four" holds "three".
+	newest := versions[0].(map[string]any)
+	version := newest["version"].(string)
+	code, got := doHistory(t, h, http.MethodGet, "/profiles/alpha/history/"+version, "")
+	if code != http.StatusOK || got["content"] != "id: alpha\nname: three\n" || got["digest"] != newest["digest"] {
+		t.Fatalf("version: %d %v", code, got)
+	}
+
+	code, out = doHistory(t, h, http.MethodPost, "/profiles/alpha:rollback", `{"version":"`+version+`"}`)
+	if code != http.StatusOK || out["status"] != "rolled_back" {
+		t.Fatalf("rollback: %d %v", code, out)
+	}
+	if p, _ := s.profile("alpha"); p.Name != "three" {
+		t.Fatalf("profile after rollback: %+v", p)
+	}
+	b, _ := os.ReadFile(filepath.Join(s.profilesDir, "alpha.yaml"))
+	if string(b) != "id: alpha\nname: three\n" {
+		t.Fatalf("file after rollback: %q", b)
+	}
+	// The rollback itself went to history: "four" is now the newest version.
+	_, out = doHistory(t, h, http.MethodGet, "/profiles/alpha/history", "")
+	newest = out["versions"].([]any)[0].(map[string]any)
+	_, got = doHistory(t, h, http.MethodGet, "/profiles/alpha/history/"+newest["version"].(string), "")
+	if got["content"] != "id: alpha\nname: four\n" {
+		t.Fatalf("rollback not recorded: %v", got)
+	}
+}
+
+func TestProfileHistoryErrors(t *testing.T) {
+	t.Setenv("REGISTRY_API_KEY", "k")
+	s := newTestStore("")
+	s.profilesDir = t.TempDir()
+	s.historyDepth = 10
+	h := historyRouter(s)
+	putVersion(t, h, "one")
+
+	for _, tc := range []struct {
+		method, target, body string
+		code                 int
+		err                  string
+	}{
+		{http.MethodGet, "/profiles/ghost/history", "", http.StatusNotFound, "not_found"},
+		{http.MethodGet, "/profiles/alpha/history/latest", "", http.StatusBadRequest, "invalid_version"},
+		{http.MethodGet, "/profiles/alpha/history/123", "", http.StatusNotFound, "version_not_found"},
+		{http.MethodPost, "/profiles/alpha:rollback", `{"version":"123"}`, http.StatusNotFound, "version_not_found"},
+		{http.MethodPost, "/profiles/alpha:rollback", `{"version":"../x"}`, http.StatusBadRequest, "invalid_version"},
+		{http.MethodPost, "/profiles/alpha:rollback", `{"ver":"1"}`, http.StatusBadRequest, "invalid_json"},
+	} {
+		code, out := doHistory(t, h, tc.method, tc.target, tc.body)
+		if code != tc.code || out["error"] != tc.err {
+			t.Errorf("%s %s: %d %v, want %d %s", tc.method, tc.target, code, out, tc.code, tc.err)
+		}
+	}
+}
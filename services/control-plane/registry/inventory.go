@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sourceDoc is the part of a profile the inventory fields and dependencies
+// are derived from. source.auth is either a scalar ("none", "api_key") or a
+// mapping with a type key.
+type sourceDoc struct {
+	Source struct {
+		URL       string    `yaml:"url"`
+		Auth      yaml.Node `yaml:"auth"`
+		ProfileID string    `yaml:"profile_id"`
+	} `yaml:"source"`
+	DependsOn []string `yaml:"depends_on"`
+}
+
+// withSourceInventory fills SourceHost, SourceEnv, AuthType and DependsOn
+// from the profile content. Env placeholders are never expanded: a host written as
+// ${API_HOST} is reported as such, and the placeholder names used anywhere in
+// the URL are listed in SourceEnv.
+func withSourceInventory(p Profile) Profile {
+	p.SourceHost, p.SourceEnv, p.AuthType, p.DependsOn = "", nil, "", nil
+	var doc sourceDoc
+	dec := yaml.NewDecoder(strings.NewReader(p.Content))
+	dec.KnownFields(false)
+	if err := dec.Decode(&doc); err != nil {
+		return p
+	}
+	rawURL := strings.TrimSpace(doc.Source.URL)
+	if rawURL != "" {
+		p.SourceHost = sourceHost(rawURL)
+		for _, m := range envRe.FindAllStringSubmatch(rawURL, -1) {
+			p.SourceEnv = append(p.SourceEnv, m[1])
+		}
+	}
+	p.AuthType = authType(&doc.Source.Auth)
+	p.DependsOn = dependencyIDs(p.ID, doc)
+	return p
+}
+
+// sourceHost returns the host[:port] of rawURL, lowercased unless it is a
+// placeholder. Userinfo, path, query and fragment are dropped, so credentials
+// embedded in the URL never reach the inventory.
+func sourceHost(rawURL string) string {
+	rest := rawURL
+	if i := strings.Index(rest, "://"); i >= 0 {
+		rest = rest[i+3:]
+	}
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		rest = rest[:i]
+	}
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		rest = rest[i+1:]
+	}
+	if strings.Contains(rest, "${") {
+		return rest
+	}
+	return strings.ToLower(rest)
+}
+
+func authType(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if v := strings.ToLower(strings.TrimSpace(n.Value)); v != "" {
+			return v
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == "type" {
+				if v := strings.ToLower(strings.TrimSpace(n.Content[i+1].Value)); v != "" {
+					return v
+				}
+			}
+		}
+		return "unknown"
+	}
+	return "none"
+}
@@ -8,13 +8,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -38,12 +42,21 @@ type Profile struct {
 	Interval string  `json:"interval,omitempty" yaml:"-"`
 	Jitter   string  `json:"jitter,omitempty" yaml:"-"`
 	Limits   *Limits `json:"limits,omitempty" yaml:"-"`
+
+	Tags []string `json:"tags,omitempty" yaml:"-"`
+
+	SourceHost string   `json:"source_host,omitempty" yaml:"-"`
+	SourceEnv  []string `json:"source_env,omitempty" yaml:"-"`
+	AuthType   string   `json:"auth_type,omitempty" yaml:"-"`
+
+	DependsOn []string `json:"depends_on,omitempty" yaml:"-"`
 }
 
 type profileYAML struct {
-	ID      string `yaml:"id"`
-	Name    string `yaml:"name"`
-	Version string `yaml:"version"`
+	ID      string   `yaml:"id"`
+	Name    string   `yaml:"name"`
+	Version string   `yaml:"version"`
+	Tags    []string `yaml:"tags"`
 }
 
 type profileDoc struct {
@@ -71,12 +84,32 @@ type Limits struct {
 }
 
 type store struct {
-	mu          sync.RWMutex
-	profiles    map[string]Profile
-	fieldsCache map[string]cachedFields
-	profilesDir string
-	aggURL      string
-	client      *http.Client
+	// profiles is read lock-free; writeMu serializes its copy-on-write updates.
+	// graph is rebuilt from profiles on each of them.
+	profiles profileSnapshot
+	graph    atomic.Pointer[depGraph]
+	writeMu  sync.Mutex
+
+	mu           sync.RWMutex // guards fieldsCache, lastRuns, badOverrides and quarantine
+	fieldsCache  map[string]cachedFields
+	lastRuns     map[string]cachedRun
+	badOverrides map[string]string         // profile id -> why its override file was ignored
+	quarantine   map[string]invalidProfile // file name -> why it could not be loaded
+	overridesMu  sync.Mutex                // serializes read-modify-write of override files
+	profilesDir  string
+	aggURL       string
+	client       *http.Client
+
+	// profileFileMu serializes profile writes and deletes, from the digest
+	// check through the file and history writes to the in-memory update;
+	// historyDepth is how many old versions to keep (0: none).
+	profileFileMu sync.Mutex
+	historyDepth  int
+}
+
+type cachedRun struct {
+	lastRun   map[string]any
+	fetchedAt time.Time
 }
 
 type cachedFields struct {
@@ -107,6 +140,7 @@ type fieldEntry struct {
 }
 
 func main() {
+	setupLogging()
 	profilesDir := strings.TrimSpace(os.Getenv("PROFILES_DIR"))
 	if profilesDir == "" {
 		profilesDir = defaultProfilesDir
@@ -118,10 +152,11 @@ func main() {
 	}
 
 	s := &store{
-		profiles:    make(map[string]Profile),
-		fieldsCache: make(map[string]cachedFields),
-		profilesDir: profilesDir,
-		aggURL:      aggURL,
+		fieldsCache:  make(map[string]cachedFields),
+		lastRuns:     make(map[string]cachedRun),
+		profilesDir:  profilesDir,
+		historyDepth: loadHistoryDepth(),
+		aggURL:       aggURL,
 		client: &http.Client{
 			Timeout: 5 * time.Second,
 		},
@@ -135,17 +170,25 @@ func main() {
 
 	r.HandleFunc("/profiles", s.handleProfilesList).Methods(http.MethodGet, http.MethodOptions)
 	r.HandleFunc("/profiles", s.handleProfilesCreate).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/profiles:status", s.handleProfilesStatus).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/profiles:batch", s.handleProfilesBatch).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/profiles:reload", s.handleProfilesReload).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/profiles/invalid", s.handleProfilesInvalid).Methods(http.MethodGet, http.MethodOptions)
 	r.HandleFunc("/profiles/{id}", s.handleProfileGet).Methods(http.MethodGet, http.MethodOptions)
 	r.HandleFunc("/profiles/{id}", s.handleProfileUpdate).Methods(http.MethodPut, http.MethodOptions)
 	r.HandleFunc("/profiles/{id}", s.handleProfileDelete).Methods(http.MethodDelete, http.MethodOptions)
 	r.HandleFunc("/profiles/{id}/fields", s.handleProfileFields).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/profiles/{id}/dependencies", s.handleProfileDependencies).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/profiles/{id}/history", s.handleProfileHistory).Methods(http.MethodGet, http.MethodOptions)
+	r.HandleFunc("/profiles/{id}/history/{version}", s.handleProfileHistoryVersion).Methods(http.MethodGet, http.MethodOptions)
 
 	r.HandleFunc("/profiles/{id}/status", s.handleProfileStatus).Methods(http.MethodGet, http.MethodOptions)
 	r.HandleFunc("/profiles/{id}:pause", s.handleProfilePause).Methods(http.MethodPost, http.MethodOptions)
 	r.HandleFunc("/profiles/{id}:resume", s.handleProfileResume).Methods(http.MethodPost, http.MethodOptions)
 	r.HandleFunc("/profiles/{id}:setSchedule", s.handleProfileSetSchedule).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/profiles/{id}:rollback", s.handleProfileRollback).Methods(http.MethodPost, http.MethodOptions)
 
-	handler := requestLoggingMiddleware(withCORS(withAuth(r)))
+	handler := requestLoggingMiddleware(withCORS(loadCORSConfig())(withAuth(r)))
 
 	addr := ":" + defaultPort
 	server := &http.Server{
@@ -154,9 +197,9 @@ func main() {
 		ReadHeaderTimeout: 10 * time.Second,
 	}
 
-	logLine("INFO", "starting", "addr=%s profiles_dir=%s aggregator_url=%s", addr, profilesDir, aggURL)
+	slog.Info("starting", "addr", addr, "profiles_dir", profilesDir, "aggregator_url", aggURL)
 	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		logLine("ERROR", "listen_failed", "err=%s", err.Error())
+		slog.Error("listen_failed", "err", err)
 		os.Exit(1)
 	}
 }
@@ -164,7 +207,7 @@ func main() {
 func (s *store) loadAll() error {
 	entries, err := os.ReadDir(s.profilesDir)
 	if err != nil {
-		logLine("WARN", "profiles_dir_unavailable", "dir=%s err=%s", s.profilesDir, err.Error())
+		slog.Warn("profiles_dir_unavailable", "dir", s.profilesDir, "err", err)
 		return nil
 	}
 
@@ -180,34 +223,38 @@ func (s *store) loadAll() error {
 	}
 	sort.Strings(names)
 
-	next := make(map[string]Profile)
+	next := make(profileSet)
+	bad := make(map[string]invalidProfile)
 	for _, name := range names {
 		full := filepath.Join(s.profilesDir, name)
 		b, rerr := os.ReadFile(full)
 		if rerr != nil {
-			logLine("WARN", "profile_read_failed", "file=%s err=%s", name, rerr.Error())
+			slog.Warn("profile_read_failed", "file", name, "err", rerr)
+			bad[name] = s.quarantineEntry(name, rerr.Error())
 			continue
 		}
 		content := normalizeYAMLBytes(b)
 		meta, perr := parseProfileYAML(string(content))
 		if perr != nil || strings.TrimSpace(meta.ID) == "" {
-			logLine("WARN", "profile_parse_failed", "file=%s err=%s", name, errString(perr))
+			slog.Warn("profile_parse_failed", "file", name, "err", errString(perr))
+			bad[name] = s.quarantineEntry(name, firstNonEmpty(errString(perr), "missing_id"))
 			continue
 		}
 		p := Profile{
 			ID:      strings.TrimSpace(meta.ID),
 			Name:    strings.TrimSpace(meta.Name),
 			Version: strings.TrimSpace(meta.Version),
+			Tags:    normalizeTags(meta.Tags),
 			Digest:  digestBytes(content),
 			Content: string(content),
 		}
 		p = s.applyOverrides(p)
+		p = withSourceInventory(p)
 		next[p.ID] = p
 	}
 
-	s.mu.Lock()
-	s.profiles = next
-	s.mu.Unlock()
+	s.replaceProfiles(next)
+	s.replaceQuarantine(bad)
 
 	return nil
 }
@@ -530,6 +577,9 @@ func (s *store) readOverrides(id string) (Overrides, error) {
 	if err := dec.Decode(&o); err != nil {
 		return Overrides{}, err
 	}
+	if v := validateOverrides(o); len(v) > 0 {
+		return Overrides{}, &overridesError{violations: v}
+	}
 	return o, nil
 }
 
@@ -563,8 +613,11 @@ func (s *store) writeOverrides(id string, o Overrides) error {
 	return nil
 }
 
+// applyOverrides layers the profile's override file on top of it. A file
+// that does not parse or validate is ignored and reported by /health.
 func (s *store) applyOverrides(p Profile) Profile {
 	o, err := s.readOverrides(p.ID)
+	s.noteOverridesState(p.ID, err)
 	if err != nil {
 		return p
 	}
@@ -593,13 +646,19 @@ func (s *store) handleHealth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.mu.RLock()
-	n := len(s.profiles)
-	s.mu.RUnlock()
+	n := len(s.profiles.load())
+	status := "healthy"
+	bad := s.invalidOverrides()
+	invalid := s.invalidProfilesCount()
+	if len(bad) > 0 || invalid > 0 {
+		status = "degraded"
+	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
-		"status":         "healthy",
-		"profiles_count": n,
+		"status":                 status,
+		"profiles_count":         n,
+		"invalid_overrides":      bad,
+		"invalid_profiles_count": invalid,
 	})
 }
 
@@ -621,14 +680,44 @@ func (s *store) handleProfilesList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.mu.RLock()
-	out := make([]Profile, 0, len(s.profiles))
-	for _, p := range s.profiles {
+	host := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("host")))
+	auth := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("auth_type")))
+	tag := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("tag")))
+	search, errCode := parseProfileSearch(r)
+	if errCode != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": errCode})
+		return
+	}
+
+	all := s.profiles.load()
+	out := make([]Profile, 0, len(all))
+	for _, p := range all {
+		if host != "" && strings.ToLower(p.SourceHost) != host {
+			continue
+		}
+		if auth != "" && p.AuthType != auth {
+			continue
+		}
+		if tag != "" && !p.hasTag(tag) {
+			continue
+		}
+		if !search.matches(p) {
+			continue
+		}
 		out = append(out, p)
 	}
-	s.mu.RUnlock()
 
 	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	// The plain list stays an array, so the quarantine count rides in a
+	// header there and in the meta of the search response.
+	invalid := s.invalidProfilesCount()
+	if invalid > 0 {
+		w.Header().Set("X-Invalid-Profiles", strconv.Itoa(invalid))
+	}
+	if search.active {
+		writeJSON(w, http.StatusOK, map[string]any{"profiles": out, "total": len(all), "filtered": len(out), "invalid_profiles": invalid})
+		return
+	}
 	writeJSON(w, http.StatusOK, out)
 }
 
@@ -639,15 +728,14 @@ func (s *store) handleProfileGet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	id := strings.TrimSpace(mux.Vars(r)["id"])
-	s.mu.RLock()
-	p, ok := s.profiles[id]
-	s.mu.RUnlock()
+	p, ok := s.profile(id)
 
 	if !ok {
 		writeJSON(w, http.StatusNotFound, map[string]any{"error": "not_found"})
 		return
 	}
 
+	w.Header().Set("ETag", `"`+p.Digest+`"`)
 	writeJSON(w, http.StatusOK, p)
 }
 
@@ -663,6 +751,9 @@ func (s *store) handleProfileDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.profileFileMu.Lock()
+	defer s.profileFileMu.Unlock()
+
 	full := filepath.Join(s.profilesDir, id+".yaml")
 	if _, err := os.Stat(full); err != nil {
 		writeJSON(w, http.StatusNotFound, map[string]any{"error": "not_found"})
@@ -675,9 +766,8 @@ func (s *store) handleProfileDelete(w http.ResponseWriter, r *http.Request) {
 	}
 	_ = os.Remove(s.overridesPath(id))
 
-	s.mu.Lock()
-	delete(s.profiles, id)
-	s.mu.Unlock()
+	s.deleteProfile(id)
+	s.noteProfileFile(id+".yaml", nil)
 
 	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "id": id})
 }
@@ -694,9 +784,7 @@ func (s *store) handleProfileFields(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.mu.RLock()
-	p, ok := s.profiles[id]
-	s.mu.RUnlock()
+	p, ok := s.profile(id)
 	if !ok {
 		writeJSON(w, http.StatusNotFound, map[string]any{"error": "not_found"})
 		return
@@ -741,6 +829,8 @@ type statusBridge struct {
 	ProfileID string         `json:"profile_id"`
 	Digest    string         `json:"digest"`
 	LastRun   map[string]any `json:"last_run"`
+	FetchedAt string         `json:"fetched_at,omitempty"`
+	Stale     bool           `json:"stale"`
 }
 
 func (s *store) handleProfileStatus(w http.ResponseWriter, r *http.Request) {
@@ -750,9 +840,7 @@ func (s *store) handleProfileStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	id := strings.TrimSpace(mux.Vars(r)["id"])
-	s.mu.RLock()
-	p, ok := s.profiles[id]
-	s.mu.RUnlock()
+	p, ok := s.profile(id)
 
 	if !ok {
 		writeJSON(w, http.StatusNotFound, map[string]any{"error": "not_found"})
@@ -761,21 +849,94 @@ func (s *store) handleProfileStatus(w http.ResponseWriter, r *http.Request) {
 
 	last, err := s.fetchLastRun(id)
 	if err != nil {
-		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"error": "aggregator_unavailable"})
+		cached, ok := s.getCachedRun(id)
+		if !ok {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"error": "aggregator_unavailable"})
+			return
+		}
+		writeJSON(w, http.StatusOK, statusBridge{
+			ProfileID: id,
+			Digest:    p.Digest,
+			LastRun:   cached.lastRun,
+			FetchedAt: cached.fetchedAt.Format(time.RFC3339),
+			Stale:     true,
+		})
 		return
 	}
+	fetchedAt := s.setCachedRun(id, last)
 
 	out := statusBridge{
 		ProfileID: id,
 		Digest:    p.Digest,
 		LastRun:   last,
+		FetchedAt: fetchedAt.Format(time.RFC3339),
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleProfilesStatus returns the status of every known profile using a
+// single aggregator call, falling back to cached runs when it is unreachable.
+func (s *store) handleProfilesStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	all := s.profiles.load()
+	profiles := make([]Profile, 0, len(all))
+	for _, p := range all {
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].ID < profiles[j].ID })
+
+	ids := make([]string, 0, len(profiles))
+	for _, p := range profiles {
+		ids = append(ids, p.ID)
+	}
+	latest, err := s.fetchLastRuns(ids)
+
+	out := make([]statusBridge, 0, len(profiles))
+	missing := 0
+	for _, p := range profiles {
+		st := statusBridge{ProfileID: p.ID, Digest: p.Digest}
+		if err == nil {
+			st.LastRun = latest[p.ID]
+			st.FetchedAt = s.setCachedRun(p.ID, st.LastRun).Format(time.RFC3339)
+		} else if cached, ok := s.getCachedRun(p.ID); ok {
+			st.LastRun = cached.lastRun
+			st.FetchedAt = cached.fetchedAt.Format(time.RFC3339)
+			st.Stale = true
+		} else {
+			missing++
+			st.Stale = true
+		}
+		out = append(out, st)
+	}
+	if err != nil && len(out) > 0 && missing == len(out) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"error": "aggregator_unavailable"})
+		return
 	}
 	writeJSON(w, http.StatusOK, out)
 }
 
+func (s *store) getCachedRun(id string) (cachedRun, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.lastRuns[id]
+	return c, ok
+}
+
+func (s *store) setCachedRun(id string, last map[string]any) time.Time {
+	now := time.Now().UTC()
+	s.mu.Lock()
+	s.lastRuns[id] = cachedRun{lastRun: last, fetchedAt: now}
+	s.mu.Unlock()
+	return now
+}
+
 func (s *store) fetchLastRun(profileID string) (map[string]any, error) {
-	url := strings.TrimRight(s.aggURL, "/") + "/runs?profile_id=" + urlQueryEscape(profileID) + "&limit=1"
-	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	q := url.Values{"profile_id": {profileID}, "limit": {"1"}}
+	req, _ := http.NewRequest(http.MethodGet, strings.TrimRight(s.aggURL, "/")+"/runs?"+q.Encode(), nil)
 	resp, err := s.client.Do(req)
 	if err != nil {
 		return nil, err
@@ -798,9 +959,51 @@ func (s *store) fetchLastRun(profileID string) (map[string]any, error) {
 	return arr[0], nil
 }
 
-func urlQueryEscape(s string) string {
-	replacer := strings.NewReplacer(" ", "%20", "\n", "%0A", "\r", "%0D")
-	return replacer.Replace(s)
+// lastRunsBatch is how many profile ids fetchLastRuns sends per aggregator
+// request, keeping URLs well under common length limits.
+const lastRunsBatch = 100
+
+func (s *store) fetchLastRuns(ids []string) (map[string]map[string]any, error) {
+	out := make(map[string]map[string]any, len(ids))
+	for start := 0; start < len(ids); start += lastRunsBatch {
+		if err := s.fetchLastRunsBatch(ids[start:min(start+lastRunsBatch, len(ids))], out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// fetchLastRunsBatch adds the latest run of each of ids to out. latest=1
+// without a limit returns one run per requested profile.
+func (s *store) fetchLastRunsBatch(ids []string, out map[string]map[string]any) error {
+	q := url.Values{"latest": {"1"}, "profile_id": ids}
+	req, _ := http.NewRequest(http.MethodGet, strings.TrimRight(s.aggURL, "/")+"/runs?"+q.Encode(), nil)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("aggregator_status_%d", resp.StatusCode)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return err
+	}
+	var arr []map[string]any
+	if err := json.Unmarshal(b, &arr); err != nil {
+		return err
+	}
+	for _, run := range arr {
+		pid, _ := run["profile_id"].(string)
+		if pid == "" {
+			continue
+		}
+		if _, seen := out[pid]; !seen {
+			out[pid] = run
+		}
+	}
+	return nil
 }
 
 type createProfileRequest struct {
@@ -808,6 +1011,8 @@ type createProfileRequest struct {
 	Name    string `json:"name"`
 	Version string `json:"version"`
 	Content string `json:"content"`
+	// Digest makes an update conditional on the stored profile's digest.
+	Digest string `json:"digest,omitempty"`
 }
 
 type setScheduleRequest struct {
@@ -882,51 +1087,12 @@ func (s *store) handleProfilesCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := os.MkdirAll(s.profilesDir, 0o755); err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "write_failed"})
-		return
-	}
-
 	content := normalizeYAMLBytes([]byte(req.Content))
-	dst := filepath.Join(s.profilesDir, req.ID+".yaml")
-
-	tmp, err := os.CreateTemp(s.profilesDir, req.ID+".tmp-*")
+	p, err := s.saveProfile(req.ID, content, saveOptions{Name: req.Name, Version: req.Version})
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "write_failed"})
-		return
-	}
-	tmpName := tmp.Name()
-	_, werr := tmp.Write(content)
-	cerr := tmp.Close()
-	if werr != nil || cerr != nil {
-		_ = os.Remove(tmpName)
-		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "write_failed"})
+		writeSaveError(w, err)
 		return
 	}
-	if err := os.Rename(tmpName, dst); err != nil {
-		_ = os.Remove(tmpName)
-		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "write_failed"})
-		return
-	}
-
-	meta2, perr2 := parseProfileYAML(string(content))
-	if perr2 != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "write_failed"})
-		return
-	}
-
-	p := Profile{
-		ID:      req.ID,
-		Name:    firstNonEmpty(strings.TrimSpace(meta2.Name), req.Name),
-		Version: firstNonEmpty(strings.TrimSpace(meta2.Version), req.Version),
-		Digest:  digestBytes(content),
-		Content: string(content),
-	}
-	p = s.applyOverrides(p)
-
-	s.mu.Lock()
-	s.profiles[p.ID] = p
-	s.mu.Unlock()
 
 	writeJSON(w, http.StatusCreated, p)
 }
@@ -986,52 +1152,20 @@ func (s *store) handleProfileUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := os.MkdirAll(s.profilesDir, 0o755); err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "write_failed"})
+	ifDigest, derr := requestDigest(req.Digest, r.Header.Get("If-Match"))
+	if derr != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "conflicting_digest"})
 		return
 	}
 
 	content := normalizeYAMLBytes([]byte(req.Content))
-	dst := filepath.Join(s.profilesDir, req.ID+".yaml")
-
-	tmp, err := os.CreateTemp(s.profilesDir, req.ID+".tmp-*")
+	p, err := s.saveProfile(req.ID, content, saveOptions{IfDigest: ifDigest, Name: req.Name, Version: req.Version})
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "write_failed"})
+		writeSaveError(w, err)
 		return
 	}
-	tmpName := tmp.Name()
-	_, werr := tmp.Write(content)
-	cerr := tmp.Close()
-	if werr != nil || cerr != nil {
-		_ = os.Remove(tmpName)
-		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "write_failed"})
-		return
-	}
-	if err := os.Rename(tmpName, dst); err != nil {
-		_ = os.Remove(tmpName)
-		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "write_failed"})
-		return
-	}
-
-	meta2, perr2 := parseProfileYAML(string(content))
-	if perr2 != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "write_failed"})
-		return
-	}
-
-	p := Profile{
-		ID:      req.ID,
-		Name:    firstNonEmpty(strings.TrimSpace(meta2.Name), req.Name),
-		Version: firstNonEmpty(strings.TrimSpace(meta2.Version), req.Version),
-		Digest:  digestBytes(content),
-		Content: string(content),
-	}
-	p = s.applyOverrides(p)
-
-	s.mu.Lock()
-	s.profiles[p.ID] = p
-	s.mu.Unlock()
 
+	w.Header().Set("ETag", `"`+p.Digest+`"`)
 	writeJSON(w, http.StatusOK, p)
 }
 
@@ -1126,6 +1260,14 @@ func (s *store) handleProfileSetSchedule(w http.ResponseWriter, r *http.Request)
 		o.MaxPages = req.Limits.MaxPages
 		o.MaxBytes = req.Limits.MaxBytes
 	}
+	if violations := validateOverrides(o); len(violations) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+			"error":      "invalid_overrides",
+			"id":         id,
+			"violations": violations,
+		})
+		return
+	}
 
 	if err := s.writeOverrides(id, o); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "write_failed"})
@@ -1145,20 +1287,23 @@ func (s *store) reloadProfile(id string) {
 	content := normalizeYAMLBytes(b)
 	meta, perr := parseProfileYAML(string(content))
 	if perr != nil || strings.TrimSpace(meta.ID) == "" {
+		e := s.quarantineEntry(id+".yaml", firstNonEmpty(errString(perr), "missing_id"))
+		s.noteProfileFile(id+".yaml", &e)
 		return
 	}
+	s.noteProfileFile(id+".yaml", nil)
 	p := Profile{
 		ID:      strings.TrimSpace(meta.ID),
 		Name:    strings.TrimSpace(meta.Name),
 		Version: strings.TrimSpace(meta.Version),
+		Tags:    normalizeTags(meta.Tags),
 		Digest:  digestBytes(content),
 		Content: string(content),
 	}
 	p = s.applyOverrides(p)
+	p = withSourceInventory(p)
 
-	s.mu.Lock()
-	s.profiles[p.ID] = p
-	s.mu.Unlock()
+	s.putProfile(p)
 }
 
 func firstNonEmpty(a, b string) string {
@@ -1249,39 +1394,22 @@ func requestLoggingMiddleware(next http.Handler) http.Handler {
 
 		dur := time.Since(start).Milliseconds()
 		metricsRecord(rec.status, dur)
-		level := "INFO"
+		level := slog.LevelInfo
 		if rec.status >= 500 {
-			level = "ERROR"
+			level = slog.LevelError
 		} else if rec.status >= 400 {
-			level = "WARN"
+			level = slog.LevelWarn
 		}
-		ts := time.Now().UTC().Format(time.RFC3339)
-		fmt.Fprintf(os.Stdout, "%s %s method=%s path=%s status=%d duration_ms=%d\n",
-			ts, level, r.Method, r.URL.Path, rec.status, dur)
+		slog.Log(r.Context(), level, "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", dur,
+			"request_id", strings.TrimSpace(r.Header.Get("X-Request-ID")),
+		)
 	})
 }
 
-func withCORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,DELETE,OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Request-ID, X-API-Key, X-Principal, X-Tenant-ID")
-		w.Header().Set("Access-Control-Max-Age", "86400")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
-}
-
-func logLine(level, msg, format string, args ...any) {
-	ts := time.Now().UTC().Format(time.RFC3339)
-	line := fmt.Sprintf(format, args...)
-	fmt.Fprintf(os.Stdout, "%s %s %s %s\n", ts, level, msg, line)
-}
-
 // --- minimal metrics ---
 
 var metricsMu sync.Mutex
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Bounds for schedule overrides. Drones treat an interval they cannot parse
+// as "always due", so anything outside these is rejected up front.
+const (
+	minOverrideInterval = time.Minute
+	maxOverrideInterval = 30 * 24 * time.Hour
+
+	maxOverrideRecords = 1_000_000
+	maxOverridePages   = 10_000
+	maxOverrideBytes   = 1 << 30
+)
+
+// overrideViolation is one invalid field in a schedule override.
+type overrideViolation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type overridesError struct {
+	violations []overrideViolation
+}
+
+func (e *overridesError) Error() string {
+	parts := make([]string, 0, len(e.violations))
+	for _, v := range e.violations {
+		parts = append(parts, v.Field+": "+v.Message)
+	}
+	return "invalid overrides: " + strings.Join(parts, "; ")
+}
+
+// validateOverrides checks intervals and jitter as Go durations (the format
+// drones parse) and limits against their bounds. Jitter may be at most half
+// the interval and needs an interval to apply to.
+func validateOverrides(o Overrides) []overrideViolation {
+	var out []overrideViolation
+	fail := func(field, format string, args ...any) {
+		out = append(out, overrideViolation{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var interval time.Duration
+	if v := strings.TrimSpace(o.Interval); v != "" {
+		d, err := time.ParseDuration(v)
+		switch {
+		case err != nil:
+			fail("interval", "must be a duration such as 30m or 6h")
+		case d < minOverrideInterval:
+			fail("interval", "must be at least %s", minOverrideInterval)
+		case d > maxOverrideInterval:
+			fail("interval", "must be at most %s", maxOverrideInterval)
+		default:
+			interval = d
+		}
+	}
+	if v := strings.TrimSpace(o.Jitter); v != "" {
+		d, err := time.ParseDuration(v)
+		switch {
+		case err != nil:
+			fail("jitter", "must be a duration such as 30s or 5m")
+		case d < 0:
+			fail("jitter", "must not be negative")
+		case strings.TrimSpace(o.Interval) == "":
+			fail("jitter", "requires an interval")
+		case interval > 0 && d > interval/2:
+			fail("jitter", "must be at most half the interval (%s)", interval/2)
+		}
+	}
+
+	limit := func(field string, v *int, max int) {
+		if v == nil {
+			return
+		}
+		if *v < 1 {
+			fail(field, "must be positive")
+		} else if *v > max {
+			fail(field, "must be at most %d", max)
+		}
+	}
+	limit("limits.max_records", o.MaxRecords, maxOverrideRecords)
+	limit("limits.max_pages", o.MaxPages, maxOverridePages)
+	limit("limits.max_bytes", o.MaxBytes, maxOverrideBytes)
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Field < out[j].Field })
+	return out
+}
+
+// noteOverridesState records whether id's override file could be applied so
+// /health can list the ones that are being ignored.
+func (s *store) noteOverridesState(id string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		delete(s.badOverrides, id)
+		return
+	}
+	if s.badOverrides == nil {
+		s.badOverrides = make(map[string]string)
+	}
+	if _, known := s.badOverrides[id]; !known {
+		slog.Warn("overrides_invalid", "id", id, "err", err)
+	}
+	s.badOverrides[id] = err.Error()
+}
+
+type invalidOverridesEntry struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+func (s *store) invalidOverrides() []invalidOverridesEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]invalidOverridesEntry, 0, len(s.badOverrides))
+	for id, msg := range s.badOverrides {
+		out = append(out, invalidOverridesEntry{ID: id, Error: msg})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestValidateOverrides(t *testing.T) {
+	n := func(v int) *int { return &v }
+	cases := []struct {
+		name string
+		in   Overrides
+		want []string // "field: message prefix"
+	}{
+		{"empty", Overrides{}, nil},
+		{"valid schedule", Overrides{Interval: "6h", Jitter: "30s", MaxRecords: n(5000), MaxPages: n(10), MaxBytes: n(1 << 20)}, nil},
+		{"prose interval", Overrides{Interval: "5 minutes"}, []string{"interval: must be a duration"}},
+		{"interval too short", Overrides{Interval: "10s"}, []string{"interval: must be at least"}},
+		{"interval too long", Overrides{Interval: "8760h"}, []string{"interval: must be at most"}},
+		{"bad jitter", Overrides{Interval: "1h", Jitter: "soon"}, []string{"jitter: must be a duration"}},
+		{"negative jitter", Overrides{Interval: "1h", Jitter: "-5s"}, []string{"jitter: must not be negative"}},
+		{"jitter over half", Overrides{Interval: "10m", Jitter: "6m"}, []string{"jitter: must be at most half"}},
+		{"jitter at half", Overrides{Interval: "10m", Jitter: "5m"}, nil},
+		{"jitter alone", Overrides{Jitter: "30s"}, []string{"jitter: requires an interval"}},
+		{"negative records", Overrides{MaxRecords: n(-1)}, []string{"limits.max_records: must be positive"}},
+		{"zero pages", Overrides{MaxPages: n(0)}, []string{"limits.max_pages: must be positive"}},
+		{"too many bytes", Overrides{MaxBytes: n(maxOverrideBytes + 1)}, []string{"limits.max_bytes: must be at most"}},
+		{"several", Overrides{Interval: "often", MaxRecords: n(0), MaxPages: n(maxOverridePages + 1)}, []string{
+			"interval: must be a duration", "limits.max_pages: must be at most", "limits.max_records: must be positive",
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := validateOverrides(tc.in)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %+v, want %v", got, tc.want)
+			}
+			for i, v := range got {
+				if s := v.Field + ": " + v.Message; !strings.HasPrefix(s, tc.want[i]) {
+					t.Fatalf("violation %d: got %q, want prefix %q", i, s, tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSetScheduleRejectsInvalidOverrides(t *testing.T) {
+	t.Setenv("REGISTRY_API_KEY", "k")
+	s := newTestStore("")
+	s.profilesDir = t.TempDir()
+	post := func(body string) (int, map[string]any) {
+		req := httptest.NewRequest(http.MethodPost, "/profiles/alpha:setSchedule", strings.NewReader(body))
+		req.Header.Set("X-API-Key", "k")
+		req = mux.SetURLVars(req, map[string]string{"id": "alpha"})
+		rec := httptest.NewRecorder()
+		s.handleProfileSetSchedule(rec, req)
+		var out map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &out)
+		return rec.Code, out
+	}
+
+	code, out := post(`{"interval": "5 minutes", "limits": {"max_records": -1}}`)
+	if code != http.StatusUnprocessableEntity || out["error"] != "invalid_overrides" {
+		t.Fatalf("expected 422, got %d %v", code, out)
+	}
+	violations, _ := out["violations"].([]any)
+	if len(violations) != 2 || violations[0].(map[string]any)["field"] != "interval" {
+		t.Fatalf("unexpected violations: %v", violations)
+	}
+	if _, err := os.Stat(s.overridesPath("alpha")); !os.IsNotExist(err) {
+		t.Fatalf("invalid overrides must not be written: %v", err)
+	}
+	if code, out := post(`{"interval": "5m", "jitter": "30s", "limits": {"max_records": 100}}`); code != http.StatusOK {
+		t.Fatalf("valid schedule: %d %v", code, out)
+	}
+}
+
+func TestHealthReportsInvalidOverrideFiles(t *testing.T) {
+	s := newTestStore("")
+	s.profilesDir = t.TempDir()
+	dir := filepath.Join(s.profilesDir, ".overrides")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "alpha.json"), []byte(`{"interval": "5 minutes"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	health := func() map[string]any {
+		rec := httptest.NewRecorder()
+		s.handleHealth(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		var out map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &out)
+		return out
+	}
+
+	p := s.applyOverrides(Profile{ID: "alpha"})
+	if p.Interval != "" {
+		t.Fatalf("invalid override applied: %+v", p)
+	}
+	out := health()
+	bad, _ := out["invalid_overrides"].([]any)
+	if out["status"] != "degraded" || len(bad) != 1 || bad[0].(map[string]any)["id"] != "alpha" {
+		t.Fatalf("unexpected health: %v", out)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "alpha.json"), []byte(`{"interval": "5m"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if p := s.applyOverrides(Profile{ID: "alpha"}); p.Interval != "5m" {
+		t.Fatalf("fixed override not applied: %+v", p)
+	}
+	if out := health(); out["status"] != "healthy" || len(out["invalid_overrides"].([]any)) != 0 {
+		t.Fatalf("unexpected health after fix: %v", out)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// invalidProfile is a YAML file in PROFILES_DIR that could not be loaded.
+// Such files are left out of /profiles, so they are listed here instead of
+// vanishing without a trace.
+type invalidProfile struct {
+	File    string `json:"file"`
+	Error   string `json:"error"`
+	Size    int64  `json:"size"`
+	ModTime string `json:"modtime,omitempty"`
+}
+
+func (s *store) quarantineEntry(name string, reason string) invalidProfile {
+	e := invalidProfile{File: name, Error: reason}
+	if fi, err := os.Stat(filepath.Join(s.profilesDir, name)); err == nil {
+		e.Size = fi.Size()
+		e.ModTime = fi.ModTime().UTC().Format(time.RFC3339)
+	}
+	return e
+}
+
+// replaceQuarantine swaps in the result of a full scan, so files fixed or
+// removed since the last one drop off the list.
+func (s *store) replaceQuarantine(next map[string]invalidProfile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quarantine = next
+}
+
+// noteProfileFile records whether a single profile file loaded; bad is nil
+// when it did.
+func (s *store) noteProfileFile(name string, bad *invalidProfile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if bad == nil {
+		delete(s.quarantine, name)
+		return
+	}
+	if s.quarantine == nil {
+		s.quarantine = make(map[string]invalidProfile)
+	}
+	s.quarantine[name] = *bad
+}
+
+func (s *store) invalidProfiles() []invalidProfile {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]invalidProfile, 0, len(s.quarantine))
+	for _, e := range s.quarantine {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].File < out[j].File })
+	return out
+}
+
+func (s *store) invalidProfilesCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.quarantine)
+}
+
+func (s *store) handleProfilesInvalid(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	bad := s.invalidProfiles()
+	writeJSON(w, http.StatusOK, map[string]any{"count": len(bad), "profiles": bad})
+}
+
+// handleProfilesReload rescans PROFILES_DIR, picking up files edited on disk
+// and clearing quarantine entries that have been fixed.
+func (s *store) handleProfilesReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !s.requireAPIKey(w, r) {
+		return
+	}
+	s.profileFileMu.Lock()
+	err := s.loadAll()
+	s.profileFileMu.Unlock()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "reload_failed"})
+		return
+	}
+	n, bad := len(s.profiles.load()), s.invalidProfilesCount()
+	slog.Info("profiles_reloaded", "profiles", n, "invalid", bad)
+	writeJSON(w, http.StatusOK, map[string]any{"status": "reloaded", "profiles_count": n, "invalid_count": bad})
+}
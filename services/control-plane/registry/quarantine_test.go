@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInvalidProfilesQuarantine(t *testing.T) {
+	s := newBatchTestStore(t, map[string]string{"alpha": ""})
+	broken := filepath.Join(s.profilesDir, "broken.yaml")
+	if err := os.WriteFile(broken, []byte("id: broken\nname: [unterminated\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(s.profilesDir, "noid.yaml"), []byte("name: x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.loadAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleProfilesInvalid(rec, httptest.NewRequest(http.MethodGet, "/profiles/invalid", nil))
+	var out struct {
+		Count    int              `json:"count"`
+		Profiles []invalidProfile `json:"profiles"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Count != 2 || out.Profiles[0].File != "broken.yaml" || out.Profiles[1].Error != "missing_id" {
+		t.Fatalf("quarantine: %s", rec.Body.String())
+	}
+	if e := out.Profiles[0]; e.Error == "" || e.Size == 0 || e.ModTime == "" {
+		t.Fatalf("entry details: %+v", e)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleHealth(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var health map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &health)
+	if health["status"] != "degraded" || health["invalid_profiles_count"] != float64(2) || health["profiles_count"] != float64(1) {
+		t.Fatalf("health: %v", health)
+	}
+	rec = httptest.NewRecorder()
+	s.handleProfilesList(rec, httptest.NewRequest(http.MethodGet, "/profiles", nil))
+	if rec.Header().Get("X-Invalid-Profiles") != "2" {
+		t.Fatalf("list header: %v", rec.Header())
+	}
+
+	// Fixing the file and reloading clears its entry.
+	if err := os.WriteFile(broken, []byte("id: broken\nname: fixed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/profiles:reload", nil)
+	req.Header.Set("X-API-Key", "k")
+	rec = httptest.NewRecorder()
+	s.handleProfilesReload(rec, req)
+	var reload map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &reload)
+	if rec.Code != http.StatusOK || reload["profiles_count"] != float64(2) || reload["invalid_count"] != float64(1) {
+		t.Fatalf("reload: %d %v", rec.Code, reload)
+	}
+	if bad := s.invalidProfiles(); len(bad) != 1 || bad[0].File != "noid.yaml" {
+		t.Fatalf("after fix: %+v", bad)
+	}
+}
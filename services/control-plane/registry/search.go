@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Profile search ---
+
+// profileSearch holds the search parameters of GET /profiles. Without any
+// of them the list answers a bare array as before; with one, an envelope
+// with the counts the UI pages with.
+type profileSearch struct {
+	q           string // lower-cased substring of id, name or content
+	enabled     *bool
+	maxInterval time.Duration // 0 means no interval filter
+	active      bool
+}
+
+// parseProfileSearch reads q, enabled and interval. The second result is an
+// error code for a malformed parameter.
+func parseProfileSearch(r *http.Request) (profileSearch, string) {
+	var ps profileSearch
+	query := r.URL.Query()
+	if v := strings.TrimSpace(query.Get("q")); v != "" {
+		ps.q = strings.ToLower(v)
+		ps.active = true
+	}
+	if v := strings.TrimSpace(query.Get("enabled")); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return ps, "invalid_enabled"
+		}
+		ps.enabled = &b
+		ps.active = true
+	}
+	if v := strings.TrimSpace(query.Get("interval")); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return ps, "invalid_interval"
+		}
+		ps.maxInterval = d
+		ps.active = true
+	}
+	return ps, ""
+}
+
+// matches applies the search to one profile. A profile without overrides
+// is enabled; one without an interval never matches an interval filter.
+func (ps profileSearch) matches(p Profile) bool {
+	if ps.q != "" &&
+		!strings.Contains(strings.ToLower(p.ID), ps.q) &&
+		!strings.Contains(strings.ToLower(p.Name), ps.q) &&
+		!strings.Contains(strings.ToLower(p.Content), ps.q) {
+		return false
+	}
+	if ps.enabled != nil && p.isEnabled() != *ps.enabled {
+		return false
+	}
+	if ps.maxInterval > 0 {
+		d, err := time.ParseDuration(p.Interval)
+		if p.Interval == "" || err != nil || d > ps.maxInterval {
+			return false
+		}
+	}
+	return true
+}
+
+func (p Profile) isEnabled() bool {
+	return p.Enabled == nil || *p.Enabled
+}
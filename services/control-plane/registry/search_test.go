@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func searchProfiles(t *testing.T, s *store, query string) (int, []string, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.handleProfilesList(rec, httptest.NewRequest(http.MethodGet, "/profiles"+query, nil))
+	var env struct {
+		Profiles []Profile `json:"profiles"`
+		Total    int       `json:"total"`
+		Filtered int       `json:"filtered"`
+	}
+	var raw map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &raw)
+	_ = json.Unmarshal(rec.Body.Bytes(), &env)
+	ids := []string{}
+	for _, p := range env.Profiles {
+		ids = append(ids, p.ID)
+	}
+	return rec.Code, ids, raw
+}
+
+func newSearchStore() *store {
+	s := newTestStore("")
+	s.putProfile(Profile{ID: "census-pop", Name: "Census Population", Content: "source:\n  url: https://api.census.gov\n", Interval: "1h"})
+	s.putProfile(Profile{ID: "bls-cpi", Name: "Consumer Prices", Content: "source:\n  url: https://api.bls.gov\n", Interval: "15m", Enabled: boolPtr(false)})
+	s.putProfile(Profile{ID: "crypto-btc", Name: "Bitcoin", Content: "source:\n  url: https://data-api.binance.vision\n", Interval: "30s"})
+	s.putProfile(Profile{ID: "weather", Name: "Weather", Content: "source:\n  url: https://api.weather.gov\n"})
+	return s
+}
+
+func TestProfileSearchFilters(t *testing.T) {
+	s := newSearchStore()
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"?q=CENSUS", []string{"census-pop"}},         // id, case-insensitive
+		{"?q=consumer", []string{"bls-cpi"}},          // name
+		{"?q=binance.vision", []string{"crypto-btc"}}, // content
+		{"?q=https://api.", []string{"bls-cpi", "census-pop", "weather"}},
+		{"?enabled=false", []string{"bls-cpi"}},
+		{"?enabled=true", []string{"census-pop", "crypto-btc", "weather"}},
+		{"?interval=15m", []string{"bls-cpi", "crypto-btc"}}, // no interval never matches
+		{"?interval=1m&enabled=true", []string{"crypto-btc"}},
+		{"?q=nothing-matches", []string{}},
+	}
+	for _, c := range cases {
+		code, ids, raw := searchProfiles(t, s, c.query)
+		if code != http.StatusOK || !reflect.DeepEqual(ids, c.want) {
+			t.Errorf("%s: got %d %v, want %v", c.query, code, ids, c.want)
+			continue
+		}
+		if raw["total"] != float64(4) || raw["filtered"] != float64(len(c.want)) {
+			t.Errorf("%s: total=%v filtered=%v", c.query, raw["total"], raw["filtered"])
+		}
+	}
+}
+
+func TestProfileSearchInvalidParams(t *testing.T) {
+	s := newSearchStore()
+	for query, want := range map[string]string{"?enabled=maybe": "invalid_enabled", "?interval=soon": "invalid_interval", "?interval=-1m": "invalid_interval"} {
+		code, _, raw := searchProfiles(t, s, query)
+		if code != http.StatusBadRequest || raw["error"] != want {
+			t.Errorf("%s: got %d %v, want 400 %s", query, code, raw, want)
+		}
+	}
+}
+
+func TestProfilesListWithoutSearchStaysArray(t *testing.T) {
+	s := newSearchStore()
+	rec := httptest.NewRecorder()
+	s.handleProfilesList(rec, httptest.NewRequest(http.MethodGet, "/profiles", nil))
+	var out []Profile
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil || len(out) != 4 {
+		t.Fatalf("plain list should stay an array of all profiles: %v %s", err, rec.Body.String())
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import "sync/atomic"
+
+// profileSet is an immutable id → profile map. Readers load the current set
+// without locking; writers copy it, apply their change and swap the pointer.
+type profileSet map[string]Profile
+
+// profileSnapshot holds the current profileSet. The zero value is an empty
+// set; writers must hold store.writeMu.
+type profileSnapshot struct {
+	p atomic.Pointer[profileSet]
+}
+
+func (s *profileSnapshot) load() profileSet {
+	if p := s.p.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+func (s *profileSnapshot) store(next profileSet) {
+	s.p.Store(&next)
+}
+
+func (s *store) profile(id string) (Profile, bool) {
+	p, ok := s.profiles.load()[id]
+	return p, ok
+}
+
+func (s *store) putProfile(p Profile) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	cur := s.profiles.load()
+	next := make(profileSet, len(cur)+1)
+	for k, v := range cur {
+		next[k] = v
+	}
+	next[p.ID] = p
+	s.profiles.store(next)
+	s.storeGraph(next)
+}
+
+func (s *store) deleteProfile(id string) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	cur := s.profiles.load()
+	next := make(profileSet, len(cur))
+	for k, v := range cur {
+		if k != id {
+			next[k] = v
+		}
+	}
+	s.profiles.store(next)
+	s.storeGraph(next)
+}
+
+func (s *store) replaceProfiles(next profileSet) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.profiles.store(next)
+	s.storeGraph(next)
+}
+
+// storeGraph publishes the dependency graph of next. Callers hold writeMu.
+func (s *store) storeGraph(next profileSet) {
+	g := buildDepGraph(next)
+	s.graph.Store(&g)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func snapshotTestProfiles(n int) profileSet {
+	set := make(profileSet, n)
+	content := strings.Repeat("# filler line for a realistically sized profile\n", 200)
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("p%03d", i)
+		set[id] = Profile{ID: id, Digest: "d-" + id, Content: content}
+	}
+	return set
+}
+
+// Run with -race: readers list and get profiles while writers put, delete and
+// replace the whole set.
+func TestProfileSnapshotConcurrentAccess(t *testing.T) {
+	s := newTestStore("")
+	s.replaceProfiles(snapshotTestProfiles(50))
+
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() {
+				rec := httptest.NewRecorder()
+				s.handleProfilesList(rec, httptest.NewRequest(http.MethodGet, "/profiles", nil))
+				var out []Profile
+				if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil || len(out) < 49 {
+					t.Errorf("list saw a partial set: %d profiles, %v", len(out), err)
+					return
+				}
+				if p, ok := s.profile("p000"); ok && p.ID != "p000" {
+					t.Errorf("torn read: %+v", p.ID)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		s.putProfile(Profile{ID: "extra", Digest: fmt.Sprint(i)})
+		s.deleteProfile("extra")
+		s.deleteProfile("p001")
+		s.replaceProfiles(snapshotTestProfiles(50))
+	}
+	stop.Store(true)
+	wg.Wait()
+
+	if n := len(s.profiles.load()); n != 50 {
+		t.Fatalf("expected 50 profiles at the end, got %d", n)
+	}
+	if _, ok := s.profile("extra"); ok {
+		t.Fatal("deleted profile still visible")
+	}
+}
+
+func TestProfileSnapshotIsImmutable(t *testing.T) {
+	s := newTestStore("", "a")
+	before := s.profiles.load()
+	s.putProfile(Profile{ID: "b"})
+	s.deleteProfile("a")
+	if len(before) != 1 || before["a"].ID != "a" {
+		t.Fatalf("a loaded snapshot must not change under the reader: %v", before)
+	}
+	if _, ok := s.profile("a"); ok || len(s.profiles.load()) != 1 {
+		t.Fatalf("current set should hold only b: %v", s.profiles.load())
+	}
+}
+
+// BenchmarkProfilesListDuringReloads measures list throughput while another
+// goroutine keeps replacing the whole set, as the periodic reload does. The
+// rwmutex case is the previous design (map behind an RWMutex, held while
+// encoding) kept here as the baseline.
+func BenchmarkProfilesListDuringReloads(b *testing.B) {
+	set := snapshotTestProfiles(200)
+	clone := func() profileSet {
+		next := make(profileSet, len(set))
+		for k, v := range set {
+			next[k] = v
+		}
+		return next
+	}
+	bench := func(b *testing.B, reload func(), list func()) {
+		var stop atomic.Bool
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for !stop.Load() {
+				reload()
+				time.Sleep(100 * time.Microsecond)
+			}
+		}()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				list()
+			}
+		})
+		b.StopTimer()
+		stop.Store(true)
+		<-done
+	}
+
+	b.Run("snapshot", func(b *testing.B) {
+		s := newTestStore("")
+		s.replaceProfiles(clone())
+		req := httptest.NewRequest(http.MethodGet, "/profiles", nil)
+		bench(b, func() { s.replaceProfiles(clone()) }, func() { s.handleProfilesList(httptest.NewRecorder(), req) })
+	})
+	b.Run("rwmutex", func(b *testing.B) {
+		var mu sync.RWMutex
+		m := clone()
+		bench(b, func() {
+			next := clone()
+			mu.Lock()
+			m = next
+			mu.Unlock()
+		}, func() {
+			mu.RLock()
+			out := make([]Profile, 0, len(m))
+			for _, p := range m {
+				out = append(out, p)
+			}
+			sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+			writeJSON(httptest.NewRecorder(), http.StatusOK, out)
+			mu.RUnlock()
+		})
+	})
+}
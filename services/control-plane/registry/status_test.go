@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// flappingAggregator serves /runs until down is set, then fails every call.
+func flappingAggregator(t *testing.T, down *atomic.Bool, calls *atomic.Int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		ids := r.URL.Query()["profile_id"]
+		out := make([]map[string]any, 0, len(ids))
+		for _, id := range ids {
+			out = append(out, map[string]any{"profile_id": id, "run_id": "run-" + id, "status": "succeeded"})
+		}
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+}
+
+func newTestStore(aggURL string, ids ...string) *store {
+	s := &store{
+		fieldsCache: make(map[string]cachedFields),
+		lastRuns:    make(map[string]cachedRun),
+		aggURL:      aggURL,
+		client:      &http.Client{Timeout: time.Second},
+	}
+	for _, id := range ids {
+		s.putProfile(Profile{ID: id, Digest: "d-" + id})
+	}
+	return s
+}
+
+func getStatus(t *testing.T, s *store, id string) (int, statusBridge) {
+	t.Helper()
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/profiles/"+id+"/status", nil), map[string]string{"id": id})
+	rec := httptest.NewRecorder()
+	s.handleProfileStatus(rec, req)
+	var out statusBridge
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	return rec.Code, out
+}
+
+func TestProfileStatusServesStaleRunWhenAggregatorDown(t *testing.T) {
+	var down atomic.Bool
+	var calls atomic.Int32
+	agg := flappingAggregator(t, &down, &calls)
+	defer agg.Close()
+	s := newTestStore(agg.URL, "alpha", "beta")
+
+	down.Store(true)
+	if code, _ := getStatus(t, s, "alpha"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 before any successful fetch, got %d", code)
+	}
+
+	down.Store(false)
+	code, st := getStatus(t, s, "alpha")
+	if code != http.StatusOK || st.Stale || st.LastRun["run_id"] != "run-alpha" || st.FetchedAt == "" {
+		t.Fatalf("unexpected live status: %d %+v", code, st)
+	}
+
+	down.Store(true)
+	code, st = getStatus(t, s, "alpha")
+	if code != http.StatusOK || !st.Stale || st.LastRun["run_id"] != "run-alpha" {
+		t.Fatalf("expected cached stale status, got %d %+v", code, st)
+	}
+	if code, _ := getStatus(t, s, "beta"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 for never-fetched profile, got %d", code)
+	}
+}
+
+func TestProfilesStatusBatchesAggregatorCall(t *testing.T) {
+	var down atomic.Bool
+	var calls atomic.Int32
+	agg := flappingAggregator(t, &down, &calls)
+	defer agg.Close()
+	s := newTestStore(agg.URL, "alpha", "beta", "gamma")
+
+	list := func() (int, []statusBridge) {
+		rec := httptest.NewRecorder()
+		s.handleProfilesStatus(rec, httptest.NewRequest(http.MethodGet, "/profiles:status", nil))
+		var out []statusBridge
+		_ = json.Unmarshal(rec.Body.Bytes(), &out)
+		return rec.Code, out
+	}
+
+	code, out := list()
+	if code != http.StatusOK || len(out) != 3 || calls.Load() != 1 {
+		t.Fatalf("expected 3 statuses from one call, got %d %d calls=%d", code, len(out), calls.Load())
+	}
+	for _, st := range out {
+		if st.Stale || st.LastRun["run_id"] != "run-"+st.ProfileID {
+			t.Fatalf("unexpected status %+v", st)
+		}
+	}
+
+	down.Store(true)
+	code, out = list()
+	if code != http.StatusOK || len(out) != 3 {
+		t.Fatalf("expected cached statuses, got %d %d", code, len(out))
+	}
+	for _, st := range out {
+		if !st.Stale || st.LastRun == nil {
+			t.Fatalf("expected stale cached status, got %+v", st)
+		}
+	}
+}
+
+func TestProfilesStatusChunksLargeRegistries(t *testing.T) {
+	var down atomic.Bool
+	var calls atomic.Int32
+	agg := flappingAggregator(t, &down, &calls)
+	defer agg.Close()
+	ids := make([]string, 2*lastRunsBatch+5)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("p%03d", i)
+	}
+	s := newTestStore(agg.URL, ids...)
+
+	rec := httptest.NewRecorder()
+	s.handleProfilesStatus(rec, httptest.NewRequest(http.MethodGet, "/profiles:status", nil))
+	var out []statusBridge
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	if rec.Code != http.StatusOK || len(out) != len(ids) || calls.Load() != 3 {
+		t.Fatalf("expected %d statuses from 3 calls, got %d %d calls=%d", len(ids), rec.Code, len(out), calls.Load())
+	}
+	for _, st := range out {
+		if st.LastRun["run_id"] != "run-"+st.ProfileID {
+			t.Fatalf("missing status %+v", st)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
@@ -62,6 +63,7 @@ type tableRow struct {
 }
 
 func main() {
+	setupLogging()
 	aggURL := strings.TrimSpace(os.Getenv("AGGREGATOR_URL"))
 	if aggURL == "" {
 		aggURL = defaultAggURL
@@ -82,9 +84,9 @@ func main() {
 
 	addr := ":" + defaultPort
 	srv := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
-	logLine("INFO", "starting", "addr=%s aggregator_url=%s", addr, aggURL)
+	slog.Info("starting", "addr", addr, "aggregator_url", aggURL)
 	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		logLine("ERROR", "listen_failed", "err=%s", err.Error())
+		slog.Error("listen_failed", "err", err)
 		os.Exit(1)
 	}
 }
@@ -532,15 +534,19 @@ func withRequestLogging(next http.Handler) http.Handler {
 		next.ServeHTTP(rec, r)
 		dur := time.Since(start).Milliseconds()
 		metricsRecord(rec.status, dur)
-		level := "INFO"
+		level := slog.LevelInfo
 		if rec.status >= 500 {
-			level = "ERROR"
+			level = slog.LevelError
 		} else if rec.status >= 400 {
-			level = "WARN"
+			level = slog.LevelWarn
 		}
-		ts := time.Now().UTC().Format(time.RFC3339)
-		fmt.Fprintf(os.Stdout, "%s %s method=%s path=%s status=%d duration_ms=%d\n",
-			ts, level, r.Method, r.URL.Path, rec.status, dur)
+		slog.Log(r.Context(), level, "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", dur,
+			"request_id", strings.TrimSpace(r.Header.Get("X-Request-ID")),
+		)
 	})
 }
 
@@ -578,12 +584,6 @@ func mathSqrt(v float64) float64 {
 	return x
 }
 
-func logLine(level, msg, format string, args ...any) {
-	ts := time.Now().UTC().Format(time.RFC3339)
-	line := fmt.Sprintf(format, args...)
-	fmt.Fprintf(os.Stdout, "%s %s %s %s\n", ts, level, msg, line)
-}
-
 // --- minimal metrics ---
 
 var metricsMu sync.Mutex
@@ -8,7 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -38,6 +38,7 @@ type config struct {
 	TenantHeader    string
 	LocalTenant     string
 	MaxEvents       int
+	SchemaMode      string
 }
 type observation struct {
 	TenantID  string            `json:"tenant_id"`
@@ -172,7 +173,7 @@ type server struct {
 	reqN uint64
 }
 func main() {
-	log.SetFlags(0)
+	setupLogging()
 cfg := loadConfig()
 s := &server{
 		cfg: cfg,
@@ -183,6 +184,7 @@ mux.HandleFunc("/health", s.handleHealth)
 mux.HandleFunc("/ready", s.handleReady)
 mux.HandleFunc("/v0/observe", s.withMiddleware(s.handleObserve))
 mux.HandleFunc("/v0/metrics", s.withMiddleware(s.handleMetrics))
+mux.HandleFunc("/v0/schema", s.handleSchema)
 h := &http.Server{
 		Addr:              netAddr(cfg.Addr, cfg.Port),
 		Handler:           mux,
@@ -260,6 +262,10 @@ func (s *server) handlePostObserve(w http.ResponseWriter, r *http.Request, tenan
 		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "service/kind/status required"})
 		return
 	}
+	if err := applySchema(&in, s.cfg.SchemaMode); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
 	if in.TS == "" {
 		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "ts required"})
 		return
@@ -349,6 +355,20 @@ func (s *server) withMiddleware(next func(http.ResponseWriter, *http.Request, st
 		if isLocal && tenantID == "" {
 			tenantID = s.cfg.LocalTenant
 		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		w = rec
+		defer func() {
+			slog.InfoContext(r.Context(), "request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", rec.status,
+				"duration_ms", time.Since(start).Milliseconds(),
+				"request_id", reqID,
+				"tenant_id", tenantID,
+				"remote", r.RemoteAddr,
+			)
+		}()
 		defer func() {
 			if rec := recover(); rec != nil {
 				logJSON("error", "panic_recovered", map[string]any{
@@ -358,13 +378,6 @@ func (s *server) withMiddleware(next func(http.ResponseWriter, *http.Request, st
 				writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "internal"})
 			}
 		}()
-		logJSON("info", "request", map[string]any{
-			"method":     r.Method,
-			"path":       r.URL.Path,
-			"tenant_id":  tenantID,
-			"request_id": reqID,
-			"remote":     r.RemoteAddr,
-		})
 		next(w, r, tenantID, reqID)
 	}
 }
@@ -426,6 +439,7 @@ func loadConfig() config {
 		TenantHeader:    "X-Tenant-Id",
 		LocalTenant:     "local",
 		MaxEvents:       maxEvents,
+		SchemaMode:      parseSchemaMode(getenv("OBSERVER_SCHEMA_MODE", schemaModeNormalize)),
 	}
 }
 func decodeJSONStrict(r io.Reader, out any) error {
@@ -438,10 +452,7 @@ func decodeJSONStrict(r io.Reader, out any) error {
 		return errors.New("invalid json")
 	}
 	var extra any
-	if err := dec.Decode(&extra); err == nil {
-		return errors.New("trailing json")
-	}
-	if !errors.Is(err := dec.Decode(&extra), io.EOF) {
+	if err := dec.Decode(&extra); !errors.Is(err, io.EOF) {
 		return errors.New("trailing json")
 	}
 	return nil
@@ -452,29 +463,6 @@ func writeJSON(w http.ResponseWriter, code int, v any) {
 	enc := json.NewEncoder(w)
 	_ = enc.Encode(v)
 }
-func logJSON(level string, event string, fields map[string]any) {
-	type kv struct {
-		K string `json:"k"`
-		V any    `json:"v"`
-	}
-	if fields == nil {
-		fields = map[string]any{}
-	}
-	fields["level"] = level
-	fields["event"] = event
-
-	keys := make([]string, 0, len(fields))
-	for k := range fields {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-	arr := make([]kv, 0, len(keys))
-	for _, k := range keys {
-		arr = append(arr, kv{K: k, V: fields[k]})
-	}
-	b, _ := json.Marshal(arr)
-	log.Print(string(b))
-}
 func parseRFC3339(s string) (time.Time, error) {
 	s = norm(s)
 	if s == "" {
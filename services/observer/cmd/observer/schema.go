@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	schemaModeNormalize = "normalize"
+	schemaModeStrict    = "strict"
+	schemaVersion       = 1
+)
+
+// Accepted observation kinds and statuses. Aliases map common producer
+// spellings onto them; matching is case-insensitive and treats "-" and " "
+// like "_".
+var (
+	schemaKinds    = []string{"http_request", "run", "heartbeat", "ingest", "custom"}
+	schemaStatuses = []string{"ok", "warn", "error"}
+	kindAliases    = map[string]string{
+		"http":         "http_request",
+		"request":      "http_request",
+		"httprequest":  "http_request",
+		"http_req":     "http_request",
+		"job":          "run",
+		"job_run":      "run",
+		"hb":           "heartbeat",
+		"ping":         "heartbeat",
+		"ingestion":    "ingest",
+		"ingest_batch": "ingest",
+	}
+	statusAliases = map[string]string{
+		"success":   "ok",
+		"succeeded": "ok",
+		"pass":      "ok",
+		"passed":    "ok",
+		"healthy":   "ok",
+		"warning":   "warn",
+		"degraded":  "warn",
+		"err":       "error",
+		"fail":      "error",
+		"failed":    "error",
+		"failure":   "error",
+		"fatal":     "error",
+		"critical":  "error",
+		"unhealthy": "error",
+	}
+)
+
+// In normalize mode unknown values are replaced by these and the original
+// value is kept in meta.
+const (
+	unknownKindFallback   = "custom"
+	unknownStatusFallback = "warn"
+)
+
+func schemaKey(s string) string {
+	s = strings.ToLower(normCollapse(s))
+	s = strings.ReplaceAll(s, "-", "_")
+	return strings.ReplaceAll(s, " ", "_")
+}
+func canonicalValue(raw string, allowed []string, aliases map[string]string) (string, bool) {
+	k := schemaKey(raw)
+	for _, a := range allowed {
+		if k == a {
+			return a, true
+		}
+	}
+	if v, ok := aliases[k]; ok {
+		return v, true
+	}
+	return k, false
+}
+
+// applySchema canonicalizes in.Kind and in.Status. In strict mode unknown
+// values are rejected; otherwise they fall back and the raw value is kept in
+// meta as kind_raw / status_raw.
+func applySchema(in *observation, mode string) error {
+	kind, kindOK := canonicalValue(in.Kind, schemaKinds, kindAliases)
+	status, statusOK := canonicalValue(in.Status, schemaStatuses, statusAliases)
+	if mode == schemaModeStrict {
+		if !kindOK {
+			return fmt.Errorf("unknown kind: %s", in.Kind)
+		}
+		if !statusOK {
+			return fmt.Errorf("unknown status: %s", in.Status)
+		}
+	}
+	if in.Meta == nil {
+		in.Meta = map[string]string{}
+	}
+	if !kindOK {
+		in.Meta["kind_raw"] = in.Kind
+		kind = unknownKindFallback
+	}
+	if !statusOK {
+		in.Meta["status_raw"] = in.Status
+		status = unknownStatusFallback
+	}
+	in.Kind = kind
+	in.Status = status
+	return nil
+}
+func parseSchemaMode(s string) string {
+	if strings.EqualFold(strings.TrimSpace(s), schemaModeStrict) {
+		return schemaModeStrict
+	}
+	return schemaModeNormalize
+}
+func (s *server) handleSchema(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method not allowed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"version":  schemaVersion,
+		"mode":     s.cfg.SchemaMode,
+		"kinds":    schemaKinds,
+		"statuses": schemaStatuses,
+		"aliases": map[string]any{
+			"kinds":    kindAliases,
+			"statuses": statusAliases,
+		},
+		"unknown": map[string]any{
+			"kind":   unknownKindFallback,
+			"status": unknownStatusFallback,
+			"meta":   []string{"kind_raw", "status_raw"},
+		},
+	})
+}
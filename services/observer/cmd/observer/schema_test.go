@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplySchemaNormalizesAliases(t *testing.T) {
+	cases := []struct {
+		kind, status         string
+		wantKind, wantStatus string
+		wantMeta             map[string]string
+	}{
+		{"HTTP-Request", "Error", "http_request", "error", nil},
+		{"http", "ERR", "http_request", "error", nil},
+		{" Heartbeat ", "success", "heartbeat", "ok", nil},
+		{"job", "Warning", "run", "warn", nil},
+		{"Ingestion", "failed", "ingest", "error", nil},
+		{"deploy", "flaky", "custom", "warn", map[string]string{"kind_raw": "deploy", "status_raw": "flaky"}},
+	}
+	for _, tc := range cases {
+		in := observation{Kind: tc.kind, Status: tc.status}
+		if err := applySchema(&in, schemaModeNormalize); err != nil {
+			t.Fatalf("%s/%s: %v", tc.kind, tc.status, err)
+		}
+		if in.Kind != tc.wantKind || in.Status != tc.wantStatus {
+			t.Fatalf("%s/%s: got %s/%s want %s/%s", tc.kind, tc.status, in.Kind, in.Status, tc.wantKind, tc.wantStatus)
+		}
+		for k, v := range tc.wantMeta {
+			if in.Meta[k] != v {
+				t.Fatalf("%s/%s: meta[%s]=%q want %q", tc.kind, tc.status, k, in.Meta[k], v)
+			}
+		}
+		if tc.wantMeta == nil && len(in.Meta) != 0 {
+			t.Fatalf("%s/%s: unexpected meta %v", tc.kind, tc.status, in.Meta)
+		}
+	}
+}
+
+func TestStrictSchemaRejectsUnknownValues(t *testing.T) {
+	s := &server{cfg: config{Env: "local", LocalTenant: "local", TenantHeader: "X-Tenant-Id", SchemaMode: schemaModeStrict}, st: newStore(10)}
+	h := s.withMiddleware(s.handleObserve)
+	post := func(kind, status string) *httptest.ResponseRecorder {
+		body := `{"service":"gateway","kind":"` + kind + `","status":"` + status + `","ts":"2026-01-01T00:00:00Z"}`
+		rr := httptest.NewRecorder()
+		h(rr, httptest.NewRequest(http.MethodPost, "/v0/observe", strings.NewReader(body)))
+		return rr
+	}
+
+	if rr := post("Run", "Succeeded"); rr.Code != http.StatusAccepted {
+		t.Fatalf("aliases must be accepted in strict mode: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := post("deploy", "ok"); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "unknown kind: deploy") {
+		t.Fatalf("expected unknown kind rejection, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := post("run", "maybe"); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "unknown status: maybe") {
+		t.Fatalf("expected unknown status rejection, got %d %s", rr.Code, rr.Body.String())
+	}
+	if got := s.st.list("local", "", time.Time{}, false, 10); len(got) != 1 || got[0].Kind != "run" || got[0].Status != "ok" {
+		t.Fatalf("expected one normalized observation, got %+v", got)
+	}
+
+	rr := httptest.NewRecorder()
+	s.handleSchema(rr, httptest.NewRequest(http.MethodGet, "/v0/schema", nil))
+	var doc struct {
+		Mode     string   `json:"mode"`
+		Kinds    []string `json:"kinds"`
+		Statuses []string `json:"statuses"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Mode != schemaModeStrict || len(doc.Kinds) != 5 || strings.Join(doc.Statuses, ",") != "ok,warn,error" {
+		t.Fatalf("unexpected schema document: %+v", doc)
+	}
+}
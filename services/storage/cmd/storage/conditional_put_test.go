@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newTestAPI() (*api, http.Handler) {
+	a := newAPI(config{MaxObjectBytes: 1 << 20}, newJSONLogger(io.Discard), newMemoryStore())
+	return a, chain(http.HandlerFunc(a.handleObjects), tenantMW(config{}))
+}
+
+func putObject(h http.Handler, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/v0/objects?key=doc", strings.NewReader(body))
+	req.Header.Set("X-Tenant-Id", "t1")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPutCreateOnly(t *testing.T) {
+	_, h := newTestAPI()
+	if rec := putObject(h, "v1", map[string]string{"If-None-Match": "*"}); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 on first create, got %d", rec.Code)
+	}
+	if rec := putObject(h, "v2", map[string]string{"If-None-Match": "*"}); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 on second create, got %d", rec.Code)
+	}
+}
+
+func TestPutIfMatchStaleETag(t *testing.T) {
+	_, h := newTestAPI()
+	if rec := putObject(h, "v1", map[string]string{"If-Match": `"nope"`}); rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for If-Match on missing object, got %d", rec.Code)
+	}
+	first := putObject(h, "v1", nil).Header().Get("ETag")
+	second := putObject(h, "v2", map[string]string{"If-Match": first})
+	if second.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for matching etag, got %d", second.Code)
+	}
+	if rec := putObject(h, "v3", map[string]string{"If-Match": first}); rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for stale etag, got %d", rec.Code)
+	}
+	if rec := putObject(h, "v3", map[string]string{"If-Match": `"other", ` + second.Header().Get("ETag")}); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 when any listed etag matches, got %d", rec.Code)
+	}
+}
+
+func TestPutIfMatchConcurrentOverwrites(t *testing.T) {
+	a, h := newTestAPI()
+	base := putObject(h, "base", nil).Header().Get("ETag")
+
+	const writers = 16
+	codes := make(chan int, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes <- putObject(h, "writer-"+string(rune('a'+i)), map[string]string{"If-Match": base}).Code
+		}(i)
+	}
+	wg.Wait()
+	close(codes)
+
+	won := 0
+	for code := range codes {
+		switch code {
+		case http.StatusCreated:
+			won++
+		case http.StatusPreconditionFailed:
+		default:
+			t.Fatalf("unexpected status %d", code)
+		}
+	}
+	if won != 1 {
+		t.Fatalf("expected exactly one writer to win, got %d", won)
+	}
+	if obj, _ := a.store.get("t1", "doc"); !strings.HasPrefix(string(obj.body), "writer-") {
+		t.Fatalf("unexpected final body %q", obj.body)
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// Store (file)
+////////////////////////////////////////////////////////////////////////////////
+
+// fileStore persists each object as <dir>/<tenant>/<sha256(key)>.<etag> with
+// a sidecar <sha256(key)>.json holding its objectMeta. The body is named by
+// its ETag, a digest of its content, so the sidecar names exactly the body it
+// describes: an overwrite writes the new body, then repoints the sidecar, then
+// removes the old body. Metadata is indexed in memory at open; bodies are read
+// from disk on demand. All file writes happen under the store lock and land via
+// rename, so readers never see partial files.
+type fileStore struct {
+	dir string
+
+	mu sync.RWMutex
+
+	// tenant -> key -> meta
+	index map[string]map[string]objectMeta
+
+	now func() time.Time
+}
+
+func openFileStore(dir string) (*fileStore, error) {
+	if strings.TrimSpace(dir) == "" {
+		return nil, errors.New("STORAGE_DATA_DIR is required for the file backend")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &fileStore{dir: dir, index: make(map[string]map[string]objectMeta), now: time.Now}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load rebuilds the index from sidecars. Entries whose body is missing or
+// has a different size are skipped. Bodies no sidecar points at (left by a
+// crash mid-overwrite) and temp files are removed; a body in the older
+// <sha256(key)> layout is renamed to its ETag name.
+func (s *fileStore) load() error {
+	tenants, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, td := range tenants {
+		if !td.IsDir() {
+			continue
+		}
+		dir := filepath.Join(s.dir, td.Name())
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		bodies := make(map[string]struct{})
+		for _, f := range files {
+			if !strings.HasSuffix(f.Name(), ".json") {
+				continue
+			}
+			b, err := os.ReadFile(filepath.Join(dir, f.Name()))
+			if err != nil {
+				continue
+			}
+			var meta objectMeta
+			if err := json.Unmarshal(b, &meta); err != nil {
+				continue
+			}
+			base, metaPath := s.paths(meta.TenantID, meta.Key)
+			if metaPath != filepath.Join(dir, f.Name()) {
+				continue
+			}
+			bodyPath, ok := bodyPathFor(base, meta.ETag)
+			if !ok {
+				continue
+			}
+			if _, err := os.Stat(bodyPath); os.IsNotExist(err) {
+				if fi, err := os.Stat(base); err == nil && fi.Size() == meta.SizeBytes {
+					_ = os.Rename(base, bodyPath)
+				}
+			}
+			fi, err := os.Stat(bodyPath)
+			if err != nil || fi.Size() != meta.SizeBytes {
+				continue
+			}
+			bodies[filepath.Base(bodyPath)] = struct{}{}
+			m, ok := s.index[meta.TenantID]
+			if !ok {
+				m = make(map[string]objectMeta)
+				s.index[meta.TenantID] = m
+			}
+			m[meta.Key] = meta
+		}
+		for _, f := range files {
+			if _, ok := bodies[f.Name()]; ok || f.IsDir() || strings.HasSuffix(f.Name(), ".json") {
+				continue
+			}
+			_ = os.Remove(filepath.Join(dir, f.Name()))
+		}
+	}
+	return nil
+}
+
+// tenantDirName keeps simple tenant ids readable and hex-encodes anything
+// that could escape the data dir. The "~" prefix cannot occur in readable names.
+func tenantDirName(tenant string) string {
+	safe := tenant != "" && !strings.HasPrefix(tenant, ".")
+	for _, c := range tenant {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return tenant
+	}
+	return "~" + hex.EncodeToString([]byte(tenant))
+}
+
+// paths returns the base name of an object's files and its sidecar path.
+func (s *fileStore) paths(tenant, key string) (base, meta string) {
+	sum := sha256.Sum256([]byte(key))
+	base = filepath.Join(s.dir, tenantDirName(tenant), hex.EncodeToString(sum[:]))
+	return base, base + ".json"
+}
+
+// bodyPathFor names the body with the given ETag. ETags are quoted hex
+// digests; anything else (a hand-edited sidecar) is refused.
+func bodyPathFor(base, etag string) (string, bool) {
+	digest := strings.Trim(etag, `"`)
+	if digest == "" {
+		return "", false
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		return "", false
+	}
+	return base + "." + digest, true
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *fileStore) put(tenant, key string, obj storedObject) error {
+	return s.putIf(tenant, key, obj, putCondition{})
+}
+
+func (s *fileStore) putIf(tenant, key string, obj storedObject, cond putCondition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, exists := s.index[tenant][key]
+	if exists && cur.expired(s.now()) {
+		exists = false
+	}
+	if err := cond.check(cur, exists); err != nil {
+		return err
+	}
+	metaJSON, err := json.Marshal(obj.meta)
+	if err != nil {
+		return err
+	}
+	base, metaPath := s.paths(tenant, key)
+	bodyPath, ok := bodyPathFor(base, obj.meta.ETag)
+	if !ok {
+		return errors.New("invalid etag")
+	}
+	// The new body lands under its own name first; until the sidecar is
+	// replaced, the old one still describes the old body.
+	if err := writeFileAtomic(bodyPath, obj.body); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(metaPath, metaJSON); err != nil {
+		_ = os.Remove(bodyPath)
+		return err
+	}
+	if old, ok := bodyPathFor(base, cur.ETag); ok && old != bodyPath {
+		_ = os.Remove(old)
+	}
+	m, ok := s.index[tenant]
+	if !ok {
+		m = make(map[string]objectMeta)
+		s.index[tenant] = m
+	}
+	m[key] = obj.meta
+	return nil
+}
+
+func (s *fileStore) get(tenant, key string) (storedObject, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	meta, ok := s.index[tenant][key]
+	if !ok || meta.expired(s.now()) {
+		return storedObject{}, false
+	}
+	base, _ := s.paths(tenant, key)
+	bodyPath, ok := bodyPathFor(base, meta.ETag)
+	if !ok {
+		return storedObject{}, false
+	}
+	b, err := os.ReadFile(bodyPath)
+	if err != nil {
+		return storedObject{}, false
+	}
+	return storedObject{body: b, meta: meta}, true
+}
+
+func (s *fileStore) getMeta(tenant, key string) (objectMeta, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	meta, ok := s.index[tenant][key]
+	if !ok || meta.expired(s.now()) {
+		return objectMeta{}, false
+	}
+	return meta, true
+}
+
+func (s *fileStore) list(tenant, prefix string, limit int, after string) ([]objectMeta, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := s.now()
+	keys := make([]string, 0, len(s.index[tenant]))
+	for k, meta := range s.index[tenant] {
+		if strings.HasPrefix(k, prefix) && k > after && !meta.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	more := false
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+		more = true
+	}
+	out := make([]objectMeta, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, s.index[tenant][k])
+	}
+	return out, more
+}
+
+func (s *fileStore) del(tenant, key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	meta, ok := s.index[tenant][key]
+	if !ok {
+		return false
+	}
+	if err := s.removeLocked(tenant, key); err != nil {
+		return false
+	}
+	return !meta.expired(s.now())
+}
+
+// removeLocked deletes the object's files and index entry; s.mu must be held.
+func (s *fileStore) removeLocked(tenant, key string) error {
+	base, metaPath := s.paths(tenant, key)
+	// Drop the sidecar first so a failed body removal cannot resurrect the
+	// object; load clears the body if it is left behind.
+	if err := os.Remove(metaPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if bodyPath, ok := bodyPathFor(base, s.index[tenant][key].ETag); ok {
+		_ = os.Remove(bodyPath)
+	}
+	m := s.index[tenant]
+	delete(m, key)
+	if len(m) == 0 {
+		delete(s.index, tenant)
+	}
+	return nil
+}
+
+func (s *fileStore) sweep() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	n := 0
+	for t, m := range s.index {
+		for k, meta := range m {
+			if meta.expired(now) && s.removeLocked(t, k) == nil {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func (s *fileStore) stats() map[string]any {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sizes := make(map[string][]int64, len(s.index))
+	now := s.now()
+	for t, m := range s.index {
+		for _, meta := range m {
+			if meta.expired(now) {
+				continue
+			}
+			sizes[t] = append(sizes[t], meta.SizeBytes)
+		}
+	}
+	out := storeStats(sizes)
+	out["backend"] = backendFile
+	out["data_dir"] = s.dir
+	return out
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newFileTestHandler(t *testing.T, dir string) http.Handler {
+	t.Helper()
+	cfg := config{MaxObjectBytes: 1 << 20, Backend: backendFile, DataDir: dir}
+	store, err := newObjectStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newAPI(cfg, newJSONLogger(io.Discard), store)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v0/objects", a.handleObjects)
+	mux.HandleFunc("/v0/objects/meta", a.handleObjectsMeta)
+	mux.HandleFunc("/v0/objects/list", a.handleObjectsList)
+	return chain(mux, tenantMW(config{}))
+}
+
+func doObject(h http.Handler, method, tenant, key, body, contentType string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/v0/objects?key="+url.QueryEscape(key), strings.NewReader(body))
+	req.Header.Set("X-Tenant-Id", tenant)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestFileStoreSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	h := newFileTestHandler(t, dir)
+
+	put := doObject(h, http.MethodPut, "t1", "reports/r1", `{"a":1}`, "application/json")
+	if put.Code != http.StatusCreated {
+		t.Fatalf("put status %d: %s", put.Code, put.Body.String())
+	}
+	etag := put.Header().Get("ETag")
+	doObject(h, http.MethodPut, "t1", "reports/r2", "two", "")
+	doObject(h, http.MethodPut, "../evil", "x", "escaped?", "")
+	if rec := doObject(h, http.MethodDelete, "t1", "reports/r2", "", ""); rec.Code != http.StatusOK {
+		t.Fatalf("delete status %d", rec.Code)
+	}
+
+	// Re-open the same directory as a restarted process would.
+	h = newFileTestHandler(t, dir)
+
+	get := doObject(h, http.MethodGet, "t1", "reports/r1", "", "")
+	if get.Code != http.StatusOK || get.Body.String() != `{"a":1}` {
+		t.Fatalf("get after restart: %d %q", get.Code, get.Body.String())
+	}
+	if got := get.Header().Get("ETag"); got != etag {
+		t.Fatalf("etag changed across restart: %s != %s", got, etag)
+	}
+	if ct := get.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("content type not persisted: %q", ct)
+	}
+	if got := listObjects(t, h, "t1", "prefix=reports/"); objectKeys(got.Objects) != "reports/r1" {
+		t.Fatalf("deleted object came back or listing lost: %+v", got)
+	}
+	if rec := doObject(h, http.MethodGet, "../evil", "x", "", ""); rec.Body.String() != "escaped?" {
+		t.Fatalf("tenant with path characters not round-tripped: %d %q", rec.Code, rec.Body.String())
+	}
+
+	// Conditional writes keep working against persisted ETags.
+	req := httptest.NewRequest(http.MethodPut, "/v0/objects?key=reports/r1", strings.NewReader("v2"))
+	req.Header.Set("X-Tenant-Id", "t1")
+	req.Header.Set("If-Match", etag)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("If-Match with persisted etag: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestFileStoreConcurrentPuts(t *testing.T) {
+	dir := t.TempDir()
+	h := newFileTestHandler(t, dir)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			doObject(h, http.MethodPut, "t1", fmt.Sprintf("k%02d", i%5), fmt.Sprintf("body-%d", i), "")
+		}(i)
+	}
+	wg.Wait()
+
+	h = newFileTestHandler(t, dir)
+	if got := listObjects(t, h, "t1", ""); got.Count != 5 {
+		t.Fatalf("expected 5 keys after reopen, got %+v", got)
+	}
+	for i := 0; i < 5; i++ {
+		rec := doObject(h, http.MethodGet, "t1", fmt.Sprintf("k%02d", i), "", "")
+		if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Body.String(), "body-") {
+			t.Fatalf("k%02d: %d %q", i, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestUnknownBackend(t *testing.T) {
+	if _, err := newObjectStore(config{Backend: "s3"}); err == nil {
+		t.Fatal("expected error for unknown backend")
+	}
+}
+
+// TestFileStoreCrashMidOverwrite replays a same-size overwrite that stopped
+// after the new body landed but before the sidecar was replaced.
+func TestFileStoreCrashMidOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	h := newFileTestHandler(t, dir)
+	first := doObject(h, http.MethodPut, "t1", "k", "aaaa", "text/plain")
+	if first.Code != http.StatusCreated {
+		t.Fatalf("put: %d", first.Code)
+	}
+
+	fs, err := openFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _ := fs.paths("t1", "k")
+	sum := sha256.Sum256([]byte("bbbb"))
+	orphan := base + "." + hex.EncodeToString(sum[:])
+	if err := os.WriteFile(orphan, []byte("bbbb"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	h = newFileTestHandler(t, dir)
+	get := doObject(h, http.MethodGet, "t1", "k", "", "")
+	if get.Body.String() != "aaaa" || get.Header().Get("ETag") != first.Header().Get("ETag") {
+		t.Fatalf("expected the old body under the old ETag, got %q %s", get.Body.String(), get.Header().Get("ETag"))
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Fatalf("orphaned body not removed: %v", err)
+	}
+
+	// A completed overwrite leaves only the new body.
+	if rec := doObject(h, http.MethodPut, "t1", "k", "cccc", "text/plain"); rec.Code != http.StatusCreated {
+		t.Fatalf("overwrite: %d", rec.Code)
+	}
+	files, _ := filepath.Glob(base + ".*")
+	if len(files) != 2 {
+		t.Fatalf("expected the sidecar and one body, got %v", files)
+	}
+}
+
+func TestFileStoreMigratesLegacyBodies(t *testing.T) {
+	dir := t.TempDir()
+	h := newFileTestHandler(t, dir)
+	put := doObject(h, http.MethodPut, "t1", "k", "legacy", "")
+	fs, err := openFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _ := fs.paths("t1", "k")
+	current, _ := bodyPathFor(base, put.Header().Get("ETag"))
+	if err := os.Rename(current, base); err != nil {
+		t.Fatal(err)
+	}
+
+	h = newFileTestHandler(t, dir)
+	if get := doObject(h, http.MethodGet, "t1", "k", "", ""); get.Body.String() != "legacy" {
+		t.Fatalf("legacy body not served: %d %q", get.Code, get.Body.String())
+	}
+	if _, err := os.Stat(current); err != nil {
+		t.Fatalf("legacy body not renamed: %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type listResponse struct {
+	Count      int          `json:"count"`
+	Objects    []objectMeta `json:"objects"`
+	NextCursor string       `json:"next_cursor"`
+}
+
+func listObjects(t *testing.T, h http.Handler, tenant, query string) listResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/v0/objects/list?"+query, nil)
+	req.Header.Set("X-Tenant-Id", tenant)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list status %d: %s", rec.Code, rec.Body.String())
+	}
+	var out listResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func newListTestHandler(t *testing.T, keys ...string) http.Handler {
+	t.Helper()
+	a, _ := newTestAPI()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v0/objects", a.handleObjects)
+	mux.HandleFunc("/v0/objects/list", a.handleObjectsList)
+	h := chain(mux, tenantMW(config{}))
+	for _, k := range keys {
+		req := httptest.NewRequest(http.MethodPut, "/v0/objects?key="+url.QueryEscape(k), strings.NewReader(k))
+		req.Header.Set("X-Tenant-Id", "t1")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	return h
+}
+
+func objectKeys(items []objectMeta) string {
+	keys := make([]string, 0, len(items))
+	for _, m := range items {
+		keys = append(keys, m.Key)
+	}
+	return strings.Join(keys, ",")
+}
+
+func TestListPrefix(t *testing.T) {
+	h := newListTestHandler(t, "reports/b", "reports/a", "other/x", "reportsX")
+	got := listObjects(t, h, "t1", "prefix=reports/")
+	if objectKeys(got.Objects) != "reports/a,reports/b" || got.NextCursor != "" {
+		t.Fatalf("unexpected listing: %+v", got)
+	}
+	if got := listObjects(t, h, "t1", ""); got.Count != 4 {
+		t.Fatalf("expected all 4 keys without prefix, got %d", got.Count)
+	}
+}
+
+func TestListEmptyTenant(t *testing.T) {
+	h := newListTestHandler(t, "a", "b")
+	got := listObjects(t, h, "t2", "")
+	if got.Count != 0 || len(got.Objects) != 0 || got.NextCursor != "" {
+		t.Fatalf("expected empty listing for other tenant, got %+v", got)
+	}
+}
+
+func TestListCursorPagination(t *testing.T) {
+	h := newListTestHandler(t, "k5", "k1", "k4", "k2", "k3")
+	var pages []string
+	cursor := ""
+	for i := 0; i < 5; i++ {
+		q := "limit=2"
+		if cursor != "" {
+			q += "&cursor=" + cursor
+		}
+		page := listObjects(t, h, "t1", q)
+		pages = append(pages, objectKeys(page.Objects))
+		cursor = page.NextCursor
+		if cursor == "" {
+			break
+		}
+	}
+	if got := strings.Join(pages, "|"); got != "k1,k2|k3,k4|k5" {
+		t.Fatalf("unexpected pages: %s", got)
+	}
+}
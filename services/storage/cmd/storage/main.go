@@ -5,6 +5,8 @@ import (
 
 	"crypto/sha256"
 
+	"encoding/base64"
+
 	"encoding/hex"
 
 	"encoding/json"
@@ -76,6 +78,18 @@ type config struct {
 	// RequireTenant forces X-Tenant-Id on /v0/* endpoints when true.
 
 	RequireTenant bool
+
+	// Backend selects the object store: "memory" (default) or "file".
+
+	Backend string
+
+	// DataDir is the root directory of the file backend.
+
+	DataDir string
+
+	// SweepInterval controls how often expired objects are purged (<=0 disables).
+
+	SweepInterval time.Duration
 }
 
 func loadConfig() config {
@@ -100,6 +114,12 @@ func loadConfig() config {
 
 		MaxHeaderBytes: getenvInt("STORAGE_MAX_HEADER_BYTES", 1<<20), // 1MiB
 
+		Backend: strings.ToLower(strings.TrimSpace(getenv("STORAGE_BACKEND", backendMemory))),
+
+		DataDir: getenv("STORAGE_DATA_DIR", "data"),
+
+		SweepInterval: getenvDuration("STORAGE_SWEEP_INTERVAL", time.Minute),
+
 	}
 
 	// Tenant rules:
@@ -169,8 +189,19 @@ logger.Info("service_start", map[string]any{
 		"tenant_required": cfg.RequireTenant,
 
 		"max_object_bytes": cfg.MaxObjectBytes,
+
+		"backend": cfg.Backend,
 	})
-store := newObjectStore()
+store, err := newObjectStore(cfg)
+if err != nil {
+
+		logger.Error("store_open_failed", map[string]any{"backend": cfg.Backend, "data_dir": cfg.DataDir, "error": err.Error()})
+		os.Exit(1)
+
+	}
+sweepCtx, stopSweep := context.WithCancel(context.Background())
+defer stopSweep()
+go runSweeper(sweepCtx, store, cfg.SweepInterval, logger)
 mux := http.NewServeMux()
 api := newAPI(cfg, logger, store)
 
@@ -179,9 +210,10 @@ api := newAPI(cfg, logger, store)
 	mux.HandleFunc("/health", api.handleHealth)
 mux.HandleFunc("/ready", api.handleReady)
 
-	// v0 storage endpoints (in-memory)
+	// v0 storage endpoints
 mux.HandleFunc("/v0/objects", api.handleObjects)
 mux.HandleFunc("/v0/objects/meta", api.handleObjectsMeta)
+mux.HandleFunc("/v0/objects/list", api.handleObjectsList)
 mux.HandleFunc("/v0/stats", api.handleStats)
 handler := chain(
 
@@ -279,12 +311,16 @@ type api struct {
 
 	log *jsonLogger
 
-	store *objectStore
+	store objectStore
+
+	// now is the clock used for expiry; tests replace it.
+
+	now func() time.Time
 }
 
-func newAPI(cfg config, log *jsonLogger, store *objectStore) *api {
+func newAPI(cfg config, log *jsonLogger, store objectStore) *api {
 
-	return &api{cfg: cfg, log: log, store: store}
+	return &api{cfg: cfg, log: log, store: store, now: time.Now}
 }
 func (a *api) handleHealth(w http.ResponseWriter, r *http.Request) {
 
@@ -330,9 +366,7 @@ func (a *api) handleReady(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, r, http.StatusOK, resp)
 }
 
-// In-memory object API.
-// IMPORTANT: This is an in-memory store only (no persistence). It is safe for local/dev and placeholder use.
-// Replace/extend with durable storage in future files.
+// Object API. Persistence depends on the configured backend (see newObjectStore).
 func (a *api) handleObjects(w http.ResponseWriter, r *http.Request) {
 
 	// Tenant enforcement occurs in middleware for /v0/*.
@@ -386,6 +420,69 @@ if !ok {
 	}
 	writeJSON(w, r, http.StatusOK, meta)
 }
+// handleObjectsList returns the caller's keys in sorted order. The cursor is opaque to clients.
+func (a *api) handleObjectsList(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+
+		writeError(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+
+	}
+	tenant := tenantIDFromCtx(r.Context())
+q := r.URL.Query()
+prefix := q.Get("prefix")
+limit := 100
+
+	if v := strings.TrimSpace(q.Get("limit")); v != "" {
+
+		n, err := strconv.Atoi(v)
+if err != nil || n < 1 {
+
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "invalid limit")
+			return
+
+		}
+		if n > 1000 {
+
+			n = 1000
+
+		}
+		limit = n
+
+	}
+	after := ""
+
+	if c := strings.TrimSpace(q.Get("cursor")); c != "" {
+
+		b, err := base64.RawURLEncoding.DecodeString(c)
+if err != nil {
+
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "invalid cursor")
+			return
+
+		}
+		after = string(b)
+
+	}
+	items, more := a.store.list(tenant, prefix, limit, after)
+resp := map[string]any{
+
+		"tenant_id": tenant,
+
+		"prefix": prefix,
+
+		"count": len(items),
+
+		"objects": items,
+	}
+	if more && len(items) > 0 {
+
+		resp["next_cursor"] = base64.RawURLEncoding.EncodeToString([]byte(items[len(items)-1].Key))
+
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
 func (a *api) handleStats(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method != http.MethodGet {
@@ -414,6 +511,14 @@ if key == "" {
 
 	}
 
+	ttl, err := parseTTL(r)
+if err != nil {
+
+		writeError(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+
+	}
+
 	// Enforce size limit deterministically.
 
 	r.Body = http.MaxBytesReader(w, r.Body, a.cfg.MaxObjectBytes)
@@ -451,16 +556,47 @@ etag := `"` + hex.EncodeToString(sum[:]) + `"`
 
 		ETag: etag,
 
-		StoredAtUnix: 0, // no time.Now; store is in-memory only
+		StoredAtUnix: 0, // no time.Now; keeps ETag/meta deterministic
+
+	}
+	if ttl > 0 {
+
+		meta.ExpiresAtUnix = a.now().Add(ttl).Unix()
 
 	}
-	a.store.put(tenant, key, storedObject{
+	// Conditional PUT: If-Match for compare-and-swap, If-None-Match: * for create-only.
+
+	cond := putCondition{
+
+		ifMatch: parseETagList(r.Header.Get("If-Match")),
+
+		createOnly: strings.TrimSpace(r.Header.Get("If-None-Match")) == "*",
+	}
+	if err := a.store.putIf(tenant, key, storedObject{
 
 		body: b,
 
 		meta: meta,
-	})
-w.Header().Set("ETag", etag)
+	}, cond); err != nil {
+
+		switch {
+
+		case errors.Is(err, errObjectExists):
+
+			writeError(w, r, http.StatusConflict, "already_exists", "object already exists")
+		case errors.Is(err, errPreconditionFailed):
+
+			writeError(w, r, http.StatusPreconditionFailed, "precondition_failed", "etag does not match current object")
+		default:
+
+			a.log.Error("store_put_failed", map[string]any{"tenant_id": tenant, "key": key, "error": err.Error()})
+writeError(w, r, http.StatusInternalServerError, "storage_error", "failed to store object")
+
+		}
+		return
+
+	}
+	w.Header().Set("ETag", etag)
 resp := map[string]any{
 
 		"tenant_id": tenant,
@@ -472,11 +608,41 @@ resp := map[string]any{
 		"content_type": meta.ContentType,
 
 		"etag": meta.ETag,
+	}
+	if meta.ExpiresAtUnix > 0 {
+
+		resp["expires_at_unix"] = meta.ExpiresAtUnix
+
+	}
+	if a.cfg.Backend != backendFile {
+
+		resp["note"] = "in-memory storage only"
 
-		"note": "in-memory storage only",
 	}
 	writeJSON(w, r, http.StatusCreated, resp)
 }
+// parseTTL reads the optional expiry from X-Expires-In-Seconds (preferred) or ?ttl=, both in seconds.
+func parseTTL(r *http.Request) (time.Duration, error) {
+
+	v := strings.TrimSpace(r.Header.Get("X-Expires-In-Seconds"))
+if v == "" {
+
+		v = strings.TrimSpace(r.URL.Query().Get("ttl"))
+
+	}
+	if v == "" {
+
+		return 0, nil
+
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+if err != nil || n < 1 {
+
+		return 0, errors.New("invalid ttl: expected a positive number of seconds")
+
+	}
+	return time.Duration(n) * time.Second, nil
+}
 func (a *api) handleGetObject(w http.ResponseWriter, r *http.Request, headOnly bool) {
 
 	tenant := tenantIDFromCtx(r.Context())
@@ -507,19 +673,129 @@ w.WriteHeader(http.StatusNotModified)
 	}
 	w.Header().Set("Content-Type", obj.meta.ContentType)
 w.Header().Set("ETag", obj.meta.ETag)
-w.Header().Set("Content-Length", strconv.FormatInt(obj.meta.SizeBytes, 10))
+w.Header().Set("Accept-Ranges", "bytes")
+if obj.meta.ExpiresAtUnix > 0 {
+
+		w.Header().Set("Expires", time.Unix(obj.meta.ExpiresAtUnix, 0).UTC().Format(http.TimeFormat))
+
+	}
 if headOnly {
 
-		w.WriteHeader(http.StatusOK)
+		// HEAD always reports the full object size.
+
+		w.Header().Set("Content-Length", strconv.FormatInt(obj.meta.SizeBytes, 10))
+w.WriteHeader(http.StatusOK)
 		return
 
 	}
 
+	// Single byte range (RFC 7233); multi-range is not supported.
+
+	if rh := strings.TrimSpace(r.Header.Get("Range")); rh != "" {
+
+		start, end, ok, err := parseByteRange(rh, int64(len(obj.body)))
+if err != nil {
+
+			w.Header().Set("Content-Range", "bytes */"+strconv.Itoa(len(obj.body)))
+writeError(w, r, http.StatusRequestedRangeNotSatisfiable, "range_not_satisfiable", err.Error())
+			return
+
+		}
+		if ok {
+
+			part := obj.body[start : end+1]
+
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(obj.body)))
+w.Header().Set("Content-Length", strconv.Itoa(len(part)))
+w.WriteHeader(http.StatusPartialContent)
+_, _ = w.Write(part)
+			return
+
+		}
+
+	}
+
 	// Raw bytes
 
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Length", strconv.FormatInt(obj.meta.SizeBytes, 10))
+w.WriteHeader(http.StatusOK)
 _, _ = w.Write(obj.body)
 }
+
+// parseByteRange parses a single "bytes=" range against an object of the given size.
+// ok=false means the header uses another unit and should be ignored.
+// Returned offsets are inclusive.
+func parseByteRange(h string, size int64) (start, end int64, ok bool, err error) {
+
+	spec, found := strings.CutPrefix(h, "bytes=")
+if !found {
+
+		return 0, 0, false, nil
+
+	}
+	if strings.Contains(spec, ",") {
+
+		return 0, 0, false, errors.New("multiple ranges are not supported")
+
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+if !found {
+
+		return 0, 0, false, errors.New("malformed range")
+
+	}
+	first = strings.TrimSpace(first)
+last = strings.TrimSpace(last)
+switch {
+
+	case first == "" && last == "":
+
+		return 0, 0, false, errors.New("malformed range")
+	case first == "":
+
+		// Suffix range: last N bytes.
+
+		n, perr := strconv.ParseInt(last, 10, 64)
+if perr != nil || n <= 0 || size == 0 {
+
+			return 0, 0, false, errors.New("unsatisfiable range")
+
+		}
+		if n > size {
+
+			n = size
+
+		}
+		return size - n, size - 1, true, nil
+	default:
+
+		s, perr := strconv.ParseInt(first, 10, 64)
+if perr != nil || s < 0 || s >= size {
+
+			return 0, 0, false, errors.New("unsatisfiable range")
+
+		}
+		e := size - 1
+
+		if last != "" {
+
+			v, perr := strconv.ParseInt(last, 10, 64)
+if perr != nil || v < s {
+
+				return 0, 0, false, errors.New("malformed range")
+
+			}
+			if v < e {
+
+				e = v
+
+			}
+
+		}
+		return s, e, true, nil
+
+	}
+}
 func (a *api) handleDeleteObject(w http.ResponseWriter, r *http.Request) {
 
 	tenant := tenantIDFromCtx(r.Context())
@@ -541,9 +817,84 @@ if !ok {
 }
 
 ////////////////////////////////////////////////////////////////////////////////
-// Store (in-memory)
+// Store
 ////////////////////////////////////////////////////////////////////////////////
 
+const (
+	backendMemory = "memory"
+
+	backendFile = "file"
+)
+
+// objectStore is implemented by memoryStore and fileStore.
+type objectStore interface {
+	put(tenant, key string, obj storedObject) error
+
+	putIf(tenant, key string, obj storedObject, cond putCondition) error
+
+	get(tenant, key string) (storedObject, bool)
+
+	getMeta(tenant, key string) (objectMeta, bool)
+
+	list(tenant, prefix string, limit int, after string) ([]objectMeta, bool)
+
+	del(tenant, key string) bool
+
+	stats() map[string]any
+
+	// sweep purges expired objects and returns how many were removed.
+
+	sweep() int
+}
+
+// runSweeper purges expired objects every interval until ctx is done.
+func runSweeper(ctx context.Context, store objectStore, interval time.Duration, l *jsonLogger) {
+
+	if interval <= 0 {
+
+		return
+
+	}
+	t := time.NewTicker(interval)
+defer t.Stop()
+for {
+
+		select {
+
+		case <-ctx.Done():
+
+			return
+		case <-t.C:
+
+			if n := store.sweep(); n > 0 {
+
+				l.Info("expired_objects_purged", map[string]any{"count": n})
+
+			}
+
+		}
+
+	}
+}
+
+// newObjectStore opens the backend selected by STORAGE_BACKEND.
+func newObjectStore(cfg config) (objectStore, error) {
+
+	switch cfg.Backend {
+
+	case "", backendMemory:
+
+		return newMemoryStore(), nil
+	case backendFile:
+
+		return openFileStore(cfg.DataDir)
+	default:
+
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q (want memory or file)", cfg.Backend)
+
+	}
+}
+
 type objectMeta struct {
 	TenantID string `json:"tenant_id"`
 
@@ -556,28 +907,42 @@ type objectMeta struct {
 	ETag string `json:"etag"`
 
 	StoredAtUnix int64 `json:"stored_at_unix,omitempty"`
+
+	// ExpiresAtUnix is the absolute expiry; 0 means the object never expires.
+
+	ExpiresAtUnix int64 `json:"expires_at_unix,omitempty"`
+}
+
+// expired reports whether the object is past its expiry at now.
+func (m objectMeta) expired(now time.Time) bool {
+
+	return m.ExpiresAtUnix > 0 && now.Unix() >= m.ExpiresAtUnix
 }
 type storedObject struct {
 	body []byte
 
 	meta objectMeta
 }
-type objectStore struct {
+type memoryStore struct {
 	mu sync.RWMutex
 
 	// tenant -> key -> object
 
 	data map[string]map[string]storedObject
+
+	now func() time.Time
 }
 
-func newObjectStore() *objectStore {
+func newMemoryStore() *memoryStore {
 
-	return &objectStore{
+	return &memoryStore{
 
 		data: make(map[string]map[string]storedObject),
+
+		now: time.Now,
 	}
 }
-func (s *objectStore) put(tenant, key string, obj storedObject) {
+func (s *memoryStore) put(tenant, key string, obj storedObject) error {
 
 	s.mu.Lock()
 defer s.mu.Unlock()
@@ -596,8 +961,101 @@ s.data[tenant] = m
 obj.body = bodyCopy
 
 	m[key] = obj
+	return nil
+}
+var (
+	errPreconditionFailed = errors.New("precondition failed")
+
+	errObjectExists = errors.New("object exists")
+)
+
+// putCondition describes the preconditions checked by putIf.
+// An empty ifMatch with createOnly=false is an unconditional put.
+type putCondition struct {
+	ifMatch []string
+
+	createOnly bool
+}
+
+// putIf stores obj only if cond holds against the current object, checked under the same lock as the write.
+func (s *memoryStore) putIf(tenant, key string, obj storedObject, cond putCondition) error {
+
+	s.mu.Lock()
+defer s.mu.Unlock()
+cur, exists := s.data[tenant][key]
+
+	if exists && cur.meta.expired(s.now()) {
+
+		exists = false
+
+	}
+	if err := cond.check(cur.meta, exists); err != nil {
+
+		return err
+
+	}
+	m, ok := s.data[tenant]
+
+	if !ok {
+
+		m = make(map[string]storedObject)
+s.data[tenant] = m
+
+	}
+	obj.body = append([]byte(nil), obj.body...)
+m[key] = obj
+	return nil
+}
+
+// check validates cond against the current object's meta.
+func (cond putCondition) check(cur objectMeta, exists bool) error {
+
+	if cond.createOnly && exists {
+
+		return errObjectExists
+
+	}
+	if len(cond.ifMatch) > 0 {
+
+		if !exists || !etagMatches(cond.ifMatch, cur.ETag) {
+
+			return errPreconditionFailed
+
+		}
+
+	}
+	return nil
+}
+
+// parseETagList splits an If-Match style header into its entity tags.
+func parseETagList(h string) []string {
+
+	out := make([]string, 0, 2)
+for _, part := range strings.Split(h, ",") {
+
+		if t := strings.TrimSpace(part); t != "" {
+
+			out = append(out, strings.TrimPrefix(t, "W/"))
+
+		}
+
+	}
+	return out
 }
-func (s *objectStore) get(tenant, key string) (storedObject, bool) {
+func etagMatches(candidates []string, etag string) bool {
+
+	for _, c := range candidates {
+
+		if c == "*" || c == etag {
+
+			return true
+
+		}
+
+	}
+	return false
+}
+func (s *memoryStore) get(tenant, key string) (storedObject, bool) {
 
 	s.mu.RLock()
 defer s.mu.RUnlock()
@@ -610,7 +1068,7 @@ m, ok := s.data[tenant]
 	}
 	obj, ok := m[key]
 
-	if !ok {
+	if !ok || obj.meta.expired(s.now()) {
 
 		return storedObject{}, false
 
@@ -624,7 +1082,7 @@ m, ok := s.data[tenant]
 	}
 	return out, true
 }
-func (s *objectStore) getMeta(tenant, key string) (objectMeta, bool) {
+func (s *memoryStore) getMeta(tenant, key string) (objectMeta, bool) {
 
 	s.mu.RLock()
 defer s.mu.RUnlock()
@@ -637,14 +1095,48 @@ m, ok := s.data[tenant]
 	}
 	obj, ok := m[key]
 
-	if !ok {
+	if !ok || obj.meta.expired(s.now()) {
 
 		return objectMeta{}, false
 
 	}
 	return obj.meta, true
 }
-func (s *objectStore) del(tenant, key string) bool {
+// list returns up to limit objects whose key has prefix and sorts after the given key.
+// more reports whether further matches exist.
+func (s *memoryStore) list(tenant, prefix string, limit int, after string) ([]objectMeta, bool) {
+
+	s.mu.RLock()
+defer s.mu.RUnlock()
+now := s.now()
+keys := make([]string, 0, len(s.data[tenant]))
+for k, obj := range s.data[tenant] {
+
+		if strings.HasPrefix(k, prefix) && k > after && !obj.meta.expired(now) {
+
+			keys = append(keys, k)
+
+		}
+
+	}
+	sort.Strings(keys)
+more := false
+
+	if limit > 0 && len(keys) > limit {
+
+		keys = keys[:limit]
+		more = true
+
+	}
+	out := make([]objectMeta, 0, len(keys))
+for _, k := range keys {
+
+		out = append(out, s.data[tenant][k].meta)
+
+	}
+	return out, more
+}
+func (s *memoryStore) del(tenant, key string) bool {
 
 	s.mu.Lock()
 defer s.mu.Unlock()
@@ -655,7 +1147,9 @@ m, ok := s.data[tenant]
 		return false
 
 	}
-	if _, ok := m[key]; !ok {
+	obj, ok := m[key]
+
+	if !ok {
 
 		return false
 
@@ -666,17 +1160,70 @@ if len(m) == 0 {
 		delete(s.data, tenant)
 
 	}
-	return true
+	return !obj.meta.expired(s.now())
 }
-func (s *objectStore) stats() map[string]any {
+func (s *memoryStore) sweep() int {
+
+	s.mu.Lock()
+defer s.mu.Unlock()
+now := s.now()
+n := 0
+
+	for t, m := range s.data {
+
+		for k, obj := range m {
+
+			if obj.meta.expired(now) {
+
+				delete(m, k)
+n++
+
+			}
+
+		}
+		if len(m) == 0 {
+
+			delete(s.data, t)
+
+		}
+
+	}
+	return n
+}
+func (s *memoryStore) stats() map[string]any {
 
 	s.mu.RLock()
 defer s.mu.RUnlock()
-tenants := make([]string, 0, len(s.data))
+now := s.now()
+sizes := make(map[string][]int64, len(s.data))
+for t, m := range s.data {
+
+		for _, obj := range m {
+
+			if obj.meta.expired(now) {
+
+				continue
+
+			}
+			sizes[t] = append(sizes[t], obj.meta.SizeBytes)
+
+		}
+
+	}
+	out := storeStats(sizes)
+out["backend"] = backendMemory
+out["note"] = "in-memory only"
+	return out
+}
+
+// storeStats summarizes object sizes per tenant.
+func storeStats(sizes map[string][]int64) map[string]any {
+
+	tenants := make([]string, 0, len(sizes))
 totalObjects := 0
 
 	totalBytes := int64(0)
-for t := range s.data {
+for t := range sizes {
 
 		tenants = append(tenants, t)
 
@@ -685,16 +1232,14 @@ for t := range s.data {
 perTenant := make([]map[string]any, 0, len(tenants))
 for _, t := range tenants {
 
-		m := s.data[t]
-
 		count := 0
 
 		bytes := int64(0)
-for _, obj := range m {
+for _, n := range sizes[t] {
 
 			count++
 
-			bytes += obj.meta.SizeBytes
+			bytes += n
 
 		}
 		totalObjects += count
@@ -726,8 +1271,6 @@ for _, obj := range m {
 		"total_bytes": totalBytes,
 
 		"per_tenant": perTenant,
-
-		"note": "in-memory only",
 	}
 }
 
@@ -735,7 +1278,9 @@ for _, obj := range m {
 // Middleware
 ////////////////////////////////////////////////////////////////////////////////
 
-type middleware func(http.Handler) // http.Handler func chain(h http.Handler, mws ...middleware) http.Handler {
+type middleware func(http.Handler) http.Handler
+
+func chain(h http.Handler, mws ...middleware) http.Handler {
 
 	for i := len(mws) - 1; i >= 0; i-- {
 
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func getObject(h http.Handler, method, rangeHeader string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/v0/objects?key=doc", nil)
+	req.Header.Set("X-Tenant-Id", "t1")
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRangeGet(t *testing.T) {
+	_, h := newTestAPI()
+	putObject(h, "0123456789", nil)
+
+	cases := []struct {
+		name         string
+		rangeHeader  string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{"full body", "", http.StatusOK, "0123456789", ""},
+		{"closed range", "bytes=2-5", http.StatusPartialContent, "2345", "bytes 2-5/10"},
+		{"end past size", "bytes=8-20", http.StatusPartialContent, "89", "bytes 8-9/10"},
+		{"open-ended", "bytes=7-", http.StatusPartialContent, "789", "bytes 7-9/10"},
+		{"suffix", "bytes=-3", http.StatusPartialContent, "789", "bytes 7-9/10"},
+		{"suffix larger than object", "bytes=-50", http.StatusPartialContent, "0123456789", "bytes 0-9/10"},
+		{"start past end", "bytes=10-", http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+		{"reversed", "bytes=5-2", http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+		{"malformed", "bytes=abc", http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+		{"multi-range", "bytes=0-1,4-5", http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+		{"other unit ignored", "items=0-1", http.StatusOK, "0123456789", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := getObject(h, http.MethodGet, tc.rangeHeader)
+			if rec.Code != tc.status {
+				t.Fatalf("status %d want %d", rec.Code, tc.status)
+			}
+			if got := rec.Header().Get("Content-Range"); got != tc.contentRange {
+				t.Fatalf("Content-Range %q want %q", got, tc.contentRange)
+			}
+			if tc.body != "" {
+				if rec.Body.String() != tc.body {
+					t.Fatalf("body %q want %q", rec.Body.String(), tc.body)
+				}
+				if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(len(tc.body)) {
+					t.Fatalf("Content-Length %s want %d", got, len(tc.body))
+				}
+			}
+		})
+	}
+
+	head := getObject(h, http.MethodHead, "bytes=0-1")
+	if head.Code != http.StatusOK || head.Header().Get("Content-Length") != "10" {
+		t.Fatalf("HEAD should report full size, got %d len=%s", head.Code, head.Header().Get("Content-Length"))
+	}
+}
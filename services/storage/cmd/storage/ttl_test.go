@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTTLTestHandler(t *testing.T, store objectStore, clk *fakeClock) http.Handler {
+	t.Helper()
+	a := newAPI(config{MaxObjectBytes: 1 << 20}, newJSONLogger(io.Discard), store)
+	a.now = clk.now
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v0/objects", a.handleObjects)
+	mux.HandleFunc("/v0/objects/meta", a.handleObjectsMeta)
+	mux.HandleFunc("/v0/objects/list", a.handleObjectsList)
+	mux.HandleFunc("/v0/stats", a.handleStats)
+	return chain(mux, tenantMW(config{}))
+}
+
+func ttlRequest(h http.Handler, method, target string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader("cached"))
+	req.Header.Set("X-Tenant-Id", "t1")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestObjectExpiry(t *testing.T) {
+	clk := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	mem := newMemoryStore()
+	mem.now = clk.now
+	file, err := openFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.now = clk.now
+
+	for name, store := range map[string]objectStore{"memory": mem, "file": file} {
+		t.Run(name, func(t *testing.T) {
+			clk.t = time.Unix(1_700_000_000, 0)
+			h := newTTLTestHandler(t, store, clk)
+			rec := ttlRequest(h, http.MethodPut, "/v0/objects?key=a", map[string]string{"X-Expires-In-Seconds": "60"})
+			if rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), `"expires_at_unix":1700000060`) {
+				t.Fatalf("put with header: %d %s", rec.Code, rec.Body.String())
+			}
+			ttlRequest(h, http.MethodPut, "/v0/objects?key=b&ttl=120", nil)
+			ttlRequest(h, http.MethodPut, "/v0/objects?key=c", nil)
+
+			clk.advance(59 * time.Second)
+			if rec := ttlRequest(h, http.MethodGet, "/v0/objects?key=a", nil); rec.Code != http.StatusOK || rec.Header().Get("Expires") == "" {
+				t.Fatalf("object expired early: %d", rec.Code)
+			}
+
+			clk.advance(time.Second)
+			for _, path := range []string{"/v0/objects?key=a", "/v0/objects/meta?key=a"} {
+				if rec := ttlRequest(h, http.MethodGet, path, nil); rec.Code != http.StatusNotFound {
+					t.Fatalf("GET %s after expiry: %d", path, rec.Code)
+				}
+			}
+			if rec := ttlRequest(h, http.MethodPut, "/v0/objects?key=a", map[string]string{"If-None-Match": "*", "X-Expires-In-Seconds": "30"}); rec.Code != http.StatusCreated {
+				t.Fatalf("create-only over an expired object: %d", rec.Code)
+			}
+
+			clk.advance(time.Minute)
+			var stats struct {
+				TotalObjects int `json:"total_objects"`
+			}
+			_ = json.Unmarshal(ttlRequest(h, http.MethodGet, "/v0/stats", nil).Body.Bytes(), &stats)
+			if stats.TotalObjects != 1 {
+				t.Fatalf("stats should only count c, got %d", stats.TotalObjects)
+			}
+			if got := listObjects(t, h, "t1", ""); objectKeys(got.Objects) != "c" {
+				t.Fatalf("listing should hide expired objects: %+v", got)
+			}
+
+			if n := store.sweep(); n != 2 {
+				t.Fatalf("expected sweep to purge a and b, got %d", n)
+			}
+			if n := store.sweep(); n != 0 {
+				t.Fatalf("second sweep should be a no-op, got %d", n)
+			}
+		})
+	}
+}
+
+func TestInvalidTTL(t *testing.T) {
+	h := newTTLTestHandler(t, newMemoryStore(), &fakeClock{t: time.Unix(0, 0)})
+	for _, target := range []string{"/v0/objects?key=a&ttl=0", "/v0/objects?key=a&ttl=soon"} {
+		if rec := ttlRequest(h, http.MethodPut, target, nil); rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", target, rec.Code)
+		}
+	}
+	if rec := ttlRequest(h, http.MethodPut, "/v0/objects?key=a", map[string]string{"X-Expires-In-Seconds": "-5"}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("negative header: expected 400, got %d", rec.Code)
+	}
+}
@@ -33,7 +33,8 @@ export default function App() {
   const [pulseMsg, setPulseMsg] = useState("Waiting for heartbeat...");
 
   useEffect(() => {
-    const es = new EventSource("/api/events");
+    let es: EventSource;
+    let reconnect: ReturnType<typeof setTimeout> | undefined;
     const onHeartbeat = (evt: MessageEvent) => {
       try {
         const data = JSON.parse(evt.data || "{}");
@@ -52,13 +53,31 @@ export default function App() {
       setPulseOk(false);
       setPulseMsg("Disconnected");
     };
-    es.addEventListener("heartbeat", onHeartbeat);
-    es.addEventListener("error", onError as EventListener);
-    return () => {
+    // The gateway sends "shutdown" before a restart; reconnect right away
+    // (to the next instance) instead of waiting out the browser's retry delay.
+    const onShutdown = () => {
+      setPulseOk(false);
+      setPulseMsg("Reconnecting...");
+      close();
+      reconnect = setTimeout(connect, 250);
+    };
+    const connect = () => {
+      es = new EventSource("/api/events");
+      es.addEventListener("heartbeat", onHeartbeat);
+      es.addEventListener("shutdown", onShutdown);
+      es.addEventListener("error", onError as EventListener);
+    };
+    const close = () => {
       es.removeEventListener("heartbeat", onHeartbeat);
+      es.removeEventListener("shutdown", onShutdown);
       es.removeEventListener("error", onError as EventListener);
       es.close();
     };
+    connect();
+    return () => {
+      clearTimeout(reconnect);
+      close();
+    };
   }, []);
 
   useEffect(() => {
@@ -186,8 +186,8 @@ export default function Crypto() {
         const payload = JSON.parse((evt as MessageEvent).data || "{}");
         if (Array.isArray(payload.rows)) {
           setRows(payload.rows);
-          setLastUpdated(payload.updated || nowIso());
-          setStatus("Live");
+          setLastUpdated(payload.updated_at || payload.updated || nowIso());
+          setStatus(payload.data_status === "stale" ? "Stale" : "Live");
         }
       } catch {
         setStatus("Stream error");
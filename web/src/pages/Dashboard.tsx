@@ -44,7 +44,7 @@ export default function Dashboard() {
     const refresh = async () => {
       const sum = await fetchJson("/api/summary");
       if (sum) {
-        lastUpdateRef.current = sum.last_updated || nowIso();
+        lastUpdateRef.current = sum.updated_at || sum.last_updated || nowIso();
         setSummary({
           totalResults: sum.total_results ?? 0,
           activeProfiles: sum.active_profiles ?? 0,